@@ -1,6 +1,9 @@
 package codec
 
-import "errors"
+import (
+    "errors"
+    "fmt"
+)
 
 // Table 31 – Profiles
 // index      profile
@@ -131,8 +134,10 @@ func NewAdtsFrameHeader() *ADTS_Frame_Header {
     }
 }
 
-func (frame *ADTS_Frame_Header) Decode(aac []byte) {
-    _ = aac[6]
+func (frame *ADTS_Frame_Header) Decode(aac []byte) error {
+    if len(aac) < 7 {
+        return &ParseError{What: "adts header", Offset: len(aac), Err: ErrTruncated}
+    }
     frame.Fix_Header.ID = aac[1] >> 3
     frame.Fix_Header.Layer = aac[1] >> 1 & 0x03
     frame.Fix_Header.Protection_absent = aac[1] & 0x01
@@ -147,6 +152,7 @@ func (frame *ADTS_Frame_Header) Decode(aac []byte) {
     frame.Variable_Header.Frame_length = (uint16(aac[3]&0x03) << 11) | (uint16(aac[4]) << 3) | (uint16(aac[5]>>5) & 0x07)
     frame.Variable_Header.Adts_buffer_fullness = (uint16(aac[5]&0x1F) << 6) | uint16(aac[6]>>2)
     frame.Variable_Header.Number_of_raw_data_blocks_in_frame = aac[6] & 0x03
+    return nil
 }
 
 func (frame *ADTS_Frame_Header) Encode() []byte {
@@ -168,30 +174,160 @@ func (frame *ADTS_Frame_Header) Encode() []byte {
     return hdr
 }
 
+// 不在表中的采样率返回0x0F, AudioSpecificConfig中使用samplingFrequency(24 bits)显式表示
 func SampleToAACSampleIndex(sampling int) int {
     for i, v := range AAC_Sampling_Idx {
         if v == sampling {
             return i
         }
     }
-    panic("not Found AAC Sample Index")
+    return AAC_SAMPLE_ESCAPE
 }
 
+// idx无效时返回0
 func AACSampleIdxToSample(idx int) int {
+    if idx < 0 || idx >= len(AAC_Sampling_Idx) {
+        return 0
+    }
     return AAC_Sampling_Idx[idx]
 }
 
-// +--------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------+
-// |  audio object type(5 bits)  |  sampling frequency index(4 bits) |   channel configuration(4 bits)  | GA framelength flag(1 bits) |  GA Depends on core coder(1 bits) | GA Extension Flag(1 bits) |
-// +--------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------------+
+const AAC_SAMPLE_ESCAPE = 0x0F
 
+// Table 1.17 – Audio Object Types
+const (
+    AOT_NULL            = 0
+    AOT_AAC_MAIN        = 1
+    AOT_AAC_LC          = 2
+    AOT_AAC_SSR         = 3
+    AOT_AAC_LTP         = 4
+    AOT_SBR             = 5
+    AOT_AAC_SCALABLE    = 6
+    AOT_TWINVQ          = 7
+    AOT_CELP            = 8
+    AOT_HVXC            = 9
+    AOT_ER_AAC_LC       = 17
+    AOT_ER_AAC_LTP      = 19
+    AOT_ER_AAC_SCALABLE = 20
+    AOT_ER_TWINVQ       = 21
+    AOT_ER_BSAC         = 22
+    AOT_ER_AAC_LD       = 23
+    AOT_ER_CELP         = 24
+    AOT_ER_HVXC         = 25
+    AOT_ER_HILN         = 26
+    AOT_ER_PARAM        = 27
+    AOT_PS              = 29
+    AOT_ESCAPE          = 31
+    AOT_ER_AAC_ELD      = 39
+)
+
+// Table 1.15 – Syntax of AudioSpecificConfig()
+// AudioSpecificConfig () {
+//     audioObjectType = GetAudioObjectType();
+//     samplingFrequencyIndex;                                     4
+//     if ( samplingFrequencyIndex == 0xf ) {
+//         samplingFrequency;                                      24
+//     }
+//     channelConfiguration;                                       4
+//     sbrPresentFlag = -1;
+//     psPresentFlag = -1;
+//     if ( audioObjectType == 5 || audioObjectType == 29 ) {
+//         extensionAudioObjectType = 5;
+//         sbrPresentFlag = 1;
+//         if ( audioObjectType == 29 ) {
+//             psPresentFlag = 1;
+//         }
+//         extensionSamplingFrequencyIndex;                        4
+//         if ( extensionSamplingFrequencyIndex == 0xf )
+//             extensionSamplingFrequency;                         24
+//         audioObjectType = GetAudioObjectType();
+//         if ( audioObjectType == 22 )
+//             extensionChannelConfiguration;                      4
+//     }
+//     else {
+//         extensionAudioObjectType = 0;
+//     }
+//     switch (audioObjectType) {
+//     case 1: case 2: case 3: case 4: case 6: case 7:
+//     case 17: case 19: case 20: case 21: case 22: case 23:
+//         GASpecificConfig();
+//         break:
+//     ...
+//     }
+//     switch (audioObjectType) {
+//     case 17: case 19: case 20: case 21: case 22: case 23: case 24: case 25: case 26: case 27: case 39:
+//         epConfig;                                               2
+//         if ( epConfig == 2 || epConfig == 3 ) {
+//             ErrorProtectionSpecificConfig();
+//         }
+//         if ( epConfig == 3 ) {
+//             directMapping;                                      1
+//             if ( ! directMapping ) {
+//                 /* tbd */
+//             }
+//         }
+//     }
+//     if ( extensionAudioObjectType != 5 && bits_to_decode() >= 16 ) {
+//         syncExtensionType;                                      11
+//         if (syncExtensionType == 0x2b7) {
+//             extensionAudioObjectType = GetAudioObjectType();
+//             if ( extensionAudioObjectType == 5 ) {
+//                 sbrPresentFlag;                                 1
+//                 if (sbrPresentFlag == 1) {
+//                     extensionSamplingFrequencyIndex;            4
+//                     if ( extensionSamplingFrequencyIndex == 0xf ) {
+//                         extensionSamplingFrequency;             24
+//                     }
+//                     if ( bits_to_decode() >= 12 ) {
+//                         syncExtensionType;                      11
+//                         if (syncExtensionType == 0x548) {
+//                             psPresentFlag;                      1
+//                         }
+//                     }
+//                 }
+//             }
+//             if ( extensionAudioObjectType == 22 ) {
+//                 sbrPresentFlag;                                 1
+//                 if (sbrPresentFlag == 1) {
+//                     extensionSamplingFrequencyIndex;            4
+//                     if ( extensionSamplingFrequencyIndex == 0xf ) {
+//                         extensionSamplingFrequency;             24
+//                     }
+//                 }
+//                 extensionChannelConfiguration;                  4
+//             }
+//         }
+//     }
+// }
+//
+// Audio_object_type 为码流中第一个audioObjectType, 隐式(hierarchical)信令时为5或者29, 核心编码类型为Core_audio_object_type
+// 兼容旧版本, 只有AAC LC等简单配置时与原来的2字节格式一致
 type AudioSpecificConfiguration struct {
-    Audio_object_type        uint8
-    Sample_freq_index        uint8
-    Channel_configuration    uint8
-    GA_framelength_flag      uint8
-    GA_depends_on_core_coder uint8
-    GA_extension_flag        uint8
+    Audio_object_type                    uint8
+    Sample_freq_index                    uint8
+    Sampling_frequency                   uint32
+    Channel_configuration                uint8
+    Extension_audio_object_type          uint8
+    Sbr_present_flag                     uint8
+    Ps_present_flag                      uint8
+    Extension_sample_freq_index          uint8
+    Extension_sampling_frequency         uint32
+    Core_audio_object_type               uint8
+    Extension_channel_configuration      uint8
+    GA_framelength_flag                  uint8
+    GA_depends_on_core_coder             uint8
+    GA_core_coder_delay                  uint16
+    GA_extension_flag                    uint8
+    Pce                                  *ProgramConfigElement
+    Layer_nr                             uint8
+    Num_of_sub_frame                     uint8
+    Layer_length                         uint16
+    Aac_section_data_resilience_flag     uint8
+    Aac_scalefactor_data_resilience_flag uint8
+    Aac_spectral_data_resilience_flag    uint8
+    Extension_flag3                      uint8
+    Ep_config                            uint8
+    Direct_mapping                       uint8
 }
 
 func NewAudioSpecificConfiguration() *AudioSpecificConfiguration {
@@ -205,28 +341,447 @@ func NewAudioSpecificConfiguration() *AudioSpecificConfiguration {
     }
 }
 
-func (asc *AudioSpecificConfiguration) Encode() []byte {
-    buf := make([]byte, 2)
-    buf[0] = (asc.Audio_object_type & 0x1f << 3) | (asc.Sample_freq_index & 0x0F >> 1)
-    buf[1] = (asc.Sample_freq_index & 0x0F << 7) | (asc.Channel_configuration & 0x0F << 3) | (asc.GA_framelength_flag & 0x01 << 2) | (asc.GA_depends_on_core_coder & 0x01 << 1) | (asc.GA_extension_flag & 0x01)
-    return buf
+// 隐式信令(audioObjectType为5或者29)
+func (asc *AudioSpecificConfiguration) hierarchicalSbr() bool {
+    return asc.Audio_object_type == AOT_SBR || asc.Audio_object_type == AOT_PS
 }
 
-func (asc *AudioSpecificConfiguration) Decode(buf []byte) error {
+// 核心编码器的audioObjectType, HE-AAC返回2
+func (asc *AudioSpecificConfiguration) ObjectType() uint8 {
+    if asc.hierarchicalSbr() {
+        return asc.Core_audio_object_type
+    }
+    return asc.Audio_object_type
+}
+
+// 核心编码器的采样率
+func (asc *AudioSpecificConfiguration) SampleRate() int {
+    if asc.Sample_freq_index == AAC_SAMPLE_ESCAPE {
+        return int(asc.Sampling_frequency)
+    }
+    return AACSampleIdxToSample(int(asc.Sample_freq_index))
+}
 
+// 解码输出的采样率, 存在SBR时为扩展采样率
+func (asc *AudioSpecificConfiguration) OutputSampleRate() int {
+    if asc.Sbr_present_flag == 1 {
+        if asc.Extension_sample_freq_index == AAC_SAMPLE_ESCAPE {
+            return int(asc.Extension_sampling_frequency)
+        }
+        return AACSampleIdxToSample(int(asc.Extension_sample_freq_index))
+    }
+    return asc.SampleRate()
+}
+
+// Table 1.19 – Channel Configuration, 0表示由PCE描述
+var aacChannelCount [16]int = [16]int{0, 1, 2, 3, 4, 5, 6, 8, 0, 0, 0, 7, 8, 24, 8, 0}
+
+// 声道数, PS解码输出双声道
+func (asc *AudioSpecificConfiguration) ChannelCount() int {
+    if asc.Ps_present_flag == 1 && asc.Channel_configuration == 1 {
+        return 2
+    }
+    if asc.Channel_configuration == 0 && asc.Pce != nil {
+        return asc.Pce.ChannelCount()
+    }
+    return aacChannelCount[asc.Channel_configuration&0x0F]
+}
+
+// 每帧采样数, 不包含SBR
+func (asc *AudioSpecificConfiguration) FrameLength() int {
+    switch asc.ObjectType() {
+    case AOT_ER_AAC_LD, AOT_ER_AAC_ELD:
+        if asc.GA_framelength_flag == 1 {
+            return 480
+        }
+        return 512
+    }
+    if asc.GA_framelength_flag == 1 {
+        return 960
+    }
+    return 1024
+}
+
+func (asc *AudioSpecificConfiguration) Encode() []byte {
+    bsw := NewBitStreamWriter(8)
+    asc.encode(bsw)
+    return bsw.Bits()
+}
+
+func (asc *AudioSpecificConfiguration) Decode(buf []byte) (err error) {
     if len(buf) < 2 {
         return errors.New("len of buf < 2 ")
     }
+    bs := NewBitStream(buf)
+    if err = asc.decode(bs, len(buf)*8); err != nil {
+        return err
+    }
+    if bs.Err() != nil {
+        return fmt.Errorf("audio specific config: %w", bs.Err())
+    }
+    return nil
+}
 
-    asc.Audio_object_type = buf[0] >> 3
-    asc.Sample_freq_index = (buf[0] & 0x07 << 1) | (buf[1] >> 7)
-    asc.Channel_configuration = buf[1] >> 3 & 0x0F
-    asc.GA_framelength_flag = buf[1] >> 2 & 0x01
-    asc.GA_depends_on_core_coder = buf[1] >> 1 & 0x01
-    asc.GA_extension_flag = buf[1] & 0x01
+func getAudioObjectType(bs *BitStream) uint8 {
+    aot := bs.Uint8(5)
+    if aot == AOT_ESCAPE {
+        aot = 32 + bs.Uint8(6)
+    }
+    return aot
+}
+
+func putAudioObjectType(bsw *BitStreamWriter, aot uint8) {
+    if aot >= AOT_ESCAPE {
+        bsw.PutUint8(AOT_ESCAPE, 5)
+        bsw.PutUint8(aot-32, 6)
+    } else {
+        bsw.PutUint8(aot, 5)
+    }
+}
+
+func isGASpecificConfig(aot uint8) bool {
+    switch aot {
+    case 1, 2, 3, 4, 6, 7, 17, 19, 20, 21, 22, 23:
+        return true
+    }
+    return false
+}
+
+func isErrorResilient(aot uint8) bool {
+    switch aot {
+    case 17, 19, 20, 21, 22, 23, 24, 25, 26, 27, 39:
+        return true
+    }
+    return false
+}
+
+// totalBits为AudioSpecificConfig可用的bit数, 用于bits_to_decode()
+func (asc *AudioSpecificConfiguration) decode(bs *BitStream, totalBits int) error {
+    startBits := bs.RemainBits()
+    bitsToDecode := func() int {
+        return totalBits - (startBits - bs.RemainBits())
+    }
+    asc.Audio_object_type = getAudioObjectType(bs)
+    asc.Sample_freq_index = bs.Uint8(4)
+    if asc.Sample_freq_index == AAC_SAMPLE_ESCAPE {
+        asc.Sampling_frequency = bs.Uint32(24)
+    }
+    asc.Channel_configuration = bs.Uint8(4)
+    aot := asc.Audio_object_type
+    if asc.hierarchicalSbr() {
+        asc.Extension_audio_object_type = AOT_SBR
+        asc.Sbr_present_flag = 1
+        if asc.Audio_object_type == AOT_PS {
+            asc.Ps_present_flag = 1
+        }
+        asc.Extension_sample_freq_index = bs.Uint8(4)
+        if asc.Extension_sample_freq_index == AAC_SAMPLE_ESCAPE {
+            asc.Extension_sampling_frequency = bs.Uint32(24)
+        }
+        asc.Core_audio_object_type = getAudioObjectType(bs)
+        aot = asc.Core_audio_object_type
+        if aot == AOT_ER_BSAC {
+            asc.Extension_channel_configuration = bs.Uint8(4)
+        }
+    }
+    // 其他类型(CELP,HVXC,ALS...)只解析基本字段
+    if !isGASpecificConfig(aot) {
+        return nil
+    }
+    asc.decodeGASpecificConfig(bs, aot, startBits)
+    if isErrorResilient(aot) {
+        asc.Ep_config = bs.Uint8(2)
+        if asc.Ep_config == 2 || asc.Ep_config == 3 {
+            return errors.New("unsupported ErrorProtectionSpecificConfig")
+        }
+    }
+    if asc.Extension_audio_object_type != AOT_SBR && bitsToDecode() >= 16 {
+        if bs.NextBits(11) != 0x2b7 {
+            return nil
+        }
+        bs.SkipBits(11)
+        asc.Extension_audio_object_type = getAudioObjectType(bs)
+        if asc.Extension_audio_object_type == AOT_SBR {
+            asc.Sbr_present_flag = bs.GetBit()
+            if asc.Sbr_present_flag == 1 {
+                asc.Extension_sample_freq_index = bs.Uint8(4)
+                if asc.Extension_sample_freq_index == AAC_SAMPLE_ESCAPE {
+                    asc.Extension_sampling_frequency = bs.Uint32(24)
+                }
+                if bitsToDecode() >= 12 && bs.NextBits(11) == 0x548 {
+                    bs.SkipBits(11)
+                    asc.Ps_present_flag = bs.GetBit()
+                }
+            }
+        }
+        if asc.Extension_audio_object_type == AOT_ER_BSAC {
+            asc.Sbr_present_flag = bs.GetBit()
+            if asc.Sbr_present_flag == 1 {
+                asc.Extension_sample_freq_index = bs.Uint8(4)
+                if asc.Extension_sample_freq_index == AAC_SAMPLE_ESCAPE {
+                    asc.Extension_sampling_frequency = bs.Uint32(24)
+                }
+            }
+            asc.Extension_channel_configuration = bs.Uint8(4)
+        }
+    }
     return nil
 }
 
+// Table 4.1 – Syntax of GASpecificConfig()
+func (asc *AudioSpecificConfiguration) decodeGASpecificConfig(bs *BitStream, aot uint8, startBits int) {
+    asc.GA_framelength_flag = bs.GetBit()
+    asc.GA_depends_on_core_coder = bs.GetBit()
+    if asc.GA_depends_on_core_coder == 1 {
+        asc.GA_core_coder_delay = bs.Uint16(14)
+    }
+    asc.GA_extension_flag = bs.GetBit()
+    if asc.Channel_configuration == 0 {
+        asc.Pce = new(ProgramConfigElement)
+        asc.Pce.decode(bs, startBits)
+    }
+    if aot == AOT_AAC_SCALABLE || aot == AOT_ER_AAC_SCALABLE {
+        asc.Layer_nr = bs.Uint8(3)
+    }
+    if asc.GA_extension_flag == 1 {
+        if aot == AOT_ER_BSAC {
+            asc.Num_of_sub_frame = bs.Uint8(5)
+            asc.Layer_length = bs.Uint16(11)
+        }
+        if aot == AOT_ER_AAC_LC || aot == AOT_ER_AAC_LTP || aot == AOT_ER_AAC_SCALABLE || aot == AOT_ER_AAC_LD {
+            asc.Aac_section_data_resilience_flag = bs.GetBit()
+            asc.Aac_scalefactor_data_resilience_flag = bs.GetBit()
+            asc.Aac_spectral_data_resilience_flag = bs.GetBit()
+        }
+        asc.Extension_flag3 = bs.GetBit()
+    }
+}
+
+func (asc *AudioSpecificConfiguration) encode(bsw *BitStreamWriter) {
+    startBits := bsw.ByteOffset()*8 + bsw.BitOffset()
+    putAudioObjectType(bsw, asc.Audio_object_type)
+    bsw.PutUint8(asc.Sample_freq_index, 4)
+    if asc.Sample_freq_index == AAC_SAMPLE_ESCAPE {
+        bsw.PutUint32(asc.Sampling_frequency, 24)
+    }
+    bsw.PutUint8(asc.Channel_configuration, 4)
+    aot := asc.Audio_object_type
+    if asc.hierarchicalSbr() {
+        bsw.PutUint8(asc.Extension_sample_freq_index, 4)
+        if asc.Extension_sample_freq_index == AAC_SAMPLE_ESCAPE {
+            bsw.PutUint32(asc.Extension_sampling_frequency, 24)
+        }
+        putAudioObjectType(bsw, asc.Core_audio_object_type)
+        aot = asc.Core_audio_object_type
+        if aot == AOT_ER_BSAC {
+            bsw.PutUint8(asc.Extension_channel_configuration, 4)
+        }
+    }
+    if !isGASpecificConfig(aot) {
+        return
+    }
+    asc.encodeGASpecificConfig(bsw, aot, startBits)
+    if isErrorResilient(aot) {
+        bsw.PutUint8(asc.Ep_config, 2)
+    }
+    // 显式(backward compatible)信令
+    if asc.hierarchicalSbr() {
+        return
+    }
+    if asc.Extension_audio_object_type == AOT_SBR {
+        bsw.PutUint16(0x2b7, 11)
+        putAudioObjectType(bsw, asc.Extension_audio_object_type)
+        bsw.PutUint8(asc.Sbr_present_flag, 1)
+        if asc.Sbr_present_flag == 1 {
+            bsw.PutUint8(asc.Extension_sample_freq_index, 4)
+            if asc.Extension_sample_freq_index == AAC_SAMPLE_ESCAPE {
+                bsw.PutUint32(asc.Extension_sampling_frequency, 24)
+            }
+            if asc.Ps_present_flag == 1 {
+                bsw.PutUint16(0x548, 11)
+                bsw.PutUint8(1, 1)
+            }
+        }
+    } else if asc.Extension_audio_object_type == AOT_ER_BSAC {
+        bsw.PutUint16(0x2b7, 11)
+        putAudioObjectType(bsw, asc.Extension_audio_object_type)
+        bsw.PutUint8(asc.Sbr_present_flag, 1)
+        if asc.Sbr_present_flag == 1 {
+            bsw.PutUint8(asc.Extension_sample_freq_index, 4)
+            if asc.Extension_sample_freq_index == AAC_SAMPLE_ESCAPE {
+                bsw.PutUint32(asc.Extension_sampling_frequency, 24)
+            }
+        }
+        bsw.PutUint8(asc.Extension_channel_configuration, 4)
+    }
+}
+
+func (asc *AudioSpecificConfiguration) encodeGASpecificConfig(bsw *BitStreamWriter, aot uint8, startBits int) {
+    bsw.PutUint8(asc.GA_framelength_flag, 1)
+    bsw.PutUint8(asc.GA_depends_on_core_coder, 1)
+    if asc.GA_depends_on_core_coder == 1 {
+        bsw.PutUint16(asc.GA_core_coder_delay, 14)
+    }
+    bsw.PutUint8(asc.GA_extension_flag, 1)
+    if asc.Channel_configuration == 0 && asc.Pce != nil {
+        asc.Pce.encode(bsw, startBits)
+    }
+    if aot == AOT_AAC_SCALABLE || aot == AOT_ER_AAC_SCALABLE {
+        bsw.PutUint8(asc.Layer_nr, 3)
+    }
+    if asc.GA_extension_flag == 1 {
+        if aot == AOT_ER_BSAC {
+            bsw.PutUint8(asc.Num_of_sub_frame, 5)
+            bsw.PutUint16(asc.Layer_length, 11)
+        }
+        if aot == AOT_ER_AAC_LC || aot == AOT_ER_AAC_LTP || aot == AOT_ER_AAC_SCALABLE || aot == AOT_ER_AAC_LD {
+            bsw.PutUint8(asc.Aac_section_data_resilience_flag, 1)
+            bsw.PutUint8(asc.Aac_scalefactor_data_resilience_flag, 1)
+            bsw.PutUint8(asc.Aac_spectral_data_resilience_flag, 1)
+        }
+        bsw.PutUint8(asc.Extension_flag3, 1)
+    }
+}
+
+// Table 4.2 – Syntax of program_config_element()
+type PCEElement struct {
+    Is_cpe             uint8
+    Element_tag_select uint8
+}
+
+type ProgramConfigElement struct {
+    Element_instance_tag          uint8
+    Object_type                   uint8
+    Sampling_frequency_index      uint8
+    Mono_mixdown_present          uint8
+    Mono_mixdown_element_number   uint8
+    Stereo_mixdown_present        uint8
+    Stereo_mixdown_element_number uint8
+    Matrix_mixdown_idx_present    uint8
+    Matrix_mixdown_idx            uint8
+    Pseudo_surround_enable        uint8
+    Front_elements                []PCEElement
+    Side_elements                 []PCEElement
+    Back_elements                 []PCEElement
+    Lfe_element_tag_select        []uint8
+    Assoc_data_element_tag_select []uint8
+    Cc_elements                   []PCEElement // Is_cpe 表示 cc_element_is_ind_sw
+    Comment_field_data            []byte
+}
+
+func (pce *ProgramConfigElement) ChannelCount() int {
+    count := len(pce.Lfe_element_tag_select)
+    for _, elements := range [][]PCEElement{pce.Front_elements, pce.Side_elements, pce.Back_elements} {
+        for _, e := range elements {
+            count += 1 + int(e.Is_cpe)
+        }
+    }
+    return count
+}
+
+func decodePCEElements(bs *BitStream, n int) []PCEElement {
+    elements := make([]PCEElement, n)
+    for i := range elements {
+        elements[i].Is_cpe = bs.GetBit()
+        elements[i].Element_tag_select = bs.Uint8(4)
+    }
+    return elements
+}
+
+func encodePCEElements(bsw *BitStreamWriter, elements []PCEElement) {
+    for _, e := range elements {
+        bsw.PutUint8(e.Is_cpe, 1)
+        bsw.PutUint8(e.Element_tag_select, 4)
+    }
+}
+
+// byte_alignment()相对于AudioSpecificConfig的开始位置
+func (pce *ProgramConfigElement) decode(bs *BitStream, startBits int) {
+    pce.Element_instance_tag = bs.Uint8(4)
+    pce.Object_type = bs.Uint8(2)
+    pce.Sampling_frequency_index = bs.Uint8(4)
+    numFront := int(bs.Uint8(4))
+    numSide := int(bs.Uint8(4))
+    numBack := int(bs.Uint8(4))
+    numLfe := int(bs.Uint8(2))
+    numAssocData := int(bs.Uint8(3))
+    numValidCC := int(bs.Uint8(4))
+    pce.Mono_mixdown_present = bs.GetBit()
+    if pce.Mono_mixdown_present == 1 {
+        pce.Mono_mixdown_element_number = bs.Uint8(4)
+    }
+    pce.Stereo_mixdown_present = bs.GetBit()
+    if pce.Stereo_mixdown_present == 1 {
+        pce.Stereo_mixdown_element_number = bs.Uint8(4)
+    }
+    pce.Matrix_mixdown_idx_present = bs.GetBit()
+    if pce.Matrix_mixdown_idx_present == 1 {
+        pce.Matrix_mixdown_idx = bs.Uint8(2)
+        pce.Pseudo_surround_enable = bs.GetBit()
+    }
+    pce.Front_elements = decodePCEElements(bs, numFront)
+    pce.Side_elements = decodePCEElements(bs, numSide)
+    pce.Back_elements = decodePCEElements(bs, numBack)
+    pce.Lfe_element_tag_select = make([]uint8, numLfe)
+    for i := range pce.Lfe_element_tag_select {
+        pce.Lfe_element_tag_select[i] = bs.Uint8(4)
+    }
+    pce.Assoc_data_element_tag_select = make([]uint8, numAssocData)
+    for i := range pce.Assoc_data_element_tag_select {
+        pce.Assoc_data_element_tag_select[i] = bs.Uint8(4)
+    }
+    pce.Cc_elements = decodePCEElements(bs, numValidCC)
+    if consumed := startBits - bs.RemainBits(); consumed%8 != 0 {
+        bs.SkipBits(8 - consumed%8)
+    }
+    pce.Comment_field_data = make([]byte, bs.Uint8(8))
+    for i := range pce.Comment_field_data {
+        pce.Comment_field_data[i] = bs.Uint8(8)
+    }
+}
+
+func (pce *ProgramConfigElement) encode(bsw *BitStreamWriter, startBits int) {
+    bsw.PutUint8(pce.Element_instance_tag, 4)
+    bsw.PutUint8(pce.Object_type, 2)
+    bsw.PutUint8(pce.Sampling_frequency_index, 4)
+    bsw.PutUint8(uint8(len(pce.Front_elements)), 4)
+    bsw.PutUint8(uint8(len(pce.Side_elements)), 4)
+    bsw.PutUint8(uint8(len(pce.Back_elements)), 4)
+    bsw.PutUint8(uint8(len(pce.Lfe_element_tag_select)), 2)
+    bsw.PutUint8(uint8(len(pce.Assoc_data_element_tag_select)), 3)
+    bsw.PutUint8(uint8(len(pce.Cc_elements)), 4)
+    bsw.PutUint8(pce.Mono_mixdown_present, 1)
+    if pce.Mono_mixdown_present == 1 {
+        bsw.PutUint8(pce.Mono_mixdown_element_number, 4)
+    }
+    bsw.PutUint8(pce.Stereo_mixdown_present, 1)
+    if pce.Stereo_mixdown_present == 1 {
+        bsw.PutUint8(pce.Stereo_mixdown_element_number, 4)
+    }
+    bsw.PutUint8(pce.Matrix_mixdown_idx_present, 1)
+    if pce.Matrix_mixdown_idx_present == 1 {
+        bsw.PutUint8(pce.Matrix_mixdown_idx, 2)
+        bsw.PutUint8(pce.Pseudo_surround_enable, 1)
+    }
+    encodePCEElements(bsw, pce.Front_elements)
+    encodePCEElements(bsw, pce.Side_elements)
+    encodePCEElements(bsw, pce.Back_elements)
+    for _, tag := range pce.Lfe_element_tag_select {
+        bsw.PutUint8(tag, 4)
+    }
+    for _, tag := range pce.Assoc_data_element_tag_select {
+        bsw.PutUint8(tag, 4)
+    }
+    encodePCEElements(bsw, pce.Cc_elements)
+    for (bsw.ByteOffset()*8+bsw.BitOffset()-startBits)%8 != 0 {
+        bsw.PutUint8(0, 1)
+    }
+    bsw.PutUint8(uint8(len(pce.Comment_field_data)), 8)
+    for _, b := range pce.Comment_field_data {
+        bsw.PutUint8(b, 8)
+    }
+}
+
 func ConvertADTSToASC(frame []byte) (*AudioSpecificConfiguration, error) {
     if len(frame) < 7 {
         return nil, errors.New("len of frame < 7")
@@ -246,8 +801,11 @@ func ConvertASCToADTS(asc []byte, aacbytes int) (*ADTS_Frame_Header, error) {
     if err != nil {
         return nil, err
     }
+    if aac_asc.Sample_freq_index == AAC_SAMPLE_ESCAPE {
+        return nil, errors.New("adts not support explicit sampling frequency")
+    }
     aac_adts := NewAdtsFrameHeader()
-    aac_adts.Fix_Header.Profile = aac_asc.Audio_object_type - 1
+    aac_adts.Fix_Header.Profile = aac_asc.ObjectType() - 1
     aac_adts.Fix_Header.Channel_configuration = aac_asc.Channel_configuration
     aac_adts.Fix_Header.Sampling_frequency_index = aac_asc.Sample_freq_index
     aac_adts.Fix_Header.Protection_absent = 1
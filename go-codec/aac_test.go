@@ -0,0 +1,134 @@
+package codec
+
+import (
+    "bytes"
+    "reflect"
+    "testing"
+)
+
+func TestAudioSpecificConfiguration_Decode(t *testing.T) {
+    tests := []struct {
+        name       string
+        asc        []byte
+        objectType uint8
+        sampleRate int
+        outputRate int
+        channels   int
+        sbr        uint8
+        ps         uint8
+    }{
+        {name: "aac lc", asc: []byte{0x12, 0x10}, objectType: AOT_AAC_LC, sampleRate: 44100, outputRate: 44100, channels: 2},
+        {name: "he-aac explicit sbr", asc: []byte{0x13, 0x10, 0x56, 0xE5, 0x98}, objectType: AOT_AAC_LC, sampleRate: 24000, outputRate: 48000, channels: 2, sbr: 1},
+        {name: "he-aac hierarchical", asc: []byte{0x2B, 0x11, 0x88, 0x00}, objectType: AOT_AAC_LC, sampleRate: 24000, outputRate: 48000, channels: 2, sbr: 1},
+        {name: "he-aac v2 hierarchical", asc: []byte{0xEB, 0x09, 0x88, 0x00}, objectType: AOT_AAC_LC, sampleRate: 24000, outputRate: 48000, channels: 2, sbr: 1, ps: 1},
+        {name: "explicit sampling frequency", asc: []byte{0x17, 0x80, 0x49, 0xD4, 0x08}, objectType: AOT_AAC_LC, sampleRate: 37800, outputRate: 37800, channels: 1},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            asc := NewAudioSpecificConfiguration()
+            if err := asc.Decode(tt.asc); err != nil {
+                t.Fatal(err)
+            }
+            if asc.ObjectType() != tt.objectType || asc.SampleRate() != tt.sampleRate || asc.OutputSampleRate() != tt.outputRate ||
+                asc.ChannelCount() != tt.channels || asc.Sbr_present_flag != tt.sbr || asc.Ps_present_flag != tt.ps {
+                t.Errorf("Decode() = %+v", asc)
+            }
+            if got := asc.Encode(); !bytes.Equal(got, tt.asc) {
+                t.Errorf("Encode() = %x, want %x", got, tt.asc)
+            }
+        })
+    }
+}
+
+func TestAudioSpecificConfiguration_RoundTrip(t *testing.T) {
+    tests := []struct {
+        name string
+        asc  *AudioSpecificConfiguration
+    }{
+        {
+            name: "explicit ps",
+            asc: &AudioSpecificConfiguration{Audio_object_type: AOT_AAC_LC, Sample_freq_index: 6, Channel_configuration: 1,
+                Extension_audio_object_type: AOT_SBR, Sbr_present_flag: 1, Extension_sample_freq_index: 3, Ps_present_flag: 1},
+        },
+        {
+            name: "audio object type escape",
+            asc:  &AudioSpecificConfiguration{Audio_object_type: 42, Sample_freq_index: 3, Channel_configuration: 2},
+        },
+        {
+            name: "er aac ld",
+            asc: &AudioSpecificConfiguration{Audio_object_type: AOT_ER_AAC_LD, Sample_freq_index: 3, Channel_configuration: 1,
+                GA_framelength_flag: 1, GA_extension_flag: 1, Aac_spectral_data_resilience_flag: 1},
+        },
+        {
+            name: "program config element",
+            asc: &AudioSpecificConfiguration{Audio_object_type: AOT_AAC_LC, Sample_freq_index: 4,
+                Pce: &ProgramConfigElement{
+                    Object_type:                   1,
+                    Sampling_frequency_index:      4,
+                    Front_elements:                []PCEElement{{Is_cpe: 0, Element_tag_select: 0}, {Is_cpe: 1, Element_tag_select: 0}},
+                    Side_elements:                 []PCEElement{},
+                    Back_elements:                 []PCEElement{{Is_cpe: 1, Element_tag_select: 1}},
+                    Lfe_element_tag_select:        []uint8{0},
+                    Assoc_data_element_tag_select: []uint8{},
+                    Cc_elements:                   []PCEElement{},
+                    Comment_field_data:            []byte("5.1"),
+                }},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := NewAudioSpecificConfiguration()
+            if err := got.Decode(tt.asc.Encode()); err != nil {
+                t.Fatal(err)
+            }
+            if !reflect.DeepEqual(got, tt.asc) {
+                t.Errorf("Decode(Encode()) = %+v, want %+v", got, tt.asc)
+            }
+        })
+    }
+}
+
+func TestAudioSpecificConfiguration_ChannelCount(t *testing.T) {
+    asc := &AudioSpecificConfiguration{Channel_configuration: 0, Pce: &ProgramConfigElement{
+        Front_elements:         []PCEElement{{Is_cpe: 0}, {Is_cpe: 1}},
+        Back_elements:          []PCEElement{{Is_cpe: 1}},
+        Lfe_element_tag_select: []uint8{0},
+    }}
+    if asc.ChannelCount() != 6 {
+        t.Errorf("ChannelCount() = %d, want 6", asc.ChannelCount())
+    }
+    asc = &AudioSpecificConfiguration{Channel_configuration: 7}
+    if asc.ChannelCount() != 8 {
+        t.Errorf("ChannelCount() = %d, want 8", asc.ChannelCount())
+    }
+}
+
+func TestSampleToAACSampleIndex(t *testing.T) {
+    if idx := SampleToAACSampleIndex(44100); idx != 4 {
+        t.Errorf("SampleToAACSampleIndex(44100) = %d", idx)
+    }
+    if idx := SampleToAACSampleIndex(37800); idx != AAC_SAMPLE_ESCAPE {
+        t.Errorf("SampleToAACSampleIndex(37800) = %d", idx)
+    }
+    if rate := AACSampleIdxToSample(AAC_SAMPLE_ESCAPE); rate != 0 {
+        t.Errorf("AACSampleIdxToSample(15) = %d", rate)
+    }
+}
+
+func TestConvertADTSToASC(t *testing.T) {
+    adts := []byte{0xFF, 0xF1, 0x50, 0x80, 0x2E, 0x7F, 0xFC}
+    asc, err := ConvertADTSToASC(adts)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if got := asc.Encode(); !bytes.Equal(got, []byte{0x12, 0x10}) {
+        t.Errorf("Encode() = %x, want 1210", got)
+    }
+    hdr, err := ConvertASCToADTS([]byte{0x2B, 0x11, 0x88, 0x00}, 100)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if hdr.Fix_Header.Profile != 1 || hdr.Fix_Header.Sampling_frequency_index != 6 {
+        t.Errorf("ConvertASCToADTS() = %+v", hdr.Fix_Header)
+    }
+}
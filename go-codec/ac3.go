@@ -0,0 +1,546 @@
+package codec
+
+import (
+    "errors"
+    "fmt"
+)
+
+// ETSI TS 102 366 Digital Audio Compression (AC-3, Enhanced AC-3) Standard
+
+// AC-3 syncframe
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+// |  syncinfo  |  bsi  |  audblk0  |  ....  |  audblk5  |  aux  |  crc2  |
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+
+// syncinfo() {
+//     syncword                    16   0x0B77
+//     crc1                        16
+//     fscod                       2
+//     frmsizecod                  6
+// }
+//
+// bsi() {
+//     bsid                        5
+//     bsmod                       3
+//     acmod                       3
+//     if((acmod & 0x1) && (acmod != 0x1)) {cmixlev}           2
+//     if(acmod & 0x4) {surmixlev}                             2
+//     if(acmod == 0x2) {dsurmod}                              2
+//     lfeon                       1
+//     ......
+// }
+
+// E-AC-3 syncframe, bsid == 16
+// syncinfo() {
+//     syncword                    16   0x0B77
+// }
+//
+// bsi() {
+//     strmtyp                     2
+//     substreamid                 3
+//     frmsiz                      11
+//     fscod                       2
+//     if(fscod == 0x3) {
+//         fscod2                  2
+//         numblkscod = 0x3  /* six blocks per frame */
+//     }
+//     else {
+//         numblkscod              2
+//     }
+//     acmod                       3
+//     lfeon                       1
+//     bsid                        5
+//     dialnorm                    5
+//     compre                      1
+//     if(compre) {compr}          8
+//     if(acmod == 0x0) {
+//         dialnorm2               5
+//         compr2e                 1
+//         if(compr2e) {compr2}    8
+//     }
+//     if(strmtyp == 0x1) {
+//         chanmape                1
+//         if(chanmape) {chanmap}  16
+//     }
+//     mixmdate                    1
+//     if(mixmdate) {
+//         ......
+//     }
+//     infomdate                   1
+//     if(infomdate) {
+//         bsmod                   3
+//         ......
+//     }
+//     ......
+// }
+
+const (
+    EAC3_STRMTYP_INDEPENDENT = 0
+    EAC3_STRMTYP_DEPENDENT   = 1
+    EAC3_STRMTYP_AC3_CONVERT = 2
+)
+
+var AC3SampleRateTable [3]int = [3]int{48000, 44100, 32000}
+
+var EAC3ReducedSampleRateTable [3]int = [3]int{24000, 22050, 16000}
+
+// frmsizecod>>1 对应的码率(kbps)
+var AC3BitRateTable [19]int = [19]int{32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 448, 512, 576, 640}
+
+// acmod 对应的全带宽声道数(不包含lfe)
+var AC3ChannelsTable [8]int = [8]int{2, 1, 2, 3, 3, 4, 4, 5}
+
+var eac3BlocksTable [4]int = [4]int{1, 2, 3, 6}
+
+type AC3FrameHead struct {
+    Fscod       uint8
+    Frmsizecod  uint8
+    Bsid        uint8
+    Bsmod       uint8
+    Acmod       uint8
+    Lfeon       uint8
+    Strmtyp     uint8
+    Substreamid uint8
+    Frmsiz      uint16
+    Fscod2      uint8
+    Numblkscod  uint8
+    Chanmape    uint8
+    Chanmap     uint16
+
+    SampleRate   int
+    BitRate      int
+    ChannelCount int
+    SampleSize   int //每帧的采样数
+    FrameSize    int //syncframe字节数
+}
+
+// bsid <= 10 为AC-3, 11~16为E-AC-3
+func (head *AC3FrameHead) IsEAC3() bool {
+    return head.Bsid > 10
+}
+
+func DecodeAC3FrameHead(data []byte) (head *AC3FrameHead, err error) {
+    if len(data) < 7 {
+        return nil, errors.New("ac3 frame head must has 7 bytes at least")
+    }
+    if data[0] != 0x0B || data[1] != 0x77 {
+        return nil, errors.New("ac3 frame must start with 0x0B77")
+    }
+    head = &AC3FrameHead{}
+    bsid := data[5] >> 3
+    if bsid > 16 {
+        return nil, errors.New("unsupported ac3 bsid")
+    }
+    bs := NewBitStream(data[2:])
+    if bsid <= 10 {
+        err = head.decodeAC3(bs)
+    } else {
+        err = head.decodeEAC3(bs)
+    }
+    if err == nil && bs.Err() != nil {
+        err = fmt.Errorf("ac3 frame head: %w", bs.Err())
+    }
+    if err != nil {
+        return nil, err
+    }
+    head.ChannelCount = AC3ChannelsTable[head.Acmod] + int(head.Lfeon)
+    return head, nil
+}
+
+func (head *AC3FrameHead) decodeAC3(bs *BitStream) error {
+    bs.SkipBits(16) //crc1
+    head.Fscod = bs.Uint8(2)
+    head.Frmsizecod = bs.Uint8(6)
+    if head.Fscod == 3 || head.Frmsizecod >= 38 {
+        return errors.New("invalid ac3 fscod or frmsizecod")
+    }
+    head.Bsid = bs.Uint8(5)
+    head.Bsmod = bs.Uint8(3)
+    head.Acmod = bs.Uint8(3)
+    if head.Acmod&0x01 == 1 && head.Acmod != 1 {
+        bs.SkipBits(2) //cmixlev
+    }
+    if head.Acmod&0x04 > 0 {
+        bs.SkipBits(2) //surmixlev
+    }
+    if head.Acmod == 2 {
+        bs.SkipBits(2) //dsurmod
+    }
+    head.Lfeon = bs.GetBit()
+    head.SampleRate = AC3SampleRateTable[head.Fscod]
+    head.BitRate = AC3BitRateTable[head.Frmsizecod>>1] * 1000
+    head.SampleSize = 1536
+    // words per syncframe, 44.1kHz时奇数frmsizecod多一个word
+    switch head.Fscod {
+    case 0:
+        head.FrameSize = AC3BitRateTable[head.Frmsizecod>>1] * 2 * 2
+    case 1:
+        head.FrameSize = (AC3BitRateTable[head.Frmsizecod>>1]*320/147 + int(head.Frmsizecod&0x01)) * 2
+    case 2:
+        head.FrameSize = AC3BitRateTable[head.Frmsizecod>>1] * 3 * 2
+    }
+    return nil
+}
+
+func (head *AC3FrameHead) decodeEAC3(bs *BitStream) error {
+    head.Strmtyp = bs.Uint8(2)
+    head.Substreamid = bs.Uint8(3)
+    head.Frmsiz = bs.Uint16(11)
+    head.Fscod = bs.Uint8(2)
+    if head.Fscod == 3 {
+        head.Fscod2 = bs.Uint8(2)
+        if head.Fscod2 == 3 {
+            return errors.New("invalid eac3 fscod2")
+        }
+        head.Numblkscod = 3
+        head.SampleRate = EAC3ReducedSampleRateTable[head.Fscod2]
+    } else {
+        head.Numblkscod = bs.Uint8(2)
+        head.SampleRate = AC3SampleRateTable[head.Fscod]
+    }
+    head.Acmod = bs.Uint8(3)
+    head.Lfeon = bs.GetBit()
+    head.Bsid = bs.Uint8(5)
+    head.SampleSize = eac3BlocksTable[head.Numblkscod] * 256
+    head.FrameSize = (int(head.Frmsiz) + 1) * 2
+    head.BitRate = head.FrameSize * 8 * head.SampleRate / head.SampleSize
+    bs.SkipBits(5) //dialnorm
+    if bs.GetBit() == 1 {
+        bs.SkipBits(8) //compr
+    }
+    if head.Acmod == 0 {
+        bs.SkipBits(5) //dialnorm2
+        if bs.GetBit() == 1 {
+            bs.SkipBits(8) //compr2
+        }
+    }
+    if head.Strmtyp == EAC3_STRMTYP_DEPENDENT {
+        head.Chanmape = bs.GetBit()
+        if head.Chanmape == 1 {
+            head.Chanmap = bs.Uint16(16)
+        }
+    }
+    // mixing metadata
+    if bs.GetBit() == 1 {
+        if head.Acmod > 2 {
+            bs.SkipBits(2) //dmixmod
+        }
+        if head.Acmod&0x01 == 1 && head.Acmod > 2 {
+            bs.SkipBits(6) //ltrtcmixlev, lorocmixlev
+        }
+        if head.Acmod&0x04 > 0 {
+            bs.SkipBits(6) //ltrtsurmixlev, lorosurmixlev
+        }
+        if head.Lfeon == 1 && bs.GetBit() == 1 {
+            bs.SkipBits(5) //lfemixlevcod
+        }
+        if head.Strmtyp == EAC3_STRMTYP_INDEPENDENT {
+            if bs.GetBit() == 1 {
+                bs.SkipBits(6) //pgmscl
+            }
+            if head.Acmod == 0 && bs.GetBit() == 1 {
+                bs.SkipBits(6) //pgmscl2
+            }
+            if bs.GetBit() == 1 {
+                bs.SkipBits(6) //extpgmscl
+            }
+            switch bs.Uint8(2) { //mixdef
+            case 1:
+                bs.SkipBits(5) //premixcmpsel, drcsrc, premixcmpscl
+            case 2:
+                bs.SkipBits(12) //mixdata
+            case 3:
+                mixdeflen := int(bs.Uint8(5))
+                bs.SkipBits((mixdeflen + 2) * 8)
+            }
+            if head.Acmod < 2 {
+                if bs.GetBit() == 1 {
+                    bs.SkipBits(14) //panmean, paninfo
+                }
+                if head.Acmod == 0 && bs.GetBit() == 1 {
+                    bs.SkipBits(14) //panmean2, paninfo2
+                }
+            }
+            if bs.GetBit() == 1 { //frmmixcfginfoe
+                if head.Numblkscod == 0 {
+                    bs.SkipBits(5)
+                } else {
+                    for i := 0; i < eac3BlocksTable[head.Numblkscod]; i++ {
+                        if bs.GetBit() == 1 {
+                            bs.SkipBits(5) //blkmixcfginfo
+                        }
+                    }
+                }
+            }
+        }
+    }
+    // informational metadata
+    if bs.GetBit() == 1 {
+        head.Bsmod = bs.Uint8(3)
+    }
+    return nil
+}
+
+// 返回0x0B77的位置, 没有找到返回-1
+func FindAC3Syncword(data []byte, offset int) int {
+    for i := offset; i+1 < len(data); i++ {
+        if data[i] == 0x0B && data[i+1] == 0x77 {
+            return i
+        }
+    }
+    return -1
+}
+
+// 按syncframe分帧, E-AC-3的每个substream都是一个syncframe
+func SplitAC3Frames(data []byte, onFrame func(head *AC3FrameHead, frame []byte)) error {
+    start := FindAC3Syncword(data, 0)
+    for start >= 0 {
+        head, err := DecodeAC3FrameHead(data[start:])
+        if err != nil {
+            return err
+        }
+        if start+head.FrameSize > len(data) {
+            return errors.New("ac3 frame truncated")
+        }
+        if onFrame != nil {
+            onFrame(head, data[start:start+head.FrameSize])
+        }
+        start = FindAC3Syncword(data, start+head.FrameSize)
+    }
+    return nil
+}
+
+// ETSI TS 102 366 F.4 AC3SpecificBox
+//
+//	class AC3SpecificBox {
+//	    unsigned int(2) fscod;
+//	    unsigned int(5) bsid;
+//	    unsigned int(3) bsmod;
+//	    unsigned int(3) acmod;
+//	    unsigned int(1) lfeon;
+//	    unsigned int(5) bit_rate_code;
+//	    unsigned int(5) reserved = 0;
+//	}
+type AC3SpecificConfig struct {
+    Fscod         uint8
+    Bsid          uint8
+    Bsmod         uint8
+    Acmod         uint8
+    Lfeon         uint8
+    Bit_rate_code uint8
+}
+
+func NewAC3SpecificConfig(head *AC3FrameHead) *AC3SpecificConfig {
+    return &AC3SpecificConfig{
+        Fscod:         head.Fscod,
+        Bsid:          head.Bsid,
+        Bsmod:         head.Bsmod,
+        Acmod:         head.Acmod,
+        Lfeon:         head.Lfeon,
+        Bit_rate_code: head.Frmsizecod >> 1,
+    }
+}
+
+func (dac3 *AC3SpecificConfig) Encode() []byte {
+    bsw := NewBitStreamWriter(3)
+    bsw.PutUint8(dac3.Fscod, 2)
+    bsw.PutUint8(dac3.Bsid, 5)
+    bsw.PutUint8(dac3.Bsmod, 3)
+    bsw.PutUint8(dac3.Acmod, 3)
+    bsw.PutUint8(dac3.Lfeon, 1)
+    bsw.PutUint8(dac3.Bit_rate_code, 5)
+    bsw.PutUint8(0, 5)
+    return bsw.Bits()
+}
+
+func (dac3 *AC3SpecificConfig) Decode(data []byte) error {
+    if len(data) < 3 {
+        return errors.New("len of dac3 < 3")
+    }
+    bs := NewBitStream(data)
+    dac3.Fscod = bs.Uint8(2)
+    dac3.Bsid = bs.Uint8(5)
+    dac3.Bsmod = bs.Uint8(3)
+    dac3.Acmod = bs.Uint8(3)
+    dac3.Lfeon = bs.GetBit()
+    dac3.Bit_rate_code = bs.Uint8(5)
+    return nil
+}
+
+func (dac3 *AC3SpecificConfig) SampleRate() int {
+    if dac3.Fscod > 2 {
+        return 0
+    }
+    return AC3SampleRateTable[dac3.Fscod]
+}
+
+func (dac3 *AC3SpecificConfig) ChannelCount() int {
+    return AC3ChannelsTable[dac3.Acmod&0x07] + int(dac3.Lfeon)
+}
+
+// ETSI TS 102 366 F.6 EC3SpecificBox
+//
+//	class EC3SpecificBox {
+//	    unsigned int(13) data_rate;
+//	    unsigned int(3) num_ind_sub;
+//	    for (i = 0; i < num_ind_sub + 1; i++) {
+//	        unsigned int(2) fscod;
+//	        unsigned int(5) bsid;
+//	        unsigned int(1) reserved = 0;
+//	        unsigned int(1) asvc;
+//	        unsigned int(3) bsmod;
+//	        unsigned int(3) acmod;
+//	        unsigned int(1) lfeon;
+//	        unsigned int(3) reserved = 0;
+//	        unsigned int(4) num_dep_sub;
+//	        if (num_dep_sub > 0) {
+//	            unsigned int(9) chan_loc;
+//	        }
+//	        else {
+//	            unsigned int(1) reserved = 0;
+//	        }
+//	    }
+//	}
+type EAC3IndependentSubstream struct {
+    Fscod       uint8
+    Bsid        uint8
+    Asvc        uint8
+    Bsmod       uint8
+    Acmod       uint8
+    Lfeon       uint8
+    Num_dep_sub uint8
+    Chan_loc    uint16
+}
+
+type EAC3SpecificConfig struct {
+    Data_rate  uint16 //kbps
+    Substreams []EAC3IndependentSubstream
+}
+
+// frame为一个完整的access unit, 包含所有independent/dependent substream
+func NewEAC3SpecificConfig(frame []byte) (*EAC3SpecificConfig, error) {
+    dec3 := &EAC3SpecificConfig{}
+    dataRate := 0
+    done := false
+    err := SplitAC3Frames(frame, func(head *AC3FrameHead, _ []byte) {
+        if done {
+            return
+        }
+        if !head.IsEAC3() || head.Strmtyp != EAC3_STRMTYP_DEPENDENT {
+            // 下一个access unit
+            if head.Substreamid != uint8(len(dec3.Substreams)) || len(dec3.Substreams) == 8 {
+                done = len(dec3.Substreams) > 0
+                return
+            }
+            dec3.Substreams = append(dec3.Substreams, EAC3IndependentSubstream{
+                Fscod: head.Fscod,
+                Bsid:  head.Bsid,
+                Bsmod: head.Bsmod,
+                Acmod: head.Acmod,
+                Lfeon: head.Lfeon,
+            })
+            dataRate += head.BitRate
+            return
+        }
+        if len(dec3.Substreams) == 0 {
+            return
+        }
+        sub := &dec3.Substreams[len(dec3.Substreams)-1]
+        sub.Num_dep_sub++
+        sub.Chan_loc |= chanmapToChanLoc(head.Chanmap)
+        dataRate += head.BitRate
+    })
+    if err != nil {
+        return nil, err
+    }
+    if len(dec3.Substreams) == 0 {
+        return nil, errors.New("not found independent substream")
+    }
+    dec3.Data_rate = uint16(dataRate / 1000)
+    return dec3, nil
+}
+
+// chanmap(Table E.1.4)的bit 5~12对应chan_loc(Table F.6.3)的bit 0~7, bit 14(LFE2)对应chan_loc的bit 8
+// chanmap和chan_loc的bit 0均为最高位
+func chanmapToChanLoc(chanmap uint16) uint16 {
+    loc := (chanmap >> 2) & 0x1FE
+    loc |= (chanmap >> 1) & 0x01
+    return loc
+}
+
+func (dec3 *EAC3SpecificConfig) Encode() []byte {
+    bsw := NewBitStreamWriter(2 + 4*len(dec3.Substreams))
+    bsw.PutUint16(dec3.Data_rate, 13)
+    bsw.PutUint8(uint8(len(dec3.Substreams)-1), 3)
+    for _, sub := range dec3.Substreams {
+        bsw.PutUint8(sub.Fscod, 2)
+        bsw.PutUint8(sub.Bsid, 5)
+        bsw.PutUint8(0, 1)
+        bsw.PutUint8(sub.Asvc, 1)
+        bsw.PutUint8(sub.Bsmod, 3)
+        bsw.PutUint8(sub.Acmod, 3)
+        bsw.PutUint8(sub.Lfeon, 1)
+        bsw.PutUint8(0, 3)
+        bsw.PutUint8(sub.Num_dep_sub, 4)
+        if sub.Num_dep_sub > 0 {
+            bsw.PutUint16(sub.Chan_loc, 9)
+        } else {
+            bsw.PutUint8(0, 1)
+        }
+    }
+    return bsw.Bits()
+}
+
+func (dec3 *EAC3SpecificConfig) Decode(data []byte) (err error) {
+    if len(data) < 2 {
+        return errors.New("len of dec3 < 2")
+    }
+    bs := NewBitStream(data)
+    dec3.Data_rate = bs.Uint16(13)
+    dec3.Substreams = make([]EAC3IndependentSubstream, bs.Uint8(3)+1)
+    for i := range dec3.Substreams {
+        sub := &dec3.Substreams[i]
+        sub.Fscod = bs.Uint8(2)
+        sub.Bsid = bs.Uint8(5)
+        bs.SkipBits(1)
+        sub.Asvc = bs.GetBit()
+        sub.Bsmod = bs.Uint8(3)
+        sub.Acmod = bs.Uint8(3)
+        sub.Lfeon = bs.GetBit()
+        bs.SkipBits(3)
+        sub.Num_dep_sub = bs.Uint8(4)
+        if sub.Num_dep_sub > 0 {
+            sub.Chan_loc = bs.Uint16(9)
+        } else {
+            bs.SkipBits(1)
+        }
+    }
+    if bs.Err() != nil {
+        return fmt.Errorf("dec3: %w", bs.Err())
+    }
+    return nil
+}
+
+func (dec3 *EAC3SpecificConfig) SampleRate() int {
+    if len(dec3.Substreams) == 0 || dec3.Substreams[0].Fscod > 2 {
+        return 0
+    }
+    return AC3SampleRateTable[dec3.Substreams[0].Fscod]
+}
+
+// 第一个independent substream的声道数, 包含dependent substream中的声道
+func (dec3 *EAC3SpecificConfig) ChannelCount() int {
+    if len(dec3.Substreams) == 0 {
+        return 0
+    }
+    sub := dec3.Substreams[0]
+    count := AC3ChannelsTable[sub.Acmod&0x07] + int(sub.Lfeon)
+    // Lc/Rc, Lrs/Rrs, Cs, Ts, Lsd/Rsd, Lw/Rw, Lvh/Rvh, Cvh, LFE2
+    pairs := [9]int{2, 2, 1, 1, 2, 2, 2, 1, 1}
+    for i := 0; i < 9; i++ {
+        if sub.Chan_loc&(1<<(8-i)) > 0 {
+            count += pairs[i]
+        }
+    }
+    return count
+}
@@ -0,0 +1,160 @@
+package codec
+
+import (
+    "reflect"
+    "testing"
+)
+
+// 构造AC-3 syncframe, audblk部分填0
+func makeAC3Frame(fscod, frmsizecod, bsmod, acmod, lfeon uint8) []byte {
+    bsw := NewBitStreamWriter(8)
+    bsw.PutUint16(0x0B77, 16)
+    bsw.PutUint16(0, 16)
+    bsw.PutUint8(fscod, 2)
+    bsw.PutUint8(frmsizecod, 6)
+    bsw.PutUint8(8, 5)
+    bsw.PutUint8(bsmod, 3)
+    bsw.PutUint8(acmod, 3)
+    if acmod&0x01 == 1 && acmod != 1 {
+        bsw.PutUint8(0, 2)
+    }
+    if acmod&0x04 > 0 {
+        bsw.PutUint8(0, 2)
+    }
+    if acmod == 2 {
+        bsw.PutUint8(0, 2)
+    }
+    bsw.PutUint8(lfeon, 1)
+    head, _ := DecodeAC3FrameHead(append(bsw.Bits(), 0, 0, 0, 0))
+    frame := make([]byte, head.FrameSize)
+    copy(frame, bsw.Bits())
+    return frame
+}
+
+// 构造E-AC-3 syncframe, 携带infomdate(bsmod)
+func makeEAC3Frame(strmtyp, substreamid uint8, frmsiz uint16, acmod, lfeon uint8, chanmap uint16) []byte {
+    bsw := NewBitStreamWriter(16)
+    bsw.PutUint16(0x0B77, 16)
+    bsw.PutUint8(strmtyp, 2)
+    bsw.PutUint8(substreamid, 3)
+    bsw.PutUint16(frmsiz, 11)
+    bsw.PutUint8(0, 2) //48000
+    bsw.PutUint8(3, 2) //6 blocks
+    bsw.PutUint8(acmod, 3)
+    bsw.PutUint8(lfeon, 1)
+    bsw.PutUint8(16, 5)
+    bsw.PutUint8(31, 5)
+    bsw.PutUint8(0, 1)
+    if acmod == 0 {
+        bsw.PutUint8(31, 5)
+        bsw.PutUint8(0, 1)
+    }
+    if strmtyp == EAC3_STRMTYP_DEPENDENT {
+        bsw.PutUint8(1, 1)
+        bsw.PutUint16(chanmap, 16)
+    }
+    bsw.PutUint8(0, 1) //mixmdate
+    bsw.PutUint8(1, 1) //infomdate
+    bsw.PutUint8(2, 3) //bsmod
+    frame := make([]byte, (int(frmsiz)+1)*2)
+    copy(frame, bsw.Bits())
+    return frame
+}
+
+func TestDecodeAC3FrameHead(t *testing.T) {
+    tests := []struct {
+        name       string
+        frame      []byte
+        sampleRate int
+        bitRate    int
+        channels   int
+        frameSize  int
+        sampleSize int
+        eac3       bool
+    }{
+        {name: "ac3 5.1 448k", frame: makeAC3Frame(0, 30, 0, 7, 1), sampleRate: 48000, bitRate: 448000, channels: 6, frameSize: 1792, sampleSize: 1536},
+        {name: "ac3 stereo 44.1k", frame: makeAC3Frame(1, 3, 0, 2, 0), sampleRate: 44100, bitRate: 40000, channels: 2, frameSize: 176, sampleSize: 1536},
+        {name: "ac3 mono 32k", frame: makeAC3Frame(2, 0, 0, 1, 0), sampleRate: 32000, bitRate: 32000, channels: 1, frameSize: 192, sampleSize: 1536},
+        {name: "eac3 5.1", frame: makeEAC3Frame(0, 0, 767, 7, 1, 0), sampleRate: 48000, bitRate: 384000, channels: 6, frameSize: 1536, sampleSize: 1536, eac3: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            head, err := DecodeAC3FrameHead(tt.frame)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if head.SampleRate != tt.sampleRate || head.BitRate != tt.bitRate || head.ChannelCount != tt.channels ||
+                head.FrameSize != tt.frameSize || head.SampleSize != tt.sampleSize || head.IsEAC3() != tt.eac3 {
+                t.Errorf("DecodeAC3FrameHead() = %+v", head)
+            }
+        })
+    }
+    if _, err := DecodeAC3FrameHead([]byte{0x0B, 0x77, 0x00}); err == nil {
+        t.Errorf("expected error for short frame")
+    }
+}
+
+func TestSplitAC3Frames(t *testing.T) {
+    var data []byte
+    data = append(data, 0xFF, 0x00)
+    data = append(data, makeAC3Frame(0, 8, 0, 2, 0)...)
+    data = append(data, makeAC3Frame(0, 8, 0, 2, 0)...)
+    n := 0
+    err := SplitAC3Frames(data, func(head *AC3FrameHead, frame []byte) {
+        if len(frame) != head.FrameSize || frame[0] != 0x0B || frame[1] != 0x77 {
+            t.Errorf("frame %d size %d", n, len(frame))
+        }
+        n++
+    })
+    if err != nil || n != 2 {
+        t.Errorf("SplitAC3Frames() got %d frames, err %v", n, err)
+    }
+    if err := SplitAC3Frames(data[:len(data)-1], nil); err == nil {
+        t.Errorf("expected error for truncated frame")
+    }
+}
+
+func TestAC3SpecificConfig(t *testing.T) {
+    head, _ := DecodeAC3FrameHead(makeAC3Frame(0, 30, 1, 7, 1))
+    dac3 := NewAC3SpecificConfig(head)
+    data := dac3.Encode()
+    if len(data) != 3 {
+        t.Fatalf("len of dac3 = %d", len(data))
+    }
+    got := &AC3SpecificConfig{}
+    if err := got.Decode(data); err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(got, dac3) || got.SampleRate() != 48000 || got.ChannelCount() != 6 || got.Bit_rate_code != 15 {
+        t.Errorf("AC3SpecificConfig = %+v", got)
+    }
+}
+
+func TestEAC3SpecificConfig(t *testing.T) {
+    // 5.1 independent substream + dependent substream(Lrs/Rrs) = 7.1
+    var au []byte
+    au = append(au, makeEAC3Frame(0, 0, 383, 7, 1, 0)...)
+    au = append(au, makeEAC3Frame(1, 0, 127, 2, 0, 0x0200)...)
+    next := append(append([]byte{}, au...), au...)
+    dec3, err := NewEAC3SpecificConfig(next)
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := &EAC3SpecificConfig{
+        Data_rate:  256,
+        Substreams: []EAC3IndependentSubstream{{Bsid: 16, Bsmod: 2, Acmod: 7, Lfeon: 1, Num_dep_sub: 1, Chan_loc: 0x80}},
+    }
+    if !reflect.DeepEqual(dec3, want) {
+        t.Fatalf("NewEAC3SpecificConfig() = %+v, want %+v", dec3, want)
+    }
+    if dec3.ChannelCount() != 8 || dec3.SampleRate() != 48000 {
+        t.Errorf("ChannelCount() = %d, SampleRate() = %d", dec3.ChannelCount(), dec3.SampleRate())
+    }
+    got := &EAC3SpecificConfig{}
+    if err := got.Decode(dec3.Encode()); err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(got, dec3) {
+        t.Errorf("Decode(Encode()) = %+v, want %+v", got, dec3)
+    }
+}
@@ -0,0 +1,839 @@
+package codec
+
+import (
+    "errors"
+    "fmt"
+)
+
+// AV1 Bitstream & Decoding Process Specification
+// https://aomediacodec.github.io/av1-spec/av1-spec.pdf
+//
+// obu_header() {
+//     obu_forbidden_bit                   f(1)
+//     obu_type                            f(4)
+//     obu_extension_flag                  f(1)
+//     obu_has_size_field                  f(1)
+//     obu_reserved_1bit                   f(1)
+//     if ( obu_extension_flag == 1 )
+//         obu_extension_header()
+// }
+//
+// obu_extension_header() {
+//     temporal_id                         f(3)
+//     spatial_id                          f(2)
+//     extension_header_reserved_3bits     f(3)
+// }
+
+type AV1_OBU_TYPE int
+
+const (
+    AV1_OBU_RESERVED AV1_OBU_TYPE = iota
+    AV1_OBU_SEQUENCE_HEADER
+    AV1_OBU_TEMPORAL_DELIMITER
+    AV1_OBU_FRAME_HEADER
+    AV1_OBU_TILE_GROUP
+    AV1_OBU_METADATA
+    AV1_OBU_FRAME
+    AV1_OBU_REDUNDANT_FRAME_HEADER
+    AV1_OBU_TILE_LIST
+    AV1_OBU_PADDING AV1_OBU_TYPE = 15
+)
+
+type AV1ObuHeader struct {
+    Obu_forbidden_bit  uint8
+    Obu_type           uint8
+    Obu_extension_flag uint8
+    Obu_has_size_field uint8
+    Obu_reserved_1bit  uint8
+    Temporal_id        uint8
+    Spatial_id         uint8
+}
+
+func (hdr *AV1ObuHeader) Decode(bs *BitStream) {
+    hdr.Obu_forbidden_bit = bs.GetBit()
+    hdr.Obu_type = bs.Uint8(4)
+    hdr.Obu_extension_flag = bs.GetBit()
+    hdr.Obu_has_size_field = bs.GetBit()
+    hdr.Obu_reserved_1bit = bs.GetBit()
+    if hdr.Obu_extension_flag == 1 {
+        hdr.Temporal_id = bs.Uint8(3)
+        hdr.Spatial_id = bs.Uint8(2)
+        bs.SkipBits(3)
+    }
+}
+
+func (hdr *AV1ObuHeader) Encode(bsw *BitStreamWriter) {
+    bsw.PutUint8(0, 1)
+    bsw.PutUint8(hdr.Obu_type, 4)
+    bsw.PutUint8(hdr.Obu_extension_flag, 1)
+    bsw.PutUint8(hdr.Obu_has_size_field, 1)
+    bsw.PutUint8(0, 1)
+    if hdr.Obu_extension_flag == 1 {
+        bsw.PutUint8(hdr.Temporal_id, 3)
+        bsw.PutUint8(hdr.Spatial_id, 2)
+        bsw.PutUint8(0, 3)
+    }
+}
+
+func (hdr *AV1ObuHeader) Size() int {
+    if hdr.Obu_extension_flag == 1 {
+        return 2
+    }
+    return 1
+}
+
+// leb128() {
+//     value = 0
+//     for (i = 0; i < 8; i++) {
+//         leb128_byte                     f(8)
+//         value |= ( (leb128_byte & 0x7f) << (i*7) )
+//         if ( !(leb128_byte & 0x80) )
+//             break
+//     }
+//     return value
+// }
+
+// return value and the number of bytes consumed, n == 0 means buf is not a complete leb128
+func ReadLeb128(buf []byte) (value uint64, n int) {
+    for i := 0; i < 8 && i < len(buf); i++ {
+        value |= uint64(buf[i]&0x7f) << (i * 7)
+        if buf[i]&0x80 == 0 {
+            return value, i + 1
+        }
+    }
+    return 0, 0
+}
+
+func WriteLeb128(value uint64) []byte {
+    leb := make([]byte, 0, 8)
+    for {
+        b := uint8(value & 0x7f)
+        value >>= 7
+        if value != 0 {
+            leb = append(leb, b|0x80)
+        } else {
+            leb = append(leb, b)
+            break
+        }
+    }
+    return leb
+}
+
+// AV1ObuType 空的obu返回AV1_OBU_RESERVED
+func AV1ObuType(obu []byte) AV1_OBU_TYPE {
+    if len(obu) == 0 {
+        return AV1_OBU_RESERVED
+    }
+    return AV1_OBU_TYPE((obu[0] >> 3) & 0x0F)
+}
+
+// AV1ObuPayload return the obu header and payload of an obu, the payload does not include obu_size
+func AV1ObuPayload(obu []byte) (*AV1ObuHeader, []byte, error) {
+    if len(obu) < 1 {
+        return nil, nil, errors.New("empty obu")
+    }
+    hdr := &AV1ObuHeader{}
+    if obu[0]&0x04 > 0 && len(obu) < 2 {
+        return nil, nil, errors.New("obu extension header is truncated")
+    }
+    hdr.Decode(NewBitStream(obu))
+    offset := hdr.Size()
+    if hdr.Obu_has_size_field == 0 {
+        return hdr, obu[offset:], nil
+    }
+    size, n := ReadLeb128(obu[offset:])
+    if n == 0 {
+        return nil, nil, errors.New("invalid obu_size")
+    }
+    offset += n
+    if uint64(len(obu)-offset) < size {
+        return nil, nil, errors.New("obu payload is truncated")
+    }
+    return hdr, obu[offset : offset+int(size)], nil
+}
+
+// SplitAV1OBUs split the Low Overhead Bitstream Format(Section 5.2) into obus,
+// every obu except the last one must have obu_size field
+func SplitAV1OBUs(frame []byte, onObu func(obu []byte) bool) error {
+    for len(frame) > 0 {
+        hdrlen := 1
+        if frame[0]&0x04 > 0 {
+            hdrlen = 2
+        }
+        if len(frame) < hdrlen {
+            return errors.New("obu header is truncated")
+        }
+        obulen := len(frame)
+        if frame[0]&0x02 > 0 {
+            size, n := ReadLeb128(frame[hdrlen:])
+            if n == 0 {
+                return errors.New("invalid obu_size")
+            }
+            if uint64(len(frame)-hdrlen-n) < size {
+                return errors.New("obu payload is truncated")
+            }
+            obulen = hdrlen + n + int(size)
+        }
+        if onObu != nil && !onObu(frame[:obulen]) {
+            return nil
+        }
+        frame = frame[obulen:]
+    }
+    return nil
+}
+
+// temporal_unit( sz ) {
+//     while ( sz > 0 ) {
+//         frame_unit_size                 leb128()
+//         sz -= Leb128Bytes
+//         frame_unit( frame_unit_size )
+//         sz -= frame_unit_size
+//     }
+// }
+// frame_unit( sz ) {
+//     while ( sz > 0 ) {
+//         obu_length                      leb128()
+//         sz -= Leb128Bytes
+//         open_bitstream_unit( obu_length )
+//         sz -= obu_length
+//     }
+// }
+
+// SplitAV1AnnexBOBUs split one temporal_unit (without temporal_unit_size) of Length Delimited Bitstream Format(Annex B) into obus
+func SplitAV1AnnexBOBUs(tu []byte, onObu func(obu []byte) bool) error {
+    for len(tu) > 0 {
+        frameUnitSize, n := ReadLeb128(tu)
+        if n == 0 || uint64(len(tu)-n) < frameUnitSize {
+            return errors.New("invalid frame_unit_size")
+        }
+        fu := tu[n : n+int(frameUnitSize)]
+        tu = tu[n+int(frameUnitSize):]
+        for len(fu) > 0 {
+            obuLength, n := ReadLeb128(fu)
+            if n == 0 || uint64(len(fu)-n) < obuLength {
+                return errors.New("invalid obu_length")
+            }
+            if onObu != nil && !onObu(fu[n:n+int(obuLength)]) {
+                return nil
+            }
+            fu = fu[n+int(obuLength):]
+        }
+    }
+    return nil
+}
+
+// ConvertAV1AnnexBToLowOverhead convert one temporal_unit in Annex B format to Low Overhead Bitstream Format,
+// every obu will has obu_size field
+func ConvertAV1AnnexBToLowOverhead(tu []byte) ([]byte, error) {
+    out := make([]byte, 0, len(tu))
+    err := SplitAV1AnnexBOBUs(tu, func(obu []byte) bool {
+        out = append(out, AV1ObuWithSizeField(obu)...)
+        return true
+    })
+    if err != nil {
+        return nil, err
+    }
+    return out, nil
+}
+
+// AV1ObuWithSizeField return the obu with obu_has_size_field set
+func AV1ObuWithSizeField(obu []byte) []byte {
+    if len(obu) == 0 || obu[0]&0x02 > 0 {
+        return obu
+    }
+    hdrlen := 1
+    if obu[0]&0x04 > 0 {
+        hdrlen = 2
+    }
+    if len(obu) < hdrlen {
+        return obu
+    }
+    leb := WriteLeb128(uint64(len(obu) - hdrlen))
+    newobu := make([]byte, 0, len(obu)+len(leb))
+    newobu = append(newobu, obu[:hdrlen]...)
+    newobu[0] |= 0x02
+    newobu = append(newobu, leb...)
+    newobu = append(newobu, obu[hdrlen:]...)
+    return newobu
+}
+
+func IsAV1KeyFrame(frame []byte) bool {
+    ret := false
+    SplitAV1OBUs(frame, func(obu []byte) bool {
+        switch AV1ObuType(obu) {
+        case AV1_OBU_SEQUENCE_HEADER:
+            //reduced_still_picture_header == 1, the frame must be key frame
+            _, payload, err := AV1ObuPayload(obu)
+            if err == nil && len(payload) > 0 && payload[0]&0x08 > 0 {
+                ret = true
+                return false
+            }
+        case AV1_OBU_FRAME, AV1_OBU_FRAME_HEADER:
+            _, payload, err := AV1ObuPayload(obu)
+            if err != nil || len(payload) == 0 {
+                return false
+            }
+            // show_existing_frame f(1) == 0, frame_type f(2) == KEY_FRAME
+            // only valid when reduced_still_picture_header == 0
+            ret = payload[0]&0x80 == 0 && (payload[0]>>5)&0x03 == 0
+            return false
+        }
+        return true
+    })
+    return ret
+}
+
+const (
+    AV1_CP_BT_709      = 1
+    AV1_CP_UNSPECIFIED = 2
+    AV1_TC_UNSPECIFIED = 2
+    AV1_TC_SRGB        = 13
+    AV1_MC_IDENTITY    = 0
+    AV1_MC_UNSPECIFIED = 2
+
+    AV1_CSP_UNKNOWN = 0
+
+    AV1_SELECT_SCREEN_CONTENT_TOOLS = 2
+    AV1_SELECT_INTEGER_MV           = 2
+)
+
+// color_config( ) {
+//     high_bitdepth                       f(1)
+//     if ( seq_profile == 2 && high_bitdepth ) {
+//         twelve_bit                      f(1)
+//         BitDepth = twelve_bit ? 12 : 10
+//     } else if ( seq_profile <= 2 ) {
+//         BitDepth = high_bitdepth ? 10 : 8
+//     }
+//     if ( seq_profile == 1 ) {
+//         mono_chrome = 0
+//     } else {
+//         mono_chrome                     f(1)
+//     }
+//     NumPlanes = mono_chrome ? 1 : 3
+//     color_description_present_flag      f(1)
+//     ......
+//     separate_uv_delta_q                 f(1)
+// }
+
+type AV1ColorConfig struct {
+    High_bitdepth                  uint8
+    Twelve_bit                     uint8
+    BitDepth                       uint8
+    Mono_chrome                    uint8
+    Color_description_present_flag uint8
+    Color_primaries                uint8
+    Transfer_characteristics       uint8
+    Matrix_coefficients            uint8
+    Color_range                    uint8
+    Subsampling_x                  uint8
+    Subsampling_y                  uint8
+    Chroma_sample_position         uint8
+    Separate_uv_delta_q            uint8
+}
+
+func (cc *AV1ColorConfig) Decode(bs *BitStream, seqProfile uint8) {
+    cc.High_bitdepth = bs.GetBit()
+    if seqProfile == 2 && cc.High_bitdepth == 1 {
+        cc.Twelve_bit = bs.GetBit()
+        if cc.Twelve_bit == 1 {
+            cc.BitDepth = 12
+        } else {
+            cc.BitDepth = 10
+        }
+    } else {
+        if cc.High_bitdepth == 1 {
+            cc.BitDepth = 10
+        } else {
+            cc.BitDepth = 8
+        }
+    }
+    if seqProfile != 1 {
+        cc.Mono_chrome = bs.GetBit()
+    }
+    cc.Color_description_present_flag = bs.GetBit()
+    if cc.Color_description_present_flag == 1 {
+        cc.Color_primaries = bs.Uint8(8)
+        cc.Transfer_characteristics = bs.Uint8(8)
+        cc.Matrix_coefficients = bs.Uint8(8)
+    } else {
+        cc.Color_primaries = AV1_CP_UNSPECIFIED
+        cc.Transfer_characteristics = AV1_TC_UNSPECIFIED
+        cc.Matrix_coefficients = AV1_MC_UNSPECIFIED
+    }
+    if cc.Mono_chrome == 1 {
+        cc.Color_range = bs.GetBit()
+        cc.Subsampling_x = 1
+        cc.Subsampling_y = 1
+        cc.Chroma_sample_position = AV1_CSP_UNKNOWN
+        cc.Separate_uv_delta_q = 0
+        return
+    } else if cc.Color_primaries == AV1_CP_BT_709 &&
+        cc.Transfer_characteristics == AV1_TC_SRGB &&
+        cc.Matrix_coefficients == AV1_MC_IDENTITY {
+        cc.Color_range = 1
+        cc.Subsampling_x = 0
+        cc.Subsampling_y = 0
+    } else {
+        cc.Color_range = bs.GetBit()
+        if seqProfile == 0 {
+            cc.Subsampling_x = 1
+            cc.Subsampling_y = 1
+        } else if seqProfile == 1 {
+            cc.Subsampling_x = 0
+            cc.Subsampling_y = 0
+        } else {
+            if cc.BitDepth == 12 {
+                cc.Subsampling_x = bs.GetBit()
+                if cc.Subsampling_x == 1 {
+                    cc.Subsampling_y = bs.GetBit()
+                } else {
+                    cc.Subsampling_y = 0
+                }
+            } else {
+                cc.Subsampling_x = 1
+                cc.Subsampling_y = 0
+            }
+        }
+        if cc.Subsampling_x == 1 && cc.Subsampling_y == 1 {
+            cc.Chroma_sample_position = bs.Uint8(2)
+        }
+    }
+    cc.Separate_uv_delta_q = bs.GetBit()
+}
+
+type AV1TimingInfo struct {
+    Num_units_in_display_tick     uint32
+    Time_scale                    uint32
+    Equal_picture_interval        uint8
+    Num_ticks_per_picture_minus_1 uint32
+}
+
+type AV1DecoderModelInfo struct {
+    Buffer_delay_length_minus_1            uint8
+    Num_units_in_decoding_tick             uint32
+    Buffer_removal_time_length_minus_1     uint8
+    Frame_presentation_time_length_minus_1 uint8
+}
+
+type AV1OperatingPoint struct {
+    Operating_point_idc                       uint16
+    Seq_level_idx                             uint8
+    Seq_tier                                  uint8
+    Decoder_model_present_for_this_op         uint8
+    Decoder_buffer_delay                      uint32
+    Encoder_buffer_delay                      uint32
+    Low_delay_mode_flag                       uint8
+    Initial_display_delay_present_for_this_op uint8
+    Initial_display_delay_minus_1             uint8
+}
+
+// sequence_header_obu( ) {
+//     seq_profile                         f(3)
+//     still_picture                       f(1)
+//     reduced_still_picture_header        f(1)
+//     ......
+//     enable_superres                     f(1)
+//     enable_cdef                         f(1)
+//     enable_restoration                  f(1)
+//     color_config( )
+//     film_grain_params_present           f(1)
+// }
+
+type AV1SequenceHeader struct {
+    Seq_profile                        uint8
+    Still_picture                      uint8
+    Reduced_still_picture_header       uint8
+    Timing_info_present_flag           uint8
+    TimingInfo                         AV1TimingInfo
+    Decoder_model_info_present_flag    uint8
+    DecoderModelInfo                   AV1DecoderModelInfo
+    Initial_display_delay_present_flag uint8
+    Operating_points_cnt_minus_1       uint8
+    OperatingPoints                    []AV1OperatingPoint
+    Frame_width_bits_minus_1           uint8
+    Frame_height_bits_minus_1          uint8
+    Max_frame_width_minus_1            uint32
+    Max_frame_height_minus_1           uint32
+    Frame_id_numbers_present_flag      uint8
+    Delta_frame_id_length_minus_2      uint8
+    Additional_frame_id_length_minus_1 uint8
+    Use_128x128_superblock             uint8
+    Enable_filter_intra                uint8
+    Enable_intra_edge_filter           uint8
+    Enable_interintra_compound         uint8
+    Enable_masked_compound             uint8
+    Enable_warped_motion               uint8
+    Enable_dual_filter                 uint8
+    Enable_order_hint                  uint8
+    Enable_jnt_comp                    uint8
+    Enable_ref_frame_mvs               uint8
+    Seq_choose_screen_content_tools    uint8
+    Seq_force_screen_content_tools     uint8
+    Seq_choose_integer_mv              uint8
+    Seq_force_integer_mv               uint8
+    Order_hint_bits_minus_1            uint8
+    Enable_superres                    uint8
+    Enable_cdef                        uint8
+    Enable_restoration                 uint8
+    ColorConfig                        AV1ColorConfig
+    Film_grain_params_present          uint8
+}
+
+// uvlc() Section 4.10.3
+func readUvlc(bs *BitStream) uint32 {
+    leadingZeros := 0
+    //越界之后GetBit一直返回0, 需要检查错误
+    for bs.GetBit() == 0 {
+        if bs.Err() != nil {
+            return 0
+        }
+        leadingZeros++
+        if leadingZeros >= 32 {
+            break
+        }
+    }
+    if leadingZeros >= 32 {
+        return 0xFFFFFFFF
+    }
+    if leadingZeros == 0 {
+        return 0
+    }
+    return uint32(bs.GetBits(leadingZeros)) + (uint32(1) << leadingZeros) - 1
+}
+
+// payload of sequence header obu, without obu header and obu_size
+func (sh *AV1SequenceHeader) Decode(bs *BitStream) {
+    sh.Seq_profile = bs.Uint8(3)
+    sh.Still_picture = bs.GetBit()
+    sh.Reduced_still_picture_header = bs.GetBit()
+    if sh.Reduced_still_picture_header == 1 {
+        sh.Operating_points_cnt_minus_1 = 0
+        sh.OperatingPoints = make([]AV1OperatingPoint, 1)
+        sh.OperatingPoints[0].Seq_level_idx = bs.Uint8(5)
+    } else {
+        sh.Timing_info_present_flag = bs.GetBit()
+        if sh.Timing_info_present_flag == 1 {
+            sh.TimingInfo.Num_units_in_display_tick = bs.Uint32(32)
+            sh.TimingInfo.Time_scale = bs.Uint32(32)
+            sh.TimingInfo.Equal_picture_interval = bs.GetBit()
+            if sh.TimingInfo.Equal_picture_interval == 1 {
+                sh.TimingInfo.Num_ticks_per_picture_minus_1 = readUvlc(bs)
+            }
+            sh.Decoder_model_info_present_flag = bs.GetBit()
+            if sh.Decoder_model_info_present_flag == 1 {
+                sh.DecoderModelInfo.Buffer_delay_length_minus_1 = bs.Uint8(5)
+                sh.DecoderModelInfo.Num_units_in_decoding_tick = bs.Uint32(32)
+                sh.DecoderModelInfo.Buffer_removal_time_length_minus_1 = bs.Uint8(5)
+                sh.DecoderModelInfo.Frame_presentation_time_length_minus_1 = bs.Uint8(5)
+            }
+        }
+        sh.Initial_display_delay_present_flag = bs.GetBit()
+        sh.Operating_points_cnt_minus_1 = bs.Uint8(5)
+        sh.OperatingPoints = make([]AV1OperatingPoint, sh.Operating_points_cnt_minus_1+1)
+        for i := range sh.OperatingPoints {
+            op := &sh.OperatingPoints[i]
+            op.Operating_point_idc = bs.Uint16(12)
+            op.Seq_level_idx = bs.Uint8(5)
+            if op.Seq_level_idx > 7 {
+                op.Seq_tier = bs.GetBit()
+            }
+            if sh.Decoder_model_info_present_flag == 1 {
+                op.Decoder_model_present_for_this_op = bs.GetBit()
+                if op.Decoder_model_present_for_this_op == 1 {
+                    n := int(sh.DecoderModelInfo.Buffer_delay_length_minus_1) + 1
+                    op.Decoder_buffer_delay = bs.Uint32(n)
+                    op.Encoder_buffer_delay = bs.Uint32(n)
+                    op.Low_delay_mode_flag = bs.GetBit()
+                }
+            }
+            if sh.Initial_display_delay_present_flag == 1 {
+                op.Initial_display_delay_present_for_this_op = bs.GetBit()
+                if op.Initial_display_delay_present_for_this_op == 1 {
+                    op.Initial_display_delay_minus_1 = bs.Uint8(4)
+                }
+            }
+        }
+    }
+    sh.Frame_width_bits_minus_1 = bs.Uint8(4)
+    sh.Frame_height_bits_minus_1 = bs.Uint8(4)
+    sh.Max_frame_width_minus_1 = bs.Uint32(int(sh.Frame_width_bits_minus_1) + 1)
+    sh.Max_frame_height_minus_1 = bs.Uint32(int(sh.Frame_height_bits_minus_1) + 1)
+    if sh.Reduced_still_picture_header == 0 {
+        sh.Frame_id_numbers_present_flag = bs.GetBit()
+    }
+    if sh.Frame_id_numbers_present_flag == 1 {
+        sh.Delta_frame_id_length_minus_2 = bs.Uint8(4)
+        sh.Additional_frame_id_length_minus_1 = bs.Uint8(3)
+    }
+    sh.Use_128x128_superblock = bs.GetBit()
+    sh.Enable_filter_intra = bs.GetBit()
+    sh.Enable_intra_edge_filter = bs.GetBit()
+    if sh.Reduced_still_picture_header == 1 {
+        sh.Seq_force_screen_content_tools = AV1_SELECT_SCREEN_CONTENT_TOOLS
+        sh.Seq_force_integer_mv = AV1_SELECT_INTEGER_MV
+    } else {
+        sh.Enable_interintra_compound = bs.GetBit()
+        sh.Enable_masked_compound = bs.GetBit()
+        sh.Enable_warped_motion = bs.GetBit()
+        sh.Enable_dual_filter = bs.GetBit()
+        sh.Enable_order_hint = bs.GetBit()
+        if sh.Enable_order_hint == 1 {
+            sh.Enable_jnt_comp = bs.GetBit()
+            sh.Enable_ref_frame_mvs = bs.GetBit()
+        }
+        sh.Seq_choose_screen_content_tools = bs.GetBit()
+        if sh.Seq_choose_screen_content_tools == 1 {
+            sh.Seq_force_screen_content_tools = AV1_SELECT_SCREEN_CONTENT_TOOLS
+        } else {
+            sh.Seq_force_screen_content_tools = bs.GetBit()
+        }
+        if sh.Seq_force_screen_content_tools > 0 {
+            sh.Seq_choose_integer_mv = bs.GetBit()
+            if sh.Seq_choose_integer_mv == 1 {
+                sh.Seq_force_integer_mv = AV1_SELECT_INTEGER_MV
+            } else {
+                sh.Seq_force_integer_mv = bs.GetBit()
+            }
+        } else {
+            sh.Seq_force_integer_mv = AV1_SELECT_INTEGER_MV
+        }
+        if sh.Enable_order_hint == 1 {
+            sh.Order_hint_bits_minus_1 = bs.Uint8(3)
+        }
+    }
+    sh.Enable_superres = bs.GetBit()
+    sh.Enable_cdef = bs.GetBit()
+    sh.Enable_restoration = bs.GetBit()
+    sh.ColorConfig.Decode(bs, sh.Seq_profile)
+    sh.Film_grain_params_present = bs.GetBit()
+}
+
+func (sh *AV1SequenceHeader) Width() uint32 {
+    return sh.Max_frame_width_minus_1 + 1
+}
+
+func (sh *AV1SequenceHeader) Height() uint32 {
+    return sh.Max_frame_height_minus_1 + 1
+}
+
+// DecodeAV1SequenceHeader find the first sequence header obu in frame(Low Overhead Bitstream Format) and decode it
+func DecodeAV1SequenceHeader(frame []byte) (*AV1SequenceHeader, error) {
+    var sh *AV1SequenceHeader
+    var err error
+    splitErr := SplitAV1OBUs(frame, func(obu []byte) bool {
+        if AV1ObuType(obu) != AV1_OBU_SEQUENCE_HEADER {
+            return true
+        }
+        var payload []byte
+        _, payload, err = AV1ObuPayload(obu)
+        if err != nil {
+            return false
+        }
+        sh = &AV1SequenceHeader{}
+        bs := NewBitStream(payload)
+        sh.Decode(bs)
+        if bs.Err() != nil {
+            err = fmt.Errorf("av1 sequence header: %w", bs.Err())
+        }
+        return false
+    })
+    if splitErr != nil {
+        return nil, splitErr
+    }
+    if err != nil {
+        return nil, err
+    }
+    if sh == nil {
+        return nil, errors.New("not found sequence header obu")
+    }
+    return sh, nil
+}
+
+func GetAV1Resolution(frame []byte) (width uint32, height uint32, err error) {
+    sh, err := DecodeAV1SequenceHeader(frame)
+    if err != nil {
+        return 0, 0, err
+    }
+    return sh.Width(), sh.Height(), nil
+}
+
+// AV1 Codec ISO Media File Format Binding
+// https://aomediacodec.github.io/av1-isobmff/#av1codecconfigurationbox-syntax
+//
+// aligned (8) class AV1CodecConfigurationRecord {
+//     unsigned int (1) marker = 1;
+//     unsigned int (7) version = 1;
+//     unsigned int (3) seq_profile;
+//     unsigned int (5) seq_level_idx_0;
+//     unsigned int (1) seq_tier_0;
+//     unsigned int (1) high_bitdepth;
+//     unsigned int (1) twelve_bit;
+//     unsigned int (1) monochrome;
+//     unsigned int (1) chroma_subsampling_x;
+//     unsigned int (1) chroma_subsampling_y;
+//     unsigned int (2) chroma_sample_position;
+//     unsigned int (3) reserved = 0;
+//
+//     unsigned int (1) initial_presentation_delay_present;
+//     if (initial_presentation_delay_present) {
+//         unsigned int (4) initial_presentation_delay_minus_one;
+//     } else {
+//         unsigned int (4) reserved = 0;
+//     }
+//
+//     unsigned int (8) configOBUs[];
+// }
+
+type AV1CodecConfigurationRecord struct {
+    Marker                               uint8
+    Version                              uint8
+    Seq_profile                          uint8
+    Seq_level_idx_0                      uint8
+    Seq_tier_0                           uint8
+    High_bitdepth                        uint8
+    Twelve_bit                           uint8
+    Monochrome                           uint8
+    Chroma_subsampling_x                 uint8
+    Chroma_subsampling_y                 uint8
+    Chroma_sample_position               uint8
+    Initial_presentation_delay_present   uint8
+    Initial_presentation_delay_minus_one uint8
+    ConfigOBUs                           []byte
+}
+
+func NewAV1CodecConfigurationRecord() *AV1CodecConfigurationRecord {
+    return &AV1CodecConfigurationRecord{
+        Marker:  1,
+        Version: 1,
+    }
+}
+
+func (av1c *AV1CodecConfigurationRecord) Encode() []byte {
+    bsw := NewBitStreamWriter(4 + len(av1c.ConfigOBUs))
+    bsw.PutUint8(1, 1)
+    bsw.PutUint8(av1c.Version, 7)
+    bsw.PutUint8(av1c.Seq_profile, 3)
+    bsw.PutUint8(av1c.Seq_level_idx_0, 5)
+    bsw.PutUint8(av1c.Seq_tier_0, 1)
+    bsw.PutUint8(av1c.High_bitdepth, 1)
+    bsw.PutUint8(av1c.Twelve_bit, 1)
+    bsw.PutUint8(av1c.Monochrome, 1)
+    bsw.PutUint8(av1c.Chroma_subsampling_x, 1)
+    bsw.PutUint8(av1c.Chroma_subsampling_y, 1)
+    bsw.PutUint8(av1c.Chroma_sample_position, 2)
+    bsw.PutUint8(0, 3)
+    bsw.PutUint8(av1c.Initial_presentation_delay_present, 1)
+    if av1c.Initial_presentation_delay_present == 1 {
+        bsw.PutUint8(av1c.Initial_presentation_delay_minus_one, 4)
+    } else {
+        bsw.PutUint8(0, 4)
+    }
+    if len(av1c.ConfigOBUs) > 0 {
+        bsw.PutBytes(av1c.ConfigOBUs)
+    }
+    return bsw.Bits()
+}
+
+func (av1c *AV1CodecConfigurationRecord) Decode(buf []byte) error {
+    if len(buf) < 4 {
+        return errors.New("len of av1C < 4")
+    }
+    if buf[0]&0x80 == 0 {
+        return errors.New("av1C marker must be 1")
+    }
+    bs := NewBitStream(buf)
+    av1c.Marker = bs.GetBit()
+    av1c.Version = bs.Uint8(7)
+    av1c.Seq_profile = bs.Uint8(3)
+    av1c.Seq_level_idx_0 = bs.Uint8(5)
+    av1c.Seq_tier_0 = bs.GetBit()
+    av1c.High_bitdepth = bs.GetBit()
+    av1c.Twelve_bit = bs.GetBit()
+    av1c.Monochrome = bs.GetBit()
+    av1c.Chroma_subsampling_x = bs.GetBit()
+    av1c.Chroma_subsampling_y = bs.GetBit()
+    av1c.Chroma_sample_position = bs.Uint8(2)
+    bs.SkipBits(3)
+    av1c.Initial_presentation_delay_present = bs.GetBit()
+    av1c.Initial_presentation_delay_minus_one = bs.Uint8(4)
+    if av1c.Initial_presentation_delay_present == 0 {
+        av1c.Initial_presentation_delay_minus_one = 0
+    }
+    av1c.ConfigOBUs = make([]byte, len(buf)-4)
+    copy(av1c.ConfigOBUs, buf[4:])
+    return nil
+}
+
+// UpdateSequenceHeader update av1C with the sequence header obu,
+// the obu is stored in configOBUs with obu_has_size_field = 1
+func (av1c *AV1CodecConfigurationRecord) UpdateSequenceHeader(obu []byte) error {
+    hdr, payload, err := AV1ObuPayload(obu)
+    if err != nil {
+        return err
+    }
+    if AV1_OBU_TYPE(hdr.Obu_type) != AV1_OBU_SEQUENCE_HEADER {
+        return errors.New("obu is not sequence header")
+    }
+    var sh AV1SequenceHeader
+    bs := NewBitStream(payload)
+    sh.Decode(bs)
+    if err = bs.Err(); err != nil {
+        return fmt.Errorf("av1 sequence header: %w", err)
+    }
+    av1c.Seq_profile = sh.Seq_profile
+    av1c.Seq_level_idx_0 = sh.OperatingPoints[0].Seq_level_idx
+    av1c.Seq_tier_0 = sh.OperatingPoints[0].Seq_tier
+    av1c.High_bitdepth = sh.ColorConfig.High_bitdepth
+    av1c.Twelve_bit = sh.ColorConfig.Twelve_bit
+    av1c.Monochrome = sh.ColorConfig.Mono_chrome
+    av1c.Chroma_subsampling_x = sh.ColorConfig.Subsampling_x
+    av1c.Chroma_subsampling_y = sh.ColorConfig.Subsampling_y
+    av1c.Chroma_sample_position = sh.ColorConfig.Chroma_sample_position
+    if sh.Initial_display_delay_present_flag == 1 && sh.OperatingPoints[0].Initial_display_delay_present_for_this_op == 1 {
+        av1c.Initial_presentation_delay_present = 1
+        av1c.Initial_presentation_delay_minus_one = sh.OperatingPoints[0].Initial_display_delay_minus_1
+    } else {
+        av1c.Initial_presentation_delay_present = 0
+        av1c.Initial_presentation_delay_minus_one = 0
+    }
+    sizedObu := AV1ObuWithSizeField(obu)
+    av1c.ConfigOBUs = make([]byte, len(sizedObu))
+    copy(av1c.ConfigOBUs, sizedObu)
+    return nil
+}
+
+// SequenceHeader return the sequence header obu stored in configOBUs
+func (av1c *AV1CodecConfigurationRecord) SequenceHeader() []byte {
+    var seqhdr []byte
+    SplitAV1OBUs(av1c.ConfigOBUs, func(obu []byte) bool {
+        if AV1ObuType(obu) == AV1_OBU_SEQUENCE_HEADER {
+            seqhdr = obu
+            return false
+        }
+        return true
+    })
+    return seqhdr
+}
+
+// CreateAV1CodecConfigurationRecord create av1C from a temporal unit(Low Overhead Bitstream Format) which contains sequence header obu
+func CreateAV1CodecConfigurationRecord(frame []byte) ([]byte, error) {
+    var seqhdr []byte
+    if err := SplitAV1OBUs(frame, func(obu []byte) bool {
+        if AV1ObuType(obu) == AV1_OBU_SEQUENCE_HEADER {
+            seqhdr = obu
+            return false
+        }
+        return true
+    }); err != nil {
+        return nil, err
+    }
+    if seqhdr == nil {
+        return nil, errors.New("not found sequence header obu")
+    }
+    av1c := NewAV1CodecConfigurationRecord()
+    if err := av1c.UpdateSequenceHeader(seqhdr); err != nil {
+        return nil, err
+    }
+    return av1c.Encode(), nil
+}
@@ -0,0 +1,148 @@
+package codec
+
+import (
+    "bytes"
+    "errors"
+    "reflect"
+    "testing"
+)
+
+// temporal delimiter + sequence header(profile 0, level 4.0, 1920x1080, 8bit 4:2:0)
+var av1Frame []byte = []byte{0x12, 0x00,
+    0x0A, 0x0B, 0x00, 0x00, 0x00, 0x42, 0xAB, 0xBF, 0xC3, 0x77, 0xFF, 0xE6, 0x01}
+
+var av1SeqHdrAnnexB []byte = []byte{0x0F,
+    0x01, 0x10,
+    0x0C, 0x08, 0x00, 0x00, 0x00, 0x42, 0xAB, 0xBF, 0xC3, 0x77, 0xFF, 0xE6, 0x01}
+
+func TestLeb128(t *testing.T) {
+    tests := []struct {
+        name  string
+        value uint64
+        leb   []byte
+    }{
+        {name: "test1", value: 0, leb: []byte{0x00}},
+        {name: "test2", value: 127, leb: []byte{0x7F}},
+        {name: "test3", value: 128, leb: []byte{0x80, 0x01}},
+        {name: "test4", value: 300, leb: []byte{0xAC, 0x02}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := WriteLeb128(tt.value); !reflect.DeepEqual(got, tt.leb) {
+                t.Errorf("WriteLeb128() = %v, want %v", got, tt.leb)
+            }
+            got, n := ReadLeb128(tt.leb)
+            if got != tt.value || n != len(tt.leb) {
+                t.Errorf("ReadLeb128() = %v,%v, want %v,%v", got, n, tt.value, len(tt.leb))
+            }
+        })
+    }
+}
+
+func TestSplitAV1OBUs(t *testing.T) {
+    var types []AV1_OBU_TYPE
+    err := SplitAV1OBUs(av1Frame, func(obu []byte) bool {
+        types = append(types, AV1ObuType(obu))
+        return true
+    })
+    if err != nil {
+        t.Fatalf("SplitAV1OBUs() error = %v", err)
+    }
+    want := []AV1_OBU_TYPE{AV1_OBU_TEMPORAL_DELIMITER, AV1_OBU_SEQUENCE_HEADER}
+    if !reflect.DeepEqual(types, want) {
+        t.Errorf("SplitAV1OBUs() = %v, want %v", types, want)
+    }
+    if err := SplitAV1OBUs([]byte{0x0A, 0x0B, 0x00}, nil); err == nil {
+        t.Errorf("SplitAV1OBUs() want error for truncated obu")
+    }
+}
+
+func TestConvertAV1AnnexBToLowOverhead(t *testing.T) {
+    got, err := ConvertAV1AnnexBToLowOverhead(av1SeqHdrAnnexB)
+    if err != nil {
+        t.Fatalf("ConvertAV1AnnexBToLowOverhead() error = %v", err)
+    }
+    if !bytes.Equal(got, av1Frame) {
+        t.Errorf("ConvertAV1AnnexBToLowOverhead() = %x, want %x", got, av1Frame)
+    }
+}
+
+func TestAV1SequenceHeader_Decode(t *testing.T) {
+    sh, err := DecodeAV1SequenceHeader(av1Frame)
+    if err != nil {
+        t.Fatalf("DecodeAV1SequenceHeader() error = %v", err)
+    }
+    if sh.Width() != 1920 || sh.Height() != 1080 {
+        t.Errorf("resolution = %dx%d, want 1920x1080", sh.Width(), sh.Height())
+    }
+    if sh.Seq_profile != 0 || sh.OperatingPoints[0].Seq_level_idx != 8 {
+        t.Errorf("profile = %d level = %d", sh.Seq_profile, sh.OperatingPoints[0].Seq_level_idx)
+    }
+    if sh.ColorConfig.BitDepth != 8 || sh.ColorConfig.Subsampling_x != 1 || sh.ColorConfig.Subsampling_y != 1 {
+        t.Errorf("color config = %+v", sh.ColorConfig)
+    }
+    if sh.Order_hint_bits_minus_1 != 6 || sh.Seq_force_screen_content_tools != AV1_SELECT_SCREEN_CONTENT_TOOLS {
+        t.Errorf("sequence header = %+v", sh)
+    }
+    if sh.Enable_cdef != 1 || sh.Enable_restoration != 1 || sh.Film_grain_params_present != 0 {
+        t.Errorf("sequence header = %+v", sh)
+    }
+}
+
+func TestAV1CodecConfigurationRecord(t *testing.T) {
+    av1c, err := CreateAV1CodecConfigurationRecord(av1Frame)
+    if err != nil {
+        t.Fatalf("CreateAV1CodecConfigurationRecord() error = %v", err)
+    }
+    want := append([]byte{0x81, 0x08, 0x0C, 0x00}, av1Frame[2:]...)
+    if !bytes.Equal(av1c, want) {
+        t.Errorf("CreateAV1CodecConfigurationRecord() = %x, want %x", av1c, want)
+    }
+    record := &AV1CodecConfigurationRecord{}
+    if err := record.Decode(av1c); err != nil {
+        t.Fatalf("AV1CodecConfigurationRecord.Decode() error = %v", err)
+    }
+    if record.Seq_level_idx_0 != 8 || record.Chroma_subsampling_x != 1 || record.Chroma_subsampling_y != 1 {
+        t.Errorf("AV1CodecConfigurationRecord.Decode() = %+v", record)
+    }
+    if !bytes.Equal(record.SequenceHeader(), av1Frame[2:]) {
+        t.Errorf("SequenceHeader() = %x", record.SequenceHeader())
+    }
+    if !bytes.Equal(record.Encode(), av1c) {
+        t.Errorf("Encode() = %x, want %x", record.Encode(), av1c)
+    }
+}
+
+func TestAV1SequenceHeader_Truncated(t *testing.T) {
+    //uvlc读到结尾时不能死循环
+    if _, _, err := GetAV1Resolution([]byte{0x0d, 0x56, 0x45, 0x18, 0x56, 0x46, 0x98, 0x27, 0x55, 0xd2, 0x5e}); err == nil {
+        t.Errorf("GetAV1Resolution() want error for truncated sequence header")
+    }
+    //timing_info中equal_picture_interval=1, 后面全是0
+    bsw := NewBitStreamWriter(16)
+    bsw.PutUint8(0x01, 6)
+    bsw.PutUint32(1, 32)
+    bsw.PutUint32(90000, 32)
+    bsw.PutUint8(1, 1)
+    bsw.PutRepetValue(0, 4)
+    payload := bsw.Bits()
+    obu := append([]byte{0x0A}, WriteLeb128(uint64(len(payload)))...)
+    if _, err := DecodeAV1SequenceHeader(append(obu, payload...)); err == nil {
+        t.Errorf("DecodeAV1SequenceHeader() want error for zero padding")
+    }
+}
+
+func TestAV1CodecConfigurationRecord_UpdateTruncated(t *testing.T) {
+    if AV1ObuType(nil) != AV1_OBU_RESERVED {
+        t.Errorf("AV1ObuType(nil) = %d", AV1ObuType(nil))
+    }
+    //sequence header只保留前3个字节
+    obu := []byte{0x0A, 0x03, 0x00, 0x00, 0x00}
+    record := &AV1CodecConfigurationRecord{}
+    if err := record.UpdateSequenceHeader(obu); !errors.Is(err, ErrTruncated) {
+        t.Errorf("UpdateSequenceHeader() error = %v, want ErrTruncated", err)
+    }
+    if record.ConfigOBUs != nil {
+        t.Errorf("UpdateSequenceHeader() updated record on error")
+    }
+}
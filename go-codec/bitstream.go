@@ -6,12 +6,15 @@ import (
 
 var BitMask [8]byte = [8]byte{0x01, 0x03, 0x07, 0x0F, 0x1F, 0x3F, 0x7F, 0xFF}
 
+// BitStream 读取越界时不会panic, 返回0并记录错误(ErrTruncated), 之后的读取都返回0,
+// 解析完成之后通过Err()检查
 type BitStream struct {
     bits        []byte
     bytesOffset int
     bitsOffset  int
     bitsmark    int
     bytemark    int
+    err         error
 }
 
 func NewBitStream(buf []byte) *BitStream {
@@ -36,14 +39,33 @@ func (bs *BitStream) Uint32(n int) uint32 {
     return uint32(bs.GetBits(n))
 }
 
+// Err 第一次读取失败的错误
+func (bs *BitStream) Err() error {
+    return bs.err
+}
+
+// 记录第一个错误, 并移动到结尾, 之后的读取都会失败
+func (bs *BitStream) fail(err error) {
+    if bs.err == nil {
+        bs.err = &ParseError{What: "bitstream", Offset: bs.bytesOffset, Err: err}
+    }
+    bs.bytesOffset = len(bs.bits)
+    bs.bitsOffset = 0
+}
+
+// 越界时返回nil
 func (bs *BitStream) GetBytes(n int) []byte {
-    if bs.bytesOffset+n > len(bs.bits) {
-        panic("OUT OF RANGE")
+    if n < 0 || bs.RemainBits() < n*8 {
+        bs.fail(ErrTruncated)
+        return nil
     }
+    data := make([]byte, n)
     if bs.bitsOffset != 0 {
-        panic("invaild operation")
+        for i := range data {
+            data[i] = bs.Uint8(8)
+        }
+        return data
     }
-    data := make([]byte, n)
     copy(data, bs.bits[bs.bytesOffset:bs.bytesOffset+n])
     bs.bytesOffset += n
     return data
@@ -51,8 +73,12 @@ func (bs *BitStream) GetBytes(n int) []byte {
 
 //n <= 64
 func (bs *BitStream) GetBits(n int) uint64 {
-    if bs.bytesOffset >= len(bs.bits) {
-        panic("OUT OF RANGE")
+    if n <= 0 {
+        return 0
+    }
+    if n > 64 || bs.RemainBits() < n {
+        bs.fail(ErrTruncated)
+        return 0
     }
     var ret uint64 = 0
     if 8-bs.bitsOffset >= n {
@@ -68,9 +94,6 @@ func (bs *BitStream) GetBits(n int) uint64 {
         n -= 8 - bs.bitsOffset
         bs.bitsOffset = 0
         for n > 0 {
-            if bs.bytesOffset >= len(bs.bits) {
-                panic("OUT OF RANGE")
-            }
             if n >= 8 {
                 ret = ret<<8 | uint64(bs.bits[bs.bytesOffset])
                 bs.bytesOffset++
@@ -87,7 +110,8 @@ func (bs *BitStream) GetBits(n int) uint64 {
 
 func (bs *BitStream) GetBit() uint8 {
     if bs.bytesOffset >= len(bs.bits) {
-        panic("OUT OF RANGE")
+        bs.fail(ErrTruncated)
+        return 0
     }
     ret := bs.bits[bs.bytesOffset] >> (7 - bs.bitsOffset) & 0x01
     bs.bitsOffset++
@@ -99,6 +123,10 @@ func (bs *BitStream) GetBit() uint8 {
 }
 
 func (bs *BitStream) SkipBits(n int) {
+    if n < 0 || bs.RemainBits() < n {
+        bs.fail(ErrTruncated)
+        return
+    }
     bytecount := n / 8
     bitscount := n % 8
     bs.bytesOffset += bytecount
@@ -143,6 +171,9 @@ func (bs *BitStream) Bits() []byte {
 }
 
 func (bs *BitStream) RemainData() []byte {
+    if bs.bytesOffset >= len(bs.bits) {
+        return nil
+    }
     return bs.bits[bs.bytesOffset:]
 }
 
@@ -150,11 +181,18 @@ func (bs *BitStream) RemainData() []byte {
 func (bs *BitStream) ReadUE() uint64 {
     leadingZeroBits := 0
     for bs.GetBit() == 0 {
+        if bs.err != nil {
+            return 0
+        }
         leadingZeroBits++
     }
     if leadingZeroBits == 0 {
         return 0
     }
+    if leadingZeroBits > 63 {
+        bs.fail(ErrInvalidData)
+        return 0
+    }
     info := bs.GetBits(leadingZeroBits)
     return uint64(1)<<leadingZeroBits - 1 + info
 }
@@ -174,6 +212,9 @@ func (bs *BitStream) ByteOffset() int {
 }
 
 func (bs *BitStream) UnRead(n int) {
+    if bs.err != nil {
+        return
+    }
     if n-bs.bitsOffset <= 0 {
         bs.bitsOffset -= n
     } else {
@@ -185,6 +226,8 @@ func (bs *BitStream) UnRead(n int) {
         if least > 0 {
             bs.bytesOffset--
             bs.bitsOffset = 8 - least
+        } else {
+            bs.bitsOffset = 0
         }
     }
 }
@@ -195,6 +238,29 @@ func (bs *BitStream) NextBits(n int) uint64 {
     return r
 }
 
+// more_rbsp_data(), 当前位置之后除了rbsp_trailing_bits之外是否还有数据
+func (bs *BitStream) MoreRbspData() bool {
+    if bs.RemainBits() <= 0 {
+        return false
+    }
+    last := len(bs.bits) - 1
+    for last >= bs.bytesOffset && bs.bits[last] == 0 {
+        last--
+    }
+    if last < bs.bytesOffset {
+        return false
+    }
+    if last > bs.bytesOffset {
+        return true
+    }
+    //rbsp_stop_one_bit 和当前位置在同一个字节内
+    stopbit := 0
+    for (bs.bits[last]>>stopbit)&0x01 == 0 {
+        stopbit++
+    }
+    return 7-bs.bitsOffset > stopbit
+}
+
 func (bs *BitStream) EOS() bool {
     return bs.bytesOffset == len(bs.bits) && bs.bitsOffset == 0
 }
@@ -264,7 +330,10 @@ func (bsw *BitStreamWriter) PutByte(v byte) {
 
 func (bsw *BitStreamWriter) PutBytes(v []byte) {
     if bsw.bitsoffset != 0 {
-        panic("bsw.bitsoffset > 0")
+        for _, b := range v {
+            bsw.PutUint8(b, 8)
+        }
+        return
     }
     bsw.expandSpace(8 * len(v))
     copy(bsw.bits[bsw.byteoffset:], v)
@@ -273,7 +342,10 @@ func (bsw *BitStreamWriter) PutBytes(v []byte) {
 
 func (bsw *BitStreamWriter) PutRepetValue(v byte, n int) {
     if bsw.bitsoffset != 0 {
-        panic("bsw.bitsoffset > 0")
+        for i := 0; i < n; i++ {
+            bsw.PutUint8(v, 8)
+        }
+        return
     }
     bsw.expandSpace(8 * n)
     for i := 0; i < n; i++ {
@@ -319,6 +391,35 @@ func (bsw *BitStreamWriter) PutUint64(v uint64, n int) {
     }
 }
 
+//无符号哥伦布熵编码
+func (bsw *BitStreamWriter) PutUE(v uint64) {
+    leadingZeroBits := -1
+    for tmp := v + 1; tmp > 0; tmp >>= 1 {
+        leadingZeroBits++
+    }
+    if leadingZeroBits > 0 {
+        bsw.PutUint64(0, leadingZeroBits)
+    }
+    bsw.PutUint64(v+1, leadingZeroBits+1)
+}
+
+//有符号哥伦布熵编码
+func (bsw *BitStreamWriter) PutSE(v int64) {
+    if v > 0 {
+        bsw.PutUE(uint64(2*v - 1))
+    } else {
+        bsw.PutUE(uint64(-2 * v))
+    }
+}
+
+// rbsp_trailing_bits: rbsp_stop_one_bit + rbsp_alignment_zero_bit
+func (bsw *BitStreamWriter) PutRbspTrailingBits() {
+    bsw.PutUint8(1, 1)
+    for bsw.BitOffset() != 0 {
+        bsw.PutUint8(0, 1)
+    }
+}
+
 func (bsw *BitStreamWriter) SetByte(v byte, where int) {
     bsw.bits[where] = v
 }
@@ -1,6 +1,7 @@
 package codec
 
 import (
+    "errors"
     "testing"
 )
 
@@ -38,6 +39,18 @@ func Test_UnRead(t *testing.T) {
     t.Log(bs.GetBits(3))
 }
 
+func TestBitStream_NextBits(t *testing.T) {
+    bs := NewBitStream([]byte{0x13, 0x10, 0x56, 0xE5, 0x98})
+    bs.SkipBits(16)
+    if got := bs.NextBits(11); got != 0x2b7 {
+        t.Fatalf("NextBits(11) = %x", got)
+    }
+    bs.SkipBits(11)
+    if got := bs.GetBits(5); got != 5 {
+        t.Errorf("GetBits(5) after NextBits = %d, want 5", got)
+    }
+}
+
 func Test_SkipBits(t *testing.T) {
     bs := NewBitStream(testbit)
     bs.SkipBits(4)
@@ -139,3 +152,69 @@ func TestBitStream_ReadUE(t *testing.T) {
         })
     }
 }
+
+func TestBitStream_Err(t *testing.T) {
+    tests := []struct {
+        name string
+        data []byte
+        read func(bs *BitStream)
+        want error
+    }{
+        {name: "getbits", data: []byte{0xFF}, read: func(bs *BitStream) { bs.GetBits(4); bs.GetBits(8) }, want: ErrTruncated},
+        {name: "getbit", data: []byte{0xFF}, read: func(bs *BitStream) { bs.SkipBits(8); bs.GetBit() }, want: ErrTruncated},
+        {name: "getbytes", data: []byte{0x01, 0x02}, read: func(bs *BitStream) { bs.GetBytes(3) }, want: ErrTruncated},
+        {name: "skipbits", data: []byte{0x01, 0x02}, read: func(bs *BitStream) { bs.SkipBits(17) }, want: ErrTruncated},
+        {name: "readue truncated", data: []byte{0x00, 0x01}, read: func(bs *BitStream) { bs.ReadUE() }, want: ErrTruncated},
+        {name: "readue too long", data: append(make([]byte, 8), 0xFF), read: func(bs *BitStream) { bs.ReadUE() }, want: ErrInvalidData},
+        {name: "ok", data: []byte{0x01, 0x02}, read: func(bs *BitStream) { bs.GetBits(16) }, want: nil},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            bs := NewBitStream(tt.data)
+            tt.read(bs)
+            if tt.want == nil {
+                if bs.Err() != nil {
+                    t.Fatalf("Err() = %v, want nil", bs.Err())
+                }
+                return
+            }
+            if !errors.Is(bs.Err(), tt.want) {
+                t.Fatalf("Err() = %v, want %v", bs.Err(), tt.want)
+            }
+            var perr *ParseError
+            if !errors.As(bs.Err(), &perr) {
+                t.Fatalf("Err() = %T, want *ParseError", bs.Err())
+            }
+            //出错之后继续读取返回0, 不会panic
+            if bs.GetBits(32) != 0 || bs.ReadUE() != 0 || bs.GetBytes(1) != nil || !bs.EOS() {
+                t.Error("read after error should return zero value")
+            }
+        })
+    }
+}
+
+func TestBitStream_MoreRbspData(t *testing.T) {
+    tests := []struct {
+        name string
+        bits []byte
+        skip int
+        want bool
+    }{
+        {name: "stop bit only", bits: []byte{0x80}, skip: 0, want: false},
+        {name: "data before stop bit", bits: []byte{0xB0}, skip: 2, want: true},
+        {name: "at stop bit", bits: []byte{0xB0}, skip: 3, want: false},
+        {name: "zero data before stop bit", bits: []byte{0x90}, skip: 1, want: true},
+        {name: "stop bit in next byte", bits: []byte{0x01, 0x80}, skip: 8, want: false},
+        {name: "data in next byte", bits: []byte{0x01, 0x80}, skip: 7, want: true},
+        {name: "cabac zero words", bits: []byte{0x40, 0x00, 0x00}, skip: 1, want: false},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            bs := NewBitStream(tt.bits)
+            bs.SkipBits(tt.skip)
+            if got := bs.MoreRbspData(); got != tt.want {
+                t.Errorf("BitStream.MoreRbspData() = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,544 @@
+package codec
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "sort"
+)
+
+// BitStreamFilter 码流转换, 每次输入一帧(access unit/音频帧), 输出转换之后的帧
+// 输出nil表示这一帧被丢弃, 或者被缓存到之后的帧中一起输出
+// filter不会修改输入的数据, 输出的数据也不会被filter复用
+type BitStreamFilter interface {
+    Filter(frame []byte) ([]byte, error)
+}
+
+// BSFChain 按顺序执行多个filter, 本身也是一个BitStreamFilter
+type BSFChain struct {
+    filters []BitStreamFilter
+}
+
+func NewBSFChain(filters ...BitStreamFilter) *BSFChain {
+    return &BSFChain{filters: filters}
+}
+
+func (chain *BSFChain) Append(filter BitStreamFilter) *BSFChain {
+    chain.filters = append(chain.filters, filter)
+    return chain
+}
+
+func (chain *BSFChain) Filter(frame []byte) ([]byte, error) {
+    var err error
+    for _, filter := range chain.filters {
+        if frame, err = filter.Filter(frame); err != nil || len(frame) == 0 {
+            return nil, err
+        }
+    }
+    return frame, nil
+}
+
+const (
+    h264NalFiller = 12
+    h265NalFD     = 38
+)
+
+func isValidLengthSize(lengthSize int) bool {
+    return lengthSize == 1 || lengthSize == 2 || lengthSize == 4
+}
+
+/***************************Annex-B -> AVCC/HVCC***************************/
+
+// AnnexBToLengthFilter Annex-B(startcode) 转换为 mp4/flv 使用的 length-prefixed 格式
+type AnnexBToLengthFilter struct {
+    lengthSize int
+}
+
+// lengthSize 为 1/2/4, 对应 avcC/hvcC 中的 lengthSizeMinusOne+1
+func NewAnnexBToLengthFilter(lengthSize int) (*AnnexBToLengthFilter, error) {
+    if !isValidLengthSize(lengthSize) {
+        return nil, errors.New("nalu length size must be 1/2/4")
+    }
+    return &AnnexBToLengthFilter{lengthSize: lengthSize}, nil
+}
+
+func (f *AnnexBToLengthFilter) Filter(frame []byte) ([]byte, error) {
+    out := make([]byte, 0, len(frame)+f.lengthSize*4)
+    var err error
+    SplitFrame(frame, func(nalu []byte) bool {
+        if len(nalu) == 0 {
+            return true
+        }
+        if f.lengthSize < 4 && uint64(len(nalu)) >= uint64(1)<<(8*uint(f.lengthSize)) {
+            err = errors.New("nalu is too large for length size")
+            return false
+        }
+        for i := f.lengthSize - 1; i >= 0; i-- {
+            out = append(out, byte(len(nalu)>>(8*uint(i))))
+        }
+        out = append(out, nalu...)
+        return true
+    })
+    if err != nil {
+        return nil, err
+    }
+    return out, nil
+}
+
+/***************************AVCC/HVCC -> Annex-B***************************/
+
+// LengthToAnnexBFilter length-prefixed 转换为 Annex-B(4字节startcode)
+//
+// 关键帧之前没有携带参数集(sps/pps, H265还有vps)时, 插入extradata或者码流中最近一次出现的参数集;
+// 只有参数集没有VCL的帧会被缓存, 和下一帧一起输出
+type LengthToAnnexBFilter struct {
+    cid        CodecID
+    lengthSize int
+    params     [3][]byte //vps sps pps
+    pending    []byte
+    pendingPs  [3]bool
+}
+
+// extradata 为 avcC(AVCDecoderConfigurationRecord)/hvcC(HEVCDecoderConfigurationRecord), 可以为空(lengthSize为4)
+func NewLengthToAnnexBFilter(cid CodecID, extradata []byte) (*LengthToAnnexBFilter, error) {
+    if cid != CODECID_VIDEO_H264 && cid != CODECID_VIDEO_H265 {
+        return nil, errors.New("unsupport bitstream filter codec " + CodecString(cid))
+    }
+    f := &LengthToAnnexBFilter{cid: cid, lengthSize: 4}
+    if len(extradata) > 0 {
+        if err := f.SetExtradata(extradata); err != nil {
+            return nil, err
+        }
+    }
+    return f, nil
+}
+
+// SetExtradata extradata更新时调用(例如flv中新的sequence header)
+func (f *LengthToAnnexBFilter) SetExtradata(extradata []byte) error {
+    var params [3][]byte
+    startcode := []byte{0x00, 0x00, 0x00, 0x01}
+    if f.cid == CODECID_VIDEO_H264 {
+        lengthSize, spss, ppss, err := decodeAVCCParameterSets(extradata)
+        if err != nil {
+            return err
+        }
+        f.lengthSize = lengthSize
+        for _, sps := range spss {
+            params[1] = append(append(params[1], startcode...), sps...)
+        }
+        for _, pps := range ppss {
+            params[2] = append(append(params[2], startcode...), pps...)
+        }
+    } else {
+        if len(extradata) < 23 {
+            return errors.New("hvcc extradata is too short")
+        }
+        hvcc := NewHEVCRecordConfiguration()
+        if err := hvcc.Decode(extradata); err != nil {
+            return err
+        }
+        f.lengthSize = int(hvcc.LengthSizeMinusOne) + 1
+        for _, array := range hvcc.Arrays {
+            idx := f.paramIndex(int(array.NAL_unit_type))
+            if idx < 0 {
+                continue
+            }
+            for _, unit := range array.NalUnits {
+                params[idx] = append(append(params[idx], startcode...), unit.Nalu[:unit.NalUnitLength]...)
+            }
+        }
+    }
+    if !isValidLengthSize(f.lengthSize) {
+        return errors.New("nalu length size must be 1/2/4")
+    }
+    f.params = params
+    return nil
+}
+
+// 返回参数集在params中的位置, 不是参数集返回-1
+func (f *LengthToAnnexBFilter) paramIndex(naluType int) int {
+    if f.cid == CODECID_VIDEO_H264 {
+        switch H264_NAL_TYPE(naluType) {
+        case H264_NAL_SPS:
+            return 1
+        case H264_NAL_PPS:
+            return 2
+        }
+        return -1
+    }
+    switch H265_NAL_TYPE(naluType) {
+    case H265_NAL_VPS:
+        return 0
+    case H265_NAL_SPS:
+        return 1
+    case H265_NAL_PPS:
+        return 2
+    }
+    return -1
+}
+
+func (f *LengthToAnnexBFilter) Filter(frame []byte) ([]byte, error) {
+    out := make([]byte, 0, len(frame)+16)
+    var inband [3][]byte
+    var vcl, key bool
+    it := NewLengthPrefixedNaluIterator(frame, f.lengthSize)
+    for it.Next() {
+        nalu := it.Nalu()
+        var naluType int
+        if f.cid == CODECID_VIDEO_H264 {
+            naluType = int(H264NaluTypeWithoutStartCode(nalu))
+            if IsH264VCLNaluType(H264_NAL_TYPE(naluType)) {
+                vcl = true
+                key = key || naluType == int(H264_NAL_I_SLICE) || isH264ISlice(nalu)
+            }
+        } else {
+            naluType = int(H265NaluTypeWithoutStartCode(nalu))
+            if IsH265VCLNaluType(H265_NAL_TYPE(naluType)) {
+                vcl = true
+                key = key || (naluType >= int(H265_NAL_SLICE_BLA_W_LP) && naluType <= int(H265_NAL_SLICE_CRA))
+            }
+        }
+        if idx := f.paramIndex(naluType); idx >= 0 {
+            inband[idx] = append(append(inband[idx], 0x00, 0x00, 0x00, 0x01), nalu...)
+        }
+        out = append(append(out, 0x00, 0x00, 0x00, 0x01), nalu...)
+    }
+    if err := it.Err(); err != nil {
+        return nil, err
+    }
+
+    var has [3]bool
+    for i := range inband {
+        if len(inband[i]) > 0 {
+            f.params[i] = inband[i]
+            has[i] = true
+        }
+    }
+    if !vcl {
+        if !has[0] && !has[1] && !has[2] {
+            return out, nil
+        }
+        f.pending = append(f.pending, out...)
+        for i := range has {
+            f.pendingPs[i] = f.pendingPs[i] || has[i]
+        }
+        return nil, nil
+    }
+
+    result := make([]byte, 0, len(f.pending)+len(out)+256)
+    result = append(result, f.pending...)
+    if key {
+        for i := range f.params {
+            if !has[i] && !f.pendingPs[i] {
+                result = append(result, f.params[i]...)
+            }
+        }
+    }
+    result = append(result, out...)
+    f.pending = f.pending[:0]
+    f.pendingPs = [3]bool{}
+    return result, nil
+}
+
+// 非IDR的I slice(例如只有recovery point的流)也当作关键帧
+func isH264ISlice(nalu []byte) bool {
+    if len(nalu) < 2 || H264NaluTypeWithoutStartCode(nalu) != H264_NAL_P_SLICE {
+        return false
+    }
+    var buf [16]byte
+    sh := SliceHeader{}
+    sh.Decode(NewBitStream(RbspView(headBytes(nalu[1:], 16), buf[:])))
+    return sh.Slice_type == 2 || sh.Slice_type == 7
+}
+
+// 解析avcC, 返回不带startcode的sps/pps
+func decodeAVCCParameterSets(extradata []byte) (lengthSize int, spss [][]byte, ppss [][]byte, err error) {
+    errAvcc := errors.New("invalid avcc extradata")
+    if len(extradata) < 7 || extradata[0] != 1 {
+        return 0, nil, nil, errAvcc
+    }
+    lengthSize = int(extradata[4]&0x03) + 1
+    data := extradata[5:]
+    readSets := func(count int) ([][]byte, bool) {
+        sets := make([][]byte, 0, count)
+        for i := 0; i < count; i++ {
+            if len(data) < 2 {
+                return nil, false
+            }
+            size := int(binary.BigEndian.Uint16(data))
+            if len(data) < 2+size {
+                return nil, false
+            }
+            sets = append(sets, data[2:2+size])
+            data = data[2+size:]
+        }
+        return sets, true
+    }
+    var ok bool
+    num := int(data[0] & 0x1F)
+    data = data[1:]
+    if spss, ok = readSets(num); !ok || len(data) < 1 {
+        return 0, nil, nil, errAvcc
+    }
+    num = int(data[0])
+    data = data[1:]
+    if ppss, ok = readSets(num); !ok {
+        return 0, nil, nil, errAvcc
+    }
+    return lengthSize, spss, ppss, nil
+}
+
+/***************************ADTS***************************/
+
+// ADTSStripFilter 去掉ADTS头, 输出raw aac, 输入必须是一个完整的ADTS帧(可以用SplitAACFrame拆分)
+// 同时记录AudioSpecificConfiguration, 用于生成mp4/flv的extradata
+type ADTSStripFilter struct {
+    asc []byte
+}
+
+func NewADTSStripFilter() *ADTSStripFilter {
+    return &ADTSStripFilter{}
+}
+
+// ASC 最近一帧对应的AudioSpecificConfiguration
+func (f *ADTSStripFilter) ASC() []byte {
+    return f.asc
+}
+
+func (f *ADTSStripFilter) Filter(frame []byte) ([]byte, error) {
+    if len(frame) < 7 || frame[0] != 0xFF || frame[1]&0xF0 != 0xF0 {
+        return nil, errors.New("not adts frame")
+    }
+    adts := NewAdtsFrameHeader()
+    adts.Decode(frame)
+    hdrLen := 7
+    if adts.Fix_Header.Protection_absent == 0 {
+        hdrLen = 9
+    }
+    frameLength := int(adts.Variable_Header.Frame_length)
+    if frameLength < hdrLen || frameLength > len(frame) {
+        return nil, errors.New("invalid adts frame length")
+    } else if frameLength < len(frame) {
+        return nil, errors.New("more than one adts frame, split it first")
+    }
+    asc, _ := ConvertADTSToASC(frame)
+    if ascData := asc.Encode(); !bytes.Equal(ascData, f.asc) {
+        f.asc = ascData
+    }
+    out := make([]byte, frameLength-hdrLen)
+    copy(out, frame[hdrLen:])
+    return out, nil
+}
+
+// ADTSAddFilter raw aac 加上ADTS头
+type ADTSAddFilter struct {
+    asc []byte
+}
+
+func NewADTSAddFilter(asc []byte) (*ADTSAddFilter, error) {
+    f := &ADTSAddFilter{}
+    if err := f.SetASC(asc); err != nil {
+        return nil, err
+    }
+    return f, nil
+}
+
+func (f *ADTSAddFilter) SetASC(asc []byte) error {
+    if _, err := ConvertASCToADTS(asc, 7); err != nil {
+        return err
+    }
+    f.asc = make([]byte, len(asc))
+    copy(f.asc, asc)
+    return nil
+}
+
+func (f *ADTSAddFilter) Filter(frame []byte) ([]byte, error) {
+    if len(frame)+7 > 0x1FFF {
+        return nil, errors.New("aac frame is too large for adts")
+    }
+    adts, err := ConvertASCToADTS(f.asc, len(frame)+7)
+    if err != nil {
+        return nil, err
+    }
+    out := make([]byte, 0, len(frame)+7)
+    out = append(out, adts.Encode()...)
+    return append(out, frame...), nil
+}
+
+/***************************extract extradata***************************/
+
+// ExtractExtradataFilter 从Annex-B H264/H265或者ADTS AAC中提取extradata(avcC/hvcC/AudioSpecificConfiguration)
+// 不修改帧数据, extradata变化时回调OnExtradata
+type ExtractExtradataFilter struct {
+    OnExtradata func(extradata []byte)
+    cid         CodecID
+    extradata   []byte
+    spss        map[uint64][]byte //带startcode
+    ppss        map[uint64][]byte
+    hvcc        *HEVCRecordConfiguration
+}
+
+func NewExtractExtradataFilter(cid CodecID) (*ExtractExtradataFilter, error) {
+    f := &ExtractExtradataFilter{cid: cid}
+    switch cid {
+    case CODECID_VIDEO_H264:
+        f.spss = make(map[uint64][]byte)
+        f.ppss = make(map[uint64][]byte)
+    case CODECID_VIDEO_H265:
+        f.hvcc = NewHEVCRecordConfiguration()
+    case CODECID_AUDIO_AAC:
+    default:
+        return nil, errors.New("unsupport bitstream filter codec " + CodecString(cid))
+    }
+    return f, nil
+}
+
+// Extradata 还没有得到完整的参数集时返回nil
+func (f *ExtractExtradataFilter) Extradata() []byte {
+    return f.extradata
+}
+
+func (f *ExtractExtradataFilter) Filter(frame []byte) ([]byte, error) {
+    var extradata []byte
+    switch f.cid {
+    case CODECID_VIDEO_H264:
+        extradata = f.extractH264(frame)
+    case CODECID_VIDEO_H265:
+        extradata = f.extractH265(frame)
+    case CODECID_AUDIO_AAC:
+        if len(frame) < 7 || frame[0] != 0xFF || frame[1]&0xF0 != 0xF0 {
+            return nil, errors.New("not adts frame")
+        }
+        asc, _ := ConvertADTSToASC(frame)
+        extradata = asc.Encode()
+    }
+    if len(extradata) > 0 && !bytes.Equal(extradata, f.extradata) {
+        f.extradata = extradata
+        if f.OnExtradata != nil {
+            f.OnExtradata(extradata)
+        }
+    }
+    return frame, nil
+}
+
+func sortedParameterSets(sets map[uint64][]byte) [][]byte {
+    ids := make([]uint64, 0, len(sets))
+    for id := range sets {
+        ids = append(ids, id)
+    }
+    sort.Slice(ids, func(i, j int) bool { return ids[i] < ids[j] })
+    out := make([][]byte, 0, len(ids))
+    for _, id := range ids {
+        out = append(out, sets[id])
+    }
+    return out
+}
+
+func (f *ExtractExtradataFilter) extractH264(frame []byte) []byte {
+    update := false
+    SplitFrame(frame, func(nalu []byte) bool {
+        if len(nalu) < 2 {
+            return true
+        }
+        switch H264NaluTypeWithoutStartCode(nalu) {
+        case H264_NAL_SPS:
+            id := GetSPSId(nalu)
+            if old, ok := f.spss[id]; !ok || !bytes.Equal(old[4:], nalu) {
+                f.spss[id] = append([]byte{0x00, 0x00, 0x00, 0x01}, nalu...)
+                update = true
+            }
+        case H264_NAL_PPS:
+            id := GetPPSId(nalu)
+            if old, ok := f.ppss[id]; !ok || !bytes.Equal(old[4:], nalu) {
+                f.ppss[id] = append([]byte{0x00, 0x00, 0x00, 0x01}, nalu...)
+                update = true
+            }
+        }
+        return true
+    })
+    if !update || len(f.spss) == 0 || len(f.ppss) == 0 {
+        return nil
+    }
+    extradata, err := CreateH264AVCCExtradata(sortedParameterSets(f.spss), sortedParameterSets(f.ppss))
+    if err != nil {
+        return nil
+    }
+    return extradata
+}
+
+func (f *ExtractExtradataFilter) extractH265(frame []byte) []byte {
+    update := false
+    SplitFrameWithStartCode(frame, func(nalu []byte) bool {
+        switch H265NaluType(nalu) {
+        case H265_NAL_VPS:
+            f.hvcc.UpdateVPS(nalu)
+            update = true
+        case H265_NAL_SPS:
+            f.hvcc.UpdateSPS(nalu)
+            update = true
+        case H265_NAL_PPS:
+            f.hvcc.UpdatePPS(nalu)
+            update = true
+        }
+        return true
+    })
+    if !update {
+        return nil
+    }
+    extradata, err := f.hvcc.Encode()
+    if err != nil {
+        return nil
+    }
+    return extradata
+}
+
+/***************************drop nalu***************************/
+
+// DropNaluFilter 删除Annex-B码流中指定类型的nalu, 输出统一使用4字节startcode
+type DropNaluFilter struct {
+    cid   CodecID
+    types map[int]bool
+}
+
+// naluTypes为空时, H264删除AUD/SEI/filler data, H265删除AUD/prefix SEI/suffix SEI/filler data
+func NewDropNaluFilter(cid CodecID, naluTypes ...int) (*DropNaluFilter, error) {
+    f := &DropNaluFilter{cid: cid, types: make(map[int]bool)}
+    if len(naluTypes) == 0 {
+        switch cid {
+        case CODECID_VIDEO_H264:
+            naluTypes = []int{int(H264_NAL_AUD), int(H264_NAL_SEI), h264NalFiller}
+        case CODECID_VIDEO_H265:
+            naluTypes = []int{int(H265_NAL_AUD), int(H265_NAL_SEI), int(H265_NAL_SEI_SUFFIX), h265NalFD}
+        }
+    }
+    if cid != CODECID_VIDEO_H264 && cid != CODECID_VIDEO_H265 {
+        return nil, errors.New("unsupport bitstream filter codec " + CodecString(cid))
+    }
+    for _, t := range naluTypes {
+        f.types[t] = true
+    }
+    return f, nil
+}
+
+func (f *DropNaluFilter) Filter(frame []byte) ([]byte, error) {
+    out := make([]byte, 0, len(frame))
+    SplitFrame(frame, func(nalu []byte) bool {
+        if len(nalu) == 0 {
+            return true
+        }
+        var naluType int
+        if f.cid == CODECID_VIDEO_H264 {
+            naluType = int(H264NaluTypeWithoutStartCode(nalu))
+        } else {
+            naluType = int(H265NaluTypeWithoutStartCode(nalu))
+        }
+        if !f.types[naluType] {
+            out = append(append(out, 0x00, 0x00, 0x00, 0x01), nalu...)
+        }
+        return true
+    })
+    if len(out) == 0 {
+        return nil, nil
+    }
+    return out, nil
+}
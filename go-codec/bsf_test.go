@@ -0,0 +1,199 @@
+package codec
+
+import (
+    "bytes"
+    "testing"
+)
+
+func annexB(nalus ...[]byte) []byte {
+    var out []byte
+    for _, nalu := range nalus {
+        out = append(append(out, 0x00, 0x00, 0x00, 0x01), nalu...)
+    }
+    return out
+}
+
+func lengthPrefixed(lengthSize int, nalus ...[]byte) []byte {
+    var out []byte
+    for _, nalu := range nalus {
+        for i := lengthSize - 1; i >= 0; i-- {
+            out = append(out, byte(len(nalu)>>(8*uint(i))))
+        }
+        out = append(out, nalu...)
+    }
+    return out
+}
+
+func TestAnnexBToLengthFilter(t *testing.T) {
+    idr := makeH264TestSlice(uint8(H264_NAL_I_SLICE), 3, H264_SLICE_I, 0, 0)
+    //混合3字节和4字节startcode
+    in := append([]byte{0x00, 0x00, 0x01}, h264TestSps...)
+    in = append(in, annexB(h264TestPps, idr)...)
+    for _, lengthSize := range []int{2, 4} {
+        f, err := NewAnnexBToLengthFilter(lengthSize)
+        if err != nil {
+            t.Fatal(err)
+        }
+        out, err := f.Filter(in)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if want := lengthPrefixed(lengthSize, h264TestSps, h264TestPps, idr); !bytes.Equal(out, want) {
+            t.Errorf("lengthSize %d Filter() = %x, want %x", lengthSize, out, want)
+        }
+    }
+    if _, err := NewAnnexBToLengthFilter(3); err == nil {
+        t.Error("expect error for length size 3")
+    }
+    f, _ := NewAnnexBToLengthFilter(1)
+    if _, err := f.Filter(annexB(bytes.Repeat([]byte{0x65}, 300))); err == nil {
+        t.Error("expect error when nalu is too large")
+    }
+}
+
+func TestLengthToAnnexBFilter(t *testing.T) {
+    idr := makeH264TestSlice(uint8(H264_NAL_I_SLICE), 3, H264_SLICE_I, 0, 0)
+    islice := makeH264TestSlice(uint8(H264_NAL_P_SLICE), 2, H264_SLICE_I, 1, 2)
+    pslice := makeH264TestSlice(uint8(H264_NAL_P_SLICE), 2, H264_SLICE_P, 1, 2)
+    sei := []byte{0x06, 0x05, 0x01, 0x00, 0x80}
+    extradata, err := CreateH264AVCCExtradata([][]byte{annexB(h264TestSps)}, [][]byte{annexB(h264TestPps)})
+    if err != nil {
+        t.Fatal(err)
+    }
+    tests := []struct {
+        name string
+        in   []byte
+        want []byte
+    }{
+        {name: "insert sps pps before idr", in: lengthPrefixed(4, sei, idr), want: annexB(h264TestSps, h264TestPps, sei, idr)},
+        {name: "p slice", in: lengthPrefixed(4, pslice), want: annexB(pslice)},
+        {name: "non-idr i slice", in: lengthPrefixed(4, islice), want: annexB(h264TestSps, h264TestPps, islice)},
+        {name: "in-band sps pps", in: lengthPrefixed(4, h264TestSps, h264TestPps, idr), want: annexB(h264TestSps, h264TestPps, idr)},
+        {name: "cache parameter sets", in: lengthPrefixed(4, h264TestSps), want: nil},
+        {name: "output cached parameter sets", in: lengthPrefixed(4, idr), want: annexB(h264TestSps, h264TestPps, idr)},
+        {name: "sei only", in: lengthPrefixed(4, sei), want: annexB(sei)},
+    }
+    f, err := NewLengthToAnnexBFilter(CODECID_VIDEO_H264, extradata)
+    if err != nil {
+        t.Fatal(err)
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            in := append([]byte{}, tt.in...)
+            got, err := f.Filter(in)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if !bytes.Equal(got, tt.want) {
+                t.Errorf("Filter() = %x, want %x", got, tt.want)
+            }
+            if !bytes.Equal(in, tt.in) {
+                t.Error("input is modified")
+            }
+        })
+    }
+    if _, err := f.Filter([]byte{0x00, 0x00, 0x00, 0x10, 0x65}); err == nil {
+        t.Error("expect error when nalu length exceeds frame")
+    }
+    if _, err := NewLengthToAnnexBFilter(CODECID_AUDIO_AAC, nil); err == nil {
+        t.Error("expect error for unsupport codec")
+    }
+}
+
+func TestADTSFilter(t *testing.T) {
+    asc := []byte{0x12, 0x10} //AAC LC 44100 2ch
+    raw := []byte{0x21, 0x00, 0x49, 0x90, 0x02, 0x19}
+    add, err := NewADTSAddFilter(asc)
+    if err != nil {
+        t.Fatal(err)
+    }
+    adts, err := add.Filter(raw)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(adts) != 7+len(raw) || adts[0] != 0xFF {
+        t.Fatalf("ADTSAddFilter.Filter() = %x", adts)
+    }
+    strip := NewADTSStripFilter()
+    got, err := strip.Filter(adts)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !bytes.Equal(got, raw) || !bytes.Equal(strip.ASC(), asc) {
+        t.Errorf("ADTSStripFilter.Filter() = %x asc = %x", got, strip.ASC())
+    }
+    if _, err := strip.Filter(append(adts, adts...)); err == nil {
+        t.Error("expect error for more than one adts frame")
+    }
+    if _, err := strip.Filter(raw); err == nil {
+        t.Error("expect error for raw aac")
+    }
+}
+
+func TestExtractExtradataFilter(t *testing.T) {
+    f, err := NewExtractExtradataFilter(CODECID_VIDEO_H264)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var calls int
+    f.OnExtradata = func(extradata []byte) { calls++ }
+    idr := makeH264TestSlice(uint8(H264_NAL_I_SLICE), 3, H264_SLICE_I, 0, 0)
+    frames := [][]byte{annexB(h264TestSps, idr), annexB(h264TestPps, idr), annexB(h264TestSps, h264TestPps, idr)}
+    for _, frame := range frames {
+        out, err := f.Filter(frame)
+        if err != nil {
+            t.Fatal(err)
+        }
+        if !bytes.Equal(out, frame) {
+            t.Error("frame is modified")
+        }
+    }
+    if calls != 1 {
+        t.Errorf("OnExtradata called %d times, want 1", calls)
+    }
+    want, _ := CreateH264AVCCExtradata([][]byte{annexB(h264TestSps)}, [][]byte{annexB(h264TestPps)})
+    if !bytes.Equal(f.Extradata(), want) {
+        t.Errorf("Extradata() = %x, want %x", f.Extradata(), want)
+    }
+
+    af, _ := NewExtractExtradataFilter(CODECID_AUDIO_AAC)
+    add, _ := NewADTSAddFilter([]byte{0x11, 0x90})
+    adts, _ := add.Filter([]byte{0x01, 0x02})
+    if _, err := af.Filter(adts); err != nil || !bytes.Equal(af.Extradata(), []byte{0x11, 0x90}) {
+        t.Errorf("aac Extradata() = %x, err = %v", af.Extradata(), err)
+    }
+    if _, err := NewExtractExtradataFilter(CODECID_AUDIO_MP3); err == nil {
+        t.Error("expect error for unsupport codec")
+    }
+}
+
+func TestBSFChain(t *testing.T) {
+    aud := []byte{0x09, 0xF0}
+    sei := []byte{0x06, 0x05, 0x01, 0x00, 0x80}
+    pslice := makeH264TestSlice(uint8(H264_NAL_P_SLICE), 2, H264_SLICE_P, 1, 2)
+    drop, err := NewDropNaluFilter(CODECID_VIDEO_H264)
+    if err != nil {
+        t.Fatal(err)
+    }
+    toLength, _ := NewAnnexBToLengthFilter(4)
+    chain := NewBSFChain(drop).Append(toLength)
+    tests := []struct {
+        name string
+        in   []byte
+        want []byte
+    }{
+        {name: "drop aud sei", in: annexB(aud, sei, pslice), want: lengthPrefixed(4, pslice)},
+        {name: "drop whole frame", in: annexB(aud, sei), want: nil},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := chain.Filter(tt.in)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if !bytes.Equal(got, tt.want) {
+                t.Errorf("Filter() = %x, want %x", got, tt.want)
+            }
+        })
+    }
+}
@@ -6,12 +6,19 @@ const (
     CODECID_VIDEO_H264 CodecID = iota
     CODECID_VIDEO_H265
     CODECID_VIDEO_VP8
+    CODECID_VIDEO_AV1
+    CODECID_VIDEO_VP9
 
-    CODECID_AUDIO_AAC CodecID = iota + 98
+    CODECID_AUDIO_AAC CodecID = iota + 96
     CODECID_AUDIO_G711A
     CODECID_AUDIO_G711U
     CODECID_AUDIO_OPUS
     CODECID_AUDIO_MP3
+    CODECID_AUDIO_AC3
+    CODECID_AUDIO_EAC3
+    CODECID_AUDIO_FLAC
+    CODECID_AUDIO_G722
+    CODECID_AUDIO_G726
 
     CODECID_UNRECOGNIZED = 999
 )
@@ -72,6 +79,10 @@ func CodecString(codecid CodecID) string {
         return "H265"
     case CODECID_VIDEO_VP8:
         return "VP8"
+    case CODECID_VIDEO_AV1:
+        return "AV1"
+    case CODECID_VIDEO_VP9:
+        return "VP9"
     case CODECID_AUDIO_AAC:
         return "AAC"
     case CODECID_AUDIO_G711A:
@@ -82,6 +93,16 @@ func CodecString(codecid CodecID) string {
         return "OPUS"
     case CODECID_AUDIO_MP3:
         return "MP3"
+    case CODECID_AUDIO_AC3:
+        return "AC3"
+    case CODECID_AUDIO_EAC3:
+        return "EAC3"
+    case CODECID_AUDIO_FLAC:
+        return "FLAC"
+    case CODECID_AUDIO_G722:
+        return "G722"
+    case CODECID_AUDIO_G726:
+        return "G726"
     default:
         return "UNRECOGNIZED"
    }
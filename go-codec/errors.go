@@ -0,0 +1,33 @@
+package codec
+
+import (
+    "errors"
+    "strconv"
+)
+
+// 解析/封装失败时返回的错误类型, 具体的错误会包装这些错误, 可以用errors.Is判断
+var (
+    ErrTruncated        = errors.New("truncated data")
+    ErrInvalidData      = errors.New("invalid data")
+    ErrUnsupportedCodec = errors.New("unsupported codec")
+    ErrCodecChanged     = errors.New("codec changed")
+    ErrInvalidState     = errors.New("invalid state")
+)
+
+// ParseError 记录出错的位置
+type ParseError struct {
+    What   string //正在解析的结构, 例如"sps", "pes header"
+    Offset int    //出错时的字节偏移, 未知时为-1
+    Err    error
+}
+
+func (e *ParseError) Error() string {
+    if e.Offset < 0 {
+        return e.What + ": " + e.Err.Error()
+    }
+    return e.What + " at offset " + strconv.Itoa(e.Offset) + ": " + e.Err.Error()
+}
+
+func (e *ParseError) Unwrap() error {
+    return e.Err
+}
@@ -0,0 +1,518 @@
+package codec
+
+import (
+    "bytes"
+    "errors"
+    "io"
+)
+
+// ESReader 读取裸流文件(Annex-B H264/H265, ADTS AAC, MP3), 输出完整的帧以及pts/dts(ms)
+//
+// 视频: 按照access unit输出(包含startcode), 帧率优先使用SetFrameRate设置的值, 其次是sps中VUI的timing_info, 默认25fps.
+// pts根据poc计算(同一个IDR之间poc相邻的两帧相差一个帧间隔, H264按照2, H265按照1),
+// dts由FrameReorder生成, 有B帧时输出比输入延迟重排序深度个帧.
+//
+// 音频: 按照帧输出, AAC每帧1024*(number_of_raw_data_blocks_in_frame+1)个采样, MP3由帧头得到采样数, pts == dts.
+// MP3会跳过ID3v2/ID3v1标签以及Xing/Info/VBRI帧
+type ESReader struct {
+    r      io.Reader
+    cid    CodecID
+    buf    []byte
+    scan   int
+    eof    bool
+    frames []esFrame
+
+    //video
+    fpsNum      int64
+    fpsDen      int64
+    fpsLocked   bool
+    au          []byte
+    hasVcl      bool
+    reorder     *FrameReorder
+    window      pocWindow
+    h264Spss    map[uint64]*SPS
+    h264Ppss    map[uint64]*PPS
+    h264Calc    H264PocCalculator
+    h265Spss    map[uint64]*H265RawSPS
+    h265Ppss    map[uint64]*H265RawPPS
+    h265Calc    H265PocCalculator
+    resetPoc    bool
+    basePts     int64
+    basePoc     int64
+    maxPts      int64
+    ptsStarted  bool
+    sampleRate  int
+    channels    int
+    samples     uint64
+    baseMs      uint64
+    firstMp3    bool
+    skipPending int
+}
+
+type esFrame struct {
+    frame []byte
+    pts   uint64
+    dts   uint64
+}
+
+const esReadSize = 64 * 1024
+
+// NewESReader cid 支持 CODECID_VIDEO_H264, CODECID_VIDEO_H265, CODECID_AUDIO_AAC, CODECID_AUDIO_MP3
+func NewESReader(r io.Reader, cid CodecID) (*ESReader, error) {
+    reader := &ESReader{r: r, cid: cid, firstMp3: true}
+    switch cid {
+    case CODECID_VIDEO_H264:
+        reader.h264Spss = make(map[uint64]*SPS)
+        reader.h264Ppss = make(map[uint64]*PPS)
+    case CODECID_VIDEO_H265:
+        reader.h265Spss = make(map[uint64]*H265RawSPS)
+        reader.h265Ppss = make(map[uint64]*H265RawPPS)
+    case CODECID_AUDIO_AAC, CODECID_AUDIO_MP3:
+        return reader, nil
+    default:
+        return nil, errors.New("unsupport es codec " + CodecString(cid))
+    }
+    reader.resetPoc = true
+    reader.reorder = NewFrameReorder(0)
+    reader.reorder.OnFrame = func(frame []byte, pts, dts int64) {
+        reader.frames = append(reader.frames, esFrame{frame: frame, pts: reader.unitToMs(pts), dts: reader.unitToMs(dts)})
+    }
+    return reader, nil
+}
+
+func (reader *ESReader) CodecID() CodecID {
+    return reader.cid
+}
+
+// SetFrameRate 帧率为num/den, 例如30000/1001, 需要在第一次ReadFrame之前调用
+func (reader *ESReader) SetFrameRate(num int, den int) {
+    if num <= 0 || den <= 0 {
+        return
+    }
+    reader.fpsNum = int64(num)
+    reader.fpsDen = int64(den)
+    reader.fpsLocked = true
+}
+
+// FrameRate 视频帧率, 在读到第一帧之前可能为0
+func (reader *ESReader) FrameRate() (num int, den int) {
+    return int(reader.fpsNum), int(reader.fpsDen)
+}
+
+// SampleRate 音频采样率, 在读到第一帧之前为0
+func (reader *ESReader) SampleRate() int {
+    return reader.sampleRate
+}
+
+func (reader *ESReader) ChannelCount() int {
+    return reader.channels
+}
+
+// ReadFrame 文件读完之后返回io.EOF
+func (reader *ESReader) ReadFrame() (frame []byte, pts uint64, dts uint64, err error) {
+    for len(reader.frames) == 0 {
+        if err = reader.parse(); err != nil {
+            return
+        }
+    }
+    f := reader.frames[0]
+    reader.frames = reader.frames[1:]
+    return f.frame, f.pts, f.dts, nil
+}
+
+func (reader *ESReader) fill() error {
+    if reader.eof {
+        return io.EOF
+    }
+    tmp := make([]byte, esReadSize)
+    n, err := reader.r.Read(tmp)
+    reader.buf = append(reader.buf, tmp[:n]...)
+    if err == io.EOF {
+        reader.eof = true
+        return nil
+    }
+    return err
+}
+
+func (reader *ESReader) consume(n int) {
+    reader.buf = reader.buf[n:]
+    reader.scan = 0
+}
+
+func (reader *ESReader) parse() error {
+    switch reader.cid {
+    case CODECID_VIDEO_H264, CODECID_VIDEO_H265:
+        return reader.parseVideo()
+    case CODECID_AUDIO_AAC:
+        return reader.parseAAC()
+    default:
+        return reader.parseMp3()
+    }
+}
+
+/*********************************video*********************************/
+
+// 每次调用至少输出一个nalu或者读取一次数据
+func (reader *ESReader) parseVideo() error {
+    beg, sc := FindStartCode(reader.buf, 0)
+    if beg < 0 {
+        //保留末尾可能是startcode一部分的3个字节
+        if len(reader.buf) > 3 {
+            reader.consume(len(reader.buf) - 3)
+        }
+        if reader.eof {
+            return reader.flushVideo()
+        }
+        return reader.fill()
+    }
+    if beg > 0 {
+        reader.consume(beg)
+    }
+    from := int(sc)
+    if reader.scan > from {
+        from = reader.scan
+    }
+    end, _ := FindStartCode(reader.buf, from)
+    if end < 0 {
+        if !reader.eof {
+            reader.scan = Max(int(sc), len(reader.buf)-4)
+            return reader.fill()
+        }
+        end = len(reader.buf)
+    }
+    nalu := reader.buf[:end]
+    if len(nalu) > int(sc) {
+        reader.onNalu(nalu)
+    }
+    reader.consume(end)
+    if len(reader.buf) == 0 && reader.eof {
+        return reader.flushVideo()
+    }
+    return nil
+}
+
+func (reader *ESReader) isNewAccessUnit(nalu []byte) bool {
+    if reader.cid == CODECID_VIDEO_H264 {
+        return IsH264NewAccessUnit(nalu)
+    }
+    return IsH265NewAccessUnit(nalu)
+}
+
+func (reader *ESReader) isVcl(nalu []byte) bool {
+    if reader.cid == CODECID_VIDEO_H264 {
+        return IsH264VCLNaluType(H264NaluType(nalu))
+    }
+    return IsH265VCLNaluType(H265NaluType(nalu))
+}
+
+func (reader *ESReader) onNalu(nalu []byte) {
+    if reader.hasVcl && reader.isNewAccessUnit(nalu) {
+        reader.onAccessUnit(reader.au)
+        reader.au = nil
+        reader.hasVcl = false
+    }
+    reader.au = append(reader.au, nalu...)
+    if reader.isVcl(nalu) {
+        reader.hasVcl = true
+    }
+}
+
+func (reader *ESReader) flushVideo() error {
+    if len(reader.au) > 0 {
+        reader.onAccessUnit(reader.au)
+        reader.au = nil
+        reader.hasVcl = false
+    }
+    reader.reorder.Flush()
+    if len(reader.frames) == 0 {
+        return io.EOF
+    }
+    return nil
+}
+
+func (reader *ESReader) onAccessUnit(au []byte) {
+    var poc int64
+    var idr, mmco5, ok bool
+    if reader.cid == CODECID_VIDEO_H264 {
+        poc, idr, mmco5, ok = reader.h264Poc(au)
+    } else {
+        poc, idr, ok = reader.h265Poc(au)
+    }
+    if !reader.fpsLocked {
+        if reader.fpsNum == 0 {
+            reader.fpsNum, reader.fpsDen = 25, 1
+        }
+        reader.fpsLocked = true
+    }
+
+    var pts int64
+    if !ok {
+        //无法解析poc(例如第一个sps之前的帧), 当作没有B帧处理
+        pts = reader.nextPts()
+        reader.resetPoc = true
+    } else {
+        if idr || reader.resetPoc {
+            reader.basePts = reader.nextPts()
+            reader.basePoc = poc
+            reader.resetPoc = false
+        }
+        step := int64(2)
+        if reader.cid == CODECID_VIDEO_H265 {
+            step = 1
+        }
+        pts = reader.basePts + (poc-reader.basePoc)/step
+        if mmco5 {
+            //memory_management_control_operation等于5之后poc从0开始
+            reader.basePts = pts
+            reader.basePoc = 0
+        }
+        reader.reorder.SetDepth(reader.window.push(poc))
+    }
+    if !reader.ptsStarted || pts > reader.maxPts {
+        reader.maxPts = pts
+        reader.ptsStarted = true
+    }
+    reader.reorder.Write(au, pts)
+}
+
+func (reader *ESReader) nextPts() int64 {
+    if !reader.ptsStarted {
+        //第一帧的pts预留重排序深度个帧间隔, 保证dts从0开始
+        return int64(reader.reorder.Depth())
+    }
+    return reader.maxPts + 1
+}
+
+func (reader *ESReader) unitToMs(unit int64) uint64 {
+    if unit <= 0 {
+        return 0
+    }
+    return uint64(unit * 1000 * reader.fpsDen / reader.fpsNum)
+}
+
+func (reader *ESReader) setVuiFrameRate(num uint32, den uint32) {
+    if reader.fpsLocked || num == 0 || den == 0 {
+        return
+    }
+    reader.fpsNum = int64(num)
+    reader.fpsDen = int64(den)
+}
+
+func (reader *ESReader) h264Poc(au []byte) (poc int64, idr bool, mmco5 bool, ok bool) {
+    var sh *SliceHeader
+    SplitFrame(au, func(nalu []byte) bool {
+        switch H264NaluTypeWithoutStartCode(nalu) {
+        case H264_NAL_SPS:
+            sps := &SPS{}
+            bs := NewBitStream(CovertRbspToSodb(nalu[1:]))
+            sps.Decode(bs)
+            if bs.Err() != nil {
+                break
+            }
+            reader.h264Spss[sps.Seq_parameter_set_id] = sps
+            reader.reorder.SetDepth(sps.MaxNumReorderFrames())
+            vui := &sps.VuiParameters
+            if sps.Vui_parameters_present_flag == 1 && vui.TimingInfoPresentFlag == 1 {
+                //每一帧包含两个field, 每个field为num_units_in_tick
+                reader.setVuiFrameRate(vui.TimeScale, 2*vui.NumUnitsInTick)
+            }
+        case H264_NAL_PPS:
+            pps := &PPS{}
+            bs := NewBitStream(CovertRbspToSodb(nalu[1:]))
+            pps.Decode(bs)
+            if bs.Err() != nil {
+                break
+            }
+            reader.h264Ppss[pps.Pic_parameter_set_id] = pps
+        case H264_NAL_I_SLICE, H264_NAL_P_SLICE:
+            sh, _ = DecodeH264SliceHeader(nalu, reader.h264Spss, reader.h264Ppss)
+            return false
+        }
+        return true
+    })
+    if sh == nil {
+        return
+    }
+    sps := reader.h264Spss[reader.h264Ppss[sh.Pic_parameter_set_id].Seq_parameter_set_id]
+    idr = sh.IdrPicFlag()
+    if idr {
+        reader.window.reset()
+    }
+    poc = reader.h264Calc.PicOrderCnt(sps, sh)
+    mmco5 = sh.HasMMCO5()
+    if mmco5 {
+        reader.window.reset()
+    }
+    return poc, idr, mmco5, true
+}
+
+func (reader *ESReader) h265Poc(au []byte) (poc int64, idr bool, ok bool) {
+    var sh *H265SliceHeader
+    SplitFrame(au, func(nalu []byte) bool {
+        naluType := H265NaluTypeWithoutStartCode(nalu)
+        switch {
+        case naluType == H265_NAL_SPS:
+            sps := &H265RawSPS{}
+            if sps.Decode(nalu) != nil {
+                break
+            }
+            reader.h265Spss[sps.Sps_seq_parameter_set_id] = sps
+            reader.reorder.SetDepth(sps.MaxNumReorderPics())
+            vui := &sps.Vui
+            if sps.Vui_parameters_present_flag == 1 && vui.Vui_timing_info_present_flag == 1 {
+                reader.setVuiFrameRate(vui.Vui_time_scale, vui.Vui_num_units_in_tick)
+            }
+        case naluType == H265_NAL_PPS:
+            pps := &H265RawPPS{}
+            if pps.Decode(nalu) != nil {
+                break
+            }
+            reader.h265Ppss[pps.Pps_pic_parameter_set_id] = pps
+        case naluType == 37: //EOS_NUT, 之后的IRAP的poc重新开始
+            reader.h265Calc.Reset()
+            reader.resetPoc = true
+        case IsH265VCLNaluType(naluType):
+            sh, _ = DecodeH265SliceHeader(nalu, reader.h265Spss, reader.h265Ppss)
+            return false
+        }
+        return true
+    })
+    if sh == nil {
+        return
+    }
+    sps := reader.h265Spss[reader.h265Ppss[sh.Slice_pic_parameter_set_id].Pps_seq_parameter_set_id]
+    if sh.IsIRAP() {
+        reader.window.reset()
+    }
+    poc = reader.h265Calc.PicOrderCnt(sps, sh)
+    return poc, sh.IsIDR(), true
+}
+
+/*********************************audio*********************************/
+
+func (reader *ESReader) onAudioFrame(frame []byte, sampleRate int, channels int, samples int) {
+    if sampleRate != reader.sampleRate {
+        //采样率变化之后以当前时间为起点重新计算
+        if reader.sampleRate > 0 {
+            reader.baseMs += reader.samples * 1000 / uint64(reader.sampleRate)
+        }
+        reader.samples = 0
+        reader.sampleRate = sampleRate
+    }
+    reader.channels = channels
+    pts := reader.baseMs + reader.samples*1000/uint64(sampleRate)
+    reader.samples += uint64(samples)
+    f := make([]byte, len(frame))
+    copy(f, frame)
+    reader.frames = append(reader.frames, esFrame{frame: f, pts: pts, dts: pts})
+}
+
+// 数据不够时读取数据, 读到文件末尾时返回io.EOF(丢弃不完整的帧)
+func (reader *ESReader) need(n int) error {
+    if len(reader.buf) >= n {
+        return nil
+    }
+    if reader.eof {
+        return io.EOF
+    }
+    return reader.fill()
+}
+
+func (reader *ESReader) parseAAC() error {
+    start := FindSyncword(reader.buf, 0)
+    if start < 0 {
+        if len(reader.buf) > 1 {
+            reader.consume(len(reader.buf) - 1)
+        }
+        return reader.fill()
+    }
+    reader.consume(start)
+    if len(reader.buf) < 7 {
+        return reader.need(7)
+    }
+    var adts ADTS_Frame_Header
+    adts.Decode(reader.buf)
+    frameLength := int(adts.Variable_Header.Frame_length)
+    sampleRate := AACSampleIdxToSample(int(adts.Fix_Header.Sampling_frequency_index))
+    if adts.Fix_Header.Layer != 0 || frameLength < 7 || sampleRate == 0 {
+        reader.consume(1)
+        return nil
+    }
+    if len(reader.buf) < frameLength {
+        return reader.need(frameLength)
+    }
+    channels := int(adts.Fix_Header.Channel_configuration)
+    if channels == 7 {
+        channels = 8
+    }
+    samples := 1024 * (int(adts.Variable_Header.Number_of_raw_data_blocks_in_frame) + 1)
+    reader.onAudioFrame(reader.buf[:frameLength], sampleRate, channels, samples)
+    reader.consume(frameLength)
+    return nil
+}
+
+// 帧头中的version/layer/bitrate/samplerate不能为保留值
+func isValidMp3Head(data []byte) bool {
+    return data[0] == 0xFF && data[1]&0xE0 == 0xE0 &&
+        (data[1]>>3)&0x03 != 0x01 && (data[1]>>1)&0x03 != 0x00 &&
+        data[2]>>4 != 0x00 && data[2]>>4 != 0x0F && (data[2]>>2)&0x03 != 0x03
+}
+
+func (reader *ESReader) parseMp3() error {
+    if reader.skipPending > 0 {
+        if len(reader.buf) == 0 {
+            return reader.need(1)
+        }
+        n := Min(reader.skipPending, len(reader.buf))
+        reader.consume(n)
+        reader.skipPending -= n
+        return nil
+    }
+    if len(reader.buf) < 4 {
+        return reader.need(4)
+    }
+    data := reader.buf
+    if bytes.HasPrefix(data, []byte{'I', 'D', '3'}) {
+        if len(data) < 10 {
+            return reader.need(10)
+        }
+        if tag, err := DecodeID3V2Head(data); err == nil {
+            reader.skipPending = tag.TotalSize()
+        } else {
+            reader.consume(1)
+        }
+        return nil
+    }
+    if bytes.HasPrefix(data, []byte{'T', 'A', 'G'}) {
+        reader.skipPending = 128
+        return nil
+    }
+    if !isValidMp3Head(data) {
+        idx := bytes.IndexByte(data[1:], 0xFF)
+        if idx < 0 {
+            reader.consume(len(data))
+        } else {
+            reader.consume(idx + 1)
+        }
+        return nil
+    }
+    head, err := DecodeMp3Head(data)
+    if err != nil || head.FrameSize < 4 {
+        reader.consume(1)
+        return nil
+    }
+    if len(reader.buf) < head.FrameSize {
+        return reader.need(head.FrameSize)
+    }
+    frame := reader.buf[:head.FrameSize]
+    if reader.firstMp3 {
+        reader.firstMp3 = false
+        if _, err = DecodeMP3VBRHeader(frame); err == nil {
+            reader.consume(head.FrameSize)
+            return nil
+        }
+    }
+    reader.onAudioFrame(frame, head.GetSampleRate(), head.GetChannelCount(), head.SampleSize)
+    reader.consume(head.FrameSize)
+    return nil
+}
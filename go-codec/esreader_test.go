@@ -0,0 +1,172 @@
+package codec
+
+import (
+    "bytes"
+    "io"
+    "reflect"
+    "testing"
+    "testing/iotest"
+)
+
+func readAllESFrames(t *testing.T, reader *ESReader) (frames [][]byte, ptss []uint64, dtss []uint64) {
+    for {
+        frame, pts, dts, err := reader.ReadFrame()
+        if err == io.EOF {
+            return
+        } else if err != nil {
+            t.Fatalf("ESReader.ReadFrame() error = %v", err)
+        }
+        frames = append(frames, frame)
+        ptss = append(ptss, pts)
+        dtss = append(dtss, dts)
+    }
+}
+
+func makeH264TestES(sps []byte, gops int) []byte {
+    var es []byte
+    for g := 0; g < gops; g++ {
+        for i, pic := range h264TestGop {
+            if i == 0 {
+                es = append(append(es, 0x00, 0x00, 0x00, 0x01), sps...)
+                es = append(append(es, 0x00, 0x00, 0x01), h264TestPps...)
+            }
+            es = append(es, 0x00, 0x00, 0x00, 0x01)
+            es = append(es, makeH264TestSlice(pic.nalType, pic.refIdc, pic.sliceType, pic.frameNum, pic.pocLsb)...)
+        }
+    }
+    return es
+}
+
+func TestESReader_H264(t *testing.T) {
+    sps := &SPS{}
+    sps.Decode(NewBitStream(CovertRbspToSodb(h264TestSps[1:])))
+    sps.Vui_parameters_present_flag = 1
+    sps.VuiParameters.TimingInfoPresentFlag = 1
+    sps.VuiParameters.NumUnitsInTick = 1
+    sps.VuiParameters.TimeScale = 60
+    vuiSps := EncodeH264SPSNalu(sps)
+    sps.VuiParameters.TimingInfoPresentFlag = 0
+    noTimingSps := EncodeH264SPSNalu(sps)
+
+    //显示顺序的帧序号, 第一帧预留2个重排序延迟
+    units := []uint64{2, 5, 3, 4, 8, 6, 7, 9, 12, 10, 11, 15, 13, 14}
+    tests := []struct {
+        name      string
+        es        []byte
+        fps       [2]int
+        oneByte   bool
+        frameRate [2]int
+        msPerUnit func(u uint64) uint64
+    }{
+        {name: "configured frame rate", es: makeH264TestES(vuiSps, 2), fps: [2]int{25, 1}, frameRate: [2]int{25, 1},
+            msPerUnit: func(u uint64) uint64 { return u * 40 }},
+        {name: "vui timing info", es: makeH264TestES(vuiSps, 2), frameRate: [2]int{60, 2},
+            msPerUnit: func(u uint64) uint64 { return u * 1000 / 30 }},
+        {name: "one byte reader", es: makeH264TestES(h264TestSps, 2), oneByte: true, frameRate: [2]int{50, 2},
+            msPerUnit: func(u uint64) uint64 { return u * 40 }},
+        {name: "default frame rate", es: makeH264TestES(noTimingSps, 2), frameRate: [2]int{25, 1},
+            msPerUnit: func(u uint64) uint64 { return u * 40 }},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var r io.Reader = bytes.NewReader(append([]byte{0x12, 0x34}, tt.es...))
+            if tt.oneByte {
+                r = iotest.OneByteReader(r)
+            }
+            reader, err := NewESReader(r, CODECID_VIDEO_H264)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if tt.fps[0] > 0 {
+                reader.SetFrameRate(tt.fps[0], tt.fps[1])
+            }
+            frames, ptss, dtss := readAllESFrames(t, reader)
+            if len(frames) != len(units) {
+                t.Fatalf("got %d frames, want %d", len(frames), len(units))
+            }
+            if num, den := reader.FrameRate(); num != tt.frameRate[0] || den != tt.frameRate[1] {
+                t.Errorf("FrameRate() = %d/%d, want %d/%d", num, den, tt.frameRate[0], tt.frameRate[1])
+            }
+            wantPts := make([]uint64, len(units))
+            wantDts := make([]uint64, len(units))
+            for i, u := range units {
+                wantPts[i] = tt.msPerUnit(u)
+                wantDts[i] = tt.msPerUnit(uint64(i))
+            }
+            if !reflect.DeepEqual(ptss, wantPts) || !reflect.DeepEqual(dtss, wantDts) {
+                t.Errorf("pts = %v dts = %v, want %v %v", ptss, dtss, wantPts, wantDts)
+            }
+            if !IsH264IDRFrame(frames[0]) || !IsH264IDRFrame(frames[7]) || IsH264IDRFrame(frames[1]) {
+                t.Error("access unit is not split at idr")
+            }
+            var all []byte
+            for _, f := range frames {
+                all = append(all, f...)
+            }
+            if !bytes.Equal(all, tt.es) {
+                t.Error("access units do not cover the whole es")
+            }
+        })
+    }
+}
+
+func TestESReader_AAC(t *testing.T) {
+    var es []byte
+    es = append(es, 0x00, 0x01, 0x02)
+    for i := 0; i < 3; i++ {
+        adts := NewAdtsFrameHeader()
+        adts.Fix_Header.Profile = uint8(LC)
+        adts.Fix_Header.Sampling_frequency_index = uint8(AAC_SAMPLE_44100)
+        adts.Fix_Header.Channel_configuration = 2
+        adts.Variable_Header.Frame_length = 7 + 20
+        es = append(es, adts.Encode()...)
+        es = append(es, make([]byte, 20)...)
+    }
+    reader, err := NewESReader(iotest.HalfReader(bytes.NewReader(es)), CODECID_AUDIO_AAC)
+    if err != nil {
+        t.Fatal(err)
+    }
+    frames, ptss, dtss := readAllESFrames(t, reader)
+    if len(frames) != 3 || len(frames[0]) != 27 {
+        t.Fatalf("got %d frames", len(frames))
+    }
+    if want := []uint64{0, 23, 46}; !reflect.DeepEqual(ptss, want) || !reflect.DeepEqual(dtss, want) {
+        t.Errorf("pts = %v dts = %v, want %v", ptss, dtss, want)
+    }
+    if reader.SampleRate() != 44100 || reader.ChannelCount() != 2 {
+        t.Errorf("sample rate = %d channels = %d", reader.SampleRate(), reader.ChannelCount())
+    }
+}
+
+func TestESReader_MP3(t *testing.T) {
+    var es []byte
+    es = append(es, makeID3Tag(4, 0, makeID3Frame(4, "TIT2", 0, []byte{0x03, 'a', 'b'}))...)
+    es = append(es, makeXingFrame([]byte{0xFF, 0xFB, 0x90, 0x00}, 417, 36, "Xing", XING_FLAG_FRAMES, 3, 0, false)...)
+    for i := 0; i < 3; i++ {
+        frame := make([]byte, 417)
+        copy(frame, []byte{0xFF, 0xFB, 0x90, 0x00})
+        frame[4] = byte(i)
+        es = append(es, frame...)
+    }
+    tag := make([]byte, 128)
+    copy(tag, "TAG")
+    es = append(es, tag...)
+
+    reader, err := NewESReader(bytes.NewReader(es), CODECID_AUDIO_MP3)
+    if err != nil {
+        t.Fatal(err)
+    }
+    frames, ptss, _ := readAllESFrames(t, reader)
+    if len(frames) != 3 || frames[2][4] != 2 {
+        t.Fatalf("got %d frames", len(frames))
+    }
+    if want := []uint64{0, 26, 52}; !reflect.DeepEqual(ptss, want) {
+        t.Errorf("pts = %v, want %v", ptss, want)
+    }
+    if reader.SampleRate() != 44100 || reader.ChannelCount() != 2 {
+        t.Errorf("sample rate = %d channels = %d", reader.SampleRate(), reader.ChannelCount())
+    }
+    if _, err := NewESReader(bytes.NewReader(es), CODECID_AUDIO_OPUS); err == nil {
+        t.Error("expect error for unsupport codec")
+    }
+}
@@ -0,0 +1,551 @@
+package codec
+
+import (
+    "encoding/binary"
+    "errors"
+)
+
+// https://xiph.org/flac/format.html
+// STREAM
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+// |  "fLaC"  |  METADATA_BLOCK(STREAMINFO)  |  METADATA_BLOCK*  |  FRAME+  |
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+
+// METADATA_BLOCK_HEADER {
+//     Last-metadata-block flag     1
+//     BLOCK_TYPE                   7
+//     Length                       24
+// }
+
+// METADATA_BLOCK_STREAMINFO {
+//     minimum block size           16
+//     maximum block size           16
+//     minimum frame size           24
+//     maximum frame size           24
+//     sample rate                  20
+//     (number of channels)-1       3
+//     (bits per sample)-1          5
+//     total samples in stream      36
+//     MD5 signature                128
+// }
+
+// FRAME_HEADER {
+//     Sync code                    14  '11111111111110'
+//     Reserved                     1
+//     Blocking strategy            1
+//     Block size                   4
+//     Sample rate                  4
+//     Channel assignment           4
+//     Sample size                  3
+//     Reserved                     1
+//     frame/sample number          8-56 "UTF-8" coded
+//     if(blocksize bits == 011x)   8/16 (blocksize-1)
+//     if(sample rate bits == 11xx) 8/16
+//     CRC-8                        8
+// }
+// FRAME_FOOTER {
+//     CRC-16                       16
+// }
+
+const (
+    FLAC_METADATA_STREAMINFO     = 0
+    FLAC_METADATA_PADDING        = 1
+    FLAC_METADATA_APPLICATION    = 2
+    FLAC_METADATA_SEEKTABLE      = 3
+    FLAC_METADATA_VORBIS_COMMENT = 4
+    FLAC_METADATA_CUESHEET       = 5
+    FLAC_METADATA_PICTURE        = 6
+)
+
+const (
+    FLAC_STREAMINFO_SIZE       = 34
+    FLAC_MIN_FRAME_SIZE        = 10
+    FLAC_MAX_HEADER_SIZE       = 16
+    FLAC_SEEKPOINT_SIZE        = 18
+    FLAC_SEEKPOINT_PLACEHOLDER = 0xFFFFFFFFFFFFFFFF
+)
+
+const (
+    FLAC_CHANNEL_LEFT_SIDE  = 8
+    FLAC_CHANNEL_RIGHT_SIDE = 9
+    FLAC_CHANNEL_MID_SIDE   = 10
+)
+
+var FLACStreamMarker []byte = []byte("fLaC")
+
+var FLACSampleRateTable [12]int = [12]int{0, 88200, 176400, 192000, 8000, 16000, 22050, 24000, 32000, 44100, 48000, 96000}
+var FLACSampleSizeTable [8]int = [8]int{0, 8, 12, 0, 16, 20, 24, 32}
+
+var errFLACInvalidFrameHead = errors.New("invalid flac frame header")
+var errFLACFrameHeadCrc = errors.New("flac frame header crc-8 mismatch")
+
+type FLACStreamInfo struct {
+    Min_block_size  uint16
+    Max_block_size  uint16
+    Min_frame_size  uint32
+    Max_frame_size  uint32
+    Sample_rate     uint32
+    Channels        uint8 //已经+1
+    Bits_per_sample uint8 //已经+1
+    Total_samples   uint64
+    Md5             [16]byte
+}
+
+func (si *FLACStreamInfo) Decode(data []byte) error {
+    if len(data) < FLAC_STREAMINFO_SIZE {
+        return errors.New("flac streaminfo length must be 34")
+    }
+    bs := NewBitStream(data)
+    si.Min_block_size = bs.Uint16(16)
+    si.Max_block_size = bs.Uint16(16)
+    si.Min_frame_size = bs.Uint32(24)
+    si.Max_frame_size = bs.Uint32(24)
+    si.Sample_rate = bs.Uint32(20)
+    si.Channels = bs.Uint8(3) + 1
+    si.Bits_per_sample = bs.Uint8(5) + 1
+    si.Total_samples = bs.GetBits(36)
+    copy(si.Md5[:], data[18:34])
+    return nil
+}
+
+func (si *FLACStreamInfo) Encode() []byte {
+    bsw := NewBitStreamWriter(FLAC_STREAMINFO_SIZE)
+    bsw.PutUint16(si.Min_block_size, 16)
+    bsw.PutUint16(si.Max_block_size, 16)
+    bsw.PutUint32(si.Min_frame_size, 24)
+    bsw.PutUint32(si.Max_frame_size, 24)
+    bsw.PutUint32(si.Sample_rate, 20)
+    bsw.PutUint8(si.Channels-1, 3)
+    bsw.PutUint8(si.Bits_per_sample-1, 5)
+    bsw.PutUint64(si.Total_samples, 36)
+    bsw.PutBytes(si.Md5[:])
+    return bsw.Bits()
+}
+
+type FLACMetadataBlock struct {
+    Last_metadata_block uint8
+    Block_type          uint8
+    Data                []byte
+}
+
+// DecodeFLACMetadataBlocks 解析"fLaC"之后的metadata block, data可以以"fLaC"开头
+// 返回所有的metadata block, 以及第一个FRAME在data中的偏移
+func DecodeFLACMetadataBlocks(data []byte) (blocks []FLACMetadataBlock, offset int, err error) {
+    if len(data) >= 4 && string(data[:4]) == string(FLACStreamMarker) {
+        offset = 4
+    }
+    for {
+        if offset+4 > len(data) {
+            return nil, 0, errors.New("flac metadata block header is truncated")
+        }
+        last := data[offset] >> 7
+        blockType := data[offset] & 0x7F
+        length := int(data[offset+1])<<16 | int(data[offset+2])<<8 | int(data[offset+3])
+        offset += 4
+        if offset+length > len(data) {
+            return nil, 0, errors.New("flac metadata block is truncated")
+        }
+        if blockType == 127 {
+            return nil, 0, errors.New("invalid flac metadata block type")
+        }
+        blocks = append(blocks, FLACMetadataBlock{
+            Last_metadata_block: last,
+            Block_type:          blockType,
+            Data:                data[offset : offset+length],
+        })
+        offset += length
+        if last == 1 {
+            break
+        }
+    }
+    if blocks[0].Block_type != FLAC_METADATA_STREAMINFO {
+        return nil, 0, errors.New("the first flac metadata block must be streaminfo")
+    }
+    return
+}
+
+// EncodeFLACMetadataBlocks 不包含"fLaC", 最后一个block的Last-metadata-block会被置1, 其余置0
+func EncodeFLACMetadataBlocks(blocks []FLACMetadataBlock) []byte {
+    var out []byte
+    for i, block := range blocks {
+        hdr := uint32(block.Block_type&0x7F)<<24 | uint32(len(block.Data))&0xFFFFFF
+        if i == len(blocks)-1 {
+            hdr |= 0x80000000
+        }
+        out = append(out, uint8(hdr>>24), uint8(hdr>>16), uint8(hdr>>8), uint8(hdr))
+        out = append(out, block.Data...)
+    }
+    return out
+}
+
+// FindFLACStreamInfo 从metadata block中找到STREAMINFO并解析
+func FindFLACStreamInfo(blocks []FLACMetadataBlock) (*FLACStreamInfo, error) {
+    for _, block := range blocks {
+        if block.Block_type == FLAC_METADATA_STREAMINFO {
+            si := &FLACStreamInfo{}
+            if err := si.Decode(block.Data); err != nil {
+                return nil, err
+            }
+            return si, nil
+        }
+    }
+    return nil, errors.New("flac streaminfo not found")
+}
+
+type FLACSeekPoint struct {
+    Sample_number uint64
+    Offset        uint64
+    Samples       uint16
+}
+
+func DecodeFLACSeekTable(data []byte) []FLACSeekPoint {
+    points := make([]FLACSeekPoint, 0, len(data)/FLAC_SEEKPOINT_SIZE)
+    for i := 0; i+FLAC_SEEKPOINT_SIZE <= len(data); i += FLAC_SEEKPOINT_SIZE {
+        points = append(points, FLACSeekPoint{
+            Sample_number: binary.BigEndian.Uint64(data[i:]),
+            Offset:        binary.BigEndian.Uint64(data[i+8:]),
+            Samples:       binary.BigEndian.Uint16(data[i+16:]),
+        })
+    }
+    return points
+}
+
+func EncodeFLACSeekTable(points []FLACSeekPoint) []byte {
+    out := make([]byte, len(points)*FLAC_SEEKPOINT_SIZE)
+    for i, point := range points {
+        binary.BigEndian.PutUint64(out[i*FLAC_SEEKPOINT_SIZE:], point.Sample_number)
+        binary.BigEndian.PutUint64(out[i*FLAC_SEEKPOINT_SIZE+8:], point.Offset)
+        binary.BigEndian.PutUint16(out[i*FLAC_SEEKPOINT_SIZE+16:], point.Samples)
+    }
+    return out
+}
+
+// VORBIS_COMMENT, 长度字段是小端
+type FLACVorbisComment struct {
+    Vendor   string
+    Comments []string
+}
+
+func (vc *FLACVorbisComment) Decode(data []byte) error {
+    readString := func() (string, error) {
+        if len(data) < 4 {
+            return "", errors.New("vorbis comment is truncated")
+        }
+        length := binary.LittleEndian.Uint32(data)
+        if uint64(length) > uint64(len(data)-4) {
+            return "", errors.New("vorbis comment is truncated")
+        }
+        str := string(data[4 : 4+length])
+        data = data[4+length:]
+        return str, nil
+    }
+    var err error
+    if vc.Vendor, err = readString(); err != nil {
+        return err
+    }
+    if len(data) < 4 {
+        return errors.New("vorbis comment is truncated")
+    }
+    count := binary.LittleEndian.Uint32(data)
+    data = data[4:]
+    vc.Comments = make([]string, 0, 8)
+    for i := uint32(0); i < count; i++ {
+        comment, err := readString()
+        if err != nil {
+            return err
+        }
+        vc.Comments = append(vc.Comments, comment)
+    }
+    return nil
+}
+
+func (vc *FLACVorbisComment) Encode() []byte {
+    out := appendUint32LE(nil, uint32(len(vc.Vendor)))
+    out = append(out, vc.Vendor...)
+    out = appendUint32LE(out, uint32(len(vc.Comments)))
+    for _, comment := range vc.Comments {
+        out = appendUint32LE(out, uint32(len(comment)))
+        out = append(out, comment...)
+    }
+    return out
+}
+
+func appendUint32LE(out []byte, v uint32) []byte {
+    return append(out, uint8(v), uint8(v>>8), uint8(v>>16), uint8(v>>24))
+}
+
+type FLACFrameHead struct {
+    Blocking_strategy  uint8
+    Block_size_code    uint8
+    Sample_rate_code   uint8
+    Channel_assignment uint8
+    Sample_size_code   uint8
+    Coded_number       uint64 //Blocking_strategy == 0 为frame number, 否则为sample number
+    Crc8               uint8
+    BlockSize          int
+    SampleRate         int
+    ChannelCount       int
+    BitsPerSample      int
+    HeadSize           int
+}
+
+// 固定blocksize时, 第一个sample = frame number * STREAMINFO中的blocksize
+// 最后一帧的blocksize可能小于其他帧, 所以si为nil时只对非最后一帧有效
+func (head *FLACFrameHead) SampleNumber(si *FLACStreamInfo) uint64 {
+    if head.Blocking_strategy == 1 {
+        return head.Coded_number
+    }
+    if si != nil && si.Min_block_size == si.Max_block_size {
+        return head.Coded_number * uint64(si.Min_block_size)
+    }
+    return head.Coded_number * uint64(head.BlockSize)
+}
+
+// DecodeFLACFrameHead sample rate/sample size 需要从STREAMINFO获取时, si不能为nil
+func DecodeFLACFrameHead(data []byte, si *FLACStreamInfo) (head *FLACFrameHead, err error) {
+    if len(data) < 6 || data[0] != 0xFF || data[1]&0xFE != 0xF8 {
+        return nil, errFLACInvalidFrameHead
+    }
+    head = &FLACFrameHead{}
+    head.Blocking_strategy = data[1] & 0x01
+    head.Block_size_code = data[2] >> 4
+    head.Sample_rate_code = data[2] & 0x0F
+    head.Channel_assignment = data[3] >> 4
+    head.Sample_size_code = (data[3] >> 1) & 0x07
+    if head.Block_size_code == 0 || head.Sample_rate_code == 0x0F || head.Channel_assignment > FLAC_CHANNEL_MID_SIDE ||
+        head.Sample_size_code == 3 || data[3]&0x01 == 1 {
+        return nil, errFLACInvalidFrameHead
+    }
+
+    offset := 4
+    var n int
+    if head.Coded_number, n = decodeFLACUTF8(data[offset:]); n == 0 {
+        return nil, errFLACInvalidFrameHead
+    }
+    if head.Blocking_strategy == 0 && n > 6 {
+        return nil, errFLACInvalidFrameHead
+    }
+    offset += n
+
+    switch {
+    case head.Block_size_code == 1:
+        head.BlockSize = 192
+    case head.Block_size_code <= 5:
+        head.BlockSize = 576 << (head.Block_size_code - 2)
+    case head.Block_size_code == 6:
+        if offset+1 > len(data) {
+            return nil, errFLACInvalidFrameHead
+        }
+        head.BlockSize = int(data[offset]) + 1
+        offset++
+    case head.Block_size_code == 7:
+        if offset+2 > len(data) {
+            return nil, errFLACInvalidFrameHead
+        }
+        head.BlockSize = int(binary.BigEndian.Uint16(data[offset:])) + 1
+        offset += 2
+    default:
+        head.BlockSize = 256 << (head.Block_size_code - 8)
+    }
+
+    switch {
+    case head.Sample_rate_code == 0:
+        if si == nil {
+            return nil, errors.New("flac frame sample rate need streaminfo")
+        }
+        head.SampleRate = int(si.Sample_rate)
+    case head.Sample_rate_code < 12:
+        head.SampleRate = FLACSampleRateTable[head.Sample_rate_code]
+    case head.Sample_rate_code == 12:
+        if offset+1 > len(data) {
+            return nil, errFLACInvalidFrameHead
+        }
+        head.SampleRate = int(data[offset]) * 1000
+        offset++
+    default:
+        if offset+2 > len(data) {
+            return nil, errFLACInvalidFrameHead
+        }
+        head.SampleRate = int(binary.BigEndian.Uint16(data[offset:]))
+        if head.Sample_rate_code == 14 {
+            head.SampleRate *= 10
+        }
+        offset += 2
+    }
+
+    if head.Sample_size_code == 0 {
+        if si == nil {
+            return nil, errors.New("flac frame sample size need streaminfo")
+        }
+        head.BitsPerSample = int(si.Bits_per_sample)
+    } else {
+        head.BitsPerSample = FLACSampleSizeTable[head.Sample_size_code]
+    }
+
+    if head.Channel_assignment < FLAC_CHANNEL_LEFT_SIDE {
+        head.ChannelCount = int(head.Channel_assignment) + 1
+    } else {
+        head.ChannelCount = 2
+    }
+
+    if offset+1 > len(data) {
+        return nil, errFLACInvalidFrameHead
+    }
+    head.Crc8 = data[offset]
+    if flacCrc8(data[:offset]) != head.Crc8 {
+        return nil, errFLACFrameHeadCrc
+    }
+    head.HeadSize = offset + 1
+    return head, nil
+}
+
+// Encode 根据Block_size_code/Sample_rate_code生成帧头(包含CRC-8)
+// Block_size_code为6/7时使用BlockSize, Sample_rate_code为12/13/14时使用SampleRate
+func (head *FLACFrameHead) Encode() []byte {
+    out := make([]byte, 4, FLAC_MAX_HEADER_SIZE)
+    out[0] = 0xFF
+    out[1] = 0xF8 | head.Blocking_strategy&0x01
+    out[2] = head.Block_size_code<<4 | head.Sample_rate_code&0x0F
+    out[3] = head.Channel_assignment<<4 | (head.Sample_size_code&0x07)<<1
+    out = append(out, encodeFLACUTF8(head.Coded_number)...)
+    switch head.Block_size_code {
+    case 6:
+        out = append(out, uint8(head.BlockSize-1))
+    case 7:
+        out = append(out, uint8((head.BlockSize-1)>>8), uint8(head.BlockSize-1))
+    }
+    switch head.Sample_rate_code {
+    case 12:
+        out = append(out, uint8(head.SampleRate/1000))
+    case 13:
+        out = append(out, uint8(head.SampleRate>>8), uint8(head.SampleRate))
+    case 14:
+        out = append(out, uint8(head.SampleRate/10>>8), uint8(head.SampleRate/10))
+    }
+    head.Crc8 = flacCrc8(out)
+    out = append(out, head.Crc8)
+    head.HeadSize = len(out)
+    return out
+}
+
+// FindFLACFrameHead 从offset开始查找下一个合法(CRC-8校验通过)的帧头
+func FindFLACFrameHead(data []byte, offset int, si *FLACStreamInfo) (int, *FLACFrameHead) {
+    for i := offset; i+1 < len(data); i++ {
+        if data[i] != 0xFF || data[i+1]&0xFE != 0xF8 {
+            continue
+        }
+        if head, err := DecodeFLACFrameHead(data[i:], si); err == nil {
+            return i, head
+        }
+    }
+    return -1, nil
+}
+
+// SplitFLACFrames FLAC帧没有长度字段, 以下一个合法帧头且当前帧CRC-16校验通过作为帧边界
+// 最后一帧到data结尾, 调用者需要保证data包含完整的帧
+func SplitFLACFrames(data []byte, si *FLACStreamInfo, onFrame func(head *FLACFrameHead, frame []byte)) error {
+    start, head := FindFLACFrameHead(data, 0, si)
+    if start < 0 {
+        return errors.New("not found flac frame")
+    }
+    next := start + FLAC_MIN_FRAME_SIZE
+    for {
+        pos, nextHead := FindFLACFrameHead(data, next, si)
+        if pos < 0 {
+            break
+        }
+        if flacCrc16(data[start:pos-2]) != binary.BigEndian.Uint16(data[pos-2:]) {
+            next = pos + 1
+            continue
+        }
+        if onFrame != nil {
+            onFrame(head, data[start:pos])
+        }
+        start, head = pos, nextHead
+        next = start + FLAC_MIN_FRAME_SIZE
+    }
+    if len(data)-start < FLAC_MIN_FRAME_SIZE || flacCrc16(data[start:len(data)-2]) != binary.BigEndian.Uint16(data[len(data)-2:]) {
+        return errors.New("the last flac frame is truncated")
+    }
+    if onFrame != nil {
+        onFrame(head, data[start:])
+    }
+    return nil
+}
+
+// "UTF-8" coded number, 最多7字节(36bit)
+func decodeFLACUTF8(data []byte) (uint64, int) {
+    if len(data) == 0 {
+        return 0, 0
+    }
+    first := data[0]
+    if first&0x80 == 0 {
+        return uint64(first), 1
+    }
+    n := 0
+    for mask := uint8(0x80); first&mask != 0 && n < 8; mask >>= 1 {
+        n++
+    }
+    if n < 2 || n > 7 || len(data) < n {
+        return 0, 0
+    }
+    v := uint64(first & (0xFF >> (n + 1)))
+    for i := 1; i < n; i++ {
+        if data[i]&0xC0 != 0x80 {
+            return 0, 0
+        }
+        v = v<<6 | uint64(data[i]&0x3F)
+    }
+    return v, n
+}
+
+func encodeFLACUTF8(v uint64) []byte {
+    if v < 0x80 {
+        return []byte{uint8(v)}
+    }
+    n := 2
+    for ; n < 7; n++ {
+        if v < 1<<(5*n+1) {
+            break
+        }
+    }
+    out := make([]byte, n)
+    for i := n - 1; i > 0; i-- {
+        out[i] = 0x80 | uint8(v&0x3F)
+        v >>= 6
+    }
+    out[0] = uint8(uint16(0xFF00)>>n) | uint8(v)
+    return out
+}
+
+// CRC-8 x^8 + x^2 + x^1 + x^0
+func flacCrc8(data []byte) uint8 {
+    var crc uint8
+    for _, b := range data {
+        crc ^= b
+        for i := 0; i < 8; i++ {
+            if crc&0x80 != 0 {
+                crc = crc<<1 ^ 0x07
+            } else {
+                crc <<= 1
+            }
+        }
+    }
+    return crc
+}
+
+// CRC-16 x^16 + x^15 + x^2 + x^0
+func flacCrc16(data []byte) uint16 {
+    var crc uint16
+    for _, b := range data {
+        crc ^= uint16(b) << 8
+        for i := 0; i < 8; i++ {
+            if crc&0x8000 != 0 {
+                crc = crc<<1 ^ 0x8005
+            } else {
+                crc <<= 1
+            }
+        }
+    }
+    return crc
+}
@@ -0,0 +1,174 @@
+package codec
+
+import (
+    "bytes"
+    "encoding/binary"
+    "reflect"
+    "testing"
+)
+
+func makeFLACFrame(head *FLACFrameHead, payload []byte) []byte {
+    frame := append(head.Encode(), payload...)
+    crc := flacCrc16(frame)
+    return append(frame, uint8(crc>>8), uint8(crc))
+}
+
+func makeFLACStreamHeader(si *FLACStreamInfo, blocks ...FLACMetadataBlock) []byte {
+    blocks = append([]FLACMetadataBlock{{Block_type: FLAC_METADATA_STREAMINFO, Data: si.Encode()}}, blocks...)
+    return append([]byte("fLaC"), EncodeFLACMetadataBlocks(blocks)...)
+}
+
+func TestFLACStreamInfo(t *testing.T) {
+    si := &FLACStreamInfo{Min_block_size: 4096, Max_block_size: 4096, Min_frame_size: 14, Max_frame_size: 12345,
+        Sample_rate: 96000, Channels: 6, Bits_per_sample: 24, Total_samples: 0x912345678, Md5: [16]byte{1, 2, 3, 15: 16}}
+    data := si.Encode()
+    if len(data) != FLAC_STREAMINFO_SIZE {
+        t.Fatalf("len of streaminfo = %d", len(data))
+    }
+    got := &FLACStreamInfo{}
+    if err := got.Decode(data); err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(got, si) {
+        t.Errorf("Decode(Encode()) = %+v, want %+v", got, si)
+    }
+}
+
+func TestDecodeFLACMetadataBlocks(t *testing.T) {
+    si := &FLACStreamInfo{Min_block_size: 4096, Max_block_size: 4096, Sample_rate: 44100, Channels: 2, Bits_per_sample: 16}
+    vc := &FLACVorbisComment{Vendor: "reference libFLAC 1.3.2", Comments: []string{"TITLE=test", "ARTIST=gomedia"}}
+    seek := []FLACSeekPoint{{Sample_number: 0, Offset: 0, Samples: 4096}, {Sample_number: FLAC_SEEKPOINT_PLACEHOLDER}}
+    stream := makeFLACStreamHeader(si,
+        FLACMetadataBlock{Block_type: FLAC_METADATA_SEEKTABLE, Data: EncodeFLACSeekTable(seek)},
+        FLACMetadataBlock{Block_type: FLAC_METADATA_VORBIS_COMMENT, Data: vc.Encode()},
+        FLACMetadataBlock{Block_type: FLAC_METADATA_PADDING, Data: make([]byte, 16)})
+    stream = append(stream, 0xFF, 0xF8)
+
+    blocks, offset, err := DecodeFLACMetadataBlocks(stream)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(blocks) != 4 || offset != len(stream)-2 || blocks[3].Last_metadata_block != 1 || blocks[0].Last_metadata_block != 0 {
+        t.Fatalf("DecodeFLACMetadataBlocks() = %d blocks, offset %d", len(blocks), offset)
+    }
+    gotSi, err := FindFLACStreamInfo(blocks)
+    if err != nil || !reflect.DeepEqual(gotSi, si) {
+        t.Errorf("FindFLACStreamInfo() = %+v, %v", gotSi, err)
+    }
+    if got := DecodeFLACSeekTable(blocks[1].Data); !reflect.DeepEqual(got, seek) {
+        t.Errorf("DecodeFLACSeekTable() = %+v", got)
+    }
+    gotVc := &FLACVorbisComment{}
+    if err := gotVc.Decode(blocks[2].Data); err != nil || !reflect.DeepEqual(gotVc, vc) {
+        t.Errorf("FLACVorbisComment.Decode() = %+v, %v", gotVc, err)
+    }
+    if got := EncodeFLACMetadataBlocks(blocks); !bytes.Equal(got, stream[4:offset]) {
+        t.Errorf("EncodeFLACMetadataBlocks() mismatch")
+    }
+
+    if _, _, err := DecodeFLACMetadataBlocks(stream[:20]); err == nil {
+        t.Errorf("expected error for truncated metadata")
+    }
+    if _, _, err := DecodeFLACMetadataBlocks([]byte{0x84, 0x00, 0x00, 0x00}); err == nil {
+        t.Errorf("expected error when the first block is not streaminfo")
+    }
+}
+
+func TestDecodeFLACFrameHead(t *testing.T) {
+    si := &FLACStreamInfo{Min_block_size: 4096, Max_block_size: 4096, Sample_rate: 44100, Channels: 2, Bits_per_sample: 16}
+    tests := []struct {
+        name       string
+        head       FLACFrameHead
+        blockSize  int
+        sampleRate int
+        channels   int
+        bits       int
+        sampleNum  uint64
+    }{
+        {name: "fixed 4096 44.1k stereo", head: FLACFrameHead{Block_size_code: 12, Sample_rate_code: 9, Channel_assignment: 1, Sample_size_code: 4, Coded_number: 3},
+            blockSize: 4096, sampleRate: 44100, channels: 2, bits: 16, sampleNum: 3 * 4096},
+        {name: "mid side from streaminfo", head: FLACFrameHead{Block_size_code: 1, Sample_rate_code: 0, Channel_assignment: FLAC_CHANNEL_MID_SIDE, Sample_size_code: 0, Coded_number: 200},
+            blockSize: 192, sampleRate: 44100, channels: 2, bits: 16, sampleNum: 200 * 4096},
+        {name: "variable 8bit blocksize", head: FLACFrameHead{Blocking_strategy: 1, Block_size_code: 6, BlockSize: 100, Sample_rate_code: 12, SampleRate: 12000, Channel_assignment: 0, Sample_size_code: 6, Coded_number: 0x12345678},
+            blockSize: 100, sampleRate: 12000, channels: 1, bits: 24, sampleNum: 0x12345678},
+        {name: "16bit blocksize and rate", head: FLACFrameHead{Blocking_strategy: 1, Block_size_code: 7, BlockSize: 1000, Sample_rate_code: 13, SampleRate: 37800, Channel_assignment: 5, Sample_size_code: 1, Coded_number: 0xFFFFFFFFF},
+            blockSize: 1000, sampleRate: 37800, channels: 6, bits: 8, sampleNum: 0xFFFFFFFFF},
+        {name: "rate in tens of hz", head: FLACFrameHead{Blocking_strategy: 1, Block_size_code: 8, Sample_rate_code: 14, SampleRate: 352800, Channel_assignment: 7, Sample_size_code: 7, Coded_number: 0x7F},
+            blockSize: 256, sampleRate: 352800, channels: 8, bits: 32, sampleNum: 0x7F},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            data := tt.head.Encode()
+            head, err := DecodeFLACFrameHead(append(data, 0x00), si)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if head.BlockSize != tt.blockSize || head.SampleRate != tt.sampleRate || head.ChannelCount != tt.channels ||
+                head.BitsPerSample != tt.bits || head.SampleNumber(si) != tt.sampleNum || head.HeadSize != len(data) {
+                t.Errorf("DecodeFLACFrameHead() = %+v", head)
+            }
+        })
+    }
+
+    head := FLACFrameHead{Block_size_code: 12, Sample_rate_code: 9, Channel_assignment: 1, Sample_size_code: 4}
+    data := head.Encode()
+    data[len(data)-1]++
+    if _, err := DecodeFLACFrameHead(data, si); err != errFLACFrameHeadCrc {
+        t.Errorf("crc mismatch err = %v", err)
+    }
+    if _, err := DecodeFLACFrameHead([]byte{0xFF, 0xF8, 0x09, 0x18, 0x00, 0x00}, nil); err == nil {
+        t.Errorf("expected error for reserved block size")
+    }
+}
+
+func TestSplitFLACFrames(t *testing.T) {
+    si := &FLACStreamInfo{Min_block_size: 4096, Max_block_size: 4096, Sample_rate: 44100, Channels: 2, Bits_per_sample: 16}
+    var frames [][]byte
+    for i := 0; i < 4; i++ {
+        head := &FLACFrameHead{Block_size_code: 12, Sample_rate_code: 9, Channel_assignment: 1, Sample_size_code: 4, Coded_number: uint64(i)}
+        payload := bytes.Repeat([]byte{uint8(i + 1)}, 40+i*10)
+        // 在payload中插入伪造的帧头
+        copy(payload[8:], []byte{0xFF, 0xF8, 0xC9, 0x18})
+        frames = append(frames, makeFLACFrame(head, payload))
+    }
+    // 插入一个帧头合法但CRC-16不匹配的数据
+    fake := (&FLACFrameHead{Block_size_code: 12, Sample_rate_code: 9, Channel_assignment: 1, Sample_size_code: 4, Coded_number: 9}).Encode()
+    copy(frames[1][20:], fake)
+    crc := flacCrc16(frames[1][:len(frames[1])-2])
+    binary.BigEndian.PutUint16(frames[1][len(frames[1])-2:], crc)
+
+    stream := makeFLACStreamHeader(si)
+    for _, frame := range frames {
+        stream = append(stream, frame...)
+    }
+    _, offset, err := DecodeFLACMetadataBlocks(stream)
+    if err != nil {
+        t.Fatal(err)
+    }
+    var got [][]byte
+    err = SplitFLACFrames(stream[offset:], si, func(head *FLACFrameHead, frame []byte) {
+        if head.SampleNumber(si) != uint64(len(got)*4096) {
+            t.Errorf("frame %d sample number %d", len(got), head.SampleNumber(si))
+        }
+        got = append(got, frame)
+    })
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(got, frames) {
+        t.Errorf("SplitFLACFrames() got %d frames", len(got))
+    }
+    if err := SplitFLACFrames(stream[offset:len(stream)-1], si, nil); err == nil {
+        t.Errorf("expected error for truncated frame")
+    }
+}
+
+func TestFLACUTF8(t *testing.T) {
+    for _, v := range []uint64{0, 0x7F, 0x80, 0x7FF, 0x800, 0xFFFF, 0x10000, 0x1FFFFF, 0x3FFFFFF, 0x7FFFFFFF, 0xFFFFFFFFF} {
+        data := encodeFLACUTF8(v)
+        got, n := decodeFLACUTF8(data)
+        if got != v || n != len(data) {
+            t.Errorf("utf8 %x: encode %x decode %x(%d)", v, data, got, n)
+        }
+    }
+}
@@ -0,0 +1,174 @@
+package codec
+
+import (
+    "testing"
+)
+
+// go test -run=^$ -fuzz=FuzzXXX
+// 只检查不会panic, 解析结果不做校验
+
+func FuzzH264ParameterSets(f *testing.F) {
+    f.Add(h264TestSps)
+    f.Add(h264TestPps)
+    f.Add(sps2)
+    f.Add([]byte{0x65, 0x88, 0x84, 0x00, 0x33})
+    f.Add([]byte{0x06, 0x05, 0x02, 0xAA, 0xBB, 0x80})
+    f.Fuzz(func(t *testing.T, nalu []byte) {
+        if len(nalu) < 1 {
+            return
+        }
+        var sps SPS
+        sps.Decode(NewBitStream(CovertRbspToSodb(nalu[1:])))
+        sps.MaxNumReorderFrames()
+        var pps PPS
+        pps.Decode(NewBitStream(CovertRbspToSodb(nalu[1:])))
+        GetH264Resolution(nalu)
+        GetSPSIdWithStartCode(nalu)
+        GetPPSId(nalu)
+        spss := map[uint64]*SPS{sps.Seq_parameter_set_id: &sps}
+        ppss := map[uint64]*PPS{pps.Pic_parameter_set_id: &pps}
+        DecodeH264SliceHeader(nalu, spss, ppss)
+        DecodeH264SEINalu(nalu)
+        CreateH264AVCCExtradata([][]byte{nalu}, [][]byte{nalu})
+        GetH264CodecString(nalu)
+    })
+}
+
+func FuzzH265ParameterSets(f *testing.F) {
+    f.Add(vps[4:])
+    f.Add(sps[4:])
+    f.Add(pps[4:])
+    f.Add(h265sps2[4:])
+    f.Add(src)
+    f.Add([]byte{0x26, 0x01, 0xAF, 0x06, 0xB8})
+    f.Fuzz(func(t *testing.T, nalu []byte) {
+        var vps VPS
+        vps.Decode(nalu)
+        var sps H265RawSPS
+        sps.Decode(nalu)
+        var pps H265RawPPS
+        pps.Decode(nalu)
+        GetH265Resolution(nalu)
+        GetVPSIdWithStartCode(nalu)
+        GetH265PPSIdWithStartCode(nalu)
+        spss := map[uint64]*H265RawSPS{sps.Sps_seq_parameter_set_id: &sps}
+        ppss := map[uint64]*H265RawPPS{pps.Pps_pic_parameter_set_id: &pps}
+        DecodeH265SliceHeader(nalu, spss, ppss)
+        DecodeH265SEINalu(nalu)
+        hvcc := NewHEVCRecordConfiguration()
+        if hvcc.Decode(nalu) == nil {
+            hvcc.ToNalus()
+            hvcc.Encode()
+        }
+        GetH265CodecString(nalu)
+    })
+}
+
+func FuzzAAC(f *testing.F) {
+    f.Add([]byte{0xFF, 0xF1, 0x50, 0x80, 0x02, 0x1F, 0xFC, 0x21, 0x00})
+    f.Add([]byte{0x12, 0x10})
+    f.Add([]byte{0x56, 0xE0, 0x0A, 0x20, 0x00, 0x26, 0x20, 0x01, 0x00, 0x00})
+    f.Fuzz(func(t *testing.T, data []byte) {
+        var adts ADTS_Frame_Header
+        adts.Decode(data)
+        SplitAACFrame(data, func(aac []byte) {
+            ConvertADTSToASC(aac)
+        })
+        asc := NewAudioSpecificConfiguration()
+        asc.Decode(data)
+        ConvertASCToADTS(data, len(data))
+        GetAACCodecString(data)
+        var smc StreamMuxConfig
+        smc.Decode(data)
+        SplitLOASFrame(data, func(ame []byte) {
+            DecodeAudioMuxElement(ame, true, &smc)
+        })
+    })
+}
+
+func FuzzMp3(f *testing.F) {
+    f.Add([]byte{0xFF, 0xFB, 0x90, 0x64, 0x00, 0x00, 0x00, 0x00})
+    f.Add([]byte{'I', 'D', '3', 0x03, 0x00, 0x00, 0x00, 0x00, 0x00, 0x0A, 'T', 'I', 'T', '2', 0x00, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 'a'})
+    f.Add(append([]byte{0xFF, 0xFB, 0x90, 0x64}, append(make([]byte, 32), 'X', 'i', 'n', 'g', 0x00, 0x00, 0x00, 0x0F)...))
+    f.Fuzz(func(t *testing.T, data []byte) {
+        if head, err := DecodeMp3Head(data); err == nil {
+            head.GetBitRate()
+            head.GetSampleRate()
+            head.GetChannelCount()
+        }
+        SplitMp3Frames(data, func(head *MP3FrameHead, frame []byte) {
+            DecodeMP3VBRHeader(frame)
+        })
+        DecodeXingHeader(data)
+        DecodeVBRIHeader(data)
+        DecodeID3V2(data)
+        DecodeID3V1(data)
+    })
+}
+
+func FuzzOpus(f *testing.F) {
+    f.Add([]byte{0x78, 0x01, 0x02, 0x03})
+    f.Add([]byte{0x7B, 0xC2, 0x01, 0x01, 0xAA, 0xBB, 0xCC, 0x00})
+    f.Add(WriteDefaultOpusExtraData())
+    f.Add([]byte{'O', 'p', 'u', 's', 'H', 'e', 'a', 'd', 0x01, 0x03, 0x00, 0x00, 0x80, 0xBB, 0x00, 0x00, 0x00, 0x00, 0x01, 0x02, 0x01, 0x00, 0x02, 0x01})
+    f.Fuzz(func(t *testing.T, data []byte) {
+        ParseOpusPacket(data)
+        DecodeOpusPacket(data)
+        OpusPacketDuration(data)
+        ctx := &OpusContext{}
+        ctx.ParseExtranData(data)
+    })
+}
+
+func FuzzAC3(f *testing.F) {
+    f.Add([]byte{0x0B, 0x77, 0x00, 0x00, 0x08, 0x40, 0x2F, 0x84})
+    f.Add([]byte{0x0B, 0x77, 0x00, 0xBF, 0x34, 0x86, 0xFF, 0xE0})
+    f.Add([]byte{0x10, 0x3D, 0xC0})
+    f.Fuzz(func(t *testing.T, data []byte) {
+        DecodeAC3FrameHead(data)
+        SplitAC3Frames(data, func(head *AC3FrameHead, frame []byte) {})
+        var dac3 AC3SpecificConfig
+        dac3.Decode(data)
+        var dec3 EAC3SpecificConfig
+        dec3.Decode(data)
+    })
+}
+
+func FuzzFLAC(f *testing.F) {
+    f.Add([]byte{0x80, 0x00, 0x00, 0x22, 0x10, 0x00, 0x10, 0x00, 0x00, 0x00, 0x0E, 0x00, 0x0F, 0xFF, 0x0A, 0xC4, 0x42, 0xF0,
+        0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00})
+    f.Add([]byte{0xFF, 0xF8, 0x69, 0x18, 0x00, 0x00, 0xBF})
+    f.Fuzz(func(t *testing.T, data []byte) {
+        DecodeFLACMetadataBlocks(data)
+        DecodeFLACSeekTable(data)
+        var vc FLACVorbisComment
+        vc.Decode(data)
+        var si FLACStreamInfo
+        if si.Decode(data) != nil {
+            DecodeFLACFrameHead(data, nil)
+            SplitFLACFrames(data, nil, func(head *FLACFrameHead, frame []byte) {})
+            return
+        }
+        DecodeFLACFrameHead(data, &si)
+        SplitFLACFrames(data, &si, func(head *FLACFrameHead, frame []byte) {})
+    })
+}
+
+func FuzzAV1AndVP9(f *testing.F) {
+    f.Add(av1Frame)
+    f.Add(av1SeqHdrAnnexB)
+    f.Add(vp9KeyFrame)
+    f.Add([]byte{0x81, 0x00, 0x0C, 0x00, 0x0A, 0x0B, 0x00, 0x00, 0x00, 0x42, 0xAB, 0xBF, 0xC3, 0x77, 0xFF, 0xE6, 0x01})
+    f.Fuzz(func(t *testing.T, data []byte) {
+        GetAV1Resolution(data)
+        ConvertAV1AnnexBToLowOverhead(data)
+        var av1c AV1CodecConfigurationRecord
+        av1c.Decode(data)
+        GetAV1CodecString(data)
+        GetVP9Resolution(data)
+        var vpcc VPCodecConfigurationRecord
+        vpcc.Decode(data)
+        GetVP9CodecString(data)
+        GetResloution(data)
+    })
+}
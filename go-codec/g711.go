@@ -0,0 +1,205 @@
+package codec
+
+import "errors"
+
+// ITU-T G.711, 参考 Sun Microsystems g711.c
+//
+// A-law (PCMA), 输入为13bit线性PCM, 偶数位取反(^0x55)
+// +---+---+---+---+---+---+---+---+
+// | S |  segment  |   quantization |
+// +---+---+---+---+---+---+---+---+
+//
+// µ-law (PCMU), 输入为14bit线性PCM, 加上偏置0x84后全部取反
+// +---+---+---+---+---+---+---+---+
+// | S |  segment  |   quantization |
+// +---+---+---+---+---+---+---+---+
+//
+// 本文件中的线性PCM均为16bit有符号整数
+
+const (
+    G711_ULAW_BIAS = 0x84
+    G711_ULAW_CLIP = 8159
+)
+
+var alawSegEnd = [8]int{0x1F, 0x3F, 0x7F, 0xFF, 0x1FF, 0x3FF, 0x7FF, 0xFFF}
+var ulawSegEnd = [8]int{0x3F, 0x7F, 0xFF, 0x1FF, 0x3FF, 0x7FF, 0xFFF, 0x1FFF}
+
+var alawToLinearTable [256]int16
+var ulawToLinearTable [256]int16
+var alawToUlawTable [256]uint8
+var ulawToAlawTable [256]uint8
+
+func init() {
+    for i := 0; i < 256; i++ {
+        alawToLinearTable[i] = alaw2linear(uint8(i))
+        ulawToLinearTable[i] = ulaw2linear(uint8(i))
+    }
+    for i := 0; i < 256; i++ {
+        alawToUlawTable[i] = LinearToMuLaw(alawToLinearTable[i])
+        ulawToAlawTable[i] = LinearToALaw(ulawToLinearTable[i])
+    }
+}
+
+func searchSegment(val int, table *[8]int) int {
+    for i, end := range table {
+        if val <= end {
+            return i
+        }
+    }
+    return 8
+}
+
+func alaw2linear(a uint8) int16 {
+    a ^= 0x55
+    t := int(a&0x0F) << 4
+    seg := int(a&0x70) >> 4
+    switch seg {
+    case 0:
+        t += 8
+    case 1:
+        t += 0x108
+    default:
+        t += 0x108
+        t <<= seg - 1
+    }
+    if a&0x80 > 0 {
+        return int16(t)
+    }
+    return int16(-t)
+}
+
+func ulaw2linear(u uint8) int16 {
+    u = ^u
+    t := (int(u&0x0F) << 3) + G711_ULAW_BIAS
+    t <<= (u & 0x70) >> 4
+    if u&0x80 > 0 {
+        return int16(G711_ULAW_BIAS - t)
+    }
+    return int16(t - G711_ULAW_BIAS)
+}
+
+func LinearToALaw(pcm int16) uint8 {
+    val := int(pcm) >> 3
+    var mask uint8 = 0xD5
+    if val < 0 {
+        mask = 0x55
+        val = -val - 1
+    }
+    seg := searchSegment(val, &alawSegEnd)
+    if seg >= 8 {
+        return 0x7F ^ mask
+    }
+    aval := uint8(seg) << 4
+    if seg < 2 {
+        aval |= uint8(val>>1) & 0x0F
+    } else {
+        aval |= uint8(val>>uint(seg)) & 0x0F
+    }
+    return aval ^ mask
+}
+
+func ALawToLinear(a uint8) int16 {
+    return alawToLinearTable[a]
+}
+
+func LinearToMuLaw(pcm int16) uint8 {
+    val := int(pcm) >> 2
+    var mask uint8 = 0xFF
+    if val < 0 {
+        mask = 0x7F
+        val = -val
+    }
+    if val > G711_ULAW_CLIP {
+        val = G711_ULAW_CLIP
+    }
+    val += G711_ULAW_BIAS >> 2
+    seg := searchSegment(val, &ulawSegEnd)
+    if seg >= 8 {
+        return 0x7F ^ mask
+    }
+    uval := uint8(seg)<<4 | uint8(val>>uint(seg+1))&0x0F
+    return uval ^ mask
+}
+
+func MuLawToLinear(u uint8) int16 {
+    return ulawToLinearTable[u]
+}
+
+func ALawToMuLaw(a uint8) uint8 {
+    return alawToUlawTable[a]
+}
+
+func MuLawToALaw(u uint8) uint8 {
+    return ulawToAlawTable[u]
+}
+
+func DecodeG711A(data []byte) []int16 {
+    pcm := make([]int16, len(data))
+    for i, a := range data {
+        pcm[i] = alawToLinearTable[a]
+    }
+    return pcm
+}
+
+func EncodeG711A(pcm []int16) []byte {
+    data := make([]byte, len(pcm))
+    for i, v := range pcm {
+        data[i] = LinearToALaw(v)
+    }
+    return data
+}
+
+func DecodeG711U(data []byte) []int16 {
+    pcm := make([]int16, len(data))
+    for i, u := range data {
+        pcm[i] = ulawToLinearTable[u]
+    }
+    return pcm
+}
+
+func EncodeG711U(pcm []int16) []byte {
+    data := make([]byte, len(pcm))
+    for i, v := range pcm {
+        data[i] = LinearToMuLaw(v)
+    }
+    return data
+}
+
+func G711AToG711U(data []byte) []byte {
+    out := make([]byte, len(data))
+    for i, a := range data {
+        out[i] = alawToUlawTable[a]
+    }
+    return out
+}
+
+func G711UToG711A(data []byte) []byte {
+    out := make([]byte, len(data))
+    for i, u := range data {
+        out[i] = ulawToAlawTable[u]
+    }
+    return out
+}
+
+// DecodeG711 cid 为 CODECID_AUDIO_G711A 或者 CODECID_AUDIO_G711U
+func DecodeG711(cid CodecID, data []byte) ([]int16, error) {
+    switch cid {
+    case CODECID_AUDIO_G711A:
+        return DecodeG711A(data), nil
+    case CODECID_AUDIO_G711U:
+        return DecodeG711U(data), nil
+    default:
+        return nil, errors.New("unsupport g711 codec id " + CodecString(cid))
+    }
+}
+
+func EncodeG711(cid CodecID, pcm []int16) ([]byte, error) {
+    switch cid {
+    case CODECID_AUDIO_G711A:
+        return EncodeG711A(pcm), nil
+    case CODECID_AUDIO_G711U:
+        return EncodeG711U(pcm), nil
+    default:
+        return nil, errors.New("unsupport g711 codec id " + CodecString(cid))
+    }
+}
@@ -0,0 +1,84 @@
+package codec
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestG711Sample(t *testing.T) {
+    tests := []struct {
+        name    string
+        alaw    uint8
+        ulaw    uint8
+        alinear int16
+        ulinear int16
+    }{
+        {name: "positive zero", alaw: 0xD5, ulaw: 0xFF, alinear: 8, ulinear: 0},
+        {name: "negative zero", alaw: 0x55, ulaw: 0x7F, alinear: -8, ulinear: 0},
+        {name: "positive max", alaw: 0xAA, ulaw: 0x80, alinear: 32256, ulinear: 32124},
+        {name: "negative max", alaw: 0x2A, ulaw: 0x00, alinear: -32256, ulinear: -32124},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := ALawToLinear(tt.alaw); got != tt.alinear {
+                t.Errorf("ALawToLinear() = %d, want %d", got, tt.alinear)
+            }
+            if got := MuLawToLinear(tt.ulaw); got != tt.ulinear {
+                t.Errorf("MuLawToLinear() = %d, want %d", got, tt.ulinear)
+            }
+        })
+    }
+    if LinearToALaw(32767) != 0xAA || LinearToALaw(-32768) != 0x2A {
+        t.Errorf("LinearToALaw() clip = %#x %#x", LinearToALaw(32767), LinearToALaw(-32768))
+    }
+    if LinearToMuLaw(32767) != 0x80 || LinearToMuLaw(-32768) != 0x00 {
+        t.Errorf("LinearToMuLaw() clip = %#x %#x", LinearToMuLaw(32767), LinearToMuLaw(-32768))
+    }
+}
+
+func TestG711RoundTrip(t *testing.T) {
+    for i := 0; i < 256; i++ {
+        if got := LinearToALaw(ALawToLinear(uint8(i))); got != uint8(i) {
+            t.Fatalf("alaw %#x round trip = %#x", i, got)
+        }
+        //0x7F(-0)编码为0xFF(+0)
+        if got := LinearToMuLaw(MuLawToLinear(uint8(i))); got != uint8(i) && i != 0x7F {
+            t.Fatalf("ulaw %#x round trip = %#x", i, got)
+        }
+    }
+    //量化误差不超过所在段的步长
+    for v := -32768; v <= 32767; v += 7 {
+        pcm := int16(v)
+        if d := int(ALawToLinear(LinearToALaw(pcm))) - v; d > 1024 || d < -1024 {
+            t.Fatalf("alaw quantization error %d for %d", d, v)
+        }
+        if v > -32124 && v < 32124 {
+            if d := int(MuLawToLinear(LinearToMuLaw(pcm))) - v; d > 1024 || d < -1024 {
+                t.Fatalf("ulaw quantization error %d for %d", d, v)
+            }
+        }
+    }
+}
+
+func TestG711Transcode(t *testing.T) {
+    pcm := []int16{0, 100, -100, 1000, -1000, 8000, -8000, 30000, -30000}
+    alaw := EncodeG711A(pcm)
+    ulaw := EncodeG711U(pcm)
+    if !reflect.DeepEqual(DecodeG711A(G711UToG711A(ulaw)), DecodeG711A(EncodeG711A(DecodeG711U(ulaw)))) {
+        t.Errorf("G711UToG711A() mismatch")
+    }
+    if !reflect.DeepEqual(G711AToG711U(alaw), EncodeG711U(DecodeG711A(alaw))) {
+        t.Errorf("G711AToG711U() mismatch")
+    }
+    got, err := DecodeG711(CODECID_AUDIO_G711A, alaw)
+    if err != nil || !reflect.DeepEqual(got, DecodeG711A(alaw)) {
+        t.Errorf("DecodeG711() = %v, %v", got, err)
+    }
+    enc, err := EncodeG711(CODECID_AUDIO_G711U, pcm)
+    if err != nil || !reflect.DeepEqual(enc, ulaw) {
+        t.Errorf("EncodeG711() = %v, %v", enc, err)
+    }
+    if _, err := DecodeG711(CODECID_AUDIO_AAC, alaw); err == nil {
+        t.Errorf("expected error for aac")
+    }
+}
@@ -0,0 +1,377 @@
+package codec
+
+// ITU-T G.722 SB-ADPCM, 16000Hz 单声道, 64kbit/s
+// 参考 spandsp g722.c
+//
+// 每个字节对应两个采样(一个低频子带码字和一个高频子带码字)
+// +---+---+---+---+---+---+---+---+
+// | IH(2) |        IL(6)          |
+// +---+---+---+---+---+---+---+---+
+//
+// rfc3551 由于历史原因, G722的RTP时钟频率为8000, 但实际采样率为16000
+
+const (
+    G722_SAMPLE_RATE   = 16000
+    G722_RTP_CLOCKRATE = 8000
+)
+
+var g722QmfCoeffs = [12]int{3, -11, 12, 32, -210, 951, 3876, -805, 362, -156, 53, -11}
+
+var g722Wl = [8]int{-60, -30, 58, 172, 334, 538, 1198, 3042}
+var g722Rl42 = [16]int{0, 7, 6, 5, 4, 3, 2, 1, 7, 6, 5, 4, 3, 2, 1, 0}
+var g722Ilb = [32]int{
+    2048, 2093, 2139, 2186, 2233, 2282, 2332, 2383,
+    2435, 2489, 2543, 2599, 2656, 2714, 2774, 2834,
+    2896, 2960, 3025, 3091, 3158, 3228, 3298, 3371,
+    3444, 3520, 3597, 3676, 3756, 3838, 3922, 4008,
+}
+var g722Wh = [3]int{0, -214, 798}
+var g722Rh2 = [4]int{2, 1, 2, 1}
+var g722Qm2 = [4]int{-7408, -1616, 7408, 1616}
+var g722Qm4 = [16]int{
+    0, -20456, -12896, -8968, -6288, -4240, -2584, -1200,
+    20456, 12896, 8968, 6288, 4240, 2584, 1200, 0,
+}
+var g722Qm6 = [64]int{
+    -136, -136, -136, -136, -24808, -21904, -19008, -16704,
+    -14984, -13512, -12280, -11192, -10232, -9360, -8576, -7856,
+    -7192, -6576, -6000, -5456, -4944, -4464, -4008, -3576,
+    -3168, -2776, -2400, -2032, -1688, -1360, -1040, -728,
+    24808, 21904, 19008, 16704, 14984, 13512, 12280, 11192,
+    10232, 9360, 8576, 7856, 7192, 6576, 6000, 5456,
+    4944, 4464, 4008, 3576, 3168, 2776, 2400, 2032,
+    1688, 1360, 1040, 728, 432, 136, -432, -136,
+}
+
+// 编码器量化表
+var g722Q6 = [32]int{
+    0, 35, 72, 110, 150, 190, 233, 276,
+    323, 370, 422, 473, 530, 587, 650, 714,
+    786, 858, 940, 1023, 1121, 1219, 1339, 1458,
+    1612, 1765, 1980, 2195, 2557, 2919, 0, 0,
+}
+var g722Iln = [32]int{
+    0, 63, 62, 31, 30, 29, 28, 27, 26, 25, 24, 23, 22, 21, 20, 19,
+    18, 17, 16, 15, 14, 13, 12, 11, 10, 9, 8, 7, 6, 5, 4, 0,
+}
+var g722Ilp = [32]int{
+    0, 61, 60, 59, 58, 57, 56, 55, 54, 53, 52, 51, 50, 49, 48, 47,
+    46, 45, 44, 43, 42, 41, 40, 39, 38, 37, 36, 35, 34, 33, 32, 0,
+}
+var g722Ihn = [3]int{0, 1, 0}
+var g722Ihp = [3]int{0, 3, 2}
+
+func saturate16(v int) int {
+    if v > 32767 {
+        return 32767
+    } else if v < -32768 {
+        return -32768
+    }
+    return v
+}
+
+type g722Band struct {
+    s   int
+    sp  int
+    sz  int
+    r   [3]int
+    a   [3]int
+    ap  [3]int
+    p   [3]int
+    d   [7]int
+    b   [7]int
+    bp  [7]int
+    sg  [7]int
+    nb  int
+    det int
+}
+
+// block4 自适应预测器更新
+func (band *g722Band) block4(dx int) {
+    //RECONS
+    band.d[0] = dx
+    band.r[0] = saturate16(band.s + dx)
+    //PARREC
+    band.p[0] = saturate16(band.sz + dx)
+
+    //UPPOL2
+    for i := 0; i < 3; i++ {
+        band.sg[i] = band.p[i] >> 15
+    }
+    wd1 := saturate16(band.a[1] << 2)
+    wd2 := wd1
+    if band.sg[0] == band.sg[1] {
+        wd2 = -wd1
+    }
+    if wd2 > 32767 {
+        wd2 = 32767
+    }
+    wd3 := wd2 >> 7
+    if band.sg[0] == band.sg[2] {
+        wd3 += 128
+    } else {
+        wd3 -= 128
+    }
+    wd3 += (band.a[2] * 32512) >> 15
+    if wd3 > 12288 {
+        wd3 = 12288
+    } else if wd3 < -12288 {
+        wd3 = -12288
+    }
+    band.ap[2] = wd3
+
+    //UPPOL1
+    band.sg[0] = band.p[0] >> 15
+    band.sg[1] = band.p[1] >> 15
+    wd1 = -192
+    if band.sg[0] == band.sg[1] {
+        wd1 = 192
+    }
+    wd2 = (band.a[1] * 32640) >> 15
+    band.ap[1] = saturate16(wd1 + wd2)
+    wd3 = saturate16(15360 - band.ap[2])
+    if band.ap[1] > wd3 {
+        band.ap[1] = wd3
+    } else if band.ap[1] < -wd3 {
+        band.ap[1] = -wd3
+    }
+
+    //UPZERO
+    wd1 = 128
+    if dx == 0 {
+        wd1 = 0
+    }
+    band.sg[0] = dx >> 15
+    for i := 1; i < 7; i++ {
+        band.sg[i] = band.d[i] >> 15
+        wd2 = -wd1
+        if band.sg[i] == band.sg[0] {
+            wd2 = wd1
+        }
+        wd3 = (band.b[i] * 32640) >> 15
+        band.bp[i] = saturate16(wd2 + wd3)
+    }
+
+    //DELAYA
+    for i := 6; i > 0; i-- {
+        band.d[i] = band.d[i-1]
+        band.b[i] = band.bp[i]
+    }
+    for i := 2; i > 0; i-- {
+        band.r[i] = band.r[i-1]
+        band.p[i] = band.p[i-1]
+        band.a[i] = band.ap[i]
+    }
+
+    //FILTEP
+    wd1 = saturate16(band.r[1] + band.r[1])
+    wd1 = (band.a[1] * wd1) >> 15
+    wd2 = saturate16(band.r[2] + band.r[2])
+    wd2 = (band.a[2] * wd2) >> 15
+    band.sp = saturate16(wd1 + wd2)
+
+    //FILTEZ
+    band.sz = 0
+    for i := 6; i > 0; i-- {
+        wd1 = saturate16(band.d[i] + band.d[i])
+        band.sz += (band.b[i] * wd1) >> 15
+    }
+    band.sz = saturate16(band.sz)
+
+    //PREDIC
+    band.s = saturate16(band.sp + band.sz)
+}
+
+// 低频子带 LOGSCL + SCALEL
+func (band *g722Band) scaleLow(il4 int) {
+    wd := (band.nb*127)>>7 + g722Wl[il4]
+    if wd < 0 {
+        wd = 0
+    } else if wd > 18432 {
+        wd = 18432
+    }
+    band.nb = wd
+    band.det = g722Scale(band.nb, 8)
+}
+
+// 高频子带 LOGSCH + SCALEH
+func (band *g722Band) scaleHigh(ih2 int) {
+    wd := (band.nb*127)>>7 + g722Wh[ih2]
+    if wd < 0 {
+        wd = 0
+    } else if wd > 22528 {
+        wd = 22528
+    }
+    band.nb = wd
+    band.det = g722Scale(band.nb, 10)
+}
+
+func g722Scale(nb int, shift int) int {
+    wd1 := (nb >> 6) & 31
+    wd2 := shift - (nb >> 11)
+    wd3 := 0
+    if wd2 < 0 {
+        wd3 = g722Ilb[wd1] << uint(-wd2)
+    } else {
+        wd3 = g722Ilb[wd1] >> uint(wd2)
+    }
+    return wd3 << 2
+}
+
+type g722State struct {
+    band [2]g722Band
+    x    [24]int
+}
+
+func (s *g722State) init() {
+    *s = g722State{}
+    s.band[0].det = 32
+    s.band[1].det = 8
+}
+
+type G722Decoder struct {
+    state g722State
+}
+
+func NewG722Decoder() *G722Decoder {
+    decoder := &G722Decoder{}
+    decoder.state.init()
+    return decoder
+}
+
+// Decode 输入64kbit/s码流, 每个字节输出两个16000Hz的16bit线性PCM采样
+func (decoder *G722Decoder) Decode(data []byte) []int16 {
+    s := &decoder.state
+    pcm := make([]int16, 0, len(data)*2)
+    for _, code := range data {
+        il := int(code & 0x3F)
+        ih := int(code>>6) & 0x03
+
+        //低频子带 INVQBL + RECONS + LIMIT
+        wd2 := (s.band[0].det * g722Qm6[il]) >> 15
+        rlow := s.band[0].s + wd2
+        if rlow > 16383 {
+            rlow = 16383
+        } else if rlow < -16384 {
+            rlow = -16384
+        }
+        //INVQAL
+        il4 := il >> 2
+        dlow := (s.band[0].det * g722Qm4[il4]) >> 15
+        s.band[0].scaleLow(g722Rl42[il4])
+        s.band[0].block4(dlow)
+
+        //高频子带 INVQAH + RECONS + LIMIT
+        dhigh := (s.band[1].det * g722Qm2[ih]) >> 15
+        rhigh := dhigh + s.band[1].s
+        if rhigh > 16383 {
+            rhigh = 16383
+        } else if rhigh < -16384 {
+            rhigh = -16384
+        }
+        s.band[1].scaleHigh(g722Rh2[ih])
+        s.band[1].block4(dhigh)
+
+        //QMF合成
+        copy(s.x[:22], s.x[2:])
+        s.x[22] = rlow + rhigh
+        s.x[23] = rlow - rhigh
+        xout1, xout2 := 0, 0
+        for i := 0; i < 12; i++ {
+            xout2 += s.x[2*i] * g722QmfCoeffs[i]
+            xout1 += s.x[2*i+1] * g722QmfCoeffs[11-i]
+        }
+        pcm = append(pcm, int16(saturate16(xout1>>11)), int16(saturate16(xout2>>11)))
+    }
+    return pcm
+}
+
+func (decoder *G722Decoder) Reset() {
+    decoder.state.init()
+}
+
+type G722Encoder struct {
+    state g722State
+    odd   []int16
+}
+
+func NewG722Encoder() *G722Encoder {
+    encoder := &G722Encoder{}
+    encoder.state.init()
+    return encoder
+}
+
+// Encode 输入16000Hz的16bit线性PCM, 每两个采样输出一个字节, 奇数个采样时最后一个采样保留到下一次调用
+func (encoder *G722Encoder) Encode(pcm []int16) []byte {
+    s := &encoder.state
+    if len(encoder.odd) > 0 {
+        pcm = append(encoder.odd, pcm...)
+        encoder.odd = nil
+    }
+    out := make([]byte, 0, len(pcm)/2)
+    for j := 0; j+1 < len(pcm); j += 2 {
+        //QMF分析
+        copy(s.x[:22], s.x[2:])
+        s.x[22] = int(pcm[j])
+        s.x[23] = int(pcm[j+1])
+        sumodd, sumeven := 0, 0
+        for i := 0; i < 12; i++ {
+            sumodd += s.x[2*i] * g722QmfCoeffs[i]
+            sumeven += s.x[2*i+1] * g722QmfCoeffs[11-i]
+        }
+        xlow := (sumeven + sumodd) >> 14
+        xhigh := (sumeven - sumodd) >> 14
+
+        //低频子带 SUBTRA + QUANTL
+        el := saturate16(xlow - s.band[0].s)
+        wd := el
+        if el < 0 {
+            wd = -(el + 1)
+        }
+        i := 1
+        for ; i < 30; i++ {
+            if wd < (g722Q6[i]*s.band[0].det)>>12 {
+                break
+            }
+        }
+        ilow := g722Ilp[i]
+        if el < 0 {
+            ilow = g722Iln[i]
+        }
+        //INVQAL
+        ril := ilow >> 2
+        dlow := (s.band[0].det * g722Qm4[ril]) >> 15
+        s.band[0].scaleLow(g722Rl42[ril])
+        s.band[0].block4(dlow)
+
+        //高频子带 SUBTRA + QUANTH
+        eh := saturate16(xhigh - s.band[1].s)
+        wd = eh
+        if eh < 0 {
+            wd = -(eh + 1)
+        }
+        mih := 1
+        if wd >= (564*s.band[1].det)>>12 {
+            mih = 2
+        }
+        ihigh := g722Ihp[mih]
+        if eh < 0 {
+            ihigh = g722Ihn[mih]
+        }
+        //INVQAH
+        dhigh := (s.band[1].det * g722Qm2[ihigh]) >> 15
+        s.band[1].scaleHigh(g722Rh2[ihigh])
+        s.band[1].block4(dhigh)
+
+        out = append(out, uint8(ihigh<<6|ilow))
+    }
+    if len(pcm)%2 == 1 {
+        encoder.odd = []int16{pcm[len(pcm)-1]}
+    }
+    return out
+}
+
+func (encoder *G722Encoder) Reset() {
+    encoder.state.init()
+    encoder.odd = nil
+}
@@ -0,0 +1,51 @@
+package codec
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestG722(t *testing.T) {
+    tests := []struct {
+        name   string
+        freq   float64
+        minSNR float64
+    }{
+        {name: "low band", freq: 1000, minSNR: 40},
+        {name: "high band", freq: 6000, minSNR: 22},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            pcm := makeSine(G722_SAMPLE_RATE, tt.freq, 8000, G722_SAMPLE_RATE)
+            enc := NewG722Encoder()
+            var data []byte
+            //奇数个采样的分片
+            for i := 0; i < len(pcm); i += 161 {
+                end := i + 161
+                if end > len(pcm) {
+                    end = len(pcm)
+                }
+                data = append(data, enc.Encode(pcm[i:end])...)
+            }
+            if len(data) != len(pcm)/2 {
+                t.Fatalf("encoded %d bytes", len(data))
+            }
+            out := NewG722Decoder().Decode(data)
+            if len(out) != len(pcm) {
+                t.Fatalf("decoded %d samples", len(out))
+            }
+            //QMF分析+合成的延迟为22个采样
+            if snr := pcmSNR(pcm, out, 1000, 22); snr < tt.minSNR {
+                t.Errorf("snr = %.2f", snr)
+            }
+        })
+    }
+
+    dec := NewG722Decoder()
+    whole := dec.Decode([]byte{0x12, 0xFE, 0x7A, 0x85})
+    dec.Reset()
+    split := append(dec.Decode([]byte{0x12, 0xFE}), dec.Decode([]byte{0x7A, 0x85})...)
+    if !reflect.DeepEqual(whole, split) {
+        t.Errorf("whole %v split %v", whole, split)
+    }
+}
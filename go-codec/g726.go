@@ -0,0 +1,517 @@
+package codec
+
+import "errors"
+
+// ITU-T G.726 ADPCM, 16/24/32/40 kbit/s, 8000Hz 单声道
+// 参考 Sun Microsystems g72x.c 和 spandsp g726.c
+//
+// 码字打包方式
+// RFC3551 "G726-xx": 第一个码字位于第一个字节的低位
+// AAL2 "AAL2-G726-xx"(I.366.2): 第一个码字位于第一个字节的高位, 很多摄像头使用这种方式
+
+type G726_PACKING int
+
+const (
+    G726_PACKING_RFC3551 G726_PACKING = iota
+    G726_PACKING_AAL2
+)
+
+type g726Table struct {
+    bits    int
+    states  int
+    qtab    []int
+    dqlntab []int
+    witab   []int
+    fitab   []int
+}
+
+var g726_16 = g726Table{
+    bits:    2,
+    states:  4,
+    qtab:    []int{261},
+    dqlntab: []int{116, 365, 365, 116},
+    witab:   []int{-704, 14048, 14048, -704},
+    fitab:   []int{0x000, 0xE00, 0xE00, 0x000},
+}
+
+var g726_24 = g726Table{
+    bits:    3,
+    states:  7,
+    qtab:    []int{8, 218, 331},
+    dqlntab: []int{-2048, 135, 273, 373, 373, 273, 135, -2048},
+    witab:   []int{-128, 960, 4384, 18624, 18624, 4384, 960, -128},
+    fitab:   []int{0x000, 0x200, 0x400, 0xE00, 0xE00, 0x400, 0x200, 0x000},
+}
+
+var g726_32 = g726Table{
+    bits:    4,
+    states:  15,
+    qtab:    []int{-124, 80, 178, 246, 300, 349, 400},
+    dqlntab: []int{-2048, 4, 135, 213, 273, 323, 373, 425, 425, 373, 323, 273, 213, 135, 4, -2048},
+    witab:   []int{-384, 576, 1312, 2048, 3584, 6336, 11360, 35904, 35904, 11360, 6336, 3584, 2048, 1312, 576, -384},
+    fitab:   []int{0x000, 0x000, 0x000, 0x200, 0x200, 0x200, 0x600, 0xE00, 0xE00, 0x600, 0x200, 0x200, 0x200, 0x000, 0x000, 0x000},
+}
+
+var g726_40 = g726Table{
+    bits:    5,
+    states:  31,
+    qtab:    []int{-122, -16, 68, 139, 198, 250, 298, 339, 378, 413, 445, 475, 502, 528, 553},
+    dqlntab: []int{-2048, -66, 28, 104, 169, 224, 274, 318, 358, 395, 429, 459, 488, 514, 539, 566, 566, 539, 514, 488, 459, 429, 395, 358, 318, 274, 224, 169, 104, 28, -66, -2048},
+    witab:   []int{448, 448, 768, 1248, 1280, 1312, 1856, 3200, 4512, 5728, 7008, 8960, 11456, 14080, 16928, 22272, 22272, 16928, 14080, 11456, 8960, 7008, 5728, 4512, 3200, 1856, 1312, 1280, 1248, 768, 448, 448},
+    fitab:   []int{0x000, 0x000, 0x000, 0x000, 0x000, 0x200, 0x200, 0x200, 0x200, 0x200, 0x400, 0x600, 0x800, 0xA00, 0xC00, 0xC00, 0xC00, 0xC00, 0xA00, 0x800, 0x600, 0x400, 0x200, 0x200, 0x200, 0x200, 0x200, 0x000, 0x000, 0x000, 0x000, 0x000},
+}
+
+func g726TableByBitRate(bitRate int) (*g726Table, error) {
+    switch bitRate {
+    case 16000:
+        return &g726_16, nil
+    case 24000:
+        return &g726_24, nil
+    case 32000:
+        return &g726_32, nil
+    case 40000:
+        return &g726_40, nil
+    default:
+        return nil, errors.New("unsupport g726 bitrate")
+    }
+}
+
+// G726BitsPerSample 16000->2 24000->3 32000->4 40000->5, 不支持的码率返回0
+func G726BitsPerSample(bitRate int) int {
+    table, err := g726TableByBitRate(bitRate)
+    if err != nil {
+        return 0
+    }
+    return table.bits
+}
+
+var g726Power2 = [15]int{1, 2, 4, 8, 0x10, 0x20, 0x40, 0x80, 0x100, 0x200, 0x400, 0x800, 0x1000, 0x2000, 0x4000}
+
+type g726State struct {
+    yl  int
+    yu  int
+    dms int
+    dml int
+    ap  int
+    a   [2]int
+    b   [6]int
+    pk  [2]int
+    dq  [6]int
+    sr  [2]int
+    td  int
+}
+
+func (s *g726State) init() {
+    *s = g726State{yl: 34816, yu: 544}
+    for i := range s.dq {
+        s.dq[i] = 32
+    }
+    s.sr[0], s.sr[1] = 32, 32
+}
+
+func g726Quan(val int, table []int) int {
+    i := 0
+    for ; i < len(table); i++ {
+        if val < table[i] {
+            break
+        }
+    }
+    return i
+}
+
+func g726Fmult(an int, srn int) int {
+    anmag := an
+    if an <= 0 {
+        anmag = (-an) & 0x1FFF
+    }
+    anexp := g726Quan(anmag, g726Power2[:]) - 6
+    anmant := 32
+    if anmag != 0 {
+        if anexp >= 0 {
+            anmant = anmag >> uint(anexp)
+        } else {
+            anmant = anmag << uint(-anexp)
+        }
+    }
+    wanexp := anexp + ((srn >> 6) & 0x0F) - 13
+    wanmant := (anmant*(srn&0x3F) + 0x30) >> 4
+    retval := 0
+    if wanexp >= 0 {
+        retval = (wanmant << uint(wanexp)) & 0x7FFF
+    } else {
+        retval = wanmant >> uint(-wanexp)
+    }
+    if (an ^ srn) < 0 {
+        return -retval
+    }
+    return retval
+}
+
+func (s *g726State) predictorZero() int {
+    sezi := 0
+    for i := 0; i < 6; i++ {
+        sezi += g726Fmult(s.b[i]>>2, s.dq[i])
+    }
+    return sezi
+}
+
+func (s *g726State) predictorPole() int {
+    return g726Fmult(s.a[1]>>2, s.sr[1]) + g726Fmult(s.a[0]>>2, s.sr[0])
+}
+
+func (s *g726State) stepSize() int {
+    if s.ap >= 256 {
+        return s.yu
+    }
+    y := s.yl >> 6
+    dif := s.yu - y
+    al := s.ap >> 2
+    if dif > 0 {
+        y += (dif * al) >> 6
+    } else if dif < 0 {
+        y += (dif*al + 0x3F) >> 6
+    }
+    return y
+}
+
+func g726Quantize(d int, y int, table *g726Table) int {
+    dqm := d
+    if dqm < 0 {
+        dqm = -dqm
+    }
+    exp := g726Quan(dqm>>1, g726Power2[:])
+    mant := ((dqm << 7) >> uint(exp)) & 0x7F
+    dl := (exp << 7) + mant
+    dln := dl - (y >> 2)
+    size := (table.states - 1) >> 1
+    i := g726Quan(dln, table.qtab[:size])
+    if d < 0 {
+        return (size << 1) + 1 - i
+    }
+    //码字0只在状态数为偶数时有效
+    if i == 0 && table.states&1 == 1 {
+        return table.states
+    }
+    return i
+}
+
+func g726Reconstruct(sign bool, dqln int, y int) int {
+    dql := dqln + (y >> 2)
+    if dql < 0 {
+        if sign {
+            return -0x8000
+        }
+        return 0
+    }
+    dex := (dql >> 7) & 15
+    dqt := 128 + (dql & 127)
+    dq := (dqt << 7) >> uint(14-dex)
+    if sign {
+        return dq - 0x8000
+    }
+    return dq
+}
+
+func g726Float(mag int) int {
+    exp := g726Quan(mag, g726Power2[:])
+    return (exp << 6) + ((mag << 6) >> uint(exp))
+}
+
+func (s *g726State) update(bits int, y int, wi int, fi int, dq int, sr int, dqsez int) {
+    pk0 := 0
+    if dqsez < 0 {
+        pk0 = 1
+    }
+    mag := dq & 0x7FFF
+
+    //TRANS
+    ylint := s.yl >> 15
+    ylfrac := (s.yl >> 10) & 0x1F
+    thr1 := (32 + ylfrac) << uint(ylint)
+    thr2 := thr1
+    if ylint > 9 {
+        thr2 = 31 << 10
+    }
+    dqthr := (thr2 + (thr2 >> 1)) >> 1
+    tr := 0
+    if s.td != 0 && mag > dqthr {
+        tr = 1
+    }
+
+    //量化器步长自适应
+    s.yu = y + ((wi - y) >> 5)
+    if s.yu < 544 {
+        s.yu = 544
+    } else if s.yu > 5120 {
+        s.yu = 5120
+    }
+    s.yl += s.yu + ((-s.yl) >> 6)
+
+    //自适应预测系数
+    a2p := 0
+    if tr == 1 {
+        s.a = [2]int{}
+        s.b = [6]int{}
+    } else {
+        pks1 := pk0 ^ s.pk[0]
+        a2p = s.a[1] - (s.a[1] >> 7)
+        if dqsez != 0 {
+            fa1 := -s.a[0]
+            if pks1 != 0 {
+                fa1 = s.a[0]
+            }
+            if fa1 < -8191 {
+                a2p -= 0x100
+            } else if fa1 > 8191 {
+                a2p += 0xFF
+            } else {
+                a2p += fa1 >> 5
+            }
+            if pk0^s.pk[1] != 0 {
+                if a2p <= -12160 {
+                    a2p = -12288
+                } else if a2p >= 12416 {
+                    a2p = 12288
+                } else {
+                    a2p -= 0x80
+                }
+            } else if a2p <= -12416 {
+                a2p = -12288
+            } else if a2p >= 12160 {
+                a2p = 12288
+            } else {
+                a2p += 0x80
+            }
+        }
+        s.a[1] = a2p
+
+        s.a[0] -= s.a[0] >> 8
+        if dqsez != 0 {
+            if pks1 == 0 {
+                s.a[0] += 192
+            } else {
+                s.a[0] -= 192
+            }
+        }
+        a1ul := 15360 - a2p
+        if s.a[0] < -a1ul {
+            s.a[0] = -a1ul
+        } else if s.a[0] > a1ul {
+            s.a[0] = a1ul
+        }
+
+        for i := 0; i < 6; i++ {
+            if bits == 5 {
+                s.b[i] -= s.b[i] >> 9
+            } else {
+                s.b[i] -= s.b[i] >> 8
+            }
+            if dq&0x7FFF != 0 {
+                if (dq ^ s.dq[i]) >= 0 {
+                    s.b[i] += 128
+                } else {
+                    s.b[i] -= 128
+                }
+            }
+        }
+    }
+
+    for i := 5; i > 0; i-- {
+        s.dq[i] = s.dq[i-1]
+    }
+    if mag == 0 {
+        if dq >= 0 {
+            s.dq[0] = 0x20
+        } else {
+            s.dq[0] = 0x20 - 0x400
+        }
+    } else if dq >= 0 {
+        s.dq[0] = g726Float(mag)
+    } else {
+        s.dq[0] = g726Float(mag) - 0x400
+    }
+
+    s.sr[1] = s.sr[0]
+    if sr == 0 {
+        s.sr[0] = 0x20
+    } else if sr > 0 {
+        s.sr[0] = g726Float(sr)
+    } else if sr > -32768 {
+        s.sr[0] = g726Float(-sr) - 0x400
+    } else {
+        s.sr[0] = 0x20 - 0x400
+    }
+
+    s.pk[1] = s.pk[0]
+    s.pk[0] = pk0
+
+    //TONE
+    if tr == 1 {
+        s.td = 0
+    } else if a2p < -11776 {
+        s.td = 1
+    } else {
+        s.td = 0
+    }
+
+    //自适应速度控制
+    s.dms += (fi - s.dms) >> 5
+    s.dml += ((fi << 2) - s.dml) >> 7
+    if tr == 1 {
+        s.ap = 256
+    } else if y < 1536 {
+        s.ap += (0x200 - s.ap) >> 4
+    } else if s.td == 1 {
+        s.ap += (0x200 - s.ap) >> 4
+    } else if absInt((s.dms<<2)-s.dml) >= (s.dml >> 3) {
+        s.ap += (0x200 - s.ap) >> 4
+    } else {
+        s.ap += (-s.ap) >> 4
+    }
+}
+
+func absInt(v int) int {
+    if v < 0 {
+        return -v
+    }
+    return v
+}
+
+// decode 输入一个码字, 输出14bit线性PCM
+func (s *g726State) decode(code int, table *g726Table) int {
+    code &= (1 << uint(table.bits)) - 1
+    sezi := s.predictorZero()
+    sez := sezi >> 1
+    se := (sezi + s.predictorPole()) >> 1
+    y := s.stepSize()
+    dq := g726Reconstruct(code&(1<<uint(table.bits-1)) != 0, table.dqlntab[code], y)
+    sr := se + dq
+    if dq < 0 {
+        sr = se - (dq & 0x3FFF)
+    }
+    dqsez := sr - se + sez
+    s.update(table.bits, y, table.witab[code], table.fitab[code], dq, sr, dqsez)
+    return sr
+}
+
+// encode 输入14bit线性PCM, 输出一个码字
+func (s *g726State) encode(sl int, table *g726Table) int {
+    sezi := s.predictorZero()
+    sez := sezi >> 1
+    se := (sezi + s.predictorPole()) >> 1
+    d := sl - se
+    y := s.stepSize()
+    code := g726Quantize(d, y, table)
+    dq := g726Reconstruct(code&(1<<uint(table.bits-1)) != 0, table.dqlntab[code], y)
+    sr := se + dq
+    if dq < 0 {
+        sr = se - (dq & 0x3FFF)
+    }
+    dqsez := sr + sez - se
+    s.update(table.bits, y, table.witab[code], table.fitab[code], dq, sr, dqsez)
+    return code
+}
+
+type G726Decoder struct {
+    table   *g726Table
+    packing G726_PACKING
+    state   g726State
+}
+
+// NewG726Decoder bitRate 16000/24000/32000/40000
+func NewG726Decoder(bitRate int, packing G726_PACKING) (*G726Decoder, error) {
+    table, err := g726TableByBitRate(bitRate)
+    if err != nil {
+        return nil, err
+    }
+    decoder := &G726Decoder{table: table, packing: packing}
+    decoder.state.init()
+    return decoder, nil
+}
+
+// Decode 解码若干完整的码字, 输出16bit线性PCM, 字节末尾不足一个码字的bit被丢弃
+func (decoder *G726Decoder) Decode(data []byte) []int16 {
+    bits := uint(decoder.table.bits)
+    mask := uint32(1)<<bits - 1
+    pcm := make([]int16, 0, len(data)*8/int(bits))
+    var acc uint32
+    var nbits uint
+    for _, b := range data {
+        if decoder.packing == G726_PACKING_RFC3551 {
+            acc |= uint32(b) << nbits
+        } else {
+            acc = acc<<8 | uint32(b)
+        }
+        nbits += 8
+        for nbits >= bits {
+            var code uint32
+            if decoder.packing == G726_PACKING_RFC3551 {
+                code = acc & mask
+                acc >>= bits
+            } else {
+                code = (acc >> (nbits - bits)) & mask
+            }
+            nbits -= bits
+            pcm = append(pcm, clipInt16(decoder.state.decode(int(code), decoder.table)<<2))
+        }
+        if decoder.packing == G726_PACKING_AAL2 {
+            acc &= uint32(1)<<nbits - 1
+        }
+    }
+    return pcm
+}
+
+func (decoder *G726Decoder) Reset() {
+    decoder.state.init()
+}
+
+type G726Encoder struct {
+    table   *g726Table
+    packing G726_PACKING
+    state   g726State
+    acc     uint32
+    nbits   uint
+}
+
+func NewG726Encoder(bitRate int, packing G726_PACKING) (*G726Encoder, error) {
+    table, err := g726TableByBitRate(bitRate)
+    if err != nil {
+        return nil, err
+    }
+    encoder := &G726Encoder{table: table, packing: packing}
+    encoder.state.init()
+    return encoder, nil
+}
+
+// Encode 输入16bit线性PCM, 只输出完整的字节, 剩余的bit保留到下一次调用
+// 24k/40k 每8个采样对应整数个字节
+func (encoder *G726Encoder) Encode(pcm []int16) []byte {
+    bits := uint(encoder.table.bits)
+    out := make([]byte, 0, (len(pcm)*int(bits)+int(encoder.nbits))/8)
+    for _, v := range pcm {
+        code := uint32(encoder.state.encode(int(v)>>2, encoder.table))
+        if encoder.packing == G726_PACKING_RFC3551 {
+            encoder.acc |= code << encoder.nbits
+        } else {
+            encoder.acc = encoder.acc<<bits | code
+        }
+        encoder.nbits += bits
+        for encoder.nbits >= 8 {
+            if encoder.packing == G726_PACKING_RFC3551 {
+                out = append(out, uint8(encoder.acc))
+                encoder.acc >>= 8
+            } else {
+                out = append(out, uint8(encoder.acc>>(encoder.nbits-8)))
+                encoder.acc &= uint32(1)<<(encoder.nbits-8) - 1
+            }
+            encoder.nbits -= 8
+        }
+    }
+    return out
+}
+
+func (encoder *G726Encoder) Reset() {
+    encoder.state.init()
+    encoder.acc = 0
+    encoder.nbits = 0
+}
@@ -0,0 +1,113 @@
+package codec
+
+import (
+    "math"
+    "reflect"
+    "strconv"
+    "testing"
+)
+
+func makeSine(rate int, freq float64, amp float64, n int) []int16 {
+    pcm := make([]int16, n)
+    for i := range pcm {
+        pcm[i] = int16(amp * math.Sin(2*math.Pi*freq*float64(i)/float64(rate)))
+    }
+    return pcm
+}
+
+// pcmSNR 跳过前skip个采样(自适应收敛), out相对ref延迟delay个采样
+func pcmSNR(ref []int16, out []int16, skip int, delay int) float64 {
+    var sig, noise float64
+    for i := skip; i+delay < len(out) && i < len(ref); i++ {
+        e := float64(out[i+delay]) - float64(ref[i])
+        sig += float64(ref[i]) * float64(ref[i])
+        noise += e * e
+    }
+    return 10 * math.Log10(sig/noise)
+}
+
+func unpackCodes(data []byte, bits uint, packing G726_PACKING) []uint32 {
+    var codes []uint32
+    for i := 0; i+int(bits) <= len(data)*8; i += int(bits) {
+        var code uint32
+        for j := 0; j < int(bits); j++ {
+            pos := i + j
+            if packing == G726_PACKING_RFC3551 {
+                code |= uint32(data[pos/8]>>(pos%8)&1) << j
+            } else {
+                code = code<<1 | uint32(data[pos/8]>>(7-pos%8)&1)
+            }
+        }
+        codes = append(codes, code)
+    }
+    return codes
+}
+
+func TestG726(t *testing.T) {
+    tests := []struct {
+        bitRate int
+        bits    int
+        minSNR  float64
+    }{
+        {bitRate: 16000, bits: 2, minSNR: 20},
+        {bitRate: 24000, bits: 3, minSNR: 32},
+        {bitRate: 32000, bits: 4, minSNR: 42},
+        {bitRate: 40000, bits: 5, minSNR: 48},
+    }
+    pcm := makeSine(8000, 440, 8000, 8000)
+    for _, tt := range tests {
+        t.Run("G726-"+strconv.Itoa(tt.bitRate/1000), func(t *testing.T) {
+            if G726BitsPerSample(tt.bitRate) != tt.bits {
+                t.Fatalf("G726BitsPerSample() = %d", G726BitsPerSample(tt.bitRate))
+            }
+            var codes [][]uint32
+            for _, packing := range []G726_PACKING{G726_PACKING_RFC3551, G726_PACKING_AAL2} {
+                enc, err := NewG726Encoder(tt.bitRate, packing)
+                if err != nil {
+                    t.Fatal(err)
+                }
+                dec, _ := NewG726Decoder(tt.bitRate, packing)
+                //分片编码, 每次的采样数不是8的整数倍
+                var data []byte
+                for i := 0; i < len(pcm); i += 100 {
+                    data = append(data, enc.Encode(pcm[i:i+100])...)
+                }
+                if len(data) != len(pcm)*tt.bits/8 {
+                    t.Fatalf("encoded %d bytes", len(data))
+                }
+                out := dec.Decode(data)
+                if len(out) != len(pcm) {
+                    t.Fatalf("decoded %d samples", len(out))
+                }
+                if snr := pcmSNR(pcm, out, 800, 0); snr < tt.minSNR {
+                    t.Errorf("packing %d snr = %.2f", packing, snr)
+                }
+                codes = append(codes, unpackCodes(data, uint(tt.bits), packing))
+            }
+            //两种打包方式只是码字的bit顺序不同
+            if !reflect.DeepEqual(codes[0], codes[1]) {
+                t.Errorf("rfc3551 and aal2 codes mismatch")
+            }
+        })
+    }
+    if _, err := NewG726Decoder(64000, G726_PACKING_RFC3551); err == nil {
+        t.Errorf("expected error for 64000")
+    }
+}
+
+func TestG726Decoder_Packing(t *testing.T) {
+    //32k: 码字1,2
+    rfc, _ := NewG726Decoder(32000, G726_PACKING_RFC3551)
+    aal2, _ := NewG726Decoder(32000, G726_PACKING_AAL2)
+    if a, b := rfc.Decode([]byte{0x21, 0x43}), aal2.Decode([]byte{0x12, 0x34}); !reflect.DeepEqual(a, b) {
+        t.Errorf("rfc3551 %v aal2 %v", a, b)
+    }
+    //解码器状态在多次调用之间保持
+    rfc.Reset()
+    whole := rfc.Decode([]byte{0x21, 0x43, 0x65, 0x87})
+    rfc.Reset()
+    split := append(rfc.Decode([]byte{0x21, 0x43}), rfc.Decode([]byte{0x65, 0x87})...)
+    if !reflect.DeepEqual(whole, split) {
+        t.Errorf("whole %v split %v", whole, split)
+    }
+}
@@ -3,6 +3,8 @@ package codec
 import (
 	"encoding/binary"
 	"errors"
+	"fmt"
+	mathbits "math/bits"
 )
 
 // nal_unit( NumBytesInNALunit ) {
@@ -23,11 +25,85 @@ func (hdr *H264NaluHdr) Decode(bs *BitStream) {
 	hdr.Nal_unit_type = bs.Uint8(5)
 }
 
+type H264_SLICE_TYPE int
+
+const (
+	H264_SLICE_P H264_SLICE_TYPE = iota
+	H264_SLICE_B
+	H264_SLICE_I
+	H264_SLICE_SP
+	H264_SLICE_SI
+)
+
+type H264RefPicListModification struct {
+	Modification_of_pic_nums_idc uint64
+	Abs_diff_pic_num_minus1      uint64
+	Long_term_pic_num            uint64
+	Abs_diff_view_idx_minus1     uint64
+}
+
+type H264PredWeight struct {
+	Luma_weight_flag   uint8
+	Luma_weight        int64
+	Luma_offset        int64
+	Chroma_weight_flag uint8
+	Chroma_weight      [2]int64
+	Chroma_offset      [2]int64
+}
+
+type H264PredWeightTable struct {
+	Luma_log2_weight_denom   uint64
+	Chroma_log2_weight_denom uint64
+	L0                       []H264PredWeight
+	L1                       []H264PredWeight
+}
+
+type H264MemoryManagementControl struct {
+	Memory_management_control_operation uint64
+	Difference_of_pic_nums_minus1       uint64
+	Long_term_pic_num                   uint64
+	Long_term_frame_idx                 uint64
+	Max_long_term_frame_idx_plus1       uint64
+}
+
+type H264DecRefPicMarking struct {
+	No_output_of_prior_pics_flag       uint8
+	Long_term_reference_flag           uint8
+	Adaptive_ref_pic_marking_mode_flag uint8
+	MMCO                               []H264MemoryManagementControl
+}
+
 type SliceHeader struct {
-	First_mb_in_slice    uint64
-	Slice_type           uint64
-	Pic_parameter_set_id uint64
-	Frame_num            uint64
+	First_mb_in_slice                uint64
+	Slice_type                       uint64
+	Pic_parameter_set_id             uint64
+	Frame_num                        uint64
+	Nal_ref_idc                      uint8
+	Nal_unit_type                    uint8
+	Colour_plane_id                  uint8
+	Field_pic_flag                   uint8
+	Bottom_field_flag                uint8
+	Idr_pic_id                       uint64
+	Pic_order_cnt_lsb                uint64
+	Delta_pic_order_cnt_bottom       int64
+	Delta_pic_order_cnt              [2]int64
+	Redundant_pic_cnt                uint64
+	Direct_spatial_mv_pred_flag      uint8
+	Num_ref_idx_active_override_flag uint8
+	Num_ref_idx_l0_active_minus1     uint64
+	Num_ref_idx_l1_active_minus1     uint64
+	Ref_pic_list_modification_flag   [2]uint8
+	RefPicListModification           [2][]H264RefPicListModification
+	PredWeightTable                  H264PredWeightTable
+	DecRefPicMarking                 H264DecRefPicMarking
+	Cabac_init_idc                   uint64
+	Slice_qp_delta                   int64
+	Sp_for_switch_flag               uint8
+	Slice_qs_delta                   int64
+	Disable_deblocking_filter_idc    uint64
+	Slice_alpha_c0_offset_div2       int64
+	Slice_beta_offset_div2           int64
+	Slice_group_change_cycle         uint64
 }
 
 // 调用方根据sps中的log2_max_frame_num_minus4的值来解析Frame_num
@@ -37,44 +113,256 @@ func (sh *SliceHeader) Decode(bs *BitStream) {
 	sh.Pic_parameter_set_id = bs.ReadUE()
 }
 
+func (sh *SliceHeader) SliceType() H264_SLICE_TYPE {
+	return H264_SLICE_TYPE(sh.Slice_type % 5)
+}
+
+func (sh *SliceHeader) IdrPicFlag() bool {
+	return sh.Nal_unit_type == uint8(H264_NAL_I_SLICE)
+}
+
+// 7.3.3 Slice header syntax
+// bs从first_mb_in_slice开始(不包含nalu header), pps为Pic_parameter_set_id对应的pps, sps为pps引用的sps
+func (sh *SliceHeader) DecodeWithParameterSet(bs *BitStream, hdr H264NaluHdr, sps *SPS, pps *PPS) {
+	sh.Nal_ref_idc = hdr.Nal_ref_idc
+	sh.Nal_unit_type = hdr.Nal_unit_type
+	sh.Decode(bs)
+	if sps.Separate_colour_plane_flag == 1 {
+		sh.Colour_plane_id = bs.Uint8(2)
+	}
+	sh.Frame_num = bs.GetBits(int(sps.Log2_max_frame_num_minus4 + 4))
+	if sps.Frame_mbs_only_flag == 0 {
+		sh.Field_pic_flag = bs.GetBit()
+		if sh.Field_pic_flag == 1 {
+			sh.Bottom_field_flag = bs.GetBit()
+		}
+	}
+	if sh.IdrPicFlag() {
+		sh.Idr_pic_id = bs.ReadUE()
+	}
+	if sps.Pic_order_cnt_type == 0 {
+		sh.Pic_order_cnt_lsb = bs.GetBits(int(sps.Log2_max_pic_order_cnt_lsb_minus4 + 4))
+		if pps.Bottom_field_pic_order_in_frame_present_flag == 1 && sh.Field_pic_flag == 0 {
+			sh.Delta_pic_order_cnt_bottom = bs.ReadSE()
+		}
+	}
+	if sps.Pic_order_cnt_type == 1 && sps.Delta_pic_order_always_zero_flag == 0 {
+		sh.Delta_pic_order_cnt[0] = bs.ReadSE()
+		if pps.Bottom_field_pic_order_in_frame_present_flag == 1 && sh.Field_pic_flag == 0 {
+			sh.Delta_pic_order_cnt[1] = bs.ReadSE()
+		}
+	}
+	if pps.Redundant_pic_cnt_present_flag == 1 {
+		sh.Redundant_pic_cnt = bs.ReadUE()
+	}
+	sliceType := sh.SliceType()
+	if sliceType == H264_SLICE_B {
+		sh.Direct_spatial_mv_pred_flag = bs.GetBit()
+	}
+	sh.Num_ref_idx_l0_active_minus1 = pps.Num_ref_idx_l0_default_active_minus1
+	sh.Num_ref_idx_l1_active_minus1 = pps.Num_ref_idx_l1_default_active_minus1
+	if sliceType == H264_SLICE_P || sliceType == H264_SLICE_SP || sliceType == H264_SLICE_B {
+		sh.Num_ref_idx_active_override_flag = bs.GetBit()
+		if sh.Num_ref_idx_active_override_flag == 1 {
+			sh.Num_ref_idx_l0_active_minus1 = bs.ReadUE()
+			if sliceType == H264_SLICE_B {
+				sh.Num_ref_idx_l1_active_minus1 = bs.ReadUE()
+			}
+		}
+	}
+	if sh.Num_ref_idx_l0_active_minus1 > 31 || sh.Num_ref_idx_l1_active_minus1 > 31 {
+		bs.fail(fmt.Errorf("%w: num_ref_idx_active_minus1 %d/%d", ErrInvalidData, sh.Num_ref_idx_l0_active_minus1, sh.Num_ref_idx_l1_active_minus1))
+		return
+	}
+	// ref_pic_list_modification() / ref_pic_list_mvc_modification()
+	for list := 0; list < 2; list++ {
+		if list == 0 && (sliceType == H264_SLICE_I || sliceType == H264_SLICE_SI) {
+			continue
+		}
+		if list == 1 && sliceType != H264_SLICE_B {
+			continue
+		}
+		sh.Ref_pic_list_modification_flag[list] = bs.GetBit()
+		if sh.Ref_pic_list_modification_flag[list] == 0 {
+			continue
+		}
+		for {
+			var mod H264RefPicListModification
+			mod.Modification_of_pic_nums_idc = bs.ReadUE()
+			switch mod.Modification_of_pic_nums_idc {
+			case 0, 1:
+				mod.Abs_diff_pic_num_minus1 = bs.ReadUE()
+			case 2:
+				mod.Long_term_pic_num = bs.ReadUE()
+			case 4, 5:
+				mod.Abs_diff_view_idx_minus1 = bs.ReadUE()
+			}
+			sh.RefPicListModification[list] = append(sh.RefPicListModification[list], mod)
+			if mod.Modification_of_pic_nums_idc == 3 || bs.Err() != nil {
+				break
+			}
+		}
+	}
+	if (pps.Weighted_pred_flag == 1 && (sliceType == H264_SLICE_P || sliceType == H264_SLICE_SP)) ||
+		(pps.Weighted_bipred_idc == 1 && sliceType == H264_SLICE_B) {
+		sh.decodePredWeightTable(bs, sps)
+	}
+	if sh.Nal_ref_idc != 0 {
+		sh.decodeDecRefPicMarking(bs)
+	}
+	if pps.Entropy_coding_mode_flag == 1 && sliceType != H264_SLICE_I && sliceType != H264_SLICE_SI {
+		sh.Cabac_init_idc = bs.ReadUE()
+	}
+	sh.Slice_qp_delta = bs.ReadSE()
+	if sliceType == H264_SLICE_SP || sliceType == H264_SLICE_SI {
+		if sliceType == H264_SLICE_SP {
+			sh.Sp_for_switch_flag = bs.GetBit()
+		}
+		sh.Slice_qs_delta = bs.ReadSE()
+	}
+	if pps.Deblocking_filter_control_present_flag == 1 {
+		sh.Disable_deblocking_filter_idc = bs.ReadUE()
+		if sh.Disable_deblocking_filter_idc != 1 {
+			sh.Slice_alpha_c0_offset_div2 = bs.ReadSE()
+			sh.Slice_beta_offset_div2 = bs.ReadSE()
+		}
+	}
+	if pps.Num_slice_groups_minus1 > 0 && pps.Slice_group_map_type >= 3 && pps.Slice_group_map_type <= 5 {
+		picSizeInMapUnits := (sps.Pic_width_in_mbs_minus1 + 1) * (sps.Pic_height_in_map_units_minus1 + 1)
+		sliceGroupChangeRate := pps.Slice_group_change_rate_minus1 + 1
+		bits := ceilLog2(picSizeInMapUnits/sliceGroupChangeRate + 1)
+		if picSizeInMapUnits%sliceGroupChangeRate != 0 {
+			bits = ceilLog2(picSizeInMapUnits/sliceGroupChangeRate + 2)
+		}
+		sh.Slice_group_change_cycle = bs.GetBits(bits)
+	}
+}
+
+// 7.3.3.2 Prediction weight table syntax
+func (sh *SliceHeader) decodePredWeightTable(bs *BitStream, sps *SPS) {
+	pwt := &sh.PredWeightTable
+	chromaArrayType := sps.ChromaArrayType()
+	pwt.Luma_log2_weight_denom = bs.ReadUE()
+	if chromaArrayType != 0 {
+		pwt.Chroma_log2_weight_denom = bs.ReadUE()
+	}
+	decodeWeights := func(n uint64) []H264PredWeight {
+		weights := make([]H264PredWeight, n+1)
+		for i := range weights {
+			weights[i].Luma_weight_flag = bs.GetBit()
+			if weights[i].Luma_weight_flag == 1 {
+				weights[i].Luma_weight = bs.ReadSE()
+				weights[i].Luma_offset = bs.ReadSE()
+			}
+			if chromaArrayType != 0 {
+				weights[i].Chroma_weight_flag = bs.GetBit()
+				if weights[i].Chroma_weight_flag == 1 {
+					for j := 0; j < 2; j++ {
+						weights[i].Chroma_weight[j] = bs.ReadSE()
+						weights[i].Chroma_offset[j] = bs.ReadSE()
+					}
+				}
+			}
+		}
+		return weights
+	}
+	pwt.L0 = decodeWeights(sh.Num_ref_idx_l0_active_minus1)
+	if sh.SliceType() == H264_SLICE_B {
+		pwt.L1 = decodeWeights(sh.Num_ref_idx_l1_active_minus1)
+	}
+}
+
+// 7.3.3.3 Decoded reference picture marking syntax
+func (sh *SliceHeader) decodeDecRefPicMarking(bs *BitStream) {
+	marking := &sh.DecRefPicMarking
+	if sh.IdrPicFlag() {
+		marking.No_output_of_prior_pics_flag = bs.GetBit()
+		marking.Long_term_reference_flag = bs.GetBit()
+		return
+	}
+	marking.Adaptive_ref_pic_marking_mode_flag = bs.GetBit()
+	if marking.Adaptive_ref_pic_marking_mode_flag == 0 {
+		return
+	}
+	for {
+		var mmco H264MemoryManagementControl
+		mmco.Memory_management_control_operation = bs.ReadUE()
+		op := mmco.Memory_management_control_operation
+		if op == 1 || op == 3 {
+			mmco.Difference_of_pic_nums_minus1 = bs.ReadUE()
+		}
+		if op == 2 {
+			mmco.Long_term_pic_num = bs.ReadUE()
+		}
+		if op == 3 || op == 6 {
+			mmco.Long_term_frame_idx = bs.ReadUE()
+		}
+		if op == 4 {
+			mmco.Max_long_term_frame_idx_plus1 = bs.ReadUE()
+		}
+		marking.MMCO = append(marking.MMCO, mmco)
+		if op == 0 {
+			break
+		}
+	}
+}
+
+// memory_management_control_operation等于5时, 之后图像的poc计算需要重置
+func (sh *SliceHeader) HasMMCO5() bool {
+	for _, mmco := range sh.DecRefPicMarking.MMCO {
+		if mmco.Memory_management_control_operation == 5 {
+			return true
+		}
+	}
+	return false
+}
+
 type SPS struct {
-	Profile_idc                          uint8
-	Constraint_set0_flag                 uint8
-	Constraint_set1_flag                 uint8
-	Constraint_set2_flag                 uint8
-	Constraint_set3_flag                 uint8
-	Constraint_set4_flag                 uint8
-	Constraint_set5_flag                 uint8
-	Reserved_zero_2bits                  uint8
-	Level_idc                            uint8
-	Seq_parameter_set_id                 uint64
-	Chroma_format_idc                    uint64
-	Separate_colour_plane_flag           uint8
-	Bit_depth_luma_minus8                uint64
-	Bit_depth_chroma_minus8              uint64
-	Log2_max_frame_num_minus4            uint64
-	Pic_order_cnt_type                   uint64
-	Log2_max_pic_order_cnt_lsb_minus4    uint64
-	Delta_pic_order_always_zero_flag     uint8
-	Offset_for_non_ref_pic               int64
-	Offset_for_top_to_bottom_field       int64
-	Offset_for_ref_frame                 []int64
-	Max_num_ref_frames                   uint64
-	Gaps_in_frame_num_value_allowed_flag uint8
-	Pic_width_in_mbs_minus1              uint64
-	Pic_height_in_map_units_minus1       uint64
-	Frame_mbs_only_flag                  uint8
-	Mb_adaptive_frame_field_flag         uint8
-	Direct_8x8_inference_flag            uint8
-	Frame_cropping_flag                  uint8
-	Frame_crop_left_offset               uint64
-	Frame_crop_right_offset              uint64
-	Frame_crop_top_offset                uint64
-	Frame_crop_bottom_offset             uint64
-	Vui_parameters_present_flag          uint8
-	VuiParameters                        H264VuiParameters
+	Profile_idc                           uint8
+	Constraint_set0_flag                  uint8
+	Constraint_set1_flag                  uint8
+	Constraint_set2_flag                  uint8
+	Constraint_set3_flag                  uint8
+	Constraint_set4_flag                  uint8
+	Constraint_set5_flag                  uint8
+	Reserved_zero_2bits                   uint8
+	Level_idc                             uint8
+	Seq_parameter_set_id                  uint64
+	Chroma_format_idc                     uint64
+	Separate_colour_plane_flag            uint8
+	Bit_depth_luma_minus8                 uint64
+	Bit_depth_chroma_minus8               uint64
+	Qpprime_y_zero_transform_bypass_flag  uint8
+	Seq_scaling_matrix_present_flag       uint8
+	Seq_scaling_list_present_flag         [12]uint8
+	Delta_scale                           [12][]int64
+	Log2_max_frame_num_minus4             uint64
+	Pic_order_cnt_type                    uint64
+	Log2_max_pic_order_cnt_lsb_minus4     uint64
+	Delta_pic_order_always_zero_flag      uint8
+	Offset_for_non_ref_pic                int64
+	Offset_for_top_to_bottom_field        int64
+	Num_ref_frames_in_pic_order_cnt_cycle uint64
+	Offset_for_ref_frame                  []int64
+	Max_num_ref_frames                    uint64
+	Gaps_in_frame_num_value_allowed_flag  uint8
+	Pic_width_in_mbs_minus1               uint64
+	Pic_height_in_map_units_minus1        uint64
+	Frame_mbs_only_flag                   uint8
+	Mb_adaptive_frame_field_flag          uint8
+	Direct_8x8_inference_flag             uint8
+	Frame_cropping_flag                   uint8
+	Frame_crop_left_offset                uint64
+	Frame_crop_right_offset               uint64
+	Frame_crop_top_offset                 uint64
+	Frame_crop_bottom_offset              uint64
+	Vui_parameters_present_flag           uint8
+	VuiParameters                         H264VuiParameters
 }
 
+// Sqrt(139264*8), level 6.2一行或一列最多的宏块数
+const H264_MAX_MBS_IN_ROW = 1055
+
 func (sps *SPS) Decode(bs *BitStream) {
 	sps.Profile_idc = bs.Uint8(8)
 	sps.Constraint_set0_flag = bs.GetBit()
@@ -86,25 +374,34 @@ func (sps *SPS) Decode(bs *BitStream) {
 	sps.Reserved_zero_2bits = bs.Uint8(2)
 	sps.Level_idc = bs.Uint8(8)
 	sps.Seq_parameter_set_id = bs.ReadUE()
-	if sps.Profile_idc == 100 || sps.Profile_idc == 110 ||
-		sps.Profile_idc == 122 || sps.Profile_idc == 244 || sps.Profile_idc == 44 ||
-		sps.Profile_idc == 83 || sps.Profile_idc == 86 || sps.Profile_idc == 118 ||
-		sps.Profile_idc == 128 || sps.Profile_idc == 138 || sps.Profile_idc == 139 ||
-		sps.Profile_idc == 134 || sps.Profile_idc == 135 {
+	sps.Chroma_format_idc = 1
+	if sps.hasChromaFormatInfo() {
 		sps.Chroma_format_idc = bs.ReadUE()
+		if sps.Chroma_format_idc > 3 {
+			bs.fail(fmt.Errorf("%w: chroma_format_idc %d", ErrInvalidData, sps.Chroma_format_idc))
+			return
+		}
 		if sps.Chroma_format_idc == 3 {
 			sps.Separate_colour_plane_flag = bs.Uint8(1) //separate_colour_plane_flag
 		}
 		sps.Bit_depth_luma_minus8 = bs.ReadUE()   //bit_depth_luma_minus8
 		sps.Bit_depth_chroma_minus8 = bs.ReadUE() //bit_depth_chroma_minus8
-		bs.SkipBits(1)                            //qpprime_y_zero_transform_bypass_flag
-		seq_scaling_matrix_present_flag := bs.GetBit()
-		if seq_scaling_matrix_present_flag == 1 {
-			//seq_scaling_list_present_flag[i]
+		sps.Qpprime_y_zero_transform_bypass_flag = bs.GetBit()
+		sps.Seq_scaling_matrix_present_flag = bs.GetBit()
+		if sps.Seq_scaling_matrix_present_flag == 1 {
+			n := 8
 			if sps.Chroma_format_idc == 3 {
-				bs.SkipBits(12)
-			} else {
-				bs.SkipBits(8)
+				n = 12
+			}
+			for i := 0; i < n; i++ {
+				sps.Seq_scaling_list_present_flag[i] = bs.GetBit()
+				if sps.Seq_scaling_list_present_flag[i] == 1 {
+					if i < 6 {
+						sps.Delta_scale[i] = decodeScalingList(bs, 16)
+					} else {
+						sps.Delta_scale[i] = decodeScalingList(bs, 64)
+					}
+				}
 			}
 		}
 	}
@@ -116,8 +413,13 @@ func (sps *SPS) Decode(bs *BitStream) {
 		sps.Delta_pic_order_always_zero_flag = bs.GetBit()
 		sps.Offset_for_non_ref_pic = bs.ReadSE()         // offset_for_non_ref_pic
 		sps.Offset_for_top_to_bottom_field = bs.ReadSE() // offset_for_top_to_bottom_field
-		num_ref_frames_in_pic_order_cnt_cycle := bs.ReadUE()
-		for i := 0; i < int(num_ref_frames_in_pic_order_cnt_cycle); i++ {
+		sps.Num_ref_frames_in_pic_order_cnt_cycle = bs.ReadUE()
+		if sps.Num_ref_frames_in_pic_order_cnt_cycle > 255 {
+			bs.fail(fmt.Errorf("%w: num_ref_frames_in_pic_order_cnt_cycle %d", ErrInvalidData, sps.Num_ref_frames_in_pic_order_cnt_cycle))
+			return
+		}
+		sps.Offset_for_ref_frame = make([]int64, sps.Num_ref_frames_in_pic_order_cnt_cycle)
+		for i := 0; i < int(sps.Num_ref_frames_in_pic_order_cnt_cycle); i++ {
 			sps.Offset_for_ref_frame[i] = bs.ReadSE() // offset_for_ref_frame
 		}
 	}
@@ -125,6 +427,11 @@ func (sps *SPS) Decode(bs *BitStream) {
 	sps.Gaps_in_frame_num_value_allowed_flag = bs.GetBit()
 	sps.Pic_width_in_mbs_minus1 = bs.ReadUE()
 	sps.Pic_height_in_map_units_minus1 = bs.ReadUE()
+	// A.3.1 宽高都不超过Sqrt(MaxFS*8)个宏块, level 6.2的MaxFS为139264
+	if sps.Pic_width_in_mbs_minus1 >= H264_MAX_MBS_IN_ROW || sps.Pic_height_in_map_units_minus1 >= H264_MAX_MBS_IN_ROW {
+		bs.fail(fmt.Errorf("%w: pic size in mbs %dx%d", ErrInvalidData, sps.Pic_width_in_mbs_minus1+1, sps.Pic_height_in_map_units_minus1+1))
+		return
+	}
 	sps.Frame_mbs_only_flag = bs.GetBit()
 	if sps.Frame_mbs_only_flag == 0 {
 		sps.Mb_adaptive_frame_field_flag = bs.GetBit()
@@ -144,20 +451,268 @@ func (sps *SPS) Decode(bs *BitStream) {
 	}
 }
 
+func (sps *SPS) hasChromaFormatInfo() bool {
+	return sps.Profile_idc == 100 || sps.Profile_idc == 110 ||
+		sps.Profile_idc == 122 || sps.Profile_idc == 244 || sps.Profile_idc == 44 ||
+		sps.Profile_idc == 83 || sps.Profile_idc == 86 || sps.Profile_idc == 118 ||
+		sps.Profile_idc == 128 || sps.Profile_idc == 138 || sps.Profile_idc == 139 ||
+		sps.Profile_idc == 134 || sps.Profile_idc == 135
+}
+
+// 与Decode对应, 不包含nalu header和rbsp_trailing_bits
+func (sps *SPS) Encode(bsw *BitStreamWriter) {
+	bsw.PutUint8(sps.Profile_idc, 8)
+	bsw.PutUint8(sps.Constraint_set0_flag, 1)
+	bsw.PutUint8(sps.Constraint_set1_flag, 1)
+	bsw.PutUint8(sps.Constraint_set2_flag, 1)
+	bsw.PutUint8(sps.Constraint_set3_flag, 1)
+	bsw.PutUint8(sps.Constraint_set4_flag, 1)
+	bsw.PutUint8(sps.Constraint_set5_flag, 1)
+	bsw.PutUint8(sps.Reserved_zero_2bits, 2)
+	bsw.PutUint8(sps.Level_idc, 8)
+	bsw.PutUE(sps.Seq_parameter_set_id)
+	if sps.hasChromaFormatInfo() {
+		bsw.PutUE(sps.Chroma_format_idc)
+		if sps.Chroma_format_idc == 3 {
+			bsw.PutUint8(sps.Separate_colour_plane_flag, 1)
+		}
+		bsw.PutUE(sps.Bit_depth_luma_minus8)
+		bsw.PutUE(sps.Bit_depth_chroma_minus8)
+		bsw.PutUint8(sps.Qpprime_y_zero_transform_bypass_flag, 1)
+		bsw.PutUint8(sps.Seq_scaling_matrix_present_flag, 1)
+		if sps.Seq_scaling_matrix_present_flag == 1 {
+			n := 8
+			if sps.Chroma_format_idc == 3 {
+				n = 12
+			}
+			for i := 0; i < n; i++ {
+				bsw.PutUint8(sps.Seq_scaling_list_present_flag[i], 1)
+				if sps.Seq_scaling_list_present_flag[i] == 1 {
+					for _, delta := range sps.Delta_scale[i] {
+						bsw.PutSE(delta)
+					}
+				}
+			}
+		}
+	}
+	bsw.PutUE(sps.Log2_max_frame_num_minus4)
+	bsw.PutUE(sps.Pic_order_cnt_type)
+	if sps.Pic_order_cnt_type == 0 {
+		bsw.PutUE(sps.Log2_max_pic_order_cnt_lsb_minus4)
+	} else if sps.Pic_order_cnt_type == 1 {
+		bsw.PutUint8(sps.Delta_pic_order_always_zero_flag, 1)
+		bsw.PutSE(sps.Offset_for_non_ref_pic)
+		bsw.PutSE(sps.Offset_for_top_to_bottom_field)
+		bsw.PutUE(sps.Num_ref_frames_in_pic_order_cnt_cycle)
+		for i := 0; i < int(sps.Num_ref_frames_in_pic_order_cnt_cycle); i++ {
+			bsw.PutSE(sps.Offset_for_ref_frame[i])
+		}
+	}
+	bsw.PutUE(sps.Max_num_ref_frames)
+	bsw.PutUint8(sps.Gaps_in_frame_num_value_allowed_flag, 1)
+	bsw.PutUE(sps.Pic_width_in_mbs_minus1)
+	bsw.PutUE(sps.Pic_height_in_map_units_minus1)
+	bsw.PutUint8(sps.Frame_mbs_only_flag, 1)
+	if sps.Frame_mbs_only_flag == 0 {
+		bsw.PutUint8(sps.Mb_adaptive_frame_field_flag, 1)
+	}
+	bsw.PutUint8(sps.Direct_8x8_inference_flag, 1)
+	bsw.PutUint8(sps.Frame_cropping_flag, 1)
+	if sps.Frame_cropping_flag == 1 {
+		bsw.PutUE(sps.Frame_crop_left_offset)
+		bsw.PutUE(sps.Frame_crop_right_offset)
+		bsw.PutUE(sps.Frame_crop_top_offset)
+		bsw.PutUE(sps.Frame_crop_bottom_offset)
+	}
+	bsw.PutUint8(sps.Vui_parameters_present_flag, 1)
+	if sps.Vui_parameters_present_flag == 1 {
+		sps.VuiParameters.Encode(bsw)
+	}
+}
+
+// 生成不带startcode的sps nalu(包含防竞争字节), 可以直接用于CreateH264AVCCExtradata
+func EncodeH264SPSNalu(sps *SPS) []byte {
+	bsw := NewBitStreamWriter(64)
+	sps.Encode(bsw)
+	bsw.PutRbspTrailingBits()
+	return append([]byte{0x67}, CovertSodbToRbsp(bsw.Bits())...)
+}
+
+//	scaling_list( scalingList, sizeOfScalingList, useDefaultScalingMatrixFlag ) {
+//	    lastScale = 8
+//	    nextScale = 8
+//	    for( j = 0; j < sizeOfScalingList; j++ ) {
+//	        if( nextScale != 0 ) {
+//	            delta_scale                                     se(v)
+//	            nextScale = ( lastScale + delta_scale + 256 ) % 256
+//	            useDefaultScalingMatrixFlag = ( j = = 0 && nextScale = = 0 )
+//	        }
+//	        scalingList[ j ] = ( nextScale = = 0 ) ? lastScale : nextScale
+//	        lastScale = scalingList[ j ]
+//	    }
+//	}
+//
+// 只保存码流中的delta_scale,足以还原scaling list
+func decodeScalingList(bs *BitStream, size int) []int64 {
+	var deltas []int64
+	lastScale, nextScale := int64(8), int64(8)
+	for j := 0; j < size; j++ {
+		if nextScale != 0 {
+			delta := bs.ReadSE()
+			deltas = append(deltas, delta)
+			nextScale = (lastScale + delta + 256) % 256
+		}
+		if nextScale != 0 {
+			lastScale = nextScale
+		}
+	}
+	return deltas
+}
+
+// ChromaArrayType
+func (sps *SPS) ChromaArrayType() uint64 {
+	if sps.Separate_colour_plane_flag == 1 {
+		return 0
+	}
+	return sps.Chroma_format_idc
+}
+
+func (sps *SPS) MaxFrameNum() uint64 {
+	return 1 << (sps.Log2_max_frame_num_minus4 + 4)
+}
+
+func (sps *SPS) MaxPicOrderCntLsb() uint64 {
+	return 1 << (sps.Log2_max_pic_order_cnt_lsb_minus4 + 4)
+}
+
+// 解码顺序到显示顺序需要缓存的最大帧数
+// vui中没有bitstream_restriction时, pic_order_cnt_type为2或者baseline profile不存在重排序,
+// 其它情况保守地使用max_num_ref_frames
+func (sps *SPS) MaxNumReorderFrames() int {
+	if sps.VuiParameters.BitstreamRestrictionFlag == 1 {
+		return int(sps.VuiParameters.NumReorderFrames)
+	}
+	if sps.Pic_order_cnt_type == 2 || sps.Profile_idc == 66 {
+		return 0
+	}
+	if sps.Max_num_ref_frames > 16 {
+		return 16
+	}
+	return int(sps.Max_num_ref_frames)
+}
+
 type PPS struct {
 	Pic_parameter_set_id                         uint64
 	Seq_parameter_set_id                         uint64
 	Entropy_coding_mode_flag                     uint8
 	Bottom_field_pic_order_in_frame_present_flag uint8
 	Num_slice_groups_minus1                      uint64
+	Slice_group_map_type                         uint64
+	Run_length_minus1                            []uint64
+	Top_left                                     []uint64
+	Bottom_right                                 []uint64
+	Slice_group_change_direction_flag            uint8
+	Slice_group_change_rate_minus1               uint64
+	Pic_size_in_map_units_minus1                 uint64
+	Slice_group_id                               []uint64
+	Num_ref_idx_l0_default_active_minus1         uint64
+	Num_ref_idx_l1_default_active_minus1         uint64
+	Weighted_pred_flag                           uint8
+	Weighted_bipred_idc                          uint8
+	Pic_init_qp_minus26                          int64
+	Pic_init_qs_minus26                          int64
+	Chroma_qp_index_offset                       int64
+	Deblocking_filter_control_present_flag       uint8
+	Constrained_intra_pred_flag                  uint8
+	Redundant_pic_cnt_present_flag               uint8
+	Transform_8x8_mode_flag                      uint8
+	Pic_scaling_matrix_present_flag              uint8
+	Pic_scaling_list_present_flag                [12]uint8
+	Delta_scale                                  [12][]int64
+	Second_chroma_qp_index_offset                int64
 }
 
+// 7.3.2.2 Picture parameter set RBSP syntax
+// pps中transform_8x8_mode_flag之后的字段只有在more_rbsp_data()时存在,
+// pic_scaling_list的个数依赖sps中的chroma_format_idc, 这里按照chroma_format_idc != 3处理
 func (pps *PPS) Decode(bs *BitStream) {
 	pps.Pic_parameter_set_id = bs.ReadUE()
 	pps.Seq_parameter_set_id = bs.ReadUE()
 	pps.Entropy_coding_mode_flag = bs.GetBit()
 	pps.Bottom_field_pic_order_in_frame_present_flag = bs.GetBit()
 	pps.Num_slice_groups_minus1 = bs.ReadUE()
+	if pps.Num_slice_groups_minus1 > 7 {
+		bs.fail(fmt.Errorf("%w: num_slice_groups_minus1 %d", ErrInvalidData, pps.Num_slice_groups_minus1))
+		return
+	}
+	if pps.Num_slice_groups_minus1 > 0 {
+		pps.Slice_group_map_type = bs.ReadUE()
+		switch pps.Slice_group_map_type {
+		case 0:
+			pps.Run_length_minus1 = make([]uint64, pps.Num_slice_groups_minus1+1)
+			for i := range pps.Run_length_minus1 {
+				pps.Run_length_minus1[i] = bs.ReadUE()
+			}
+		case 2:
+			pps.Top_left = make([]uint64, pps.Num_slice_groups_minus1)
+			pps.Bottom_right = make([]uint64, pps.Num_slice_groups_minus1)
+			for i := range pps.Top_left {
+				pps.Top_left[i] = bs.ReadUE()
+				pps.Bottom_right[i] = bs.ReadUE()
+			}
+		case 3, 4, 5:
+			pps.Slice_group_change_direction_flag = bs.GetBit()
+			pps.Slice_group_change_rate_minus1 = bs.ReadUE()
+		case 6:
+			pps.Pic_size_in_map_units_minus1 = bs.ReadUE()
+			bits := ceilLog2(pps.Num_slice_groups_minus1 + 1)
+			if pps.Pic_size_in_map_units_minus1 >= uint64(bs.RemainBits()/bits) {
+				bs.fail(ErrTruncated)
+				return
+			}
+			pps.Slice_group_id = make([]uint64, pps.Pic_size_in_map_units_minus1+1)
+			for i := range pps.Slice_group_id {
+				pps.Slice_group_id[i] = bs.GetBits(bits)
+			}
+		}
+	}
+	pps.Num_ref_idx_l0_default_active_minus1 = bs.ReadUE()
+	pps.Num_ref_idx_l1_default_active_minus1 = bs.ReadUE()
+	pps.Weighted_pred_flag = bs.GetBit()
+	pps.Weighted_bipred_idc = bs.Uint8(2)
+	pps.Pic_init_qp_minus26 = bs.ReadSE()
+	pps.Pic_init_qs_minus26 = bs.ReadSE()
+	pps.Chroma_qp_index_offset = bs.ReadSE()
+	pps.Deblocking_filter_control_present_flag = bs.GetBit()
+	pps.Constrained_intra_pred_flag = bs.GetBit()
+	pps.Redundant_pic_cnt_present_flag = bs.GetBit()
+	pps.Second_chroma_qp_index_offset = pps.Chroma_qp_index_offset
+	if !bs.MoreRbspData() {
+		return
+	}
+	pps.Transform_8x8_mode_flag = bs.GetBit()
+	pps.Pic_scaling_matrix_present_flag = bs.GetBit()
+	if pps.Pic_scaling_matrix_present_flag == 1 {
+		for i := 0; i < 6+2*int(pps.Transform_8x8_mode_flag); i++ {
+			pps.Pic_scaling_list_present_flag[i] = bs.GetBit()
+			if pps.Pic_scaling_list_present_flag[i] == 1 {
+				if i < 6 {
+					pps.Delta_scale[i] = decodeScalingList(bs, 16)
+				} else {
+					pps.Delta_scale[i] = decodeScalingList(bs, 64)
+				}
+			}
+		}
+	}
+	pps.Second_chroma_qp_index_offset = bs.ReadSE()
+}
+
+// Ceil( Log2( v ) )
+func ceilLog2(v uint64) int {
+	if v <= 1 {
+		return 0
+	}
+	return mathbits.Len64(v - 1)
 }
 
 type SEIReaderWriter interface {
@@ -189,16 +744,16 @@ type SEI struct {
 func (sei *SEI) Decode(bs *BitStream) {
 	for bs.NextBits(8) == 0xFF {
 		sei.PayloadType += 255
+		bs.SkipBits(8)
 	}
 	sei.PayloadType += uint16(bs.Uint8(8))
 	for bs.NextBits(8) == 0xFF {
 		sei.PayloadSize += 255
+		bs.SkipBits(8)
 	}
 	sei.PayloadSize += uint16(bs.Uint8(8))
-	if sei.PayloadType == 5 {
-		sei.Sei_payload = new(UserDataUnregistered)
-		sei.Sei_payload.Read(sei.PayloadSize, bs)
-	}
+	sei.Sei_payload = newSEIPayload(sei.PayloadType)
+	sei.Sei_payload.Read(sei.PayloadSize, NewBitStream(bs.GetBytes(int(sei.PayloadSize))))
 }
 
 func (sei *SEI) Encode(bsw *BitStreamWriter) []byte {
@@ -219,34 +774,202 @@ func (sei *SEI) Encode(bsw *BitStreamWriter) []byte {
 }
 
 func GetSPSIdWithStartCode(sps []byte) uint64 {
-	start, sc := FindStartCode(sps, 0)
-	return GetSPSId(sps[start+int(sc):])
+	return GetSPSId(trimStartCode(sps))
 }
 
 func GetSPSId(sps []byte) uint64 {
-	sps = sps[1:]
-	bs := NewBitStream(sps)
+	if len(sps) < 1 {
+		return 0
+	}
+	var buf [16]byte
+	bs := NewBitStream(RbspView(headBytes(sps[1:], 16), buf[:]))
 	bs.SkipBits(24)
 	return bs.ReadUE()
 }
 
 func GetPPSIdWithStartCode(pps []byte) uint64 {
-	start, sc := FindStartCode(pps, 0)
-	return GetPPSId(pps[start+int(sc):])
+	return GetPPSId(trimStartCode(pps))
 }
 
 func GetPPSId(pps []byte) uint64 {
-	pps = pps[1:]
-	bs := NewBitStream(pps)
+	if len(pps) < 1 {
+		return 0
+	}
+	var buf [16]byte
+	bs := NewBitStream(RbspView(headBytes(pps[1:], 16), buf[:]))
 	return bs.ReadUE()
 }
 
+// 解析不带startcode的slice nalu的slice header, spss/ppss以id为key
+func DecodeH264SliceHeader(nalu []byte, spss map[uint64]*SPS, ppss map[uint64]*PPS) (*SliceHeader, error) {
+	if len(nalu) < 2 {
+		return nil, errors.New("h264 slice nalu too short")
+	}
+	var hdr H264NaluHdr
+	hdr.Decode(NewBitStream(nalu[:1]))
+	if hdr.Nal_unit_type != uint8(H264_NAL_P_SLICE) && hdr.Nal_unit_type != uint8(H264_NAL_I_SLICE) {
+		return nil, errors.New("not h264 slice nalu")
+	}
+	bs := NewBitStream(CovertRbspToSodb(nalu[1:]))
+	sh := &SliceHeader{}
+	sh.Decode(bs)
+	if bs.Err() != nil {
+		return nil, fmt.Errorf("h264 slice header: %w", bs.Err())
+	}
+	pps, found := ppss[sh.Pic_parameter_set_id]
+	if !found {
+		return nil, errors.New("not found h264 pps")
+	}
+	sps, found := spss[pps.Seq_parameter_set_id]
+	if !found {
+		return nil, errors.New("not found h264 sps")
+	}
+	bs = NewBitStream(bs.Bits())
+	sh.DecodeWithParameterSet(bs, hdr, sps, pps)
+	if bs.Err() != nil {
+		return nil, fmt.Errorf("h264 slice header: %w", bs.Err())
+	}
+	return sh, nil
+}
+
+// 8.2.1 Decoding process for picture order count
+// 按照解码顺序, 每个图像调用一次PicOrderCnt(同一图像的多个slice只需要第一个slice)
+type H264PocCalculator struct {
+	prevPicOrderCntMsb int64
+	prevPicOrderCntLsb int64
+	prevFrameNumOffset int64
+	prevFrameNum       int64
+}
+
+func (calc *H264PocCalculator) PicOrderCnt(sps *SPS, sh *SliceHeader) int64 {
+	var topFieldOrderCnt, bottomFieldOrderCnt int64
+	var picOrderCntMsb, frameNumOffset int64
+	frameNum := int64(sh.Frame_num)
+	if sps.Pic_order_cnt_type != 0 {
+		if sh.IdrPicFlag() {
+			frameNumOffset = 0
+		} else if calc.prevFrameNum > frameNum {
+			frameNumOffset = calc.prevFrameNumOffset + int64(sps.MaxFrameNum())
+		} else {
+			frameNumOffset = calc.prevFrameNumOffset
+		}
+	}
+
+	switch sps.Pic_order_cnt_type {
+	case 0:
+		// 8.2.1.1
+		if sh.IdrPicFlag() {
+			calc.prevPicOrderCntMsb = 0
+			calc.prevPicOrderCntLsb = 0
+		}
+		maxPicOrderCntLsb := int64(sps.MaxPicOrderCntLsb())
+		lsb := int64(sh.Pic_order_cnt_lsb)
+		if lsb < calc.prevPicOrderCntLsb && calc.prevPicOrderCntLsb-lsb >= maxPicOrderCntLsb/2 {
+			picOrderCntMsb = calc.prevPicOrderCntMsb + maxPicOrderCntLsb
+		} else if lsb > calc.prevPicOrderCntLsb && lsb-calc.prevPicOrderCntLsb > maxPicOrderCntLsb/2 {
+			picOrderCntMsb = calc.prevPicOrderCntMsb - maxPicOrderCntLsb
+		} else {
+			picOrderCntMsb = calc.prevPicOrderCntMsb
+		}
+		topFieldOrderCnt = picOrderCntMsb + lsb
+		if sh.Field_pic_flag == 0 {
+			bottomFieldOrderCnt = topFieldOrderCnt + sh.Delta_pic_order_cnt_bottom
+		} else {
+			bottomFieldOrderCnt = picOrderCntMsb + lsb
+		}
+	case 1:
+		// 8.2.1.2
+		var absFrameNum, expectedPicOrderCnt int64
+		if sps.Num_ref_frames_in_pic_order_cnt_cycle != 0 {
+			absFrameNum = frameNumOffset + frameNum
+		}
+		if sh.Nal_ref_idc == 0 && absFrameNum > 0 {
+			absFrameNum--
+		}
+		if absFrameNum > 0 {
+			var expectedDeltaPerPicOrderCntCycle int64
+			for _, offset := range sps.Offset_for_ref_frame {
+				expectedDeltaPerPicOrderCntCycle += offset
+			}
+			cycle := int64(sps.Num_ref_frames_in_pic_order_cnt_cycle)
+			picOrderCntCycleCnt := (absFrameNum - 1) / cycle
+			frameNumInPicOrderCntCycle := (absFrameNum - 1) % cycle
+			expectedPicOrderCnt = picOrderCntCycleCnt * expectedDeltaPerPicOrderCntCycle
+			for i := int64(0); i <= frameNumInPicOrderCntCycle; i++ {
+				expectedPicOrderCnt += sps.Offset_for_ref_frame[i]
+			}
+		}
+		if sh.Nal_ref_idc == 0 {
+			expectedPicOrderCnt += sps.Offset_for_non_ref_pic
+		}
+		if sh.Field_pic_flag == 0 {
+			topFieldOrderCnt = expectedPicOrderCnt + sh.Delta_pic_order_cnt[0]
+			bottomFieldOrderCnt = topFieldOrderCnt + sps.Offset_for_top_to_bottom_field + sh.Delta_pic_order_cnt[1]
+		} else if sh.Bottom_field_flag == 0 {
+			topFieldOrderCnt = expectedPicOrderCnt + sh.Delta_pic_order_cnt[0]
+		} else {
+			bottomFieldOrderCnt = expectedPicOrderCnt + sps.Offset_for_top_to_bottom_field + sh.Delta_pic_order_cnt[0]
+		}
+	default:
+		// 8.2.1.3
+		var tempPicOrderCnt int64
+		if sh.IdrPicFlag() {
+			tempPicOrderCnt = 0
+		} else if sh.Nal_ref_idc == 0 {
+			tempPicOrderCnt = 2*(frameNumOffset+frameNum) - 1
+		} else {
+			tempPicOrderCnt = 2 * (frameNumOffset + frameNum)
+		}
+		topFieldOrderCnt = tempPicOrderCnt
+		bottomFieldOrderCnt = tempPicOrderCnt
+	}
+
+	var poc int64
+	if sh.Field_pic_flag == 0 {
+		poc = topFieldOrderCnt
+		if bottomFieldOrderCnt < poc {
+			poc = bottomFieldOrderCnt
+		}
+	} else if sh.Bottom_field_flag == 1 {
+		poc = bottomFieldOrderCnt
+	} else {
+		poc = topFieldOrderCnt
+	}
+
+	// memory_management_control_operation等于5时, 当前图像的poc减去tempPicOrderCnt, 效果等同于idr
+	mmco5 := sh.HasMMCO5()
+	if sps.Pic_order_cnt_type == 0 && sh.Nal_ref_idc != 0 {
+		if mmco5 {
+			calc.prevPicOrderCntMsb = 0
+			if sh.Field_pic_flag == 1 && sh.Bottom_field_flag == 1 {
+				calc.prevPicOrderCntLsb = 0
+			} else {
+				calc.prevPicOrderCntLsb = topFieldOrderCnt - poc
+			}
+		} else {
+			calc.prevPicOrderCntMsb = picOrderCntMsb
+			calc.prevPicOrderCntLsb = int64(sh.Pic_order_cnt_lsb)
+		}
+	}
+	if mmco5 {
+		calc.prevFrameNumOffset = 0
+		calc.prevFrameNum = 0
+		return 0
+	}
+	calc.prevFrameNumOffset = frameNumOffset
+	calc.prevFrameNum = frameNum
+	return poc
+}
+
 // https://stackoverflow.com/questions/12018535/get-the-width-height-of-the-video-from-h-264-nalu
 // int Width = ((pic_width_in_mbs_minus1 +1)*16) - frame_crop_right_offset *2 - frame_crop_left_offset *2;
 // int Height = ((2 - frame_mbs_only_flag)* (pic_height_in_map_units_minus1 +1) * 16) - (frame_crop_bottom_offset* 2) - (frame_crop_top_offset* 2);
 func GetH264Resolution(sps []byte) (width uint32, height uint32) {
-	start, sc := FindStartCode(sps, 0)
-	sodb := CovertRbspToSodb(sps[start+int(sc)+1:])
+	sps = trimStartCode(sps)
+	if len(sps) < 1 {
+		return 0, 0
+	}
+	sodb := CovertRbspToSodb(sps[1:])
 	bs := NewBitStream(sodb)
 	var s SPS
 	s.Decode(bs)
@@ -325,13 +1048,14 @@ func CreateH264AVCCExtradata(spss [][]byte, ppss [][]byte) ([]byte, error) {
 
 	extradata := make([]byte, 6, 256)
 	for i, sps := range spss {
-		start, sc := FindStartCode(sps, 0)
-		spss[i] = sps[start+int(sc):]
+		spss[i] = trimStartCode(sps)
 	}
 
 	for i, pps := range ppss {
-		start, sc := FindStartCode(pps, 0)
-		ppss[i] = pps[start+int(sc):]
+		ppss[i] = trimStartCode(pps)
+	}
+	if len(spss[0]) < 4 {
+		return nil, errors.New("h264 sps too short")
 	}
 
 	extradata[0] = 0x01
@@ -371,28 +1095,47 @@ func CreateH264AVCCExtradata(spss [][]byte, ppss [][]byte) ([]byte, error) {
 	return extradata, nil
 }
 
+// 数据不完整时只返回已经解析出来的sps/pps
 func CovertExtradata(extraData []byte) ([][]byte, [][]byte) {
+	if len(extraData) < 6 {
+		return nil, nil
+	}
 	spsnum := extraData[5] & 0x1F
-	spss := make([][]byte, spsnum)
+	spss := make([][]byte, 0, spsnum)
 	offset := 6
 	for i := 0; i < int(spsnum); i++ {
+		if offset+2 > len(extraData) {
+			return spss, nil
+		}
 		spssize := binary.BigEndian.Uint16(extraData[offset:])
+		if offset+2+int(spssize) > len(extraData) {
+			return spss, nil
+		}
 		sps := make([]byte, spssize+4)
 		copy(sps, []byte{0x00, 0x00, 0x00, 0x01})
 		copy(sps[4:], extraData[offset+2:offset+2+int(spssize)])
 		offset += 2 + int(spssize)
-		spss[i] = sps
+		spss = append(spss, sps)
+	}
+	if offset >= len(extraData) {
+		return spss, nil
 	}
 	ppsnum := extraData[offset]
-	ppss := make([][]byte, ppsnum)
+	ppss := make([][]byte, 0, ppsnum)
 	offset++
 	for i := 0; i < int(ppsnum); i++ {
+		if offset+2 > len(extraData) {
+			break
+		}
 		ppssize := binary.BigEndian.Uint16(extraData[offset:])
+		if offset+2+int(ppssize) > len(extraData) {
+			break
+		}
 		pps := make([]byte, ppssize+4)
 		copy(pps, []byte{0x00, 0x00, 0x00, 0x01})
 		copy(pps[4:], extraData[offset+2:offset+2+int(ppssize)])
 		offset += 2 + int(ppssize)
-		ppss[i] = pps
+		ppss = append(ppss, pps)
 	}
 	return spss, ppss
 }
@@ -486,7 +1229,7 @@ func (h264Vui *H264VuiParameters) Decode(bs *BitStream) {
 
 		if h264Vui.AspectRatioIdc == ExtendedSar {
 			h264Vui.SarWidth = bs.Uint16(16)
-			h264Vui.SarWidth = bs.Uint16(16)
+			h264Vui.SarHeight = bs.Uint16(16)
 		}
 	}
 
@@ -541,27 +1284,32 @@ func (h264Vui *H264VuiParameters) Decode(bs *BitStream) {
 		h264Vui.LowDelayHrdFlag = bs.Uint8(1)
 	}
 
-	/*
-		TODO - These fields were causing problems because we'd run out of bits when parsing. Maybe they're optional in certain versions/levels/configurations?
-			h264Vui.PicStructPresentFlag = bs.GetBit()
-			h264Vui.BitstreamRestrictionFlag = bs.GetBit()
-
-			if h264Vui.BitstreamRestrictionFlag == 1 {
-				h264Vui.MotionVectorsOverPicBoundaries = bs.GetBit()
-				h264Vui.MaxBytesPerPicDenom = bs.ReadUE()
-				h264Vui.MaxBitsPerMbDenom = bs.ReadUE()
-				h264Vui.Log2MaxMvLengthHorizontal = bs.ReadUE()
-				h264Vui.Log2MaxMvLengthVertical = bs.ReadUE()
-				h264Vui.NumReorderFrames = bs.ReadUE()
-				h264Vui.MaxDecFrameBuffering = bs.ReadUE()
-			}
-	*/
+	// 某些设备输出的sps在这里被截断
+	if bs.RemainBits() < 2 {
+		return
+	}
+	h264Vui.PicStructPresentFlag = bs.GetBit()
+	h264Vui.BitstreamRestrictionFlag = bs.GetBit()
+
+	if h264Vui.BitstreamRestrictionFlag == 1 {
+		h264Vui.MotionVectorsOverPicBoundaries = bs.GetBit()
+		h264Vui.MaxBytesPerPicDenom = bs.ReadUE()
+		h264Vui.MaxBitsPerMbDenom = bs.ReadUE()
+		h264Vui.Log2MaxMvLengthHorizontal = bs.ReadUE()
+		h264Vui.Log2MaxMvLengthVertical = bs.ReadUE()
+		h264Vui.NumReorderFrames = bs.ReadUE()
+		h264Vui.MaxDecFrameBuffering = bs.ReadUE()
+	}
 }
 
 func (h264Hrd *H264HrdParameters) Decode(bs *BitStream) {
 	h264Hrd.CpbCntMinus1 = bs.ReadUE()
 	h264Hrd.BitRateScale = bs.Uint8(4)
 	h264Hrd.CpbSizeScale = bs.Uint8(4)
+	if h264Hrd.CpbCntMinus1 > 31 {
+		bs.fail(fmt.Errorf("%w: cpb_cnt_minus1 %d", ErrInvalidData, h264Hrd.CpbCntMinus1))
+		return
+	}
 
 	h264Hrd.H264BitRateCpbSizeCbrFlag = make([]H264BitRateCpbSizeCbrFlag, h264Hrd.CpbCntMinus1+1)
 
@@ -574,5 +1322,79 @@ func (h264Hrd *H264HrdParameters) Decode(bs *BitStream) {
 	h264Hrd.InitialCpbRemovalDelayLengthMinus1 = bs.Uint8(5)
 	h264Hrd.CpbRemovalDelayLengthMinus1 = bs.Uint8(5)
 	h264Hrd.DpbOutputDelayLengthMinus1 = bs.Uint8(5)
-	//h264Hrd.TimeOffsetLength = bs.Uint8(5)
+	h264Hrd.TimeOffsetLength = bs.Uint8(5)
+}
+
+func (h264Vui *H264VuiParameters) Encode(bsw *BitStreamWriter) {
+	bsw.PutUint8(h264Vui.AspectRatioInfoPresentFlag, 1)
+	if h264Vui.AspectRatioInfoPresentFlag == 1 {
+		bsw.PutUint8(h264Vui.AspectRatioIdc, 8)
+		if h264Vui.AspectRatioIdc == ExtendedSar {
+			bsw.PutUint16(h264Vui.SarWidth, 16)
+			bsw.PutUint16(h264Vui.SarHeight, 16)
+		}
+	}
+	bsw.PutUint8(h264Vui.OverscanInfoPresentFlag, 1)
+	if h264Vui.OverscanInfoPresentFlag == 1 {
+		bsw.PutUint8(h264Vui.OverscanAppropriateFlag, 1)
+	}
+	bsw.PutUint8(h264Vui.VideoSignalTypePresentFlag, 1)
+	if h264Vui.VideoSignalTypePresentFlag == 1 {
+		bsw.PutUint8(h264Vui.VideoFormat, 3)
+		bsw.PutUint8(h264Vui.VideoFullRangeFlag, 1)
+		bsw.PutUint8(h264Vui.ColourDescriptionPresentFlag, 1)
+		if h264Vui.ColourDescriptionPresentFlag == 1 {
+			bsw.PutUint8(h264Vui.ColourPrimaries, 8)
+			bsw.PutUint8(h264Vui.TransferCharacteristics, 8)
+			bsw.PutUint8(h264Vui.MatrixCoefficients, 8)
+		}
+	}
+	bsw.PutUint8(h264Vui.ChromaLocInfoPresentFlag, 1)
+	if h264Vui.ChromaLocInfoPresentFlag == 1 {
+		bsw.PutUE(h264Vui.ChromaSampleLocTypeTopField)
+		bsw.PutUE(h264Vui.ChromaSampleLocTypeBottomField)
+	}
+	bsw.PutUint8(h264Vui.TimingInfoPresentFlag, 1)
+	if h264Vui.TimingInfoPresentFlag == 1 {
+		bsw.PutUint32(h264Vui.NumUnitsInTick, 32)
+		bsw.PutUint32(h264Vui.TimeScale, 32)
+		bsw.PutUint8(h264Vui.FixedFrameRateFlag, 1)
+	}
+	bsw.PutUint8(h264Vui.NalHrdParametersPresentFlag, 1)
+	if h264Vui.NalHrdParametersPresentFlag == 1 {
+		h264Vui.NalHrdParameters.Encode(bsw)
+	}
+	bsw.PutUint8(h264Vui.VclHrdParametersPresentFlag, 1)
+	if h264Vui.VclHrdParametersPresentFlag == 1 {
+		h264Vui.VclHrdParameters.Encode(bsw)
+	}
+	if h264Vui.NalHrdParametersPresentFlag == 1 || h264Vui.VclHrdParametersPresentFlag == 1 {
+		bsw.PutUint8(h264Vui.LowDelayHrdFlag, 1)
+	}
+	bsw.PutUint8(h264Vui.PicStructPresentFlag, 1)
+	bsw.PutUint8(h264Vui.BitstreamRestrictionFlag, 1)
+	if h264Vui.BitstreamRestrictionFlag == 1 {
+		bsw.PutUint8(h264Vui.MotionVectorsOverPicBoundaries, 1)
+		bsw.PutUE(h264Vui.MaxBytesPerPicDenom)
+		bsw.PutUE(h264Vui.MaxBitsPerMbDenom)
+		bsw.PutUE(h264Vui.Log2MaxMvLengthHorizontal)
+		bsw.PutUE(h264Vui.Log2MaxMvLengthVertical)
+		bsw.PutUE(h264Vui.NumReorderFrames)
+		bsw.PutUE(h264Vui.MaxDecFrameBuffering)
+	}
+}
+
+func (h264Hrd *H264HrdParameters) Encode(bsw *BitStreamWriter) {
+	bsw.PutUE(h264Hrd.CpbCntMinus1)
+	bsw.PutUint8(h264Hrd.BitRateScale, 4)
+	bsw.PutUint8(h264Hrd.CpbSizeScale, 4)
+	for i := 0; i <= int(h264Hrd.CpbCntMinus1); i++ {
+		bsw.PutUE(h264Hrd.H264BitRateCpbSizeCbrFlag[i].BitRateValueMinus1)
+		bsw.PutUE(h264Hrd.H264BitRateCpbSizeCbrFlag[i].CpbSizeValueMinus1)
+		bsw.PutUint8(h264Hrd.H264BitRateCpbSizeCbrFlag[i].CbrFlag, 1)
+	}
+	bsw.PutUint8(h264Hrd.InitialCpbRemovalDelayLengthMinus1, 5)
+	bsw.PutUint8(h264Hrd.CpbRemovalDelayLengthMinus1, 5)
+	bsw.PutUint8(h264Hrd.DpbOutputDelayLengthMinus1, 5)
+	bsw.PutUint8(h264Hrd.TimeOffsetLength, 5)
 }
@@ -1,6 +1,7 @@
 package codec
 
 import (
+    "errors"
     "reflect"
     "testing"
 )
@@ -98,3 +99,328 @@ func TestCreateH264AVCCExtradata(t *testing.T) {
         })
     }
 }
+
+// CreateH264AVCCExtradata会修改spss1/ppss1, 这里单独定义不带startcode的sps/pps
+var h264TestSps []byte = []byte{0x67, 0x64, 0x00, 0x0A, 0xAC, 0x72, 0x84, 0x44,
+    0x26, 0x84, 0x00, 0x00, 0x03, 0x00, 0x04, 0x00, 0x00, 0x03, 0x00, 0xCA, 0x3C, 0x48, 0x96, 0x11, 0x80}
+var h264TestPps []byte = []byte{0x68, 0xE8, 0x43, 0x8F, 0x13, 0x21, 0x30}
+
+func TestPPS_Decode(t *testing.T) {
+    pps := &PPS{}
+    pps.Decode(NewBitStream(CovertRbspToSodb(h264TestPps[1:])))
+    if pps.Entropy_coding_mode_flag != 1 || pps.Num_ref_idx_l0_default_active_minus1 != 15 || pps.Weighted_pred_flag != 1 ||
+        pps.Weighted_bipred_idc != 2 || pps.Pic_init_qp_minus26 != -3 || pps.Chroma_qp_index_offset != -4 ||
+        pps.Deblocking_filter_control_present_flag != 1 || pps.Transform_8x8_mode_flag != 1 || pps.Second_chroma_qp_index_offset != -4 {
+        t.Errorf("PPS.Decode() = %+v", pps)
+    }
+    sps := &SPS{}
+    sps.Decode(NewBitStream(CovertRbspToSodb(h264TestSps[1:])))
+    if sps.VuiParameters.BitstreamRestrictionFlag != 1 || sps.MaxNumReorderFrames() != 2 {
+        t.Errorf("SPS.Decode() vui = %+v", sps.VuiParameters)
+    }
+}
+
+// 根据h264TestSps/h264TestPps构造slice nalu, p slice使用显式加权预测
+func makeH264TestSlice(nalType uint8, refIdc uint8, sliceType H264_SLICE_TYPE, frameNum uint64, pocLsb uint64) []byte {
+    bsw := NewBitStreamWriter(32)
+    bsw.PutUint8(0, 1)
+    bsw.PutUint8(refIdc, 2)
+    bsw.PutUint8(nalType, 5)
+    bsw.PutUE(0)
+    bsw.PutUE(uint64(sliceType))
+    bsw.PutUE(0)
+    bsw.PutUint64(frameNum, 6)
+    if nalType == uint8(H264_NAL_I_SLICE) {
+        bsw.PutUE(0)
+    }
+    bsw.PutUint64(pocLsb, 8)
+    if sliceType == H264_SLICE_B {
+        bsw.PutUint8(1, 1)
+    }
+    if sliceType != H264_SLICE_I {
+        bsw.PutUint8(1, 1)
+        bsw.PutUE(0)
+        if sliceType == H264_SLICE_B {
+            bsw.PutUE(0)
+        }
+        bsw.PutUint8(0, 1)
+    }
+    if sliceType == H264_SLICE_B {
+        bsw.PutUint8(0, 1)
+    }
+    if sliceType == H264_SLICE_P {
+        bsw.PutUE(0)
+        bsw.PutUE(0)
+        bsw.PutUint8(0, 2)
+    }
+    if refIdc != 0 {
+        if nalType == uint8(H264_NAL_I_SLICE) {
+            bsw.PutUint8(0, 2)
+        } else {
+            bsw.PutUint8(0, 1)
+        }
+    }
+    if sliceType != H264_SLICE_I {
+        bsw.PutUE(0)
+    }
+    bsw.PutSE(-2)
+    bsw.PutUE(1)
+    bsw.PutUint8(1, 1)
+    return bsw.Bits()
+}
+
+type h264TestPicture struct {
+    nalType   uint8
+    refIdc    uint8
+    sliceType H264_SLICE_TYPE
+    frameNum  uint64
+    pocLsb    uint64
+    pts       int64
+}
+
+var h264TestGop []h264TestPicture = []h264TestPicture{
+    {nalType: 5, refIdc: 3, sliceType: H264_SLICE_I, frameNum: 0, pocLsb: 0, pts: 0},
+    {nalType: 1, refIdc: 2, sliceType: H264_SLICE_P, frameNum: 1, pocLsb: 6, pts: 9000},
+    {nalType: 1, refIdc: 0, sliceType: H264_SLICE_B, frameNum: 2, pocLsb: 2, pts: 3000},
+    {nalType: 1, refIdc: 0, sliceType: H264_SLICE_B, frameNum: 2, pocLsb: 4, pts: 6000},
+    {nalType: 1, refIdc: 2, sliceType: H264_SLICE_P, frameNum: 2, pocLsb: 12, pts: 18000},
+    {nalType: 1, refIdc: 0, sliceType: H264_SLICE_B, frameNum: 3, pocLsb: 8, pts: 12000},
+    {nalType: 1, refIdc: 0, sliceType: H264_SLICE_B, frameNum: 3, pocLsb: 10, pts: 15000},
+}
+
+func TestDecodeH264SliceHeader(t *testing.T) {
+    sps := &SPS{}
+    sps.Decode(NewBitStream(CovertRbspToSodb(h264TestSps[1:])))
+    pps := &PPS{}
+    pps.Decode(NewBitStream(CovertRbspToSodb(h264TestPps[1:])))
+    spss := map[uint64]*SPS{0: sps}
+    ppss := map[uint64]*PPS{0: pps}
+    calc := H264PocCalculator{}
+    for i, pic := range h264TestGop {
+        sh, err := DecodeH264SliceHeader(makeH264TestSlice(pic.nalType, pic.refIdc, pic.sliceType, pic.frameNum, pic.pocLsb), spss, ppss)
+        if err != nil {
+            t.Fatalf("DecodeH264SliceHeader() error = %v", err)
+        }
+        if sh.SliceType() != pic.sliceType || sh.Frame_num != pic.frameNum || sh.Pic_order_cnt_lsb != pic.pocLsb {
+            t.Errorf("picture %d slice header = %+v", i, sh)
+        }
+        if sh.Slice_qp_delta != -2 || sh.Disable_deblocking_filter_idc != 1 {
+            t.Errorf("picture %d slice header = %+v", i, sh)
+        }
+        if pic.sliceType != H264_SLICE_I && (sh.Num_ref_idx_active_override_flag != 1 || sh.Num_ref_idx_l0_active_minus1 != 0) {
+            t.Errorf("picture %d slice header = %+v", i, sh)
+        }
+        if pic.sliceType == H264_SLICE_P && len(sh.PredWeightTable.L0) != 1 {
+            t.Errorf("picture %d pred weight table = %+v", i, sh.PredWeightTable)
+        }
+        if poc := calc.PicOrderCnt(sps, sh); poc != int64(pic.pocLsb) {
+            t.Errorf("picture %d PicOrderCnt() = %d, want %d", i, poc, pic.pocLsb)
+        }
+    }
+    if _, err := DecodeH264SliceHeader(makeH264TestSlice(1, 2, H264_SLICE_P, 1, 2), spss, map[uint64]*PPS{}); err == nil {
+        t.Errorf("DecodeH264SliceHeader() want error without pps")
+    }
+}
+
+func TestH264PocCalculator_PicOrderCnt(t *testing.T) {
+    type picture struct {
+        idr    bool
+        refIdc uint8
+        sh     SliceHeader
+    }
+    tests := []struct {
+        name string
+        sps  SPS
+        pics []picture
+        want []int64
+    }{
+        {name: "type0 wrap", sps: SPS{Pic_order_cnt_type: 0, Log2_max_pic_order_cnt_lsb_minus4: 0},
+            pics: []picture{{idr: true, refIdc: 1, sh: SliceHeader{Pic_order_cnt_lsb: 0}},
+                {refIdc: 1, sh: SliceHeader{Pic_order_cnt_lsb: 8}},
+                {refIdc: 1, sh: SliceHeader{Pic_order_cnt_lsb: 14}},
+                {refIdc: 1, sh: SliceHeader{Pic_order_cnt_lsb: 4}}},
+            want: []int64{0, 8, 14, 20}},
+        {name: "type1", sps: SPS{Pic_order_cnt_type: 1, Num_ref_frames_in_pic_order_cnt_cycle: 1, Offset_for_ref_frame: []int64{2}, Offset_for_non_ref_pic: -1},
+            pics: []picture{{idr: true, refIdc: 1, sh: SliceHeader{Frame_num: 0}},
+                {refIdc: 1, sh: SliceHeader{Frame_num: 1}},
+                {refIdc: 0, sh: SliceHeader{Frame_num: 2}}},
+            want: []int64{0, 2, 1}},
+        {name: "type2 wrap", sps: SPS{Pic_order_cnt_type: 2, Log2_max_frame_num_minus4: 0},
+            pics: []picture{{idr: true, refIdc: 1, sh: SliceHeader{Frame_num: 0}},
+                {refIdc: 1, sh: SliceHeader{Frame_num: 1}},
+                {refIdc: 0, sh: SliceHeader{Frame_num: 2}},
+                {refIdc: 1, sh: SliceHeader{Frame_num: 15}},
+                {refIdc: 1, sh: SliceHeader{Frame_num: 0}}},
+            want: []int64{0, 2, 3, 30, 32}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            calc := H264PocCalculator{}
+            for i, pic := range tt.pics {
+                sh := pic.sh
+                sh.Nal_ref_idc = pic.refIdc
+                sh.Nal_unit_type = uint8(H264_NAL_P_SLICE)
+                if pic.idr {
+                    sh.Nal_unit_type = uint8(H264_NAL_I_SLICE)
+                }
+                if got := calc.PicOrderCnt(&tt.sps, &sh); got != tt.want[i] {
+                    t.Errorf("PicOrderCnt() picture %d = %d, want %d", i, got, tt.want[i])
+                }
+            }
+        })
+    }
+}
+
+func TestH264FrameReorder(t *testing.T) {
+    reorder := NewH264FrameReorder()
+    var ptss, dtss []int64
+    reorder.OnFrame = func(frame []byte, pts, dts int64) {
+        ptss = append(ptss, pts)
+        dtss = append(dtss, dts)
+    }
+    for i, pic := range h264TestGop {
+        frame := []byte{0x00, 0x00, 0x00, 0x01}
+        if i == 0 {
+            frame = append(append(append(append(frame, h264TestSps...), 0x00, 0x00, 0x00, 0x01), h264TestPps...), 0x00, 0x00, 0x00, 0x01)
+        }
+        frame = append(frame, makeH264TestSlice(pic.nalType, pic.refIdc, pic.sliceType, pic.frameNum, pic.pocLsb)...)
+        if err := reorder.Write(frame, pic.pts); err != nil {
+            t.Fatalf("H264FrameReorder.Write() error = %v", err)
+        }
+    }
+    reorder.Flush()
+    wantPts := []int64{0, 9000, 3000, 6000, 18000, 12000, 15000}
+    wantDts := []int64{-6000, -3000, 0, 3000, 6000, 9000, 12000}
+    if !reflect.DeepEqual(ptss, wantPts) || !reflect.DeepEqual(dtss, wantDts) {
+        t.Errorf("H264FrameReorder pts = %v dts = %v, want %v %v", ptss, dtss, wantPts, wantDts)
+    }
+}
+
+func TestFrameReorder(t *testing.T) {
+    tests := []struct {
+        name    string
+        depth   int
+        pts     []int64
+        wantDts []int64
+    }{
+        {name: "no reorder", depth: 0, pts: []int64{0, 40, 80, 120}, wantDts: []int64{0, 40, 80, 120}},
+        {name: "one b frame", depth: 1, pts: []int64{0, 80, 40, 160, 120}, wantDts: []int64{-40, 0, 40, 80, 120}},
+        {name: "depth too small", depth: 0, pts: []int64{0, 80, 40, 120}, wantDts: []int64{0, 80, 81, 120}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var dtss []int64
+            r := NewFrameReorder(tt.depth)
+            r.OnFrame = func(frame []byte, pts, dts int64) {
+                if dts > pts && tt.name != "depth too small" {
+                    t.Errorf("dts %d > pts %d", dts, pts)
+                }
+                dtss = append(dtss, dts)
+            }
+            for _, pts := range tt.pts {
+                r.Write(nil, pts)
+            }
+            r.Flush()
+            if !reflect.DeepEqual(dtss, tt.wantDts) {
+                t.Errorf("FrameReorder dts = %v, want %v", dtss, tt.wantDts)
+            }
+        })
+    }
+}
+
+func TestEncodeH264SPSNalu(t *testing.T) {
+    tests := []struct {
+        name string
+        nalu []byte
+    }{
+        {name: "sps with vui and hrd", nalu: append([]byte{0x67}, sps1...)},
+        {name: "sps without vui", nalu: h264TestSps},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var s SPS
+            s.Decode(NewBitStream(CovertRbspToSodb(tt.nalu[1:])))
+            if got := EncodeH264SPSNalu(&s); !reflect.DeepEqual(got, tt.nalu) {
+                t.Errorf("EncodeH264SPSNalu() = %x, want %x", got, tt.nalu)
+            }
+        })
+    }
+}
+
+func TestEncodeH264SPSNalu_Patch(t *testing.T) {
+    var s SPS
+    s.Decode(NewBitStream(CovertRbspToSodb(h264TestSps[1:])))
+    w, h := GetH264Resolution(append([]byte{0x00, 0x00, 0x00, 0x01}, h264TestSps...))
+    s.Vui_parameters_present_flag = 1
+    s.VuiParameters.AspectRatioInfoPresentFlag = 1
+    s.VuiParameters.AspectRatioIdc = ExtendedSar
+    s.VuiParameters.SarWidth = 4
+    s.VuiParameters.SarHeight = 3
+    s.VuiParameters.VideoSignalTypePresentFlag = 1
+    s.VuiParameters.VideoFormat = 5
+    s.VuiParameters.ColourDescriptionPresentFlag = 1
+    s.VuiParameters.ColourPrimaries = 1
+    s.VuiParameters.TransferCharacteristics = 1
+    s.VuiParameters.MatrixCoefficients = 1
+    s.VuiParameters.TimingInfoPresentFlag = 1
+    s.VuiParameters.NumUnitsInTick = 1
+    s.VuiParameters.TimeScale = 50
+    s.VuiParameters.FixedFrameRateFlag = 1
+    s.VuiParameters.BitstreamRestrictionFlag = 1
+    s.VuiParameters.NumReorderFrames = 2
+    s.VuiParameters.MaxDecFrameBuffering = 4
+
+    nalu := EncodeH264SPSNalu(&s)
+    var got SPS
+    got.Decode(NewBitStream(CovertRbspToSodb(nalu[1:])))
+    if !reflect.DeepEqual(got, s) {
+        t.Errorf("decode patched sps = %+v, want %+v", got, s)
+    }
+    if gw, gh := GetH264Resolution(append([]byte{0x00, 0x00, 0x00, 0x01}, nalu...)); gw != w || gh != h {
+        t.Errorf("GetH264Resolution() = %dx%d, want %dx%d", gw, gh, w, h)
+    }
+    if got.MaxNumReorderFrames() != 2 {
+        t.Errorf("MaxNumReorderFrames() = %d", got.MaxNumReorderFrames())
+    }
+    if _, err := CreateH264AVCCExtradata([][]byte{nalu}, [][]byte{h264TestPps}); err != nil {
+        t.Error(err)
+    }
+}
+
+// x264 high profile的pps, transform_8x8_mode_flag和rbsp_stop_one_bit在同一个字节内
+func TestPPS_Decode_Transform8x8(t *testing.T) {
+    pps := &PPS{}
+    bs := NewBitStream(CovertRbspToSodb([]byte{0xEE, 0x3C, 0xB0}))
+    pps.Decode(bs)
+    if bs.Err() != nil || pps.Entropy_coding_mode_flag != 1 || pps.Transform_8x8_mode_flag != 1 {
+        t.Errorf("PPS.Decode() = %+v", pps)
+    }
+}
+
+func TestCeilLog2(t *testing.T) {
+    tests := []struct {
+        v    uint64
+        want int
+    }{
+        {0, 0}, {1, 0}, {2, 1}, {3, 2}, {4, 2}, {510, 9}, {1 << 63, 63}, {1<<63 + 1, 64}, {^uint64(0), 64},
+    }
+    for _, tt := range tests {
+        if got := ceilLog2(tt.v); got != tt.want {
+            t.Errorf("ceilLog2(%d) = %d, want %d", tt.v, got, tt.want)
+        }
+    }
+}
+
+// 宽高过大的sps会让PicSizeInMapUnits溢出
+func TestSPS_Decode_PicSize(t *testing.T) {
+    var s SPS
+    s.Decode(NewBitStream(CovertRbspToSodb(h264TestSps[1:])))
+    s.Pic_width_in_mbs_minus1 = 1 << 32
+    s.Pic_height_in_map_units_minus1 = 1 << 32
+    bs := NewBitStream(CovertRbspToSodb(EncodeH264SPSNalu(&s)[1:]))
+    var got SPS
+    got.Decode(bs)
+    if !errors.Is(bs.Err(), ErrInvalidData) {
+        t.Errorf("SPS.Decode() error = %v, want ErrInvalidData", bs.Err())
+    }
+}
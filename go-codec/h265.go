@@ -3,6 +3,7 @@ package codec
 import (
     "bytes"
     "errors"
+    "fmt"
 )
 
 // nal_unit_header() {
@@ -58,18 +59,24 @@ type VPSTimeInfo struct {
 }
 
 type ProfileTierLevel struct {
-    General_profile_space              uint8
-    General_tier_flag                  uint8
-    General_profile_idc                uint8
-    General_profile_compatibility_flag uint32
-    General_constraint_indicator_flag  uint64
-    General_level_idc                  uint8
-    Sub_layer_profile_present_flag     [8]uint8
-    Sub_layer_level_present_flag       [8]uint8
+    General_profile_space                uint8
+    General_tier_flag                    uint8
+    General_profile_idc                  uint8
+    General_profile_compatibility_flag   uint32
+    General_constraint_indicator_flag    uint64
+    General_level_idc                    uint8
+    Sub_layer_profile_present_flag       [8]uint8
+    Sub_layer_level_present_flag         [8]uint8
+    Sub_layer_profile_space              [8]uint8
+    Sub_layer_tier_flag                  [8]uint8
+    Sub_layer_profile_idc                [8]uint8
+    Sub_layer_profile_compatibility_flag [8]uint32
+    Sub_layer_constraint_indicator_flag  [8]uint64
+    Sub_layer_level_idc                  [8]uint8
 }
 
 //nalu without startcode
-func (vps *VPS) Decode(nalu []byte) {
+func (vps *VPS) Decode(nalu []byte) error {
     sodb := CovertRbspToSodb(nalu)
     bs := NewBitStream(sodb)
     hdr := H265NaluHdr{}
@@ -96,9 +103,12 @@ func (vps *VPS) Decode(nalu []byte) {
     }
     vps.Vps_max_layer_id = bs.Uint8(6)
     vps.Vps_num_layer_sets_minus1 = bs.ReadUE()
-    vps.Layer_id_included_flag = make([][]uint8, vps.Vps_num_layer_sets_minus1)
+    if vps.Vps_num_layer_sets_minus1 > 1023 {
+        return fmt.Errorf("h265 vps: %w: vps_num_layer_sets_minus1 %d", ErrInvalidData, vps.Vps_num_layer_sets_minus1)
+    }
+    vps.Layer_id_included_flag = make([][]uint8, vps.Vps_num_layer_sets_minus1+1)
     for i := 1; i <= int(vps.Vps_num_layer_sets_minus1); i++ {
-        vps.Layer_id_included_flag[i] = make([]uint8, vps.Vps_max_layer_id)
+        vps.Layer_id_included_flag[i] = make([]uint8, int(vps.Vps_max_layer_id)+1)
         for j := 0; j <= int(vps.Vps_max_layer_id); j++ {
             vps.Layer_id_included_flag[i][j] = bs.Uint8(1)
         }
@@ -107,6 +117,10 @@ func (vps *VPS) Decode(nalu []byte) {
     if vps.Vps_timing_info_present_flag == 1 {
         vps.TimeInfo = ParserVPSTimeinfo(bs)
     }
+    if bs.Err() != nil {
+        return fmt.Errorf("h265 vps: %w", bs.Err())
+    }
+    return nil
 }
 
 //ffmpeg hevc.c
@@ -142,15 +156,49 @@ func Profile_tier_level(profilePresentFlag uint8, maxNumSubLayersMinus1 uint8, b
              * sub_layer_frame_only_constraint_flag[i]        u(1)
              * sub_layer_reserved_zero_44bits[i]              u(44)
              */
-            bs.SkipBits(88)
+            ptl.Sub_layer_profile_space[i] = bs.Uint8(2)
+            ptl.Sub_layer_tier_flag[i] = bs.Uint8(1)
+            ptl.Sub_layer_profile_idc[i] = bs.Uint8(5)
+            ptl.Sub_layer_profile_compatibility_flag[i] = bs.Uint32(32)
+            ptl.Sub_layer_constraint_indicator_flag[i] = bs.GetBits(48)
         }
         if ptl.Sub_layer_level_present_flag[i] == 1 {
-            bs.SkipBits(8)
+            ptl.Sub_layer_level_idc[i] = bs.Uint8(8)
         }
     }
     return ptl
 }
 
+func (ptl *ProfileTierLevel) Encode(profilePresentFlag uint8, maxNumSubLayersMinus1 uint8, bsw *BitStreamWriter) {
+    bsw.PutUint8(ptl.General_profile_space, 2)
+    bsw.PutUint8(ptl.General_tier_flag, 1)
+    bsw.PutUint8(ptl.General_profile_idc, 5)
+    bsw.PutUint32(ptl.General_profile_compatibility_flag, 32)
+    bsw.PutUint64(ptl.General_constraint_indicator_flag, 48)
+    bsw.PutUint8(ptl.General_level_idc, 8)
+    for i := 0; i < int(maxNumSubLayersMinus1); i++ {
+        bsw.PutUint8(ptl.Sub_layer_profile_present_flag[i], 1)
+        bsw.PutUint8(ptl.Sub_layer_level_present_flag[i], 1)
+    }
+    if maxNumSubLayersMinus1 > 0 {
+        for i := maxNumSubLayersMinus1; i < 8; i++ {
+            bsw.PutUint8(0, 2) //reserved_zero_2bits
+        }
+    }
+    for i := 0; i < int(maxNumSubLayersMinus1); i++ {
+        if ptl.Sub_layer_profile_present_flag[i] == 1 {
+            bsw.PutUint8(ptl.Sub_layer_profile_space[i], 2)
+            bsw.PutUint8(ptl.Sub_layer_tier_flag[i], 1)
+            bsw.PutUint8(ptl.Sub_layer_profile_idc[i], 5)
+            bsw.PutUint32(ptl.Sub_layer_profile_compatibility_flag[i], 32)
+            bsw.PutUint64(ptl.Sub_layer_constraint_indicator_flag[i], 48)
+        }
+        if ptl.Sub_layer_level_present_flag[i] == 1 {
+            bsw.PutUint8(ptl.Sub_layer_level_idc[i], 8)
+        }
+    }
+}
+
 func ParserVPSTimeinfo(bs *BitStream) VPSTimeInfo {
     var ti VPSTimeInfo
     ti.Vps_num_units_in_tick = bs.Uint32(32)
@@ -171,29 +219,104 @@ func ParserVPSTimeinfo(bs *BitStream) VPSTimeInfo {
 }
 
 type H265RawSPS struct {
-    Sps_video_parameter_set_id               uint8
-    Sps_max_sub_layers_minus1                uint8
-    Sps_temporal_id_nesting_flag             uint8
-    Ptl                                      ProfileTierLevel
-    Sps_seq_parameter_set_id                 uint64
-    Chroma_format_idc                        uint64
-    Pic_width_in_luma_samples                uint64
-    Pic_height_in_luma_samples               uint64
-    Conformance_window_flag                  uint8
-    Conf_win_left_offset                     uint64
-    Conf_win_right_offset                    uint64
-    Conf_win_top_offset                      uint64
-    Conf_win_bottom_offset                   uint64
-    Bit_depth_luma_minus8                    uint64
-    Bit_depth_chroma_minus8                  uint64
-    Log2_max_pic_order_cnt_lsb_minus4        uint64
-    Sps_sub_layer_ordering_info_present_flag uint8
-    Vui_parameters_present_flag              uint8
-    Vui                                      VUI_Parameters
+    Sps_video_parameter_set_id                   uint8
+    Sps_max_sub_layers_minus1                    uint8
+    Sps_temporal_id_nesting_flag                 uint8
+    Ptl                                          ProfileTierLevel
+    Sps_seq_parameter_set_id                     uint64
+    Chroma_format_idc                            uint64
+    Separate_colour_plane_flag                   uint8
+    Pic_width_in_luma_samples                    uint64
+    Pic_height_in_luma_samples                   uint64
+    Conformance_window_flag                      uint8
+    Conf_win_left_offset                         uint64
+    Conf_win_right_offset                        uint64
+    Conf_win_top_offset                          uint64
+    Conf_win_bottom_offset                       uint64
+    Bit_depth_luma_minus8                        uint64
+    Bit_depth_chroma_minus8                      uint64
+    Log2_max_pic_order_cnt_lsb_minus4            uint64
+    Sps_sub_layer_ordering_info_present_flag     uint8
+    Sps_max_dec_pic_buffering_minus1             [8]uint64
+    Sps_max_num_reorder_pics                     [8]uint64
+    Sps_max_latency_increase_plus1               [8]uint64
+    Log2_min_luma_coding_block_size_minus3       uint64
+    Log2_diff_max_min_luma_coding_block_size     uint64
+    Log2_min_luma_transform_block_size_minus2    uint64
+    Log2_diff_max_min_luma_transform_block_size  uint64
+    Max_transform_hierarchy_depth_inter          uint64
+    Max_transform_hierarchy_depth_intra          uint64
+    Scaling_list_enabled_flag                    uint8
+    Sps_scaling_list_data_present_flag           uint8
+    Scaling_list_data                            H265ScalingListData
+    Amp_enabled_flag                             uint8
+    Sample_adaptive_offset_enabled_flag          uint8
+    Pcm_enabled_flag                             uint8
+    Pcm_sample_bit_depth_luma_minus1             uint8
+    Pcm_sample_bit_depth_chroma_minus1           uint8
+    Log2_min_pcm_luma_coding_block_size_minus3   uint64
+    Log2_diff_max_min_pcm_luma_coding_block_size uint64
+    Pcm_loop_filter_disabled_flag                uint8
+    Num_short_term_ref_pic_sets                  uint64
+    St_ref_pic_sets                              []H265ShortTermRefPicSet
+    Long_term_ref_pics_present_flag              uint8
+    Num_long_term_ref_pics_sps                   uint64
+    Lt_ref_pic_poc_lsb_sps                       []uint64
+    Used_by_curr_pic_lt_sps_flag                 []uint8
+    Sps_temporal_mvp_enabled_flag                uint8
+    Strong_intra_smoothing_enabled_flag          uint8
+    Vui_parameters_present_flag                  uint8
+    Vui                                          VUI_Parameters
+    Sps_extension_present_flag                   uint8
+    Sps_range_extension_flag                     uint8
+    Sps_multilayer_extension_flag                uint8
+    Sps_3d_extension_flag                        uint8
+    Sps_scc_extension_flag                       uint8
+    Sps_extension_4bits                          uint8
+    Range_extension                              H265SpsRangeExtension
+    // multilayer/3d/scc/sps_extension_4bits 对应的扩展数据不解析, 每个元素保存一个bit
+    Sps_extension_data_flag []uint8
+}
+
+// 7.3.2.2.2 Sequence parameter set range extension syntax
+type H265SpsRangeExtension struct {
+    Transform_skip_rotation_enabled_flag    uint8
+    Transform_skip_context_enabled_flag     uint8
+    Implicit_rdpcm_enabled_flag             uint8
+    Explicit_rdpcm_enabled_flag             uint8
+    Extended_precision_processing_flag      uint8
+    Intra_smoothing_disabled_flag           uint8
+    High_precision_offsets_enabled_flag     uint8
+    Persistent_rice_adaptation_enabled_flag uint8
+    Cabac_bypass_alignment_enabled_flag     uint8
+}
+
+func (ext *H265SpsRangeExtension) Decode(bs *BitStream) {
+    ext.Transform_skip_rotation_enabled_flag = bs.GetBit()
+    ext.Transform_skip_context_enabled_flag = bs.GetBit()
+    ext.Implicit_rdpcm_enabled_flag = bs.GetBit()
+    ext.Explicit_rdpcm_enabled_flag = bs.GetBit()
+    ext.Extended_precision_processing_flag = bs.GetBit()
+    ext.Intra_smoothing_disabled_flag = bs.GetBit()
+    ext.High_precision_offsets_enabled_flag = bs.GetBit()
+    ext.Persistent_rice_adaptation_enabled_flag = bs.GetBit()
+    ext.Cabac_bypass_alignment_enabled_flag = bs.GetBit()
+}
+
+func (ext *H265SpsRangeExtension) Encode(bsw *BitStreamWriter) {
+    bsw.PutUint8(ext.Transform_skip_rotation_enabled_flag, 1)
+    bsw.PutUint8(ext.Transform_skip_context_enabled_flag, 1)
+    bsw.PutUint8(ext.Implicit_rdpcm_enabled_flag, 1)
+    bsw.PutUint8(ext.Explicit_rdpcm_enabled_flag, 1)
+    bsw.PutUint8(ext.Extended_precision_processing_flag, 1)
+    bsw.PutUint8(ext.Intra_smoothing_disabled_flag, 1)
+    bsw.PutUint8(ext.High_precision_offsets_enabled_flag, 1)
+    bsw.PutUint8(ext.Persistent_rice_adaptation_enabled_flag, 1)
+    bsw.PutUint8(ext.Cabac_bypass_alignment_enabled_flag, 1)
 }
 
 //nalu without startcode
-func (sps *H265RawSPS) Decode(nalu []byte) {
+func (sps *H265RawSPS) Decode(nalu []byte) error {
     sodb := CovertRbspToSodb(nalu)
     bs := NewBitStream(sodb)
     hdr := H265NaluHdr{}
@@ -205,7 +328,7 @@ func (sps *H265RawSPS) Decode(nalu []byte) {
     sps.Sps_seq_parameter_set_id = bs.ReadUE()
     sps.Chroma_format_idc = bs.ReadUE()
     if sps.Chroma_format_idc == 3 {
-        bs.SkipBits(1)
+        sps.Separate_colour_plane_flag = bs.GetBit()
     }
     sps.Pic_width_in_luma_samples = bs.ReadUE()
     sps.Pic_height_in_luma_samples = bs.ReadUE()
@@ -225,71 +348,245 @@ func (sps *H265RawSPS) Decode(nalu []byte) {
         i = int(sps.Sps_max_sub_layers_minus1)
     }
     for ; i <= int(sps.Sps_max_sub_layers_minus1); i++ {
-        bs.ReadUE()
-        bs.ReadUE()
-        bs.ReadUE()
+        sps.Sps_max_dec_pic_buffering_minus1[i] = bs.ReadUE()
+        sps.Sps_max_num_reorder_pics[i] = bs.ReadUE()
+        sps.Sps_max_latency_increase_plus1[i] = bs.ReadUE()
+    }
+    // sps_sub_layer_ordering_info_present_flag为0时, 低层的值和最高层相同
+    if sps.Sps_sub_layer_ordering_info_present_flag == 0 {
+        for i := 0; i < int(sps.Sps_max_sub_layers_minus1); i++ {
+            sps.Sps_max_dec_pic_buffering_minus1[i] = sps.Sps_max_dec_pic_buffering_minus1[sps.Sps_max_sub_layers_minus1]
+            sps.Sps_max_num_reorder_pics[i] = sps.Sps_max_num_reorder_pics[sps.Sps_max_sub_layers_minus1]
+            sps.Sps_max_latency_increase_plus1[i] = sps.Sps_max_latency_increase_plus1[sps.Sps_max_sub_layers_minus1]
+        }
     }
 
-    bs.ReadUE() // log2_min_luma_coding_block_size_minus3
-    bs.ReadUE() // log2_diff_max_min_luma_coding_block_size
-    bs.ReadUE() // log2_min_transform_block_size_minus2
-    bs.ReadUE() // log2_diff_max_min_transform_block_size
-    bs.ReadUE() // max_transform_hierarchy_depth_inter
-    bs.ReadUE() // max_transform_hierarchy_depth_intra
-    scaling_list_enabled_flag := bs.GetBit()
-    if scaling_list_enabled_flag > 0 {
-        sps_scaling_list_data_present_flag := bs.GetBit()
-        if sps_scaling_list_data_present_flag > 0 {
-            scaling_list_data(bs)
+    sps.Log2_min_luma_coding_block_size_minus3 = bs.ReadUE()
+    sps.Log2_diff_max_min_luma_coding_block_size = bs.ReadUE()
+    // 7.4.3.2.1 MinCbLog2SizeY >= 3, CtbLog2SizeY <= 6
+    if sps.Log2_min_luma_coding_block_size_minus3 > 3 || sps.Log2_diff_max_min_luma_coding_block_size > 3 ||
+        sps.Log2_min_luma_coding_block_size_minus3+sps.Log2_diff_max_min_luma_coding_block_size > 3 {
+        return fmt.Errorf("h265 sps: %w: CtbLog2SizeY %d", ErrInvalidData,
+            sps.Log2_min_luma_coding_block_size_minus3+3+sps.Log2_diff_max_min_luma_coding_block_size)
+    }
+    sps.Log2_min_luma_transform_block_size_minus2 = bs.ReadUE()
+    sps.Log2_diff_max_min_luma_transform_block_size = bs.ReadUE()
+    sps.Max_transform_hierarchy_depth_inter = bs.ReadUE()
+    sps.Max_transform_hierarchy_depth_intra = bs.ReadUE()
+    sps.Scaling_list_enabled_flag = bs.GetBit()
+    if sps.Scaling_list_enabled_flag > 0 {
+        sps.Sps_scaling_list_data_present_flag = bs.GetBit()
+        if sps.Sps_scaling_list_data_present_flag > 0 {
+            sps.Scaling_list_data.Decode(bs)
         }
     }
 
-    bs.SkipBits(1)
-    bs.SkipBits(1)
-    if bs.GetBit() == 1 {
-        bs.GetBits(4)
-        bs.GetBits(4)
-        bs.ReadUE()
-        bs.ReadUE()
-        bs.GetBit()
+    sps.Amp_enabled_flag = bs.GetBit()
+    sps.Sample_adaptive_offset_enabled_flag = bs.GetBit()
+    sps.Pcm_enabled_flag = bs.GetBit()
+    if sps.Pcm_enabled_flag == 1 {
+        sps.Pcm_sample_bit_depth_luma_minus1 = bs.Uint8(4)
+        sps.Pcm_sample_bit_depth_chroma_minus1 = bs.Uint8(4)
+        sps.Log2_min_pcm_luma_coding_block_size_minus3 = bs.ReadUE()
+        sps.Log2_diff_max_min_pcm_luma_coding_block_size = bs.ReadUE()
+        sps.Pcm_loop_filter_disabled_flag = bs.GetBit()
     }
-    num_short_term_ref_pic_sets := bs.ReadUE()
-    if num_short_term_ref_pic_sets > 64 {
-        panic("beyond HEVC_MAX_SHORT_TERM_REF_PIC_SETS")
+    sps.Num_short_term_ref_pic_sets = bs.ReadUE()
+    if sps.Num_short_term_ref_pic_sets > 64 {
+        return fmt.Errorf("h265 sps: %w: beyond HEVC_MAX_SHORT_TERM_REF_PIC_SETS", ErrInvalidData)
     }
-    var num_delta_pocs [64]uint32
-    for i := 0; i < int(num_short_term_ref_pic_sets); i++ {
-        parse_rps(i, num_short_term_ref_pic_sets, num_delta_pocs, bs)
+    sps.St_ref_pic_sets = make([]H265ShortTermRefPicSet, sps.Num_short_term_ref_pic_sets)
+    for i := 0; i < int(sps.Num_short_term_ref_pic_sets); i++ {
+        sps.St_ref_pic_sets[i].Decode(bs, i, sps.St_ref_pic_sets)
     }
-    if bs.GetBit() == 1 {
-        num_long_term_ref_pics_sps := bs.ReadUE()
-        for i := 0; i < int(num_long_term_ref_pics_sps); i++ {
-            length := Min(int(sps.Log2_max_pic_order_cnt_lsb_minus4+4), 16)
-            bs.SkipBits(length)
-            bs.SkipBits(1)
+    sps.Long_term_ref_pics_present_flag = bs.GetBit()
+    if sps.Long_term_ref_pics_present_flag == 1 {
+        sps.Num_long_term_ref_pics_sps = bs.ReadUE()
+        if sps.Num_long_term_ref_pics_sps > 32 {
+            return fmt.Errorf("h265 sps: %w: beyond HEVC_MAX_LONG_TERM_REF_PICS", ErrInvalidData)
+        }
+        sps.Lt_ref_pic_poc_lsb_sps = make([]uint64, sps.Num_long_term_ref_pics_sps)
+        sps.Used_by_curr_pic_lt_sps_flag = make([]uint8, sps.Num_long_term_ref_pics_sps)
+        for i := 0; i < int(sps.Num_long_term_ref_pics_sps); i++ {
+            sps.Lt_ref_pic_poc_lsb_sps[i] = bs.GetBits(int(sps.Log2_max_pic_order_cnt_lsb_minus4 + 4))
+            sps.Used_by_curr_pic_lt_sps_flag[i] = bs.GetBit()
         }
     }
-    bs.SkipBits(1)
-    bs.SkipBits(1)
+    sps.Sps_temporal_mvp_enabled_flag = bs.GetBit()
+    sps.Strong_intra_smoothing_enabled_flag = bs.GetBit()
     sps.Vui_parameters_present_flag = bs.GetBit()
     if sps.Vui_parameters_present_flag == 1 {
         sps.Vui.Decode(bs, sps.Sps_max_sub_layers_minus1)
     }
+    if !bs.MoreRbspData() {
+        if bs.Err() != nil {
+            return fmt.Errorf("h265 sps: %w", bs.Err())
+        }
+        return nil
+    }
+    sps.Sps_extension_present_flag = bs.GetBit()
+    if sps.Sps_extension_present_flag == 1 {
+        sps.Sps_range_extension_flag = bs.GetBit()
+        sps.Sps_multilayer_extension_flag = bs.GetBit()
+        sps.Sps_3d_extension_flag = bs.GetBit()
+        sps.Sps_scc_extension_flag = bs.GetBit()
+        sps.Sps_extension_4bits = bs.Uint8(4)
+    }
+    if sps.Sps_range_extension_flag == 1 {
+        sps.Range_extension.Decode(bs)
+    }
+    for bs.MoreRbspData() {
+        sps.Sps_extension_data_flag = append(sps.Sps_extension_data_flag, bs.GetBit())
+    }
+    if bs.Err() != nil {
+        return fmt.Errorf("h265 sps: %w", bs.Err())
+    }
+    return nil
+}
+
+// 与Decode对应, 返回不带startcode的sps nalu(包含防竞争字节), 可以用于HEVCRecordConfiguration.UpdateSPS
+func (sps *H265RawSPS) Encode() []byte {
+    bsw := NewBitStreamWriter(128)
+    bsw.PutUint8(sps.Sps_video_parameter_set_id, 4)
+    bsw.PutUint8(sps.Sps_max_sub_layers_minus1, 3)
+    bsw.PutUint8(sps.Sps_temporal_id_nesting_flag, 1)
+    sps.Ptl.Encode(1, sps.Sps_max_sub_layers_minus1, bsw)
+    bsw.PutUE(sps.Sps_seq_parameter_set_id)
+    bsw.PutUE(sps.Chroma_format_idc)
+    if sps.Chroma_format_idc == 3 {
+        bsw.PutUint8(sps.Separate_colour_plane_flag, 1)
+    }
+    bsw.PutUE(sps.Pic_width_in_luma_samples)
+    bsw.PutUE(sps.Pic_height_in_luma_samples)
+    bsw.PutUint8(sps.Conformance_window_flag, 1)
+    if sps.Conformance_window_flag == 1 {
+        bsw.PutUE(sps.Conf_win_left_offset)
+        bsw.PutUE(sps.Conf_win_right_offset)
+        bsw.PutUE(sps.Conf_win_top_offset)
+        bsw.PutUE(sps.Conf_win_bottom_offset)
+    }
+    bsw.PutUE(sps.Bit_depth_luma_minus8)
+    bsw.PutUE(sps.Bit_depth_chroma_minus8)
+    bsw.PutUE(sps.Log2_max_pic_order_cnt_lsb_minus4)
+    bsw.PutUint8(sps.Sps_sub_layer_ordering_info_present_flag, 1)
+    i := 0
+    if sps.Sps_sub_layer_ordering_info_present_flag == 0 {
+        i = int(sps.Sps_max_sub_layers_minus1)
+    }
+    for ; i <= int(sps.Sps_max_sub_layers_minus1); i++ {
+        bsw.PutUE(sps.Sps_max_dec_pic_buffering_minus1[i])
+        bsw.PutUE(sps.Sps_max_num_reorder_pics[i])
+        bsw.PutUE(sps.Sps_max_latency_increase_plus1[i])
+    }
+    bsw.PutUE(sps.Log2_min_luma_coding_block_size_minus3)
+    bsw.PutUE(sps.Log2_diff_max_min_luma_coding_block_size)
+    bsw.PutUE(sps.Log2_min_luma_transform_block_size_minus2)
+    bsw.PutUE(sps.Log2_diff_max_min_luma_transform_block_size)
+    bsw.PutUE(sps.Max_transform_hierarchy_depth_inter)
+    bsw.PutUE(sps.Max_transform_hierarchy_depth_intra)
+    bsw.PutUint8(sps.Scaling_list_enabled_flag, 1)
+    if sps.Scaling_list_enabled_flag > 0 {
+        bsw.PutUint8(sps.Sps_scaling_list_data_present_flag, 1)
+        if sps.Sps_scaling_list_data_present_flag > 0 {
+            sps.Scaling_list_data.Encode(bsw)
+        }
+    }
+    bsw.PutUint8(sps.Amp_enabled_flag, 1)
+    bsw.PutUint8(sps.Sample_adaptive_offset_enabled_flag, 1)
+    bsw.PutUint8(sps.Pcm_enabled_flag, 1)
+    if sps.Pcm_enabled_flag == 1 {
+        bsw.PutUint8(sps.Pcm_sample_bit_depth_luma_minus1, 4)
+        bsw.PutUint8(sps.Pcm_sample_bit_depth_chroma_minus1, 4)
+        bsw.PutUE(sps.Log2_min_pcm_luma_coding_block_size_minus3)
+        bsw.PutUE(sps.Log2_diff_max_min_pcm_luma_coding_block_size)
+        bsw.PutUint8(sps.Pcm_loop_filter_disabled_flag, 1)
+    }
+    bsw.PutUE(sps.Num_short_term_ref_pic_sets)
+    for i := 0; i < int(sps.Num_short_term_ref_pic_sets); i++ {
+        sps.St_ref_pic_sets[i].Encode(bsw, i, int(sps.Num_short_term_ref_pic_sets))
+    }
+    bsw.PutUint8(sps.Long_term_ref_pics_present_flag, 1)
+    if sps.Long_term_ref_pics_present_flag == 1 {
+        bsw.PutUE(sps.Num_long_term_ref_pics_sps)
+        for i := 0; i < int(sps.Num_long_term_ref_pics_sps); i++ {
+            bsw.PutUint64(sps.Lt_ref_pic_poc_lsb_sps[i], int(sps.Log2_max_pic_order_cnt_lsb_minus4+4))
+            bsw.PutUint8(sps.Used_by_curr_pic_lt_sps_flag[i], 1)
+        }
+    }
+    bsw.PutUint8(sps.Sps_temporal_mvp_enabled_flag, 1)
+    bsw.PutUint8(sps.Strong_intra_smoothing_enabled_flag, 1)
+    bsw.PutUint8(sps.Vui_parameters_present_flag, 1)
+    if sps.Vui_parameters_present_flag == 1 {
+        sps.Vui.Encode(bsw, sps.Sps_max_sub_layers_minus1)
+    }
+    bsw.PutUint8(sps.Sps_extension_present_flag, 1)
+    if sps.Sps_extension_present_flag == 1 {
+        bsw.PutUint8(sps.Sps_range_extension_flag, 1)
+        bsw.PutUint8(sps.Sps_multilayer_extension_flag, 1)
+        bsw.PutUint8(sps.Sps_3d_extension_flag, 1)
+        bsw.PutUint8(sps.Sps_scc_extension_flag, 1)
+        bsw.PutUint8(sps.Sps_extension_4bits, 4)
+    }
+    if sps.Sps_range_extension_flag == 1 {
+        sps.Range_extension.Encode(bsw)
+    }
+    for _, flag := range sps.Sps_extension_data_flag {
+        bsw.PutUint8(flag, 1)
+    }
+    bsw.PutRbspTrailingBits()
+    return append([]byte{byte(H265_NAL_SPS) << 1, 0x01}, CovertSodbToRbsp(bsw.Bits())...)
+}
+
+// 最高时域层的sps_max_num_reorder_pics
+func (sps *H265RawSPS) MaxNumReorderPics() int {
+    return int(sps.Sps_max_num_reorder_pics[sps.Sps_max_sub_layers_minus1])
+}
+
+func (sps *H265RawSPS) MaxPicOrderCntLsb() uint64 {
+    return 1 << (sps.Log2_max_pic_order_cnt_lsb_minus4 + 4)
+}
+
+// PicSizeInCtbsY
+func (sps *H265RawSPS) PicSizeInCtbsY() uint64 {
+    ctbLog2SizeY := sps.Log2_min_luma_coding_block_size_minus3 + 3 + sps.Log2_diff_max_min_luma_coding_block_size
+    ctbSizeY := uint64(1) << ctbLog2SizeY
+    picWidthInCtbsY := (sps.Pic_width_in_luma_samples + ctbSizeY - 1) / ctbSizeY
+    picHeightInCtbsY := (sps.Pic_height_in_luma_samples + ctbSizeY - 1) / ctbSizeY
+    return picWidthInCtbsY * picHeightInCtbsY
 }
 
 type VUI_Parameters struct {
     Aspect_ratio_info_present_flag          uint8
+    Aspect_ratio_idc                        uint8
+    Sar_width                               uint16
+    Sar_height                              uint16
     Overscan_info_present_flag              uint8
+    Overscan_appropriate_flag               uint8
+    Video_signal_type_present_flag          uint8
+    Video_format                            uint8
+    Video_full_range_flag                   uint8
+    Colour_description_present_flag         uint8
+    Colour_primaries                        uint8
+    Transfer_characteristics                uint8
+    Matrix_coeffs                           uint8
     Chroma_loc_info_present_flag            uint8
+    Chroma_sample_loc_type_top_field        uint64
+    Chroma_sample_loc_type_bottom_field     uint64
     Neutral_chroma_indication_flag          uint8
     Field_seq_flag                          uint8
     Frame_field_info_present_flag           uint8
     Default_display_window_flag             uint8
+    Def_disp_win_left_offset                uint64
+    Def_disp_win_right_offset               uint64
+    Def_disp_win_top_offset                 uint64
+    Def_disp_win_bottom_offset              uint64
     Vui_timing_info_present_flag            uint8
     Vui_num_units_in_tick                   uint32
     Vui_time_scale                          uint32
     Vui_poc_proportional_to_timing_flag     uint8
+    Vui_num_ticks_poc_diff_one_minus1       uint64
     Vui_hrd_parameters_present_flag         uint8
+    Hrd_parameters                          H265HrdParameters
     Bitstream_restriction_flag              uint8
     Tiles_fixed_structure_flag              uint8
     Motion_vectors_over_pic_boundaries_flag uint8
@@ -304,34 +601,41 @@ type VUI_Parameters struct {
 func (vui *VUI_Parameters) Decode(bs *BitStream, max_sub_layers_minus1 uint8) {
     vui.Aspect_ratio_info_present_flag = bs.Uint8(1)
     if vui.Aspect_ratio_info_present_flag == 1 {
-        if bs.Uint8(8) == 255 {
-            bs.SkipBits(32)
+        vui.Aspect_ratio_idc = bs.Uint8(8)
+        if vui.Aspect_ratio_idc == ExtendedSar {
+            vui.Sar_width = bs.Uint16(16)
+            vui.Sar_height = bs.Uint16(16)
         }
     }
     vui.Overscan_info_present_flag = bs.Uint8(1)
     if vui.Overscan_info_present_flag == 1 {
-        bs.SkipBits(1)
+        vui.Overscan_appropriate_flag = bs.GetBit()
     }
-    if bs.GetBit() == 1 {
-        bs.SkipBits(4)
-        if bs.GetBit() == 1 {
-            bs.SkipBits(24)
+    vui.Video_signal_type_present_flag = bs.GetBit()
+    if vui.Video_signal_type_present_flag == 1 {
+        vui.Video_format = bs.Uint8(3)
+        vui.Video_full_range_flag = bs.GetBit()
+        vui.Colour_description_present_flag = bs.GetBit()
+        if vui.Colour_description_present_flag == 1 {
+            vui.Colour_primaries = bs.Uint8(8)
+            vui.Transfer_characteristics = bs.Uint8(8)
+            vui.Matrix_coeffs = bs.Uint8(8)
         }
     }
     vui.Chroma_loc_info_present_flag = bs.GetBit()
     if vui.Chroma_loc_info_present_flag == 1 {
-        bs.ReadUE()
-        bs.ReadUE()
+        vui.Chroma_sample_loc_type_top_field = bs.ReadUE()
+        vui.Chroma_sample_loc_type_bottom_field = bs.ReadUE()
     }
     vui.Neutral_chroma_indication_flag = bs.GetBit()
     vui.Field_seq_flag = bs.GetBit()
     vui.Frame_field_info_present_flag = bs.GetBit()
     vui.Default_display_window_flag = bs.GetBit()
     if vui.Default_display_window_flag == 1 {
-        bs.ReadUE()
-        bs.ReadUE()
-        bs.ReadUE()
-        bs.ReadUE()
+        vui.Def_disp_win_left_offset = bs.ReadUE()
+        vui.Def_disp_win_right_offset = bs.ReadUE()
+        vui.Def_disp_win_top_offset = bs.ReadUE()
+        vui.Def_disp_win_bottom_offset = bs.ReadUE()
     }
     vui.Vui_timing_info_present_flag = bs.GetBit()
     if vui.Vui_timing_info_present_flag == 1 {
@@ -339,11 +643,11 @@ func (vui *VUI_Parameters) Decode(bs *BitStream, max_sub_layers_minus1 uint8) {
         vui.Vui_time_scale = bs.Uint32(32)
         vui.Vui_poc_proportional_to_timing_flag = bs.GetBit()
         if vui.Vui_poc_proportional_to_timing_flag == 1 {
-            bs.ReadUE()
+            vui.Vui_num_ticks_poc_diff_one_minus1 = bs.ReadUE()
         }
         vui.Vui_hrd_parameters_present_flag = bs.GetBit()
         if vui.Vui_hrd_parameters_present_flag == 1 {
-            skip_hrd_parameters(1, uint32(max_sub_layers_minus1), bs)
+            vui.Hrd_parameters.Decode(bs, 1, max_sub_layers_minus1)
         }
     }
     vui.Bitstream_restriction_flag = bs.GetBit()
@@ -359,134 +663,477 @@ func (vui *VUI_Parameters) Decode(bs *BitStream, max_sub_layers_minus1 uint8) {
     }
 }
 
-func skip_hrd_parameters(cprms_present_flag uint8, max_sub_layers_minus1 uint32, bs *BitStream) {
-    nal_hrd_parameters_present_flag := uint8(0)
-    vcl_hrd_parameters_present_flag := uint8(0)
-    sub_pic_hrd_params_present_flag := uint8(0)
-    if cprms_present_flag == 1 {
-        nal_hrd_parameters_present_flag = bs.GetBit()
-        vcl_hrd_parameters_present_flag = bs.GetBit()
+func (vui *VUI_Parameters) Encode(bsw *BitStreamWriter, max_sub_layers_minus1 uint8) {
+    bsw.PutUint8(vui.Aspect_ratio_info_present_flag, 1)
+    if vui.Aspect_ratio_info_present_flag == 1 {
+        bsw.PutUint8(vui.Aspect_ratio_idc, 8)
+        if vui.Aspect_ratio_idc == ExtendedSar {
+            bsw.PutUint16(vui.Sar_width, 16)
+            bsw.PutUint16(vui.Sar_height, 16)
+        }
+    }
+    bsw.PutUint8(vui.Overscan_info_present_flag, 1)
+    if vui.Overscan_info_present_flag == 1 {
+        bsw.PutUint8(vui.Overscan_appropriate_flag, 1)
+    }
+    bsw.PutUint8(vui.Video_signal_type_present_flag, 1)
+    if vui.Video_signal_type_present_flag == 1 {
+        bsw.PutUint8(vui.Video_format, 3)
+        bsw.PutUint8(vui.Video_full_range_flag, 1)
+        bsw.PutUint8(vui.Colour_description_present_flag, 1)
+        if vui.Colour_description_present_flag == 1 {
+            bsw.PutUint8(vui.Colour_primaries, 8)
+            bsw.PutUint8(vui.Transfer_characteristics, 8)
+            bsw.PutUint8(vui.Matrix_coeffs, 8)
+        }
+    }
+    bsw.PutUint8(vui.Chroma_loc_info_present_flag, 1)
+    if vui.Chroma_loc_info_present_flag == 1 {
+        bsw.PutUE(vui.Chroma_sample_loc_type_top_field)
+        bsw.PutUE(vui.Chroma_sample_loc_type_bottom_field)
+    }
+    bsw.PutUint8(vui.Neutral_chroma_indication_flag, 1)
+    bsw.PutUint8(vui.Field_seq_flag, 1)
+    bsw.PutUint8(vui.Frame_field_info_present_flag, 1)
+    bsw.PutUint8(vui.Default_display_window_flag, 1)
+    if vui.Default_display_window_flag == 1 {
+        bsw.PutUE(vui.Def_disp_win_left_offset)
+        bsw.PutUE(vui.Def_disp_win_right_offset)
+        bsw.PutUE(vui.Def_disp_win_top_offset)
+        bsw.PutUE(vui.Def_disp_win_bottom_offset)
+    }
+    bsw.PutUint8(vui.Vui_timing_info_present_flag, 1)
+    if vui.Vui_timing_info_present_flag == 1 {
+        bsw.PutUint32(vui.Vui_num_units_in_tick, 32)
+        bsw.PutUint32(vui.Vui_time_scale, 32)
+        bsw.PutUint8(vui.Vui_poc_proportional_to_timing_flag, 1)
+        if vui.Vui_poc_proportional_to_timing_flag == 1 {
+            bsw.PutUE(vui.Vui_num_ticks_poc_diff_one_minus1)
+        }
+        bsw.PutUint8(vui.Vui_hrd_parameters_present_flag, 1)
+        if vui.Vui_hrd_parameters_present_flag == 1 {
+            vui.Hrd_parameters.Encode(bsw, 1, max_sub_layers_minus1)
+        }
+    }
+    bsw.PutUint8(vui.Bitstream_restriction_flag, 1)
+    if vui.Bitstream_restriction_flag == 1 {
+        bsw.PutUint8(vui.Tiles_fixed_structure_flag, 1)
+        bsw.PutUint8(vui.Motion_vectors_over_pic_boundaries_flag, 1)
+        bsw.PutUint8(vui.Restricted_ref_pic_lists_flag, 1)
+        bsw.PutUE(vui.Min_spatial_segmentation_idc)
+        bsw.PutUE(vui.Max_bytes_per_pic_denom)
+        bsw.PutUE(vui.Max_bits_per_min_cu_denom)
+        bsw.PutUE(vui.Log2_max_mv_length_horizontal)
+        bsw.PutUE(vui.Log2_max_mv_length_vertical)
+    }
+}
 
-        if nal_hrd_parameters_present_flag == 1 || vcl_hrd_parameters_present_flag == 1 {
-            sub_pic_hrd_params_present_flag = bs.GetBit()
+// E.2.2 HRD parameters syntax
+type H265HrdParameters struct {
+    Nal_hrd_parameters_present_flag              uint8
+    Vcl_hrd_parameters_present_flag              uint8
+    Sub_pic_hrd_params_present_flag              uint8
+    Tick_divisor_minus2                          uint8
+    Du_cpb_removal_delay_increment_length_minus1 uint8
+    Sub_pic_cpb_params_in_pic_timing_sei_flag    uint8
+    Dpb_output_delay_du_length_minus1            uint8
+    Bit_rate_scale                               uint8
+    Cpb_size_scale                               uint8
+    Cpb_size_du_scale                            uint8
+    Initial_cpb_removal_delay_length_minus1      uint8
+    Au_cpb_removal_delay_length_minus1           uint8
+    Dpb_output_delay_length_minus1               uint8
+    SubLayers                                    []H265HrdSubLayer
+}
 
-            if sub_pic_hrd_params_present_flag == 1 {
-                /*
-                 * tick_divisor_minus2                          u(8)
-                 * du_cpb_removal_delay_increment_length_minus1 u(5)
-                 * sub_pic_cpb_params_in_pic_timing_sei_flag    u(1)
-                 * dpb_output_delay_du_length_minus1            u(5)
-                 */
-                bs.SkipBits(19)
-            }
+type H265HrdSubLayer struct {
+    Fixed_pic_rate_general_flag     uint8
+    Fixed_pic_rate_within_cvs_flag  uint8
+    Elemental_duration_in_tc_minus1 uint64
+    Low_delay_hrd_flag              uint8
+    Cpb_cnt_minus1                  uint64
+    Nal_hrd_parameters              []H265SubLayerHrdParameters
+    Vcl_hrd_parameters              []H265SubLayerHrdParameters
+}
 
-            bs.SkipBits(8)
+// E.2.3 Sub-layer HRD parameters syntax
+type H265SubLayerHrdParameters struct {
+    Bit_rate_value_minus1    uint64
+    Cpb_size_value_minus1    uint64
+    Cpb_size_du_value_minus1 uint64
+    Bit_rate_du_value_minus1 uint64
+    Cbr_flag                 uint8
+}
 
-            if sub_pic_hrd_params_present_flag == 1 {
-                // cpb_size_du_scale
-                bs.SkipBits(4)
+func (hrd *H265HrdParameters) Decode(bs *BitStream, commonInfPresentFlag uint8, maxNumSubLayersMinus1 uint8) {
+    if commonInfPresentFlag == 1 {
+        hrd.Nal_hrd_parameters_present_flag = bs.GetBit()
+        hrd.Vcl_hrd_parameters_present_flag = bs.GetBit()
+        if hrd.Nal_hrd_parameters_present_flag == 1 || hrd.Vcl_hrd_parameters_present_flag == 1 {
+            hrd.Sub_pic_hrd_params_present_flag = bs.GetBit()
+            if hrd.Sub_pic_hrd_params_present_flag == 1 {
+                hrd.Tick_divisor_minus2 = bs.Uint8(8)
+                hrd.Du_cpb_removal_delay_increment_length_minus1 = bs.Uint8(5)
+                hrd.Sub_pic_cpb_params_in_pic_timing_sei_flag = bs.GetBit()
+                hrd.Dpb_output_delay_du_length_minus1 = bs.Uint8(5)
             }
-
-            /*
-             * initial_cpb_removal_delay_length_minus1 u(5)
-             * au_cpb_removal_delay_length_minus1      u(5)
-             * dpb_output_delay_length_minus1          u(5)
-             */
-            bs.SkipBits(15)
+            hrd.Bit_rate_scale = bs.Uint8(4)
+            hrd.Cpb_size_scale = bs.Uint8(4)
+            if hrd.Sub_pic_hrd_params_present_flag == 1 {
+                hrd.Cpb_size_du_scale = bs.Uint8(4)
+            }
+            hrd.Initial_cpb_removal_delay_length_minus1 = bs.Uint8(5)
+            hrd.Au_cpb_removal_delay_length_minus1 = bs.Uint8(5)
+            hrd.Dpb_output_delay_length_minus1 = bs.Uint8(5)
         }
     }
-    for i := 0; i <= int(max_sub_layers_minus1); i++ {
-        fixed_pic_rate_general_flag := bs.GetBit()
-        fixed_pic_rate_within_cvs_flag := uint8(0)
-        low_delay_hrd_flag := uint8(0)
-        cpb_cnt_minus1 := uint32(0)
-        if fixed_pic_rate_general_flag == 0 {
-            fixed_pic_rate_within_cvs_flag = bs.GetBit()
+    hrd.SubLayers = make([]H265HrdSubLayer, int(maxNumSubLayersMinus1)+1)
+    for i := range hrd.SubLayers {
+        sub := &hrd.SubLayers[i]
+        sub.Fixed_pic_rate_general_flag = bs.GetBit()
+        // fixed_pic_rate_general_flag为1时, fixed_pic_rate_within_cvs_flag推导为1
+        sub.Fixed_pic_rate_within_cvs_flag = 1
+        if sub.Fixed_pic_rate_general_flag == 0 {
+            sub.Fixed_pic_rate_within_cvs_flag = bs.GetBit()
         }
-        if fixed_pic_rate_within_cvs_flag == 1 {
-            bs.ReadUE()
+        if sub.Fixed_pic_rate_within_cvs_flag == 1 {
+            sub.Elemental_duration_in_tc_minus1 = bs.ReadUE()
         } else {
-            low_delay_hrd_flag = bs.GetBit()
+            sub.Low_delay_hrd_flag = bs.GetBit()
         }
-        if low_delay_hrd_flag == 0 {
-            cpb_cnt_minus1 = uint32(bs.ReadUE())
-            if cpb_cnt_minus1 > 31 {
-                panic("cpb_cnt_minus1 > 31")
+        if sub.Low_delay_hrd_flag == 0 {
+            sub.Cpb_cnt_minus1 = bs.ReadUE()
+            if sub.Cpb_cnt_minus1 > 31 {
+                bs.fail(fmt.Errorf("%w: cpb_cnt_minus1 > 31", ErrInvalidData))
+                return
             }
         }
-        skip_sub_layer_hrd_parameters := func() {
-            for i := 0; i < int(cpb_cnt_minus1); i++ {
-                bs.ReadUE()
-                bs.ReadUE()
-                if sub_pic_hrd_params_present_flag == 1 {
-                    bs.ReadUE()
-                    bs.ReadUE()
-                }
-                bs.SkipBits(1)
+        if hrd.Nal_hrd_parameters_present_flag == 1 {
+            sub.Nal_hrd_parameters = hrd.decodeSubLayer(bs, sub.Cpb_cnt_minus1)
+        }
+        if hrd.Vcl_hrd_parameters_present_flag == 1 {
+            sub.Vcl_hrd_parameters = hrd.decodeSubLayer(bs, sub.Cpb_cnt_minus1)
+        }
+    }
+}
+
+func (hrd *H265HrdParameters) decodeSubLayer(bs *BitStream, cpbCntMinus1 uint64) []H265SubLayerHrdParameters {
+    params := make([]H265SubLayerHrdParameters, cpbCntMinus1+1)
+    for i := range params {
+        params[i].Bit_rate_value_minus1 = bs.ReadUE()
+        params[i].Cpb_size_value_minus1 = bs.ReadUE()
+        if hrd.Sub_pic_hrd_params_present_flag == 1 {
+            params[i].Cpb_size_du_value_minus1 = bs.ReadUE()
+            params[i].Bit_rate_du_value_minus1 = bs.ReadUE()
+        }
+        params[i].Cbr_flag = bs.GetBit()
+    }
+    return params
+}
+
+func (hrd *H265HrdParameters) Encode(bsw *BitStreamWriter, commonInfPresentFlag uint8, maxNumSubLayersMinus1 uint8) {
+    if commonInfPresentFlag == 1 {
+        bsw.PutUint8(hrd.Nal_hrd_parameters_present_flag, 1)
+        bsw.PutUint8(hrd.Vcl_hrd_parameters_present_flag, 1)
+        if hrd.Nal_hrd_parameters_present_flag == 1 || hrd.Vcl_hrd_parameters_present_flag == 1 {
+            bsw.PutUint8(hrd.Sub_pic_hrd_params_present_flag, 1)
+            if hrd.Sub_pic_hrd_params_present_flag == 1 {
+                bsw.PutUint8(hrd.Tick_divisor_minus2, 8)
+                bsw.PutUint8(hrd.Du_cpb_removal_delay_increment_length_minus1, 5)
+                bsw.PutUint8(hrd.Sub_pic_cpb_params_in_pic_timing_sei_flag, 1)
+                bsw.PutUint8(hrd.Dpb_output_delay_du_length_minus1, 5)
+            }
+            bsw.PutUint8(hrd.Bit_rate_scale, 4)
+            bsw.PutUint8(hrd.Cpb_size_scale, 4)
+            if hrd.Sub_pic_hrd_params_present_flag == 1 {
+                bsw.PutUint8(hrd.Cpb_size_du_scale, 4)
             }
+            bsw.PutUint8(hrd.Initial_cpb_removal_delay_length_minus1, 5)
+            bsw.PutUint8(hrd.Au_cpb_removal_delay_length_minus1, 5)
+            bsw.PutUint8(hrd.Dpb_output_delay_length_minus1, 5)
+        }
+    }
+    for i := 0; i <= int(maxNumSubLayersMinus1); i++ {
+        sub := &hrd.SubLayers[i]
+        bsw.PutUint8(sub.Fixed_pic_rate_general_flag, 1)
+        if sub.Fixed_pic_rate_general_flag == 0 {
+            bsw.PutUint8(sub.Fixed_pic_rate_within_cvs_flag, 1)
+        }
+        if sub.Fixed_pic_rate_general_flag == 1 || sub.Fixed_pic_rate_within_cvs_flag == 1 {
+            bsw.PutUE(sub.Elemental_duration_in_tc_minus1)
+        } else {
+            bsw.PutUint8(sub.Low_delay_hrd_flag, 1)
         }
-        if nal_hrd_parameters_present_flag == 1 {
-            skip_sub_layer_hrd_parameters()
+        if sub.Low_delay_hrd_flag == 0 {
+            bsw.PutUE(sub.Cpb_cnt_minus1)
         }
-        if vcl_hrd_parameters_present_flag == 1 {
-            skip_sub_layer_hrd_parameters()
+        if hrd.Nal_hrd_parameters_present_flag == 1 {
+            hrd.encodeSubLayer(bsw, sub.Nal_hrd_parameters, sub.Cpb_cnt_minus1)
+        }
+        if hrd.Vcl_hrd_parameters_present_flag == 1 {
+            hrd.encodeSubLayer(bsw, sub.Vcl_hrd_parameters, sub.Cpb_cnt_minus1)
         }
     }
 }
 
-func scaling_list_data(bs *BitStream) {
-    for i := 0; i < 4; i++ {
-        maxj := 6
-        if i == 3 {
-            maxj = 2
+func (hrd *H265HrdParameters) encodeSubLayer(bsw *BitStreamWriter, params []H265SubLayerHrdParameters, cpbCntMinus1 uint64) {
+    for i := 0; i <= int(cpbCntMinus1); i++ {
+        bsw.PutUE(params[i].Bit_rate_value_minus1)
+        bsw.PutUE(params[i].Cpb_size_value_minus1)
+        if hrd.Sub_pic_hrd_params_present_flag == 1 {
+            bsw.PutUE(params[i].Cpb_size_du_value_minus1)
+            bsw.PutUE(params[i].Bit_rate_du_value_minus1)
         }
-        for j := 0; j < maxj; j++ {
-            if bs.GetBit() == 0 {
-                bs.ReadUE()
-            } else {
-                num_coeffs := Min(64, 1<<(4+(i<<1)))
-                if i > 1 {
-                    bs.ReadSE()
-                }
-                for k := 0; k < num_coeffs; k++ {
-                    bs.ReadSE()
-                }
+        bsw.PutUint8(params[i].Cbr_flag, 1)
+    }
+}
+
+// 7.3.4 Scaling list data syntax
+// sizeId == 3 时 matrixId 只有 0 和 3
+type H265ScalingListData struct {
+    Scaling_list_pred_mode_flag       [4][6]uint8
+    Scaling_list_pred_matrix_id_delta [4][6]uint64
+    Scaling_list_dc_coef_minus8       [4][6]int64
+    Scaling_list_delta_coef           [4][6][]int64
+}
+
+func (sld *H265ScalingListData) Decode(bs *BitStream) {
+    for sizeId := 0; sizeId < 4; sizeId++ {
+        for matrixId := 0; matrixId < 6; matrixId += scalingListMatrixStep(sizeId) {
+            sld.Scaling_list_pred_mode_flag[sizeId][matrixId] = bs.GetBit()
+            if sld.Scaling_list_pred_mode_flag[sizeId][matrixId] == 0 {
+                sld.Scaling_list_pred_matrix_id_delta[sizeId][matrixId] = bs.ReadUE()
+                continue
+            }
+            coefNum := Min(64, 1<<(4+(sizeId<<1)))
+            if sizeId > 1 {
+                sld.Scaling_list_dc_coef_minus8[sizeId][matrixId] = bs.ReadSE()
+            }
+            sld.Scaling_list_delta_coef[sizeId][matrixId] = make([]int64, coefNum)
+            for k := 0; k < coefNum; k++ {
+                sld.Scaling_list_delta_coef[sizeId][matrixId][k] = bs.ReadSE()
             }
         }
     }
 }
 
-func parse_rps(rps_idx int, nums_rps uint64, num_delta_pocs [64]uint32, bs *BitStream) {
-    if rps_idx > 0 && bs.GetBit() > 0 {
-        if rps_idx > int(nums_rps) {
-            panic("rps_idx > int(nums_rps)")
+func (sld *H265ScalingListData) Encode(bsw *BitStreamWriter) {
+    for sizeId := 0; sizeId < 4; sizeId++ {
+        for matrixId := 0; matrixId < 6; matrixId += scalingListMatrixStep(sizeId) {
+            bsw.PutUint8(sld.Scaling_list_pred_mode_flag[sizeId][matrixId], 1)
+            if sld.Scaling_list_pred_mode_flag[sizeId][matrixId] == 0 {
+                bsw.PutUE(sld.Scaling_list_pred_matrix_id_delta[sizeId][matrixId])
+                continue
+            }
+            if sizeId > 1 {
+                bsw.PutSE(sld.Scaling_list_dc_coef_minus8[sizeId][matrixId])
+            }
+            for _, coef := range sld.Scaling_list_delta_coef[sizeId][matrixId] {
+                bsw.PutSE(coef)
+            }
         }
-        bs.SkipBits(1)
-        bs.ReadUE()
-        num_delta_pocs[rps_idx] = 0
-        for i := uint32(0); i <= num_delta_pocs[rps_idx-1]; i++ {
-            var use_delta_flag uint8
-            var used_by_curr_pic_flag uint8 = bs.GetBit()
-            if used_by_curr_pic_flag == 0 {
-                use_delta_flag = bs.GetBit()
+    }
+}
+
+func scalingListMatrixStep(sizeId int) int {
+    if sizeId == 3 {
+        return 3
+    }
+    return 1
+}
+
+// 7.3.7 Short-term reference picture set syntax
+// st_ref_pic_set( stRpsIdx ) {
+//     if( stRpsIdx != 0 )
+//         inter_ref_pic_set_prediction_flag                       u(1)
+//     if( inter_ref_pic_set_prediction_flag ) {
+//         if( stRpsIdx = = num_short_term_ref_pic_sets )
+//             delta_idx_minus1                                    ue(v)
+//         delta_rps_sign                                          u(1)
+//         abs_delta_rps_minus1                                    ue(v)
+//         for( j = 0; j <= NumDeltaPocs[ RefRpsIdx ]; j++ ) {
+//             used_by_curr_pic_flag[ j ]                          u(1)
+//             if( !used_by_curr_pic_flag[ j ] )
+//                 use_delta_flag[ j ]                             u(1)
+//         }
+//     } else {
+//         num_negative_pics                                       ue(v)
+//         num_positive_pics                                       ue(v)
+//         for( i = 0; i < num_negative_pics; i++ ) {
+//             delta_poc_s0_minus1[ i ]                            ue(v)
+//             used_by_curr_pic_s0_flag[ i ]                       u(1)
+//         }
+//         for( i = 0; i < num_positive_pics; i++ ) {
+//             delta_poc_s1_minus1[ i ]                            ue(v)
+//             used_by_curr_pic_s1_flag[ i ]                       u(1)
+//         }
+//     }
+// }
+// DeltaPocS0/DeltaPocS1/UsedByCurrPicS0/UsedByCurrPicS1 按照(7-61)(7-62)推导
+type H265ShortTermRefPicSet struct {
+    Inter_ref_pic_set_prediction_flag uint8
+    Delta_idx_minus1                  uint64
+    Delta_rps_sign                    uint8
+    Abs_delta_rps_minus1              uint64
+    Used_by_curr_pic_flag             []uint8
+    Use_delta_flag                    []uint8
+    Num_negative_pics                 uint64
+    Num_positive_pics                 uint64
+    Delta_poc_s0_minus1               []uint64
+    Used_by_curr_pic_s0_flag          []uint8
+    Delta_poc_s1_minus1               []uint64
+    Used_by_curr_pic_s1_flag          []uint8
+    DeltaPocS0                        []int64
+    UsedByCurrPicS0                   []uint8
+    DeltaPocS1                        []int64
+    UsedByCurrPicS1                   []uint8
+}
+
+func (rps *H265ShortTermRefPicSet) NumNegativePics() int {
+    return len(rps.DeltaPocS0)
+}
+
+func (rps *H265ShortTermRefPicSet) NumPositivePics() int {
+    return len(rps.DeltaPocS1)
+}
+
+func (rps *H265ShortTermRefPicSet) NumDeltaPocs() int {
+    return len(rps.DeltaPocS0) + len(rps.DeltaPocS1)
+}
+
+// sps中stRpsIdx < num_short_term_ref_pic_sets, slice header中stRpsIdx == num_short_term_ref_pic_sets
+// rpss为sps中已经解析的st_ref_pic_set
+func (rps *H265ShortTermRefPicSet) Decode(bs *BitStream, stRpsIdx int, rpss []H265ShortTermRefPicSet) {
+    if stRpsIdx != 0 {
+        rps.Inter_ref_pic_set_prediction_flag = bs.GetBit()
+    }
+    if rps.Inter_ref_pic_set_prediction_flag == 0 {
+        rps.Num_negative_pics = bs.ReadUE()
+        rps.Num_positive_pics = bs.ReadUE()
+        if rps.Num_negative_pics+rps.Num_positive_pics > 32 {
+            bs.fail(fmt.Errorf("%w: num_negative_pics + num_positive_pics > 32", ErrInvalidData))
+            return
+        }
+        rps.Delta_poc_s0_minus1 = make([]uint64, rps.Num_negative_pics)
+        rps.Used_by_curr_pic_s0_flag = make([]uint8, rps.Num_negative_pics)
+        rps.DeltaPocS0 = make([]int64, rps.Num_negative_pics)
+        for i := 0; i < int(rps.Num_negative_pics); i++ {
+            rps.Delta_poc_s0_minus1[i] = bs.ReadUE()
+            rps.Used_by_curr_pic_s0_flag[i] = bs.GetBit()
+            prev := int64(0)
+            if i > 0 {
+                prev = rps.DeltaPocS0[i-1]
             }
-            if use_delta_flag > 0 || used_by_curr_pic_flag > 0 {
-                num_delta_pocs[rps_idx]++
+            rps.DeltaPocS0[i] = prev - int64(rps.Delta_poc_s0_minus1[i]+1)
+        }
+        rps.Delta_poc_s1_minus1 = make([]uint64, rps.Num_positive_pics)
+        rps.Used_by_curr_pic_s1_flag = make([]uint8, rps.Num_positive_pics)
+        rps.DeltaPocS1 = make([]int64, rps.Num_positive_pics)
+        for i := 0; i < int(rps.Num_positive_pics); i++ {
+            rps.Delta_poc_s1_minus1[i] = bs.ReadUE()
+            rps.Used_by_curr_pic_s1_flag[i] = bs.GetBit()
+            prev := int64(0)
+            if i > 0 {
+                prev = rps.DeltaPocS1[i-1]
             }
+            rps.DeltaPocS1[i] = prev + int64(rps.Delta_poc_s1_minus1[i]+1)
         }
-    } else {
-        num_negative_pics := bs.ReadUE()
-        num_positive_pics := bs.ReadUE()
-        if (num_negative_pics+num_positive_pics)*2 > uint64(bs.RemainBits()) {
-            panic("(num_negative_pics + num_positive_pics) * 2> uint64(bs.RemainBits())")
+        rps.UsedByCurrPicS0 = rps.Used_by_curr_pic_s0_flag
+        rps.UsedByCurrPicS1 = rps.Used_by_curr_pic_s1_flag
+        return
+    }
+
+    if stRpsIdx == len(rpss) {
+        rps.Delta_idx_minus1 = bs.ReadUE()
+    }
+    if int(rps.Delta_idx_minus1)+1 > stRpsIdx {
+        bs.fail(fmt.Errorf("%w: delta_idx_minus1 out of range", ErrInvalidData))
+        return
+    }
+    ref := &rpss[stRpsIdx-int(rps.Delta_idx_minus1+1)]
+    rps.Delta_rps_sign = bs.GetBit()
+    rps.Abs_delta_rps_minus1 = bs.ReadUE()
+    deltaRps := (1 - 2*int64(rps.Delta_rps_sign)) * int64(rps.Abs_delta_rps_minus1+1)
+    numDeltaPocs := ref.NumDeltaPocs()
+    rps.Used_by_curr_pic_flag = make([]uint8, numDeltaPocs+1)
+    rps.Use_delta_flag = make([]uint8, numDeltaPocs+1)
+    for j := 0; j <= numDeltaPocs; j++ {
+        rps.Used_by_curr_pic_flag[j] = bs.GetBit()
+        rps.Use_delta_flag[j] = 1
+        if rps.Used_by_curr_pic_flag[j] == 0 {
+            rps.Use_delta_flag[j] = bs.GetBit()
+        }
+    }
+
+    numNegative := ref.NumNegativePics()
+    numPositive := ref.NumPositivePics()
+    rps.DeltaPocS0 = rps.DeltaPocS0[:0]
+    rps.DeltaPocS1 = rps.DeltaPocS1[:0]
+    for j := numPositive - 1; j >= 0; j-- {
+        dPoc := ref.DeltaPocS1[j] + deltaRps
+        if dPoc < 0 && rps.Use_delta_flag[numNegative+j] == 1 {
+            rps.DeltaPocS0 = append(rps.DeltaPocS0, dPoc)
+            rps.UsedByCurrPicS0 = append(rps.UsedByCurrPicS0, rps.Used_by_curr_pic_flag[numNegative+j])
+        }
+    }
+    if deltaRps < 0 && rps.Use_delta_flag[numDeltaPocs] == 1 {
+        rps.DeltaPocS0 = append(rps.DeltaPocS0, deltaRps)
+        rps.UsedByCurrPicS0 = append(rps.UsedByCurrPicS0, rps.Used_by_curr_pic_flag[numDeltaPocs])
+    }
+    for j := 0; j < numNegative; j++ {
+        dPoc := ref.DeltaPocS0[j] + deltaRps
+        if dPoc < 0 && rps.Use_delta_flag[j] == 1 {
+            rps.DeltaPocS0 = append(rps.DeltaPocS0, dPoc)
+            rps.UsedByCurrPicS0 = append(rps.UsedByCurrPicS0, rps.Used_by_curr_pic_flag[j])
+        }
+    }
+    for j := numNegative - 1; j >= 0; j-- {
+        dPoc := ref.DeltaPocS0[j] + deltaRps
+        if dPoc > 0 && rps.Use_delta_flag[j] == 1 {
+            rps.DeltaPocS1 = append(rps.DeltaPocS1, dPoc)
+            rps.UsedByCurrPicS1 = append(rps.UsedByCurrPicS1, rps.Used_by_curr_pic_flag[j])
+        }
+    }
+    if deltaRps > 0 && rps.Use_delta_flag[numDeltaPocs] == 1 {
+        rps.DeltaPocS1 = append(rps.DeltaPocS1, deltaRps)
+        rps.UsedByCurrPicS1 = append(rps.UsedByCurrPicS1, rps.Used_by_curr_pic_flag[numDeltaPocs])
+    }
+    for j := 0; j < numPositive; j++ {
+        dPoc := ref.DeltaPocS1[j] + deltaRps
+        if dPoc > 0 && rps.Use_delta_flag[numNegative+j] == 1 {
+            rps.DeltaPocS1 = append(rps.DeltaPocS1, dPoc)
+            rps.UsedByCurrPicS1 = append(rps.UsedByCurrPicS1, rps.Used_by_curr_pic_flag[numNegative+j])
+        }
+    }
+}
+
+// numStRps为sps中的num_short_term_ref_pic_sets
+func (rps *H265ShortTermRefPicSet) Encode(bsw *BitStreamWriter, stRpsIdx int, numStRps int) {
+    if stRpsIdx != 0 {
+        bsw.PutUint8(rps.Inter_ref_pic_set_prediction_flag, 1)
+    }
+    if rps.Inter_ref_pic_set_prediction_flag == 0 {
+        bsw.PutUE(rps.Num_negative_pics)
+        bsw.PutUE(rps.Num_positive_pics)
+        for i := 0; i < int(rps.Num_negative_pics); i++ {
+            bsw.PutUE(rps.Delta_poc_s0_minus1[i])
+            bsw.PutUint8(rps.Used_by_curr_pic_s0_flag[i], 1)
         }
-        for i := 0; i < int(num_negative_pics); i++ {
-            bs.ReadUE()
-            bs.SkipBits(1)
+        for i := 0; i < int(rps.Num_positive_pics); i++ {
+            bsw.PutUE(rps.Delta_poc_s1_minus1[i])
+            bsw.PutUint8(rps.Used_by_curr_pic_s1_flag[i], 1)
         }
-        for i := 0; i < int(num_positive_pics); i++ {
-            bs.ReadUE()
-            bs.SkipBits(1)
+        return
+    }
+    if stRpsIdx == numStRps {
+        bsw.PutUE(rps.Delta_idx_minus1)
+    }
+    bsw.PutUint8(rps.Delta_rps_sign, 1)
+    bsw.PutUE(rps.Abs_delta_rps_minus1)
+    for j := range rps.Used_by_curr_pic_flag {
+        bsw.PutUint8(rps.Used_by_curr_pic_flag[j], 1)
+        if rps.Used_by_curr_pic_flag[j] == 0 {
+            bsw.PutUint8(rps.Use_delta_flag[j], 1)
         }
     }
 }
@@ -517,7 +1164,7 @@ type H265RawPPS struct {
 }
 
 //nalu without startcode
-func (pps *H265RawPPS) Decode(nalu []byte) {
+func (pps *H265RawPPS) Decode(nalu []byte) error {
     sodb := CovertRbspToSodb(nalu)
     bs := NewBitStream(sodb)
     hdr := H265NaluHdr{}
@@ -546,20 +1193,238 @@ func (pps *H265RawPPS) Decode(nalu []byte) {
     pps.Transquant_bypass_enabled_flag = bs.GetBit()
     pps.Tiles_enabled_flag = bs.GetBit()
     pps.Entropy_coding_sync_enabled_flag = bs.GetBit()
+    if bs.Err() != nil {
+        return fmt.Errorf("h265 pps: %w", bs.Err())
+    }
+    return nil
+}
+
+type H265_SLICE_TYPE int
+
+const (
+    H265_SLICE_B H265_SLICE_TYPE = iota
+    H265_SLICE_P
+    H265_SLICE_I
+)
+
+// 7.3.6.1 General slice segment header syntax
+// 只解析到slice_temporal_mvp_enabled_flag, 足够用来计算poc和得到参考图像集
+type H265SliceHeader struct {
+    Nal_unit_type                   uint8
+    Nuh_temporal_id_plus1           uint8
+    First_slice_segment_in_pic_flag uint8
+    No_output_of_prior_pics_flag    uint8
+    Slice_pic_parameter_set_id      uint64
+    Dependent_slice_segment_flag    uint8
+    Slice_segment_address           uint64
+    Slice_type                      uint64
+    Pic_output_flag                 uint8
+    Colour_plane_id                 uint8
+    Slice_pic_order_cnt_lsb         uint64
+    Short_term_ref_pic_set_sps_flag uint8
+    Short_term_ref_pic_set_idx      uint64
+    St_ref_pic_set                  H265ShortTermRefPicSet
+    Num_long_term_sps               uint64
+    Num_long_term_pics              uint64
+    Lt_idx_sps                      []uint64
+    Poc_lsb_lt                      []uint64
+    Used_by_curr_pic_lt_flag        []uint8
+    Delta_poc_msb_present_flag      []uint8
+    Delta_poc_msb_cycle_lt          []uint64
+    Slice_temporal_mvp_enabled_flag uint8
+}
+
+func (sh *H265SliceHeader) SliceType() H265_SLICE_TYPE {
+    return H265_SLICE_TYPE(sh.Slice_type)
+}
+
+func (sh *H265SliceHeader) IsIRAP() bool {
+    return sh.Nal_unit_type >= uint8(H265_NAL_SLICE_BLA_W_LP) && sh.Nal_unit_type <= 23
+}
+
+func (sh *H265SliceHeader) IsIDR() bool {
+    return sh.Nal_unit_type == uint8(H265_NAL_SLICE_IDR_W_RADL) || sh.Nal_unit_type == uint8(H265_NAL_SLICE_IDR_N_LP)
+}
+
+// 当前slice使用的短期参考图像集
+func (sh *H265SliceHeader) ShortTermRefPicSet(sps *H265RawSPS) *H265ShortTermRefPicSet {
+    if sh.Short_term_ref_pic_set_sps_flag == 1 {
+        return &sps.St_ref_pic_sets[sh.Short_term_ref_pic_set_idx]
+    }
+    return &sh.St_ref_pic_set
+}
+
+// bs从nal_unit_header之后开始
+func (sh *H265SliceHeader) Decode(bs *BitStream, hdr H265NaluHdr, sps *H265RawSPS, pps *H265RawPPS) {
+    sh.Nal_unit_type = hdr.Nal_unit_type
+    sh.Nuh_temporal_id_plus1 = hdr.Nuh_temporal_id_plus1
+    sh.First_slice_segment_in_pic_flag = bs.GetBit()
+    if sh.IsIRAP() {
+        sh.No_output_of_prior_pics_flag = bs.GetBit()
+    }
+    sh.Slice_pic_parameter_set_id = bs.ReadUE()
+    if sh.First_slice_segment_in_pic_flag == 0 {
+        if pps.Dependent_slice_segments_enabled_flag == 1 {
+            sh.Dependent_slice_segment_flag = bs.GetBit()
+        }
+        sh.Slice_segment_address = bs.GetBits(ceilLog2(sps.PicSizeInCtbsY()))
+    }
+    if sh.Dependent_slice_segment_flag == 1 {
+        return
+    }
+    bs.SkipBits(int(pps.Num_extra_slice_header_bits))
+    sh.Slice_type = bs.ReadUE()
+    sh.Pic_output_flag = 1
+    if pps.Output_flag_present_flag == 1 {
+        sh.Pic_output_flag = bs.GetBit()
+    }
+    if sps.Separate_colour_plane_flag == 1 {
+        sh.Colour_plane_id = bs.Uint8(2)
+    }
+    if sh.IsIDR() {
+        return
+    }
+    sh.Slice_pic_order_cnt_lsb = bs.GetBits(int(sps.Log2_max_pic_order_cnt_lsb_minus4 + 4))
+    sh.Short_term_ref_pic_set_sps_flag = bs.GetBit()
+    if sh.Short_term_ref_pic_set_sps_flag == 0 {
+        sh.St_ref_pic_set.Decode(bs, int(sps.Num_short_term_ref_pic_sets), sps.St_ref_pic_sets)
+    } else {
+        if sps.Num_short_term_ref_pic_sets == 0 {
+            bs.fail(fmt.Errorf("%w: short_term_ref_pic_set_sps_flag = 1 but num_short_term_ref_pic_sets = 0", ErrInvalidData))
+            return
+        }
+        if sps.Num_short_term_ref_pic_sets > 1 {
+            sh.Short_term_ref_pic_set_idx = bs.GetBits(ceilLog2(sps.Num_short_term_ref_pic_sets))
+        }
+        if sh.Short_term_ref_pic_set_idx >= sps.Num_short_term_ref_pic_sets {
+            bs.fail(fmt.Errorf("%w: short_term_ref_pic_set_idx out of range", ErrInvalidData))
+            return
+        }
+    }
+    if sps.Long_term_ref_pics_present_flag == 1 {
+        if sps.Num_long_term_ref_pics_sps > 0 {
+            sh.Num_long_term_sps = bs.ReadUE()
+        }
+        sh.Num_long_term_pics = bs.ReadUE()
+        num := sh.Num_long_term_sps + sh.Num_long_term_pics
+        if num > 32 {
+            bs.fail(fmt.Errorf("%w: num_long_term_sps + num_long_term_pics > 32", ErrInvalidData))
+            return
+        }
+        sh.Lt_idx_sps = make([]uint64, num)
+        sh.Poc_lsb_lt = make([]uint64, num)
+        sh.Used_by_curr_pic_lt_flag = make([]uint8, num)
+        sh.Delta_poc_msb_present_flag = make([]uint8, num)
+        sh.Delta_poc_msb_cycle_lt = make([]uint64, num)
+        for i := uint64(0); i < num; i++ {
+            if i < sh.Num_long_term_sps {
+                if sps.Num_long_term_ref_pics_sps > 1 {
+                    sh.Lt_idx_sps[i] = bs.GetBits(ceilLog2(sps.Num_long_term_ref_pics_sps))
+                }
+            } else {
+                sh.Poc_lsb_lt[i] = bs.GetBits(int(sps.Log2_max_pic_order_cnt_lsb_minus4 + 4))
+                sh.Used_by_curr_pic_lt_flag[i] = bs.GetBit()
+            }
+            sh.Delta_poc_msb_present_flag[i] = bs.GetBit()
+            if sh.Delta_poc_msb_present_flag[i] == 1 {
+                sh.Delta_poc_msb_cycle_lt[i] = bs.ReadUE()
+            }
+        }
+    }
+    if sps.Sps_temporal_mvp_enabled_flag == 1 {
+        sh.Slice_temporal_mvp_enabled_flag = bs.GetBit()
+    }
+}
+
+// 解析不带startcode的slice segment nalu, spss/ppss以id为key
+func DecodeH265SliceHeader(nalu []byte, spss map[uint64]*H265RawSPS, ppss map[uint64]*H265RawPPS) (*H265SliceHeader, error) {
+    if len(nalu) < 3 {
+        return nil, errors.New("h265 slice nalu too short")
+    }
+    sodb := CovertRbspToSodb(nalu)
+    var hdr H265NaluHdr
+    hdr.Decode(NewBitStream(sodb[:2]))
+    if hdr.Nal_unit_type > uint8(H265_NAL_SLICE_CRA) || (hdr.Nal_unit_type > uint8(H265_NAL_SLICE_RASL_R) && hdr.Nal_unit_type < uint8(H265_NAL_SLICE_BLA_W_LP)) {
+        return nil, errors.New("not h265 slice nalu")
+    }
+    bs := NewBitStream(sodb[2:])
+    bs.SkipBits(1)
+    if hdr.Nal_unit_type >= uint8(H265_NAL_SLICE_BLA_W_LP) {
+        bs.SkipBits(1)
+    }
+    ppsid := bs.ReadUE()
+    if bs.Err() != nil {
+        return nil, fmt.Errorf("h265 slice header: %w", bs.Err())
+    }
+    pps, found := ppss[ppsid]
+    if !found {
+        return nil, errors.New("not found h265 pps")
+    }
+    sps, found := spss[pps.Pps_seq_parameter_set_id]
+    if !found {
+        return nil, errors.New("not found h265 sps")
+    }
+    bs = NewBitStream(sodb[2:])
+    sh := &H265SliceHeader{}
+    sh.Decode(bs, hdr, sps, pps)
+    if bs.Err() != nil {
+        return nil, fmt.Errorf("h265 slice header: %w", bs.Err())
+    }
+    return sh, nil
+}
+
+// 8.3.1 Decoding process for picture order count
+// 按照解码顺序, 每个图像调用一次PicOrderCnt(first_slice_segment_in_pic_flag为1的slice)
+type H265PocCalculator struct {
+    prevPicOrderCntLsb int64
+    prevPicOrderCntMsb int64
+    started            bool
+}
+
+// 码流结束(end of sequence)之后的CRA的NoRaslOutputFlag为1, 需要调用Reset
+func (calc *H265PocCalculator) Reset() {
+    calc.started = false
+}
+
+func (calc *H265PocCalculator) PicOrderCnt(sps *H265RawSPS, sh *H265SliceHeader) int64 {
+    var picOrderCntMsb int64
+    lsb := int64(sh.Slice_pic_order_cnt_lsb)
+    // IDR, BLA以及码流中第一个CRA的NoRaslOutputFlag为1
+    noRaslOutputFlag := sh.IsIDR() || (sh.Nal_unit_type >= uint8(H265_NAL_SLICE_BLA_W_LP) && sh.Nal_unit_type <= uint8(H265_NAL_SLICE_BLA_N_LP)) ||
+        (sh.IsIRAP() && !calc.started)
+    if sh.IsIRAP() && noRaslOutputFlag {
+        picOrderCntMsb = 0
+    } else {
+        maxPicOrderCntLsb := int64(sps.MaxPicOrderCntLsb())
+        if lsb < calc.prevPicOrderCntLsb && calc.prevPicOrderCntLsb-lsb >= maxPicOrderCntLsb/2 {
+            picOrderCntMsb = calc.prevPicOrderCntMsb + maxPicOrderCntLsb
+        } else if lsb > calc.prevPicOrderCntLsb && lsb-calc.prevPicOrderCntLsb > maxPicOrderCntLsb/2 {
+            picOrderCntMsb = calc.prevPicOrderCntMsb - maxPicOrderCntLsb
+        } else {
+            picOrderCntMsb = calc.prevPicOrderCntMsb
+        }
+    }
+    calc.started = true
+    // prevTid0Pic: TemporalId为0, 并且不是RASL,RADL或者SLNR(sub-layer non-reference)的图像
+    isSubLayerNonRef := sh.Nal_unit_type <= 14 && sh.Nal_unit_type%2 == 0
+    isLeading := sh.Nal_unit_type >= uint8(H265_NAL_SLICE_RADL_N) && sh.Nal_unit_type <= uint8(H265_NAL_SLICE_RASL_R)
+    if sh.Nuh_temporal_id_plus1 == 1 && !isSubLayerNonRef && !isLeading {
+        calc.prevPicOrderCntLsb = lsb
+        calc.prevPicOrderCntMsb = picOrderCntMsb
+    }
+    return picOrderCntMsb + lsb
 }
 
 func GetH265Resolution(sps []byte) (width uint32, height uint32) {
-    start, sc := FindStartCode(sps, 0)
     h265sps := H265RawSPS{}
-    h265sps.Decode(sps[start+int(sc):])
+    h265sps.Decode(trimStartCode(sps))
     width = uint32(h265sps.Pic_width_in_luma_samples)
     height = uint32(h265sps.Pic_height_in_luma_samples)
     return
 }
 
 func GetVPSIdWithStartCode(vps []byte) uint8 {
-    start, sc := FindStartCode(vps, 0)
-    return GetVPSId(vps[start+int(sc):])
+    return GetVPSId(trimStartCode(vps))
 }
 
 func GetVPSId(vps []byte) uint8 {
@@ -569,8 +1434,7 @@ func GetVPSId(vps []byte) uint8 {
 }
 
 func GetH265SPSIdWithStartCode(sps []byte) uint64 {
-    start, sc := FindStartCode(sps, 0)
-    return GetH265SPSId(sps[start+int(sc):])
+    return GetH265SPSId(trimStartCode(sps))
 }
 
 func GetH265SPSId(sps []byte) uint64 {
@@ -580,8 +1444,7 @@ func GetH265SPSId(sps []byte) uint64 {
 }
 
 func GetH265PPSIdWithStartCode(pps []byte) uint64 {
-    start, sc := FindStartCode(pps, 0)
-    return GetH265SPSId(pps[start+int(sc):])
+    return GetH265PPSId(trimStartCode(pps))
 }
 
 func GetH265PPSId(pps []byte) uint64 {
@@ -724,7 +1587,7 @@ func (hvcc *HEVCRecordConfiguration) Encode() ([]byte, error) {
     return bsw.Bits(), nil
 }
 
-func (hvcc *HEVCRecordConfiguration) Decode(hevc []byte) {
+func (hvcc *HEVCRecordConfiguration) Decode(hevc []byte) error {
     bs := NewBitStream(hevc)
     hvcc.ConfigurationVersion = bs.Uint8(8)
     hvcc.General_profile_space = bs.Uint8(2)
@@ -763,13 +1626,18 @@ func (hvcc *HEVCRecordConfiguration) Decode(hevc []byte) {
             hvcc.Arrays[i].NalUnits[j].Nalu = bs.GetBytes(int(hvcc.Arrays[i].NalUnits[j].NalUnitLength))
         }
     }
+    if bs.Err() != nil {
+        return fmt.Errorf("hvcc: %w", bs.Err())
+    }
+    return nil
 }
 
 func (hvcc *HEVCRecordConfiguration) UpdateSPS(sps []byte) {
-    start, sc := FindStartCode(sps, 0)
-    sps = sps[start+int(sc):]
+    sps = trimStartCode(sps)
     var rawsps H265RawSPS
-    rawsps.Decode(sps)
+    if rawsps.Decode(sps) != nil {
+        return
+    }
     spsid := rawsps.Sps_seq_parameter_set_id
     var needUpdate bool = false
     i := 0
@@ -833,10 +1701,11 @@ func (hvcc *HEVCRecordConfiguration) UpdateSPS(sps []byte) {
 }
 
 func (hvcc *HEVCRecordConfiguration) UpdatePPS(pps []byte) {
-    start, sc := FindStartCode(pps, 0)
-    pps = pps[start+int(sc):]
+    pps = trimStartCode(pps)
     var rawpps H265RawPPS
-    rawpps.Decode(pps)
+    if rawpps.Decode(pps) != nil {
+        return
+    }
     ppsid := rawpps.Pps_pic_parameter_set_id
     var needUpdate bool = false
     i := 0
@@ -902,10 +1771,11 @@ func (hvcc *HEVCRecordConfiguration) UpdatePPS(pps []byte) {
 }
 
 func (hvcc *HEVCRecordConfiguration) UpdateVPS(vps []byte) {
-    start, sc := FindStartCode(vps, 0)
-    vps = vps[start+int(sc):]
+    vps = trimStartCode(vps)
     var rawvps VPS
-    rawvps.Decode(vps)
+    if rawvps.Decode(vps) != nil {
+        return
+    }
     vpsid := rawvps.Vps_video_parameter_set_id
     var needUpdate bool = false
     i := 0
@@ -2,6 +2,7 @@ package codec
 
 import (
 	"bytes"
+	"errors"
 	"fmt"
 	"reflect"
 	"testing"
@@ -188,3 +189,308 @@ func TestHEVCRecordConfiguration_ToNalus(t *testing.T) {
 		})
 	}
 }
+
+// 根据sps/pps构造slice nalu, 每个slice携带一个只参考前一帧的st_ref_pic_set
+func makeH265TestSlice(nalType uint8, sliceType H265_SLICE_TYPE, pocLsb uint64) []byte {
+	bsw := NewBitStreamWriter(32)
+	bsw.PutUint8(0, 1)
+	bsw.PutUint8(nalType, 6)
+	bsw.PutUint8(0, 6)
+	bsw.PutUint8(1, 3)
+	bsw.PutUint8(1, 1)
+	if nalType >= uint8(H265_NAL_SLICE_BLA_W_LP) {
+		bsw.PutUint8(0, 1)
+	}
+	bsw.PutUE(0)
+	bsw.PutUE(uint64(sliceType))
+	if nalType != uint8(H265_NAL_SLICE_IDR_W_RADL) && nalType != uint8(H265_NAL_SLICE_IDR_N_LP) {
+		bsw.PutUint64(pocLsb, 8)
+		bsw.PutUint8(0, 1)
+		bsw.PutUE(1)
+		bsw.PutUE(0)
+		bsw.PutUE(0)
+		bsw.PutUint8(1, 1)
+		bsw.PutUint8(1, 1)
+	}
+	bsw.PutUint8(1, 1)
+	return bsw.Bits()
+}
+
+type h265TestPicture struct {
+	nalType   uint8
+	sliceType H265_SLICE_TYPE
+	pocLsb    uint64
+	pts       int64
+}
+
+var h265TestGop []h265TestPicture = []h265TestPicture{
+	{nalType: 19, sliceType: H265_SLICE_I, pocLsb: 0, pts: 0},
+	{nalType: 1, sliceType: H265_SLICE_P, pocLsb: 6, pts: 9000},
+	{nalType: 0, sliceType: H265_SLICE_B, pocLsb: 2, pts: 3000},
+	{nalType: 0, sliceType: H265_SLICE_B, pocLsb: 4, pts: 6000},
+	{nalType: 1, sliceType: H265_SLICE_P, pocLsb: 12, pts: 18000},
+	{nalType: 0, sliceType: H265_SLICE_B, pocLsb: 8, pts: 12000},
+	{nalType: 0, sliceType: H265_SLICE_B, pocLsb: 10, pts: 15000},
+}
+
+func TestDecodeH265SliceHeader(t *testing.T) {
+	h265sps := &H265RawSPS{}
+	h265sps.Decode(sps[4:])
+	h265pps := &H265RawPPS{}
+	h265pps.Decode(pps[4:])
+	if h265sps.MaxNumReorderPics() != 2 || h265sps.Sps_temporal_mvp_enabled_flag != 1 || h265sps.PicSizeInCtbsY() != 510 {
+		t.Fatalf("H265RawSPS.Decode() = %+v", h265sps)
+	}
+	spss := map[uint64]*H265RawSPS{0: h265sps}
+	ppss := map[uint64]*H265RawPPS{0: h265pps}
+	calc := H265PocCalculator{}
+	for i, pic := range h265TestGop {
+		sh, err := DecodeH265SliceHeader(makeH265TestSlice(pic.nalType, pic.sliceType, pic.pocLsb), spss, ppss)
+		if err != nil {
+			t.Fatalf("DecodeH265SliceHeader() error = %v", err)
+		}
+		if sh.First_slice_segment_in_pic_flag != 1 || sh.SliceType() != pic.sliceType || sh.Slice_pic_order_cnt_lsb != pic.pocLsb {
+			t.Errorf("picture %d slice header = %+v", i, sh)
+		}
+		if !sh.IsIDR() {
+			rps := sh.ShortTermRefPicSet(h265sps)
+			if !reflect.DeepEqual(rps.DeltaPocS0, []int64{-1}) || rps.NumPositivePics() != 0 || sh.Slice_temporal_mvp_enabled_flag != 1 {
+				t.Errorf("picture %d slice header = %+v", i, sh)
+			}
+		}
+		if poc := calc.PicOrderCnt(h265sps, sh); poc != int64(pic.pocLsb) {
+			t.Errorf("picture %d PicOrderCnt() = %d, want %d", i, poc, pic.pocLsb)
+		}
+	}
+	if _, err := DecodeH265SliceHeader(makeH265TestSlice(1, H265_SLICE_P, 2), map[uint64]*H265RawSPS{}, ppss); err == nil {
+		t.Errorf("DecodeH265SliceHeader() want error without sps")
+	}
+}
+
+func TestH265ShortTermRefPicSet_Decode(t *testing.T) {
+	bsw := NewBitStreamWriter(16)
+	// st_ref_pic_set(0): -1 -3 / +2
+	bsw.PutUE(2)
+	bsw.PutUE(1)
+	bsw.PutUE(0)
+	bsw.PutUint8(1, 1)
+	bsw.PutUE(1)
+	bsw.PutUint8(1, 1)
+	bsw.PutUE(1)
+	bsw.PutUint8(1, 1)
+	// st_ref_pic_set(1): 从st_ref_pic_set(0)预测, deltaRps = -1
+	bsw.PutUint8(1, 1)
+	bsw.PutUint8(1, 1)
+	bsw.PutUE(0)
+	for j := 0; j < 4; j++ {
+		bsw.PutUint8(1, 1)
+	}
+	bsw.PutUint8(1, 8)
+	bs := NewBitStream(bsw.Bits())
+	rpss := make([]H265ShortTermRefPicSet, 2)
+	rpss[0].Decode(bs, 0, rpss)
+	rpss[1].Decode(bs, 1, rpss)
+	if !reflect.DeepEqual(rpss[0].DeltaPocS0, []int64{-1, -3}) || !reflect.DeepEqual(rpss[0].DeltaPocS1, []int64{2}) {
+		t.Errorf("st_ref_pic_set(0) = %+v", rpss[0])
+	}
+	if !reflect.DeepEqual(rpss[1].DeltaPocS0, []int64{-1, -2, -4}) || !reflect.DeepEqual(rpss[1].DeltaPocS1, []int64{1}) {
+		t.Errorf("st_ref_pic_set(1) = %+v", rpss[1])
+	}
+}
+
+func TestH265PocCalculator_PicOrderCnt(t *testing.T) {
+	h265sps := &H265RawSPS{Log2_max_pic_order_cnt_lsb_minus4: 0}
+	pics := []struct {
+		nalType uint8
+		lsb     uint64
+		want    int64
+	}{
+		{nalType: 19, lsb: 0, want: 0},
+		{nalType: 1, lsb: 8, want: 8},
+		{nalType: 0, lsb: 14, want: 14},
+		{nalType: 1, lsb: 4, want: 4},
+		{nalType: 1, lsb: 12, want: 12},
+		{nalType: 1, lsb: 2, want: 18},
+		{nalType: 21, lsb: 6, want: 22},
+	}
+	calc := H265PocCalculator{}
+	for i, pic := range pics {
+		sh := &H265SliceHeader{Nal_unit_type: pic.nalType, Nuh_temporal_id_plus1: 1, Slice_pic_order_cnt_lsb: pic.lsb}
+		if got := calc.PicOrderCnt(h265sps, sh); got != pic.want {
+			t.Errorf("PicOrderCnt() picture %d = %d, want %d", i, got, pic.want)
+		}
+	}
+}
+
+func TestH265FrameReorder(t *testing.T) {
+	reorder := NewH265FrameReorder()
+	var ptss, dtss []int64
+	reorder.OnFrame = func(frame []byte, pts, dts int64) {
+		ptss = append(ptss, pts)
+		dtss = append(dtss, dts)
+	}
+	for i, pic := range h265TestGop {
+		var frame []byte
+		if i == 0 {
+			frame = append(append(frame, sps...), pps...)
+		}
+		frame = append(frame, 0x00, 0x00, 0x00, 0x01)
+		frame = append(frame, makeH265TestSlice(pic.nalType, pic.sliceType, pic.pocLsb)...)
+		if err := reorder.Write(frame, pic.pts); err != nil {
+			t.Fatalf("H265FrameReorder.Write() error = %v", err)
+		}
+	}
+	reorder.Flush()
+	wantPts := []int64{0, 9000, 3000, 6000, 18000, 12000, 15000}
+	wantDts := []int64{-6000, -3000, 0, 3000, 6000, 9000, 12000}
+	if !reflect.DeepEqual(ptss, wantPts) || !reflect.DeepEqual(dtss, wantDts) {
+		t.Errorf("H265FrameReorder pts = %v dts = %v, want %v %v", ptss, dtss, wantPts, wantDts)
+	}
+}
+
+func TestH265RawSPS_Encode(t *testing.T) {
+	tests := []struct {
+		name string
+		nalu []byte
+	}{
+		{name: "sps", nalu: sps},
+		{name: "sps2", nalu: h265sps2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			start, sc := FindStartCode(tt.nalu, 0)
+			nalu := tt.nalu[start+int(sc):]
+			rawsps := H265RawSPS{}
+			rawsps.Decode(nalu)
+			if got := rawsps.Encode(); !bytes.Equal(got, nalu) {
+				t.Errorf("H265RawSPS.Encode() = %x, want %x", got, nalu)
+			}
+		})
+	}
+}
+
+func TestH265RawSPS_Encode_Patch(t *testing.T) {
+	start, sc := FindStartCode(sps, 0)
+	rawsps := H265RawSPS{}
+	rawsps.Decode(sps[start+int(sc):])
+	w, h := GetH265Resolution(sps)
+
+	rawsps.Scaling_list_enabled_flag = 1
+	rawsps.Sps_scaling_list_data_present_flag = 1
+	for sizeId := 0; sizeId < 4; sizeId++ {
+		for matrixId := 0; matrixId < 6; matrixId += scalingListMatrixStep(sizeId) {
+			if matrixId%2 == 1 {
+				rawsps.Scaling_list_data.Scaling_list_pred_matrix_id_delta[sizeId][matrixId] = 1
+				continue
+			}
+			rawsps.Scaling_list_data.Scaling_list_pred_mode_flag[sizeId][matrixId] = 1
+			if sizeId > 1 {
+				rawsps.Scaling_list_data.Scaling_list_dc_coef_minus8[sizeId][matrixId] = -3
+			}
+			rawsps.Scaling_list_data.Scaling_list_delta_coef[sizeId][matrixId] = make([]int64, Min(64, 1<<(4+(sizeId<<1))))
+			rawsps.Scaling_list_data.Scaling_list_delta_coef[sizeId][matrixId][0] = 8
+		}
+	}
+	rawsps.Vui_parameters_present_flag = 1
+	rawsps.Vui.Video_signal_type_present_flag = 1
+	rawsps.Vui.Video_format = 5
+	rawsps.Vui.Colour_description_present_flag = 1
+	rawsps.Vui.Colour_primaries = 9
+	rawsps.Vui.Transfer_characteristics = 16
+	rawsps.Vui.Matrix_coeffs = 9
+	rawsps.Vui.Vui_timing_info_present_flag = 1
+	rawsps.Vui.Vui_num_units_in_tick = 1001
+	rawsps.Vui.Vui_time_scale = 60000
+	rawsps.Vui.Vui_hrd_parameters_present_flag = 1
+	rawsps.Vui.Hrd_parameters = H265HrdParameters{
+		Nal_hrd_parameters_present_flag: 1,
+		Bit_rate_scale:                  2,
+		Cpb_size_scale:                  3,
+		Dpb_output_delay_length_minus1:  23,
+		SubLayers: []H265HrdSubLayer{{
+			Fixed_pic_rate_general_flag:    1,
+			Fixed_pic_rate_within_cvs_flag: 1,
+			Cpb_cnt_minus1:                 1,
+			Nal_hrd_parameters:             []H265SubLayerHrdParameters{{Bit_rate_value_minus1: 100, Cpb_size_value_minus1: 200}, {Cbr_flag: 1}},
+		}},
+	}
+	rawsps.Sps_extension_present_flag = 1
+	rawsps.Sps_range_extension_flag = 1
+	rawsps.Range_extension.Implicit_rdpcm_enabled_flag = 1
+
+	nalu := rawsps.Encode()
+	got := H265RawSPS{}
+	got.Decode(nalu)
+	if !reflect.DeepEqual(got, rawsps) {
+		t.Errorf("decode patched sps = %+v, want %+v", got, rawsps)
+	}
+	if gw, gh := GetH265Resolution(append([]byte{0x00, 0x00, 0x00, 0x01}, nalu...)); gw != w || gh != h {
+		t.Errorf("GetH265Resolution() = %dx%d, want %dx%d", gw, gh, w, h)
+	}
+	hvcc := NewHEVCRecordConfiguration()
+	hvcc.UpdateSPS(nalu)
+	if _, err := hvcc.Encode(); err == nil {
+		t.Errorf("hvcc without vps/pps should fail to encode")
+	}
+}
+
+func TestH265RawSPS_Decode_Truncated(t *testing.T) {
+	start, sc := FindStartCode(sps, 0)
+	nalu := sps[start+int(sc):]
+	for n := 0; n < len(nalu); n++ {
+		rawsps := H265RawSPS{}
+		err := rawsps.Decode(nalu[:n])
+		if n < 16 && !errors.Is(err, ErrTruncated) {
+			t.Errorf("Decode(nalu[:%d]) = %v, want ErrTruncated", n, err)
+		}
+	}
+	rawsps := H265RawSPS{}
+	if err := rawsps.Decode(nalu); err != nil {
+		t.Errorf("Decode() = %v", err)
+	}
+	hvcc := NewHEVCRecordConfiguration()
+	if err := hvcc.Decode([]byte{0x01, 0x01, 0x60}); !errors.Is(err, ErrTruncated) {
+		t.Errorf("HEVCRecordConfiguration.Decode() = %v, want ErrTruncated", err)
+	}
+}
+
+// sps extension和rbsp_stop_one_bit在同一个字节内
+func TestH265RawSPS_Decode_Extension(t *testing.T) {
+	start, sc := FindStartCode(sps, 0)
+	for n := 0; n < 9; n++ {
+		rawsps := H265RawSPS{}
+		if err := rawsps.Decode(sps[start+int(sc):]); err != nil {
+			t.Fatal(err)
+		}
+		rawsps.Sps_extension_present_flag = 1
+		rawsps.Sps_extension_4bits = 0x01
+		rawsps.Sps_extension_data_flag = nil
+		for i := 0; i < n; i++ {
+			rawsps.Sps_extension_data_flag = append(rawsps.Sps_extension_data_flag, uint8(i%2))
+		}
+		got := H265RawSPS{}
+		if err := got.Decode(rawsps.Encode()); err != nil {
+			t.Fatal(err)
+		}
+		if got.Sps_extension_present_flag != 1 || got.Sps_extension_4bits != 0x01 || !bytes.Equal(got.Sps_extension_data_flag, rawsps.Sps_extension_data_flag) {
+			t.Errorf("%d extension data flags: got %+v", n, got)
+		}
+	}
+}
+
+// CtbLog2SizeY >= 64时1<<CtbLog2SizeY为0, 解析slice header会除0
+func TestH265RawSPS_Decode_CtbSize(t *testing.T) {
+	start, sc := FindStartCode(sps, 0)
+	for _, tt := range []struct{ minus3, diff uint64 }{{0, 61}, {0, 4}, {4, 0}, {2, 2}} {
+		rawsps := H265RawSPS{}
+		if err := rawsps.Decode(sps[start+int(sc):]); err != nil {
+			t.Fatal(err)
+		}
+		rawsps.Log2_min_luma_coding_block_size_minus3 = tt.minus3
+		rawsps.Log2_diff_max_min_luma_coding_block_size = tt.diff
+		hostile := rawsps.Encode()
+		if err := (&H265RawSPS{}).Decode(hostile); !errors.Is(err, ErrInvalidData) {
+			t.Errorf("Decode(CtbLog2SizeY %d) = %v, want ErrInvalidData", tt.minus3+3+tt.diff, err)
+		}
+	}
+}
@@ -0,0 +1,529 @@
+package codec
+
+import (
+    "bytes"
+    "compress/zlib"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+    "io/ioutil"
+    "strings"
+    "unicode/utf16"
+)
+
+// https://id3.org/id3v2.4.0-structure
+// ID3v2 tag
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+// | Header(10 bytes) | Extended Header(可选) | Frames | Padding(可选) | Footer(可选, 仅v2.4) |
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+
+// Header flags
+// v2.2: a(Unsynchronisation) b(Compression)
+// v2.3: a(Unsynchronisation) b(Extended header) c(Experimental indicator)
+// v2.4: a(Unsynchronisation) b(Extended header) c(Experimental indicator) d(Footer present)
+
+// Frame header
+// v2.2: Frame ID(3 bytes) Size(3 bytes)
+// v2.3: Frame ID(4 bytes) Size(4 bytes) Flags(2 bytes)
+// v2.4: Frame ID(4 bytes) Size(4 bytes, synchsafe integer) Flags(2 bytes)
+
+const (
+    ID3V2_FLAG_UNSYNCHRONISATION = 0x80
+    ID3V2_FLAG_EXTENDED_HEADER   = 0x40
+    ID3V2_FLAG_COMPRESSION       = 0x40 //v2.2
+    ID3V2_FLAG_EXPERIMENTAL      = 0x20
+    ID3V2_FLAG_FOOTER            = 0x10
+)
+
+// v2.3 frame format flags
+const (
+    ID3V23_FRAME_COMPRESSION = 0x0080
+    ID3V23_FRAME_ENCRYPTION  = 0x0040
+    ID3V23_FRAME_GROUPING    = 0x0020
+)
+
+// v2.4 frame format flags
+const (
+    ID3V24_FRAME_GROUPING              = 0x0040
+    ID3V24_FRAME_COMPRESSION           = 0x0008
+    ID3V24_FRAME_ENCRYPTION            = 0x0004
+    ID3V24_FRAME_UNSYNCHRONISATION     = 0x0002
+    ID3V24_FRAME_DATA_LENGTH_INDICATOR = 0x0001
+)
+
+const (
+    ID3_ENCODING_ISO_8859_1 = 0
+    ID3_ENCODING_UTF16      = 1
+    ID3_ENCODING_UTF16BE    = 2
+    ID3_ENCODING_UTF8       = 3
+)
+
+const (
+    ID3V2_HEADER_SIZE = 10
+    ID3V1_SIZE        = 128
+)
+
+var errID3V2NotFound = errors.New("ID3V2 tag must start with 'ID3'")
+var errID3V2Truncated = errors.New("ID3V2 tag is truncated")
+
+// v2.2的帧ID映射到v2.3/v2.4
+var id3v22FrameIds map[string]string = map[string]string{
+    "TT2": "TIT2", "TP1": "TPE1", "TP2": "TPE2", "TAL": "TALB", "TYE": "TYER",
+    "TRK": "TRCK", "TPA": "TPOS", "TCO": "TCON", "TCM": "TCOM", "TEN": "TENC",
+    "COM": "COMM", "PIC": "APIC", "TXX": "TXXX", "ULT": "USLT",
+}
+
+type ID3V2Frame struct {
+    Id    string
+    Flags uint16
+    Data  []byte //已经去除unsynchronisation/解压, 加密的帧保持原样
+}
+
+func (frame *ID3V2Frame) IsEncrypted(ver uint8) bool {
+    if ver == 3 {
+        return frame.Flags&ID3V23_FRAME_ENCRYPTION > 0
+    } else if ver == 4 {
+        return frame.Flags&ID3V24_FRAME_ENCRYPTION > 0
+    }
+    return false
+}
+
+type ID3Picture struct {
+    MimeType    string
+    PictureType uint8
+    Description string
+    Data        []byte
+}
+
+func decodeSynchsafe(data []byte) uint32 {
+    var v uint32
+    for _, b := range data {
+        v = v<<7 | uint32(b&0x7F)
+    }
+    return v
+}
+
+// 去除 0xFF 0x00 中的 0x00
+func RemoveID3Unsynchronisation(data []byte) []byte {
+    if bytes.Index(data, []byte{0xFF, 0x00}) < 0 {
+        return data
+    }
+    out := make([]byte, 0, len(data))
+    for i := 0; i < len(data); i++ {
+        out = append(out, data[i])
+        if data[i] == 0xFF && i+1 < len(data) && data[i+1] == 0x00 {
+            i++
+        }
+    }
+    return out
+}
+
+func DecodeID3V2Head(data []byte) (*ID3V2, error) {
+    if len(data) < ID3V2_HEADER_SIZE {
+        return nil, errors.New("ID3V2 tag head must has 10 bytes")
+    }
+    if !bytes.HasPrefix(data, []byte{'I', 'D', '3'}) {
+        return nil, errID3V2NotFound
+    }
+    if data[3] == 0xFF || data[4] == 0xFF || data[6]&0x80 > 0 || data[7]&0x80 > 0 || data[8]&0x80 > 0 || data[9]&0x80 > 0 {
+        return nil, errors.New("invalid ID3V2 tag head")
+    }
+    return &ID3V2{
+        Ver:      data[3],
+        Revision: data[4],
+        Flag:     data[5],
+        Size:     decodeSynchsafe(data[6:10]),
+    }, nil
+}
+
+// TotalSize 整个tag的大小, 包括header和footer
+func (tag *ID3V2) TotalSize() int {
+    size := ID3V2_HEADER_SIZE + int(tag.Size)
+    if tag.Ver == 4 && tag.Flag&ID3V2_FLAG_FOOTER > 0 {
+        size += ID3V2_HEADER_SIZE
+    }
+    return size
+}
+
+func DecodeID3V2(data []byte) (tag *ID3V2, err error) {
+    if tag, err = DecodeID3V2Head(data); err != nil {
+        return nil, err
+    }
+    if tag.Ver < 2 || tag.Ver > 4 {
+        return nil, errors.New("unsupported ID3V2 version")
+    }
+    if len(data) < ID3V2_HEADER_SIZE+int(tag.Size) {
+        return nil, errID3V2Truncated
+    }
+    body := data[ID3V2_HEADER_SIZE : ID3V2_HEADER_SIZE+int(tag.Size)]
+    if tag.Ver < 4 && tag.Flag&ID3V2_FLAG_UNSYNCHRONISATION > 0 {
+        body = RemoveID3Unsynchronisation(body)
+    }
+    if tag.Ver == 2 && tag.Flag&ID3V2_FLAG_COMPRESSION > 0 {
+        return tag, errors.New("ID3V2.2 compression is not supported")
+    }
+
+    if tag.Ver > 2 && tag.Flag&ID3V2_FLAG_EXTENDED_HEADER > 0 {
+        if len(body) < 4 {
+            return nil, errID3V2Truncated
+        }
+        var extSize int
+        if tag.Ver == 3 {
+            //v2.3 不包括size本身
+            extSize = int(uint32(body[0])<<24|uint32(body[1])<<16|uint32(body[2])<<8|uint32(body[3])) + 4
+        } else {
+            extSize = int(decodeSynchsafe(body[0:4]))
+        }
+        if extSize < 4 || extSize > len(body) {
+            return nil, errors.New("invalid ID3V2 extended header size")
+        }
+        tag.Extended_header = body[4:extSize]
+        body = body[extSize:]
+    }
+
+    idLen, headLen := 4, 10
+    if tag.Ver == 2 {
+        idLen, headLen = 3, 6
+    }
+    for len(body) >= headLen {
+        if !isID3FrameId(body[:idLen]) {
+            //padding
+            break
+        }
+        frame := ID3V2Frame{Id: string(body[:idLen])}
+        var size int
+        switch tag.Ver {
+        case 2:
+            size = int(body[3])<<16 | int(body[4])<<8 | int(body[5])
+        case 3:
+            size = int(uint32(body[4])<<24 | uint32(body[5])<<16 | uint32(body[6])<<8 | uint32(body[7]))
+        case 4:
+            size = int(decodeSynchsafe(body[4:8]))
+        }
+        if tag.Ver > 2 {
+            frame.Flags = uint16(body[8])<<8 | uint16(body[9])
+        }
+        if size > len(body)-headLen {
+            return nil, errors.New("ID3V2 frame " + frame.Id + " is truncated")
+        }
+        frame.Data = body[headLen : headLen+size]
+        body = body[headLen+size:]
+        if frame.Data, err = tag.decodeFrameData(&frame); err != nil {
+            return nil, err
+        }
+        tag.Frames = append(tag.Frames, frame)
+    }
+    return tag, nil
+}
+
+func isID3FrameId(id []byte) bool {
+    for _, c := range id {
+        if !(c >= 'A' && c <= 'Z') && !(c >= '0' && c <= '9') {
+            return false
+        }
+    }
+    return true
+}
+
+func (tag *ID3V2) decodeFrameData(frame *ID3V2Frame) ([]byte, error) {
+    data := frame.Data
+    compressed, encrypted := false, false
+    dataLen := -1 //data length indicator, 解压后的长度
+    skip := func(n int) error {
+        if len(data) < n {
+            return errors.New("ID3V2 frame " + frame.Id + " is truncated")
+        }
+        data = data[n:]
+        return nil
+    }
+    switch tag.Ver {
+    case 3:
+        if frame.Flags&ID3V23_FRAME_COMPRESSION > 0 {
+            compressed = true
+            if err := skip(4); err != nil {
+                return nil, err
+            }
+            dataLen = int(binary.BigEndian.Uint32(frame.Data))
+        }
+        if frame.Flags&ID3V23_FRAME_ENCRYPTION > 0 {
+            encrypted = true
+            if err := skip(1); err != nil {
+                return nil, err
+            }
+        }
+        if frame.Flags&ID3V23_FRAME_GROUPING > 0 {
+            if err := skip(1); err != nil {
+                return nil, err
+            }
+        }
+    case 4:
+        if frame.Flags&ID3V24_FRAME_GROUPING > 0 {
+            if err := skip(1); err != nil {
+                return nil, err
+            }
+        }
+        if frame.Flags&ID3V24_FRAME_ENCRYPTION > 0 {
+            encrypted = true
+            if err := skip(1); err != nil {
+                return nil, err
+            }
+        }
+        if frame.Flags&ID3V24_FRAME_DATA_LENGTH_INDICATOR > 0 {
+            dli := data
+            if err := skip(4); err != nil {
+                return nil, err
+            }
+            dataLen = int(decodeSynchsafe(dli[:4]))
+        }
+        if frame.Flags&ID3V24_FRAME_UNSYNCHRONISATION > 0 || tag.Flag&ID3V2_FLAG_UNSYNCHRONISATION > 0 {
+            data = RemoveID3Unsynchronisation(data)
+        }
+        compressed = frame.Flags&ID3V24_FRAME_COMPRESSION > 0
+    }
+    if compressed && !encrypted {
+        //解压后的长度必须和data length indicator一致, 避免zlib炸弹
+        if dataLen < 0 {
+            return nil, fmt.Errorf("ID3V2 frame %s: %w: compressed frame without data length indicator", frame.Id, ErrInvalidData)
+        }
+        r, err := zlib.NewReader(bytes.NewReader(data))
+        if err != nil {
+            return nil, fmt.Errorf("ID3V2 frame %s: %w: %v", frame.Id, ErrInvalidData, err)
+        }
+        defer r.Close()
+        out, err := ioutil.ReadAll(io.LimitReader(r, int64(dataLen)+1))
+        if err != nil {
+            return nil, fmt.Errorf("ID3V2 frame %s: %w: %v", frame.Id, ErrInvalidData, err)
+        }
+        if len(out) != dataLen {
+            return nil, fmt.Errorf("ID3V2 frame %s: %w: decompressed %d bytes, data length indicator %d", frame.Id, ErrInvalidData, len(out), dataLen)
+        }
+        return out, nil
+    }
+    return data, nil
+}
+
+func (tag *ID3V2) frameId(id string) string {
+    if tag.Ver != 2 {
+        return id
+    }
+    for k, v := range id3v22FrameIds {
+        if v == id {
+            return k
+        }
+    }
+    return id
+}
+
+// FindFrame id使用v2.3/v2.4的4字节帧ID, v2.2会自动转换
+func (tag *ID3V2) FindFrame(id string) *ID3V2Frame {
+    id = tag.frameId(id)
+    for i := range tag.Frames {
+        if tag.Frames[i].Id == id && !tag.Frames[i].IsEncrypted(tag.Ver) {
+            return &tag.Frames[i]
+        }
+    }
+    return nil
+}
+
+// TextValues 文本帧(T000-TZZZ, 不包括TXXX), v2.4中多个值以'\0'分隔
+func (tag *ID3V2) TextValues(id string) []string {
+    frame := tag.FindFrame(id)
+    if frame == nil || len(frame.Data) < 1 {
+        return nil
+    }
+    values := make([]string, 0, 1)
+    data := frame.Data[1:]
+    for len(data) > 0 {
+        str, n := decodeID3String(frame.Data[0], data)
+        values = append(values, str)
+        data = data[n:]
+    }
+    return values
+}
+
+func (tag *ID3V2) Text(id string) string {
+    if values := tag.TextValues(id); len(values) > 0 {
+        return values[0]
+    }
+    return ""
+}
+
+func (tag *ID3V2) Title() string {
+    return tag.Text("TIT2")
+}
+
+func (tag *ID3V2) Artist() string {
+    return tag.Text("TPE1")
+}
+
+func (tag *ID3V2) Album() string {
+    return tag.Text("TALB")
+}
+
+func (tag *ID3V2) Track() string {
+    return tag.Text("TRCK")
+}
+
+func (tag *ID3V2) Genre() string {
+    return tag.Text("TCON")
+}
+
+// Year v2.4使用TDRC(recording time)
+func (tag *ID3V2) Year() string {
+    if year := tag.Text("TYER"); year != "" {
+        return year
+    }
+    if tdrc := tag.Text("TDRC"); len(tdrc) >= 4 {
+        return tdrc[:4]
+    }
+    return ""
+}
+
+// <Header for 'Attached picture', ID: "APIC">
+// Text encoding      $xx
+// MIME type          <text string> $00
+// Picture type       $xx
+// Description        <text string according to encoding> $00 (00)
+// Picture data       <binary data>
+// v2.2 "PIC"的MIME type为3字节的Image format("JPG"/"PNG")
+func (tag *ID3V2) Pictures() []ID3Picture {
+    var pics []ID3Picture
+    id := tag.frameId("APIC")
+    for _, frame := range tag.Frames {
+        if frame.Id != id || frame.IsEncrypted(tag.Ver) || len(frame.Data) < 2 {
+            continue
+        }
+        pic := ID3Picture{}
+        encoding := frame.Data[0]
+        data := frame.Data[1:]
+        if tag.Ver == 2 {
+            if len(data) < 4 {
+                continue
+            }
+            switch strings.ToUpper(string(data[:3])) {
+            case "JPG":
+                pic.MimeType = "image/jpeg"
+            case "PNG":
+                pic.MimeType = "image/png"
+            default:
+                pic.MimeType = "image/" + strings.ToLower(string(data[:3]))
+            }
+            data = data[3:]
+        } else {
+            mime, n := decodeID3String(ID3_ENCODING_ISO_8859_1, data)
+            pic.MimeType = mime
+            data = data[n:]
+        }
+        if len(data) < 1 {
+            continue
+        }
+        pic.PictureType = data[0]
+        var n int
+        pic.Description, n = decodeID3String(encoding, data[1:])
+        pic.Data = data[1+n:]
+        pics = append(pics, pic)
+    }
+    return pics
+}
+
+// 解码一个以'\0'结尾(或到data结尾)的字符串, 返回消耗的字节数(包括结束符)
+func decodeID3String(encoding uint8, data []byte) (string, int) {
+    switch encoding {
+    case ID3_ENCODING_UTF16, ID3_ENCODING_UTF16BE:
+        end := len(data)
+        consumed := len(data)
+        for i := 0; i+1 < len(data); i += 2 {
+            if data[i] == 0 && data[i+1] == 0 {
+                end = i
+                consumed = i + 2
+                break
+            }
+        }
+        str := data[:end]
+        bigEndian := encoding == ID3_ENCODING_UTF16BE
+        if len(str) >= 2 && str[0] == 0xFF && str[1] == 0xFE {
+            bigEndian = false
+            str = str[2:]
+        } else if len(str) >= 2 && str[0] == 0xFE && str[1] == 0xFF {
+            bigEndian = true
+            str = str[2:]
+        }
+        u16 := make([]uint16, len(str)/2)
+        for i := range u16 {
+            if bigEndian {
+                u16[i] = uint16(str[2*i])<<8 | uint16(str[2*i+1])
+            } else {
+                u16[i] = uint16(str[2*i+1])<<8 | uint16(str[2*i])
+            }
+        }
+        return string(utf16.Decode(u16)), consumed
+    default:
+        end := bytes.IndexByte(data, 0)
+        consumed := end + 1
+        if end < 0 {
+            end = len(data)
+            consumed = len(data)
+        }
+        if encoding == ID3_ENCODING_UTF8 {
+            return string(data[:end]), consumed
+        }
+        runes := make([]rune, end)
+        for i, c := range data[:end] {
+            runes[i] = rune(c)
+        }
+        return string(runes), consumed
+    }
+}
+
+type ID3V1 struct {
+    Title   string
+    Artist  string
+    Album   string
+    Year    string
+    Comment string
+    Track   uint8 //ID3v1.1, 0表示没有
+    Genre   uint8
+}
+
+func DecodeID3V1(data []byte) (*ID3V1, error) {
+    if len(data) < ID3V1_SIZE || !bytes.HasPrefix(data, []byte{'T', 'A', 'G'}) {
+        return nil, errors.New("ID3V1 must start with 'TAG' and has 128 bytes")
+    }
+    trim := func(b []byte) string {
+        if i := bytes.IndexByte(b, 0); i >= 0 {
+            b = b[:i]
+        }
+        runes := make([]rune, len(b))
+        for i, c := range b {
+            runes[i] = rune(c)
+        }
+        return strings.TrimRight(string(runes), " ")
+    }
+    tag := &ID3V1{
+        Title:  trim(data[3:33]),
+        Artist: trim(data[33:63]),
+        Album:  trim(data[63:93]),
+        Year:   trim(data[93:97]),
+        Genre:  data[127],
+    }
+    if data[125] == 0 && data[126] != 0 {
+        tag.Comment = trim(data[97:125])
+        tag.Track = data[126]
+    } else {
+        tag.Comment = trim(data[97:127])
+    }
+    return tag, nil
+}
+
+// FindID3V1 ID3V1位于文件的最后128字节
+func FindID3V1(data []byte) *ID3V1 {
+    if len(data) < ID3V1_SIZE {
+        return nil
+    }
+    tag, err := DecodeID3V1(data[len(data)-ID3V1_SIZE:])
+    if err != nil {
+        return nil
+    }
+    return tag
+}
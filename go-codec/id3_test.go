@@ -0,0 +1,166 @@
+package codec
+
+import (
+    "bytes"
+    "compress/zlib"
+    "errors"
+    "reflect"
+    "testing"
+)
+
+func synchsafe(size int) []byte {
+    return []byte{uint8(size>>21) & 0x7F, uint8(size>>14) & 0x7F, uint8(size>>7) & 0x7F, uint8(size) & 0x7F}
+}
+
+func makeID3Frame(ver uint8, id string, flags uint16, data []byte) []byte {
+    frame := []byte(id)
+    switch ver {
+    case 2:
+        frame = append(frame, uint8(len(data)>>16), uint8(len(data)>>8), uint8(len(data)))
+    case 3:
+        frame = append(frame, uint8(len(data)>>24), uint8(len(data)>>16), uint8(len(data)>>8), uint8(len(data)), uint8(flags>>8), uint8(flags))
+    case 4:
+        frame = append(frame, synchsafe(len(data))...)
+        frame = append(frame, uint8(flags>>8), uint8(flags))
+    }
+    return append(frame, data...)
+}
+
+func makeID3Tag(ver uint8, flag uint8, body []byte) []byte {
+    tag := []byte{'I', 'D', '3', ver, 0, flag}
+    tag = append(tag, synchsafe(len(body))...)
+    return append(tag, body...)
+}
+
+func TestDecodeID3V2(t *testing.T) {
+    jpeg := []byte{0xFF, 0xD8, 0xFF, 0x00, 0xE0, 0x01, 0xFF, 0xD9}
+    utf16 := []byte{0x01, 0xFF, 0xFE, 'A', 0, 0xE9, 0, 0, 0}
+
+    // v2.3: tag级unsynchronisation + extended header + padding
+    var body23 []byte
+    body23 = append(body23, 0, 0, 0, 6, 0, 0, 0, 0, 0, 0)
+    body23 = append(body23, makeID3Frame(3, "TIT2", 0, []byte("\x00Hello"))...)
+    body23 = append(body23, makeID3Frame(3, "TPE1", 0, utf16)...)
+    body23 = append(body23, makeID3Frame(3, "TYER", 0, []byte("\x002001"))...)
+    body23 = append(body23, makeID3Frame(3, "APIC", 0, append([]byte("\x00image/jpeg\x00\x03cover\x00"), jpeg...))...)
+    body23 = append(body23, make([]byte, 20)...)
+    unsync := bytes.ReplaceAll(body23, []byte{0xFF}, []byte{0xFF, 0x00})
+    tag23 := makeID3Tag(3, ID3V2_FLAG_UNSYNCHRONISATION|ID3V2_FLAG_EXTENDED_HEADER, unsync)
+
+    // v2.4: UTF-8多值, 帧级unsynchronisation + data length indicator, zlib压缩, footer
+    var compressed bytes.Buffer
+    zw := zlib.NewWriter(&compressed)
+    zw.Write([]byte("\x03Rock"))
+    zw.Close()
+    pic := append([]byte("\x03image/png\x00\x00\x00"), jpeg...)
+    picUnsync := bytes.ReplaceAll(pic, []byte{0xFF}, []byte{0xFF, 0x00})
+    var body24 []byte
+    body24 = append(body24, makeID3Frame(4, "TPE1", 0, []byte("\x03A\x00B"))...)
+    body24 = append(body24, makeID3Frame(4, "TDRC", 0, []byte("\x032020-05-01"))...)
+    body24 = append(body24, makeID3Frame(4, "APIC", ID3V24_FRAME_UNSYNCHRONISATION|ID3V24_FRAME_DATA_LENGTH_INDICATOR,
+        append(synchsafe(len(pic)), picUnsync...))...)
+    body24 = append(body24, makeID3Frame(4, "TCON", ID3V24_FRAME_COMPRESSION|ID3V24_FRAME_DATA_LENGTH_INDICATOR,
+        append(synchsafe(5), compressed.Bytes()...))...)
+    tag24 := makeID3Tag(4, ID3V2_FLAG_FOOTER, body24)
+    tag24 = append(tag24, []byte{'3', 'D', 'I', 4, 0, ID3V2_FLAG_FOOTER}...)
+    tag24 = append(tag24, synchsafe(len(body24))...)
+
+    // v2.2
+    var body22 []byte
+    body22 = append(body22, makeID3Frame(2, "TT2", 0, []byte("\x00Old"))...)
+    body22 = append(body22, makeID3Frame(2, "TRK", 0, []byte("\x003/10"))...)
+    body22 = append(body22, makeID3Frame(2, "PIC", 0, append([]byte("\x00JPG\x00\x00"), jpeg...))...)
+    tag22 := makeID3Tag(2, 0, body22)
+
+    tests := []struct {
+        name      string
+        data      []byte
+        ver       uint8
+        totalSize int
+        title     string
+        artist    []string
+        year      string
+        track     string
+        genre     string
+        pictures  []ID3Picture
+    }{
+        {name: "v2.3", data: tag23, ver: 3, totalSize: len(tag23), title: "Hello", artist: []string{"Aé"}, year: "2001",
+            pictures: []ID3Picture{{MimeType: "image/jpeg", PictureType: 3, Description: "cover", Data: jpeg}}},
+        {name: "v2.4", data: tag24, ver: 4, totalSize: len(tag24), artist: []string{"A", "B"}, year: "2020", genre: "Rock",
+            pictures: []ID3Picture{{MimeType: "image/png", PictureType: 0, Description: "", Data: jpeg}}},
+        {name: "v2.2", data: tag22, ver: 2, totalSize: len(tag22), title: "Old", track: "3/10",
+            pictures: []ID3Picture{{MimeType: "image/jpeg", PictureType: 0, Description: "", Data: jpeg}}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            tag, err := DecodeID3V2(tt.data)
+            if err != nil {
+                t.Fatal(err)
+            }
+            if tag.Ver != tt.ver || tag.TotalSize() != tt.totalSize {
+                t.Errorf("ver %d total size %d", tag.Ver, tag.TotalSize())
+            }
+            if tag.Title() != tt.title || !reflect.DeepEqual(tag.TextValues("TPE1"), tt.artist) || tag.Year() != tt.year ||
+                tag.Track() != tt.track || tag.Genre() != tt.genre {
+                t.Errorf("title %q artist %q year %q track %q genre %q", tag.Title(), tag.TextValues("TPE1"), tag.Year(), tag.Track(), tag.Genre())
+            }
+            if !reflect.DeepEqual(tag.Pictures(), tt.pictures) {
+                t.Errorf("Pictures() = %+v", tag.Pictures())
+            }
+        })
+    }
+
+    if _, err := DecodeID3V2(tag23[:len(tag23)-1]); err != errID3V2Truncated {
+        t.Errorf("truncated tag err = %v", err)
+    }
+    if _, err := DecodeID3V2(makeID3Tag(3, 0, makeID3Frame(3, "TIT2", 0, []byte("\x00abc"))[:12])); err == nil {
+        t.Errorf("expected error for truncated frame")
+    }
+}
+
+func TestDecodeID3V2_Compressed(t *testing.T) {
+    var compressed bytes.Buffer
+    zw := zlib.NewWriter(&compressed)
+    zw.Write(make([]byte, 4096))
+    zw.Close()
+    tests := []struct {
+        name  string
+        ver   uint8
+        frame []byte
+    }{
+        //解压后超过data length indicator
+        {name: "v2.4 overflow", ver: 4, frame: makeID3Frame(4, "TCON", ID3V24_FRAME_COMPRESSION|ID3V24_FRAME_DATA_LENGTH_INDICATOR,
+            append(synchsafe(16), compressed.Bytes()...))},
+        {name: "v2.4 short", ver: 4, frame: makeID3Frame(4, "TCON", ID3V24_FRAME_COMPRESSION|ID3V24_FRAME_DATA_LENGTH_INDICATOR,
+            append(synchsafe(8192), compressed.Bytes()...))},
+        {name: "v2.4 no data length", ver: 4, frame: makeID3Frame(4, "TCON", ID3V24_FRAME_COMPRESSION, compressed.Bytes())},
+        {name: "v2.3 overflow", ver: 3, frame: makeID3Frame(3, "TCON", ID3V23_FRAME_COMPRESSION, append([]byte{0, 0, 0, 16}, compressed.Bytes()...))},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if _, err := DecodeID3V2(makeID3Tag(tt.ver, 0, tt.frame)); !errors.Is(err, ErrInvalidData) {
+                t.Errorf("err = %v, want ErrInvalidData", err)
+            }
+        })
+    }
+}
+
+func TestDecodeID3V1(t *testing.T) {
+    data := make([]byte, 128)
+    copy(data, "TAG")
+    copy(data[3:], "Title  ")
+    copy(data[33:], "Artist")
+    copy(data[63:], "Album")
+    copy(data[93:], "1999")
+    copy(data[97:], "comment")
+    data[126] = 7
+    data[127] = 17
+    tag := FindID3V1(append([]byte{0xFF, 0xFB, 0x90, 0x00}, data...))
+    want := &ID3V1{Title: "Title", Artist: "Artist", Album: "Album", Year: "1999", Comment: "comment", Track: 7, Genre: 17}
+    if !reflect.DeepEqual(tag, want) {
+        t.Errorf("FindID3V1() = %+v", tag)
+    }
+    if FindID3V1(data[1:]) != nil {
+        t.Errorf("expected nil without 'TAG'")
+    }
+}
@@ -0,0 +1,455 @@
+package codec
+
+import (
+    "fmt"
+)
+
+var errLATMNoStreamMuxConfig = fmt.Errorf("latm stream mux config not found: %w", ErrInvalidData)
+var errLATMUnsupported = fmt.Errorf("latm configuration: %w", ErrUnsupportedCodec)
+
+// ISO/IEC 14496-3 1.7.3 Low Overhead Audio Transport Multiplex(LATM)
+// DVB广播中的AAC一般使用LOAS/LATM(stream_type 0x11), RTP MP4A-LATM(RFC 3016/6416)直接承载AudioMuxElement
+
+// LATMStreamConfig StreamMuxConfig中每个prog/layer对应的配置
+type LATMStreamConfig struct {
+    Prog                          uint8
+    Layer                         uint8
+    Use_same_config               uint8
+    Asc                           *AudioSpecificConfiguration
+    Frame_length_type             uint8
+    Latm_buffer_fullness          uint8
+    Core_frame_offset             uint8
+    Frame_length                  uint16
+    CELP_frame_length_table_index uint8
+    HVXC_frame_length_table_index uint8
+}
+
+// Table 1.42 – Syntax of StreamMuxConfig()
+// 只支持audioMuxVersionA == 0
+type StreamMuxConfig struct {
+    Audio_mux_version             uint8
+    Audio_mux_version_A           uint8
+    Tara_buffer_fullness          uint32
+    All_streams_same_time_framing uint8
+    Num_sub_frames                uint8
+    Num_program                   uint8
+    Num_layer                     []uint8
+    Streams                       []LATMStreamConfig
+    Other_data_present            uint8
+    Other_data_len_bits           uint32
+    Crc_check_present             uint8
+    Crc_check_sum                 uint8
+}
+
+// 单节目单层, 每个AudioMuxElement承载一帧
+func NewStreamMuxConfig(asc *AudioSpecificConfiguration) *StreamMuxConfig {
+    return &StreamMuxConfig{
+        All_streams_same_time_framing: 1,
+        Num_layer:                     []uint8{0},
+        Streams: []LATMStreamConfig{
+            {Asc: asc, Latm_buffer_fullness: 0xFF},
+        },
+    }
+}
+
+// Table 1.44 – Syntax of LatmGetValue()
+func latmGetValue(bs *BitStream) uint32 {
+    bytesForValue := bs.Uint8(2)
+    value := uint32(0)
+    for i := 0; i <= int(bytesForValue); i++ {
+        value = value<<8 | bs.Uint32(8)
+    }
+    return value
+}
+
+func latmPutValue(bsw *BitStreamWriter, value uint32) {
+    bytesForValue := 0
+    for v := value >> 8; v > 0 && bytesForValue < 3; v >>= 8 {
+        bytesForValue++
+    }
+    bsw.PutUint8(uint8(bytesForValue), 2)
+    bsw.PutUint32(value, 8*(bytesForValue+1))
+}
+
+func (smc *StreamMuxConfig) Decode(buf []byte) (err error) {
+    bs := NewBitStream(buf)
+    if err = smc.decode(bs); err != nil {
+        return err
+    }
+    if bs.Err() != nil {
+        return fmt.Errorf("stream mux config: %w", bs.Err())
+    }
+    return nil
+}
+
+func (smc *StreamMuxConfig) Encode() []byte {
+    bsw := NewBitStreamWriter(16)
+    smc.encode(bsw)
+    return bsw.Bits()
+}
+
+func (smc *StreamMuxConfig) decode(bs *BitStream) error {
+    smc.Audio_mux_version = bs.GetBit()
+    smc.Audio_mux_version_A = 0
+    if smc.Audio_mux_version == 1 {
+        smc.Audio_mux_version_A = bs.GetBit()
+    }
+    if smc.Audio_mux_version_A != 0 {
+        return errLATMUnsupported
+    }
+    if smc.Audio_mux_version == 1 {
+        smc.Tara_buffer_fullness = latmGetValue(bs)
+    }
+    smc.All_streams_same_time_framing = bs.GetBit()
+    smc.Num_sub_frames = bs.Uint8(6)
+    smc.Num_program = bs.Uint8(4)
+    smc.Num_layer = make([]uint8, smc.Num_program+1)
+    smc.Streams = smc.Streams[:0]
+    for prog := 0; prog <= int(smc.Num_program); prog++ {
+        smc.Num_layer[prog] = bs.Uint8(3)
+        for lay := 0; lay <= int(smc.Num_layer[prog]); lay++ {
+            stream := LATMStreamConfig{Prog: uint8(prog), Layer: uint8(lay)}
+            if prog != 0 || lay != 0 {
+                stream.Use_same_config = bs.GetBit()
+            }
+            if stream.Use_same_config == 1 {
+                stream.Asc = smc.Streams[len(smc.Streams)-1].Asc
+            } else {
+                stream.Asc = NewAudioSpecificConfiguration()
+                if smc.Audio_mux_version == 0 {
+                    if err := stream.Asc.decode(bs, bs.RemainBits()); err != nil {
+                        return err
+                    }
+                } else {
+                    ascLen := int(latmGetValue(bs))
+                    start := bs.RemainBits()
+                    if err := stream.Asc.decode(bs, ascLen); err != nil {
+                        return err
+                    }
+                    consumed := start - bs.RemainBits()
+                    if consumed > ascLen {
+                        return fmt.Errorf("%w: audio specific config length mismatch", ErrInvalidData)
+                    }
+                    bs.SkipBits(ascLen - consumed)
+                }
+            }
+            stream.Frame_length_type = bs.Uint8(3)
+            switch stream.Frame_length_type {
+            case 0:
+                stream.Latm_buffer_fullness = bs.Uint8(8)
+                if smc.All_streams_same_time_framing == 0 && lay > 0 {
+                    aot := stream.Asc.ObjectType()
+                    prevAot := smc.Streams[len(smc.Streams)-1].Asc.ObjectType()
+                    if (aot == AOT_AAC_SCALABLE || aot == AOT_ER_AAC_SCALABLE) && (prevAot == AOT_CELP || prevAot == AOT_ER_CELP) {
+                        stream.Core_frame_offset = bs.Uint8(6)
+                    }
+                }
+            case 1:
+                stream.Frame_length = bs.Uint16(9)
+            case 3, 4, 5:
+                stream.CELP_frame_length_table_index = bs.Uint8(6)
+            case 6, 7:
+                stream.HVXC_frame_length_table_index = bs.GetBit()
+            }
+            smc.Streams = append(smc.Streams, stream)
+        }
+    }
+    smc.Other_data_present = bs.GetBit()
+    smc.Other_data_len_bits = 0
+    if smc.Other_data_present == 1 {
+        if smc.Audio_mux_version == 1 {
+            smc.Other_data_len_bits = latmGetValue(bs)
+        } else {
+            for {
+                esc := bs.GetBit()
+                smc.Other_data_len_bits = smc.Other_data_len_bits<<8 | bs.Uint32(8)
+                if esc == 0 {
+                    break
+                }
+            }
+        }
+    }
+    smc.Crc_check_present = bs.GetBit()
+    if smc.Crc_check_present == 1 {
+        smc.Crc_check_sum = bs.Uint8(8)
+    }
+    return nil
+}
+
+func (smc *StreamMuxConfig) encode(bsw *BitStreamWriter) {
+    bsw.PutUint8(smc.Audio_mux_version, 1)
+    if smc.Audio_mux_version == 1 {
+        bsw.PutUint8(0, 1)
+        latmPutValue(bsw, smc.Tara_buffer_fullness)
+    }
+    bsw.PutUint8(smc.All_streams_same_time_framing, 1)
+    bsw.PutUint8(smc.Num_sub_frames, 6)
+    bsw.PutUint8(smc.Num_program, 4)
+    idx := 0
+    for prog := 0; prog <= int(smc.Num_program); prog++ {
+        bsw.PutUint8(smc.Num_layer[prog], 3)
+        for lay := 0; lay <= int(smc.Num_layer[prog]); lay++ {
+            stream := &smc.Streams[idx]
+            idx++
+            if prog != 0 || lay != 0 {
+                bsw.PutUint8(stream.Use_same_config, 1)
+            }
+            if prog == 0 && lay == 0 || stream.Use_same_config == 0 {
+                if smc.Audio_mux_version == 0 {
+                    stream.Asc.encode(bsw)
+                } else {
+                    ascw := NewBitStreamWriter(8)
+                    stream.Asc.encode(ascw)
+                    ascLen := ascw.ByteOffset()*8 + ascw.BitOffset()
+                    latmPutValue(bsw, uint32(ascLen))
+                    putBits(bsw, ascw.Bits(), ascLen)
+                }
+            }
+            bsw.PutUint8(stream.Frame_length_type, 3)
+            switch stream.Frame_length_type {
+            case 0:
+                bsw.PutUint8(stream.Latm_buffer_fullness, 8)
+                if smc.All_streams_same_time_framing == 0 && lay > 0 {
+                    aot := stream.Asc.ObjectType()
+                    prevAot := smc.Streams[idx-2].Asc.ObjectType()
+                    if (aot == AOT_AAC_SCALABLE || aot == AOT_ER_AAC_SCALABLE) && (prevAot == AOT_CELP || prevAot == AOT_ER_CELP) {
+                        bsw.PutUint8(stream.Core_frame_offset, 6)
+                    }
+                }
+            case 1:
+                bsw.PutUint16(stream.Frame_length, 9)
+            case 3, 4, 5:
+                bsw.PutUint8(stream.CELP_frame_length_table_index, 6)
+            case 6, 7:
+                bsw.PutUint8(stream.HVXC_frame_length_table_index, 1)
+            }
+        }
+    }
+    bsw.PutUint8(smc.Other_data_present, 1)
+    if smc.Other_data_present == 1 {
+        if smc.Audio_mux_version == 1 {
+            latmPutValue(bsw, smc.Other_data_len_bits)
+        } else {
+            n := 0
+            for v := smc.Other_data_len_bits >> 8; v > 0; v >>= 8 {
+                n++
+            }
+            for ; n >= 0; n-- {
+                if n > 0 {
+                    bsw.PutUint8(1, 1)
+                } else {
+                    bsw.PutUint8(0, 1)
+                }
+                bsw.PutUint8(uint8(smc.Other_data_len_bits>>(8*n)), 8)
+            }
+        }
+    }
+    bsw.PutUint8(smc.Crc_check_present, 1)
+    if smc.Crc_check_present == 1 {
+        bsw.PutUint8(smc.Crc_check_sum, 8)
+    }
+}
+
+// 写入data中的前nbits位, 不要求字节对齐
+func putBits(bsw *BitStreamWriter, data []byte, nbits int) {
+    for i := 0; nbits > 0; i++ {
+        if nbits >= 8 {
+            bsw.PutUint8(data[i], 8)
+            nbits -= 8
+        } else {
+            bsw.PutUint8(data[i]>>(8-nbits), nbits)
+            nbits = 0
+        }
+    }
+}
+
+// 只支持allStreamsSameTimeFraming == 1, frameLengthType为0或者1
+func (smc *StreamMuxConfig) checkPayloadMux() error {
+    if smc.All_streams_same_time_framing == 0 {
+        return errLATMUnsupported
+    }
+    for _, stream := range smc.Streams {
+        if stream.Frame_length_type != 0 && stream.Frame_length_type != 1 {
+            return errLATMUnsupported
+        }
+    }
+    return nil
+}
+
+// Table 1.41 – Syntax of AudioMuxElement()
+//
+//	AudioMuxElement(muxConfigPresent) {
+//	    if (muxConfigPresent) {
+//	        useSameStreamMux;                   1
+//	        if (!useSameStreamMux)
+//	            StreamMuxConfig();
+//	    }
+//	    if (audioMuxVersionA == 0) {
+//	        for (i = 0; i <= numSubFrames; i++) {
+//	            PayloadLengthInfo();
+//	            PayloadMux();
+//	        }
+//	        if (otherDataPresent) {
+//	            for(i = 0; i < otherDataLenBits; i++) {
+//	                otherDataBit;               1
+//	            }
+//	        }
+//	    }
+//	    else {
+//	        /* tbd */
+//	    }
+//	    ByteAlign();
+//	}
+//
+// muxConfigPresent: LOAS为true, RTP MP4A-LATM cpresent=0时为false(StreamMuxConfig来自SDP config参数)
+// 使用新的StreamMuxConfig时会更新smc, 返回的payload按subframe, stream顺序排列, 指向data
+func DecodeAudioMuxElement(data []byte, muxConfigPresent bool, smc *StreamMuxConfig) (payloads [][]byte, err error) {
+    bs := NewBitStream(data)
+    if muxConfigPresent && bs.GetBit() == 0 {
+        if err = smc.decode(bs); err != nil {
+            return nil, err
+        }
+        if bs.Err() != nil {
+            return nil, fmt.Errorf("stream mux config: %w", bs.Err())
+        }
+    }
+    if len(smc.Streams) == 0 {
+        return nil, errLATMNoStreamMuxConfig
+    }
+    if err = smc.checkPayloadMux(); err != nil {
+        return nil, err
+    }
+    lengths := make([]int, len(smc.Streams))
+    for i := 0; i <= int(smc.Num_sub_frames); i++ {
+        // PayloadLengthInfo()
+        for j, stream := range smc.Streams {
+            if stream.Frame_length_type == 0 {
+                lengths[j] = 0
+                for {
+                    tmp := bs.Uint8(8)
+                    lengths[j] += int(tmp)
+                    if tmp != 255 {
+                        break
+                    }
+                }
+            } else {
+                lengths[j] = int(stream.Frame_length) + 20
+            }
+        }
+        // PayloadMux()
+        for j := range smc.Streams {
+            if lengths[j]*8 > bs.RemainBits() {
+                return nil, fmt.Errorf("audio mux element: %w", ErrTruncated)
+            }
+            if bs.bitsOffset == 0 {
+                offset := bs.ByteOffset()
+                payloads = append(payloads, data[offset:offset+lengths[j]])
+                bs.SkipBits(lengths[j] * 8)
+            } else {
+                payload := make([]byte, lengths[j])
+                for k := range payload {
+                    payload[k] = bs.Uint8(8)
+                }
+                payloads = append(payloads, payload)
+            }
+        }
+    }
+    if bs.Err() != nil {
+        return nil, fmt.Errorf("audio mux element: %w", bs.Err())
+    }
+    return payloads, nil
+}
+
+// payloads 按subframe, stream顺序排列, 数量为(numSubFrames+1)*len(smc.Streams)
+// frameLengthType为1时payload长度必须为frameLength+20
+func EncodeAudioMuxElement(smc *StreamMuxConfig, muxConfigPresent bool, useSameStreamMux bool, payloads [][]byte) ([]byte, error) {
+    if err := smc.checkPayloadMux(); err != nil {
+        return nil, err
+    }
+    if len(payloads) != (int(smc.Num_sub_frames)+1)*len(smc.Streams) {
+        return nil, fmt.Errorf("%w: number of latm payloads mismatch", ErrInvalidData)
+    }
+    size := 8
+    for _, payload := range payloads {
+        size += len(payload) + len(payload)/255 + 1
+    }
+    bsw := NewBitStreamWriter(size)
+    if muxConfigPresent {
+        if useSameStreamMux {
+            bsw.PutUint8(1, 1)
+        } else {
+            bsw.PutUint8(0, 1)
+            smc.encode(bsw)
+        }
+    }
+    for i := 0; i <= int(smc.Num_sub_frames); i++ {
+        subframe := payloads[i*len(smc.Streams) : (i+1)*len(smc.Streams)]
+        for j, stream := range smc.Streams {
+            if stream.Frame_length_type == 0 {
+                n := len(subframe[j])
+                for ; n >= 255; n -= 255 {
+                    bsw.PutUint8(255, 8)
+                }
+                bsw.PutUint8(uint8(n), 8)
+            } else if len(subframe[j]) != int(stream.Frame_length)+20 {
+                return nil, fmt.Errorf("%w: latm payload length mismatch", ErrInvalidData)
+            }
+        }
+        for _, payload := range subframe {
+            if bsw.BitOffset() == 0 {
+                bsw.PutBytes(payload)
+            } else {
+                putBits(bsw, payload, len(payload)*8)
+            }
+        }
+    }
+    // otherDataBit 填充0
+    for i := uint32(0); smc.Other_data_present == 1 && i < smc.Other_data_len_bits; i++ {
+        bsw.PutUint8(0, 1)
+    }
+    return bsw.Bits(), nil
+}
+
+// Table 1.36 – Syntax of AudioSyncStream()
+// AudioSyncStream() {
+//     while (nextbits() == 0x2B7) {
+//         syncword;                   11
+//         audioMuxLengthBytes;        13
+//         AudioMuxElement(1);
+//     }
+// }
+
+const LOAS_SYNCWORD = 0x2B7
+
+// 返回LOAS syncword(0x56E)的位置, 没有找到返回-1
+func FindLOASSyncword(loas []byte, offset int) int {
+    for i := offset; i+2 < len(loas); i++ {
+        if loas[i] == 0x56 && loas[i+1]&0xE0 == 0xE0 {
+            return i
+        }
+    }
+    return -1
+}
+
+// onFrame 回调AudioMuxElement(不包含3字节LOAS头), 不完整的帧被丢弃
+func SplitLOASFrame(frames []byte, onFrame func(ame []byte)) {
+    start := FindLOASSyncword(frames, 0)
+    for start >= 0 {
+        length := int(frames[start+1]&0x1F)<<8 | int(frames[start+2])
+        if start+3+length > len(frames) {
+            return
+        }
+        onFrame(frames[start+3 : start+3+length])
+        start = FindLOASSyncword(frames, start+3+length)
+    }
+}
+
+// 添加3字节LOAS头, ame最大8191字节
+func EncodeLOASFrame(ame []byte) []byte {
+    frame := make([]byte, 3+len(ame))
+    frame[0] = 0x56
+    frame[1] = 0xE0 | byte(len(ame)>>8)&0x1F
+    frame[2] = byte(len(ame))
+    copy(frame[3:], ame)
+    return frame
+}
@@ -0,0 +1,87 @@
+package codec
+
+import (
+    "bytes"
+    "errors"
+    "reflect"
+    "testing"
+)
+
+func TestStreamMuxConfig_Decode(t *testing.T) {
+    // a=fmtp:96 profile-level-id=15;object=2;cpresent=0;config=400024203FC0
+    config := []byte{0x40, 0x00, 0x24, 0x20, 0x3F, 0xC0}
+    smc := &StreamMuxConfig{}
+    if err := smc.Decode(config); err != nil {
+        t.Fatal(err)
+    }
+    if len(smc.Streams) != 1 || smc.All_streams_same_time_framing != 1 || smc.Streams[0].Latm_buffer_fullness != 0xFF {
+        t.Fatalf("Decode() = %+v", smc)
+    }
+    asc := smc.Streams[0].Asc
+    if asc.ObjectType() != AOT_AAC_LC || asc.SampleRate() != 44100 || asc.ChannelCount() != 2 {
+        t.Errorf("asc = %+v", asc)
+    }
+    if got := smc.Encode(); !bytes.Equal(got, config) {
+        t.Errorf("Encode() = %x, want %x", got, config)
+    }
+}
+
+func TestAudioMuxElement_RoundTrip(t *testing.T) {
+    heaac := &AudioSpecificConfiguration{Audio_object_type: AOT_SBR, Sample_freq_index: 6, Channel_configuration: 2,
+        Extension_audio_object_type: AOT_SBR, Sbr_present_flag: 1, Extension_sample_freq_index: 3, Core_audio_object_type: AOT_AAC_LC}
+    tests := []struct {
+        name    string
+        version uint8
+        asc     *AudioSpecificConfiguration
+        frames  [][]byte
+    }{
+        {name: "version 0", version: 0, asc: &AudioSpecificConfiguration{Audio_object_type: AOT_AAC_LC, Sample_freq_index: 3, Channel_configuration: 2}},
+        {name: "version 1", version: 1, asc: heaac},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            smc := NewStreamMuxConfig(tt.asc)
+            smc.Audio_mux_version = tt.version
+            payloads := [][]byte{bytes.Repeat([]byte{0xA5}, 300), {0x21, 0x10, 0x05}}
+            var loas []byte
+            for i, payload := range payloads {
+                ame, err := EncodeAudioMuxElement(smc, true, i > 0, [][]byte{payload})
+                if err != nil {
+                    t.Fatal(err)
+                }
+                loas = append(loas, EncodeLOASFrame(ame)...)
+            }
+
+            got := &StreamMuxConfig{}
+            var frames [][]byte
+            SplitLOASFrame(append([]byte{0x00, 0x56}, loas...), func(ame []byte) {
+                out, err := DecodeAudioMuxElement(ame, true, got)
+                if err != nil {
+                    t.Fatal(err)
+                }
+                frames = append(frames, out...)
+            })
+            if !reflect.DeepEqual(frames, payloads) {
+                t.Errorf("payloads = %x, want %x", frames, payloads)
+            }
+            if !reflect.DeepEqual(got.Streams[0].Asc, tt.asc) {
+                t.Errorf("asc = %+v, want %+v", got.Streams[0].Asc, tt.asc)
+            }
+        })
+    }
+}
+
+func TestDecodeAudioMuxElement_Error(t *testing.T) {
+    smc := &StreamMuxConfig{}
+    if _, err := DecodeAudioMuxElement([]byte{0x80, 0x01}, true, smc); err != errLATMNoStreamMuxConfig || !errors.Is(err, ErrInvalidData) {
+        t.Errorf("useSameStreamMux without config err = %v", err)
+    }
+    config := NewStreamMuxConfig(&AudioSpecificConfiguration{Audio_object_type: AOT_AAC_LC, Sample_freq_index: 3, Channel_configuration: 1})
+    ame, _ := EncodeAudioMuxElement(config, true, false, [][]byte{{0x01, 0x02, 0x03}})
+    if _, err := DecodeAudioMuxElement(ame[:len(ame)-2], true, smc); !errors.Is(err, ErrTruncated) {
+        t.Errorf("truncated audio mux element err = %v", err)
+    }
+    if _, err := EncodeAudioMuxElement(config, true, false, nil); !errors.Is(err, ErrInvalidData) {
+        t.Errorf("payload count mismatch err = %v", err)
+    }
+}
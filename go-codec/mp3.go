@@ -175,10 +175,12 @@ const (
 )
 
 type ID3V2 struct {
-    Ver      uint8
-    Revision uint8
-    Flag     uint8
-    Size     uint32
+    Ver             uint8
+    Revision        uint8
+    Flag            uint8
+    Size            uint32 //不包括header和footer
+    Extended_header []byte //不包括extended header size
+    Frames          []ID3V2Frame
 }
 
 type MP3FrameHead struct {
@@ -199,8 +201,8 @@ type MP3FrameHead struct {
 }
 
 func DecodeMp3Head(data []byte) (*MP3FrameHead, error) {
-    if len(data) == 0 {
-        return nil, errors.New("empty mp3 frame")
+    if len(data) < 4 {
+        return nil, &ParseError{What: "mp3 frame head", Offset: len(data), Err: ErrTruncated}
     }
     bs := NewBitStream(data)
     syncWord := bs.GetBits(11)
@@ -244,6 +246,12 @@ func DecodeMp3Head(data []byte) (*MP3FrameHead, error) {
     head.Copyright = bs.GetBit()
     head.Original = bs.GetBit()
     head.Emphasis = uint8(bs.GetBits(2))
+    //不支持free format
+    if head.Version == VERSION_RESERVED || head.Layer == LAYER_RESERVED ||
+        head.BitrateIndex == 0 || head.BitrateIndex == 0x0F || head.SampleRateIndex == 0x03 {
+        return nil, fmt.Errorf("mp3 frame head: %w: version %d layer %d bitrate index %d sample rate index %d",
+            ErrInvalidData, head.Version, head.Layer, head.BitrateIndex, head.SampleRateIndex)
+    }
 
     if head.Layer == LAYER_1 {
         head.SampleSize = 384
@@ -269,7 +277,7 @@ func DecodeMp3Head(data []byte) (*MP3FrameHead, error) {
 }
 
 func (mp3 *MP3FrameHead) GetChannelCount() int {
-    if mp3.Mode == 0x11 {
+    if mp3.Mode == 0x03 {
         return 1
     } else {
         return 2
@@ -281,11 +289,14 @@ func (mp3 *MP3FrameHead) GetBitRate() int {
     if mp3.Version == VERSION_MPEG_2 || mp3.Version == VERSION_MPEG_2_5 {
         i = 1
     }
+    if mp3.Layer == LAYER_RESERVED || mp3.Layer > LAYER_3 || mp3.BitrateIndex > 0x0F {
+        return 0
+    }
     return BitRateTable[i][mp3.Layer-1][mp3.BitrateIndex] * 1000
 }
 
 func (mp3 *MP3FrameHead) GetSampleRate() int {
-    if mp3.Version == LAYER_RESERVED {
+    if mp3.Version == VERSION_RESERVED || mp3.Version > VERSION_MPEG_2_5 || mp3.SampleRateIndex > 0x03 {
         return 0
     }
     return SampleRateTable[mp3.Version-1][mp3.SampleRateIndex]
@@ -294,15 +305,14 @@ func (mp3 *MP3FrameHead) GetSampleRate() int {
 func SplitMp3Frames(data []byte, onFrame func(head *MP3FrameHead, frame []byte)) error {
     for len(data) > 0 {
         if bytes.HasPrefix(data, []byte{'I', 'D', '3'}) {
-            if len(data) < 10 {
-                return errors.New("ID3V2 tag head must has 10 bytes")
+            tag, err := DecodeID3V2Head(data)
+            if err != nil {
+                return err
+            }
+            if len(data) < tag.TotalSize() {
+                return errID3V2Truncated
             }
-            fmt.Println("Get ID3 tag")
-            var size uint32 = uint32(data[7])
-            size = size<<7 | uint32(data[8])
-            size = size<<7 | uint32(data[9])
-            data = data[10+size:]
-            fmt.Println("tag size ", size)
+            data = data[tag.TotalSize():]
         } else if bytes.HasPrefix(data, []byte{'T', 'A', 'G'}) {
             if len(data) < 128 {
                 return errors.New("ID3V1 must has 128 bytes")
@@ -311,9 +321,11 @@ func SplitMp3Frames(data []byte, onFrame func(head *MP3FrameHead, frame []byte))
         } else {
             head, err := DecodeMp3Head(data)
             if err != nil {
-                fmt.Println(err)
                 return err
             }
+            if head.FrameSize < 4 || head.FrameSize > len(data) {
+                return &ParseError{What: "mp3 frame", Offset: len(data), Err: ErrTruncated}
+            }
             if onFrame != nil {
                 onFrame(head, data[:head.FrameSize])
             }
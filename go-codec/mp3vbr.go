@@ -0,0 +1,299 @@
+package codec
+
+import (
+    "encoding/binary"
+    "errors"
+)
+
+// VBR header位于第一个mp3帧中, 该帧本身不包含音频数据
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+// | FRAMEHEADER(4 byte) | side information | "Xing"/"Info" ... | LAME tag |
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+// | FRAMEHEADER(4 byte) | 32 bytes | "VBRI" ...                             |
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+
+// Xing/Info header
+// char     ID[4];          "Xing"(VBR) 或者 "Info"(CBR)
+// uint32   Flags;          0x01:Frames 0x02:Bytes 0x04:TOC 0x08:Quality
+// uint32   Frames;         不包括Xing帧本身
+// uint32   Bytes;          包括Xing帧
+// uint8    TOC[100];       TOC[i]*Bytes/256 为第i%时长对应的字节偏移
+// uint32   Quality;
+
+// LAME tag(紧跟在Xing header之后)
+// char     Encoder[9];     "LAME3.99r"
+// uint8    Revision(4) | VBR method(4)
+// uint8    Lowpass;
+// uint32   Peak signal amplitude;
+// uint16   Radio replay gain;
+// uint16   Audiophile replay gain;
+// uint8    Encoding flags(4) | ATH type(4)
+// uint8    Bitrate;
+// uint24   Encoder delay(12) | Encoder padding(12)
+// ......
+
+// VBRI header(Fraunhofer), 固定位于帧头后32字节
+// char     ID[4];          "VBRI"
+// uint16   Version;
+// uint16   Delay;
+// uint16   Quality;
+// uint32   Bytes;
+// uint32   Frames;
+// uint16   TOC entries;
+// uint16   TOC scale factor;
+// uint16   TOC entry size;     1-4 bytes
+// uint16   Frames per TOC entry;
+// uint8    TOC[entries * entry size];
+
+const (
+    XING_FLAG_FRAMES  = 0x01
+    XING_FLAG_BYTES   = 0x02
+    XING_FLAG_TOC     = 0x04
+    XING_FLAG_QUALITY = 0x08
+)
+
+const VBRI_OFFSET = 4 + 32
+
+// MP3VBRHeader Xing/Info/VBRI 公共接口
+// 时间单位为ms, SeekOffset返回相对于VBR header所在帧起始位置的字节偏移
+type MP3VBRHeader interface {
+    FrameCount() uint32
+    Duration() uint64
+    SeekOffset(ms uint64) int64
+}
+
+type XingHeader struct {
+    Head            *MP3FrameHead
+    Id              string
+    Flags           uint32
+    Frames          uint32
+    Bytes           uint32
+    Toc             []uint8
+    Quality         uint32
+    Encoder         string //LAME tag
+    Encoder_delay   uint16
+    Encoder_padding uint16
+}
+
+// XingOffset Xing header相对帧起始位置的偏移(ffmpeg xing_offtbl)
+func XingOffset(head *MP3FrameHead) int {
+    mono := head.GetChannelCount() == 1
+    if head.Version == VERSION_MPEG_1 {
+        if mono {
+            return 4 + 17
+        }
+        return 4 + 32
+    }
+    if mono {
+        return 4 + 9
+    }
+    return 4 + 17
+}
+
+// DecodeXingHeader frame为包含Xing/Info的完整mp3帧
+func DecodeXingHeader(frame []byte) (*XingHeader, error) {
+    head, err := DecodeMp3Head(frame)
+    if err != nil {
+        return nil, err
+    }
+    offset := XingOffset(head)
+    if len(frame) < offset+8 {
+        return nil, errors.New("not found xing header")
+    }
+    id := string(frame[offset : offset+4])
+    if id != "Xing" && id != "Info" {
+        return nil, errors.New("not found xing header")
+    }
+    xing := &XingHeader{Head: head, Id: id}
+    data := frame[offset+4:]
+    readUint32 := func() (uint32, error) {
+        if len(data) < 4 {
+            return 0, errors.New("xing header is truncated")
+        }
+        v := binary.BigEndian.Uint32(data)
+        data = data[4:]
+        return v, nil
+    }
+    if xing.Flags, err = readUint32(); err != nil {
+        return nil, err
+    }
+    if xing.Flags&XING_FLAG_FRAMES > 0 {
+        if xing.Frames, err = readUint32(); err != nil {
+            return nil, err
+        }
+    }
+    if xing.Flags&XING_FLAG_BYTES > 0 {
+        if xing.Bytes, err = readUint32(); err != nil {
+            return nil, err
+        }
+    }
+    if xing.Flags&XING_FLAG_TOC > 0 {
+        if len(data) < 100 {
+            return nil, errors.New("xing header is truncated")
+        }
+        xing.Toc = make([]uint8, 100)
+        copy(xing.Toc, data[:100])
+        data = data[100:]
+    }
+    if xing.Flags&XING_FLAG_QUALITY > 0 {
+        if xing.Quality, err = readUint32(); err != nil {
+            return nil, err
+        }
+    }
+    if len(data) >= 24 {
+        encoder := string(data[:4])
+        if encoder == "LAME" || encoder == "Lavf" || encoder == "Lavc" {
+            xing.Encoder = string(data[:9])
+            xing.Encoder_delay = uint16(data[21])<<4 | uint16(data[22])>>4
+            xing.Encoder_padding = uint16(data[22]&0x0F)<<8 | uint16(data[23])
+        }
+    }
+    return xing, nil
+}
+
+func (xing *XingHeader) IsVBR() bool {
+    return xing.Id == "Xing"
+}
+
+func (xing *XingHeader) FrameCount() uint32 {
+    return xing.Frames
+}
+
+// TotalSamples 去除了编码器的delay和padding
+func (xing *XingHeader) TotalSamples() uint64 {
+    samples := uint64(xing.Frames) * uint64(xing.Head.SampleSize)
+    skip := uint64(xing.Encoder_delay) + uint64(xing.Encoder_padding)
+    if samples > skip {
+        samples -= skip
+    }
+    return samples
+}
+
+func (xing *XingHeader) Duration() uint64 {
+    rate := xing.Head.GetSampleRate()
+    if rate == 0 {
+        return 0
+    }
+    return xing.TotalSamples() * 1000 / uint64(rate)
+}
+
+// SeekOffset 使用TOC做线性插值, 没有TOC时按照平均码率计算
+func (xing *XingHeader) SeekOffset(ms uint64) int64 {
+    duration := uint64(xing.Frames) * uint64(xing.Head.SampleSize) * 1000 / uint64(xing.Head.GetSampleRate())
+    if duration == 0 || xing.Bytes == 0 {
+        return 0
+    }
+    if ms >= duration {
+        return int64(xing.Bytes)
+    }
+    percent := float64(ms) * 100 / float64(duration)
+    if len(xing.Toc) < 100 {
+        return int64(percent / 100 * float64(xing.Bytes))
+    }
+    a := int(percent)
+    if a > 99 {
+        a = 99
+    }
+    fa := float64(xing.Toc[a])
+    fb := 256.0
+    if a < 99 {
+        fb = float64(xing.Toc[a+1])
+    }
+    fx := fa + (fb-fa)*(percent-float64(a))
+    return int64(fx / 256 * float64(xing.Bytes))
+}
+
+type VBRIHeader struct {
+    Head             *MP3FrameHead
+    Version          uint16
+    Delay            uint16
+    Quality          uint16
+    Bytes            uint32
+    Frames           uint32
+    Toc_scale        uint16
+    Toc_entry_size   uint16
+    Frames_per_entry uint16
+    Toc              []uint32 //每个entry对应的字节数, 已经乘以Toc_scale
+}
+
+func DecodeVBRIHeader(frame []byte) (*VBRIHeader, error) {
+    head, err := DecodeMp3Head(frame)
+    if err != nil {
+        return nil, err
+    }
+    if len(frame) < VBRI_OFFSET+26 || string(frame[VBRI_OFFSET:VBRI_OFFSET+4]) != "VBRI" {
+        return nil, errors.New("not found vbri header")
+    }
+    data := frame[VBRI_OFFSET+4:]
+    vbri := &VBRIHeader{Head: head}
+    vbri.Version = binary.BigEndian.Uint16(data)
+    vbri.Delay = binary.BigEndian.Uint16(data[2:])
+    vbri.Quality = binary.BigEndian.Uint16(data[4:])
+    vbri.Bytes = binary.BigEndian.Uint32(data[6:])
+    vbri.Frames = binary.BigEndian.Uint32(data[10:])
+    entries := int(binary.BigEndian.Uint16(data[14:]))
+    vbri.Toc_scale = binary.BigEndian.Uint16(data[16:])
+    vbri.Toc_entry_size = binary.BigEndian.Uint16(data[18:])
+    vbri.Frames_per_entry = binary.BigEndian.Uint16(data[20:])
+    data = data[22:]
+    if vbri.Toc_entry_size < 1 || vbri.Toc_entry_size > 4 {
+        return nil, errors.New("invalid vbri toc entry size")
+    }
+    if len(data) < entries*int(vbri.Toc_entry_size) {
+        return nil, errors.New("vbri header is truncated")
+    }
+    vbri.Toc = make([]uint32, entries)
+    for i := 0; i < entries; i++ {
+        var v uint32
+        for j := 0; j < int(vbri.Toc_entry_size); j++ {
+            v = v<<8 | uint32(data[j])
+        }
+        data = data[vbri.Toc_entry_size:]
+        vbri.Toc[i] = v * uint32(vbri.Toc_scale)
+    }
+    return vbri, nil
+}
+
+func (vbri *VBRIHeader) FrameCount() uint32 {
+    return vbri.Frames
+}
+
+func (vbri *VBRIHeader) Duration() uint64 {
+    rate := vbri.Head.GetSampleRate()
+    if rate == 0 {
+        return 0
+    }
+    return uint64(vbri.Frames) * uint64(vbri.Head.SampleSize) * 1000 / uint64(rate)
+}
+
+// SeekOffset 每个TOC entry覆盖Frames_per_entry帧, entry内部线性插值
+func (vbri *VBRIHeader) SeekOffset(ms uint64) int64 {
+    rate := uint64(vbri.Head.GetSampleRate())
+    if rate == 0 || vbri.Frames_per_entry == 0 || len(vbri.Toc) == 0 {
+        return 0
+    }
+    entryDuration := uint64(vbri.Frames_per_entry) * uint64(vbri.Head.SampleSize) * 1000 / rate
+    if entryDuration == 0 {
+        return 0
+    }
+    var offset int64
+    for _, size := range vbri.Toc {
+        if ms < entryDuration {
+            return offset + int64(uint64(size)*ms/entryDuration)
+        }
+        offset += int64(size)
+        ms -= entryDuration
+    }
+    return offset
+}
+
+// DecodeMP3VBRHeader 依次尝试Xing/Info和VBRI
+func DecodeMP3VBRHeader(frame []byte) (MP3VBRHeader, error) {
+    if xing, err := DecodeXingHeader(frame); err == nil {
+        return xing, nil
+    }
+    if vbri, err := DecodeVBRIHeader(frame); err == nil {
+        return vbri, nil
+    }
+    return nil, errors.New("not found mp3 vbr header")
+}
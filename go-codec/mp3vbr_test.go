@@ -0,0 +1,144 @@
+package codec
+
+import (
+    "encoding/binary"
+    "testing"
+)
+
+func makeXingFrame(head []byte, size int, offset int, id string, flags uint32, frames uint32, bytes uint32, lame bool) []byte {
+    frame := make([]byte, size)
+    copy(frame, head)
+    p := frame[offset:]
+    copy(p, id)
+    binary.BigEndian.PutUint32(p[4:], flags)
+    p = p[8:]
+    if flags&XING_FLAG_FRAMES > 0 {
+        binary.BigEndian.PutUint32(p, frames)
+        p = p[4:]
+    }
+    if flags&XING_FLAG_BYTES > 0 {
+        binary.BigEndian.PutUint32(p, bytes)
+        p = p[4:]
+    }
+    if flags&XING_FLAG_TOC > 0 {
+        for i := 0; i < 100; i++ {
+            p[i] = uint8(i * 256 / 100)
+        }
+        p = p[100:]
+    }
+    if flags&XING_FLAG_QUALITY > 0 {
+        binary.BigEndian.PutUint32(p, 50)
+        p = p[4:]
+    }
+    if lame {
+        copy(p, "LAME3.99r")
+        //delay 576, padding 1000
+        p[21], p[22], p[23] = 0x24, 0x03, 0xE8
+    }
+    return frame
+}
+
+func TestDecodeXingHeader(t *testing.T) {
+    tests := []struct {
+        name     string
+        frame    []byte
+        id       string
+        frames   uint32
+        duration uint64
+        seek     [][2]uint64
+    }{
+        {
+            name:     "mpeg1 stereo xing with lame tag",
+            frame:    makeXingFrame([]byte{0xFF, 0xFB, 0x90, 0x00}, 417, 36, "Xing", 0x0F, 100, 42117, true),
+            id:       "Xing",
+            frames:   100,
+            duration: 2576,
+            seek:     [][2]uint64{{0, 0}, {1306, 21058}, {5000, 42117}},
+        },
+        {
+            name:     "mpeg2 mono info",
+            frame:    makeXingFrame([]byte{0xFF, 0xF3, 0x80, 0xC0}, 208, 13, "Info", XING_FLAG_FRAMES|XING_FLAG_BYTES, 10, 2080, false),
+            id:       "Info",
+            frames:   10,
+            duration: 261,
+            seek:     [][2]uint64{{130, 1036}},
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            vbr, err := DecodeMP3VBRHeader(tt.frame)
+            if err != nil {
+                t.Fatal(err)
+            }
+            xing, ok := vbr.(*XingHeader)
+            if !ok || xing.Id != tt.id || xing.FrameCount() != tt.frames || xing.Duration() != tt.duration {
+                t.Fatalf("DecodeMP3VBRHeader() = %+v, duration %d", vbr, vbr.Duration())
+            }
+            for _, s := range tt.seek {
+                if got := xing.SeekOffset(s[0]); got != int64(s[1]) {
+                    t.Errorf("SeekOffset(%d) = %d, want %d", s[0], got, s[1])
+                }
+            }
+        })
+    }
+    if _, err := DecodeXingHeader(make([]byte, 4)); err == nil {
+        t.Errorf("expected error for invalid frame")
+    }
+}
+
+func TestDecodeVBRIHeader(t *testing.T) {
+    frame := make([]byte, 417)
+    copy(frame, []byte{0xFF, 0xFB, 0x90, 0x00})
+    p := frame[VBRI_OFFSET:]
+    copy(p, "VBRI")
+    binary.BigEndian.PutUint16(p[4:], 1)
+    binary.BigEndian.PutUint16(p[6:], 0x0481)
+    binary.BigEndian.PutUint16(p[8:], 75)
+    binary.BigEndian.PutUint32(p[10:], 40417)
+    binary.BigEndian.PutUint32(p[14:], 100)
+    binary.BigEndian.PutUint16(p[18:], 4)
+    binary.BigEndian.PutUint16(p[20:], 2)
+    binary.BigEndian.PutUint16(p[22:], 2)
+    binary.BigEndian.PutUint16(p[24:], 25)
+    for i := 0; i < 4; i++ {
+        binary.BigEndian.PutUint16(p[26+i*2:], 5000)
+    }
+    vbr, err := DecodeMP3VBRHeader(frame)
+    if err != nil {
+        t.Fatal(err)
+    }
+    vbri, ok := vbr.(*VBRIHeader)
+    if !ok || vbri.Frames != 100 || vbri.Bytes != 40417 || len(vbri.Toc) != 4 || vbri.Toc[3] != 10000 || vbri.Duration() != 2612 {
+        t.Fatalf("DecodeVBRIHeader() = %+v", vbr)
+    }
+    for _, s := range [][2]int64{{0, 0}, {979, 14992}, {3000, 40000}} {
+        if got := vbri.SeekOffset(uint64(s[0])); got != s[1] {
+            t.Errorf("SeekOffset(%d) = %d, want %d", s[0], got, s[1])
+        }
+    }
+}
+
+func TestSplitMp3Frames(t *testing.T) {
+    frame := make([]byte, 417)
+    copy(frame, []byte{0xFF, 0xFB, 0x90, 0x00})
+    var data []byte
+    // ID3v2.4 with footer
+    data = append(data, 'I', 'D', '3', 4, 0, ID3V2_FLAG_FOOTER, 0, 0, 0, 11)
+    data = append(data, 'T', 'I', 'T', '2', 0, 0, 0, 1, 0, 0, 0)
+    data = append(data, '3', 'D', 'I', 4, 0, ID3V2_FLAG_FOOTER, 0, 0, 0, 11)
+    data = append(data, frame...)
+    data = append(data, frame...)
+    tag := make([]byte, 128)
+    copy(tag, "TAG")
+    data = append(data, tag...)
+    n := 0
+    err := SplitMp3Frames(data, func(head *MP3FrameHead, f []byte) {
+        if len(f) != 417 || head.GetChannelCount() != 2 {
+            t.Errorf("frame size %d channels %d", len(f), head.GetChannelCount())
+        }
+        n++
+    })
+    if err != nil || n != 2 {
+        t.Errorf("SplitMp3Frames() = %d frames, err %v", n, err)
+    }
+}
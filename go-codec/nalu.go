@@ -0,0 +1,216 @@
+package codec
+
+import (
+    "bytes"
+    "errors"
+)
+
+var errNaluLengthOutOfRange = errors.New("nalu length out of range")
+var errNaluLengthSize = errors.New("unsupported nalu length size")
+
+// NaluIterator 遍历Annex-B或者长度前缀(AVCC/HVCC, 1/2/4字节长度)格式的码流, 不分配内存
+//
+//	it := codec.NewAnnexBNaluIterator(frame)
+//	for it.Next() {
+//	    nalu := it.Nalu()
+//	}
+//	if it.Err() != nil {
+//	}
+type NaluIterator struct {
+    data       []byte
+    offset     int
+    lengthSize int
+    nalu       []byte
+    start      int //当前nalu的startcode或者长度前缀在data中的位置
+    err        error
+}
+
+func NewAnnexBNaluIterator(data []byte) NaluIterator {
+    return NaluIterator{data: data}
+}
+
+// lengthSize 为 1,2,4, 对应avcC/hvcC中的lengthSizeMinusOne+1
+func NewLengthPrefixedNaluIterator(data []byte, lengthSize int) NaluIterator {
+    it := NaluIterator{data: data, lengthSize: lengthSize}
+    if lengthSize != 1 && lengthSize != 2 && lengthSize != 4 {
+        it.err = errNaluLengthSize
+    }
+    return it
+}
+
+// 复用iterator遍历新的数据, 格式不变
+func (it *NaluIterator) Reset(data []byte) {
+    it.data = data
+    it.offset = 0
+    it.nalu = nil
+    if it.err == errNaluLengthOutOfRange {
+        it.err = nil
+    }
+}
+
+func (it *NaluIterator) Next() bool {
+    it.nalu = nil
+    if it.err != nil {
+        return false
+    }
+    if it.lengthSize == 0 {
+        return it.nextAnnexB()
+    }
+    return it.nextLengthPrefixed()
+}
+
+func (it *NaluIterator) nextAnnexB() bool {
+    for it.offset < len(it.data) {
+        idx := bytes.Index(it.data[it.offset:], []byte{0x00, 0x00, 0x01})
+        it.start = it.offset
+        if idx < 0 {
+            // 没有startcode时整段数据作为一个nalu
+            it.nalu = trimTrailingZero(it.data[it.offset:])
+            it.offset = len(it.data)
+        } else if idx > 0 {
+            it.nalu = trimTrailingZero(it.data[it.offset : it.offset+idx])
+            it.offset += idx
+        } else {
+            //4字节startcode的第一个0x00
+            if it.start > 0 && it.data[it.start-1] == 0x00 {
+                it.start--
+            }
+            begin := it.offset + 3
+            end := bytes.Index(it.data[begin:], []byte{0x00, 0x00, 0x01})
+            if end < 0 {
+                it.nalu = trimTrailingZero(it.data[begin:])
+                it.offset = len(it.data)
+            } else {
+                it.nalu = trimTrailingZero(it.data[begin : begin+end])
+                it.offset = begin + end
+            }
+        }
+        if len(it.nalu) > 0 {
+            return true
+        }
+    }
+    it.nalu = nil
+    return false
+}
+
+// startcode前的0x00属于4字节startcode或者trailing_zero_8bits
+func trimTrailingZero(nalu []byte) []byte {
+    end := len(nalu)
+    for end > 0 && nalu[end-1] == 0x00 {
+        end--
+    }
+    return nalu[:end]
+}
+
+func (it *NaluIterator) nextLengthPrefixed() bool {
+    for it.offset < len(it.data) {
+        if it.offset+it.lengthSize > len(it.data) {
+            it.err = errNaluLengthOutOfRange
+            return false
+        }
+        it.start = it.offset
+        size := 0
+        for i := 0; i < it.lengthSize; i++ {
+            size = size<<8 | int(it.data[it.offset+i])
+        }
+        it.offset += it.lengthSize
+        if size > len(it.data)-it.offset {
+            it.err = errNaluLengthOutOfRange
+            return false
+        }
+        it.nalu = it.data[it.offset : it.offset+size]
+        it.offset += size
+        if size > 0 {
+            return true
+        }
+    }
+    return false
+}
+
+// 当前nalu, 不包含startcode或者长度前缀, 指向原始数据
+func (it *NaluIterator) Nalu() []byte {
+    return it.nalu
+}
+
+// 当前nalu的startcode(4字节startcode从第一个0x00开始)或者长度前缀在数据中的位置
+// 用来在nalu边界切分数据, data[:StartCodeOffset()]是当前nalu之前的所有nalu
+func (it *NaluIterator) StartCodeOffset() int {
+    return it.start
+}
+
+func (it *NaluIterator) Err() error {
+    return it.err
+}
+
+func (it *NaluIterator) H264NaluType() H264_NAL_TYPE {
+    return H264NaluTypeWithoutStartCode(it.nalu)
+}
+
+func (it *NaluIterator) H265NaluType() H265_NAL_TYPE {
+    return H265NaluTypeWithoutStartCode(it.nalu)
+}
+
+func (it *NaluIterator) H264Header() H264NaluHdr {
+    if len(it.nalu) == 0 {
+        return H264NaluHdr{}
+    }
+    b := it.nalu[0]
+    return H264NaluHdr{
+        Forbidden_zero_bit: b >> 7,
+        Nal_ref_idc:        (b >> 5) & 0x03,
+        Nal_unit_type:      b & 0x1F,
+    }
+}
+
+func (it *NaluIterator) H265Header() H265NaluHdr {
+    if len(it.nalu) == 0 {
+        return H265NaluHdr{}
+    }
+    if len(it.nalu) < 2 {
+        return H265NaluHdr{Forbidden_zero_bit: it.nalu[0] >> 7, Nal_unit_type: (it.nalu[0] >> 1) & 0x3F}
+    }
+    return H265NaluHdr{
+        Forbidden_zero_bit:    it.nalu[0] >> 7,
+        Nal_unit_type:         (it.nalu[0] >> 1) & 0x3F,
+        Nuh_layer_id:          (it.nalu[0]&0x01)<<5 | it.nalu[1]>>3,
+        Nuh_temporal_id_plus1: it.nalu[1] & 0x07,
+    }
+}
+
+// 去掉防竞争字节后的当前nalu(包含nalu header)
+// 没有防竞争字节时直接返回Nalu(), 否则写入buf[:0]并返回, buf容量足够时不分配内存
+func (it *NaluIterator) Rbsp(buf []byte) []byte {
+    return RbspView(it.nalu, buf)
+}
+
+// 去掉0x000003中的0x03, nalu中不存在防竞争字节时返回nalu本身
+// 否则结果写入buf[:0], buf容量足够时不分配内存
+func RbspView(nalu []byte, buf []byte) []byte {
+    idx := indexEmulationPrevention(nalu, 0)
+    if idx < 0 {
+        return nalu
+    }
+    return appendRbsp(buf[:0], nalu, idx)
+}
+
+func appendRbsp(dst []byte, nalu []byte, idx int) []byte {
+    start := 0
+    for idx >= 0 {
+        dst = append(dst, nalu[start:idx+2]...)
+        start = idx + 3
+        idx = indexEmulationPrevention(nalu, start)
+    }
+    return append(dst, nalu[start:]...)
+}
+
+// 返回0x000003的位置
+func indexEmulationPrevention(nalu []byte, offset int) int {
+    if offset+3 > len(nalu) {
+        return -1
+    }
+    idx := bytes.Index(nalu[offset:], []byte{0x00, 0x00, 0x03})
+    if idx < 0 {
+        return -1
+    }
+    return offset + idx
+}
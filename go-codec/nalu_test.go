@@ -0,0 +1,242 @@
+package codec
+
+import (
+    "bytes"
+    "reflect"
+    "testing"
+)
+
+func TestNaluIterator_AnnexB(t *testing.T) {
+    tests := []struct {
+        name  string
+        frame []byte
+        want  [][]byte
+    }{
+        {
+            name:  "3 and 4 bytes startcode",
+            frame: []byte{0x00, 0x00, 0x00, 0x01, 0x67, 0x42, 0x00, 0x00, 0x01, 0x68, 0xce, 0x00, 0x00, 0x00, 0x01, 0x65, 0x88},
+            want:  [][]byte{{0x67, 0x42}, {0x68, 0xce}, {0x65, 0x88}},
+        },
+        {
+            name:  "trailing zero",
+            frame: []byte{0x00, 0x00, 0x01, 0x09, 0xf0, 0x00, 0x00, 0x00, 0x00, 0x00, 0x01, 0x41, 0x9a, 0x00},
+            want:  [][]byte{{0x09, 0xf0}, {0x41, 0x9a}},
+        },
+        {
+            name:  "without startcode",
+            frame: []byte{0x41, 0x9a, 0x00, 0x00, 0x03, 0x01},
+            want:  [][]byte{{0x41, 0x9a, 0x00, 0x00, 0x03, 0x01}},
+        },
+        {
+            name:  "empty nalu",
+            frame: []byte{0x00, 0x00, 0x01, 0x00, 0x00, 0x01},
+            want:  nil,
+        },
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var got [][]byte
+            it := NewAnnexBNaluIterator(tt.frame)
+            for it.Next() {
+                got = append(got, it.Nalu())
+            }
+            if it.Err() != nil {
+                t.Fatal(it.Err())
+            }
+            if !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("NaluIterator = %x, want %x", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestNaluIterator_LengthPrefixed(t *testing.T) {
+    nalus := [][]byte{{0x40, 0x01, 0x0c}, {0x42, 0x01}, {0x26, 0x01, 0xaf, 0x00, 0x00, 0x03, 0x01}}
+    for _, lengthSize := range []int{1, 2, 4} {
+        var data []byte
+        for _, nalu := range nalus {
+            for i := lengthSize - 1; i >= 0; i-- {
+                data = append(data, byte(len(nalu)>>(8*i)))
+            }
+            data = append(data, nalu...)
+        }
+        it := NewLengthPrefixedNaluIterator(data, lengthSize)
+        var got [][]byte
+        for it.Next() {
+            got = append(got, it.Nalu())
+        }
+        if it.Err() != nil || !reflect.DeepEqual(got, nalus) {
+            t.Errorf("lengthSize %d: NaluIterator = %x, err %v", lengthSize, got, it.Err())
+        }
+
+        it.Reset(data[:len(data)-1])
+        n := 0
+        for it.Next() {
+            n++
+        }
+        if n != 2 || it.Err() == nil {
+            t.Errorf("lengthSize %d: truncated data got %d nalus, err %v", lengthSize, n, it.Err())
+        }
+    }
+    it := NewLengthPrefixedNaluIterator([]byte{0x00, 0x00, 0x01, 0x65}, 3)
+    if it.Next() || it.Err() == nil {
+        t.Errorf("lengthSize 3 should be rejected")
+    }
+}
+
+func TestNaluIterator_Header(t *testing.T) {
+    it := NewAnnexBNaluIterator([]byte{0x00, 0x00, 0x01, 0x65, 0x88})
+    it.Next()
+    if hdr := it.H264Header(); hdr != (H264NaluHdr{Nal_ref_idc: 3, Nal_unit_type: 5}) || it.H264NaluType() != H264_NAL_I_SLICE {
+        t.Errorf("H264Header() = %+v", hdr)
+    }
+    it = NewAnnexBNaluIterator([]byte{0x00, 0x00, 0x01, 0x03, 0x0a, 0xaf})
+    it.Next()
+    if hdr := it.H265Header(); hdr != (H265NaluHdr{Nal_unit_type: 1, Nuh_layer_id: 33, Nuh_temporal_id_plus1: 2}) {
+        t.Errorf("H265Header() = %+v", hdr)
+    }
+}
+
+func TestRbspView(t *testing.T) {
+    tests := []struct {
+        name string
+        nalu []byte
+        want []byte
+    }{
+        {name: "no emulation", nalu: []byte{0x67, 0x00, 0x00, 0x04}, want: []byte{0x67, 0x00, 0x00, 0x04}},
+        {name: "one", nalu: []byte{0x67, 0x00, 0x00, 0x03, 0x01, 0x02}, want: []byte{0x67, 0x00, 0x00, 0x01, 0x02}},
+        {name: "continuous", nalu: []byte{0x00, 0x00, 0x03, 0x00, 0x00, 0x03, 0x00}, want: []byte{0x00, 0x00, 0x00, 0x00, 0x00}},
+        {name: "at the end", nalu: []byte{0x06, 0x00, 0x00, 0x03}, want: []byte{0x06, 0x00, 0x00}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            buf := make([]byte, 0, 16)
+            if got := RbspView(tt.nalu, buf); !bytes.Equal(got, tt.want) {
+                t.Errorf("RbspView() = %x, want %x", got, tt.want)
+            }
+            if got := CovertRbspToSodb(tt.nalu); !bytes.Equal(got, tt.want) {
+                t.Errorf("CovertRbspToSodb() = %x, want %x", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestNaluIterator_Allocs(t *testing.T) {
+    frame := append([]byte{}, sps...)
+    frame = append(frame, pps...)
+    frame = append(frame, 0x00, 0x00, 0x01, 0x26, 0x01, 0x00, 0x00, 0x03, 0x01)
+    buf := make([]byte, 0, 256)
+    allocs := testing.AllocsPerRun(100, func() {
+        it := NewAnnexBNaluIterator(frame)
+        for it.Next() {
+            _ = it.H265Header()
+            _ = it.Rbsp(buf)
+        }
+    })
+    if allocs != 0 {
+        t.Errorf("NaluIterator allocs = %v, want 0", allocs)
+    }
+}
+
+func TestNaluIterator_EmptyHeader(t *testing.T) {
+    it := NewAnnexBNaluIterator([]byte{0x00, 0x00, 0x01})
+    if hdr := it.H264Header(); hdr != (H264NaluHdr{}) {
+        t.Errorf("H264Header() = %+v", hdr)
+    }
+    if hdr := it.H265Header(); hdr != (H265NaluHdr{}) {
+        t.Errorf("H265Header() = %+v", hdr)
+    }
+    if it.Next() {
+        t.Fatalf("Next() = true, nalu %x", it.Nalu())
+    }
+    if it.H264Header() != (H264NaluHdr{}) || it.H265Header() != (H265NaluHdr{}) {
+        t.Errorf("header of exhausted iterator is not zero")
+    }
+}
+
+func TestNaluIterator_StartCodeOffset(t *testing.T) {
+    frame := []byte{0xaa, 0x00, 0x00, 0x00, 0x01, 0x09, 0xf0, 0x00, 0x00, 0x01, 0x65, 0x88, 0x00, 0x00, 0x00, 0x00, 0x01, 0x41, 0x9a}
+    var got []int
+    it := NewAnnexBNaluIterator(frame)
+    for it.Next() {
+        got = append(got, it.StartCodeOffset())
+    }
+    if want := []int{0, 1, 7, 13}; !reflect.DeepEqual(got, want) {
+        t.Errorf("StartCodeOffset() = %v, want %v", got, want)
+    }
+
+    got = got[:0]
+    it = NewLengthPrefixedNaluIterator([]byte{0x00, 0x02, 0x09, 0xf0, 0x00, 0x00, 0x00, 0x01, 0x65}, 2)
+    for it.Next() {
+        got = append(got, it.StartCodeOffset())
+    }
+    if want := []int{0, 6}; !reflect.DeepEqual(got, want) {
+        t.Errorf("StartCodeOffset() = %v, want %v", got, want)
+    }
+}
+
+func TestSplitFrame(t *testing.T) {
+    frame := []byte{0xaa, 0x00, 0x00, 0x01, 0x09, 0xf0, 0x00, 0x00, 0x00, 0x01, 0x00, 0x00, 0x01, 0x65, 0x88, 0x00, 0x00}
+    var got [][]byte
+    SplitFrame(frame, func(nalu []byte) bool {
+        got = append(got, nalu)
+        return true
+    })
+    if want := [][]byte{{0x09, 0xf0}, {0x65, 0x88}}; !reflect.DeepEqual(got, want) {
+        t.Errorf("SplitFrame() = %x, want %x", got, want)
+    }
+}
+
+// 以前基于FindStartCode的SplitFrame, 用来对比性能
+func splitFrameByFindStartCode(frames []byte, onFrame func(nalu []byte) bool) {
+    beg, sc := FindStartCode(frames, 0)
+    for beg >= 0 {
+        end, sc2 := FindStartCode(frames, beg+int(sc))
+        if end == -1 {
+            onFrame(frames[beg+int(sc):])
+            break
+        }
+        if !onFrame(frames[beg+int(sc) : end]) {
+            break
+        }
+        beg = end
+        sc = sc2
+    }
+}
+
+func benchmarkFrame() []byte {
+    frame := append([]byte{}, sps...)
+    frame = append(frame, pps...)
+    for i := 0; i < 8; i++ {
+        slice := bytes.Repeat([]byte{0x9a, 0x21, 0x44, 0x0b}, 4096)
+        frame = append(append(frame, 0x00, 0x00, 0x00, 0x01, 0x41), slice...)
+    }
+    return frame
+}
+
+func BenchmarkSplitFrame(b *testing.B) {
+    frame := benchmarkFrame()
+    b.Run("FindStartCode", func(b *testing.B) {
+        b.SetBytes(int64(len(frame)))
+        for i := 0; i < b.N; i++ {
+            splitFrameByFindStartCode(frame, func(nalu []byte) bool { return true })
+        }
+    })
+    b.Run("NaluIterator", func(b *testing.B) {
+        b.SetBytes(int64(len(frame)))
+        for i := 0; i < b.N; i++ {
+            SplitFrame(frame, func(nalu []byte) bool { return true })
+        }
+    })
+}
+
+func BenchmarkLengthToAnnexBFilter(b *testing.B) {
+    toAvcc, _ := NewAnnexBToLengthFilter(4)
+    avcc, _ := toAvcc.Filter(benchmarkFrame())
+    f, _ := NewLengthToAnnexBFilter(CODECID_VIDEO_H264, nil)
+    b.SetBytes(int64(len(avcc)))
+    b.ReportAllocs()
+    for i := 0; i < b.N; i++ {
+        f.Filter(avcc)
+    }
+}
@@ -3,6 +3,7 @@ package codec
 import (
     "encoding/binary"
     "errors"
+    "fmt"
 )
 
 // rfc6716 https://datatracker.ietf.org/doc/html/rfc6716
@@ -165,7 +166,11 @@ var (
     CELTOpusSampleSize   [4]int = [4]int{120, 210, 480, 960}
 )
 
+// OpusPacketDuration 返回packet包含的采样数(48kHz), packet无效时返回0
 func OpusPacketDuration(packet []byte) uint64 {
+    if len(packet) < 1 {
+        return 0
+    }
     config := int(packet[0] >> 3)
     code := packet[0] & 0x03
     frameCount := 0
@@ -174,10 +179,11 @@ func OpusPacketDuration(packet []byte) uint64 {
         frameCount = 1
     } else if code == 1 || code == 2 {
         frameCount = 2
-    } else if code == 3 {
-        frameCount = int(packet[1] & 0x1F)
     } else {
-        panic("code must <= 3")
+        if len(packet) < 2 {
+            return 0
+        }
+        frameCount = int(packet[1] & 0x1F)
     }
 
     switch {
@@ -185,10 +191,8 @@ func OpusPacketDuration(packet []byte) uint64 {
         duration = uint64(frameCount * SLKOpusSampleSize[config%4])
     case config >= 12 && config < 16:
         duration = uint64(frameCount * HybridOpusSampleSize[config%2])
-    case config >= 16 && config < 32:
-        duration = uint64(frameCount * CELTOpusSampleSize[config%4])
     default:
-        panic("unkown opus config")
+        duration = uint64(frameCount * CELTOpusSampleSize[config%4])
     }
 
     return duration
@@ -206,7 +210,26 @@ type OpusPacket struct {
     Duration   uint64
 }
 
-func DecodeOpusPacket(packet []byte) *OpusPacket {
+// 3.2.1 Frame Length Coding
+func opusFrameLength(packet []byte, offset int) (length int, n int, err error) {
+    if offset >= len(packet) {
+        return 0, 0, &ParseError{What: "opus frame length", Offset: offset, Err: ErrTruncated}
+    }
+    length = int(packet[offset])
+    if length < 252 {
+        return length, 1, nil
+    }
+    if offset+1 >= len(packet) {
+        return 0, 0, &ParseError{What: "opus frame length", Offset: offset + 1, Err: ErrTruncated}
+    }
+    return length + int(packet[offset+1])*4, 2, nil
+}
+
+// ParseOpusPacket 解析opus packet(rfc6716 3.2), 长度字段与packet不符时返回错误
+func ParseOpusPacket(packet []byte) (*OpusPacket, error) {
+    if len(packet) < 1 {
+        return nil, &ParseError{What: "opus toc", Offset: 0, Err: ErrTruncated}
+    }
     pkt := &OpusPacket{}
     pkt.Code = int(packet[0] & 0x03)
     pkt.Stereo = int((packet[0] >> 2) & 0x01)
@@ -215,63 +238,95 @@ func DecodeOpusPacket(packet []byte) *OpusPacket {
     switch pkt.Code {
     case 0:
         pkt.FrameCount = 1
-        pkt.FrameLen = make([]uint16, 1)
-        pkt.FrameLen[0] = uint16(len(packet) - 1)
+        pkt.FrameLen = []uint16{uint16(len(packet) - 1)}
         pkt.Frame = packet[1:]
     case 1:
+        if (len(packet)-1)%2 != 0 {
+            return nil, fmt.Errorf("opus packet: %w: code 1 with odd payload length", ErrInvalidData)
+        }
         pkt.FrameCount = 2
-        pkt.FrameLen = make([]uint16, 1)
-        pkt.FrameLen[0] = uint16(len(packet)-1) / 2
+        pkt.FrameLen = []uint16{uint16(len(packet)-1) / 2}
         pkt.Frame = packet[1:]
     case 2:
         pkt.FrameCount = 2
-        hdr := 1
-        N1 := int(packet[1])
-        if N1 >= 252 {
-            N1 = N1 + int(packet[2]*4)
-            hdr = 2
+        N1, n, err := opusFrameLength(packet, 1)
+        if err != nil {
+            return nil, err
+        }
+        hdr := 1 + n
+        if hdr+N1 > len(packet) {
+            return nil, &ParseError{What: "opus packet", Offset: len(packet), Err: ErrTruncated}
         }
-        pkt.FrameLen = make([]uint16, 2)
-        pkt.FrameLen[0] = uint16(N1)
-        pkt.FrameLen[1] = uint16(len(packet)-hdr) - uint16(N1)
+        pkt.FrameLen = []uint16{uint16(N1), uint16(len(packet) - hdr - N1)}
+        pkt.Frame = packet[hdr:]
     case 3:
+        if len(packet) < 2 {
+            return nil, &ParseError{What: "opus packet", Offset: 1, Err: ErrTruncated}
+        }
         hdr := 2
         pkt.Vbr = int(packet[1] >> 7)
-        padding := packet[1] >> 6
+        padding := (packet[1] >> 6) & 0x01
         pkt.FrameCount = int(packet[1] & 0x1F)
+        if pkt.FrameCount == 0 {
+            return nil, fmt.Errorf("opus packet: %w: frame count is 0", ErrInvalidData)
+        }
         paddingLen := 0
         if padding == 1 {
-            for packet[hdr] == 255 {
-                paddingLen += 254
+            for {
+                if hdr >= len(packet) {
+                    return nil, &ParseError{What: "opus padding", Offset: hdr, Err: ErrTruncated}
+                }
+                b := packet[hdr]
                 hdr++
+                if b != 255 {
+                    paddingLen += int(b)
+                    break
+                }
+                paddingLen += 254
             }
-            paddingLen += int(packet[hdr])
         }
 
         if pkt.Vbr == 0 {
-            pkt.FrameLen = make([]uint16, 1)
-            pkt.FrameLen[0] = uint16(len(packet)-hdr-paddingLen) / uint16(pkt.FrameCount)
-            pkt.Frame = packet[hdr : hdr+int(pkt.FrameLen[0]*uint16(pkt.FrameCount))]
+            remain := len(packet) - hdr - paddingLen
+            if remain < 0 || remain%pkt.FrameCount != 0 {
+                return nil, fmt.Errorf("opus packet: %w: cbr payload length %d", ErrInvalidData, remain)
+            }
+            pkt.FrameLen = []uint16{uint16(remain / pkt.FrameCount)}
+            pkt.Frame = packet[hdr : hdr+remain]
         } else {
             n := 0
-            for i := 0; i < int(pkt.FrameCount)-1; i++ {
-                N1 := int(packet[hdr])
-                hdr += 1
-                if N1 >= 252 {
-                    N1 = N1 + int(packet[hdr]*4)
-                    hdr += 1
+            for i := 0; i < pkt.FrameCount-1; i++ {
+                N1, l, err := opusFrameLength(packet, hdr)
+                if err != nil {
+                    return nil, err
                 }
+                hdr += l
                 n += N1
                 pkt.FrameLen = append(pkt.FrameLen, uint16(N1))
             }
             lastFrameLen := len(packet) - hdr - paddingLen - n
+            if lastFrameLen < 0 {
+                return nil, &ParseError{What: "opus packet", Offset: len(packet), Err: ErrTruncated}
+            }
             pkt.FrameLen = append(pkt.FrameLen, uint16(lastFrameLen))
             pkt.Frame = packet[hdr : hdr+n+lastFrameLen]
         }
-    default:
-        panic("Error C must <= 3")
     }
-    OpusPacketDuration(packet)
+    pkt.Duration = OpusPacketDuration(packet)
+    return pkt, nil
+}
+
+// Deprecated: 使用ParseOpusPacket, packet无效时只返回toc中的信息
+func DecodeOpusPacket(packet []byte) *OpusPacket {
+    pkt, err := ParseOpusPacket(packet)
+    if err != nil {
+        pkt = &OpusPacket{}
+        if len(packet) > 0 {
+            pkt.Code = int(packet[0] & 0x03)
+            pkt.Stereo = int((packet[0] >> 2) & 0x01)
+            pkt.Config = int(packet[0] >> 3)
+        }
+    }
     return pkt
 }
 
@@ -349,11 +404,13 @@ type OpusContext struct {
 // +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
 //
 func (ctx *OpusContext) ParseExtranData(extraData []byte) error {
+    if len(extraData) < 19 {
+        return &ParseError{What: "opus head", Offset: len(extraData), Err: ErrTruncated}
+    }
     if string(extraData[0:8]) != "OpusHead" {
         return errors.New("magic signature must equal OpusHead")
     }
 
-    _ = extraData[8] // version
     ctx.ChannelCount = int(extraData[9])
     ctx.Preskip = int(binary.LittleEndian.Uint16(extraData[10:]))
     ctx.SampleRate = int(binary.LittleEndian.Uint32(extraData[12:]))
@@ -364,13 +421,23 @@ func (ctx *OpusContext) ParseExtranData(extraData []byte) error {
     if ctx.MapType == 0 {
         ctx.StreamCount = 1
         ctx.StereoStreamCount = ctx.ChannelCount - 1
+        if ctx.ChannelCount > 2 {
+            return fmt.Errorf("opus head: %w: mapping family 0 with %d channels", ErrInvalidData, ctx.ChannelCount)
+        }
         channel = []byte{0, 1}
         order = defalutOrder
     } else if ctx.MapType == 1 || ctx.MapType == 2 || ctx.MapType == 255 {
+        if len(extraData) < 21+ctx.ChannelCount {
+            return &ParseError{What: "opus channel mapping table", Offset: len(extraData), Err: ErrTruncated}
+        }
         ctx.StreamCount = int(extraData[19])
         ctx.StereoStreamCount = int(extraData[20])
+        channel = extraData[21 : 21+ctx.ChannelCount]
+        order = defalutOrder
         if ctx.MapType == 1 {
-            channel = extraData[21 : 21+ctx.ChannelCount]
+            if ctx.ChannelCount < 1 || ctx.ChannelCount > 8 {
+                return fmt.Errorf("opus head: %w: channel count %d", ErrInvalidData, ctx.ChannelCount)
+            }
             order = vorbisOrder
         }
     } else {
@@ -0,0 +1,54 @@
+package codec
+
+import (
+    "errors"
+    "reflect"
+    "testing"
+)
+
+func TestParseOpusPacket(t *testing.T) {
+    tests := []struct {
+        name     string
+        packet   []byte
+        frameLen []uint16
+        duration uint64
+        wantErr  error
+    }{
+        {name: "code 0", packet: []byte{0x78, 0x01, 0x02, 0x03}, frameLen: []uint16{3}, duration: 960},
+        {name: "code 1", packet: []byte{0x79, 0x01, 0x02, 0x03, 0x04}, frameLen: []uint16{2}, duration: 1920},
+        {name: "code 2", packet: []byte{0x7A, 0x01, 0xAA, 0xBB, 0xCC}, frameLen: []uint16{1, 2}, duration: 1920},
+        {name: "code 3 cbr", packet: []byte{0x7B, 0x03, 0x01, 0x02, 0x03}, frameLen: []uint16{1}, duration: 2880},
+        {name: "code 3 vbr padding", packet: []byte{0x7B, 0xC2, 0x01, 0x01, 0xAA, 0xBB, 0xCC, 0x00}, frameLen: []uint16{1, 2}, duration: 1920},
+        {name: "empty", packet: []byte{}, wantErr: ErrTruncated},
+        {name: "code 1 odd", packet: []byte{0x79, 0x01, 0x02, 0x03}, wantErr: ErrInvalidData},
+        {name: "code 2 truncated", packet: []byte{0x7A, 0x05, 0x01}, wantErr: ErrTruncated},
+        {name: "code 2 no length", packet: []byte{0x7A}, wantErr: ErrTruncated},
+        {name: "code 3 no count", packet: []byte{0x7B}, wantErr: ErrTruncated},
+        {name: "code 3 zero frames", packet: []byte{0x7B, 0x00}, wantErr: ErrInvalidData},
+        {name: "code 3 padding truncated", packet: []byte{0x7B, 0x41, 0xFF}, wantErr: ErrTruncated},
+        {name: "code 3 vbr truncated", packet: []byte{0x7B, 0x83, 0x10, 0x10}, wantErr: ErrTruncated},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            pkt, err := ParseOpusPacket(tt.packet)
+            if tt.wantErr != nil {
+                if !errors.Is(err, tt.wantErr) {
+                    t.Fatalf("ParseOpusPacket() error = %v, want %v", err, tt.wantErr)
+                }
+                if DecodeOpusPacket(tt.packet) == nil {
+                    t.Error("DecodeOpusPacket() = nil")
+                }
+                return
+            }
+            if err != nil {
+                t.Fatal(err)
+            }
+            if !reflect.DeepEqual(pkt.FrameLen, tt.frameLen) || pkt.Duration != tt.duration {
+                t.Errorf("ParseOpusPacket() = %v %d, want %v %d", pkt.FrameLen, pkt.Duration, tt.frameLen, tt.duration)
+            }
+        })
+    }
+    if d := OpusPacketDuration(nil); d != 0 {
+        t.Errorf("OpusPacketDuration(nil) = %d", d)
+    }
+}
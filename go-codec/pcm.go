@@ -0,0 +1,154 @@
+package codec
+
+import (
+    "encoding/binary"
+    "errors"
+)
+
+// 线性PCM工具, 采样为16bit有符号整数, 多声道时交错存放(L R L R ...)
+
+func DecodePCMS16LE(data []byte) []int16 {
+    pcm := make([]int16, len(data)/2)
+    for i := range pcm {
+        pcm[i] = int16(binary.LittleEndian.Uint16(data[i*2:]))
+    }
+    return pcm
+}
+
+func EncodePCMS16LE(pcm []int16) []byte {
+    data := make([]byte, len(pcm)*2)
+    for i, v := range pcm {
+        binary.LittleEndian.PutUint16(data[i*2:], uint16(v))
+    }
+    return data
+}
+
+func clipInt16(v int) int16 {
+    if v > 32767 {
+        return 32767
+    } else if v < -32768 {
+        return -32768
+    }
+    return int16(v)
+}
+
+// RemixPCM 声道转换
+// outChannels == 1:            所有输入声道取平均
+// inChannels == 1:             单声道复制到所有输出声道
+// outChannels < inChannels:    第i个输入声道混入第i%outChannels个输出声道, 取平均
+// outChannels > inChannels:    第j个输出声道复制第j%inChannels个输入声道
+func RemixPCM(pcm []int16, inChannels int, outChannels int) ([]int16, error) {
+    if inChannels <= 0 || outChannels <= 0 {
+        return nil, errors.New("invalid channel count")
+    }
+    if len(pcm)%inChannels != 0 {
+        return nil, errors.New("pcm samples is not a multiple of channel count")
+    }
+    frames := len(pcm) / inChannels
+    out := make([]int16, frames*outChannels)
+    if inChannels == outChannels {
+        copy(out, pcm)
+        return out, nil
+    }
+    if outChannels > inChannels {
+        for i := 0; i < frames; i++ {
+            for j := 0; j < outChannels; j++ {
+                out[i*outChannels+j] = pcm[i*inChannels+j%inChannels]
+            }
+        }
+        return out, nil
+    }
+    sum := make([]int, outChannels)
+    cnt := make([]int, outChannels)
+    for i := 0; i < inChannels; i++ {
+        cnt[i%outChannels]++
+    }
+    for i := 0; i < frames; i++ {
+        for j := range sum {
+            sum[j] = 0
+        }
+        for j := 0; j < inChannels; j++ {
+            sum[j%outChannels] += int(pcm[i*inChannels+j])
+        }
+        for j := 0; j < outChannels; j++ {
+            out[i*outChannels+j] = clipInt16(sum[j] / cnt[j])
+        }
+    }
+    return out, nil
+}
+
+// PCMResampler 线性插值重采样, 保存上一次输入的最后一帧和相位, 可以连续处理分片输入
+type PCMResampler struct {
+    channels int
+    inRate   int
+    outRate  int
+    pos      int //以1/outRate个输入帧为单位, 相对于prev的位置
+    prev     []int16
+}
+
+func NewPCMResampler(channels int, inRate int, outRate int) (*PCMResampler, error) {
+    if channels <= 0 || inRate <= 0 || outRate <= 0 {
+        return nil, errors.New("invalid resampler parameters")
+    }
+    return &PCMResampler{
+        channels: channels,
+        inRate:   inRate,
+        outRate:  outRate,
+    }, nil
+}
+
+func (r *PCMResampler) Resample(pcm []int16) []int16 {
+    ch := r.channels
+    frames := len(pcm) / ch
+    if frames == 0 {
+        return nil
+    }
+    pcm = pcm[:frames*ch]
+    if r.prev == nil {
+        r.prev = make([]int16, ch)
+        copy(r.prev, pcm[:ch])
+        pcm = pcm[ch:]
+        frames--
+    }
+
+    //虚拟输入序列: prev, pcm[0], pcm[1] ...
+    sample := func(idx int, c int) int {
+        if idx == 0 {
+            return int(r.prev[c])
+        }
+        return int(pcm[(idx-1)*ch+c])
+    }
+
+    out := make([]int16, 0, (frames*r.outRate/r.inRate+1)*ch)
+    for {
+        idx := r.pos / r.outRate
+        frac := r.pos % r.outRate
+        if idx > frames || (idx == frames && frac > 0) {
+            break
+        }
+        for c := 0; c < ch; c++ {
+            a := sample(idx, c)
+            if frac == 0 {
+                out = append(out, int16(a))
+                continue
+            }
+            b := sample(idx+1, c)
+            out = append(out, int16(int64(a)+int64(b-a)*int64(frac)/int64(r.outRate)))
+        }
+        r.pos += r.inRate
+    }
+    if frames > 0 {
+        copy(r.prev, pcm[(frames-1)*ch:])
+        r.pos -= frames * r.outRate
+    }
+    return out
+}
+
+// ResamplePCM 一次性重采样整段PCM
+func ResamplePCM(pcm []int16, channels int, inRate int, outRate int) ([]int16, error) {
+    r, err := NewPCMResampler(channels, inRate, outRate)
+    if err != nil {
+        return nil, err
+    }
+    return r.Resample(pcm), nil
+}
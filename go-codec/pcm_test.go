@@ -0,0 +1,92 @@
+package codec
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestPCMS16LE(t *testing.T) {
+    pcm := []int16{0, 1, -1, 32767, -32768}
+    data := EncodePCMS16LE(pcm)
+    if !reflect.DeepEqual(data, []byte{0, 0, 1, 0, 0xFF, 0xFF, 0xFF, 0x7F, 0x00, 0x80}) {
+        t.Errorf("EncodePCMS16LE() = %v", data)
+    }
+    if got := DecodePCMS16LE(data); !reflect.DeepEqual(got, pcm) {
+        t.Errorf("DecodePCMS16LE() = %v", got)
+    }
+}
+
+func TestRemixPCM(t *testing.T) {
+    tests := []struct {
+        name    string
+        pcm     []int16
+        in      int
+        out     int
+        want    []int16
+        wantErr bool
+    }{
+        {name: "stereo to mono", pcm: []int16{100, 200, -32768, -32768}, in: 2, out: 1, want: []int16{150, -32768}},
+        {name: "mono to stereo", pcm: []int16{1, 2}, in: 1, out: 2, want: []int16{1, 1, 2, 2}},
+        {name: "4 to 2", pcm: []int16{10, 20, 30, 40}, in: 4, out: 2, want: []int16{20, 30}},
+        {name: "2 to 3", pcm: []int16{1, 2}, in: 2, out: 3, want: []int16{1, 2, 1}},
+        {name: "same", pcm: []int16{1, 2}, in: 2, out: 2, want: []int16{1, 2}},
+        {name: "misaligned", pcm: []int16{1, 2, 3}, in: 2, out: 1, wantErr: true},
+        {name: "invalid", pcm: []int16{1}, in: 0, out: 1, wantErr: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := RemixPCM(tt.pcm, tt.in, tt.out)
+            if (err != nil) != tt.wantErr {
+                t.Fatalf("RemixPCM() error = %v", err)
+            }
+            if !tt.wantErr && !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("RemixPCM() = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
+
+func TestResamplePCM(t *testing.T) {
+    tests := []struct {
+        name     string
+        pcm      []int16
+        channels int
+        in       int
+        out      int
+        want     []int16
+    }{
+        {name: "upsample x2", pcm: []int16{0, 100, 200}, channels: 1, in: 8000, out: 16000, want: []int16{0, 50, 100, 150, 200}},
+        {name: "downsample x2", pcm: []int16{0, 100, 200, 300, 400}, channels: 1, in: 16000, out: 8000, want: []int16{0, 200, 400}},
+        {name: "stereo 2:3", pcm: []int16{0, 0, 300, -300, 600, -600}, channels: 2, in: 2, out: 3, want: []int16{0, 0, 200, -200, 400, -400, 600, -600}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := ResamplePCM(tt.pcm, tt.channels, tt.in, tt.out)
+            if err != nil || !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("ResamplePCM() = %v, %v, want %v", got, err, tt.want)
+            }
+        })
+    }
+
+    //分片输入和一次性输入结果相同
+    pcm := make([]int16, 441)
+    for i := range pcm {
+        pcm[i] = int16(i * 50)
+    }
+    whole, _ := ResamplePCM(pcm, 1, 44100, 16000)
+    r, _ := NewPCMResampler(1, 44100, 16000)
+    var chunked []int16
+    for i := 0; i < len(pcm); i += 37 {
+        end := i + 37
+        if end > len(pcm) {
+            end = len(pcm)
+        }
+        chunked = append(chunked, r.Resample(pcm[i:end])...)
+    }
+    if !reflect.DeepEqual(whole, chunked) || len(whole) != 160 {
+        t.Errorf("chunked resample mismatch, len %d %d", len(whole), len(chunked))
+    }
+    if _, err := NewPCMResampler(1, 0, 8000); err == nil {
+        t.Errorf("expected error for zero rate")
+    }
+}
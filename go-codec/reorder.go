@@ -0,0 +1,267 @@
+package codec
+
+import (
+    "sort"
+)
+
+// FrameReorder 根据解码顺序输入的帧和pts, 生成单调递增的dts
+//
+// 解码顺序中第k帧的dts取所有帧pts从小到大排序之后的第k个值, 再整体减去重排序延迟(depth个帧间隔),
+// 保证dts <= pts. 为此需要缓存depth帧, 输出比输入延迟depth帧.
+// depth小于实际的重排序深度时优先保证dts单调递增, 此时可能出现dts > pts.
+// 输入的frame不会被拷贝, 在OnFrame回调之前调用方不能复用
+type FrameReorder struct {
+    OnFrame  func(frame []byte, pts int64, dts int64)
+    depth    int
+    frames   []reorderFrame
+    ptss     []int64
+    delay    int64
+    duration int64
+    started  bool
+    lastDts  int64
+}
+
+type reorderFrame struct {
+    frame []byte
+    pts   int64
+}
+
+// depth为解码顺序到显示顺序最多需要缓存的帧数, 没有B帧时为0
+func NewFrameReorder(depth int) *FrameReorder {
+    return &FrameReorder{depth: depth}
+}
+
+func (r *FrameReorder) Depth() int {
+    return r.depth
+}
+
+// 重排序深度只能增大, 变大后dts会以1递增直到追上新的延迟
+func (r *FrameReorder) SetDepth(depth int) {
+    if depth <= r.depth {
+        return
+    }
+    if r.started {
+        r.delay += int64(depth-r.depth) * r.duration
+    }
+    r.depth = depth
+}
+
+func (r *FrameReorder) Write(frame []byte, pts int64) {
+    r.frames = append(r.frames, reorderFrame{frame: frame, pts: pts})
+    idx := sort.Search(len(r.ptss), func(i int) bool { return r.ptss[i] > pts })
+    r.ptss = append(r.ptss, 0)
+    copy(r.ptss[idx+1:], r.ptss[idx:])
+    r.ptss[idx] = pts
+    if !r.started {
+        // 多缓存depth帧用于估算帧间隔
+        if len(r.frames) <= 2*r.depth {
+            return
+        }
+        r.start()
+    }
+    for len(r.frames) > r.depth {
+        r.output()
+    }
+}
+
+// 输出所有缓存的帧
+func (r *FrameReorder) Flush() {
+    if len(r.frames) == 0 {
+        return
+    }
+    if !r.started {
+        r.start()
+    }
+    for len(r.frames) > 0 {
+        r.output()
+    }
+}
+
+func (r *FrameReorder) start() {
+    r.started = true
+    for i := 1; i < len(r.ptss); i++ {
+        diff := r.ptss[i] - r.ptss[i-1]
+        if diff > 0 && (r.duration == 0 || diff < r.duration) {
+            r.duration = diff
+        }
+    }
+    r.delay = int64(r.depth) * r.duration
+    r.lastDts = r.ptss[0] - r.delay - 1
+}
+
+func (r *FrameReorder) output() {
+    f := r.frames[0]
+    r.frames = r.frames[1:]
+    dts := r.ptss[0] - r.delay
+    r.ptss = r.ptss[1:]
+    if dts <= r.lastDts {
+        dts = r.lastDts + 1
+    }
+    r.lastDts = dts
+    if r.OnFrame != nil {
+        r.OnFrame(f.frame, f.pts, dts)
+    }
+}
+
+// 解码顺序在前, 显示顺序在后的帧的个数就是当前帧需要的重排序深度
+type pocWindow struct {
+    pocs []int64
+}
+
+func (w *pocWindow) reset() {
+    w.pocs = w.pocs[:0]
+}
+
+func (w *pocWindow) push(poc int64) int {
+    needed := 0
+    for _, p := range w.pocs {
+        if p > poc {
+            needed++
+        }
+    }
+    w.pocs = append(w.pocs, poc)
+    if len(w.pocs) > 32 {
+        w.pocs = w.pocs[1:]
+    }
+    return needed
+}
+
+// H264FrameReorder 输入解码顺序的H264 Annex-B access unit
+// 从sps中得到重排序深度(num_reorder_frames), sps没有携带时根据poc检测实际的重排序深度
+type H264FrameReorder struct {
+    OnFrame func(frame []byte, pts int64, dts int64)
+    reorder *FrameReorder
+    spss    map[uint64]*SPS
+    ppss    map[uint64]*PPS
+    calc    H264PocCalculator
+    window  pocWindow
+}
+
+func NewH264FrameReorder() *H264FrameReorder {
+    r := &H264FrameReorder{
+        reorder: NewFrameReorder(0),
+        spss:    make(map[uint64]*SPS),
+        ppss:    make(map[uint64]*PPS),
+    }
+    r.reorder.OnFrame = func(frame []byte, pts, dts int64) {
+        if r.OnFrame != nil {
+            r.OnFrame(frame, pts, dts)
+        }
+    }
+    return r
+}
+
+// 第一个sps/pps之前的slice无法解析poc, 返回错误并且丢弃该帧
+func (r *H264FrameReorder) Write(frame []byte, pts int64) error {
+    var sh *SliceHeader
+    var err error
+    SplitFrame(frame, func(nalu []byte) bool {
+        switch H264NaluTypeWithoutStartCode(nalu) {
+        case H264_NAL_SPS:
+            sps := &SPS{}
+            sps.Decode(NewBitStream(CovertRbspToSodb(nalu[1:])))
+            r.spss[sps.Seq_parameter_set_id] = sps
+            r.reorder.SetDepth(sps.MaxNumReorderFrames())
+        case H264_NAL_PPS:
+            pps := &PPS{}
+            pps.Decode(NewBitStream(CovertRbspToSodb(nalu[1:])))
+            r.ppss[pps.Pic_parameter_set_id] = pps
+        case H264_NAL_I_SLICE, H264_NAL_P_SLICE:
+            sh, err = DecodeH264SliceHeader(nalu, r.spss, r.ppss)
+            return false
+        }
+        return true
+    })
+    if err != nil {
+        return err
+    }
+    if sh == nil {
+        r.reorder.Write(frame, pts)
+        return nil
+    }
+    sps := r.spss[r.ppss[sh.Pic_parameter_set_id].Seq_parameter_set_id]
+    if sh.IdrPicFlag() {
+        r.window.reset()
+    }
+    poc := r.calc.PicOrderCnt(sps, sh)
+    if sh.HasMMCO5() {
+        r.window.reset()
+    }
+    r.reorder.SetDepth(r.window.push(poc))
+    r.reorder.Write(frame, pts)
+    return nil
+}
+
+func (r *H264FrameReorder) Flush() {
+    r.reorder.Flush()
+}
+
+// H265FrameReorder 输入解码顺序的H265 Annex-B access unit
+// 重排序深度取sps中最高时域层的sps_max_num_reorder_pics, 并且根据poc检测实际的重排序深度
+type H265FrameReorder struct {
+    OnFrame func(frame []byte, pts int64, dts int64)
+    reorder *FrameReorder
+    spss    map[uint64]*H265RawSPS
+    ppss    map[uint64]*H265RawPPS
+    calc    H265PocCalculator
+    window  pocWindow
+}
+
+func NewH265FrameReorder() *H265FrameReorder {
+    r := &H265FrameReorder{
+        reorder: NewFrameReorder(0),
+        spss:    make(map[uint64]*H265RawSPS),
+        ppss:    make(map[uint64]*H265RawPPS),
+    }
+    r.reorder.OnFrame = func(frame []byte, pts, dts int64) {
+        if r.OnFrame != nil {
+            r.OnFrame(frame, pts, dts)
+        }
+    }
+    return r
+}
+
+// 第一个sps/pps之前的slice无法解析poc, 返回错误并且丢弃该帧
+func (r *H265FrameReorder) Write(frame []byte, pts int64) error {
+    var sh *H265SliceHeader
+    var err error
+    SplitFrame(frame, func(nalu []byte) bool {
+        naluType := H265NaluTypeWithoutStartCode(nalu)
+        switch {
+        case naluType == H265_NAL_SPS:
+            sps := &H265RawSPS{}
+            sps.Decode(nalu)
+            r.spss[sps.Sps_seq_parameter_set_id] = sps
+            r.reorder.SetDepth(sps.MaxNumReorderPics())
+        case naluType == H265_NAL_PPS:
+            pps := &H265RawPPS{}
+            pps.Decode(nalu)
+            r.ppss[pps.Pps_pic_parameter_set_id] = pps
+        case naluType == 37: //EOS_NUT
+            r.calc.Reset()
+        case naluType <= H265_NAL_SLICE_RASL_R || (naluType >= H265_NAL_SLICE_BLA_W_LP && naluType <= H265_NAL_SLICE_CRA):
+            sh, err = DecodeH265SliceHeader(nalu, r.spss, r.ppss)
+            return false
+        }
+        return true
+    })
+    if err != nil {
+        return err
+    }
+    if sh == nil {
+        r.reorder.Write(frame, pts)
+        return nil
+    }
+    sps := r.spss[r.ppss[sh.Slice_pic_parameter_set_id].Pps_seq_parameter_set_id]
+    if sh.IsIRAP() {
+        r.window.reset()
+    }
+    poc := r.calc.PicOrderCnt(sps, sh)
+    r.reorder.SetDepth(r.window.push(poc))
+    r.reorder.Write(frame, pts)
+    return nil
+}
+
+func (r *H265FrameReorder) Flush() {
+    r.reorder.Flush()
+}
@@ -0,0 +1,247 @@
+package codec
+
+import (
+    "errors"
+    "fmt"
+    "strings"
+)
+
+// RFC 6381 The 'Codecs' and 'Profiles' Parameters for "Bucket" Media Types
+// https://datatracker.ietf.org/doc/html/rfc6381#section-3.3
+//
+// codec          extradata
+// H264           AVCDecoderConfigurationRecord or sps (with start code)
+// H265           HEVCDecoderConfigurationRecord or vps/sps/pps (with start code)
+// AV1            AV1CodecConfigurationRecord or temporal unit which contains sequence header obu
+// VP9            VPCodecConfigurationRecord or key frame
+// AAC            AudioSpecificConfig or adts frame
+// VP8/MP3/OPUS/AC3/EAC3/G711   extradata is ignored
+
+func GetCodecString(cid CodecID, extradata []byte) (string, error) {
+    switch cid {
+    case CODECID_VIDEO_H264:
+        return GetH264CodecString(extradata)
+    case CODECID_VIDEO_H265:
+        return GetH265CodecString(extradata)
+    case CODECID_VIDEO_AV1:
+        return GetAV1CodecString(extradata)
+    case CODECID_VIDEO_VP9:
+        return GetVP9CodecString(extradata)
+    case CODECID_VIDEO_VP8:
+        return "vp8", nil
+    case CODECID_AUDIO_AAC:
+        return GetAACCodecString(extradata)
+    case CODECID_AUDIO_MP3:
+        return "mp4a.40.34", nil
+    case CODECID_AUDIO_OPUS:
+        return "opus", nil
+    case CODECID_AUDIO_AC3:
+        return "ac-3", nil
+    case CODECID_AUDIO_EAC3:
+        return "ec-3", nil
+    case CODECID_AUDIO_G711A:
+        return "alaw", nil
+    case CODECID_AUDIO_G711U:
+        return "ulaw", nil
+    default:
+        return "", errors.New("unsupport codec id")
+    }
+}
+
+// ISO/IEC 14496-15 Annex A.2
+// avc1.PPCCLL, PP = profile_idc, CC = constraint_set flags, LL = level_idc
+func GetH264CodecString(extradata []byte) (string, error) {
+    var sps []byte
+    if len(extradata) > 0 && extradata[0] == 0x01 {
+        if len(extradata) < 4 {
+            return "", errors.New("len of avcC < 4")
+        }
+        return fmt.Sprintf("avc1.%02X%02X%02X", extradata[1], extradata[2], extradata[3]), nil
+    }
+    SplitFrame(extradata, func(nalu []byte) bool {
+        if H264NaluTypeWithoutStartCode(nalu) == H264_NAL_SPS {
+            sps = nalu
+            return false
+        }
+        return true
+    })
+    if len(sps) < 4 {
+        return "", errors.New("not found h264 sps")
+    }
+    return fmt.Sprintf("avc1.%02X%02X%02X", sps[1], sps[2], sps[3]), nil
+}
+
+// ISO/IEC 14496-15 Annex E.3
+// hvc1.[A-C]profile_idc.compatibility_flags.[L|H]level_idc.constraint_flags
+//   - general_profile_space is encoded as empty(0) or A,B,C(1,2,3)
+//   - general_profile_compatibility_flags is encoded in reverse bit order
+//   - each byte of the constraint flags is separated by a period, trailing zero bytes are omitted
+func GetH265CodecString(extradata []byte) (string, error) {
+    var ptl ProfileTierLevel
+    if len(extradata) > 0 && extradata[0] == 0x01 {
+        if len(extradata) < 23 {
+            return "", errors.New("len of hvcC < 23")
+        }
+        hvcc := NewHEVCRecordConfiguration()
+        if err := hvcc.Decode(extradata); err != nil {
+            return "", err
+        }
+        ptl.General_profile_space = hvcc.General_profile_space
+        ptl.General_tier_flag = hvcc.General_tier_flag
+        ptl.General_profile_idc = hvcc.General_profile_idc
+        ptl.General_profile_compatibility_flag = hvcc.General_profile_compatibility_flags
+        ptl.General_constraint_indicator_flag = hvcc.General_constraint_indicator_flags
+        ptl.General_level_idc = hvcc.General_level_idc
+    } else {
+        var sps []byte
+        SplitFrame(extradata, func(nalu []byte) bool {
+            if H265NaluTypeWithoutStartCode(nalu) == H265_NAL_SPS {
+                sps = nalu
+                return false
+            }
+            return true
+        })
+        if len(sps) == 0 {
+            return "", errors.New("not found h265 sps")
+        }
+        var rawsps H265RawSPS
+        if err := rawsps.Decode(sps); err != nil {
+            return "", err
+        }
+        ptl = rawsps.Ptl
+    }
+    return H265CodecStringWithPtl(ptl), nil
+}
+
+func H265CodecStringWithPtl(ptl ProfileTierLevel) string {
+    var sb strings.Builder
+    sb.WriteString("hvc1.")
+    if ptl.General_profile_space > 0 {
+        sb.WriteByte('A' + ptl.General_profile_space - 1)
+    }
+    var compat uint32 = 0
+    for i := 0; i < 32; i++ {
+        compat |= ((ptl.General_profile_compatibility_flag >> i) & 0x01) << (31 - i)
+    }
+    tier := 'L'
+    if ptl.General_tier_flag == 1 {
+        tier = 'H'
+    }
+    sb.WriteString(fmt.Sprintf("%d.%X.%c%d", ptl.General_profile_idc, compat, tier, ptl.General_level_idc))
+    constraint := make([]byte, 6)
+    for i := 0; i < 6; i++ {
+        constraint[i] = byte(ptl.General_constraint_indicator_flag >> (40 - 8*i))
+    }
+    end := 6
+    for end > 0 && constraint[end-1] == 0 {
+        end--
+    }
+    for i := 0; i < end; i++ {
+        sb.WriteString(fmt.Sprintf(".%X", constraint[i]))
+    }
+    return sb.String()
+}
+
+// https://aomediacodec.github.io/av1-isobmff/#codecsparam
+// av01.P.LLT.DD[.M.CCC.cp.tc.mc.F]
+func GetAV1CodecString(extradata []byte) (string, error) {
+    if len(extradata) == 0 {
+        return "", errors.New("empty av1 extradata")
+    }
+    var seqhdr *AV1SequenceHeader
+    var err error
+    if extradata[0] == 0x81 {
+        av1c := &AV1CodecConfigurationRecord{}
+        if err = av1c.Decode(extradata); err != nil {
+            return "", err
+        }
+        if obu := av1c.SequenceHeader(); obu != nil {
+            seqhdr, err = DecodeAV1SequenceHeader(obu)
+            if err != nil {
+                return "", err
+            }
+        } else {
+            bitdepth := 8
+            if av1c.Twelve_bit == 1 {
+                bitdepth = 12
+            } else if av1c.High_bitdepth == 1 {
+                bitdepth = 10
+            }
+            tier := 'M'
+            if av1c.Seq_tier_0 == 1 {
+                tier = 'H'
+            }
+            return fmt.Sprintf("av01.%d.%02d%c.%02d", av1c.Seq_profile, av1c.Seq_level_idx_0, tier, bitdepth), nil
+        }
+    } else {
+        seqhdr, err = DecodeAV1SequenceHeader(extradata)
+        if err != nil {
+            return "", err
+        }
+    }
+    return AV1CodecStringWithSequenceHeader(seqhdr), nil
+}
+
+func AV1CodecStringWithSequenceHeader(sh *AV1SequenceHeader) string {
+    tier := 'M'
+    if sh.OperatingPoints[0].Seq_tier == 1 {
+        tier = 'H'
+    }
+    cc := &sh.ColorConfig
+    str := fmt.Sprintf("av01.%d.%02d%c.%02d", sh.Seq_profile, sh.OperatingPoints[0].Seq_level_idx, tier, cc.BitDepth)
+    if cc.Color_description_present_flag == 0 && cc.Mono_chrome == 0 && cc.Color_range == 0 &&
+        cc.Subsampling_x == 1 && cc.Subsampling_y == 1 && cc.Chroma_sample_position == AV1_CSP_UNKNOWN {
+        return str
+    }
+    return str + fmt.Sprintf(".%d.%d%d%d.%02d.%02d.%02d.%d", cc.Mono_chrome, cc.Subsampling_x, cc.Subsampling_y,
+        cc.Chroma_sample_position, cc.Color_primaries, cc.Transfer_characteristics, cc.Matrix_coefficients, cc.Color_range)
+}
+
+// https://www.webmproject.org/vp9/mp4/#codecs-parameter-string
+// vp09.PP.LL.DD[.CC.cp.tc.mc.FF]
+func GetVP9CodecString(extradata []byte) (string, error) {
+    if len(extradata) == 0 {
+        return "", errors.New("empty vp9 extradata")
+    }
+    vpcc := NewVPCodecConfigurationRecord()
+    if extradata[0]&0xC0 == 0x80 {
+        hdr, err := DecodeVP9FrameHeader(extradata)
+        if err != nil {
+            return "", err
+        }
+        vpcc.UpdateVP9FrameHeader(hdr)
+    } else if err := vpcc.Decode(extradata); err != nil {
+        return "", err
+    }
+    return VP9CodecStringWithRecord(vpcc), nil
+}
+
+func VP9CodecStringWithRecord(vpcc *VPCodecConfigurationRecord) string {
+    str := fmt.Sprintf("vp09.%02d.%02d.%02d", vpcc.Profile, vpcc.Level, vpcc.BitDepth)
+    if vpcc.ChromaSubsampling == VPCC_CHROMA_420_COLLOCATED_WITH_LUMA && vpcc.ColourPrimaries == 1 &&
+        vpcc.TransferCharacteristics == 1 && vpcc.MatrixCoefficients == 1 && vpcc.VideoFullRangeFlag == 0 {
+        return str
+    }
+    return str + fmt.Sprintf(".%02d.%02d.%02d.%02d.%02d", vpcc.ChromaSubsampling, vpcc.ColourPrimaries,
+        vpcc.TransferCharacteristics, vpcc.MatrixCoefficients, vpcc.VideoFullRangeFlag)
+}
+
+// RFC 6381 3.3
+// mp4a.40.AOT, AOT = audio object type in AudioSpecificConfig
+func GetAACCodecString(extradata []byte) (string, error) {
+    if len(extradata) >= 2 && extradata[0] == 0xFF && extradata[1]&0xF0 == 0xF0 {
+        asc, err := ConvertADTSToASC(extradata)
+        if err != nil {
+            return "", err
+        }
+        return fmt.Sprintf("mp4a.40.%d", asc.Audio_object_type), nil
+    }
+    if len(extradata) < 2 {
+        return "", errors.New("len of asc < 2")
+    }
+    aot := int(extradata[0] >> 3)
+    if aot == 31 {
+        aot = 32 + (int(extradata[0]&0x07)<<3 | int(extradata[1]>>5))
+    }
+    return fmt.Sprintf("mp4a.40.%d", aot), nil
+}
@@ -0,0 +1,47 @@
+package codec
+
+import "testing"
+
+func TestGetCodecString(t *testing.T) {
+    type args struct {
+        cid       CodecID
+        extradata []byte
+    }
+    tests := []struct {
+        name    string
+        args    args
+        want    string
+        wantErr bool
+    }{
+        {name: "h264 sps", args: args{cid: CODECID_VIDEO_H264, extradata: sps2}, want: "avc1.640028"},
+        {name: "h264 avcC", args: args{cid: CODECID_VIDEO_H264, extradata: []byte{0x01, 0x42, 0xC0, 0x1F, 0xFF, 0xE1}}, want: "avc1.42C01F"},
+        {name: "h265 sps", args: args{cid: CODECID_VIDEO_H265, extradata: sps}, want: "hvc1.1.6.L120.90"},
+        {name: "h265 hvcC", args: args{cid: CODECID_VIDEO_H265, extradata: src}, want: "hvc1.1.6.L180.80"},
+        {name: "av1", args: args{cid: CODECID_VIDEO_AV1, extradata: av1Frame}, want: "av01.0.08M.08"},
+        {name: "av1 av1C", args: args{cid: CODECID_VIDEO_AV1, extradata: append([]byte{0x81, 0x08, 0x0C, 0x00}, av1Frame[2:]...)}, want: "av01.0.08M.08"},
+        {name: "vp9", args: args{cid: CODECID_VIDEO_VP9, extradata: vp9KeyFrame}, want: "vp09.00.20.08.00.02.02.01.00"},
+        {name: "vp9 vpcC", args: args{cid: CODECID_VIDEO_VP9, extradata: []byte{0x00, 0x1F, 0x82, 0x01, 0x01, 0x01, 0x00, 0x00}}, want: "vp09.00.31.08"},
+        {name: "aac lc", args: args{cid: CODECID_AUDIO_AAC, extradata: []byte{0x12, 0x10}}, want: "mp4a.40.2"},
+        {name: "he-aac", args: args{cid: CODECID_AUDIO_AAC, extradata: []byte{0x2B, 0x92, 0x08, 0x00}}, want: "mp4a.40.5"},
+        {name: "aac adts", args: args{cid: CODECID_AUDIO_AAC, extradata: []byte{0xFF, 0xF1, 0x50, 0x80, 0x02, 0x1F, 0xFC}}, want: "mp4a.40.2"},
+        {name: "mp3", args: args{cid: CODECID_AUDIO_MP3}, want: "mp4a.40.34"},
+        {name: "opus", args: args{cid: CODECID_AUDIO_OPUS}, want: "opus"},
+        {name: "ac3", args: args{cid: CODECID_AUDIO_AC3}, want: "ac-3"},
+        {name: "eac3", args: args{cid: CODECID_AUDIO_EAC3}, want: "ec-3"},
+        {name: "h265 truncated sps", args: args{cid: CODECID_VIDEO_H265, extradata: []byte{0x00, 0x00, 0x00, 0x01, 0x42, 0x01, 0x01}}, wantErr: true},
+        {name: "h264 without sps", args: args{cid: CODECID_VIDEO_H264, extradata: pps}, wantErr: true},
+        {name: "unknown", args: args{cid: CODECID_UNRECOGNIZED}, wantErr: true},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got, err := GetCodecString(tt.args.cid, tt.args.extradata)
+            if (err != nil) != tt.wantErr {
+                t.Errorf("GetCodecString() error = %v, wantErr %v", err, tt.wantErr)
+                return
+            }
+            if got != tt.want {
+                t.Errorf("GetCodecString() = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
@@ -0,0 +1,655 @@
+package codec
+
+import (
+    "errors"
+    "fmt"
+)
+
+// D.1.1 General SEI message syntax (H.264 / H.265)
+const (
+    SEI_BUFFERING_PERIOD                    = 0
+    SEI_PIC_TIMING                          = 1
+    SEI_USER_DATA_REGISTERED_ITU_T_T35      = 4
+    SEI_USER_DATA_UNREGISTERED              = 5
+    SEI_RECOVERY_POINT                      = 6
+    SEI_TIME_CODE                           = 136
+    SEI_MASTERING_DISPLAY_COLOUR_VOLUME     = 137
+    SEI_CONTENT_LIGHT_LEVEL_INFO            = 144
+    SEI_ALTERNATIVE_TRANSFER_CHARACTERISTIC = 147
+)
+
+func newSEIPayload(payloadType uint16) SEIReaderWriter {
+    switch payloadType {
+    case SEI_USER_DATA_REGISTERED_ITU_T_T35:
+        return new(UserDataRegisteredITUTT35)
+    case SEI_USER_DATA_UNREGISTERED:
+        return new(UserDataUnregistered)
+    case SEI_TIME_CODE:
+        return new(H265TimeCode)
+    case SEI_MASTERING_DISPLAY_COLOUR_VOLUME:
+        return new(MasteringDisplayColourVolume)
+    case SEI_CONTENT_LIGHT_LEVEL_INFO:
+        return new(ContentLightLevelInfo)
+    default:
+        return new(SEIRawPayload)
+    }
+}
+
+// 不认识或者需要参数集才能解析的sei(例如H264 pic_timing), 原样保存payload
+type SEIRawPayload struct {
+    Data []byte
+}
+
+func (raw *SEIRawPayload) Read(size uint16, bs *BitStream) {
+    raw.Data = bs.GetBytes(int(size))
+}
+
+func (raw *SEIRawPayload) Write(bsw *BitStreamWriter) {
+    bsw.PutBytes(raw.Data)
+}
+
+// 根据payload计算PayloadSize
+func NewSEI(payloadType uint16, payload SEIReaderWriter) *SEI {
+    bsw := NewBitStreamWriter(64)
+    payload.Write(bsw)
+    return &SEI{
+        PayloadType: payloadType,
+        PayloadSize: uint16(len(bsw.Bits())),
+        Sei_payload: payload,
+    }
+}
+
+// sei_rbsp(), rbsp不包含nalu header
+func decodeSEIMessages(rbsp []byte) ([]*SEI, error) {
+    bs := NewBitStream(CovertRbspToSodb(rbsp))
+    var seis []*SEI
+    for bs.MoreRbspData() {
+        var payloadType, payloadSize int
+        for bs.RemainBytes() > 0 && bs.NextBits(8) == 0xFF {
+            payloadType += 255
+            bs.SkipBits(8)
+        }
+        if bs.RemainBytes() == 0 {
+            return seis, errors.New("sei message truncated")
+        }
+        payloadType += int(bs.Uint8(8))
+        for bs.RemainBytes() > 0 && bs.NextBits(8) == 0xFF {
+            payloadSize += 255
+            bs.SkipBits(8)
+        }
+        if bs.RemainBytes() == 0 {
+            return seis, errors.New("sei message truncated")
+        }
+        payloadSize += int(bs.Uint8(8))
+        if payloadSize > bs.RemainBytes() || payloadType > 0xFFFF || payloadSize > 0xFFFF {
+            return seis, errors.New("sei payload size out of range")
+        }
+        sei := &SEI{PayloadType: uint16(payloadType), PayloadSize: uint16(payloadSize)}
+        sei.Sei_payload = newSEIPayload(sei.PayloadType)
+        sei.Sei_payload.Read(sei.PayloadSize, NewBitStream(bs.GetBytes(payloadSize)))
+        seis = append(seis, sei)
+    }
+    return seis, nil
+}
+
+// nalu without startcode
+func DecodeH264SEINalu(nalu []byte) ([]*SEI, error) {
+    if len(nalu) < 1 || H264NaluTypeWithoutStartCode(nalu) != H264_NAL_SEI {
+        return nil, errors.New("not h264 sei nalu")
+    }
+    return decodeSEIMessages(nalu[1:])
+}
+
+// nalu without startcode, prefix sei or suffix sei
+func DecodeH265SEINalu(nalu []byte) ([]*SEI, error) {
+    if len(nalu) < 2 {
+        return nil, errors.New("not h265 sei nalu")
+    }
+    if naluType := H265NaluTypeWithoutStartCode(nalu); naluType != H265_NAL_SEI && naluType != H265_NAL_SEI_SUFFIX {
+        return nil, errors.New("not h265 sei nalu")
+    }
+    return decodeSEIMessages(nalu[2:])
+}
+
+func encodeSEIMessages(hdr []byte, seis []*SEI) []byte {
+    bsw := NewBitStreamWriter(256)
+    for _, sei := range seis {
+        sei.Encode(bsw)
+    }
+    bsw.PutByte(0x80) // rbsp_trailing_bits
+    return append(hdr, CovertSodbToRbsp(bsw.Bits())...)
+}
+
+// 返回不带startcode的sei nalu
+func EncodeH264SEINalu(seis ...*SEI) []byte {
+    return encodeSEIMessages([]byte{byte(H264_NAL_SEI)}, seis)
+}
+
+// 返回不带startcode的sei nalu, suffix为true时生成suffix sei
+func EncodeH265SEINalu(suffix bool, seis ...*SEI) []byte {
+    naluType := H265_NAL_SEI
+    if suffix {
+        naluType = H265_NAL_SEI_SUFFIX
+    }
+    return encodeSEIMessages([]byte{byte(naluType) << 1, 0x01}, seis)
+}
+
+// 把不带startcode的sei nalu插入到Annex-B格式的frame中第一个VCL nalu之前
+func InsertH264SEINalu(frame []byte, sei []byte) []byte {
+    return insertNaluBeforeVCL(frame, sei, func(nalu []byte) bool {
+        return IsH264VCLNaluType(H264NaluTypeWithoutStartCode(nalu))
+    })
+}
+
+// prefix sei插入到第一个VCL nalu之前, suffix sei插入到最后一个VCL nalu之后
+func InsertH265SEINalu(frame []byte, sei []byte) []byte {
+    isVCL := func(nalu []byte) bool {
+        return IsH265VCLNaluType(H265NaluTypeWithoutStartCode(nalu))
+    }
+    if len(sei) > 0 && H265NaluTypeWithoutStartCode(sei) == H265_NAL_SEI_SUFFIX {
+        return insertNaluAfterVCL(frame, sei, isVCL)
+    }
+    return insertNaluBeforeVCL(frame, sei, isVCL)
+}
+
+func insertNaluBeforeVCL(frame []byte, insert []byte, isVCL func(nalu []byte) bool) []byte {
+    out := make([]byte, 0, len(frame)+len(insert)+4)
+    inserted := false
+    SplitFrameWithStartCode(frame, func(nalu []byte) bool {
+        start, sc := FindStartCode(nalu, 0)
+        if !inserted && isVCL(nalu[start+int(sc):]) {
+            out = append(out, 0x00, 0x00, 0x00, 0x01)
+            out = append(out, insert...)
+            inserted = true
+        }
+        out = append(out, nalu...)
+        return true
+    })
+    if !inserted {
+        out = append(out, 0x00, 0x00, 0x00, 0x01)
+        out = append(out, insert...)
+    }
+    return out
+}
+
+// 没有VCL nalu时插入到最后
+func insertNaluAfterVCL(frame []byte, insert []byte, isVCL func(nalu []byte) bool) []byte {
+    var nalus [][]byte
+    last := -1
+    SplitFrameWithStartCode(frame, func(nalu []byte) bool {
+        start, sc := FindStartCode(nalu, 0)
+        if isVCL(nalu[start+int(sc):]) {
+            last = len(nalus)
+        }
+        nalus = append(nalus, nalu)
+        return true
+    })
+    if last < 0 {
+        last = len(nalus) - 1
+    }
+    out := make([]byte, 0, len(frame)+len(insert)+4)
+    for i, nalu := range nalus {
+        out = append(out, nalu...)
+        if i == last {
+            out = append(out, 0x00, 0x00, 0x00, 0x01)
+            out = append(out, insert...)
+        }
+    }
+    if last < 0 {
+        out = append(out, 0x00, 0x00, 0x00, 0x01)
+        out = append(out, insert...)
+    }
+    return out
+}
+
+// D.1.6 User data registered by Recommendation ITU-T T.35 SEI message syntax
+type UserDataRegisteredITUTT35 struct {
+    Itu_t_t35_country_code                uint8
+    Itu_t_t35_country_code_extension_byte uint8
+    Payload                               []byte
+}
+
+func (t35 *UserDataRegisteredITUTT35) Read(size uint16, bs *BitStream) {
+    t35.Itu_t_t35_country_code = bs.Uint8(8)
+    size--
+    if t35.Itu_t_t35_country_code == 0xFF {
+        t35.Itu_t_t35_country_code_extension_byte = bs.Uint8(8)
+        size--
+    }
+    t35.Payload = bs.GetBytes(int(size))
+}
+
+func (t35 *UserDataRegisteredITUTT35) Write(bsw *BitStreamWriter) {
+    bsw.PutByte(t35.Itu_t_t35_country_code)
+    if t35.Itu_t_t35_country_code == 0xFF {
+        bsw.PutByte(t35.Itu_t_t35_country_code_extension_byte)
+    }
+    bsw.PutBytes(t35.Payload)
+}
+
+// ATSC A/53 Part 4, 6.2.3
+// itu_t_t35_country_code 0xB5(United States), itu_t_t35_provider_code 0x0031(ATSC),
+// user_identifier 'GA94', user_data_type_code 0x03 表示cc_data
+const (
+    A53_COUNTRY_CODE        = 0xB5
+    A53_PROVIDER_CODE       = 0x0031
+    A53_USER_IDENTIFIER     = 0x47413934
+    A53_CC_DATA_TYPE_CODE   = 0x03
+    A53_CC_TYPE_608_FIELD_1 = 0
+    A53_CC_TYPE_608_FIELD_2 = 1
+    A53_CC_TYPE_DTVCC_DATA  = 2
+    A53_CC_TYPE_DTVCC_START = 3
+)
+
+func (t35 *UserDataRegisteredITUTT35) IsA53CC() bool {
+    return t35.Itu_t_t35_country_code == A53_COUNTRY_CODE && len(t35.Payload) >= 7 &&
+        t35.Payload[0] == 0x00 && t35.Payload[1] == 0x31 && string(t35.Payload[2:6]) == "GA94" &&
+        t35.Payload[6] == A53_CC_DATA_TYPE_CODE
+}
+
+func (t35 *UserDataRegisteredITUTT35) A53CCData() (*A53CCData, error) {
+    if !t35.IsA53CC() {
+        return nil, errors.New("not a53 cc_data")
+    }
+    cc := &A53CCData{}
+    if err := cc.Decode(t35.Payload[7:]); err != nil {
+        return nil, err
+    }
+    return cc, nil
+}
+
+func NewA53CCUserData(cc *A53CCData) *UserDataRegisteredITUTT35 {
+    payload := []byte{0x00, 0x31, 'G', 'A', '9', '4', A53_CC_DATA_TYPE_CODE}
+    return &UserDataRegisteredITUTT35{
+        Itu_t_t35_country_code: A53_COUNTRY_CODE,
+        Payload:                append(payload, cc.Encode()...),
+    }
+}
+
+//	cc_data() {
+//	    reserved                 1 bit
+//	    process_cc_data_flag     1 bit
+//	    zero_bit                 1 bit
+//	    cc_count                 5 bits
+//	    reserved                 8 bits
+//	    for ( i=0 ; i < cc_count ; i++ ) {
+//	        one_bit              1 bit
+//	        reserved             4 bits
+//	        cc_valid             1 bit
+//	        cc_type              2 bits
+//	        cc_data_1            8 bits
+//	        cc_data_2            8 bits
+//	    }
+//	    marker_bits              8 bits
+//	}
+type CCData struct {
+    Cc_valid  uint8
+    Cc_type   uint8
+    Cc_data_1 uint8
+    Cc_data_2 uint8
+}
+
+type A53CCData struct {
+    Process_cc_data_flag uint8
+    CCs                  []CCData
+}
+
+func (cc *A53CCData) Decode(data []byte) error {
+    if len(data) < 2 {
+        return errors.New("cc_data too short")
+    }
+    bs := NewBitStream(data)
+    bs.SkipBits(1)
+    cc.Process_cc_data_flag = bs.GetBit()
+    bs.SkipBits(1)
+    count := int(bs.Uint8(5))
+    bs.SkipBits(8)
+    if bs.RemainBytes() < count*3 {
+        return errors.New("cc_data truncated")
+    }
+    cc.CCs = make([]CCData, count)
+    for i := 0; i < count; i++ {
+        bs.SkipBits(5)
+        cc.CCs[i].Cc_valid = bs.GetBit()
+        cc.CCs[i].Cc_type = bs.Uint8(2)
+        cc.CCs[i].Cc_data_1 = bs.Uint8(8)
+        cc.CCs[i].Cc_data_2 = bs.Uint8(8)
+    }
+    return nil
+}
+
+func (cc *A53CCData) Encode() []byte {
+    bsw := NewBitStreamWriter(3*len(cc.CCs) + 3)
+    bsw.PutUint8(1, 1)
+    bsw.PutUint8(cc.Process_cc_data_flag, 1)
+    bsw.PutUint8(0, 1)
+    bsw.PutUint8(uint8(len(cc.CCs)), 5)
+    bsw.PutByte(0xFF)
+    for _, c := range cc.CCs {
+        bsw.PutUint8(0x1F, 5)
+        bsw.PutUint8(c.Cc_valid, 1)
+        bsw.PutUint8(c.Cc_type, 2)
+        bsw.PutByte(c.Cc_data_1)
+        bsw.PutByte(c.Cc_data_2)
+    }
+    bsw.PutByte(0xFF)
+    return bsw.Bits()
+}
+
+// CEA-608字节对, field为1或者2, 去掉了奇偶校验位
+func (cc *A53CCData) CEA608Pairs(field int) [][2]byte {
+    var pairs [][2]byte
+    for _, c := range cc.CCs {
+        if c.Cc_valid == 1 && int(c.Cc_type) == field-1 {
+            pairs = append(pairs, [2]byte{c.Cc_data_1 & 0x7F, c.Cc_data_2 & 0x7F})
+        }
+    }
+    return pairs
+}
+
+// CEA-708 DTVCC数据(cc_type 2/3)按顺序拼接
+func (cc *A53CCData) CEA708Bytes() []byte {
+    var data []byte
+    for _, c := range cc.CCs {
+        if c.Cc_valid == 1 && c.Cc_type >= A53_CC_TYPE_DTVCC_DATA {
+            data = append(data, c.Cc_data_1, c.Cc_data_2)
+        }
+    }
+    return data
+}
+
+// clock_timestamp, H264 pic_timing和H265 time_code共用
+// H265中没有ct_type, n_frames为9bit, time_offset_length在每个clock_timestamp中携带
+type ClockTimestamp struct {
+    Clock_timestamp_flag  uint8
+    Ct_type               uint8
+    Nuit_field_based_flag uint8
+    Counting_type         uint8
+    Full_timestamp_flag   uint8
+    Discontinuity_flag    uint8
+    Cnt_dropped_flag      uint8
+    N_frames              uint16
+    Seconds_flag          uint8
+    Seconds_value         uint8
+    Minutes_flag          uint8
+    Minutes_value         uint8
+    Hours_flag            uint8
+    Hours_value           uint8
+    Time_offset_length    uint8
+    Time_offset           int64
+}
+
+func NewClockTimestamp(hours, minutes, seconds, frames int, dropFrame bool) ClockTimestamp {
+    ts := ClockTimestamp{
+        Clock_timestamp_flag: 1,
+        Full_timestamp_flag:  1,
+        N_frames:             uint16(frames),
+        Seconds_value:        uint8(seconds),
+        Minutes_value:        uint8(minutes),
+        Hours_value:          uint8(hours),
+    }
+    if dropFrame {
+        ts.Counting_type = 4
+        ts.Cnt_dropped_flag = 1
+    }
+    return ts
+}
+
+// SMPTE timecode, HH:MM:SS:FF, drop frame 使用 HH:MM:SS;FF
+func (ts *ClockTimestamp) Timecode() string {
+    sep := ':'
+    if ts.Cnt_dropped_flag == 1 {
+        sep = ';'
+    }
+    return fmt.Sprintf("%02d:%02d:%02d%c%02d", ts.Hours_value, ts.Minutes_value, ts.Seconds_value, sep, ts.N_frames)
+}
+
+func (ts *ClockTimestamp) decodeTime(bs *BitStream) {
+    if ts.Full_timestamp_flag == 1 {
+        ts.Seconds_value = bs.Uint8(6)
+        ts.Minutes_value = bs.Uint8(6)
+        ts.Hours_value = bs.Uint8(5)
+        return
+    }
+    ts.Seconds_flag = bs.GetBit()
+    if ts.Seconds_flag == 1 {
+        ts.Seconds_value = bs.Uint8(6)
+        ts.Minutes_flag = bs.GetBit()
+        if ts.Minutes_flag == 1 {
+            ts.Minutes_value = bs.Uint8(6)
+            ts.Hours_flag = bs.GetBit()
+            if ts.Hours_flag == 1 {
+                ts.Hours_value = bs.Uint8(5)
+            }
+        }
+    }
+}
+
+func (ts *ClockTimestamp) encodeTime(bsw *BitStreamWriter) {
+    if ts.Full_timestamp_flag == 1 {
+        bsw.PutUint8(ts.Seconds_value, 6)
+        bsw.PutUint8(ts.Minutes_value, 6)
+        bsw.PutUint8(ts.Hours_value, 5)
+        return
+    }
+    bsw.PutUint8(ts.Seconds_flag, 1)
+    if ts.Seconds_flag == 1 {
+        bsw.PutUint8(ts.Seconds_value, 6)
+        bsw.PutUint8(ts.Minutes_flag, 1)
+        if ts.Minutes_flag == 1 {
+            bsw.PutUint8(ts.Minutes_value, 6)
+            bsw.PutUint8(ts.Hours_flag, 1)
+            if ts.Hours_flag == 1 {
+                bsw.PutUint8(ts.Hours_value, 5)
+            }
+        }
+    }
+}
+
+// i(v), 二进制补码表示的有符号数
+func readSignedBits(bs *BitStream, n int) int64 {
+    v := bs.GetBits(n)
+    if v&(1<<(n-1)) != 0 {
+        return int64(v) - int64(1)<<n
+    }
+    return int64(v)
+}
+
+// D.1.3 Picture timing SEI message syntax (H.264)
+// 字段长度依赖sps中的hrd参数和pic_struct_present_flag
+type H264PicTiming struct {
+    Cpb_removal_delay uint32
+    Dpb_output_delay  uint32
+    Pic_struct        uint8
+    ClockTimestamps   []ClockTimestamp
+    sps               *SPS
+}
+
+func NewH264PicTiming(sps *SPS) *H264PicTiming {
+    return &H264PicTiming{sps: sps}
+}
+
+// Table D-1 – Interpretation of pic_struct
+var h264NumClockTS [16]int = [16]int{1, 1, 1, 2, 2, 3, 3, 2, 3}
+
+func (pt *H264PicTiming) hrd() *H264HrdParameters {
+    vui := &pt.sps.VuiParameters
+    if vui.NalHrdParametersPresentFlag == 1 {
+        return &vui.NalHrdParameters
+    } else if vui.VclHrdParametersPresentFlag == 1 {
+        return &vui.VclHrdParameters
+    }
+    return nil
+}
+
+func (pt *H264PicTiming) Read(size uint16, bs *BitStream) {
+    hrd := pt.hrd()
+    if hrd != nil {
+        pt.Cpb_removal_delay = bs.Uint32(int(hrd.CpbRemovalDelayLengthMinus1) + 1)
+        pt.Dpb_output_delay = bs.Uint32(int(hrd.DpbOutputDelayLengthMinus1) + 1)
+    }
+    if pt.sps.VuiParameters.PicStructPresentFlag == 0 {
+        return
+    }
+    pt.Pic_struct = bs.Uint8(4)
+    pt.ClockTimestamps = make([]ClockTimestamp, h264NumClockTS[pt.Pic_struct])
+    for i := range pt.ClockTimestamps {
+        ts := &pt.ClockTimestamps[i]
+        ts.Clock_timestamp_flag = bs.GetBit()
+        if ts.Clock_timestamp_flag == 0 {
+            continue
+        }
+        ts.Ct_type = bs.Uint8(2)
+        ts.Nuit_field_based_flag = bs.GetBit()
+        ts.Counting_type = bs.Uint8(5)
+        ts.Full_timestamp_flag = bs.GetBit()
+        ts.Discontinuity_flag = bs.GetBit()
+        ts.Cnt_dropped_flag = bs.GetBit()
+        ts.N_frames = uint16(bs.Uint8(8))
+        ts.decodeTime(bs)
+        if hrd != nil && hrd.TimeOffsetLength > 0 {
+            ts.Time_offset_length = hrd.TimeOffsetLength
+            ts.Time_offset = readSignedBits(bs, int(hrd.TimeOffsetLength))
+        }
+    }
+}
+
+func (pt *H264PicTiming) Write(bsw *BitStreamWriter) {
+    hrd := pt.hrd()
+    if hrd != nil {
+        bsw.PutUint32(pt.Cpb_removal_delay, int(hrd.CpbRemovalDelayLengthMinus1)+1)
+        bsw.PutUint32(pt.Dpb_output_delay, int(hrd.DpbOutputDelayLengthMinus1)+1)
+    }
+    if pt.sps.VuiParameters.PicStructPresentFlag == 1 {
+        bsw.PutUint8(pt.Pic_struct, 4)
+        for i := 0; i < h264NumClockTS[pt.Pic_struct]; i++ {
+            if i >= len(pt.ClockTimestamps) || pt.ClockTimestamps[i].Clock_timestamp_flag == 0 {
+                bsw.PutUint8(0, 1)
+                continue
+            }
+            ts := &pt.ClockTimestamps[i]
+            bsw.PutUint8(1, 1)
+            bsw.PutUint8(ts.Ct_type, 2)
+            bsw.PutUint8(ts.Nuit_field_based_flag, 1)
+            bsw.PutUint8(ts.Counting_type, 5)
+            bsw.PutUint8(ts.Full_timestamp_flag, 1)
+            bsw.PutUint8(ts.Discontinuity_flag, 1)
+            bsw.PutUint8(ts.Cnt_dropped_flag, 1)
+            bsw.PutUint8(uint8(ts.N_frames), 8)
+            ts.encodeTime(bsw)
+            if hrd != nil && hrd.TimeOffsetLength > 0 {
+                bsw.PutUint64(uint64(ts.Time_offset), int(hrd.TimeOffsetLength))
+            }
+        }
+    }
+    putPayloadAlignment(bsw)
+}
+
+// payload不是字节对齐时补充 bit_equal_to_one 和 bit_equal_to_zero
+func putPayloadAlignment(bsw *BitStreamWriter) {
+    if bsw.BitOffset() != 0 {
+        bsw.PutUint8(1, 1)
+        for bsw.BitOffset() != 0 {
+            bsw.PutUint8(0, 1)
+        }
+    }
+}
+
+// D.2.27 Time code SEI message syntax (H.265)
+type H265TimeCode struct {
+    ClockTimestamps []ClockTimestamp
+}
+
+func (tc *H265TimeCode) Read(size uint16, bs *BitStream) {
+    tc.ClockTimestamps = make([]ClockTimestamp, bs.Uint8(2))
+    for i := range tc.ClockTimestamps {
+        ts := &tc.ClockTimestamps[i]
+        ts.Clock_timestamp_flag = bs.GetBit()
+        if ts.Clock_timestamp_flag == 0 {
+            continue
+        }
+        ts.Nuit_field_based_flag = bs.GetBit()
+        ts.Counting_type = bs.Uint8(5)
+        ts.Full_timestamp_flag = bs.GetBit()
+        ts.Discontinuity_flag = bs.GetBit()
+        ts.Cnt_dropped_flag = bs.GetBit()
+        ts.N_frames = bs.Uint16(9)
+        ts.decodeTime(bs)
+        ts.Time_offset_length = bs.Uint8(5)
+        if ts.Time_offset_length > 0 {
+            ts.Time_offset = readSignedBits(bs, int(ts.Time_offset_length))
+        }
+    }
+}
+
+func (tc *H265TimeCode) Write(bsw *BitStreamWriter) {
+    bsw.PutUint8(uint8(len(tc.ClockTimestamps)), 2)
+    for i := range tc.ClockTimestamps {
+        ts := &tc.ClockTimestamps[i]
+        bsw.PutUint8(ts.Clock_timestamp_flag, 1)
+        if ts.Clock_timestamp_flag == 0 {
+            continue
+        }
+        bsw.PutUint8(ts.Nuit_field_based_flag, 1)
+        bsw.PutUint8(ts.Counting_type, 5)
+        bsw.PutUint8(ts.Full_timestamp_flag, 1)
+        bsw.PutUint8(ts.Discontinuity_flag, 1)
+        bsw.PutUint8(ts.Cnt_dropped_flag, 1)
+        bsw.PutUint16(ts.N_frames, 9)
+        ts.encodeTime(bsw)
+        bsw.PutUint8(ts.Time_offset_length, 5)
+        if ts.Time_offset_length > 0 {
+            bsw.PutUint64(uint64(ts.Time_offset), int(ts.Time_offset_length))
+        }
+    }
+    putPayloadAlignment(bsw)
+}
+
+// D.2.28 Mastering display colour volume SEI message syntax
+// 色度坐标单位0.00002, 亮度单位0.0001 cd/m2
+type MasteringDisplayColourVolume struct {
+    Display_primaries_x             [3]uint16
+    Display_primaries_y             [3]uint16
+    White_point_x                   uint16
+    White_point_y                   uint16
+    Max_display_mastering_luminance uint32
+    Min_display_mastering_luminance uint32
+}
+
+func (mdcv *MasteringDisplayColourVolume) Read(size uint16, bs *BitStream) {
+    for c := 0; c < 3; c++ {
+        mdcv.Display_primaries_x[c] = bs.Uint16(16)
+        mdcv.Display_primaries_y[c] = bs.Uint16(16)
+    }
+    mdcv.White_point_x = bs.Uint16(16)
+    mdcv.White_point_y = bs.Uint16(16)
+    mdcv.Max_display_mastering_luminance = bs.Uint32(32)
+    mdcv.Min_display_mastering_luminance = bs.Uint32(32)
+}
+
+func (mdcv *MasteringDisplayColourVolume) Write(bsw *BitStreamWriter) {
+    for c := 0; c < 3; c++ {
+        bsw.PutUint16(mdcv.Display_primaries_x[c], 16)
+        bsw.PutUint16(mdcv.Display_primaries_y[c], 16)
+    }
+    bsw.PutUint16(mdcv.White_point_x, 16)
+    bsw.PutUint16(mdcv.White_point_y, 16)
+    bsw.PutUint32(mdcv.Max_display_mastering_luminance, 32)
+    bsw.PutUint32(mdcv.Min_display_mastering_luminance, 32)
+}
+
+// D.2.35 Content light level information SEI message syntax
+type ContentLightLevelInfo struct {
+    Max_content_light_level     uint16
+    Max_pic_average_light_level uint16
+}
+
+func (clli *ContentLightLevelInfo) Read(size uint16, bs *BitStream) {
+    clli.Max_content_light_level = bs.Uint16(16)
+    clli.Max_pic_average_light_level = bs.Uint16(16)
+}
+
+func (clli *ContentLightLevelInfo) Write(bsw *BitStreamWriter) {
+    bsw.PutUint16(clli.Max_content_light_level, 16)
+    bsw.PutUint16(clli.Max_pic_average_light_level, 16)
+}
@@ -0,0 +1,203 @@
+package codec
+
+import (
+    "bytes"
+    "reflect"
+    "testing"
+)
+
+func TestCovertSodbToRbsp(t *testing.T) {
+    tests := []struct {
+        name string
+        sodb []byte
+        want []byte
+    }{
+        {name: "no emulation", sodb: []byte{0x01, 0x00, 0x04, 0x00, 0x00, 0x04}, want: []byte{0x01, 0x00, 0x04, 0x00, 0x00, 0x04}},
+        {name: "000000", sodb: []byte{0x00, 0x00, 0x00, 0x00}, want: []byte{0x00, 0x00, 0x03, 0x00, 0x00}},
+        {name: "000001", sodb: []byte{0x11, 0x00, 0x00, 0x01}, want: []byte{0x11, 0x00, 0x00, 0x03, 0x01}},
+        {name: "000003", sodb: []byte{0x00, 0x00, 0x03, 0x80}, want: []byte{0x00, 0x00, 0x03, 0x03, 0x80}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            got := CovertSodbToRbsp(tt.sodb)
+            if !bytes.Equal(got, tt.want) {
+                t.Errorf("CovertSodbToRbsp() = %x, want %x", got, tt.want)
+            }
+            if back := CovertRbspToSodb(got); !bytes.Equal(back, tt.sodb) {
+                t.Errorf("CovertRbspToSodb() = %x, want %x", back, tt.sodb)
+            }
+        })
+    }
+}
+
+func TestA53CCData_RoundTrip(t *testing.T) {
+    cc := &A53CCData{
+        Process_cc_data_flag: 1,
+        CCs: []CCData{
+            {Cc_valid: 1, Cc_type: A53_CC_TYPE_608_FIELD_1, Cc_data_1: 0x94, Cc_data_2: 0x2c},
+            {Cc_valid: 1, Cc_type: A53_CC_TYPE_608_FIELD_2, Cc_data_1: 0x80, Cc_data_2: 0x80},
+            {Cc_valid: 1, Cc_type: A53_CC_TYPE_DTVCC_START, Cc_data_1: 0x02, Cc_data_2: 0x21},
+            {Cc_valid: 1, Cc_type: A53_CC_TYPE_DTVCC_DATA, Cc_data_1: 0x00, Cc_data_2: 0x00},
+            {Cc_valid: 0, Cc_type: A53_CC_TYPE_608_FIELD_1, Cc_data_1: 0x80, Cc_data_2: 0x80},
+        },
+    }
+    nalu := EncodeH264SEINalu(NewSEI(SEI_USER_DATA_REGISTERED_ITU_T_T35, NewA53CCUserData(cc)))
+    seis, err := DecodeH264SEINalu(nalu)
+    if err != nil {
+        t.Fatal(err)
+    }
+    if len(seis) != 1 || seis[0].PayloadType != SEI_USER_DATA_REGISTERED_ITU_T_T35 {
+        t.Fatalf("unexpected sei messages %+v", seis)
+    }
+    t35, ok := seis[0].Sei_payload.(*UserDataRegisteredITUTT35)
+    if !ok || !t35.IsA53CC() {
+        t.Fatalf("payload is not a53 cc_data")
+    }
+    got, err := t35.A53CCData()
+    if err != nil {
+        t.Fatal(err)
+    }
+    if !reflect.DeepEqual(got, cc) {
+        t.Errorf("A53CCData() = %+v, want %+v", got, cc)
+    }
+    if pairs := got.CEA608Pairs(1); !reflect.DeepEqual(pairs, [][2]byte{{0x14, 0x2c}}) {
+        t.Errorf("CEA608Pairs(1) = %x", pairs)
+    }
+    if pairs := got.CEA608Pairs(2); !reflect.DeepEqual(pairs, [][2]byte{{0x00, 0x00}}) {
+        t.Errorf("CEA608Pairs(2) = %x", pairs)
+    }
+    if data := got.CEA708Bytes(); !bytes.Equal(data, []byte{0x02, 0x21, 0x00, 0x00}) {
+        t.Errorf("CEA708Bytes() = %x", data)
+    }
+}
+
+func TestH264PicTiming_RoundTrip(t *testing.T) {
+    sps := &SPS{}
+    sps.VuiParameters.NalHrdParametersPresentFlag = 1
+    sps.VuiParameters.NalHrdParameters.CpbRemovalDelayLengthMinus1 = 23
+    sps.VuiParameters.NalHrdParameters.DpbOutputDelayLengthMinus1 = 23
+    sps.VuiParameters.NalHrdParameters.TimeOffsetLength = 24
+    sps.VuiParameters.PicStructPresentFlag = 1
+
+    ts := NewClockTimestamp(1, 2, 3, 4, true)
+    ts.Time_offset_length = 24
+    ts.Time_offset = -10
+    pt := NewH264PicTiming(sps)
+    pt.Cpb_removal_delay = 2
+    pt.Dpb_output_delay = 4
+    pt.ClockTimestamps = []ClockTimestamp{ts}
+
+    nalu := EncodeH264SEINalu(NewSEI(SEI_PIC_TIMING, pt))
+    seis, err := DecodeH264SEINalu(nalu)
+    if err != nil {
+        t.Fatal(err)
+    }
+    raw, ok := seis[0].Sei_payload.(*SEIRawPayload)
+    if !ok {
+        t.Fatalf("pic_timing should be kept as raw payload without sps")
+    }
+    got := NewH264PicTiming(sps)
+    got.Read(seis[0].PayloadSize, NewBitStream(raw.Data))
+    if got.Cpb_removal_delay != 2 || got.Dpb_output_delay != 4 || got.Pic_struct != 0 {
+        t.Errorf("H264PicTiming = %+v", got)
+    }
+    if !reflect.DeepEqual(got.ClockTimestamps, pt.ClockTimestamps) {
+        t.Errorf("ClockTimestamps = %+v, want %+v", got.ClockTimestamps, pt.ClockTimestamps)
+    }
+    if tc := got.ClockTimestamps[0].Timecode(); tc != "01:02:03;04" {
+        t.Errorf("Timecode() = %s", tc)
+    }
+}
+
+func TestH265SEI_RoundTrip(t *testing.T) {
+    ts := NewClockTimestamp(10, 59, 58, 300, false)
+    tc := &H265TimeCode{ClockTimestamps: []ClockTimestamp{ts, {}}}
+    mdcv := &MasteringDisplayColourVolume{
+        Display_primaries_x:             [3]uint16{13250, 7500, 34000},
+        Display_primaries_y:             [3]uint16{34500, 3000, 16000},
+        White_point_x:                   15635,
+        White_point_y:                   16450,
+        Max_display_mastering_luminance: 10000000,
+        Min_display_mastering_luminance: 50,
+    }
+    clli := &ContentLightLevelInfo{Max_content_light_level: 1000, Max_pic_average_light_level: 400}
+    udu := &UserDataUnregistered{UUID: make([]byte, 16), UserData: []byte{0x00, 0x00, 0x00, 0x01}}
+
+    nalu := EncodeH265SEINalu(false, NewSEI(SEI_TIME_CODE, tc), NewSEI(SEI_MASTERING_DISPLAY_COLOUR_VOLUME, mdcv),
+        NewSEI(SEI_CONTENT_LIGHT_LEVEL_INFO, clli), NewSEI(SEI_USER_DATA_UNREGISTERED, udu))
+    if H265NaluTypeWithoutStartCode(nalu) != H265_NAL_SEI {
+        t.Fatalf("nalu type = %d", H265NaluTypeWithoutStartCode(nalu))
+    }
+    if idx, _ := FindStartCode(nalu, 0); idx >= 0 {
+        t.Fatalf("start code emulation at %d", idx)
+    }
+    seis, err := DecodeH265SEINalu(nalu)
+    if err != nil {
+        t.Fatal(err)
+    }
+    want := []SEIReaderWriter{tc, mdcv, clli, udu}
+    if len(seis) != len(want) {
+        t.Fatalf("got %d sei messages, want %d", len(seis), len(want))
+    }
+    for i := range want {
+        if !reflect.DeepEqual(seis[i].Sei_payload, want[i]) {
+            t.Errorf("sei[%d] = %+v, want %+v", i, seis[i].Sei_payload, want[i])
+        }
+    }
+    if s := seis[0].Sei_payload.(*H265TimeCode).ClockTimestamps[0].Timecode(); s != "10:59:58:300" {
+        t.Errorf("Timecode() = %s", s)
+    }
+
+    suffix := EncodeH265SEINalu(true, NewSEI(SEI_CONTENT_LIGHT_LEVEL_INFO, clli))
+    if H265NaluTypeWithoutStartCode(suffix) != H265_NAL_SEI_SUFFIX {
+        t.Errorf("suffix nalu type = %d", H265NaluTypeWithoutStartCode(suffix))
+    }
+}
+
+func TestInsertH264SEINalu(t *testing.T) {
+    sei := EncodeH264SEINalu(NewSEI(SEI_CONTENT_LIGHT_LEVEL_INFO, &ContentLightLevelInfo{1, 1}))
+    aud := []byte{0x00, 0x00, 0x00, 0x01, 0x09, 0xf0}
+    idr := []byte{0x00, 0x00, 0x01, 0x65, 0x88, 0x84}
+    frame := append(append([]byte{}, aud...), idr...)
+    got := InsertH264SEINalu(frame, sei)
+    var want []byte
+    want = append(want, aud...)
+    want = append(want, 0x00, 0x00, 0x00, 0x01)
+    want = append(want, sei...)
+    want = append(want, idr...)
+    if !bytes.Equal(got, want) {
+        t.Errorf("InsertH264SEINalu() = %x, want %x", got, want)
+    }
+}
+
+func TestInsertH265SEINalu(t *testing.T) {
+    clli := NewSEI(SEI_CONTENT_LIGHT_LEVEL_INFO, &ContentLightLevelInfo{1, 1})
+    aud := []byte{0x00, 0x00, 0x00, 0x01, 0x46, 0x01, 0x50}
+    slice1 := []byte{0x00, 0x00, 0x00, 0x01, 0x26, 0x01, 0xAF}
+    slice2 := []byte{0x00, 0x00, 0x00, 0x01, 0x26, 0x01, 0x20}
+    eos := []byte{0x00, 0x00, 0x00, 0x01, 0x48, 0x01}
+    frame := bytes.Join([][]byte{aud, slice1, slice2, eos}, nil)
+
+    //prefix sei在第一个slice之前
+    prefix := EncodeH265SEINalu(false, clli)
+    want := bytes.Join([][]byte{aud, {0x00, 0x00, 0x00, 0x01}, prefix, slice1, slice2, eos}, nil)
+    if got := InsertH265SEINalu(frame, prefix); !bytes.Equal(got, want) {
+        t.Errorf("InsertH265SEINalu(prefix) = %x, want %x", got, want)
+    }
+
+    //suffix sei在最后一个slice之后
+    suffix := EncodeH265SEINalu(true, clli)
+    want = bytes.Join([][]byte{aud, slice1, slice2, {0x00, 0x00, 0x00, 0x01}, suffix, eos}, nil)
+    if got := InsertH265SEINalu(frame, suffix); !bytes.Equal(got, want) {
+        t.Errorf("InsertH265SEINalu(suffix) = %x, want %x", got, want)
+    }
+}
+
+func TestDecodeSEIMessages_Truncated(t *testing.T) {
+    if _, err := DecodeH264SEINalu([]byte{0x06, 0x05, 0x20, 0x00}); err == nil {
+        t.Errorf("expected error for truncated payload")
+    }
+    if _, err := DecodeH264SEINalu([]byte{0x67, 0x00}); err == nil {
+        t.Errorf("expected error for non sei nalu")
+    }
+}
@@ -26,6 +26,15 @@ func FindStartCode(nalu []byte, offset int) (int, START_CODE_TYPE) {
     return -1, START_CODE_3
 }
 
+// 去掉第一个startcode及之前的数据, 没有startcode时原样返回
+func trimStartCode(nalu []byte) []byte {
+    start, sc := FindStartCode(nalu, 0)
+    if start < 0 {
+        return nalu
+    }
+    return nalu[start+int(sc):]
+}
+
 func FindSyncword(aac []byte, offset int) int {
     for i := offset; i < len(aac)-1; i++ {
         if aac[i] == 0xFF && aac[i+1]&0xF0 == 0xF0 {
@@ -35,21 +44,18 @@ func FindSyncword(aac []byte, offset int) int {
     return -1
 }
 
+// SplitFrame 回调不包含startcode的nalu, 第一个startcode之前的数据被忽略
+// 基于NaluIterator, 空的nalu和startcode之前的trailing_zero_8bits不会回调
 func SplitFrame(frames []byte, onFrame func(nalu []byte) bool) {
-    beg, sc := FindStartCode(frames, 0)
-    for beg >= 0 {
-        end, sc2 := FindStartCode(frames, beg+int(sc))
-        if end == -1 {
-            if onFrame != nil {
-                onFrame(frames[beg+int(sc):])
-            }
-            break
-        }
-        if onFrame != nil && onFrame(frames[beg+int(sc):end]) == false {
+    beg, _ := FindStartCode(frames, 0)
+    if beg < 0 || onFrame == nil {
+        return
+    }
+    it := NewAnnexBNaluIterator(frames[beg:])
+    for it.Next() {
+        if !onFrame(it.Nalu()) {
             break
         }
-        beg = end
-        sc = sc2
     }
 }
 
@@ -75,41 +81,59 @@ func SplitAACFrame(frames []byte, onFrame func(aac []byte)) {
     var adts ADTS_Frame_Header
     start := FindSyncword(frames, 0)
     for start >= 0 {
-        adts.Decode(frames[start:])
-        onFrame(frames[start : start+int(adts.Variable_Header.Frame_length)])
-        start = FindSyncword(frames, start+int(adts.Variable_Header.Frame_length))
+        if adts.Decode(frames[start:]) != nil {
+            return
+        }
+        frameLength := int(adts.Variable_Header.Frame_length)
+        if frameLength < 7 || start+frameLength > len(frames) {
+            return
+        }
+        onFrame(frames[start : start+frameLength])
+        start = FindSyncword(frames, start+frameLength)
     }
 }
 
 func H264NaluType(h264 []byte) H264_NAL_TYPE {
-    loc, sc := FindStartCode(h264, 0)
-    return H264_NAL_TYPE(h264[loc+int(sc)] & 0x1F)
+    return H264NaluTypeWithoutStartCode(trimStartCode(h264))
 }
 
 func H264NaluTypeWithoutStartCode(h264 []byte) H264_NAL_TYPE {
+    if len(h264) < 1 {
+        return 0
+    }
     return H264_NAL_TYPE(h264[0] & 0x1F)
 }
 
 func H265NaluType(h265 []byte) H265_NAL_TYPE {
-    loc, sc := FindStartCode(h265, 0)
-    return H265_NAL_TYPE((h265[loc+int(sc)] >> 1) & 0x3F)
+    return H265NaluTypeWithoutStartCode(trimStartCode(h265))
 }
 
 func H265NaluTypeWithoutStartCode(h265 []byte) H265_NAL_TYPE {
+    if len(h265) < 1 {
+        return 0
+    }
     return H265_NAL_TYPE((h265[0] >> 1) & 0x3F)
 }
 
 func GetH264FirstMbInSlice(nalu []byte) uint64 {
-    start, sc := FindStartCode(nalu, 0)
-    bs := NewBitStream(nalu[start+int(sc)+1:])
+    nalu = trimStartCode(nalu)
+    if len(nalu) < 1 {
+        return 0
+    }
+    var buf [16]byte
+    bs := NewBitStream(RbspView(headBytes(nalu[1:], 16), buf[:]))
     sliceHdr := &SliceHeader{}
     sliceHdr.Decode(bs)
     return sliceHdr.First_mb_in_slice
 }
 
 func GetH265FirstMbInSlice(nalu []byte) uint64 {
-    start, sc := FindStartCode(nalu, 0)
-    bs := NewBitStream(nalu[start+int(sc)+2:])
+    nalu = trimStartCode(nalu)
+    if len(nalu) < 2 {
+        return 0
+    }
+    var buf [16]byte
+    bs := NewBitStream(RbspView(headBytes(nalu[2:], 16), buf[:]))
     sliceHdr := &SliceHeader{}
     sliceHdr.Decode(bs)
     return sliceHdr.First_mb_in_slice
@@ -165,6 +189,47 @@ func IsH265IDRFrame(h265 []byte) bool {
     return ret
 }
 
+// IsH264NewAccessUnit nalu(带startcode)是否为新的access unit的第一个nalu(7.4.1.2.3)
+// 调用方需要保证当前access unit中已经有VCL nalu
+func IsH264NewAccessUnit(nalu []byte) bool {
+    nalu_type := H264NaluType(nalu)
+    switch nalu_type {
+    case H264_NAL_AUD, H264_NAL_SPS,
+        H264_NAL_PPS, H264_NAL_SEI:
+        return true
+    case H264_NAL_I_SLICE, H264_NAL_P_SLICE,
+        H264_NAL_SLICE_A, H264_NAL_SLICE_B, H264_NAL_SLICE_C:
+        firstMbInSlice := GetH264FirstMbInSlice(nalu)
+        if firstMbInSlice == 0 {
+            return true
+        }
+    }
+    return false
+}
+
+// IsH265NewAccessUnit nalu(带startcode)是否为新的access unit的第一个nalu(7.4.2.4.4)
+func IsH265NewAccessUnit(nalu []byte) bool {
+    nalu_type := H265NaluType(nalu)
+    switch nalu_type {
+    case H265_NAL_AUD, H265_NAL_SPS,
+        H265_NAL_PPS, H265_NAL_SEI, H265_NAL_VPS:
+        return true
+    case H265_NAL_Slice_TRAIL_N, H265_NAL_LICE_TRAIL_R,
+        H265_NAL_SLICE_TSA_N, H265_NAL_SLICE_TSA_R,
+        H265_NAL_SLICE_STSA_N, H265_NAL_SLICE_STSA_R,
+        H265_NAL_SLICE_RADL_N, H265_NAL_SLICE_RADL_R,
+        H265_NAL_SLICE_RASL_N, H265_NAL_SLICE_RASL_R,
+        H265_NAL_SLICE_BLA_W_LP, H265_NAL_SLICE_BLA_W_RADL,
+        H265_NAL_SLICE_BLA_N_LP, H265_NAL_SLICE_IDR_W_RADL,
+        H265_NAL_SLICE_IDR_N_LP, H265_NAL_SLICE_CRA:
+        firstMbInSlice := GetH265FirstMbInSlice(nalu)
+        if firstMbInSlice == 0 {
+            return true
+        }
+    }
+    return false
+}
+
 func Max(x, y int) int {
     if x > y {
         return x
@@ -245,17 +310,36 @@ func CalcCrc32(crc uint32, buffer []byte) uint32 {
     return crc
 }
 
+// 返回新分配的内存, 不需要拷贝时使用RbspView
+// 注意: 以前最后3个字节是0x000003时不处理, 现在和RbspView一致也会去掉0x03
+// (cabac_zero_word结尾时编码器会在最后追加0x03, 7.4.1 emulation_prevention_three_byte)
 func CovertRbspToSodb(rbsp []byte) []byte {
-    bs := NewBitStream(rbsp)
-    bsw := NewBitStreamWriter(len(rbsp))
-    for !bs.EOS() {
-        if bs.RemainBytes() > 3 && bs.NextBits(24) == 0x000003 {
-            bsw.PutByte(bs.Uint8(8))
-            bsw.PutByte(bs.Uint8(8))
-            bs.SkipBits(8)
+    return appendRbsp(make([]byte, 0, len(rbsp)), rbsp, indexEmulationPrevention(rbsp, 0))
+}
+
+//插入防竞争字节 emulation_prevention_three_byte
+func CovertSodbToRbsp(sodb []byte) []byte {
+    rbsp := make([]byte, 0, len(sodb)+len(sodb)/64+4)
+    zeros := 0
+    for _, b := range sodb {
+        if zeros >= 2 && b <= 0x03 {
+            rbsp = append(rbsp, 0x03)
+            zeros = 0
+        }
+        rbsp = append(rbsp, b)
+        if b == 0 {
+            zeros++
         } else {
-            bsw.PutByte(bs.Uint8(8))
+            zeros = 0
         }
     }
-    return bsw.Bits()
+    return rbsp
+}
+
+// 只需要解析开头几个语法元素时, 避免处理整个nalu
+func headBytes(data []byte, n int) []byte {
+    if len(data) > n {
+        return data[:n]
+    }
+    return data
 }
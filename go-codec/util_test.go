@@ -26,6 +26,9 @@ func TestCovertRbspToSodb(t *testing.T) {
 		{name: "test", args: args{
 			rbsp: nalu,
 		}, want: result},
+		{name: "emulation prevention at the end", args: args{
+			rbsp: []byte{0x65, 0x88, 0x00, 0x00, 0x03},
+		}, want: []byte{0x65, 0x88, 0x00, 0x00}},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
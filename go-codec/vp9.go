@@ -0,0 +1,521 @@
+package codec
+
+import (
+    "errors"
+    "fmt"
+)
+
+// VP9 Bitstream & Decoding Process Specification v0.6
+// https://storage.googleapis.com/downloads.webmproject.org/docs/vp9/vp9-bitstream-specification-v0.6-20160331-draft.pdf
+//
+// uncompressed_header( ) {
+//     frame_marker                        f(2)
+//     profile_low_bit                     f(1)
+//     profile_high_bit                    f(1)
+//     Profile = (profile_high_bit << 1) + profile_low_bit
+//     if ( Profile == 3 )
+//         reserved_zero                   f(1)
+//     show_existing_frame                 f(1)
+//     if ( show_existing_frame == 1 ) {
+//         frame_to_show_map_idx           f(3)
+//         ......
+//         return
+//     }
+//     LastFrameType = frame_type
+//     frame_type                          f(1)
+//     show_frame                          f(1)
+//     error_resilient_mode                f(1)
+//     if ( frame_type == KEY_FRAME ) {
+//         frame_sync_code( )
+//         color_config( )
+//         frame_size( )
+//         render_size( )
+//         refresh_frame_flags = 0xFF
+//         FrameIsIntra = 1
+//     } else {
+//         ......
+//     }
+//     ......
+// }
+
+const (
+    VP9_KEY_FRAME     = 0
+    VP9_NON_KEY_FRAME = 1
+)
+
+const (
+    VP9_CS_UNKNOWN   = 0
+    VP9_CS_BT_601    = 1
+    VP9_CS_BT_709    = 2
+    VP9_CS_SMPTE_170 = 3
+    VP9_CS_SMPTE_240 = 4
+    VP9_CS_BT_2020   = 5
+    VP9_CS_RESERVED  = 6
+    VP9_CS_RGB       = 7
+)
+
+type VP9ColorConfig struct {
+    BitDepth      uint8
+    Color_space   uint8
+    Color_range   uint8
+    Subsampling_x uint8
+    Subsampling_y uint8
+}
+
+// color_config( ) {
+//     if ( Profile >= 2 ) {
+//         ten_or_twelve_bit               f(1)
+//         BitDepth = ten_or_twelve_bit ? 12 : 10
+//     } else {
+//         BitDepth = 8
+//     }
+//     color_space                         f(3)
+//     if ( color_space != CS_RGB ) {
+//         color_range                     f(1)
+//         if ( Profile == 1 || Profile == 3 ) {
+//             subsampling_x               f(1)
+//             subsampling_y               f(1)
+//             reserved_zero               f(1)
+//         } else {
+//             subsampling_x = 1
+//             subsampling_y = 1
+//         }
+//     } else {
+//         color_range = 1
+//         if ( Profile == 1 || Profile == 3 ) {
+//             subsampling_x = 0
+//             subsampling_y = 0
+//             reserved_zero               f(1)
+//         }
+//     }
+// }
+
+func (cc *VP9ColorConfig) Decode(bs *BitStream, profile uint8) {
+    if profile >= 2 {
+        if bs.GetBit() == 1 {
+            cc.BitDepth = 12
+        } else {
+            cc.BitDepth = 10
+        }
+    } else {
+        cc.BitDepth = 8
+    }
+    cc.Color_space = bs.Uint8(3)
+    if cc.Color_space != VP9_CS_RGB {
+        cc.Color_range = bs.GetBit()
+        if profile == 1 || profile == 3 {
+            cc.Subsampling_x = bs.GetBit()
+            cc.Subsampling_y = bs.GetBit()
+            bs.SkipBits(1)
+        } else {
+            cc.Subsampling_x = 1
+            cc.Subsampling_y = 1
+        }
+    } else {
+        cc.Color_range = 1
+        if profile == 1 || profile == 3 {
+            cc.Subsampling_x = 0
+            cc.Subsampling_y = 0
+            bs.SkipBits(1)
+        }
+    }
+}
+
+// VP9FrameHeader is the leading part of uncompressed_header(),
+// frame size is only available for key frame and intra only frame
+type VP9FrameHeader struct {
+    Frame_marker                    uint8
+    Profile                         uint8
+    Show_existing_frame             uint8
+    Frame_to_show_map_idx           uint8
+    Frame_type                      uint8
+    Show_frame                      uint8
+    Error_resilient_mode            uint8
+    Intra_only                      uint8
+    Reset_frame_context             uint8
+    ColorConfig                     VP9ColorConfig
+    Refresh_frame_flags             uint8
+    Frame_width                     uint32
+    Frame_height                    uint32
+    Render_and_frame_size_different uint8
+    Render_width                    uint32
+    Render_height                   uint32
+}
+
+func (hdr *VP9FrameHeader) Decode(bs *BitStream) error {
+    if bs.RemainBits() < 8 {
+        return errors.New("vp9 frame is too short")
+    }
+    hdr.Frame_marker = bs.Uint8(2)
+    if hdr.Frame_marker != 2 {
+        return errors.New("vp9 frame_marker must be 2")
+    }
+    profileLowBit := bs.GetBit()
+    profileHighBit := bs.GetBit()
+    hdr.Profile = profileHighBit<<1 | profileLowBit
+    if hdr.Profile == 3 {
+        bs.SkipBits(1)
+    }
+    hdr.Show_existing_frame = bs.GetBit()
+    if hdr.Show_existing_frame == 1 {
+        hdr.Frame_to_show_map_idx = bs.Uint8(3)
+        return nil
+    }
+    //the longest path is intra only frame: 5 bits + frame_sync_code + color_config + refresh_frame_flags + frame_size + render_size
+    if bs.RemainBits() < 5+24+8+8+33+32 {
+        return errors.New("vp9 frame is too short")
+    }
+    hdr.Frame_type = bs.GetBit()
+    hdr.Show_frame = bs.GetBit()
+    hdr.Error_resilient_mode = bs.GetBit()
+    if hdr.Frame_type == VP9_KEY_FRAME {
+        if err := vp9FrameSyncCode(bs); err != nil {
+            return err
+        }
+        hdr.ColorConfig.Decode(bs, hdr.Profile)
+        hdr.Refresh_frame_flags = 0xFF
+        hdr.Intra_only = 0
+        hdr.decodeFrameSize(bs)
+        return nil
+    }
+
+    if hdr.Show_frame == 0 {
+        hdr.Intra_only = bs.GetBit()
+    }
+    if hdr.Error_resilient_mode == 0 {
+        hdr.Reset_frame_context = bs.Uint8(2)
+    }
+    if hdr.Intra_only == 1 {
+        if err := vp9FrameSyncCode(bs); err != nil {
+            return err
+        }
+        if hdr.Profile > 0 {
+            hdr.ColorConfig.Decode(bs, hdr.Profile)
+        } else {
+            hdr.ColorConfig.BitDepth = 8
+            hdr.ColorConfig.Color_space = VP9_CS_BT_601
+            hdr.ColorConfig.Subsampling_x = 1
+            hdr.ColorConfig.Subsampling_y = 1
+        }
+        hdr.Refresh_frame_flags = bs.Uint8(8)
+        hdr.decodeFrameSize(bs)
+        return nil
+    }
+    hdr.Refresh_frame_flags = bs.Uint8(8)
+    return nil
+}
+
+// frame_size( ) {
+//     frame_width_minus_1                 f(16)
+//     frame_height_minus_1                f(16)
+// }
+// render_size( ) {
+//     render_and_frame_size_different     f(1)
+//     if ( render_and_frame_size_different == 1 ) {
+//         render_width_minus_1            f(16)
+//         render_height_minus_1           f(16)
+//     }
+// }
+
+func (hdr *VP9FrameHeader) decodeFrameSize(bs *BitStream) {
+    hdr.Frame_width = bs.Uint32(16) + 1
+    hdr.Frame_height = bs.Uint32(16) + 1
+    hdr.Render_and_frame_size_different = bs.GetBit()
+    if hdr.Render_and_frame_size_different == 1 {
+        hdr.Render_width = bs.Uint32(16) + 1
+        hdr.Render_height = bs.Uint32(16) + 1
+    } else {
+        hdr.Render_width = hdr.Frame_width
+        hdr.Render_height = hdr.Frame_height
+    }
+}
+
+func vp9FrameSyncCode(bs *BitStream) error {
+    if bs.Uint8(8) != 0x49 || bs.Uint8(8) != 0x83 || bs.Uint8(8) != 0x42 {
+        return errors.New("invalid vp9 frame_sync_code")
+    }
+    return nil
+}
+
+func DecodeVP9FrameHeader(frame []byte) (*VP9FrameHeader, error) {
+    hdr := &VP9FrameHeader{}
+    bs := NewBitStream(frame)
+    if err := hdr.Decode(bs); err != nil {
+        return nil, err
+    }
+    if bs.Err() != nil {
+        return nil, fmt.Errorf("vp9 frame header: %w", bs.Err())
+    }
+    return hdr, nil
+}
+
+// Annex B Superframes
+//
+// superframe_index( ) {
+//     SZ = 0
+//     superframe_marker                   f(3)
+//     bytes_per_framesize_minus_1         f(2)
+//     frames_in_superframe_minus_1        f(3)
+//     for ( i = 0; i <= frames_in_superframe_minus_1; i++ ) {
+//         frame_sizes[ i ]                le(bytes_per_framesize_minus_1 + 1)
+//     }
+//     superframe_marker                   f(3)
+//     bytes_per_framesize_minus_1         f(2)
+//     frames_in_superframe_minus_1        f(3)
+// }
+
+// SplitVP9Superframe split the chunk into frames, if the chunk is not a superframe, onFrame is called with the whole chunk
+func SplitVP9Superframe(chunk []byte, onFrame func(frame []byte) bool) error {
+    if len(chunk) == 0 {
+        return errors.New("empty vp9 chunk")
+    }
+    marker := chunk[len(chunk)-1]
+    if marker&0xE0 != 0xC0 {
+        if onFrame != nil {
+            onFrame(chunk)
+        }
+        return nil
+    }
+    bytesPerFramesize := int((marker>>3)&0x03) + 1
+    framesInSuperframe := int(marker&0x07) + 1
+    indexSize := 2 + bytesPerFramesize*framesInSuperframe
+    if len(chunk) < indexSize || chunk[len(chunk)-indexSize] != marker {
+        if onFrame != nil {
+            onFrame(chunk)
+        }
+        return nil
+    }
+    index := chunk[len(chunk)-indexSize+1 : len(chunk)-1]
+    data := chunk[:len(chunk)-indexSize]
+    for i := 0; i < framesInSuperframe; i++ {
+        framesize := 0
+        for j := 0; j < bytesPerFramesize; j++ {
+            framesize |= int(index[i*bytesPerFramesize+j]) << (j * 8)
+        }
+        if framesize > len(data) {
+            return errors.New("vp9 superframe frame size is out of range")
+        }
+        if onFrame != nil && !onFrame(data[:framesize]) {
+            return nil
+        }
+        data = data[framesize:]
+    }
+    return nil
+}
+
+func IsVP9KeyFrame(chunk []byte) bool {
+    ret := false
+    SplitVP9Superframe(chunk, func(frame []byte) bool {
+        hdr, err := DecodeVP9FrameHeader(frame)
+        if err != nil {
+            return false
+        }
+        if hdr.Show_existing_frame == 0 && hdr.Frame_type == VP9_KEY_FRAME {
+            ret = true
+            return false
+        }
+        return true
+    })
+    return ret
+}
+
+func GetVP9Resolution(chunk []byte) (width int, height int, err error) {
+    err = errors.New("the frame is not key frame")
+    SplitVP9Superframe(chunk, func(frame []byte) bool {
+        hdr, e := DecodeVP9FrameHeader(frame)
+        if e != nil {
+            err = e
+            return false
+        }
+        if hdr.Show_existing_frame == 0 && (hdr.Frame_type == VP9_KEY_FRAME || hdr.Intra_only == 1) {
+            width, height, err = int(hdr.Frame_width), int(hdr.Frame_height), nil
+            return false
+        }
+        return true
+    })
+    return
+}
+
+// VP Codec ISO Media File Format Binding
+// https://www.webmproject.org/vp9/mp4/
+//
+// class VPCodecConfigurationBox extends FullBox('vpcC', version = 1, 0)
+// {
+//     VPCodecConfigurationRecord() vpcConfig;
+// }
+//
+// aligned (8) class VPCodecConfigurationRecord {
+//     unsigned int (8)     profile;
+//     unsigned int (8)     level;
+//     unsigned int (4)     bitDepth;
+//     unsigned int (3)     chromaSubsampling;
+//     unsigned int (1)     videoFullRangeFlag;
+//     unsigned int (8)     colourPrimaries;
+//     unsigned int (8)     transferCharacteristics;
+//     unsigned int (8)     matrixCoefficients;
+//     unsigned int (16)    codecIntializationDataSize;
+//     unsigned int (8)[]   codecIntializationData;
+// }
+
+const (
+    VPCC_CHROMA_420_VERTICAL             = 0
+    VPCC_CHROMA_420_COLLOCATED_WITH_LUMA = 1
+    VPCC_CHROMA_422                      = 2
+    VPCC_CHROMA_444                      = 3
+)
+
+type VPCodecConfigurationRecord struct {
+    Profile                    uint8
+    Level                      uint8
+    BitDepth                   uint8
+    ChromaSubsampling          uint8
+    VideoFullRangeFlag         uint8
+    ColourPrimaries            uint8
+    TransferCharacteristics    uint8
+    MatrixCoefficients         uint8
+    CodecIntializationDataSize uint16
+    CodecIntializationData     []byte
+}
+
+func NewVPCodecConfigurationRecord() *VPCodecConfigurationRecord {
+    return &VPCodecConfigurationRecord{
+        BitDepth:                8,
+        ColourPrimaries:         2,
+        TransferCharacteristics: 2,
+        MatrixCoefficients:      2,
+    }
+}
+
+func (vpcc *VPCodecConfigurationRecord) Encode() []byte {
+    bsw := NewBitStreamWriter(8 + len(vpcc.CodecIntializationData))
+    bsw.PutByte(vpcc.Profile)
+    bsw.PutByte(vpcc.Level)
+    bsw.PutUint8(vpcc.BitDepth, 4)
+    bsw.PutUint8(vpcc.ChromaSubsampling, 3)
+    bsw.PutUint8(vpcc.VideoFullRangeFlag, 1)
+    bsw.PutByte(vpcc.ColourPrimaries)
+    bsw.PutByte(vpcc.TransferCharacteristics)
+    bsw.PutByte(vpcc.MatrixCoefficients)
+    bsw.PutUint16(uint16(len(vpcc.CodecIntializationData)), 16)
+    if len(vpcc.CodecIntializationData) > 0 {
+        bsw.PutBytes(vpcc.CodecIntializationData)
+    }
+    return bsw.Bits()
+}
+
+func (vpcc *VPCodecConfigurationRecord) Decode(buf []byte) error {
+    if len(buf) < 8 {
+        return errors.New("len of vpcC < 8")
+    }
+    vpcc.Profile = buf[0]
+    vpcc.Level = buf[1]
+    vpcc.BitDepth = buf[2] >> 4
+    vpcc.ChromaSubsampling = (buf[2] >> 1) & 0x07
+    vpcc.VideoFullRangeFlag = buf[2] & 0x01
+    vpcc.ColourPrimaries = buf[3]
+    vpcc.TransferCharacteristics = buf[4]
+    vpcc.MatrixCoefficients = buf[5]
+    vpcc.CodecIntializationDataSize = uint16(buf[6])<<8 | uint16(buf[7])
+    if int(vpcc.CodecIntializationDataSize) > len(buf)-8 {
+        return errors.New("codecIntializationData is truncated")
+    }
+    vpcc.CodecIntializationData = make([]byte, vpcc.CodecIntializationDataSize)
+    copy(vpcc.CodecIntializationData, buf[8:])
+    return nil
+}
+
+// UpdateVP9FrameHeader fill vpcC with the key frame or intra only frame header,
+// vp9 does not signal colour primaries and transfer characteristics, they are left unchanged
+func (vpcc *VPCodecConfigurationRecord) UpdateVP9FrameHeader(hdr *VP9FrameHeader) {
+    vpcc.Profile = hdr.Profile
+    vpcc.BitDepth = hdr.ColorConfig.BitDepth
+    vpcc.VideoFullRangeFlag = hdr.ColorConfig.Color_range
+    switch {
+    case hdr.ColorConfig.Subsampling_x == 1 && hdr.ColorConfig.Subsampling_y == 1:
+        vpcc.ChromaSubsampling = VPCC_CHROMA_420_VERTICAL
+    case hdr.ColorConfig.Subsampling_x == 1 && hdr.ColorConfig.Subsampling_y == 0:
+        vpcc.ChromaSubsampling = VPCC_CHROMA_422
+    default:
+        vpcc.ChromaSubsampling = VPCC_CHROMA_444
+    }
+    //ISO/IEC 23091-4 MatrixCoefficients
+    switch hdr.ColorConfig.Color_space {
+    case VP9_CS_BT_601:
+        vpcc.MatrixCoefficients = 5
+    case VP9_CS_BT_709:
+        vpcc.MatrixCoefficients = 1
+    case VP9_CS_SMPTE_170:
+        vpcc.MatrixCoefficients = 6
+    case VP9_CS_SMPTE_240:
+        vpcc.MatrixCoefficients = 7
+    case VP9_CS_BT_2020:
+        vpcc.MatrixCoefficients = 9
+    case VP9_CS_RGB:
+        vpcc.MatrixCoefficients = 0
+    default:
+        vpcc.MatrixCoefficients = 2
+    }
+    if hdr.Frame_width > 0 && hdr.Frame_height > 0 && vpcc.Level == 0 {
+        vpcc.Level = GetVP9Level(int(hdr.Frame_width), int(hdr.Frame_height), 0)
+    }
+}
+
+// https://www.webmproject.org/vp9/levels/
+var vp9LevelTable = [...]struct {
+    level          uint8
+    maxPictureSize int64
+    maxSampleRate  int64
+}{
+    {10, 36864, 829440},
+    {11, 73728, 2764800},
+    {20, 122880, 4608000},
+    {21, 245760, 9216000},
+    {30, 552960, 20736000},
+    {31, 983040, 36864000},
+    {40, 2228224, 83558400},
+    {41, 2228224, 160432128},
+    {50, 8912896, 311951360},
+    {51, 8912896, 588251136},
+    {52, 8912896, 1176502272},
+    {60, 35651584, 1176502272},
+    {61, 35651584, 2353004544},
+    {62, 35651584, 4706009088},
+}
+
+// GetVP9Level return the minimum level which supports the picture size and frame rate,
+// frameRate <= 0 means only picture size is considered
+func GetVP9Level(width int, height int, frameRate float64) uint8 {
+    pictureSize := int64(width) * int64(height)
+    sampleRate := int64(float64(pictureSize) * frameRate)
+    for _, l := range vp9LevelTable {
+        if pictureSize <= l.maxPictureSize && sampleRate <= l.maxSampleRate {
+            return l.level
+        }
+    }
+    return vp9LevelTable[len(vp9LevelTable)-1].level
+}
+
+// CreateVP9VPCodecConfigurationRecord create vpcC from a chunk which contains key frame
+func CreateVP9VPCodecConfigurationRecord(chunk []byte) ([]byte, error) {
+    var keyHdr *VP9FrameHeader
+    err := SplitVP9Superframe(chunk, func(frame []byte) bool {
+        hdr, err := DecodeVP9FrameHeader(frame)
+        if err != nil {
+            return false
+        }
+        if hdr.Show_existing_frame == 0 && hdr.Frame_type == VP9_KEY_FRAME {
+            keyHdr = hdr
+            return false
+        }
+        return true
+    })
+    if err != nil {
+        return nil, err
+    }
+    if keyHdr == nil {
+        return nil, errors.New("not found vp9 key frame")
+    }
+    vpcc := NewVPCodecConfigurationRecord()
+    vpcc.UpdateVP9FrameHeader(keyHdr)
+    return vpcc.Encode(), nil
+}
@@ -0,0 +1,96 @@
+package codec
+
+import (
+    "bytes"
+    "testing"
+)
+
+// key frame, profile 0, BT.709, 352x288
+var vp9KeyFrame []byte = []byte{0x82, 0x49, 0x83, 0x42, 0x40, 0x15, 0xF0, 0x11, 0xF0,
+    0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00}
+
+func TestDecodeVP9FrameHeader(t *testing.T) {
+    hdr, err := DecodeVP9FrameHeader(vp9KeyFrame)
+    if err != nil {
+        t.Fatalf("DecodeVP9FrameHeader() error = %v", err)
+    }
+    if hdr.Profile != 0 || hdr.Frame_type != VP9_KEY_FRAME || hdr.Show_frame != 1 {
+        t.Errorf("DecodeVP9FrameHeader() = %+v", hdr)
+    }
+    if hdr.Frame_width != 352 || hdr.Frame_height != 288 {
+        t.Errorf("resolution = %dx%d, want 352x288", hdr.Frame_width, hdr.Frame_height)
+    }
+    if hdr.ColorConfig.BitDepth != 8 || hdr.ColorConfig.Color_space != VP9_CS_BT_709 {
+        t.Errorf("color config = %+v", hdr.ColorConfig)
+    }
+    if _, err := DecodeVP9FrameHeader(vp9KeyFrame[:9]); err == nil {
+        t.Errorf("DecodeVP9FrameHeader() want error for truncated frame")
+    }
+}
+
+func TestSplitVP9Superframe(t *testing.T) {
+    superframe := append([]byte{}, vp9KeyFrame...)
+    superframe = append(superframe, 0x88)
+    superframe = append(superframe, 0xC1, 0x10, 0x01, 0xC1)
+    var frames [][]byte
+    err := SplitVP9Superframe(superframe, func(frame []byte) bool {
+        frames = append(frames, frame)
+        return true
+    })
+    if err != nil {
+        t.Fatalf("SplitVP9Superframe() error = %v", err)
+    }
+    if len(frames) != 2 || !bytes.Equal(frames[0], vp9KeyFrame) || !bytes.Equal(frames[1], []byte{0x88}) {
+        t.Fatalf("SplitVP9Superframe() = %x", frames)
+    }
+    hdr, err := DecodeVP9FrameHeader(frames[1])
+    if err != nil || hdr.Show_existing_frame != 1 {
+        t.Errorf("DecodeVP9FrameHeader() = %+v, %v", hdr, err)
+    }
+    if !IsVP9KeyFrame(superframe) {
+        t.Errorf("IsVP9KeyFrame() = false, want true")
+    }
+    w, h, err := GetVP9Resolution(superframe)
+    if err != nil || w != 352 || h != 288 {
+        t.Errorf("GetVP9Resolution() = %d,%d,%v", w, h, err)
+    }
+}
+
+func TestVPCodecConfigurationRecord(t *testing.T) {
+    vpcc, err := CreateVP9VPCodecConfigurationRecord(vp9KeyFrame)
+    if err != nil {
+        t.Fatalf("CreateVP9VPCodecConfigurationRecord() error = %v", err)
+    }
+    want := []byte{0x00, 0x14, 0x80, 0x02, 0x02, 0x01, 0x00, 0x00}
+    if !bytes.Equal(vpcc, want) {
+        t.Errorf("CreateVP9VPCodecConfigurationRecord() = %x, want %x", vpcc, want)
+    }
+    record := &VPCodecConfigurationRecord{}
+    if err := record.Decode(vpcc); err != nil {
+        t.Fatalf("VPCodecConfigurationRecord.Decode() error = %v", err)
+    }
+    if !bytes.Equal(record.Encode(), vpcc) {
+        t.Errorf("Encode() = %x, want %x", record.Encode(), vpcc)
+    }
+}
+
+func TestGetVP9Level(t *testing.T) {
+    tests := []struct {
+        name          string
+        width, height int
+        fps           float64
+        want          uint8
+    }{
+        {name: "cif", width: 352, height: 288, fps: 30, want: 20},
+        {name: "1080p30", width: 1920, height: 1080, fps: 30, want: 40},
+        {name: "1080p60", width: 1920, height: 1080, fps: 60, want: 41},
+        {name: "4k", width: 3840, height: 2160, fps: 0, want: 50},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := GetVP9Level(tt.width, tt.height, tt.fps); got != tt.want {
+                t.Errorf("GetVP9Level() = %v, want %v", got, tt.want)
+            }
+        })
+    }
+}
@@ -1,8 +1,8 @@
 package flv
 
 import (
-    "encoding/binary"
     "errors"
+    "fmt"
 
     "github.com/yapingcat/gomedia/go-codec"
 )
@@ -14,15 +14,14 @@ type VideoTagDemuxer interface {
 }
 
 type AVCTagDemuxer struct {
-    spss    map[uint64][]byte
-    ppss    map[uint64][]byte
+    bsf     *codec.LengthToAnnexBFilter
     onframe OnVideoFrameCallBack
 }
 
 func NewAVCTagDemuxer() *AVCTagDemuxer {
+    bsf, _ := codec.NewLengthToAnnexBFilter(codec.CODECID_VIDEO_H264, nil)
     return &AVCTagDemuxer{
-        spss:    make(map[uint64][]byte),
-        ppss:    make(map[uint64][]byte),
+        bsf:     bsf,
         onframe: nil,
     }
 }
@@ -34,80 +33,39 @@ func (demuxer *AVCTagDemuxer) OnFrame(onframe OnVideoFrameCallBack) {
 func (demuxer *AVCTagDemuxer) Decode(data []byte) error {
 
     if len(data) < 5 {
-        return errors.New("avc tag size < 5")
+        return fmt.Errorf("avc tag: %w: size < 5", codec.ErrTruncated)
     }
 
     vtag := VideoTag{}
-    vtag.Decode(data[0:5])
+    if err := vtag.Decode(data[0:5]); err != nil {
+        return err
+    }
     data = data[5:]
     if vtag.AVCPacketType == AVC_SEQUENCE_HEADER {
-        tmpspss, tmpppss := codec.CovertExtradata(data)
-        for _, sps := range tmpspss {
-            spsid := codec.GetSPSId(sps)
-            tmpsps := make([]byte, len(sps))
-            copy(tmpsps, sps)
-            demuxer.spss[spsid] = tmpsps
-        }
-        for _, pps := range tmpppss {
-            ppsid := codec.GetPPSId(pps)
-            tmppps := make([]byte, len(pps))
-            copy(tmppps, pps)
-            demuxer.ppss[ppsid] = tmppps
-        }
-    } else {
-        var hassps bool
-        var haspps bool
-        var idr bool
-        tmpdata := data
-        for len(tmpdata) > 0 {
-            naluSize := binary.BigEndian.Uint32(tmpdata)
-            codec.CovertAVCCToAnnexB(tmpdata)
-            naluType := codec.H264NaluType(tmpdata)
-            if naluType == codec.H264_NAL_I_SLICE {
-                idr = true
-            } else if naluType == codec.H264_NAL_SPS {
-                hassps = true
-            } else if naluType == codec.H264_NAL_PPS {
-                haspps = true
-            } else if naluType < codec.H264_NAL_I_SLICE {
-                sh := codec.SliceHeader{}
-                sh.Decode(codec.NewBitStream(tmpdata[5:]))
-                if sh.Slice_type == 2 || sh.Slice_type == 7 {
-                    idr = true
-                }
-            }
-            tmpdata = tmpdata[4+naluSize:]
-        }
-
-        if idr && (!hassps || !haspps) {
-            var nalus []byte = make([]byte, 0, 2048)
-            for _, sps := range demuxer.spss {
-                nalus = append(nalus, sps...)
-            }
-            for _, pps := range demuxer.ppss {
-                nalus = append(nalus, pps...)
-            }
-            nalus = append(nalus, data...)
-            if demuxer.onframe != nil {
-                demuxer.onframe(codec.CODECID_VIDEO_H264, nalus, int(vtag.CompositionTime))
-            }
-        } else {
-            if demuxer.onframe != nil && len(data) > 0 {
-                demuxer.onframe(codec.CODECID_VIDEO_H264, data, int(vtag.CompositionTime))
-            }
-        }
+        return demuxer.bsf.SetExtradata(data)
+    }
+    //关键帧之前没有sps/pps时由bsf插入
+    frame, err := demuxer.bsf.Filter(data)
+    if err != nil {
+        return err
+    }
+    if demuxer.onframe != nil && len(frame) > 0 {
+        demuxer.onframe(codec.CODECID_VIDEO_H264, frame, int(vtag.CompositionTime))
     }
     return nil
 }
 
 type HevcTagDemuxer struct {
     SpsPpsVps []byte
+    bsf       *codec.LengthToAnnexBFilter
     onframe   OnVideoFrameCallBack
 }
 
 func NewHevcTagDemuxer() *HevcTagDemuxer {
+    bsf, _ := codec.NewLengthToAnnexBFilter(codec.CODECID_VIDEO_H265, nil)
     return &HevcTagDemuxer{
         SpsPpsVps: make([]byte, 0),
+        bsf:       bsf,
         onframe:   nil,
     }
 }
@@ -119,7 +77,7 @@ func (demuxer *HevcTagDemuxer) OnFrame(onframe OnVideoFrameCallBack) {
 func (demuxer *HevcTagDemuxer) Decode(data []byte) error {
 
     if len(data) < 5 {
-        return errors.New("hevc tag size < 5")
+        return fmt.Errorf("hevc tag: %w: size < 5", codec.ErrTruncated)
     }
 
     vtag := VideoTag{}
@@ -127,68 +85,57 @@ func (demuxer *HevcTagDemuxer) Decode(data []byte) error {
     isExHeader := data[0] & 0x80
     if isExHeader != 0 {
         // enhanced flv
-        vtag.Decode(data[0:8])
+        if err := vtag.Decode(data); err != nil {
+            return err
+        }
         if vtag.AVCPacketType == PacketTypeSequenceStart {
-            data = data[5:]
-            hvcc := codec.NewHEVCRecordConfiguration()
-            hvcc.Decode(data)
-            demuxer.SpsPpsVps = hvcc.ToNalus()
+            return demuxer.decodeHvcc(data[5:])
         } else if vtag.AVCPacketType == PacketTypeCodedFrames {
+            if len(data) < 8 {
+                return fmt.Errorf("hevc tag: %w: size < 8", codec.ErrTruncated)
+            }
             data = data[8:]
-            demuxer.decodeNalus(data, vtag.CompositionTime)
+            return demuxer.decodeNalus(data, vtag.CompositionTime)
         } else if vtag.AVCPacketType == PacketTypeCodedFramesX {
             data = data[5:]
-            demuxer.decodeNalus(data, vtag.CompositionTime)
+            return demuxer.decodeNalus(data, vtag.CompositionTime)
         }
     } else {
-        vtag.Decode(data[0:5])
+        if err := vtag.Decode(data[0:5]); err != nil {
+            return err
+        }
         data = data[5:]
         if vtag.AVCPacketType == AVC_SEQUENCE_HEADER {
-            hvcc := codec.NewHEVCRecordConfiguration()
-            hvcc.Decode(data)
-            demuxer.SpsPpsVps = hvcc.ToNalus()
+            return demuxer.decodeHvcc(data)
         } else {
-            demuxer.decodeNalus(data, vtag.CompositionTime)
+            return demuxer.decodeNalus(data, vtag.CompositionTime)
         }
     }
 
     return nil
 }
 
-func (demuxer *HevcTagDemuxer) decodeNalus(data []byte, CompositionTime int32) error {
-    var hassps bool
-    var haspps bool
-    var hasvps bool
-    var idr bool
-    tmpdata := data
-    for len(tmpdata) > 0 {
-        naluSize := binary.BigEndian.Uint32(tmpdata)
-        codec.CovertAVCCToAnnexB(tmpdata)
-        naluType := codec.H265NaluType(tmpdata)
-        if naluType >= 16 && naluType <= 21 {
-            idr = true
-        } else if naluType == codec.H265_NAL_SPS {
-            hassps = true
-        } else if naluType == codec.H265_NAL_PPS {
-            haspps = true
-        } else if naluType == codec.H265_NAL_VPS {
-            hasvps = true
-        }
-        tmpdata = tmpdata[4+naluSize:]
+func (demuxer *HevcTagDemuxer) decodeHvcc(data []byte) error {
+    if err := demuxer.bsf.SetExtradata(data); err != nil {
+        return err
     }
-
-    if idr && (!hassps || !haspps || !hasvps) {
-        var nalus []byte = make([]byte, 0, 2048)
-        nalus = append(demuxer.SpsPpsVps, data...)
-        if demuxer.onframe != nil {
-            demuxer.onframe(codec.CODECID_VIDEO_H265, nalus, int(CompositionTime))
-        }
-    } else {
-        if demuxer.onframe != nil {
-            demuxer.onframe(codec.CODECID_VIDEO_H265, data, int(CompositionTime))
-        }
+    hvcc := codec.NewHEVCRecordConfiguration()
+    if err := hvcc.Decode(data); err != nil {
+        return err
     }
+    demuxer.SpsPpsVps = hvcc.ToNalus()
+    return nil
+}
 
+func (demuxer *HevcTagDemuxer) decodeNalus(data []byte, CompositionTime int32) error {
+    //关键帧之前没有vps/sps/pps时由bsf插入
+    frame, err := demuxer.bsf.Filter(data)
+    if err != nil {
+        return err
+    }
+    if demuxer.onframe != nil && len(frame) > 0 {
+        demuxer.onframe(codec.CODECID_VIDEO_H265, frame, int(CompositionTime))
+    }
     return nil
 }
 
@@ -200,13 +147,12 @@ type AudioTagDemuxer interface {
 }
 
 type AACTagDemuxer struct {
-    asc     []byte
+    bsf     *codec.ADTSAddFilter
     onframe OnAudioFrameCallBack
 }
 
 func NewAACTagDemuxer() *AACTagDemuxer {
     return &AACTagDemuxer{
-        asc:     make([]byte, 0, 2),
         onframe: nil,
     }
 }
@@ -218,7 +164,7 @@ func (demuxer *AACTagDemuxer) OnFrame(onframe OnAudioFrameCallBack) {
 func (demuxer *AACTagDemuxer) Decode(data []byte) error {
 
     if len(data) < 2 {
-        return errors.New("aac tag size < 2")
+        return fmt.Errorf("aac tag: %w: size < 2", codec.ErrTruncated)
     }
 
     atag := AudioTag{}
@@ -228,14 +174,20 @@ func (demuxer *AACTagDemuxer) Decode(data []byte) error {
     }
     data = data[2:]
     if atag.AACPacketType == AAC_SEQUENCE_HEADER {
-        demuxer.asc = make([]byte, len(data))
-        copy(demuxer.asc, data)
+        if demuxer.bsf == nil {
+            demuxer.bsf, err = codec.NewADTSAddFilter(data)
+        } else {
+            err = demuxer.bsf.SetASC(data)
+        }
+        return err
     } else {
-        adts, err := codec.ConvertASCToADTS(demuxer.asc, len(data)+7)
+        if demuxer.bsf == nil {
+            return errors.New("aac sequence header has not been received")
+        }
+        adts_frame, err := demuxer.bsf.Filter(data)
         if err != nil {
             return err
         }
-        adts_frame := append(adts.Encode(), data...)
         if demuxer.onframe != nil {
             demuxer.onframe(codec.CODECID_AUDIO_AAC, adts_frame)
         }
@@ -262,7 +214,7 @@ func (demuxer *G711Demuxer) OnFrame(onframe OnAudioFrameCallBack) {
 func (demuxer *G711Demuxer) Decode(data []byte) error {
 
     if len(data) < 1 {
-        return errors.New("audio tag size < 1")
+        return fmt.Errorf("audio tag: %w: size < 1", codec.ErrTruncated)
     }
 
     atag := AudioTag{}
@@ -278,26 +230,26 @@ func (demuxer *G711Demuxer) Decode(data []byte) error {
     return nil
 }
 
-func CreateAudioTagDemuxer(formats FLV_SOUND_FORMAT) (demuxer AudioTagDemuxer) {
+func CreateAudioTagDemuxer(formats FLV_SOUND_FORMAT) (demuxer AudioTagDemuxer, err error) {
     switch formats {
     case FLV_G711A, FLV_G711U, FLV_MP3:
         demuxer = NewG711Demuxer(formats)
     case FLV_AAC:
         demuxer = NewAACTagDemuxer()
     default:
-        panic("unsupport audio codec id")
+        err = fmt.Errorf("flv: %w: sound format %d", codec.ErrUnsupportedCodec, formats)
     }
     return
 }
 
-func CreateFlvVideoTagHandle(cid FLV_VIDEO_CODEC_ID) (demuxer VideoTagDemuxer) {
+func CreateFlvVideoTagHandle(cid FLV_VIDEO_CODEC_ID) (demuxer VideoTagDemuxer, err error) {
     switch cid {
     case FLV_AVC:
         demuxer = NewAVCTagDemuxer()
     case FLV_HEVC:
         demuxer = NewHevcTagDemuxer()
     default:
-        panic("unsupport audio codec id")
+        err = fmt.Errorf("flv: %w: video codec id %d", codec.ErrUnsupportedCodec, cid)
     }
     return
 }
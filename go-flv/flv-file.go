@@ -3,6 +3,7 @@ package flv
 import (
     "encoding/binary"
     "errors"
+    "fmt"
     "io"
 
     "github.com/yapingcat/gomedia/go-codec"
@@ -118,7 +119,9 @@ func (f *FlvReader) Input(data []byte) (err error) {
             if len(buf) < 11 {
                 goto end
             }
-            f.flvTag.Decode(buf)
+            if err = f.flvTag.Decode(buf); err != nil {
+                goto end
+            }
             buf = buf[11:]
             if f.flvTag.TagType == uint8(VIDEO_TAG) {
                 if f.videoDemuxer == nil {
@@ -173,7 +176,8 @@ func (f *FlvReader) Input(data []byte) (err error) {
             buf = buf[f.flvTag.DataSize:]
             f.state = FLV_PARSER_TAG_SIZE
         default:
-            panic("unkown state")
+            err = fmt.Errorf("flv reader: %w: %d", codec.ErrInvalidState, f.state)
+            goto end
         }
     }
 
@@ -205,7 +209,7 @@ func (f *FlvReader) createVideoTagDemuxer(cid FLV_VIDEO_CODEC_ID) error {
     case FLV_HEVC:
         f.videoDemuxer = NewHevcTagDemuxer()
     default:
-        return errors.New("unsupport video codec id")
+        return fmt.Errorf("flv reader: %w: video codec id %d", codec.ErrUnsupportedCodec, cid)
     }
     f.videoDemuxer.OnFrame(func(codecid codec.CodecID, frame []byte, cts int) {
         dts := uint32(f.flvTag.TimestampExtended)<<24 | f.flvTag.Timestamp
@@ -222,7 +226,7 @@ func (f *FlvReader) createAudioTagDemuxer(formats FLV_SOUND_FORMAT) error {
     case FLV_AAC:
         f.audioDemuxer = NewAACTagDemuxer()
     default:
-        return errors.New("unsupport audio codec id")
+        return fmt.Errorf("flv reader: %w: sound format %d", codec.ErrUnsupportedCodec, formats)
     }
     f.audioDemuxer.OnFrame(func(codecid codec.CodecID, frame []byte) {
         dts := uint32(f.flvTag.TimestampExtended)<<24 | f.flvTag.Timestamp
@@ -285,7 +289,7 @@ func (f *FlvWriter) WriteAAC(data []byte, pts uint32, dts uint32) error {
         f.muxer.SetAudioCodeId(FLV_AAC)
     } else {
         if _, ok := f.muxer.audioMuxer.(*AACMuxer); !ok {
-            panic("audio codec change")
+            return fmt.Errorf("flv writer: %w: audio codec change to aac", codec.ErrCodecChanged)
         }
     }
     return f.writeAudio(data, pts, dts)
@@ -296,7 +300,7 @@ func (f *FlvWriter) WriteG711A(data []byte, pts uint32, dts uint32) error {
         f.muxer.SetAudioCodeId(FLV_G711A)
     } else {
         if _, ok := f.muxer.audioMuxer.(*G711AMuxer); !ok {
-            panic("audio codec change")
+            return fmt.Errorf("flv writer: %w: audio codec change to g711a", codec.ErrCodecChanged)
         }
     }
     return f.writeAudio(data, pts, dts)
@@ -307,7 +311,7 @@ func (f *FlvWriter) WriteG711U(data []byte, pts uint32, dts uint32) error {
         f.muxer.SetAudioCodeId(FLV_G711U)
     } else {
         if _, ok := f.muxer.audioMuxer.(*G711UMuxer); !ok {
-            panic("audio codec change")
+            return fmt.Errorf("flv writer: %w: audio codec change to g711u", codec.ErrCodecChanged)
         }
     }
     return f.writeAudio(data, pts, dts)
@@ -318,7 +322,7 @@ func (f *FlvWriter) WriteMp3(data []byte, pts uint32, dts uint32) error {
         f.muxer.SetAudioCodeId(FLV_MP3)
     } else {
         if _, ok := f.muxer.audioMuxer.(*Mp3Muxer); !ok {
-            panic("audio codec change")
+            return fmt.Errorf("flv writer: %w: audio codec change to mp3", codec.ErrCodecChanged)
         }
     }
     return f.writeAudio(data, pts, dts)
@@ -347,7 +351,7 @@ func (f *FlvWriter) WriteH264(data []byte, pts uint32, dts uint32) error {
         f.muxer.SetVideoCodeId(FLV_AVC)
     } else {
         if _, ok := f.muxer.videoMuxer.(*AVCMuxer); !ok {
-            panic("video codec change")
+            return fmt.Errorf("flv writer: %w: video codec change to h264", codec.ErrCodecChanged)
         }
     }
 
@@ -359,7 +363,7 @@ func (f *FlvWriter) WriteH265(data []byte, pts uint32, dts uint32) error {
         f.muxer.SetVideoCodeId(FLV_HEVC)
     } else {
         if _, ok := f.muxer.videoMuxer.(*HevcMuxer); !ok {
-            panic("video codec change")
+            return fmt.Errorf("flv writer: %w: video codec change to h265", codec.ErrCodecChanged)
         }
     }
     return f.writeVideo(data, pts, dts)
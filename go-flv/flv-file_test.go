@@ -1,6 +1,8 @@
 package flv
 
 import (
+	"bytes"
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
@@ -118,3 +120,52 @@ func TestFlvReadH265(t *testing.T) {
 		}
 	})
 }
+
+func TestFlvWriter_CodecChange(t *testing.T) {
+	var buf bytes.Buffer
+	wf := CreateFlvWriter(&buf)
+	if err := wf.WriteFlvHeader(); err != nil {
+		t.Fatal(err)
+	}
+	if err := wf.WriteG711A(make([]byte, 160), 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	if err := wf.WriteAAC(make([]byte, 160), 20, 20); !errors.Is(err, codec.ErrCodecChanged) {
+		t.Errorf("WriteAAC() error = %v, want ErrCodecChanged", err)
+	}
+}
+
+func TestFlvReader_UnsupportedCodec(t *testing.T) {
+	flv := []byte{'F', 'L', 'V', 0x01, 0x01, 0x00, 0x00, 0x00, 0x09, 0x00, 0x00, 0x00, 0x00}
+	//video tag, sorenson h263
+	flv = append(flv, 0x09, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x12)
+	rf := CreateFlvReader()
+	if err := rf.Input(flv); !errors.Is(err, codec.ErrUnsupportedCodec) {
+		t.Errorf("FlvReader.Input() error = %v, want ErrUnsupportedCodec", err)
+	}
+	if _, err := CreateAudioTagDemuxer(FLV_SOUND_FORMAT(15)); !errors.Is(err, codec.ErrUnsupportedCodec) {
+		t.Errorf("CreateAudioTagDemuxer() error = %v, want ErrUnsupportedCodec", err)
+	}
+}
+
+func TestAVCMuxer_Write(t *testing.T) {
+	sps := []byte{0x00, 0x00, 0x00, 0x01, 0x67, 0x42, 0xC0, 0x1E, 0xDA, 0x02, 0x80, 0xBF, 0xE5, 0x84, 0x00, 0x00, 0x03, 0x00, 0x04, 0x00, 0x00, 0x03, 0x00, 0xF0, 0x3C, 0x58, 0xB9, 0x20}
+	pps := []byte{0x00, 0x00, 0x00, 0x01, 0x68, 0xCE, 0x3C, 0x80}
+	idr := []byte{0x00, 0x00, 0x00, 0x01, 0x65, 0x88, 0x84, 0x00, 0x33, 0xFF}
+	muxer := NewAVCMuxer()
+	//sps/pps单独输入时缓存到下一个视频帧
+	if tags := muxer.Write(append(append([]byte{}, sps...), pps...), 0, 0); len(tags) != 1 {
+		t.Fatalf("got %d tags, want sequence header", len(tags))
+	}
+	tags := muxer.Write(idr, 0, 0)
+	if len(tags) != 1 {
+		t.Fatalf("got %d tags", len(tags))
+	}
+	var want []byte
+	for _, nalu := range [][]byte{sps, pps, idr} {
+		want = append(append(want, 0x00, 0x00, 0x00, byte(len(nalu)-4)), nalu[4:]...)
+	}
+	if !bytes.Equal(tags[0][5:], want) || tags[0][0] != 0x17 {
+		t.Errorf("AVCMuxer.Write() = %x, want %x", tags[0][5:], want)
+	}
+}
@@ -1,6 +1,8 @@
 package flv
 
 import (
+    "fmt"
+
     "github.com/yapingcat/gomedia/go-codec"
 )
 
@@ -41,25 +43,25 @@ func CovertFlvAudioCodecId2MpegCodecId(cid FLV_SOUND_FORMAT) codec.CodecID {
     return codec.CODECID_UNRECOGNIZED
 }
 
-func CovertCodecId2FlvVideoCodecId(cid codec.CodecID) FLV_VIDEO_CODEC_ID {
+func CovertCodecId2FlvVideoCodecId(cid codec.CodecID) (FLV_VIDEO_CODEC_ID, error) {
     if cid == codec.CODECID_VIDEO_H264 {
-        return FLV_AVC
+        return FLV_AVC, nil
     } else if cid == codec.CODECID_VIDEO_H265 {
-        return FLV_HEVC
+        return FLV_HEVC, nil
     } else {
-        panic("unsupport flv video codec")
+        return 0, fmt.Errorf("flv: %w: video codec %d", codec.ErrUnsupportedCodec, cid)
     }
 }
 
-func CovertCodecId2SoundFromat(cid codec.CodecID) FLV_SOUND_FORMAT {
+func CovertCodecId2SoundFromat(cid codec.CodecID) (FLV_SOUND_FORMAT, error) {
     if cid == codec.CODECID_AUDIO_AAC {
-        return FLV_AAC
+        return FLV_AAC, nil
     } else if cid == codec.CODECID_AUDIO_G711A {
-        return FLV_G711A
+        return FLV_G711A, nil
     } else if cid == codec.CODECID_AUDIO_G711U {
-        return FLV_G711U
+        return FLV_G711U, nil
     } else {
-        panic("unsupport flv audio codec")
+        return 0, fmt.Errorf("flv: %w: audio codec %d", codec.ErrUnsupportedCodec, cid)
     }
 }
 
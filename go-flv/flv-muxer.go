@@ -1,7 +1,6 @@
 package flv
 
 import (
-    "bytes"
     "errors"
 
     "github.com/yapingcat/gomedia/go-codec"
@@ -69,18 +68,20 @@ type AVTagMuxer interface {
 }
 
 type AVCMuxer struct {
-    spsset map[uint64][]byte
-    ppsset map[uint64][]byte
-    cache  []byte
-    first  bool
+    toAvcc  *codec.AnnexBToLengthFilter
+    extract *codec.ExtractExtradataFilter
+    cache   []byte
+    first   bool
 }
 
 func NewAVCMuxer() *AVCMuxer {
+    toAvcc, _ := codec.NewAnnexBToLengthFilter(4)
+    extract, _ := codec.NewExtractExtradataFilter(codec.CODECID_VIDEO_H264)
     return &AVCMuxer{
-        spsset: make(map[uint64][]byte),
-        ppsset: make(map[uint64][]byte),
-        cache:  make([]byte, 0, 1024),
-        first:  true,
+        toAvcc:  toAvcc,
+        extract: extract,
+        cache:   make([]byte, 0, 1024),
+        first:   true,
     }
 }
 
@@ -89,56 +90,24 @@ func (muxer *AVCMuxer) Write(frames []byte, pts uint32, dts uint32) [][]byte {
     var isKey bool = false
     codec.SplitFrameWithStartCode(frames, func(nalu []byte) bool {
         naltype := codec.H264NaluType(nalu)
-        switch naltype {
-        case codec.H264_NAL_SPS:
-            spsid := codec.GetSPSIdWithStartCode(nalu)
-            s, found := muxer.spsset[spsid]
-            if !found || !bytes.Equal(s, nalu) {
-                naluCopy := make([]byte, len(nalu))
-                copy(naluCopy, nalu)
-                muxer.spsset[spsid] = naluCopy
-                muxer.cache = append(muxer.cache, codec.ConvertAnnexBToAVCC(nalu)...)
-            }
-        case codec.H264_NAL_PPS:
-            ppsid := codec.GetPPSIdWithStartCode(nalu)
-            muxer.ppsset[ppsid] = nalu
-            s, found := muxer.ppsset[ppsid]
-            if !found || !bytes.Equal(s, nalu) {
-                naluCopy := make([]byte, len(nalu))
-                copy(naluCopy, nalu)
-                muxer.ppsset[ppsid] = naluCopy
-                muxer.cache = append(muxer.cache, codec.ConvertAnnexBToAVCC(nalu)...)
-            }
-        default:
-            if naltype <= codec.H264_NAL_I_SLICE {
-                vcl = true
-                if naltype == codec.H264_NAL_I_SLICE {
-                    isKey = true
-                }
+        if naltype <= codec.H264_NAL_I_SLICE {
+            vcl = true
+            if naltype == codec.H264_NAL_I_SLICE {
+                isKey = true
             }
-            muxer.cache = append(muxer.cache, codec.ConvertAnnexBToAVCC(nalu)...)
         }
         return true
     })
+    //视频的ExtractExtradataFilter和4字节长度的AnnexBToLengthFilter不会返回错误
+    muxer.extract.Filter(frames)
+    avcc, _ := muxer.toAvcc.Filter(frames)
+    muxer.cache = append(muxer.cache, avcc...)
+
     var tags [][]byte
-    if muxer.first && len(muxer.ppsset) > 0 && len(muxer.spsset) > 0 {
-        spss := make([][]byte, len(muxer.spsset))
-        idx := 0
-        for _, sps := range muxer.spsset {
-            spss[idx] = sps
-            idx++
-        }
-        idx = 0
-        ppss := make([][]byte, len(muxer.ppsset))
-        for _, pps := range muxer.ppsset {
-            ppss[idx] = pps
-            idx++
-        }
-        extraData, _ := codec.CreateH264AVCCExtradata(spss, ppss)
+    if extraData := muxer.extract.Extradata(); muxer.first && extraData != nil {
         tags = append(tags, WriteVideoTag(extraData, true, FLV_AVC, 0, true))
         muxer.first = false
     }
-
     if vcl {
         tags = append(tags, WriteVideoTag(muxer.cache, isKey, FLV_AVC, int32(pts-dts), false))
         muxer.cache = muxer.cache[:0]
@@ -147,16 +116,20 @@ func (muxer *AVCMuxer) Write(frames []byte, pts uint32, dts uint32) [][]byte {
 }
 
 type HevcMuxer struct {
-    hvcc  *codec.HEVCRecordConfiguration
-    cache []byte
-    first bool
+    toHvcc  *codec.AnnexBToLengthFilter
+    extract *codec.ExtractExtradataFilter
+    cache   []byte
+    first   bool
 }
 
 func NewHevcMuxer() *HevcMuxer {
+    toHvcc, _ := codec.NewAnnexBToLengthFilter(4)
+    extract, _ := codec.NewExtractExtradataFilter(codec.CODECID_VIDEO_H265)
     return &HevcMuxer{
-        hvcc:  codec.NewHEVCRecordConfiguration(),
-        cache: make([]byte, 0, 1024),
-        first: true,
+        toHvcc:  toHvcc,
+        extract: extract,
+        cache:   make([]byte, 0, 1024),
+        first:   true,
     }
 }
 
@@ -165,28 +138,18 @@ func (muxer *HevcMuxer) Write(frames []byte, pts uint32, dts uint32) [][]byte {
     var isKey bool = false
     codec.SplitFrameWithStartCode(frames, func(nalu []byte) bool {
         naltype := codec.H265NaluType(nalu)
-        switch naltype {
-        case codec.H265_NAL_SPS:
-            muxer.hvcc.UpdateSPS(nalu)
-            muxer.cache = append(muxer.cache, codec.ConvertAnnexBToAVCC(nalu)...)
-        case codec.H265_NAL_PPS:
-            muxer.hvcc.UpdatePPS(nalu)
-            muxer.cache = append(muxer.cache, codec.ConvertAnnexBToAVCC(nalu)...)
-        case codec.H265_NAL_VPS:
-            muxer.hvcc.UpdateVPS(nalu)
-            muxer.cache = append(muxer.cache, codec.ConvertAnnexBToAVCC(nalu)...)
-        default:
-            if naltype >= 16 && naltype <= 21 {
-                isKey = true
-            }
-            vcl = codec.IsH265VCLNaluType(naltype)
-            muxer.cache = append(muxer.cache, codec.ConvertAnnexBToAVCC(nalu)...)
+        if naltype >= 16 && naltype <= 21 {
+            isKey = true
         }
+        vcl = vcl || codec.IsH265VCLNaluType(naltype)
         return true
     })
+    muxer.extract.Filter(frames)
+    hvcc, _ := muxer.toHvcc.Filter(frames)
+    muxer.cache = append(muxer.cache, hvcc...)
+
     var tags [][]byte
-    if muxer.first && len(muxer.hvcc.Arrays) > 0 {
-        extraData, _ := muxer.hvcc.Encode()
+    if extraData := muxer.extract.Extradata(); muxer.first && extraData != nil {
         tags = append(tags, WriteVideoTag(extraData, true, FLV_HEVC, 0, true))
         muxer.first = false
     }
@@ -87,6 +87,6 @@ func (format FLV_SOUND_FORMAT) ToMpegCodecId() codec.CodecID {
     case format == FLV_MP3:
         return codec.CODECID_AUDIO_MP3
     default:
-        panic("unsupport sound format")
+        return codec.CODECID_UNRECOGNIZED
     }
 }
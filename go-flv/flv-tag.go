@@ -1,6 +1,11 @@
 package flv
 
-import "errors"
+import (
+    "errors"
+    "fmt"
+
+    "github.com/yapingcat/gomedia/go-codec"
+)
 
 const FLVTAG_SIZE uint32 = 11
 
@@ -50,12 +55,16 @@ func (ftag FlvTag) Encode() []byte {
     return tag
 }
 
-func (ftag *FlvTag) Decode(data []byte) {
+func (ftag *FlvTag) Decode(data []byte) error {
+    if len(data) < 11 {
+        return fmt.Errorf("flv tag: %w: size < 11", codec.ErrTruncated)
+    }
     ftag.TagType = data[0] & 0x1F
     ftag.DataSize = GetUint24(data[1:])
     ftag.Timestamp = GetUint24(data[4:])
     ftag.TimestampExtended = data[7]
     ftag.StreamID = GetUint24(data[8:])
+    return nil
 }
 
 //  Video Tag
@@ -106,11 +115,16 @@ func (vtag VideoTag) Encode() (tag []byte) {
     return
 }
 
-// 外部已经确保len(data) >= 5
-func (vtag *VideoTag) Decode(data []byte) {
+func (vtag *VideoTag) Decode(data []byte) error {
+    if len(data) < 1 {
+        return fmt.Errorf("video tag: %w: size < 1", codec.ErrTruncated)
+    }
     isExHeader := data[0] & 0x80
     if isExHeader != 0 {
         // enhanced flv
+        if len(data) < 5 {
+            return fmt.Errorf("video tag: %w: ex header size < 5", codec.ErrTruncated)
+        }
         vtag.FrameType = (data[0] >> 4) & 0x07
         vtag.AVCPacketType = data[0] & 0x0F
 
@@ -120,6 +134,9 @@ func (vtag *VideoTag) Decode(data []byte) {
             vtag.CodecId = uint8(FLV_HEVC)
 
             if vtag.AVCPacketType == PacketTypeCodedFrames {
+                if len(data) < 8 {
+                    return fmt.Errorf("video tag: %w: ex header size < 8", codec.ErrTruncated)
+                }
                 vtag.CompositionTime = int32(GetUint24(data[5:]))
             }
         }
@@ -127,10 +144,14 @@ func (vtag *VideoTag) Decode(data []byte) {
         vtag.FrameType = data[0] >> 4
         vtag.CodecId = data[0] & 0x0F
         if vtag.CodecId == uint8(FLV_AVC) || vtag.CodecId == uint8(FLV_HEVC) {
+            if len(data) < 5 {
+                return fmt.Errorf("video tag: %w: size < 5", codec.ErrTruncated)
+            }
             vtag.AVCPacketType = data[1]
             vtag.CompositionTime = int32(GetUint24(data[2:]))
         }
     }
+    return nil
 }
 
 //  Audio Tag
@@ -0,0 +1,69 @@
+package flv
+
+import (
+    "bytes"
+    "testing"
+
+    "github.com/yapingcat/gomedia/go-codec"
+)
+
+// go test -run=^$ -fuzz=FuzzXXX
+// 只检查不会panic, 解析结果不做校验
+
+func fuzzFlvSeed() []byte {
+    sps := []byte{0x00, 0x00, 0x00, 0x01, 0x67, 0x42, 0xC0, 0x1E, 0xDA, 0x02, 0x80, 0xBF, 0xE5, 0x84, 0x00, 0x00, 0x03, 0x00, 0x04, 0x00, 0x00, 0x03, 0x00, 0xF0, 0x3C, 0x58, 0xB9, 0x20}
+    pps := []byte{0x00, 0x00, 0x00, 0x01, 0x68, 0xCE, 0x3C, 0x80}
+    idr := []byte{0x00, 0x00, 0x00, 0x01, 0x65, 0x88, 0x84, 0x00, 0x33, 0xFF}
+    adts := []byte{0xFF, 0xF1, 0x50, 0x80, 0x01, 0x3F, 0xFC, 0x21, 0x00}
+    var buf bytes.Buffer
+    w := CreateFlvWriter(&buf)
+    w.WriteFlvHeader()
+    w.WriteH264(append(append(sps, pps...), idr...), 0, 0)
+    w.WriteAAC(adts, 0, 0)
+    w.WriteH264(idr, 40, 40)
+    return buf.Bytes()
+}
+
+func FuzzFlvReader(f *testing.F) {
+    f.Add(fuzzFlvSeed())
+    f.Add([]byte{'F', 'L', 'V', 0x01, 0x05, 0x00, 0x00, 0x00, 0x09, 0x00, 0x00, 0x00, 0x00, 0x08, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x72, 0x00})
+    f.Add([]byte{'F', 'L', 'V', 0x01, 0x01, 0x00, 0x00, 0x00, 0x09, 0x00, 0x00, 0x00, 0x00, 0x09, 0x00, 0x00, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x91, 'h', 'v', 'c', '1', 0x00, 0x00, 0x00})
+    f.Fuzz(func(t *testing.T, data []byte) {
+        r := CreateFlvReader()
+        r.OnFrame = func(cid codec.CodecID, frame []byte, pts, dts uint32) {}
+        //分两次输入, 覆盖cache的逻辑
+        half := len(data) / 2
+        if r.Input(data[:half]) == nil {
+            r.Input(data[half:])
+        }
+    })
+}
+
+func FuzzFlvTag(f *testing.F) {
+    f.Add([]byte{0x09, 0x00, 0x00, 0x05, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x17, 0x01, 0x00, 0x00, 0x00})
+    f.Add([]byte{0x08, 0x00, 0x00, 0x02, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0xAF, 0x01})
+    f.Add([]byte{0x09, 0x00, 0x00, 0x08, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x00, 0x91, 'h', 'v', 'c', '1', 0x00, 0x00, 0x00})
+    f.Fuzz(func(t *testing.T, data []byte) {
+        var ftag FlvTag
+        if ftag.Decode(data) != nil {
+            return
+        }
+        body := data[11:]
+        var vtag VideoTag
+        vtag.Decode(body)
+        var atag AudioTag
+        atag.Decode(body)
+        for _, cid := range []FLV_VIDEO_CODEC_ID{FLV_AVC, FLV_HEVC} {
+            vd, _ := CreateFlvVideoTagHandle(cid)
+            vd.OnFrame(func(codecid codec.CodecID, frame []byte, cts int) {})
+            vd.Decode(body)
+        }
+        for _, format := range []FLV_SOUND_FORMAT{FLV_AAC, FLV_G711A} {
+            ad, _ := CreateAudioTagDemuxer(format)
+            ad.OnFrame(func(codecid codec.CodecID, frame []byte) {})
+            //先送一个sequence header
+            ad.Decode(body)
+            ad.Decode(body)
+        }
+    })
+}
@@ -3,7 +3,10 @@ package mp4
 import (
     "bytes"
     "encoding/binary"
+    "fmt"
     "io"
+
+    "github.com/yapingcat/gomedia/go-codec"
 )
 
 const (
@@ -77,6 +80,36 @@ func (box *BasicBox) Decode(r io.Reader) (int, error) {
     return nn, nil
 }
 
+func errBoxTruncated(boxtype string) error {
+    return fmt.Errorf("mp4 %s box: %w", boxtype, codec.ErrTruncated)
+}
+
+// 分块读取n个字节, 数据不够时在分配大块内存之前返回错误
+// 用于根据entry count读取的表, 损坏的entry count不会导致分配过大的内存
+func readBoxData(r io.Reader, n uint64) ([]byte, error) {
+    const chunkSize = 64 * 1024
+    if n <= chunkSize {
+        buf := make([]byte, n)
+        if _, err := io.ReadFull(r, buf); err != nil {
+            return nil, err
+        }
+        return buf, nil
+    }
+    buf := make([]byte, 0, chunkSize)
+    for uint64(len(buf)) < n {
+        m := n - uint64(len(buf))
+        if m > chunkSize {
+            m = chunkSize
+        }
+        start := len(buf)
+        buf = append(buf, make([]byte, m)...)
+        if _, err := io.ReadFull(r, buf[start:]); err != nil {
+            return nil, err
+        }
+    }
+    return buf, nil
+}
+
 func (box *BasicBox) Encode() (int, []byte) {
     nn := 8
     var buf []byte
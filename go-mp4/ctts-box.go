@@ -51,12 +51,11 @@ func (ctts *CompositionOffsetBox) Decode(r io.Reader) (offset int, err error) {
     offset = 8
     ctts.ctts = new(movctts)
     ctts.ctts.entryCount = binary.BigEndian.Uint32(entryCountBuf)
-    ctts.ctts.entrys = make([]cttsEntry, ctts.ctts.entryCount)
-
-    buf := make([]byte, ctts.ctts.entryCount*8)
-    if _, err = io.ReadFull(r, buf); err != nil {
+    buf, err := readBoxData(r, uint64(ctts.ctts.entryCount)*8)
+    if err != nil {
         return
     }
+    ctts.ctts.entrys = make([]cttsEntry, ctts.ctts.entryCount)
     idx := 0
     for i := 0; i < int(ctts.ctts.entryCount); i++ {
         ctts.ctts.entrys[i].sampleCount = binary.BigEndian.Uint32(buf[idx:])
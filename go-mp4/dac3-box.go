@@ -0,0 +1,44 @@
+package mp4
+
+import (
+    "io"
+)
+
+// ETSI TS 102 366 Annex F
+// class AC3SampleEntry() extends AudioSampleEntry ('ac-3'){
+//     AC3SpecificBox();
+// }
+// class EC3SampleEntry() extends AudioSampleEntry ('ec-3'){
+//     EC3SpecificBox();
+// }
+// AC3SpecificBox('dac3')/EC3SpecificBox('dec3') 的内容见 codec.AC3SpecificConfig/codec.EAC3SpecificConfig
+
+func makeDac3Box(extraData []byte) []byte {
+    dac3 := BasicBox{Type: [4]byte{'d', 'a', 'c', '3'}}
+    dac3.Size = 8 + uint64(len(extraData))
+    offset, boxdata := dac3.Encode()
+    copy(boxdata[offset:], extraData)
+    return boxdata
+}
+
+func makeDec3Box(extraData []byte) []byte {
+    dec3 := BasicBox{Type: [4]byte{'d', 'e', 'c', '3'}}
+    dec3.Size = 8 + uint64(len(extraData))
+    offset, boxdata := dec3.Encode()
+    copy(boxdata[offset:], extraData)
+    return boxdata
+}
+
+// dac3和dec3
+func decodeDac3Box(demuxer *MovDemuxer, size uint32) (err error) {
+    buf := make([]byte, size-BasicBoxLen)
+    if _, err = io.ReadFull(demuxer.reader, buf); err != nil {
+        return
+    }
+    track := demuxer.tracks[len(demuxer.tracks)-1]
+    if track.extra == nil {
+        track.extra = new(ac3ExtraData)
+    }
+    track.extra.load(buf)
+    return
+}
@@ -0,0 +1,57 @@
+package mp4
+
+import (
+    "io"
+
+    "github.com/yapingcat/gomedia/go-codec"
+)
+
+// https://github.com/xiph/flac/blob/master/doc/isoflac.txt
+// class FLACSampleEntry() extends AudioSampleEntry ('fLaC'){
+//     FLACSpecificBox();
+// }
+// class FLACSpecificBox extends FullBox('dfLa', version=0, 0){
+//     for (i=0; ; i++) { // to end of box
+//         FLACMetadataBlock();
+//     }
+// }
+// FLACMetadataBlock 与FLAC流中的METADATA_BLOCK相同, 第一个必须是STREAMINFO
+
+func makeDflaBox(extraData []byte) []byte {
+    if len(extraData) >= 4 && string(extraData[:4]) == string(codec.FLACStreamMarker) {
+        extraData = extraData[4:]
+    }
+    dfla := NewFullBox([4]byte{'d', 'f', 'L', 'a'}, 0)
+    dfla.Box.Size = 12 + uint64(len(extraData))
+    offset, boxdata := dfla.Encode()
+    copy(boxdata[offset:], extraData)
+    return boxdata
+}
+
+func decodeDflaBox(demuxer *MovDemuxer, size uint32) (err error) {
+    dfla := FullBox{Box: new(BasicBox)}
+    if _, err = dfla.Decode(demuxer.reader); err != nil {
+        return
+    }
+    buf := make([]byte, size-FullBoxLen)
+    if _, err = io.ReadFull(demuxer.reader, buf); err != nil {
+        return
+    }
+    blocks, _, err := codec.DecodeFLACMetadataBlocks(buf)
+    if err != nil {
+        return err
+    }
+    si, err := codec.FindFLACStreamInfo(blocks)
+    if err != nil {
+        return err
+    }
+    track := demuxer.tracks[len(demuxer.tracks)-1]
+    track.sampleRate = si.Sample_rate
+    track.chanelCount = si.Channels
+    track.sampleBits = si.Bits_per_sample
+    if track.extra == nil {
+        track.extra = new(flacExtraData)
+    }
+    track.extra.load(buf)
+    return
+}
@@ -67,14 +67,14 @@ func (elst *EditListBox) Decode(r io.Reader) (offset int, err error) {
 	}
 	entryCount := binary.BigEndian.Uint32(entryCountBuf)
 	offset += 4
-	boxsize := uint32(0)
+	boxsize := uint64(0)
 	if elst.box.Version == 0 {
-		boxsize = 12 * entryCount
+		boxsize = 12 * uint64(entryCount)
 	} else {
-		boxsize = 20 * entryCount
+		boxsize = 20 * uint64(entryCount)
 	}
-	buf := make([]byte, boxsize)
-	if _, err := io.ReadFull(r, buf); err != nil {
+	buf, err := readBoxData(r, boxsize)
+	if err != nil {
 		return 0, err
 	}
 	if elst.entrys == nil {
@@ -105,7 +105,7 @@ func (elst *EditListBox) Decode(r io.Reader) (offset int, err error) {
 
 func makeElstBox(track *mp4track) (boxdata []byte) {
 	//startCt := track.samplelist[0].pts - track.samplelist[0].dts
-	delay := track.samplelist[0].pts * 1000 / uint64(track.timescale)
+	delay := track.toMillisecond(track.samplelist[0].pts)
 	entryCount := 1
 	version := uint32(0)
 	boxSize := 12
@@ -2,6 +2,7 @@ package mp4
 
 import (
     "encoding/binary"
+    "fmt"
 
     "github.com/yapingcat/gomedia/go-codec"
 )
@@ -109,7 +110,7 @@ func makeSLDescriptor() []byte {
     return sldes
 }
 
-func decodeESDescriptor(esd []byte, track *mp4track) (vosData []byte) {
+func decodeESDescriptor(esd []byte, track *mp4track) (vosData []byte, err error) {
 	var bs *codec.BitStream
 	for len(esd) > 0 {
 		based := BaseDescriptor{}
@@ -129,7 +130,9 @@ func decodeESDescriptor(esd []byte, track *mp4track) (vosData []byte) {
 			}
 			esd = bs.RemainData()
 		case 0x04:
-			track.cid = getCodecIdByObjectType(bs.Uint8(8))
+			if track.cid, err = getCodecIdByObjectType(bs.Uint8(8)); err != nil {
+				return nil, err
+			}
 			bs.Uint8(32)
 			bs.Uint8(64)
 			esd = bs.RemainData()
@@ -142,9 +145,12 @@ func decodeESDescriptor(esd []byte, track *mp4track) (vosData []byte) {
 			bs.SkipBits(int(based.sizeOfInstance) * 8)
 			esd = bs.RemainData()
 		}
+		if bs.Err() != nil {
+			return nil, fmt.Errorf("mp4 esds: %w", bs.Err())
+		}
 	}
 	if track.cid == MP4_CODEC_AAC && len(vosData) == 0 {
-		panic("no vosdata")
+		return nil, fmt.Errorf("mp4 esds: %w: no decoder specific info", codec.ErrInvalidData)
 	}
 	if track.cid == MP4_CODEC_AAC {
 		track.extra = new(aacExtraData)
@@ -38,6 +38,15 @@ func (fws *fmp4WriterSeeker) Write(p []byte) (n int, err error) {
 	return len(p), nil
 }
 
+func (fws *fmp4WriterSeeker) Read(p []byte) (n int, err error) {
+	if fws.offset >= len(fws.buffer) {
+		return 0, io.EOF
+	}
+	n = copy(p, fws.buffer[fws.offset:])
+	fws.offset += n
+	return n, nil
+}
+
 func (fws *fmp4WriterSeeker) Seek(offset int64, whence int) (int64, error) {
 	if whence == io.SeekCurrent {
 		if fws.offset+int(offset) > len(fws.buffer) {
@@ -2,6 +2,9 @@ package mp4
 import "io"
 
 func decodeFrmaBox(demuxer *MovDemuxer, size uint32) (err error) {
+	if size < BasicBoxLen+4 {
+		return errBoxTruncated("frma")
+	}
 	buf := make([]byte, size-BasicBoxLen)
 	if _, err = io.ReadFull(demuxer.reader, buf); err != nil {
 		return
@@ -46,6 +46,9 @@ func (ftyp *FileTypeBox) Size() uint64 {
 }
 
 func (ftyp *FileTypeBox) decode(r io.Reader, size uint32) (int, error) {
+	if size < BasicBoxLen+8 {
+		return 0, errBoxTruncated("ftyp")
+	}
 	buf := make([]byte, size-BasicBoxLen)
 	if n, err := io.ReadFull(r, buf); err != nil {
 		return n, err
@@ -53,7 +56,7 @@ func (ftyp *FileTypeBox) decode(r io.Reader, size uint32) (int, error) {
 	ftyp.Major_brand = binary.LittleEndian.Uint32(buf[0:])
 	ftyp.Minor_version = binary.BigEndian.Uint32(buf[4:])
 	n := 8
-	for ; BasicBoxLen+n < int(size); n += 4 {
+	for ; n+4 <= len(buf); n += 4 {
 		ftyp.Compatible_brands = append(ftyp.Compatible_brands, binary.LittleEndian.Uint32(buf[n:]))
 	}
 	return n, nil
@@ -0,0 +1,30 @@
+package mp4
+
+import (
+	"bytes"
+	"testing"
+)
+
+// go test -run=^$ -fuzz=FuzzXXX
+// 只检查不会panic, 解析结果不做校验
+
+func FuzzMovDemuxer(f *testing.F) {
+	f.Add(makeTestMp4(f, testMp4{frames: 3}))
+	f.Add(makeTestMp4(f, testMp4{frames: 3, options: []MuxerOption{WithMp4Flag(MP4_FLAG_FRAGMENT)}}))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		demuxer := CreateMp4Demuxer(bytes.NewReader(data))
+		infos, err := demuxer.ReadHead()
+		if err != nil {
+			return
+		}
+		for _, info := range infos {
+			demuxer.GetSyncTable(uint32(info.TrackId))
+		}
+		for i := 0; i < 100; i++ {
+			if _, err = demuxer.ReadPacket(); err != nil {
+				break
+			}
+		}
+		demuxer.SeekTime(0)
+	})
+}
@@ -59,6 +59,9 @@ func (hdlr *HandlerBox) Decode(r io.Reader, size uint64) (offset int, err error)
     if _, err = hdlr.Box.Decode(r); err != nil {
         return 0, err
     }
+    if size < FullBoxLen+4 {
+        return 0, errBoxTruncated("hdlr")
+    }
     buf := make([]byte, size-FullBoxLen)
     if _, err = io.ReadFull(r, buf); err != nil {
         return 0, err
@@ -92,7 +95,8 @@ func getHandlerType(cid MP4_CODEC_TYPE) HandlerType {
     case MP4_CODEC_H264, MP4_CODEC_H265:
         return vide
     case MP4_CODEC_AAC, MP4_CODEC_G711A, MP4_CODEC_G711U,
-        MP4_CODEC_MP2, MP4_CODEC_MP3, MP4_CODEC_OPUS:
+        MP4_CODEC_MP2, MP4_CODEC_MP3, MP4_CODEC_OPUS,
+        MP4_CODEC_AC3, MP4_CODEC_EAC3, MP4_CODEC_FLAC:
         return soun
     default:
         panic("unsupport codec id")
@@ -6,7 +6,8 @@ func makeMinfBox(track *mp4track) []byte {
     case MP4_CODEC_H264, MP4_CODEC_H265:
         mhdbox = makeVmhdBox()
     case MP4_CODEC_G711A, MP4_CODEC_G711U, MP4_CODEC_AAC,
-        MP4_CODEC_MP2, MP4_CODEC_MP3, MP4_CODEC_OPUS:
+        MP4_CODEC_MP2, MP4_CODEC_MP3, MP4_CODEC_OPUS,
+        MP4_CODEC_AC3, MP4_CODEC_EAC3, MP4_CODEC_FLAC:
         mhdbox = makeSmhdBox()
     default:
         panic("unsupport codec id")
@@ -1,6 +1,8 @@
 package mp4
 
 import (
+    "fmt"
+
     "github.com/yapingcat/gomedia/go-codec"
 )
 
@@ -16,6 +18,9 @@ const (
     MP4_CODEC_MP2
     MP4_CODEC_MP3
     MP4_CODEC_OPUS
+    MP4_CODEC_AC3
+    MP4_CODEC_EAC3
+    MP4_CODEC_FLAC
 )
 
 func isVideo(cid MP4_CODEC_TYPE) bool {
@@ -24,7 +29,8 @@ func isVideo(cid MP4_CODEC_TYPE) bool {
 
 func isAudio(cid MP4_CODEC_TYPE) bool {
     return cid == MP4_CODEC_AAC || cid == MP4_CODEC_G711A || cid == MP4_CODEC_G711U ||
-        cid == MP4_CODEC_MP2 || cid == MP4_CODEC_MP3 || cid == MP4_CODEC_OPUS
+        cid == MP4_CODEC_MP2 || cid == MP4_CODEC_MP3 || cid == MP4_CODEC_OPUS ||
+        cid == MP4_CODEC_AC3 || cid == MP4_CODEC_EAC3 || cid == MP4_CODEC_FLAC
 }
 
 func getCodecNameWithCodecId(cid MP4_CODEC_TYPE) [4]byte {
@@ -41,6 +47,12 @@ func getCodecNameWithCodecId(cid MP4_CODEC_TYPE) [4]byte {
         return [4]byte{'u', 'l', 'a', 'w'}
     case MP4_CODEC_OPUS:
         return [4]byte{'o', 'p', 'u', 's'}
+    case MP4_CODEC_AC3:
+        return [4]byte{'a', 'c', '-', '3'}
+    case MP4_CODEC_EAC3:
+        return [4]byte{'e', 'c', '-', '3'}
+    case MP4_CODEC_FLAC:
+        return [4]byte{'f', 'L', 'a', 'C'}
     default:
         panic("unsupport codec id")
     }
@@ -63,64 +75,34 @@ func getBojecttypeWithCodecId(cid MP4_CODEC_TYPE) uint8 {
         return 0x6b
     case MP4_CODEC_MP3:
         return 0x69
+    case MP4_CODEC_AC3:
+        return 0xa5
+    case MP4_CODEC_EAC3:
+        return 0xa6
     default:
         panic("unsupport codec id")
     }
 }
 
-func getCodecIdByObjectType(objType uint8) MP4_CODEC_TYPE {
+func getCodecIdByObjectType(objType uint8) (MP4_CODEC_TYPE, error) {
     switch objType {
     case 0x21:
-        return MP4_CODEC_H264
+        return MP4_CODEC_H264, nil
     case 0x23:
-        return MP4_CODEC_H265
+        return MP4_CODEC_H265, nil
     case 0x40:
-        return MP4_CODEC_AAC
+        return MP4_CODEC_AAC, nil
     case 0xfd:
-        return MP4_CODEC_G711A
+        return MP4_CODEC_G711A, nil
     case 0xfe:
-        return MP4_CODEC_G711U
+        return MP4_CODEC_G711U, nil
     case 0x6b, 0x69:
-        return MP4_CODEC_MP3
+        return MP4_CODEC_MP3, nil
+    case 0xa5:
+        return MP4_CODEC_AC3, nil
+    case 0xa6:
+        return MP4_CODEC_EAC3, nil
     default:
-        panic("unsupport object type")
-    }
-}
-
-func isH264NewAccessUnit(nalu []byte) bool {
-    nalu_type := codec.H264NaluType(nalu)
-    switch nalu_type {
-    case codec.H264_NAL_AUD, codec.H264_NAL_SPS,
-        codec.H264_NAL_PPS, codec.H264_NAL_SEI:
-        return true
-    case codec.H264_NAL_I_SLICE, codec.H264_NAL_P_SLICE,
-        codec.H264_NAL_SLICE_A, codec.H264_NAL_SLICE_B, codec.H264_NAL_SLICE_C:
-        firstMbInSlice := codec.GetH264FirstMbInSlice(nalu)
-        if firstMbInSlice == 0 {
-            return true
-        }
-    }
-    return false
-}
-
-func isH265NewAccessUnit(nalu []byte) bool {
-    nalu_type := codec.H265NaluType(nalu)
-    switch nalu_type {
-    case codec.H265_NAL_AUD, codec.H265_NAL_SPS,
-        codec.H265_NAL_PPS, codec.H265_NAL_SEI, codec.H265_NAL_VPS:
-        return true
-    case codec.H265_NAL_Slice_TRAIL_N, codec.H265_NAL_LICE_TRAIL_R,
-        codec.H265_NAL_SLICE_TSA_N, codec.H265_NAL_SLICE_TSA_R,
-        codec.H265_NAL_SLICE_STSA_N, codec.H265_NAL_SLICE_STSA_R,
-        codec.H265_NAL_SLICE_RADL_N, codec.H265_NAL_SLICE_RADL_R,
-        codec.H265_NAL_SLICE_RASL_N, codec.H265_NAL_SLICE_RASL_R,
-        codec.H265_NAL_SLICE_BLA_W_LP, codec.H265_NAL_SLICE_BLA_W_RADL,
-        codec.H265_NAL_SLICE_BLA_N_LP, codec.H265_NAL_SLICE_IDR_W_RADL,
-        codec.H265_NAL_SLICE_IDR_N_LP, codec.H265_NAL_SLICE_CRA:
-        firstMbInSlice := codec.GetH265FirstMbInSlice(nalu)
-        if firstMbInSlice == 0 {
-            return true
-        }
+        return 0, fmt.Errorf("mp4 object type 0x%02x: %w", objType, codec.ErrUnsupportedCodec)
     }
-    return false
 }
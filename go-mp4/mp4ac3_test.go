@@ -0,0 +1,60 @@
+package mp4
+
+import (
+	"bytes"
+	"io"
+	"testing"
+)
+
+// 48000Hz, 64kbps, 2/0 AC-3 syncframe(256 bytes)
+func makeTestAC3Frame(fill byte) []byte {
+	frame := bytes.Repeat([]byte{fill}, 256)
+	copy(frame, []byte{0x0B, 0x77, 0x00, 0x00, 0x08, 0x40, 0x40})
+	return frame
+}
+
+func TestMuxAC3(t *testing.T) {
+	ws := newFmp4WriterSeeker(1024 * 64)
+	muxer, err := CreateMp4Muxer(ws)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tid := muxer.AddAudioTrack(MP4_CODEC_AC3)
+	var frames [][]byte
+	for i := 0; i < 10; i++ {
+		frames = append(frames, makeTestAC3Frame(byte(i)))
+	}
+	// 每次写入两帧
+	for i := 0; i < len(frames); i += 2 {
+		pts := uint64(i * 32)
+		if err = muxer.Write(tid, append(append([]byte{}, frames[i]...), frames[i+1]...), pts, pts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = muxer.WriteTrailer(); err != nil {
+		t.Fatal(err)
+	}
+
+	demuxer := CreateMp4Demuxer(bytes.NewReader(ws.buffer))
+	infos, err := demuxer.ReadHead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].Cid != MP4_CODEC_AC3 || infos[0].SampleRate != 48000 || infos[0].ChannelCount != 2 {
+		t.Fatalf("ReadHead() = %+v", infos)
+	}
+	for i := 0; ; i++ {
+		pkg, err := demuxer.ReadPacket()
+		if err == io.EOF {
+			if i != len(frames) {
+				t.Errorf("got %d packets, want %d", i, len(frames))
+			}
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if pkg.Cid != MP4_CODEC_AC3 || !bytes.Equal(pkg.Data, frames[i]) || pkg.Pts != uint64(i*32) {
+			t.Errorf("packet %d cid %d pts %d", i, pkg.Cid, pkg.Pts)
+		}
+	}
+}
@@ -0,0 +1,105 @@
+package mp4
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/yapingcat/gomedia/go-codec"
+)
+
+var bsfTestSps = []byte{0x67, 0x64, 0x00, 0x0A, 0xAC, 0x72, 0x84, 0x44,
+	0x26, 0x84, 0x00, 0x00, 0x03, 0x00, 0x04, 0x00, 0x00, 0x03, 0x00, 0xCA, 0x3C, 0x48, 0x96, 0x11, 0x80}
+var bsfTestPps = []byte{0x68, 0xE8, 0x43, 0x8F, 0x13, 0x21, 0x30}
+
+func annexBNalus(nalus ...[]byte) []byte {
+	var out []byte
+	for _, nalu := range nalus {
+		out = append(append(out, 0x00, 0x00, 0x00, 0x01), nalu...)
+	}
+	return out
+}
+
+// 第二个IDR没有携带sps/pps, demux时需要从avcC中插入
+func TestDemuxInsertParameterSets(t *testing.T) {
+	idr := []byte{0x65, 0x88, 0x84, 0x00, 0x10}
+	pslice := []byte{0x41, 0x9A, 0x02, 0x03}
+	frames := [][]byte{
+		annexBNalus(bsfTestSps, bsfTestPps, idr),
+		annexBNalus(pslice),
+		annexBNalus(idr),
+	}
+	want := [][]byte{annexBNalus(bsfTestSps, bsfTestPps, idr), annexBNalus(pslice), annexBNalus(bsfTestSps, bsfTestPps, idr)}
+	aac := []byte{0x21, 0x00, 0x49, 0x90, 0x02, 0x19}
+	adts, _ := codec.ConvertASCToADTS([]byte{0x12, 0x10}, len(aac)+7)
+
+	ws := newFmp4WriterSeeker(1024 * 64)
+	muxer, err := CreateMp4Muxer(ws)
+	if err != nil {
+		t.Fatal(err)
+	}
+	vid := muxer.AddVideoTrack(MP4_CODEC_H264)
+	aid := muxer.AddAudioTrack(MP4_CODEC_AAC)
+	for i, frame := range frames {
+		pts := uint64(i * 40)
+		if err = muxer.Write(vid, frame, pts, pts); err != nil {
+			t.Fatal(err)
+		}
+		if err = muxer.Write(aid, append(adts.Encode(), aac...), pts, pts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = muxer.WriteTrailer(); err != nil {
+		t.Fatal(err)
+	}
+
+	demuxer := CreateMp4Demuxer(bytes.NewReader(ws.buffer))
+	if _, err = demuxer.ReadHead(); err != nil {
+		t.Fatal(err)
+	}
+	var videos [][]byte
+	audios := 0
+	for {
+		pkg, err := demuxer.ReadPacket()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if pkg.Cid == MP4_CODEC_H264 {
+			videos = append(videos, pkg.Data)
+		} else if pkg.Cid == MP4_CODEC_AAC {
+			audios++
+			if len(pkg.Data) != len(aac)+7 || pkg.Data[0] != 0xFF || !bytes.Equal(pkg.Data[7:], aac) {
+				t.Errorf("aac packet = %x", pkg.Data)
+			}
+		}
+	}
+	if len(videos) != len(want) || audios != len(frames) {
+		t.Fatalf("got %d video %d audio packets", len(videos), audios)
+	}
+	for i := range want {
+		if !bytes.Equal(videos[i], want[i]) {
+			t.Errorf("video packet %d = %x, want %x", i, videos[i], want[i])
+		}
+	}
+}
+
+func TestNewDemuxBSF(t *testing.T) {
+	//参数集在码流中时没有extradata
+	if _, err := newDemuxBSF(&mp4track{extra: new(h264ExtraData)}); err != nil {
+		t.Errorf("avc3 track: %v", err)
+	}
+	if _, err := newDemuxBSF(&mp4track{extra: newh265ExtraData()}); err != nil {
+		t.Errorf("hev1 track: %v", err)
+	}
+	//只有sps没有pps
+	if _, err := newDemuxBSF(&mp4track{extra: &h264ExtraData{spss: [][]byte{bsfTestSps}}}); err == nil {
+		t.Error("avcc without pps should fail")
+	}
+	hevc := newh265ExtraData()
+	hevc.hvccExtra.Arrays = append(hevc.hvccExtra.Arrays, &codec.HVCCNALUnitArray{})
+	if _, err := newDemuxBSF(&mp4track{extra: hevc}); err == nil {
+		t.Error("hvcc without vps/sps/pps should fail")
+	}
+}
@@ -0,0 +1,618 @@
+package mp4
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+
+    "github.com/yapingcat/gomedia/go-codec"
+    "github.com/yapingcat/gomedia/go-timebase"
+)
+
+// fmp4和普通mp4互相转换时直接在box层面处理, 不经过ReadPacket/Write, sample数据原样拷贝
+// 转换过程中保留: stsd(包括加密信息sinf), edts, ctts, sample flags(stss/sdtp), pssh,
+// CENC的sample auxiliary information(senc/saiz/saio), 引用moov中sgpd的sbgp
+
+// 不同timescale之间的时间转换, 比如media timescale和movie timescale
+func rescaleTimescale(v uint64, from, to uint32) uint64 {
+    return timebase.RescaleUint64(v, timebase.ClockRate(from), timebase.ClockRate(to))
+}
+
+type convSample struct {
+    offset   uint64
+    size     uint32
+    dts      uint64
+    duration uint32
+    cto      int32
+    flags    uint32 //trun中的sample_flags格式
+    descIdx  uint32
+    aux      []byte //CENC的IV和subsample信息
+}
+
+func (sample *convSample) isSync() bool {
+    return sample.flags&MOV_FRAG_SAMPLE_FLAG_IS_NON_SYNC == 0
+}
+
+// sbgp, index是每个sample的group_description_index, 0表示不属于任何group
+type convSampleGroup struct {
+    groupingType uint32
+    hasParameter bool
+    parameter    uint32
+    index        []uint32
+}
+
+type convTrack struct {
+    trackId   uint32
+    timescale uint32
+    handler   [4]byte
+    trak      []byte
+    samples   []convSample
+    groups    []*convSampleGroup
+    ivSize    int //tenc中的default_Per_Sample_IV_Size, -1表示没有加密信息
+    trex      *TrackExtendsBox
+    nextDts   uint64
+    edits     []elstEntry //不为nil时替换trak中的edts
+}
+
+func (track *convTrack) group(groupingType uint32) *convSampleGroup {
+    for _, g := range track.groups {
+        if g.groupingType == groupingType {
+            return g
+        }
+    }
+    g := &convSampleGroup{groupingType: groupingType}
+    track.groups = append(track.groups, g)
+    return g
+}
+
+// sample数增加之后补齐每个group的index
+func (track *convTrack) padGroups() {
+    for _, g := range track.groups {
+        for len(g.index) < len(track.samples) {
+            g.index = append(g.index, 0)
+        }
+    }
+}
+
+func (track *convTrack) mediaDuration() uint64 {
+    if len(track.samples) == 0 {
+        return 0
+    }
+    last := track.samples[len(track.samples)-1]
+    return last.dts + uint64(last.duration) - track.samples[0].dts
+}
+
+type convBox struct {
+    boxtype [4]byte
+    data    []byte //包含box头
+    hdrLen  int
+}
+
+func (box *convBox) payload() []byte {
+    return box.data[box.hdrLen:]
+}
+
+func (box *convBox) is(boxtype string) bool {
+    return string(box.boxtype[:]) == boxtype
+}
+
+// 解析data中同一层级的所有box
+func splitBoxes(data []byte) ([]convBox, error) {
+    var boxes []convBox
+    for len(data) > 0 {
+        basebox := BasicBox{}
+        hdrLen, err := basebox.Decode(bytes.NewReader(data))
+        if err != nil {
+            return nil, errBoxTruncated("box")
+        }
+        size := basebox.Size
+        if size == 0 {
+            size = uint64(len(data))
+        }
+        if size < uint64(hdrLen) || size > uint64(len(data)) {
+            return nil, errBoxTruncated(string(basebox.Type[:]))
+        }
+        boxes = append(boxes, convBox{boxtype: basebox.Type, data: data[:size], hdrLen: hdrLen})
+        data = data[size:]
+    }
+    return boxes, nil
+}
+
+func findBox(boxes []convBox, boxtype string) *convBox {
+    for i := range boxes {
+        if boxes[i].is(boxtype) {
+            return &boxes[i]
+        }
+    }
+    return nil
+}
+
+// 按照路径查找子box, 比如findBoxPath(trak, "mdia", "minf", "stbl")
+func findBoxPath(data []byte, path ...string) (*convBox, error) {
+    var box *convBox
+    for _, name := range path {
+        boxes, err := splitBoxes(data)
+        if err != nil {
+            return nil, err
+        }
+        if box = findBox(boxes, name); box == nil {
+            return nil, nil
+        }
+        data = box.payload()
+    }
+    return box, nil
+}
+
+func makeContainerBox(boxtype string, children ...[]byte) []byte {
+    size := 8
+    for _, child := range children {
+        size += len(child)
+    }
+    box := BasicBox{Size: uint64(size)}
+    copy(box.Type[:], boxtype)
+    _, buf := box.Encode()
+    offset := 8
+    for _, child := range children {
+        copy(buf[offset:], child)
+        offset += len(child)
+    }
+    return buf
+}
+
+// 重写容器box, replace返回nil表示删除这个box, 返回原数据表示保留
+func rewriteContainer(box *convBox, replace func(child *convBox) ([]byte, error)) ([]byte, error) {
+    children, err := splitBoxes(box.payload())
+    if err != nil {
+        return nil, err
+    }
+    out := make([][]byte, 0, len(children))
+    for i := range children {
+        data, err := replace(&children[i])
+        if err != nil {
+            return nil, err
+        }
+        out = append(out, data)
+    }
+    return makeContainerBox(string(box.boxtype[:]), out...), nil
+}
+
+// mvhd/mdhd/tkhd中duration的位置, 返回时间单位和duration字段的偏移
+func headerDurationOffset(box *convBox) (timescaleOffset int, durationOffset int, err error) {
+    payload := box.payload()
+    if len(payload) < 4 {
+        return 0, 0, errBoxTruncated(string(box.boxtype[:]))
+    }
+    version := payload[0]
+    switch {
+    case box.is("tkhd") && version == 1:
+        timescaleOffset, durationOffset = -1, 28
+    case box.is("tkhd"):
+        timescaleOffset, durationOffset = -1, 20
+    case version == 1:
+        timescaleOffset, durationOffset = 20, 24
+    default:
+        timescaleOffset, durationOffset = 12, 16
+    }
+    need := durationOffset + 4
+    if version == 1 {
+        need = durationOffset + 8
+    }
+    if len(payload) < need {
+        return 0, 0, errBoxTruncated(string(box.boxtype[:]))
+    }
+    return
+}
+
+func headerTimescale(box *convBox) (uint32, error) {
+    tsOffset, _, err := headerDurationOffset(box)
+    if err != nil {
+        return 0, err
+    }
+    return binary.BigEndian.Uint32(box.payload()[tsOffset:]), nil
+}
+
+// 修改mvhd/mdhd/tkhd的duration, version 0放不下时填0xFFFFFFFF
+func patchHeaderDuration(box *convBox, duration uint64) ([]byte, error) {
+    _, durOffset, err := headerDurationOffset(box)
+    if err != nil {
+        return nil, err
+    }
+    data := append([]byte{}, box.data...)
+    payload := data[box.hdrLen:]
+    if payload[0] == 1 {
+        binary.BigEndian.PutUint64(payload[durOffset:], duration)
+    } else if duration > 0xFFFFFFFF {
+        binary.BigEndian.PutUint32(payload[durOffset:], 0xFFFFFFFF)
+    } else {
+        binary.BigEndian.PutUint32(payload[durOffset:], uint32(duration))
+    }
+    return data, nil
+}
+
+// 解析moov中的trak, 获取track id, 时间单位, handler和加密的IV长度
+func parseConvTracks(moov []byte) ([]*convTrack, error) {
+    boxes, err := splitBoxes(moov)
+    if err != nil {
+        return nil, err
+    }
+    var tracks []*convTrack
+    for i := range boxes {
+        if !boxes[i].is("trak") {
+            continue
+        }
+        track := &convTrack{trak: boxes[i].data, ivSize: -1}
+        trak := boxes[i].payload()
+        tkhd, err := findBoxPath(trak, "tkhd")
+        if err != nil {
+            return nil, err
+        }
+        mdhd, err := findBoxPath(trak, "mdia", "mdhd")
+        if err != nil {
+            return nil, err
+        }
+        hdlr, err := findBoxPath(trak, "mdia", "hdlr")
+        if err != nil {
+            return nil, err
+        }
+        if tkhd == nil || mdhd == nil {
+            return nil, fmt.Errorf("mp4 trak box: %w: missing tkhd or mdhd", codec.ErrInvalidData)
+        }
+        payload := tkhd.payload()
+        idOffset := 12
+        if len(payload) > 0 && payload[0] == 1 {
+            idOffset = 20
+        }
+        if len(payload) < idOffset+4 {
+            return nil, errBoxTruncated("tkhd")
+        }
+        track.trackId = binary.BigEndian.Uint32(payload[idOffset:])
+        if track.timescale, err = headerTimescale(mdhd); err != nil {
+            return nil, err
+        }
+        if track.timescale == 0 {
+            return nil, fmt.Errorf("mp4 mdhd box: %w: timescale is 0", codec.ErrInvalidData)
+        }
+        if hdlr != nil && len(hdlr.payload()) >= 12 {
+            copy(track.handler[:], hdlr.payload()[8:12])
+        }
+        if track.ivSize, err = findTencIVSize(trak); err != nil {
+            return nil, err
+        }
+        tracks = append(tracks, track)
+    }
+    if len(tracks) == 0 {
+        return nil, errors.New("mp4: no track found")
+    }
+    return tracks, nil
+}
+
+// stsd中加密的sample entry: encv/enca/sinf/schi/tenc
+func findTencIVSize(trak []byte) (int, error) {
+    stsd, err := findBoxPath(trak, "mdia", "minf", "stbl", "stsd")
+    if err != nil || stsd == nil {
+        return -1, err
+    }
+    if len(stsd.payload()) < 8 {
+        return -1, errBoxTruncated("stsd")
+    }
+    entries, err := splitBoxes(stsd.payload()[8:])
+    if err != nil {
+        return -1, err
+    }
+    for _, entry := range entries {
+        //VisualSampleEntry和AudioSampleEntry固定部分的长度
+        skip := 0
+        if entry.is("encv") {
+            skip = 78
+        } else if entry.is("enca") {
+            skip = 28
+        } else {
+            continue
+        }
+        if len(entry.payload()) < skip {
+            return -1, errBoxTruncated(string(entry.boxtype[:]))
+        }
+        tenc, err := findBoxPath(entry.payload()[skip:], "sinf", "schi", "tenc")
+        if err != nil || tenc == nil {
+            return -1, err
+        }
+        if len(tenc.payload()) < 24 {
+            return -1, errBoxTruncated("tenc")
+        }
+        return int(tenc.payload()[7]), nil
+    }
+    return -1, nil
+}
+
+func convFullBoxFlags(payload []byte) uint32 {
+    return binary.BigEndian.Uint32(payload) & 0x00FFFFFF
+}
+
+// senc中每个sample的数据: IV和subsample, 原样保存
+func parseSencAux(senc *convBox, ivSize int) ([][]byte, error) {
+    payload := senc.payload()
+    if len(payload) < 8 {
+        return nil, errBoxTruncated("senc")
+    }
+    if ivSize < 0 {
+        return nil, fmt.Errorf("mp4 senc box: %w: tenc not found", codec.ErrInvalidData)
+    }
+    flags := convFullBoxFlags(payload)
+    count := binary.BigEndian.Uint32(payload[4:])
+    data := payload[8:]
+    if uint64(count)*uint64(ivSize) > uint64(len(data)) {
+        return nil, errBoxTruncated("senc")
+    }
+    aux := make([][]byte, 0, count)
+    for i := uint32(0); i < count; i++ {
+        n := ivSize
+        if flags&UseSubsampleEncryption != 0 {
+            if len(data) < n+2 {
+                return nil, errBoxTruncated("senc")
+            }
+            n += 2 + 6*int(binary.BigEndian.Uint16(data[n:]))
+        }
+        if len(data) < n {
+            return nil, errBoxTruncated("senc")
+        }
+        aux = append(aux, append([]byte{}, data[:n]...))
+        data = data[n:]
+    }
+    return aux, nil
+}
+
+// saiz中每个sample的auxiliary information大小
+func parseSaizSizes(saiz *convBox) ([]uint32, error) {
+    box := SaizBox{Box: new(FullBox)}
+    if err := box.Decode(bytes.NewReader(saiz.payload()), uint32(len(saiz.payload())+8)); err != nil {
+        return nil, err
+    }
+    sizes := make([]uint32, box.SampleCount)
+    for i := range sizes {
+        if box.DefaultSampleInfoSize != 0 {
+            sizes[i] = uint32(box.DefaultSampleInfoSize)
+        } else {
+            sizes[i] = uint32(box.SampleInfo[i])
+        }
+    }
+    return sizes, nil
+}
+
+func parseSaioOffsets(saio *convBox) ([]uint64, error) {
+    payload := saio.payload()
+    if len(payload) < 8 {
+        return nil, errBoxTruncated("saio")
+    }
+    n := 4
+    if convFullBoxFlags(payload)&0x01 != 0 {
+        n += 8
+    }
+    if len(payload) < n+4 {
+        return nil, errBoxTruncated("saio")
+    }
+    count := binary.BigEndian.Uint32(payload[n:])
+    n += 4
+    entrySize := 4
+    if payload[0] == 1 {
+        entrySize = 8
+    }
+    if uint64(count)*uint64(entrySize) > uint64(len(payload)-n) {
+        return nil, errBoxTruncated("saio")
+    }
+    offsets := make([]uint64, count)
+    for i := range offsets {
+        if entrySize == 8 {
+            offsets[i] = binary.BigEndian.Uint64(payload[n:])
+        } else {
+            offsets[i] = uint64(binary.BigEndian.Uint32(payload[n:]))
+        }
+        n += entrySize
+    }
+    return offsets, nil
+}
+
+// 根据saiz/saio读取auxiliary information, runs是每个saio entry对应的sample个数
+func readAuxInfo(r io.ReadSeeker, sizes []uint32, offsets []uint64, base uint64, runs []int) ([][]byte, error) {
+    if len(offsets) == 1 {
+        runs = []int{len(sizes)}
+    } else if len(offsets) != len(runs) {
+        return nil, fmt.Errorf("mp4 saio box: %w: entry count %d", codec.ErrUnsupportedCodec, len(offsets))
+    }
+    aux := make([][]byte, 0, len(sizes))
+    idx := 0
+    for i, run := range runs {
+        if idx+run > len(sizes) {
+            return nil, fmt.Errorf("mp4 saiz box: %w: sample count %d", codec.ErrInvalidData, len(sizes))
+        }
+        total := uint64(0)
+        for _, size := range sizes[idx : idx+run] {
+            total += uint64(size)
+        }
+        if _, err := r.Seek(int64(base+offsets[i]), io.SeekStart); err != nil {
+            return nil, err
+        }
+        data, err := readBoxData(r, total)
+        if err != nil {
+            return nil, err
+        }
+        for _, size := range sizes[idx : idx+run] {
+            aux = append(aux, data[:size])
+            data = data[size:]
+        }
+        idx += run
+    }
+    return aux, nil
+}
+
+// sbgp version 0/1, 返回grouping_type, parameter和每个entry
+func parseSbgp(sbgp *convBox) (*convSampleGroup, [][2]uint32, error) {
+    payload := sbgp.payload()
+    if len(payload) < 12 {
+        return nil, nil, errBoxTruncated("sbgp")
+    }
+    g := &convSampleGroup{groupingType: binary.BigEndian.Uint32(payload[4:])}
+    n := 8
+    if payload[0] == 1 {
+        g.hasParameter = true
+        g.parameter = binary.BigEndian.Uint32(payload[n:])
+        n += 4
+    }
+    if len(payload) < n+4 {
+        return nil, nil, errBoxTruncated("sbgp")
+    }
+    count := binary.BigEndian.Uint32(payload[n:])
+    n += 4
+    if uint64(count)*8 > uint64(len(payload)-n) {
+        return nil, nil, errBoxTruncated("sbgp")
+    }
+    entries := make([][2]uint32, count)
+    for i := range entries {
+        entries[i][0] = binary.BigEndian.Uint32(payload[n:])
+        entries[i][1] = binary.BigEndian.Uint32(payload[n+4:])
+        n += 8
+    }
+    return g, entries, nil
+}
+
+// 把sbgp的entry展开到[start, start+count)范围的sample
+func (track *convTrack) applySbgp(sbgp *convBox, start int, count int) error {
+    parsed, entries, err := parseSbgp(sbgp)
+    if err != nil {
+        return err
+    }
+    g := track.group(parsed.groupingType)
+    g.hasParameter, g.parameter = parsed.hasParameter, parsed.parameter
+    track.padGroups()
+    idx := start
+    for _, entry := range entries {
+        //fragment内的sgpd(index从0x10001开始)没办法合并到moov中
+        if entry[1] > 0x10000 {
+            return fmt.Errorf("mp4 sbgp box: %w: fragment local sample group description", codec.ErrUnsupportedCodec)
+        }
+        for j := uint32(0); j < entry[0] && idx < start+count; j++ {
+            g.index[idx] = entry[1]
+            idx++
+        }
+    }
+    return nil
+}
+
+func makeSbgpBox(g *convSampleGroup, index []uint32) []byte {
+    var entries [][2]uint32
+    for _, idx := range index {
+        if len(entries) > 0 && entries[len(entries)-1][1] == idx {
+            entries[len(entries)-1][0]++
+        } else {
+            entries = append(entries, [2]uint32{1, idx})
+        }
+    }
+    box := NewFullBox([4]byte{'s', 'b', 'g', 'p'}, 0)
+    size := 12 + 8 + 8*len(entries)
+    if g.hasParameter {
+        box.Version = 1
+        size += 4
+    }
+    box.Box.Size = uint64(size)
+    n, buf := box.Encode()
+    binary.BigEndian.PutUint32(buf[n:], g.groupingType)
+    n += 4
+    if g.hasParameter {
+        binary.BigEndian.PutUint32(buf[n:], g.parameter)
+        n += 4
+    }
+    binary.BigEndian.PutUint32(buf[n:], uint32(len(entries)))
+    n += 4
+    for _, entry := range entries {
+        binary.BigEndian.PutUint32(buf[n:], entry[0])
+        binary.BigEndian.PutUint32(buf[n+4:], entry[1])
+        n += 8
+    }
+    return buf
+}
+
+// saiz: 所有sample大小相同时只写default_sample_info_size
+func makeSaizBox(aux [][]byte) ([]byte, error) {
+    sameSize := true
+    for _, a := range aux {
+        if len(a) > 0xFF {
+            return nil, fmt.Errorf("mp4 saiz box: %w: aux info size %d", codec.ErrUnsupportedCodec, len(a))
+        }
+        if len(a) != len(aux[0]) {
+            sameSize = false
+        }
+    }
+    box := NewFullBox([4]byte{'s', 'a', 'i', 'z'}, 0)
+    size := 12 + 5
+    if !sameSize {
+        size += len(aux)
+    }
+    box.Box.Size = uint64(size)
+    n, buf := box.Encode()
+    if sameSize {
+        buf[n] = uint8(len(aux[0]))
+    }
+    binary.BigEndian.PutUint32(buf[n+1:], uint32(len(aux)))
+    n += 5
+    if !sameSize {
+        for _, a := range aux {
+            buf[n] = uint8(len(a))
+            n++
+        }
+    }
+    return buf, nil
+}
+
+func makeSaioBox(offset uint64) []byte {
+    box := NewFullBox([4]byte{'s', 'a', 'i', 'o'}, 0)
+    box.Box.Size = 12 + 4 + 4
+    if offset > 0xFFFFFFFF {
+        box.Version = 1
+        box.Box.Size += 4
+    }
+    n, buf := box.Encode()
+    binary.BigEndian.PutUint32(buf[n:], 1)
+    n += 4
+    if box.Version == 1 {
+        binary.BigEndian.PutUint64(buf[n:], offset)
+    } else {
+        binary.BigEndian.PutUint32(buf[n:], uint32(offset))
+    }
+    return buf
+}
+
+// 把每个sample的数据从r拷贝到w
+func copySampleData(r io.ReadSeeker, w io.Writer, samples []*convSample) error {
+    for _, sample := range samples {
+        if _, err := r.Seek(int64(sample.offset), io.SeekStart); err != nil {
+            return err
+        }
+        if _, err := io.CopyN(w, r, int64(sample.size)); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+func readTopLevelBox(r io.ReadSeeker, box topLevelBox) ([]byte, error) {
+    if _, err := r.Seek(box.offset, io.SeekStart); err != nil {
+        return nil, err
+    }
+    return readBoxData(r, uint64(box.size))
+}
+
+// mdat超过4G时使用largesize
+func makeMdatHeader(size uint64) []byte {
+    if size+8 > 0xFFFFFFFF {
+        buf := make([]byte, 16)
+        binary.BigEndian.PutUint32(buf, 1)
+        copy(buf[4:], "mdat")
+        binary.BigEndian.PutUint64(buf[8:], size+16)
+        return buf
+    }
+    buf := make([]byte, 8)
+    binary.BigEndian.PutUint32(buf, uint32(size+8))
+    copy(buf[4:], "mdat")
+    return buf
+}
@@ -0,0 +1,243 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestFragmentConvert(t *testing.T) {
+	normal := makeTestMp4(t, testMp4{})
+	//全部是关键帧时默认1秒一个fragment
+	out := rewriteTestMp4(t, func(w io.Writer) error { return Fragment(bytes.NewReader(normal), w) })
+	checkRewrittenMp4(t, out, "ftyp moov sidx moof mdat moof mdat mfra ", normal)
+
+	out = rewriteTestMp4(t, func(w io.Writer) error {
+		return Fragment(bytes.NewReader(normal), w, WithFragmentInterval(400), WithFragmentSidx(false), WithFragmentMfra(false))
+	})
+	checkRewrittenMp4(t, out, "ftyp moov"+strings.Repeat(" moof mdat", 5)+" ", normal)
+}
+
+func TestDefragment(t *testing.T) {
+	normal := makeTestMp4(t, testMp4{})
+	fragmented := makeTestMp4(t, testMp4{options: []MuxerOption{WithMp4Flag(MP4_FLAG_FRAGMENT)}})
+	out := rewriteTestMp4(t, func(w io.Writer) error { return Defragment(bytes.NewReader(fragmented), w) })
+	checkRewrittenMp4(t, out, "ftyp moov mdat ", normal)
+}
+
+func TestConvertErrors(t *testing.T) {
+	normal := makeTestMp4(t, testMp4{})
+	fragmented := makeTestMp4(t, testMp4{options: []MuxerOption{WithMp4Flag(MP4_FLAG_FRAGMENT)}})
+	var out bytes.Buffer
+	if err := Defragment(bytes.NewReader(normal), &out); err == nil {
+		t.Error("defragment a normal mp4 should fail")
+	}
+	if err := Fragment(bytes.NewReader(fragmented), &out); err == nil {
+		t.Error("fragment a fragmented mp4 should fail")
+	}
+	if err := Fragment(bytes.NewReader(normal[:64]), &out); err == nil {
+		t.Error("file without moov should fail")
+	}
+}
+
+// 在普通mp4的视频track中加入加密信息, ctts, 非关键帧, sdtp和sbgp
+func makeConvTestFile(t *testing.T) []byte {
+	normal := makeTestMp4(t, testMp4{})
+	src, boxes, err := readConvHead(bytes.NewReader(normal))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(boxes[len(boxes)-1].boxtype[:]) != "moov" {
+		t.Fatal("moov should be the last box")
+	}
+	prefix := normal[:boxes[len(boxes)-1].offset]
+	for _, track := range src.tracks {
+		if err = track.readStbl(bytes.NewReader(normal)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	video := src.tracks[0]
+	originTrak := video.trak
+	if string(video.handler[:]) != "vide" {
+		t.Fatalf("first track handler %q", video.handler[:])
+	}
+
+	var aux []byte
+	roll := &convSampleGroup{groupingType: mov_tag([4]byte{'r', 'o', 'l', 'l'})}
+	for i := range video.samples {
+		sample := &video.samples[i]
+		if i%2 == 1 {
+			sample.cto = 80
+		}
+		sample.flags = MOV_FRAG_SAMPLE_FLAG_DEPENDS_NO
+		roll.index = append(roll.index, 1)
+		if i%10 != 0 {
+			sample.flags = MOV_FRAG_SAMPLE_FLAG_IS_NON_SYNC | MOV_FRAG_SAMPLE_FLAG_DEPENDS_YES
+			roll.index[i] = 0
+		}
+		//前10个sample只有IV, 后面的sample有一个subsample
+		sample.aux = make([]byte, 8)
+		binary.BigEndian.PutUint64(sample.aux, uint64(i))
+		if i >= 10 {
+			sample.aux = append(sample.aux, 0, 1, 0, 2, 0, 0, 0, 4)
+		}
+		aux = append(aux, sample.aux...)
+	}
+	video.groups = append(video.groups, roll)
+
+	//avc1 -> encv + sinf(frma, schm, schi/tenc)
+	tenc := NewFullBox([4]byte{'t', 'e', 'n', 'c'}, 0)
+	tenc.Box.Size = 32
+	n, tencData := tenc.Encode()
+	tencData[n+2], tencData[n+3] = 1, 8
+	schm := NewFullBox([4]byte{'s', 'c', 'h', 'm'}, 0)
+	schm.Box.Size = 20
+	n, schmData := schm.Encode()
+	copy(schmData[n:], "cenc")
+	schmData[n+5] = 1
+	sinf := makeContainerBox("sinf", makeContainerBox("frma", []byte("avc1")), schmData, makeContainerBox("schi", tencData))
+
+	stbl, err := video.stblBox()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stbl.data, err = rewriteContainer(stbl, func(child *convBox) ([]byte, error) {
+		if !child.is("stsd") {
+			return child.data, nil
+		}
+		entry := append([]byte{}, child.payload()[8:]...)
+		copy(entry[4:], "encv")
+		entry = append(entry, sinf...)
+		binary.BigEndian.PutUint32(entry, uint32(len(entry)))
+		return makeContainerBox("stsd", child.payload()[:8], entry), nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	trak, err := splitBoxes(video.trak)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if video.trak, err = rewriteTrak(&trak[0], stbl.data, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+	if video.ivSize, err = findTencIVSize(video.trak[8:]); err != nil || video.ivSize != 8 {
+		t.Fatalf("iv size %d, %v", video.ivSize, err)
+	}
+
+	//aux数据放在moov之前的free box中
+	offsets := make([]uint64, len(video.samples))
+	for i := range video.samples {
+		offsets[i] = video.samples[i].offset
+	}
+	newStbl, err := makeConvStbl(video, offsets, uint64(len(prefix)+8))
+	if err != nil {
+		t.Fatal(err)
+	}
+	trak, _ = splitBoxes(video.trak)
+	if video.trak, err = rewriteTrak(&trak[0], newStbl, nil, nil); err != nil {
+		t.Fatal(err)
+	}
+
+	pssh := NewFullBox([4]byte{'p', 's', 's', 'h'}, 0)
+	pssh.Box.Size = 32
+	_, psshData := pssh.Encode()
+	psshData[12] = 0xED
+	moov, err := rewriteContainer(src.moov, func(child *convBox) ([]byte, error) {
+		if child.is("trak") && bytes.Equal(child.data, originTrak) {
+			return video.trak, nil
+		}
+		return child.data, nil
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	moov = makeContainerBox("moov", moov[8:], psshData)
+
+	file := append([]byte{}, prefix...)
+	file = append(file, makeContainerBox("free", aux)...)
+	return append(file, moov...)
+}
+
+func readConvTestSource(t *testing.T, data []byte, fragmented bool) *convSource {
+	var src *convSource
+	var err error
+	if fragmented {
+		src, err = readFragmentedMp4(bytes.NewReader(data))
+	} else {
+		src, err = readProgressiveMp4(bytes.NewReader(data))
+	}
+	if err != nil {
+		t.Fatal(err)
+	}
+	return src
+}
+
+func checkSameConvSource(t *testing.T, gotData []byte, got *convSource, wantData []byte, want *convSource) {
+	if len(got.tracks) != len(want.tracks) {
+		t.Fatalf("got %d tracks, want %d", len(got.tracks), len(want.tracks))
+	}
+	for i, track := range want.tracks {
+		gotTrack := got.tracks[i]
+		if len(gotTrack.samples) != len(track.samples) {
+			t.Fatalf("track %d: got %d samples, want %d", track.trackId, len(gotTrack.samples), len(track.samples))
+		}
+		for j, sample := range track.samples {
+			g := gotTrack.samples[j]
+			if g.dts != sample.dts || g.duration != sample.duration || g.cto != sample.cto || g.flags != sample.flags ||
+				g.size != sample.size || g.descIdx != sample.descIdx || !bytes.Equal(g.aux, sample.aux) {
+				t.Fatalf("track %d sample %d: got %+v, want %+v", track.trackId, j, g, sample)
+			}
+			if !bytes.Equal(gotData[g.offset:g.offset+uint64(g.size)], wantData[sample.offset:sample.offset+uint64(sample.size)]) {
+				t.Fatalf("track %d sample %d data mismatch", track.trackId, j)
+			}
+		}
+		if len(gotTrack.groups) != len(track.groups) {
+			t.Fatalf("track %d: got %d sample groups, want %d", track.trackId, len(gotTrack.groups), len(track.groups))
+		}
+		for j, g := range track.groups {
+			if gotTrack.groups[j].groupingType != g.groupingType || len(gotTrack.groups[j].index) != len(g.index) {
+				t.Fatalf("track %d sample group %d mismatch", track.trackId, j)
+			}
+			for k := range g.index {
+				if gotTrack.groups[j].index[k] != g.index[k] {
+					t.Fatalf("track %d sample group %d index %d mismatch", track.trackId, j, k)
+				}
+			}
+		}
+		for _, path := range [][]string{{"edts"}, {"mdia", "minf", "stbl", "stsd"}} {
+			wantBox, _ := findBoxPath(track.trak[8:], path...)
+			gotBox, _ := findBoxPath(gotTrack.trak[8:], path...)
+			if wantBox == nil || gotBox == nil || !bytes.Equal(wantBox.data, gotBox.data) {
+				t.Fatalf("track %d %s mismatch", track.trackId, path[len(path)-1])
+			}
+		}
+	}
+	pssh, _ := findBoxPath(got.moov.payload(), "pssh")
+	if pssh == nil {
+		t.Fatal("pssh not found")
+	}
+}
+
+func TestConvertRoundTrip(t *testing.T) {
+	file := makeConvTestFile(t)
+	origin := readConvTestSource(t, file, false)
+	if ivSize := origin.tracks[0].ivSize; ivSize != 8 {
+		t.Fatalf("iv size %d", ivSize)
+	}
+
+	//每10个sample一个关键帧
+	fragmented := rewriteTestMp4(t, func(w io.Writer) error { return Fragment(bytes.NewReader(file), w) })
+	if types := topLevelBoxTypes(t, fragmented); types != "ftyp moov sidx"+strings.Repeat(" moof mdat", 5)+" mfra " {
+		t.Fatalf("top level boxes %q", types)
+	}
+	checkSameConvSource(t, fragmented, readConvTestSource(t, fragmented, true), file, origin)
+
+	defragmented := rewriteTestMp4(t, func(w io.Writer) error { return Defragment(bytes.NewReader(fragmented), w) })
+	if types := topLevelBoxTypes(t, defragmented); types != "ftyp moov mdat " {
+		t.Fatalf("top level boxes %q", types)
+	}
+	checkSameConvSource(t, defragmented, readConvTestSource(t, defragmented, false), file, origin)
+}
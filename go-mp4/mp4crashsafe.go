@@ -0,0 +1,105 @@
+package mp4
+
+import (
+    "encoding/binary"
+    "errors"
+    "io"
+)
+
+// MP4_FLAG_CRASHSAFE 录制过程中按fmp4格式写文件(ftyp moov moof mdat moof mdat ...),
+// 每个fragment写完之后文件都是可以播放的fmp4, 断电或者程序崩溃最多丢失最后一个fragment
+// moov快照: moov/mvex中带有mehd, 每个fragment写完之后原地更新mehd中已经录制的时长
+// WriteTrailer时改写成普通mp4, 每一步中断文件都可以播放:
+//   1. 根据录制过程中记录的sample生成完整的moov(stts/stsz/stco...), 先以free box追加到文件末尾, 再改成moov
+//   2. 原来的moov和所有moof改成free box, ftyp改成isom, mdat保持不动
+// moov在文件末尾, 需要faststart的话关闭之后用FastStart另外生成文件
+// 改写需要读写原来的文件, 所以writer必须是io.ReadWriteSeeker
+
+// fragment输出后记录sample在文件中的绝对位置, dataOffset是mdat数据开始的位置
+func (track *mp4track) recordSamples(dataOffset uint64) {
+    for _, sample := range track.samplelist {
+        sample.offset += dataOffset
+        track.recordedSamples = append(track.recordedSamples, sample)
+    }
+}
+
+// 更新init moov中mehd的fragment_duration(毫秒)
+func (muxer *Movmuxer) updateMoovSnapshot() (err error) {
+    duration := uint64(0)
+    for _, track := range muxer.tracks {
+        if n := len(track.recordedSamples); n > 0 {
+            if d := track.recordedSamples[n-1].dts - track.recordedSamples[0].dts; d > duration {
+                duration = d
+            }
+        }
+    }
+    var end int64
+    if end, err = muxer.writer.Seek(0, io.SeekCurrent); err != nil {
+        return
+    }
+    buf := make([]byte, 8)
+    binary.BigEndian.PutUint64(buf, duration)
+    if err = writeAt(muxer.writer, muxer.mehdOffset, buf); err != nil {
+        return
+    }
+    _, err = muxer.writer.Seek(end, io.SeekStart)
+    return
+}
+
+func (muxer *Movmuxer) defragment() (err error) {
+    rws, ok := muxer.writer.(io.ReadWriteSeeker)
+    if !ok {
+        return errors.New("mp4 crash safe mode need io.ReadWriteSeeker")
+    }
+    var end int64
+    if end, err = rws.Seek(0, io.SeekCurrent); err != nil {
+        return
+    }
+    boxes, err := scanTopLevelBoxesUntil(rws, end)
+    if err != nil {
+        return
+    }
+    ftyp := makeFtypBox(mov_tag(isom), 0x200, []uint32{mov_tag(isom), mov_tag(iso2), mov_tag(mp41)})
+    if len(boxes) == 0 || string(boxes[0].boxtype[:]) != "ftyp" || boxes[0].size != int64(len(ftyp)) {
+        return errors.New("mp4 crash safe mode: unexpected ftyp box")
+    }
+
+    for _, track := range muxer.tracks {
+        track.clearSamples()
+        for _, sample := range track.recordedSamples {
+            track.addSampleEntry(sample)
+        }
+        track.recordedSamples = nil
+    }
+    muxer.movFlag &^= MP4_FLAG_FRAGMENT
+    moov := muxer.makeMoov()
+
+    //完整写入之后再改成moov, 写到一半失败时末尾只是一个不完整的free box
+    copy(moov[4:8], "free")
+    if err = writeAt(rws, end, moov); err != nil {
+        return
+    }
+    if err = writeAt(rws, end+4, []byte("moov")); err != nil {
+        return
+    }
+    for i := len(boxes) - 1; i > 0; i-- {
+        if t := string(boxes[i].boxtype[:]); t == "moov" || t == "moof" {
+            if err = writeAt(rws, boxes[i].offset+4, []byte("free")); err != nil {
+                return
+            }
+        }
+    }
+    if err = writeAt(rws, boxes[0].offset, ftyp); err != nil {
+        return
+    }
+    _, err = rws.Seek(end+int64(len(moov)), io.SeekStart)
+    return
+}
+
+func writeAt(ws io.WriteSeeker, offset int64, data []byte) error {
+    if _, err := ws.Seek(offset, io.SeekStart); err != nil {
+        return err
+    }
+    _, err := ws.Write(data)
+    return err
+}
@@ -0,0 +1,122 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/yapingcat/gomedia/go-codec"
+)
+
+func TestMuxCrashSafe(t *testing.T) {
+	normal := makeTestMp4(t, testMp4{})
+	crashsafe := makeTestMp4(t, testMp4{options: []MuxerOption{WithMp4Flag(MP4_FLAG_CRASHSAFE)}})
+	types := topLevelBoxTypes(t, crashsafe)
+	if !strings.HasPrefix(types, "ftyp free ") || !strings.HasSuffix(types, " moov ") || strings.Contains(types, "moof") || strings.Count(types, "moov") != 1 {
+		t.Fatalf("top level boxes %q", types)
+	}
+	checkSamePackets(t, readAllPackets(t, crashsafe), readAllPackets(t, normal))
+}
+
+func TestMuxCrashSafeInterrupted(t *testing.T) {
+	ws := newFmp4WriterSeeker(1024 * 64)
+	writeTestMp4(t, ws, testMp4{frames: 20, noAudio: true, crash: true, options: []MuxerOption{WithMp4Flag(MP4_FLAG_CRASHSAFE)}})
+	//没有调用WriteTrailer, 文件是合法的fmp4, 只丢失最后一个没有输出的fragment和缓存中的最后一帧
+	if types := topLevelBoxTypes(t, ws.buffer); !strings.HasPrefix(types, "ftyp moov moof mdat ") {
+		t.Fatalf("top level boxes %q", types)
+	}
+	pkgs := readAllPackets(t, ws.buffer)
+	if len(pkgs) != 18 {
+		t.Fatalf("got %d packets, want 18", len(pkgs))
+	}
+	//moov快照中的时长是最后一个输出的fragment的结束位置
+	i := bytes.Index(ws.buffer, []byte("mehd"))
+	if i < 0 || binary.BigEndian.Uint64(ws.buffer[i+8:]) != 17*40 {
+		t.Fatalf("mehd not updated")
+	}
+}
+
+// 第limit个字节之后的写入都失败
+type failingWriter struct {
+	*fmp4WriterSeeker
+	limit int
+}
+
+func (w *failingWriter) Write(p []byte) (int, error) {
+	if w.limit < 0 {
+		return w.fmp4WriterSeeker.Write(p)
+	}
+	if len(p) > w.limit {
+		n, _ := w.fmp4WriterSeeker.Write(p[:w.limit])
+		w.limit = 0
+		return n, errors.New("disk full")
+	}
+	w.limit -= len(p)
+	return w.fmp4WriterSeeker.Write(p)
+}
+
+func TestMuxCrashSafeCloseFailure(t *testing.T) {
+	for limit := 0; ; limit += 7 {
+		ws := &failingWriter{fmp4WriterSeeker: newFmp4WriterSeeker(1024 * 64), limit: -1}
+		muxer := writeTestMp4(t, ws, testMp4{frames: 20, crash: true, options: []MuxerOption{WithMp4Flag(MP4_FLAG_CRASHSAFE)}})
+		before := len(readAllPackets(t, ws.buffer))
+		ws.limit = limit
+		err := muxer.WriteTrailer()
+		//关闭过程中任何位置写失败, 已经输出的fragment都不能丢失
+		if pkgs := readAllPackets(t, ws.buffer); len(pkgs) < before {
+			t.Fatalf("write failed after %d bytes: got %d packets, want at least %d", limit, len(pkgs), before)
+		}
+		if err == nil {
+			if pkgs := readAllPackets(t, ws.buffer); len(pkgs) != 40 {
+				t.Fatalf("got %d packets, want 40", len(pkgs))
+			}
+			break
+		}
+	}
+}
+
+func TestMuxFragmentDuration(t *testing.T) {
+	aac := []byte{0x21, 0x00, 0x49, 0x90, 0x02, 0x19}
+	adts, _ := codec.ConvertASCToADTS([]byte{0x12, 0x10}, len(aac)+7)
+	ws := newFmp4WriterSeeker(1024 * 64)
+	muxer, err := CreateMp4Muxer(ws, WithMp4Flag(MP4_FLAG_CRASHSAFE), WithFragmentDuration(200))
+	if err != nil {
+		t.Fatal(err)
+	}
+	aid := muxer.AddAudioTrack(MP4_CODEC_AAC, WithExtraData([]byte{0x12, 0x10}))
+	fragments := 0
+	muxer.OnNewFragment(func(duration uint32, firstPts, firstDts uint64) {
+		fragments++
+	})
+	for i := 0; i < 50; i++ {
+		pts := uint64(i * 23)
+		if err = muxer.Write(aid, append(adts.Encode(), aac...), pts, pts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if fragments < 4 {
+		t.Fatalf("got %d fragments", fragments)
+	}
+	if pkgs := readAllPackets(t, ws.buffer); len(pkgs) < 40 {
+		t.Fatalf("interrupted recording got %d packets", len(pkgs))
+	}
+	if err = muxer.WriteTrailer(); err != nil {
+		t.Fatal(err)
+	}
+	if pkgs := readAllPackets(t, ws.buffer); len(pkgs) != 50 {
+		t.Fatalf("got %d packets, want 50", len(pkgs))
+	}
+}
+
+func TestMuxCrashSafeNeedReader(t *testing.T) {
+	w := struct{ io.WriteSeeker }{newFmp4WriterSeeker(1024)}
+	if _, err := CreateMp4Muxer(w, WithMp4Flag(MP4_FLAG_CRASHSAFE)); err == nil {
+		t.Fatal("crash safe mode with io.WriteSeeker should fail")
+	}
+	if _, err := CreateMp4Muxer(newFmp4WriterSeeker(1024), WithMp4Flag(MP4_FLAG_CRASHSAFE|MP4_FLAG_DASH)); err == nil {
+		t.Fatal("crash safe mode with dash should fail")
+	}
+}
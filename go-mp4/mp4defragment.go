@@ -0,0 +1,654 @@
+package mp4
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+    "sort"
+
+    "github.com/yapingcat/gomedia/go-codec"
+)
+
+type convSource struct {
+    ftyp   []byte
+    moov   *convBox
+    tracks []*convTrack
+    pssh   [][]byte //moof中的pssh
+}
+
+func (src *convSource) addPssh(pssh []byte) {
+    for _, p := range src.pssh {
+        if bytes.Equal(p, pssh) {
+            return
+        }
+    }
+    src.pssh = append(src.pssh, append([]byte{}, pssh...))
+}
+
+func (src *convSource) track(trackId uint32) *convTrack {
+    for _, track := range src.tracks {
+        if track.trackId == trackId {
+            return track
+        }
+    }
+    return nil
+}
+
+// 读取ftyp和moov, 解析moov中的track
+func readConvHead(r io.ReadSeeker) (*convSource, []topLevelBox, error) {
+    boxes, err := scanTopLevelBoxes(r)
+    if err != nil {
+        return nil, nil, err
+    }
+    src := &convSource{}
+    for _, box := range boxes {
+        switch string(box.boxtype[:]) {
+        case "ftyp":
+            if src.ftyp, err = readTopLevelBox(r, box); err != nil {
+                return nil, nil, err
+            }
+        case "moov":
+            moov, err := readTopLevelBox(r, box)
+            if err != nil {
+                return nil, nil, err
+            }
+            moovBoxes, err := splitBoxes(moov)
+            if err != nil {
+                return nil, nil, err
+            }
+            src.moov = &moovBoxes[0]
+        }
+    }
+    if src.moov == nil {
+        return nil, nil, errors.New("mp4: moov box not found")
+    }
+    if src.tracks, err = parseConvTracks(src.moov.payload()); err != nil {
+        return nil, nil, err
+    }
+    return src, boxes, nil
+}
+
+// 读取fmp4所有moof中的sample信息
+func readFragmentedMp4(r io.ReadSeeker) (*convSource, error) {
+    src, boxes, err := readConvHead(r)
+    if err != nil {
+        return nil, err
+    }
+    mvex, err := findBoxPath(src.moov.payload(), "mvex")
+    if err != nil {
+        return nil, err
+    }
+    if mvex == nil {
+        return nil, errors.New("mp4 defragment: not a fragmented mp4")
+    }
+    children, err := splitBoxes(mvex.payload())
+    if err != nil {
+        return nil, err
+    }
+    for _, child := range children {
+        if !child.is("trex") {
+            continue
+        }
+        trex := &TrackExtendsBox{Box: new(FullBox)}
+        if _, err = trex.Decode(bytes.NewReader(child.payload())); err != nil {
+            return nil, errBoxTruncated("trex")
+        }
+        if track := src.track(trex.TrackID); track != nil {
+            track.trex = trex
+        }
+    }
+
+    for _, box := range boxes {
+        if string(box.boxtype[:]) != "moof" {
+            continue
+        }
+        data, err := readTopLevelBox(r, box)
+        if err != nil {
+            return nil, err
+        }
+        moof, err := splitBoxes(data)
+        if err != nil {
+            return nil, err
+        }
+        children, err := splitBoxes(moof[0].payload())
+        if err != nil {
+            return nil, err
+        }
+        for i := range children {
+            switch {
+            case children[i].is("traf"):
+                err = src.parseTraf(r, &children[i], uint64(box.offset))
+            case children[i].is("pssh"):
+                src.addPssh(children[i].data)
+            }
+            if err != nil {
+                return nil, err
+            }
+        }
+    }
+    for _, track := range src.tracks {
+        track.padGroups()
+    }
+    return src, nil
+}
+
+func (src *convSource) parseTraf(r io.ReadSeeker, traf *convBox, moofOffset uint64) error {
+    children, err := splitBoxes(traf.payload())
+    if err != nil {
+        return err
+    }
+    tfhdBox := findBox(children, "tfhd")
+    if tfhdBox == nil {
+        return fmt.Errorf("mp4 traf box: %w: tfhd not found", codec.ErrInvalidData)
+    }
+    tfhd := &TrackFragmentHeaderBox{Box: new(FullBox)}
+    if _, err = tfhd.Decode(bytes.NewReader(tfhdBox.payload()), uint32(len(tfhdBox.payload())+8), moofOffset); err != nil {
+        return err
+    }
+    track := src.track(tfhd.Track_ID)
+    if track == nil {
+        return fmt.Errorf("mp4 tfhd box: %w: track %d not found", codec.ErrInvalidData, tfhd.Track_ID)
+    }
+    trex := track.trex
+    if trex == nil {
+        trex = NewTrackExtendsBox(track.trackId)
+    }
+    tfhdFlags := convFullBoxFlags(tfhdBox.payload())
+    descIdx, duration, size, flags := trex.DefaultSampleDescriptionIndex, trex.DefaultSampleDuration, trex.DefaultSampleSize, trex.DefaultSampleFlags
+    if tfhdFlags&TF_FLAG_SAMPLE_DESCRIPTION_INDEX_PRESENT != 0 {
+        descIdx = tfhd.SampleDescriptionIndex
+    }
+    if tfhdFlags&TF_FLAG_DEFAULT_SAMPLE_DURATION_PRESENT != 0 {
+        duration = tfhd.DefaultSampleDuration
+    }
+    if tfhdFlags&TF_FLAG_DEFAULT_SAMPLE_SIZE_PRESENT != 0 {
+        size = tfhd.DefaultSampleSize
+    }
+    if tfhdFlags&TF_FLAG_DEAAULT_SAMPLE_FLAGS_PRESENT != 0 {
+        flags = tfhd.DefaultSampleFlags
+    }
+    if descIdx == 0 {
+        descIdx = 1
+    }
+
+    dts := track.nextDts
+    if tfdtBox := findBox(children, "tfdt"); tfdtBox != nil {
+        tfdt := &TrackFragmentBaseMediaDecodeTimeBox{Box: new(FullBox)}
+        if _, err = tfdt.Decode(bytes.NewReader(tfdtBox.payload()), uint32(len(tfdtBox.payload())+8)); err != nil {
+            return err
+        }
+        dts = tfdt.BaseMediaDecodeTime
+        //两个fragment之间有空隙时延长上一个sample
+        if n := len(track.samples); n > 0 && dts > track.samples[n-1].dts {
+            track.samples[n-1].duration = uint32(dts - track.samples[n-1].dts)
+        }
+    }
+
+    start := len(track.samples)
+    dataPos := tfhd.BaseDataOffset
+    var runs []int
+    for i := range children {
+        if !children[i].is("trun") {
+            continue
+        }
+        trun := &TrackRunBox{Box: new(FullBox)}
+        if _, err = trun.Decode(bytes.NewReader(children[i].payload()), uint32(len(children[i].payload())+8), 0); err != nil {
+            return err
+        }
+        trunFlags := convFullBoxFlags(children[i].payload())
+        if trunFlags&TR_FLAG_DATA_OFFSET != 0 {
+            dataPos = uint64(int64(tfhd.BaseDataOffset) + int64(trun.Dataoffset))
+        }
+        for j, entry := range trun.EntryList.entrys {
+            sample := convSample{offset: dataPos, size: size, dts: dts, duration: duration, flags: flags, descIdx: descIdx}
+            if trunFlags&TR_FLAG_DATA_SAMPLE_DURATION != 0 {
+                sample.duration = entry.sampleDuration
+            }
+            if trunFlags&TR_FLAG_DATA_SAMPLE_SIZE != 0 {
+                sample.size = entry.sampleSize
+            }
+            if trunFlags&TR_FLAG_DATA_SAMPLE_FLAGS != 0 {
+                sample.flags = entry.sampleFlags
+            } else if j == 0 && trunFlags&TR_FLAG_DATA_FIRST_SAMPLE_FLAGS != 0 {
+                sample.flags = trun.FirstSampleFlags
+            }
+            if trunFlags&TR_FLAG_DATA_SAMPLE_COMPOSITION_TIME != 0 {
+                sample.cto = int32(entry.sampleCompositionTimeOffset)
+            }
+            dataPos += uint64(sample.size)
+            dts += uint64(sample.duration)
+            track.samples = append(track.samples, sample)
+        }
+        runs = append(runs, len(trun.EntryList.entrys))
+    }
+    track.nextDts = dts
+    count := len(track.samples) - start
+
+    var aux [][]byte
+    if senc := findBox(children, "senc"); senc != nil {
+        if aux, err = parseSencAux(senc, track.ivSize); err != nil {
+            return err
+        }
+    } else if saiz, saio := findBox(children, "saiz"), findBox(children, "saio"); saiz != nil && saio != nil {
+        sizes, err := parseSaizSizes(saiz)
+        if err != nil {
+            return err
+        }
+        offsets, err := parseSaioOffsets(saio)
+        if err != nil {
+            return err
+        }
+        if aux, err = readAuxInfo(r, sizes, offsets, tfhd.BaseDataOffset, runs); err != nil {
+            return err
+        }
+    }
+    if aux != nil {
+        if len(aux) != count {
+            return fmt.Errorf("mp4 traf box: %w: %d aux info for %d samples", codec.ErrInvalidData, len(aux), count)
+        }
+        for i := range aux {
+            track.samples[start+i].aux = aux[i]
+        }
+    }
+
+    for i := range children {
+        switch {
+        case children[i].is("sgpd"):
+            return fmt.Errorf("mp4 traf box: %w: sample group description in fragment", codec.ErrUnsupportedCodec)
+        case children[i].is("sbgp"):
+            if err = track.applySbgp(&children[i], start, count); err != nil {
+                return err
+            }
+        }
+    }
+    track.padGroups()
+    return nil
+}
+
+// 替换trak中的stbl, duration为nil时保持原来的值
+func rewriteTrak(trak *convBox, stbl []byte, mediaDuration, trackDuration *uint64) ([]byte, error) {
+    return rewriteContainer(trak, func(child *convBox) ([]byte, error) {
+        switch {
+        case child.is("tkhd") && trackDuration != nil:
+            return patchHeaderDuration(child, *trackDuration)
+        case child.is("mdia"):
+            return rewriteContainer(child, func(child *convBox) ([]byte, error) {
+                switch {
+                case child.is("mdhd") && mediaDuration != nil:
+                    return patchHeaderDuration(child, *mediaDuration)
+                case child.is("minf"):
+                    return rewriteContainer(child, func(child *convBox) ([]byte, error) {
+                        if child.is("stbl") {
+                            return stbl, nil
+                        }
+                        return child.data, nil
+                    })
+                }
+                return child.data, nil
+            })
+        }
+        return child.data, nil
+    })
+}
+
+// 保留原来的major brand以外的兼容brand, 去掉fragment相关的brand
+func makeConvFtyp(src []byte, major uint32, brands []uint32, drop []uint32) []byte {
+    contains := func(list []uint32, brand uint32) bool {
+        for _, b := range list {
+            if b == brand {
+                return true
+            }
+        }
+        return false
+    }
+    if boxes, err := splitBoxes(src); err == nil && len(boxes) > 0 {
+        payload := boxes[0].payload()
+        for n := 8; n+4 <= len(payload); n += 4 {
+            brand := binary.BigEndian.Uint32(payload[n:])
+            if !contains(brands, brand) && !contains(drop, brand) {
+                brands = append(brands, brand)
+            }
+        }
+    }
+    return makeFtypBox(major, 0x200, brands)
+}
+
+func (track *convTrack) stblBox() (*convBox, error) {
+    trak, err := splitBoxes(track.trak)
+    if err != nil {
+        return nil, err
+    }
+    stbl, err := findBoxPath(trak[0].payload(), "mdia", "minf", "stbl")
+    if err != nil {
+        return nil, err
+    }
+    if stbl == nil {
+        return nil, fmt.Errorf("mp4 trak box: %w: stbl not found", codec.ErrInvalidData)
+    }
+    return stbl, nil
+}
+
+// stbl中需要原样保留的box
+func keepStblBoxes(stbl *convBox) ([][]byte, [][]byte, error) {
+    children, err := splitBoxes(stbl.payload())
+    if err != nil {
+        return nil, nil, err
+    }
+    var stsd, sgpd [][]byte
+    for _, child := range children {
+        if child.is("stsd") {
+            stsd = append(stsd, child.data)
+        } else if child.is("sgpd") {
+            sgpd = append(sgpd, child.data)
+        }
+    }
+    if len(stsd) == 0 {
+        return nil, nil, fmt.Errorf("mp4 stbl box: %w: stsd not found", codec.ErrInvalidData)
+    }
+    return stsd, sgpd, nil
+}
+
+// 根据sample信息生成stbl, offsets是每个sample在新文件中的位置, aux数据从auxOffset开始连续存放
+func makeConvStbl(track *convTrack, offsets []uint64, auxOffset uint64) ([]byte, error) {
+    stbl, err := track.stblBox()
+    if err != nil {
+        return nil, err
+    }
+    stsd, sgpd, err := keepStblBoxes(stbl)
+    if err != nil {
+        return nil, err
+    }
+    boxes := append([][]byte{}, stsd...)
+    samples := track.samples
+
+    stts := &movstts{}
+    ctts := &movctts{}
+    hasCtts, negativeCtts, hasAux, hasNonSync, hasSdtp := false, false, false, false, false
+    sameSize := true
+    for i := range samples {
+        if n := len(stts.entrys); n > 0 && stts.entrys[n-1].sampleDelta == samples[i].duration {
+            stts.entrys[n-1].sampleCount++
+        } else {
+            stts.entrys = append(stts.entrys, sttsEntry{sampleCount: 1, sampleDelta: samples[i].duration})
+        }
+        if n := len(ctts.entrys); n > 0 && ctts.entrys[n-1].sampleOffset == uint32(samples[i].cto) {
+            ctts.entrys[n-1].sampleCount++
+        } else {
+            ctts.entrys = append(ctts.entrys, cttsEntry{sampleCount: 1, sampleOffset: uint32(samples[i].cto)})
+        }
+        hasCtts = hasCtts || samples[i].cto != 0
+        negativeCtts = negativeCtts || samples[i].cto < 0
+        hasAux = hasAux || samples[i].aux != nil
+        hasNonSync = hasNonSync || !samples[i].isSync()
+        hasSdtp = hasSdtp || samples[i].flags&0x0FF00000 != 0
+        sameSize = sameSize && samples[i].size == samples[0].size
+    }
+    stts.entryCount = uint32(len(stts.entrys))
+    ctts.entryCount = uint32(len(ctts.entrys))
+    boxes = append(boxes, makeStts(stts))
+    if hasCtts {
+        cttsbox := NewCompositionOffsetBox()
+        cttsbox.ctts = ctts
+        //负数的composition offset需要version 1
+        if negativeCtts {
+            cttsbox.box.Version = 1
+        }
+        _, data := cttsbox.Encode()
+        boxes = append(boxes, data)
+    }
+
+    //连续存放并且sample description相同的sample放在同一个chunk
+    stsc := &movstsc{}
+    stco := &movstco{}
+    lastSamplesPerChunk, lastDescIdx := uint32(0), uint32(0)
+    for i := 0; i < len(samples); {
+        j := i + 1
+        for j < len(samples) && offsets[j] == offsets[j-1]+uint64(samples[j-1].size) && samples[j].descIdx == samples[i].descIdx {
+            j++
+        }
+        stco.chunkOffsetlist = append(stco.chunkOffsetlist, offsets[i])
+        if uint32(j-i) != lastSamplesPerChunk || samples[i].descIdx != lastDescIdx {
+            lastSamplesPerChunk, lastDescIdx = uint32(j-i), samples[i].descIdx
+            stsc.entrys = append(stsc.entrys, stscEntry{firstChunk: uint32(len(stco.chunkOffsetlist)), samplesPerChunk: lastSamplesPerChunk, sampleDescriptionIndex: lastDescIdx})
+        }
+        i = j
+    }
+    stsc.entryCount = uint32(len(stsc.entrys))
+    stco.entryCount = uint32(len(stco.chunkOffsetlist))
+
+    stsz := &movstsz{sampleCount: uint32(len(samples))}
+    if sameSize && len(samples) > 0 {
+        stsz.sampleSize = samples[0].size
+    } else {
+        stsz.entrySizelist = make([]uint32, len(samples))
+        for i := range samples {
+            stsz.entrySizelist[i] = samples[i].size
+        }
+    }
+    boxes = append(boxes, makeStsc(stsc), makeStsz(stsz), makeStco(stco))
+
+    if hasNonSync {
+        stss := NewSyncSampleBox()
+        stss.entrys = make([]uint32, 0)
+        for i := range samples {
+            if samples[i].isSync() {
+                stss.entrys = append(stss.entrys, uint32(i+1))
+            }
+        }
+        _, data := stss.Encode()
+        boxes = append(boxes, data)
+    }
+    //sample flags中is_leading, depends_on, is_depended_on, has_redundancy和sdtp的格式一样
+    if hasSdtp {
+        sdtp := NewFullBox([4]byte{'s', 'd', 't', 'p'}, 0)
+        sdtp.Box.Size = uint64(12 + len(samples))
+        n, data := sdtp.Encode()
+        for i := range samples {
+            data[n+i] = uint8(samples[i].flags >> 20)
+        }
+        boxes = append(boxes, data)
+    }
+    boxes = append(boxes, sgpd...)
+    for _, g := range track.groups {
+        boxes = append(boxes, makeSbgpBox(g, g.index))
+    }
+    if hasAux {
+        aux := make([][]byte, len(samples))
+        for i := range samples {
+            aux[i] = samples[i].aux
+        }
+        saiz, err := makeSaizBox(aux)
+        if err != nil {
+            return nil, err
+        }
+        boxes = append(boxes, saiz, makeSaioBox(auxOffset))
+    }
+    return makeContainerBox("stbl", boxes...), nil
+}
+
+type convSampleRef struct {
+    track *convTrack
+    idx   int
+    r     io.ReadSeeker
+}
+
+// 按照sample在r中的位置排序
+func sortedSampleRefs(r io.ReadSeeker, tracks []*convTrack) []convSampleRef {
+    var order []convSampleRef
+    for _, track := range tracks {
+        for i := range track.samples {
+            order = append(order, convSampleRef{track: track, idx: i, r: r})
+        }
+    }
+    sort.SliceStable(order, func(i, j int) bool {
+        return order[i].track.samples[order[i].idx].offset < order[j].track.samples[order[j].idx].offset
+    })
+    return order
+}
+
+// Defragment 把fmp4(moof/traf/trun)转换成普通mp4(stbl), 输出ftyp moov mdat
+// sample数据按照在原文件中的顺序拷贝, 加密的auxiliary information放在mdat的最后
+func Defragment(r io.ReadSeeker, w io.Writer) error {
+    src, err := readFragmentedMp4(r)
+    if err != nil {
+        return err
+    }
+    return writeConvMp4(w, src, makeProgressiveFtyp(src), sortedSampleRefs(r, src.tracks))
+}
+
+// 去掉fragment相关的brand
+func makeProgressiveFtyp(src *convSource) []byte {
+    return makeConvFtyp(src.ftyp, mov_tag(isom), []uint32{mov_tag(isom), mov_tag(iso2), mov_tag(mp41)},
+        []uint32{mov_tag(iso5), mov_tag(iso6), mov_tag(msdh), mov_tag(msix), mov_tag([4]byte{'d', 'a', 's', 'h'})})
+}
+
+// 输出ftyp moov mdat, sample数据按照order的顺序写入mdat
+func writeConvMp4(w io.Writer, src *convSource, ftyp []byte, order []convSampleRef) error {
+    //每个sample在mdat中的相对位置
+    relOffsets := make(map[*convTrack][]uint64)
+    for _, track := range src.tracks {
+        relOffsets[track] = make([]uint64, len(track.samples))
+    }
+    dataSize := uint64(0)
+    for _, ref := range order {
+        relOffsets[ref.track][ref.idx] = dataSize
+        dataSize += uint64(ref.track.samples[ref.idx].size)
+    }
+    auxRel := make(map[*convTrack]uint64)
+    for _, track := range src.tracks {
+        auxRel[track] = dataSize
+        for i := range track.samples {
+            dataSize += uint64(len(track.samples[i].aux))
+        }
+    }
+
+    mdatHdr := makeMdatHeader(dataSize)
+    //moov的大小会影响chunk offset, chunk offset又可能让stco变成co64, 迭代到大小不再变化
+    var moov []byte
+    var err error
+    moovSize := 0
+    for i := 0; i < 8; i++ {
+        base := uint64(len(ftyp) + moovSize + len(mdatHdr))
+        if moov, err = makeConvMoov(src, base, relOffsets, auxRel); err != nil {
+            return err
+        }
+        if len(moov) == moovSize {
+            break
+        }
+        moovSize = len(moov)
+    }
+    if len(moov) != moovSize {
+        return errors.New("mp4: moov size does not converge")
+    }
+
+    for _, data := range [][]byte{ftyp, moov, mdatHdr} {
+        if _, err = w.Write(data); err != nil {
+            return err
+        }
+    }
+    for _, ref := range order {
+        sample := &ref.track.samples[ref.idx]
+        if _, err = ref.r.Seek(int64(sample.offset), io.SeekStart); err != nil {
+            return err
+        }
+        if _, err = io.CopyN(w, ref.r, int64(sample.size)); err != nil {
+            return err
+        }
+    }
+    for _, track := range src.tracks {
+        for i := range track.samples {
+            if _, err = w.Write(track.samples[i].aux); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+func (src *convSource) movieTimescale() (uint32, error) {
+    mvhd, err := findBoxPath(src.moov.payload(), "mvhd")
+    if err != nil {
+        return 0, err
+    }
+    if mvhd == nil {
+        return 0, fmt.Errorf("mp4 moov box: %w: mvhd not found", codec.ErrInvalidData)
+    }
+    return headerTimescale(mvhd)
+}
+
+func makeConvMoov(src *convSource, base uint64, relOffsets map[*convTrack][]uint64, auxRel map[*convTrack]uint64) ([]byte, error) {
+    movieTimescale, err := src.movieTimescale()
+    if err != nil {
+        return nil, err
+    }
+    trakIdx := 0
+    maxDuration := uint64(0)
+    traks := make([][]byte, 0, len(src.tracks))
+    for _, track := range src.tracks {
+        offsets := make([]uint64, len(track.samples))
+        for i, rel := range relOffsets[track] {
+            offsets[i] = base + rel
+        }
+        stbl, err := makeConvStbl(track, offsets, base+auxRel[track])
+        if err != nil {
+            return nil, err
+        }
+        mediaDuration := track.mediaDuration()
+        trackDuration := rescaleTimescale(mediaDuration, track.timescale, movieTimescale)
+        if track.edits != nil {
+            trackDuration = 0
+            for _, edit := range track.edits {
+                trackDuration += edit.segmentDuration
+            }
+        }
+        if trackDuration > maxDuration {
+            maxDuration = trackDuration
+        }
+        trakBoxes, err := splitBoxes(track.trak)
+        if err != nil {
+            return nil, err
+        }
+        trak, err := rewriteTrak(&trakBoxes[0], stbl, &mediaDuration, &trackDuration)
+        if err != nil {
+            return nil, err
+        }
+        if track.edits != nil {
+            if trak, err = replaceEdts(trak, makeConvEdts(track.edits)); err != nil {
+                return nil, err
+            }
+        }
+        traks = append(traks, trak)
+    }
+    var moovPssh [][]byte
+    moov, err := rewriteContainer(src.moov, func(child *convBox) ([]byte, error) {
+        switch {
+        case child.is("mvhd"):
+            return patchHeaderDuration(child, maxDuration)
+        case child.is("trak"):
+            trakIdx++
+            return traks[trakIdx-1], nil
+        case child.is("mvex"):
+            return nil, nil
+        case child.is("pssh"):
+            moovPssh = append(moovPssh, child.data)
+        }
+        return child.data, nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    //moof中的pssh移到moov中
+    children := [][]byte{moov[8:]}
+    for _, pssh := range src.pssh {
+        found := false
+        for _, p := range moovPssh {
+            found = found || bytes.Equal(p, pssh)
+        }
+        if !found {
+            children = append(children, pssh)
+        }
+    }
+    return makeContainerBox("moov", children...), nil
+}
@@ -1,11 +1,12 @@
 package mp4
 
 import (
-    "encoding/binary"
     "errors"
+    "fmt"
     "io"
 
     "github.com/yapingcat/gomedia/go-codec"
+    "github.com/yapingcat/gomedia/go-timebase"
 )
 
 type AVPacket struct {
@@ -68,7 +69,6 @@ type MovDemuxer struct {
     mdatOffset    []uint64 //一个mp4文件可能存在多个mdatbox
     tracks        []*mp4track
     readSampleIdx []uint32
-    mp4out        []byte
     mp4Info       Mp4Info
 
     //for demux fmp4
@@ -77,6 +77,7 @@ type MovDemuxer struct {
     pssh         []PsshBox
     moofOffset   int64
     dataOffset   uint32
+    fileSize     int64
 
 	OnRawSample func(cid MP4_CODEC_TYPE, sample []byte, subSample *SubSample) error
 }
@@ -95,17 +96,28 @@ func CreateMp4Demuxer(r io.ReadSeeker) *MovDemuxer {
 func (demuxer *MovDemuxer) ReadHead() ([]TrackInfo, error) {
     infos := make([]TrackInfo, 0, 2)
     var err error
+    if demuxer.fileSize, err = demuxer.size(); err != nil {
+        return nil, err
+    }
     for {
         fullbox := FullBox{}
         basebox := BasicBox{}
-        _, err = basebox.Decode(demuxer.reader)
+        var hdrLen int
+        hdrLen, err = basebox.Decode(demuxer.reader)
         if err != nil {
+            //录制中断时最后一个box头可能没有写完, 当作文件结束
+            if err == io.ErrUnexpectedEOF {
+                err = io.EOF
+            }
             break
         }
-        if basebox.Size < BasicBoxLen {
+        if basebox.Size < uint64(hdrLen) {
             err = errors.New("mp4 Parser error")
             break
         }
+        if err = demuxer.checkBox(&basebox, hdrLen); err != nil {
+            break
+        }
         switch mov_tag(basebox.Type) {
         case mov_tag([4]byte{'f', 't', 'y', 'p'}):
             err = decodeFtypBox(demuxer, uint32(basebox.Size))
@@ -117,7 +129,7 @@ func (demuxer *MovDemuxer) ReadHead() ([]TrackInfo, error) {
                 break
             }
             demuxer.mdatOffset = append(demuxer.mdatOffset, uint64(currentOffset))
-            _, err = demuxer.reader.Seek(int64(basebox.Size)-BasicBoxLen, io.SeekCurrent)
+            _, err = demuxer.reader.Seek(int64(basebox.Size)-int64(hdrLen), io.SeekCurrent)
         case mov_tag([4]byte{'m', 'o', 'o', 'v'}):
             var currentOffset int64
             if currentOffset, err = demuxer.reader.Seek(0, io.SeekCurrent); err != nil {
@@ -131,6 +143,12 @@ func (demuxer *MovDemuxer) ReadHead() ([]TrackInfo, error) {
                 err = errors.New("incomplete mp4 file")
                 break
             }
+            //crash safe模式关闭时在文件末尾追加完整的moov, 以最后一个moov为准
+            if len(demuxer.tracks) > 0 {
+                demuxer.tracks = nil
+                demuxer.currentTrack = nil
+                demuxer.isFragement = false
+            }
             _, err = demuxer.reader.Seek(currentOffset, io.SeekStart)
         case mov_tag([4]byte{'m', 'v', 'h', 'd'}):
             err = decodeMvhd(demuxer)
@@ -203,6 +221,22 @@ func (demuxer *MovDemuxer) ReadHead() ([]TrackInfo, error) {
             err = decodeAudioSampleEntry(demuxer)
         case mov_tag([4]byte{'o', 'p', 'u', 's'}):
             demuxer.tracks[len(demuxer.tracks)-1].cid = MP4_CODEC_OPUS
+        case mov_tag([4]byte{'a', 'c', '-', '3'}):
+            demuxer.tracks[len(demuxer.tracks)-1].cid = MP4_CODEC_AC3
+            demuxer.tracks[len(demuxer.tracks)-1].extra = new(ac3ExtraData)
+            err = decodeAudioSampleEntry(demuxer)
+        case mov_tag([4]byte{'e', 'c', '-', '3'}):
+            demuxer.tracks[len(demuxer.tracks)-1].cid = MP4_CODEC_EAC3
+            demuxer.tracks[len(demuxer.tracks)-1].extra = new(ac3ExtraData)
+            err = decodeAudioSampleEntry(demuxer)
+        case mov_tag([4]byte{'d', 'a', 'c', '3'}), mov_tag([4]byte{'d', 'e', 'c', '3'}):
+            err = decodeDac3Box(demuxer, uint32(basebox.Size))
+        case mov_tag([4]byte{'f', 'L', 'a', 'C'}):
+            demuxer.tracks[len(demuxer.tracks)-1].cid = MP4_CODEC_FLAC
+            demuxer.tracks[len(demuxer.tracks)-1].extra = new(flacExtraData)
+            err = decodeAudioSampleEntry(demuxer)
+        case mov_tag([4]byte{'d', 'f', 'L', 'a'}):
+            err = decodeDflaBox(demuxer, uint32(basebox.Size))
         case mov_tag([4]byte{'a', 'v', 'c', 'C'}):
             err = decodeAvccBox(demuxer, uint32(basebox.Size))
         case mov_tag([4]byte{'h', 'v', 'c', 'C'}):
@@ -236,13 +270,13 @@ func (demuxer *MovDemuxer) ReadHead() ([]TrackInfo, error) {
 		case mov_tag([4]byte{'s', 'a', 'i', 'o'}):
 			err = decodeSaioBox(demuxer, uint32(basebox.Size))
 		case mov_tag([4]byte{'u', 'u', 'i', 'd'}):
-			_, err = demuxer.reader.Seek(int64(basebox.Size)-BasicBoxLen-16, io.SeekCurrent)
+			_, err = demuxer.reader.Seek(int64(basebox.Size)-int64(hdrLen), io.SeekCurrent)
 		case mov_tag([4]byte{'s', 'g', 'p', 'd'}):
 			err = decodeSgpdBox(demuxer, uint32(basebox.Size))
         case mov_tag([4]byte{'w', 'a', 'v', 'e'}):
             err = decodeWaveBox(demuxer)
         default:
-            _, err = demuxer.reader.Seek(int64(basebox.Size)-BasicBoxLen, io.SeekCurrent)
+            _, err = demuxer.reader.Seek(int64(basebox.Size)-int64(hdrLen), io.SeekCurrent)
         }
         if err != nil {
             break
@@ -252,10 +286,27 @@ func (demuxer *MovDemuxer) ReadHead() ([]TrackInfo, error) {
         return nil, err
     }
     if !demuxer.isFragement {
-        demuxer.buildSampleList()
+        if err = demuxer.buildSampleList(); err != nil {
+            return nil, err
+        }
+    } else {
+        //最后一个fragment的mdat可能没有写完
+        for _, track := range demuxer.tracks {
+            n := 0
+            for _, sample := range track.samplelist {
+                if sample.offset+sample.size <= uint64(demuxer.fileSize) {
+                    track.samplelist[n] = sample
+                    n++
+                }
+            }
+            track.samplelist = track.samplelist[:n]
+        }
     }
     demuxer.readSampleIdx = make([]uint32, len(demuxer.tracks))
     for _, track := range demuxer.tracks {
+        if track.timescale == 0 {
+            return nil, fmt.Errorf("mp4 track %d: %w: timescale is 0", track.trackId, codec.ErrInvalidData)
+        }
         info := TrackInfo{}
         info.Cid = track.cid
         info.Duration = track.duration
@@ -268,14 +319,69 @@ func (demuxer *MovDemuxer) ReadHead() ([]TrackInfo, error) {
         info.Height = track.height
         info.Timescale = track.timescale
         if len(track.samplelist) > 0 {
-            info.StartDts = track.samplelist[0].dts * 1000 / uint64(track.timescale)
-            info.EndDts = track.samplelist[len(track.samplelist)-1].dts * 1000 / uint64(track.timescale)
+            info.StartDts = track.toMillisecond(track.samplelist[0].dts)
+            info.EndDts = track.toMillisecond(track.samplelist[len(track.samplelist)-1].dts)
         }
         infos = append(infos, info)
     }
     return infos, nil
 }
 
+// 文件大小, 读取位置保持不变
+func (demuxer *MovDemuxer) size() (int64, error) {
+    current, err := demuxer.reader.Seek(0, io.SeekCurrent)
+    if err != nil {
+        return 0, err
+    }
+    end, err := demuxer.reader.Seek(0, io.SeekEnd)
+    if err != nil {
+        return 0, err
+    }
+    _, err = demuxer.reader.Seek(current, io.SeekStart)
+    return end, err
+}
+
+// 检查box大小和所在的层级, 避免按照损坏的box分配内存或者访问不存在的track
+func (demuxer *MovDemuxer) checkBox(box *BasicBox, hdrLen int) error {
+    tag := mov_tag(box.Type)
+    //mdat可能没有写完, 由读取sample时检查
+    if tag != mov_tag([4]byte{'m', 'd', 'a', 't'}) {
+        offset, err := demuxer.reader.Seek(0, io.SeekCurrent)
+        if err != nil {
+            return err
+        }
+        if box.Size-uint64(hdrLen) > uint64(demuxer.fileSize-offset) {
+            //录制中断时没有写完的moof和crash safe模式关闭时写了一半的free, 当作文件结束
+            if tag == mov_tag([4]byte{'m', 'o', 'o', 'f'}) || tag == mov_tag([4]byte{'f', 'r', 'e', 'e'}) {
+                return io.EOF
+            }
+            return errBoxTruncated(string(box.Type[:]))
+        }
+    }
+    switch tag {
+    case mov_tag([4]byte{'t', 'k', 'h', 'd'}), mov_tag([4]byte{'m', 'd', 'h', 'd'}), mov_tag([4]byte{'s', 't', 'b', 'l'}),
+        mov_tag([4]byte{'s', 't', 's', 'd'}), mov_tag([4]byte{'e', 'l', 's', 't'}), mov_tag([4]byte{'s', 'g', 'p', 'd'}),
+        mov_tag([4]byte{'e', 'n', 'c', 'v'}), mov_tag([4]byte{'e', 'n', 'c', 'a'}), mov_tag([4]byte{'f', 'r', 'm', 'a'}),
+        mov_tag([4]byte{'t', 'e', 'n', 'c'}), mov_tag([4]byte{'s', 'e', 'n', 'c'}),
+        mov_tag([4]byte{'a', 'v', 'c', '1'}), mov_tag([4]byte{'h', 'v', 'c', '1'}), mov_tag([4]byte{'h', 'e', 'v', '1'}),
+        mov_tag([4]byte{'m', 'p', '4', 'a'}), mov_tag([4]byte{'u', 'l', 'a', 'w'}), mov_tag([4]byte{'a', 'l', 'a', 'w'}),
+        mov_tag([4]byte{'o', 'p', 'u', 's'}), mov_tag([4]byte{'a', 'c', '-', '3'}), mov_tag([4]byte{'e', 'c', '-', '3'}),
+        mov_tag([4]byte{'d', 'a', 'c', '3'}), mov_tag([4]byte{'d', 'e', 'c', '3'}), mov_tag([4]byte{'f', 'L', 'a', 'C'}),
+        mov_tag([4]byte{'d', 'f', 'L', 'a'}), mov_tag([4]byte{'a', 'v', 'c', 'C'}), mov_tag([4]byte{'h', 'v', 'c', 'C'}),
+        mov_tag([4]byte{'e', 's', 'd', 's'}):
+        if len(demuxer.tracks) == 0 {
+            return fmt.Errorf("mp4 %s box: %w: not in trak", string(box.Type[:]), codec.ErrInvalidData)
+        }
+    case mov_tag([4]byte{'s', 't', 't', 's'}), mov_tag([4]byte{'c', 't', 't', 's'}), mov_tag([4]byte{'s', 't', 's', 'c'}),
+        mov_tag([4]byte{'s', 't', 's', 'z'}), mov_tag([4]byte{'s', 't', 'c', 'o'}), mov_tag([4]byte{'c', 'o', '6', '4'}),
+        mov_tag([4]byte{'s', 't', 's', 's'}):
+        if len(demuxer.tracks) == 0 || demuxer.tracks[len(demuxer.tracks)-1].stbltable == nil {
+            return fmt.Errorf("mp4 %s box: %w: not in stbl", string(box.Type[:]), codec.ErrInvalidData)
+        }
+    }
+    return nil
+}
+
 func (demuxer *MovDemuxer) GetMp4Info() Mp4Info {
     return demuxer.mp4Info
 }
@@ -300,8 +406,8 @@ func (demuxer *MovDemuxer) ReadPacket() (*AVPacket, error) {
                 whichTrack = track
                 whichTracki = i
             } else {
-                dts1 := minTsSample.dts * uint64(demuxer.mp4Info.Timescale) / uint64(whichTrack.timescale)
-                dts2 := track.samplelist[idx].dts * uint64(demuxer.mp4Info.Timescale) / uint64(track.timescale)
+                dts1 := timebase.RescaleUint64(minTsSample.dts, timebase.ClockRate(whichTrack.timescale), timebase.ClockRate(demuxer.mp4Info.Timescale))
+                dts2 := timebase.RescaleUint64(track.samplelist[idx].dts, timebase.ClockRate(track.timescale), timebase.ClockRate(demuxer.mp4Info.Timescale))
                 if dts1 > dts2 {
                     minTsSample = track.samplelist[idx]
                     whichTrack = track
@@ -339,6 +445,9 @@ func (demuxer *MovDemuxer) ReadPacket() (*AVPacket, error) {
         if minTsSample.dts == uint64(maxdts) {
             return nil, io.EOF
         }
+        if minTsSample.offset > uint64(demuxer.fileSize) || minTsSample.size > uint64(demuxer.fileSize)-minTsSample.offset {
+            return nil, fmt.Errorf("mp4 sample: %w: offset %d size %d", codec.ErrTruncated, minTsSample.offset, minTsSample.size)
+        }
         if _, err := demuxer.reader.Seek(int64(minTsSample.offset), io.SeekStart); err != nil {
             return nil, err
         }
@@ -350,8 +459,8 @@ func (demuxer *MovDemuxer) ReadPacket() (*AVPacket, error) {
         avpkg := &AVPacket{
             Cid:     whichTrack.cid,
             TrackId: int(whichTrack.trackId),
-            Pts:     minTsSample.pts * 1000 / uint64(whichTrack.timescale),
-            Dts:     minTsSample.dts * 1000 / uint64(whichTrack.timescale),
+            Pts:     whichTrack.toMillisecond(minTsSample.pts),
+            Dts:     whichTrack.toMillisecond(minTsSample.dts),
         }
 		if demuxer.OnRawSample != nil {
 			err := demuxer.OnRawSample(whichTrack.cid, sample, subSample)
@@ -359,29 +468,18 @@ func (demuxer *MovDemuxer) ReadPacket() (*AVPacket, error) {
 				return nil, err
 			}
 		}
-        if whichTrack.cid == MP4_CODEC_H264 {
-            extra, ok := whichTrack.extra.(*h264ExtraData)
-            if !ok {
-                panic("must init aacExtraData first")
-            }
-            avpkg.Data = demuxer.processH264(sample, extra)
-        } else if whichTrack.cid == MP4_CODEC_H265 {
-            extra, ok := whichTrack.extra.(*h265ExtraData)
-            if !ok {
-                panic("must init aacExtraData first")
-            }
-            avpkg.Data = demuxer.processH265(sample, extra)
-        } else if whichTrack.cid == MP4_CODEC_AAC {
-            aacExtra, ok := whichTrack.extra.(*aacExtraData)
-            if !ok {
-                panic("must init aacExtraData first")
+        var err error
+        switch whichTrack.cid {
+        case MP4_CODEC_H264, MP4_CODEC_H265, MP4_CODEC_AAC:
+            if whichTrack.bsf == nil {
+                if whichTrack.bsf, err = newDemuxBSF(whichTrack); err != nil {
+                    return nil, err
+                }
             }
-            adts, err := codec.ConvertASCToADTS(aacExtra.asc, len(sample)+7)
-            if err != nil {
+            if avpkg.Data, err = whichTrack.bsf.Filter(sample); err != nil {
                 return nil, err
             }
-            avpkg.Data = append(adts.Encode(), sample...)
-        } else {
+        default:
             avpkg.Data = sample
         }
         if len(avpkg.Data) > 0 {
@@ -410,9 +508,12 @@ func (demuxer *MovDemuxer) GetSyncTable(trackId uint32) ([]SyncSample, error) {
 
     for i := 0; i < len(syncTable); i++ {
         idx := track.stbltable.stss.sampleNumber[i] - 1
+        if int(idx) >= len(track.samplelist) {
+            return nil, fmt.Errorf("mp4 stss box: %w: sample number %d", codec.ErrInvalidData, idx+1)
+        }
         syncTable[i] = SyncSample{
-            Pts:    track.samplelist[idx].pts * 1000 / uint64(track.timescale),
-            Dts:    track.samplelist[idx].dts * 1000 / uint64(track.timescale),
+            Pts:    track.toMillisecond(track.samplelist[idx].pts),
+            Dts:    track.toMillisecond(track.samplelist[idx].dts),
             Offset: uint32(track.samplelist[idx].offset),
             Size:   uint32(track.samplelist[idx].size),
         }
@@ -423,7 +524,7 @@ func (demuxer *MovDemuxer) GetSyncTable(trackId uint32) ([]SyncSample, error) {
 func (demuxer *MovDemuxer) SeekTime(dts uint64) error {
     for i, track := range demuxer.tracks {
         for j := 0; j < len(track.samplelist); j++ {
-            if track.samplelist[j].dts*1000/uint64(track.timescale) < dts {
+            if track.toMillisecond(track.samplelist[j].dts) < dts {
                 continue
             }
             demuxer.readSampleIdx[i] = uint32(j)
@@ -433,12 +534,24 @@ func (demuxer *MovDemuxer) SeekTime(dts uint64) error {
     return nil
 }
 
-func (demuxer *MovDemuxer) buildSampleList() {
+func (demuxer *MovDemuxer) buildSampleList() error {
     for _, track := range demuxer.tracks {
         stbl := track.stbltable
-        chunks := make([]movchunk, stbl.stco.entryCount)
+        if stbl == nil || stbl.stco == nil || stbl.stsc == nil || stbl.stsz == nil || stbl.stts == nil {
+            continue
+        }
+        if len(stbl.stsc.entrys) == 0 || stbl.stsz.sampleCount == 0 {
+            continue
+        }
+        if stbl.stsz.sampleSize == 0 && len(stbl.stsz.entrySizelist) < int(stbl.stsz.sampleCount) {
+            return fmt.Errorf("mp4 stsz box: %w", codec.ErrTruncated)
+        }
+        if uint64(stbl.stsz.sampleSize)*uint64(stbl.stsz.sampleCount) > uint64(demuxer.fileSize) {
+            return fmt.Errorf("mp4 stsz box: %w: sample count %d", codec.ErrInvalidData, stbl.stsz.sampleCount)
+        }
+        chunks := make([]movchunk, len(stbl.stco.chunkOffsetlist))
         iterator := 0
-        for i := 0; i < int(stbl.stco.entryCount); i++ {
+        for i := 0; i < len(chunks); i++ {
             chunks[i].chunknum = uint32(i + 1)
             chunks[i].chunkoffset = stbl.stco.chunkOffsetlist[i]
             for iterator+1 < int(stbl.stsc.entryCount) && stbl.stsc.entrys[iterator+1].firstChunk <= chunks[i].chunknum {
@@ -496,122 +609,43 @@ func (demuxer *MovDemuxer) buildSampleList() {
         } else {
             iterator = 0
             for i := range stbl.ctts.entrys {
-                for j := 0; j < int(stbl.ctts.entrys[i].sampleCount); j++ {
+                for j := 0; j < int(stbl.ctts.entrys[i].sampleCount) && iterator < len(track.samplelist); j++ {
                     track.samplelist[iterator].pts = track.samplelist[iterator].dts + uint64(stbl.ctts.entrys[i].sampleOffset)
                     iterator++
                 }
             }
         }
     }
+    return nil
 }
 
-func (demuxer *MovDemuxer) processH264(avcc []byte, extra *h264ExtraData) []byte {
-    idr := false
-    vcl := false
-    spspps := false
-    h264 := avcc
-    for len(h264) > 0 {
-        nalusize := binary.BigEndian.Uint32(h264)
-        codec.CovertAVCCToAnnexB(h264)
-        nalType := codec.H264NaluType(h264)
-        switch {
-        case nalType == codec.H264_NAL_PPS:
-            fallthrough
-        case nalType == codec.H264_NAL_SPS:
-            spspps = true
-        case nalType == codec.H264_NAL_I_SLICE:
-            idr = true
-            fallthrough
-        case nalType >= codec.H264_NAL_P_SLICE && nalType <= codec.H264_NAL_SLICE_C:
-            vcl = true
-        }
-        h264 = h264[4+nalusize:]
-    }
-
-    if !vcl {
-        if !spspps {
-            return avcc
-        } else {
-            demuxer.mp4out = append(demuxer.mp4out, avcc...)
+// sample转换为Annex-B/ADTS, 关键帧之前插入sps/pps(vps)
+func newDemuxBSF(track *mp4track) (codec.BitStreamFilter, error) {
+    switch extra := track.extra.(type) {
+    case *h264ExtraData:
+        //参数集都在码流中(avc3)时没有extradata
+        if len(extra.spss) == 0 && len(extra.ppss) == 0 {
+            return codec.NewLengthToAnnexBFilter(codec.CODECID_VIDEO_H264, nil)
         }
-        return nil
-    }
-
-    if spspps {
-        demuxer.mp4out = demuxer.mp4out[:0]
-        return avcc
-    }
-    if !idr {
-        return avcc
-    }
-    if len(demuxer.mp4out) > 0 {
-        out := make([]byte, len(demuxer.mp4out)+len(avcc))
-        copy(out, demuxer.mp4out)
-        copy(out[len(demuxer.mp4out):], avcc)
-        demuxer.mp4out = demuxer.mp4out[:0]
-        return out
-    }
-
-    out := make([]byte, 0)
-    for _, sps := range extra.spss {
-        out = append(out, sps...)
-    }
-    for _, pps := range extra.ppss {
-        out = append(out, pps...)
-    }
-    out = append(out, avcc...)
-    return out
-}
-
-func (demuxer *MovDemuxer) processH265(hvcc []byte, extra *h265ExtraData) []byte {
-    idr := false
-    vcl := false
-    spsppsvps := false
-    h265 := hvcc
-    for len(h265) > 0 {
-        nalusize := binary.BigEndian.Uint32(h265)
-        codec.CovertAVCCToAnnexB(h265)
-        nalType := codec.H265NaluType(h265)
-        switch {
-        case nalType == codec.H265_NAL_VPS:
-            fallthrough
-        case nalType == codec.H265_NAL_PPS:
-            fallthrough
-        case nalType == codec.H265_NAL_SPS:
-            spsppsvps = true
-        case nalType >= codec.H265_NAL_SLICE_BLA_W_LP && nalType <= codec.H265_NAL_SLICE_CRA:
-            idr = true
-            fallthrough
-        case nalType >= codec.H265_NAL_Slice_TRAIL_N && nalType <= codec.H265_NAL_SLICE_RASL_R:
-            vcl = true
-        }
-        h265 = h265[4+nalusize:]
-    }
-    if !vcl {
-        if !spsppsvps {
-            return hvcc
-        } else {
-            demuxer.mp4out = append(demuxer.mp4out, hvcc...)
+        //CreateH264AVCCExtradata会修改传入的slice
+        spss := append([][]byte{}, extra.spss...)
+        ppss := append([][]byte{}, extra.ppss...)
+        avcc, err := codec.CreateH264AVCCExtradata(spss, ppss)
+        if err != nil {
+            return nil, err
         }
-        return nil
-    }
-
-    if spsppsvps {
-        demuxer.mp4out = demuxer.mp4out[:0]
-        return hvcc
-    }
-    if !idr {
-        return hvcc
-    }
-    if len(demuxer.mp4out) > 0 {
-        out := make([]byte, len(demuxer.mp4out)+len(hvcc))
-        copy(out, demuxer.mp4out)
-        copy(out[len(demuxer.mp4out):], hvcc)
-        demuxer.mp4out = demuxer.mp4out[:0]
-        return out
+        return codec.NewLengthToAnnexBFilter(codec.CODECID_VIDEO_H264, avcc)
+    case *h265ExtraData:
+        if len(extra.hvccExtra.Arrays) == 0 {
+            return codec.NewLengthToAnnexBFilter(codec.CODECID_VIDEO_H265, nil)
+        }
+        hvcc, err := extra.hvccExtra.Encode()
+        if err != nil {
+            return nil, err
+        }
+        return codec.NewLengthToAnnexBFilter(codec.CODECID_VIDEO_H265, hvcc)
+    case *aacExtraData:
+        return codec.NewADTSAddFilter(extra.asc)
     }
-
-    out := extra.hvccExtra.ToNalus()
-    out = append(out, hvcc...)
-    return out
+    return nil, errors.New("must init extra data first")
 }
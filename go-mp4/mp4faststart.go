@@ -0,0 +1,347 @@
+package mp4
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "io"
+)
+
+// mdat后移时每次拷贝的数据大小
+const fastStartCopySize = 1024 * 1024
+
+type topLevelBox struct {
+    boxtype [4]byte
+    offset  int64
+    size    int64
+}
+
+// FastStart 把moov在mdat之后的mp4文件改写成moov在mdat之前, 方便边下边播
+// 输入可以是任意muxer生成的文件, moov已经在mdat之前的文件原样拷贝
+func FastStart(r io.ReadSeeker, w io.Writer) error {
+    boxes, err := scanTopLevelBoxes(r)
+    if err != nil {
+        return err
+    }
+    moovIdx, mdatIdx := -1, -1
+    for i, box := range boxes {
+        switch string(box.boxtype[:]) {
+        case "moov":
+            if moovIdx == -1 {
+                moovIdx = i
+            }
+        case "mdat":
+            if mdatIdx == -1 {
+                mdatIdx = i
+            }
+        }
+    }
+    if moovIdx == -1 {
+        return errors.New("mp4 faststart: moov box not found")
+    }
+    if mdatIdx == -1 || moovIdx < mdatIdx {
+        for _, box := range boxes {
+            if err = copyTopLevelBox(r, w, box); err != nil {
+                return err
+            }
+        }
+        return nil
+    }
+
+    moovBox := boxes[moovIdx]
+    if _, err = r.Seek(moovBox.offset, io.SeekStart); err != nil {
+        return err
+    }
+    moov, err := readBoxData(r, uint64(moovBox.size))
+    if err != nil {
+        return err
+    }
+    mdatStart := uint64(boxes[mdatIdx].offset)
+    moovStart := uint64(moovBox.offset)
+    moovEnd := uint64(moovBox.offset + moovBox.size)
+    newMoov, err := relocateMoov(moov, func(offset uint64, moovSize uint64) uint64 {
+        switch {
+        case offset < mdatStart:
+            return offset
+        case offset < moovStart:
+            return offset + moovSize
+        case offset >= moovEnd:
+            return offset + moovSize - uint64(moovBox.size)
+        default:
+            return offset
+        }
+    })
+    if err != nil {
+        return err
+    }
+
+    for i := 0; i < mdatIdx; i++ {
+        if err = copyTopLevelBox(r, w, boxes[i]); err != nil {
+            return err
+        }
+    }
+    if _, err = w.Write(newMoov); err != nil {
+        return err
+    }
+    for i := mdatIdx; i < len(boxes); i++ {
+        if i == moovIdx {
+            continue
+        }
+        if err = copyTopLevelBox(r, w, boxes[i]); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// moov插入到ftyp后面, free box和mdat一起后移
+func (muxer *Movmuxer) writeMoovFastStart() (err error) {
+    rws, ok := muxer.writer.(io.ReadWriteSeeker)
+    if !ok {
+        return errors.New("mp4 faststart need io.ReadWriteSeeker")
+    }
+    var end int64
+    if end, err = rws.Seek(0, io.SeekCurrent); err != nil {
+        return
+    }
+    return insertMoov(rws, int64(muxer.mdatOffset)-8, end, muxer.makeMoov())
+}
+
+// moov插入到insertPos, [insertPos, end)的数据后移, chunk offset同步调整
+func insertMoov(rws io.ReadWriteSeeker, insertPos, end int64, moov []byte) (err error) {
+    if moov, err = relocateMoov(moov, func(offset uint64, moovSize uint64) uint64 {
+        return offset + moovSize
+    }); err != nil {
+        return
+    }
+    if err = shiftFileData(rws, insertPos, end, int64(len(moov))); err != nil {
+        return
+    }
+    if _, err = rws.Seek(insertPos, io.SeekStart); err != nil {
+        return
+    }
+    if _, err = rws.Write(moov); err != nil {
+        return
+    }
+    _, err = rws.Seek(end+int64(len(moov)), io.SeekStart)
+    return
+}
+
+// moov前移后重新计算chunk offset, stco升级为co64会让moov变大, 需要迭代到moov大小不再变化
+func relocateMoov(moov []byte, remap func(offset uint64, moovSize uint64) uint64) ([]byte, error) {
+    moovSize := uint64(len(moov))
+    for i := 0; i < 8; i++ {
+        newMoov, err := rewriteChunkOffset(moov, func(offset uint64) uint64 {
+            return remap(offset, moovSize)
+        })
+        if err != nil {
+            return nil, err
+        }
+        if uint64(len(newMoov)) == moovSize {
+            return newMoov, nil
+        }
+        moovSize = uint64(len(newMoov))
+    }
+    return nil, errors.New("mp4 faststart: moov size does not converge")
+}
+
+// 递归处理moov/trak/mdia/minf/stbl, 重写其中的stco/co64和saio, 其余box原样保留
+func rewriteChunkOffset(data []byte, remap func(offset uint64) uint64) ([]byte, error) {
+    out := make([]byte, 0, len(data))
+    for len(data) > 0 {
+        basebox := BasicBox{}
+        hdrLen, err := basebox.Decode(bytes.NewReader(data))
+        if err != nil {
+            return nil, errBoxTruncated("moov")
+        }
+        size := basebox.Size
+        if size == 0 {
+            size = uint64(len(data))
+        }
+        if size < uint64(hdrLen) || size > uint64(len(data)) {
+            return nil, errBoxTruncated(string(basebox.Type[:]))
+        }
+        box := data[:size]
+        data = data[size:]
+        switch string(basebox.Type[:]) {
+        case "moov", "trak", "mdia", "minf", "stbl":
+            children, err := rewriteChunkOffset(box[hdrLen:], remap)
+            if err != nil {
+                return nil, err
+            }
+            if len(children)+8 > 0xFFFFFFFF {
+                return nil, errors.New("mp4 faststart: box too large")
+            }
+            hdr := make([]byte, 8)
+            binary.BigEndian.PutUint32(hdr, uint32(len(children)+8))
+            copy(hdr[4:], basebox.Type[:])
+            out = append(out, hdr...)
+            out = append(out, children...)
+        case "stco", "co64":
+            var stco *movstco
+            if basebox.Type[0] == 's' {
+                stcobox := ChunkOffsetBox{box: new(FullBox)}
+                if _, err = stcobox.Decode(bytes.NewReader(box[hdrLen:])); err != nil {
+                    return nil, errBoxTruncated("stco")
+                }
+                stco = stcobox.stco
+            } else {
+                co64box := ChunkLargeOffsetBox{box: new(FullBox)}
+                if _, err = co64box.Decode(bytes.NewReader(box[hdrLen:])); err != nil {
+                    return nil, errBoxTruncated("co64")
+                }
+                stco = co64box.stco
+            }
+            for i := range stco.chunkOffsetlist {
+                stco.chunkOffsetlist[i] = remap(stco.chunkOffsetlist[i])
+            }
+            out = append(out, makeStco(stco)...)
+        case "saio":
+            saio, err := remapSaio(box[hdrLen:], remap)
+            if err != nil {
+                return nil, err
+            }
+            out = append(out, saio...)
+        default:
+            out = append(out, box...)
+        }
+    }
+    return out, nil
+}
+
+// stbl中saio(CENC)的offset是文件中的绝对位置, 和chunk offset一起调整, 超过4GB时升级为version 1
+func remapSaio(payload []byte, remap func(offset uint64) uint64) ([]byte, error) {
+    if len(payload) < 4 {
+        return nil, errBoxTruncated("saio")
+    }
+    version := payload[0]
+    n := 4
+    if payload[3]&0x01 != 0 {
+        n += 8
+    }
+    if len(payload) < n+4 {
+        return nil, errBoxTruncated("saio")
+    }
+    entryCount := binary.BigEndian.Uint32(payload[n:])
+    n += 4
+    entrySize := uint64(4)
+    if version != 0 {
+        entrySize = 8
+    }
+    if uint64(entryCount)*entrySize > uint64(len(payload)-n) {
+        return nil, errBoxTruncated("saio")
+    }
+    offsets := make([]uint64, entryCount)
+    large := version != 0
+    for i := range offsets {
+        if version == 0 {
+            offsets[i] = remap(uint64(binary.BigEndian.Uint32(payload[n+4*i:])))
+        } else {
+            offsets[i] = remap(binary.BigEndian.Uint64(payload[n+8*i:]))
+        }
+        if offsets[i] > 0xFFFFFFFF {
+            large = true
+        }
+    }
+    out := make([]byte, 8, 8+n+len(offsets)*8)
+    copy(out[4:], "saio")
+    out = append(out, payload[:n]...)
+    buf := make([]byte, 8)
+    for _, offset := range offsets {
+        if large {
+            binary.BigEndian.PutUint64(buf, offset)
+            out = append(out, buf...)
+        } else {
+            binary.BigEndian.PutUint32(buf, uint32(offset))
+            out = append(out, buf[:4]...)
+        }
+    }
+    if large {
+        out[8] = 1
+    }
+    binary.BigEndian.PutUint32(out, uint32(len(out)))
+    return out, nil
+}
+
+// 扫描第一层box, size为0表示box一直到文件结束
+func scanTopLevelBoxes(r io.ReadSeeker) ([]topLevelBox, error) {
+    end, err := r.Seek(0, io.SeekEnd)
+    if err != nil {
+        return nil, err
+    }
+    return scanTopLevelBoxesUntil(r, end)
+}
+
+// 扫描[0, end)范围内的第一层box, 用于不支持SeekEnd的writer
+func scanTopLevelBoxesUntil(r io.ReadSeeker, end int64) ([]topLevelBox, error) {
+    var err error
+    var boxes []topLevelBox
+    offset := int64(0)
+    for offset+BasicBoxLen <= end {
+        if _, err = r.Seek(offset, io.SeekStart); err != nil {
+            return nil, err
+        }
+        basebox := BasicBox{}
+        hdrLen, err := basebox.Decode(r)
+        if err != nil {
+            return nil, err
+        }
+        size := basebox.Size
+        if size == 0 {
+            size = uint64(end - offset)
+        }
+        if size < uint64(hdrLen) || size > uint64(end-offset) {
+            return nil, errBoxTruncated(string(basebox.Type[:]))
+        }
+        boxes = append(boxes, topLevelBox{boxtype: basebox.Type, offset: offset, size: int64(size)})
+        offset += int64(size)
+    }
+    return boxes, nil
+}
+
+func copyTopLevelBox(r io.ReadSeeker, w io.Writer, box topLevelBox) error {
+    if _, err := r.Seek(box.offset, io.SeekStart); err != nil {
+        return err
+    }
+    _, err := io.CopyN(w, r, box.size)
+    return err
+}
+
+// [start, end)的数据后移delta个字节, 从后往前拷贝, 不会覆盖还没有拷贝的数据
+// 先在文件末尾补delta个字节, 有的writer不支持seek到文件末尾之后
+func shiftFileData(rws io.ReadWriteSeeker, start, end, delta int64) error {
+    buf := make([]byte, fastStartCopySize)
+    if _, err := rws.Seek(end, io.SeekStart); err != nil {
+        return err
+    }
+    for n := delta; n > 0; {
+        m := int64(len(buf))
+        if n < m {
+            m = n
+        }
+        if _, err := rws.Write(buf[:m]); err != nil {
+            return err
+        }
+        n -= m
+    }
+    for pos := end; pos > start; {
+        n := int64(len(buf))
+        if pos-start < n {
+            n = pos - start
+        }
+        pos -= n
+        if _, err := rws.Seek(pos, io.SeekStart); err != nil {
+            return err
+        }
+        if _, err := io.ReadFull(rws, buf[:n]); err != nil {
+            return err
+        }
+        if _, err := rws.Seek(pos+delta, io.SeekStart); err != nil {
+            return err
+        }
+        if _, err := rws.Write(buf[:n]); err != nil {
+            return err
+        }
+    }
+    return nil
+}
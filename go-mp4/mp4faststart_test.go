@@ -0,0 +1,203 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"testing"
+)
+
+func TestMuxFastStart(t *testing.T) {
+	normal := makeTestMp4(t, testMp4{})
+	faststart := makeTestMp4(t, testMp4{options: []MuxerOption{WithMp4Flag(MP4_FLAG_FASTSTART)}})
+	if len(faststart) != len(normal) {
+		t.Errorf("faststart size %d, normal size %d", len(faststart), len(normal))
+	}
+	checkRewrittenMp4(t, faststart, "ftyp moov free mdat ", normal)
+}
+
+func TestMuxFastStartNeedReader(t *testing.T) {
+	w := struct{ io.WriteSeeker }{newFmp4WriterSeeker(1024)}
+	if _, err := CreateMp4Muxer(w, WithMp4Flag(MP4_FLAG_FASTSTART)); err == nil {
+		t.Fatal("faststart with io.WriteSeeker should fail")
+	}
+}
+
+func TestFastStart(t *testing.T) {
+	normal := makeTestMp4(t, testMp4{})
+	out := rewriteTestMp4(t, func(w io.Writer) error { return FastStart(bytes.NewReader(normal), w) })
+	checkRewrittenMp4(t, out, "ftyp free moov mdat ", normal)
+
+	//已经是faststart的文件原样输出
+	again := rewriteTestMp4(t, func(w io.Writer) error { return FastStart(bytes.NewReader(out), w) })
+	if !bytes.Equal(again, out) {
+		t.Error("faststart file should be copied unchanged")
+	}
+
+	if err := FastStart(bytes.NewReader(normal[:32]), io.Discard); err == nil {
+		t.Error("file without moov should fail")
+	}
+}
+
+func TestRelocateMoovCo64(t *testing.T) {
+	normal := makeTestMp4(t, testMp4{})
+	boxes, err := scanTopLevelBoxes(bytes.NewReader(normal))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var moov []byte
+	for _, box := range boxes {
+		if string(box.boxtype[:]) == "moov" {
+			moov = normal[box.offset : box.offset+box.size]
+		}
+	}
+	var origin []uint64
+	if _, err = rewriteChunkOffset(moov, func(offset uint64) uint64 {
+		origin = append(origin, offset)
+		return offset
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	const base = 0xFFFFFFF0
+	newMoov, err := relocateMoov(moov, func(offset uint64, moovSize uint64) uint64 {
+		return offset + base + moovSize
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if bytes.Contains(newMoov, []byte("stco")) || !bytes.Contains(newMoov, []byte("co64")) {
+		t.Fatal("stco should be promoted to co64")
+	}
+	if len(newMoov) != len(moov)+4*len(origin) {
+		t.Fatalf("moov size %d, want %d", len(newMoov), len(moov)+4*len(origin))
+	}
+	i := 0
+	if _, err = rewriteChunkOffset(newMoov, func(offset uint64) uint64 {
+		if offset != origin[i]+base+uint64(len(newMoov)) {
+			t.Errorf("chunk %d offset %d, want %d", i, offset, origin[i]+base+uint64(len(newMoov)))
+		}
+		i++
+		return offset
+	}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// 模拟超过4GB的文件: [0, base)是一个largesize的skip box, 只保存后面写入的数据
+type sparseFile struct {
+	base   int64
+	header []byte
+	data   []byte
+	pos    int64
+}
+
+func newSparseFile(base int64) *sparseFile {
+	header := make([]byte, 16)
+	binary.BigEndian.PutUint32(header, 1)
+	copy(header[4:], "skip")
+	binary.BigEndian.PutUint64(header[8:], uint64(base))
+	return &sparseFile{base: base, header: header, pos: base}
+}
+
+func (f *sparseFile) Read(p []byte) (int, error) {
+	if f.pos >= f.base+int64(len(f.data)) {
+		return 0, io.EOF
+	}
+	n := 0
+	for n < len(p) && f.pos < f.base+int64(len(f.data)) {
+		switch {
+		case f.pos < int64(len(f.header)):
+			p[n] = f.header[f.pos]
+		case f.pos < f.base:
+			p[n] = 0
+		default:
+			p[n] = f.data[f.pos-f.base]
+		}
+		n++
+		f.pos++
+	}
+	return n, nil
+}
+
+func (f *sparseFile) Write(p []byte) (int, error) {
+	if f.pos < f.base {
+		return 0, errors.New("write before base")
+	}
+	if end := f.pos - f.base + int64(len(p)); end > int64(len(f.data)) {
+		f.data = append(f.data, make([]byte, end-int64(len(f.data)))...)
+	}
+	copy(f.data[f.pos-f.base:], p)
+	f.pos += int64(len(p))
+	return len(p), nil
+}
+
+func (f *sparseFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekCurrent:
+		offset += f.pos
+	case io.SeekEnd:
+		offset += f.base + int64(len(f.data))
+	}
+	f.pos = offset
+	return offset, nil
+}
+
+func TestMuxFastStartCo64(t *testing.T) {
+	normal := makeTestMp4(t, testMp4{})
+	boxes, err := scanTopLevelBoxes(bytes.NewReader(normal))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var last uint64
+	for _, box := range boxes {
+		if string(box.boxtype[:]) != "moov" {
+			continue
+		}
+		if _, err = rewriteChunkOffset(normal[box.offset:box.offset+box.size], func(offset uint64) uint64 {
+			if offset > last {
+				last = offset
+			}
+			return offset
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	//写完mdat时chunk offset还能用stco表示, moov插入到mdat之前以后超过4GB, 必须升级为co64
+	base := int64(0xFFFFFFFF - last)
+	f := newSparseFile(base)
+	writeTestMp4(t, f, testMp4{options: []MuxerOption{WithMp4Flag(MP4_FLAG_FASTSTART)}})
+	if bytes.Contains(f.data, []byte("stco")) || !bytes.Contains(f.data, []byte("co64")) {
+		t.Fatal("stco should be promoted to co64")
+	}
+	if _, err = f.Seek(0, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	checkSamePackets(t, readAllPacketsFrom(t, f), readAllPackets(t, normal))
+}
+
+func TestRewriteChunkOffsetSaio(t *testing.T) {
+	saio := NewFullBox([4]byte{'s', 'a', 'i', 'o'}, 0)
+	saio.Box.Size = 12 + 8
+	n, saioData := saio.Encode()
+	binary.BigEndian.PutUint32(saioData[n:], 1)
+	binary.BigEndian.PutUint32(saioData[n+4:], 1000)
+	moov := makeContainerBox("moov", makeContainerBox("trak", makeContainerBox("mdia", makeContainerBox("minf", makeContainerBox("stbl", saioData)))))
+	for _, delta := range []uint64{100, 0x100000000} {
+		out, err := rewriteChunkOffset(moov, func(offset uint64) uint64 { return offset + delta })
+		if err != nil {
+			t.Fatal(err)
+		}
+		//超过4GB时升级为version 1
+		i := bytes.Index(out, []byte("saio"))
+		got := uint64(binary.BigEndian.Uint32(out[i+12:]))
+		if out[i+4] == 1 {
+			got = binary.BigEndian.Uint64(out[i+12:])
+		}
+		if got != 1000+delta || (out[i+4] == 1) != (delta > 0xFFFFFFFF) {
+			t.Errorf("delta %d: saio version %d offset %d", delta, out[i+4], got)
+		}
+	}
+}
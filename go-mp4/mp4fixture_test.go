@@ -0,0 +1,176 @@
+package mp4
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/yapingcat/gomedia/go-codec"
+)
+
+// 测试用的H264+音频文件, 每帧40ms
+type testMp4 struct {
+	frames  int            //默认50帧
+	gop     int            //每gop帧一个IDR, 0表示全部是IDR
+	bframes bool           //P帧之后跟一个B帧, 输出ctts
+	audio   MP4_CODEC_TYPE //默认AAC, G711A/G711U每帧320字节
+	noAudio bool
+	crash   bool //不调用WriteTrailer, 模拟录制过程中程序退出
+	options []MuxerOption
+}
+
+func makeTestMp4(tb testing.TB, cfg testMp4) []byte {
+	ws := newFmp4WriterSeeker(1024 * 64)
+	writeTestMp4(tb, ws, cfg)
+	return ws.buffer
+}
+
+// crash为true时返回的muxer还没有调用WriteTrailer
+func writeTestMp4(tb testing.TB, w io.WriteSeeker, cfg testMp4) *Movmuxer {
+	if cfg.frames == 0 {
+		cfg.frames = 50
+	}
+	if cfg.audio == 0 {
+		cfg.audio = MP4_CODEC_AAC
+	}
+	gop := cfg.gop
+	if gop == 0 {
+		gop = 1
+		if cfg.bframes {
+			gop = cfg.frames
+		}
+	}
+	aac := []byte{0x21, 0x00, 0x49, 0x90, 0x02, 0x19}
+	adts, _ := codec.ConvertASCToADTS([]byte{0x12, 0x10}, len(aac)+7)
+	audio := append(adts.Encode(), aac...)
+	if cfg.audio != MP4_CODEC_AAC {
+		audio = bytes.Repeat([]byte{0xD5}, 320)
+	}
+
+	muxer, err := CreateMp4Muxer(w, cfg.options...)
+	if err != nil {
+		tb.Fatal(err)
+	}
+	vid := muxer.AddVideoTrack(MP4_CODEC_H264)
+	aid := uint32(0)
+	if !cfg.noAudio {
+		aid = muxer.AddAudioTrack(cfg.audio)
+	}
+	for i := 0; i < cfg.frames; i++ {
+		dts := uint64(i * 40)
+		pts := dts
+		frame := annexBNalus(bsfTestSps, bsfTestPps, []byte{0x65, 0x88, 0x84, 0x00, 0x10, byte(i)})
+		if j := i % gop; j != 0 {
+			frame = annexBNalus([]byte{0x41, 0x9A, 0x00, 0x10, byte(i)})
+			if cfg.bframes && j%2 == 0 {
+				frame = annexBNalus([]byte{0x01, 0x9E, 0x00, 0x10, byte(i)})
+			}
+		}
+		if cfg.bframes {
+			//解码顺序 I P B P B ... P, 显示时间整体延迟一帧
+			//P帧在后面的B帧之后显示, 没有B帧跟随时紧接着显示
+			switch j := i % gop; {
+			case j == 0:
+				pts = dts + 40
+			case j%2 == 1 && (j == gop-1 || i == cfg.frames-1):
+				pts = dts + 40
+			case j%2 == 1:
+				pts = dts + 80
+			}
+		}
+		if err = muxer.Write(vid, frame, pts, dts); err != nil {
+			tb.Fatal(err)
+		}
+		if !cfg.noAudio {
+			if err = muxer.Write(aid, audio, dts, dts); err != nil {
+				tb.Fatal(err)
+			}
+		}
+	}
+	if cfg.crash {
+		return muxer
+	}
+	if err = muxer.WriteTrailer(); err != nil {
+		tb.Fatal(err)
+	}
+	return muxer
+}
+
+func readAllPackets(t *testing.T, data []byte) []*AVPacket {
+	return readAllPacketsFrom(t, bytes.NewReader(data))
+}
+
+func readAllPacketsFrom(t *testing.T, r io.ReadSeeker) []*AVPacket {
+	demuxer := CreateMp4Demuxer(r)
+	if _, err := demuxer.ReadHead(); err != nil {
+		t.Fatal(err)
+	}
+	var pkgs []*AVPacket
+	for {
+		pkg, err := demuxer.ReadPacket()
+		if err == io.EOF {
+			return pkgs
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		pkgs = append(pkgs, pkg)
+	}
+}
+
+func topLevelBoxTypes(t *testing.T, data []byte) string {
+	boxes, err := scanTopLevelBoxes(bytes.NewReader(data))
+	if err != nil {
+		t.Fatal(err)
+	}
+	types := ""
+	for _, box := range boxes {
+		types += string(box.boxtype[:]) + " "
+	}
+	return types
+}
+
+// 转换结果写到内存, 失败时结束测试
+func rewriteTestMp4(t *testing.T, rewrite func(w io.Writer) error) []byte {
+	var out bytes.Buffer
+	if err := rewrite(&out); err != nil {
+		t.Fatal(err)
+	}
+	return out.Bytes()
+}
+
+// 检查top level box的顺序, 解出的packet和want完全一致
+func checkRewrittenMp4(t *testing.T, data []byte, types string, want []byte) {
+	if got := topLevelBoxTypes(t, data); got != types {
+		t.Fatalf("top level boxes %q, want %q", got, types)
+	}
+	checkSamePackets(t, readAllPackets(t, data), readAllPackets(t, want))
+}
+
+func checkSamePackets(t *testing.T, got, want []*AVPacket) {
+	if len(got) != len(want) {
+		t.Fatalf("got %d packets, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i].Cid != want[i].Cid || got[i].Pts != want[i].Pts || got[i].Dts != want[i].Dts || !bytes.Equal(got[i].Data, want[i].Data) {
+			t.Fatalf("packet %d mismatch", i)
+		}
+	}
+}
+
+func TestMakeTestMp4BFrames(t *testing.T) {
+	pkgs := readAllPackets(t, makeTestMp4(t, testMp4{gop: 10, bframes: true, noAudio: true}))
+	if len(pkgs) != 50 {
+		t.Fatalf("got %d packets", len(pkgs))
+	}
+	//显示顺序连续, 每帧40ms
+	seen := make(map[uint64]bool)
+	for i, pkg := range pkgs {
+		if pkg.Dts != uint64(i*40) || pkg.Pts < pkg.Dts || pkg.Pts%40 != 0 || seen[pkg.Pts] {
+			t.Fatalf("packet %d pts %d dts %d", i, pkg.Pts, pkg.Dts)
+		}
+		seen[pkg.Pts] = true
+	}
+	if pkgs[1].Pts != 120 || pkgs[2].Pts != 80 || pkgs[9].Pts != 400 || pkgs[10].Pts != 440 {
+		t.Errorf("unexpected composition offsets")
+	}
+}
@@ -0,0 +1,90 @@
+package mp4
+
+import (
+	"bytes"
+	"io"
+	"testing"
+
+	"github.com/yapingcat/gomedia/go-codec"
+)
+
+func makeTestFLACFrame(frameNum uint64, fill byte) []byte {
+	//blocksize 4608, 96000Hz, stereo, 24bit
+	head := &codec.FLACFrameHead{Block_size_code: 5, Sample_rate_code: 11, Channel_assignment: 1, Sample_size_code: 6, Coded_number: frameNum}
+	frame := append(head.Encode(), bytes.Repeat([]byte{fill}, 100)...)
+	var crc uint16
+	for _, b := range frame {
+		crc ^= uint16(b) << 8
+		for i := 0; i < 8; i++ {
+			if crc&0x8000 != 0 {
+				crc = crc<<1 ^ 0x8005
+			} else {
+				crc <<= 1
+			}
+		}
+	}
+	return append(frame, uint8(crc>>8), uint8(crc))
+}
+
+func TestMuxFLAC(t *testing.T) {
+	si := &codec.FLACStreamInfo{Min_block_size: 4608, Max_block_size: 4608, Sample_rate: 96000, Channels: 2, Bits_per_sample: 24}
+	vc := &codec.FLACVorbisComment{Vendor: "gomedia"}
+	stream := append([]byte("fLaC"), codec.EncodeFLACMetadataBlocks([]codec.FLACMetadataBlock{
+		{Block_type: codec.FLAC_METADATA_STREAMINFO, Data: si.Encode()},
+		{Block_type: codec.FLAC_METADATA_VORBIS_COMMENT, Data: vc.Encode()},
+		{Block_type: codec.FLAC_METADATA_PADDING, Data: make([]byte, 32)},
+	})...)
+	var frames [][]byte
+	for i := 0; i < 6; i++ {
+		frames = append(frames, makeTestFLACFrame(uint64(i), byte(i+1)))
+	}
+
+	ws := newFmp4WriterSeeker(1024 * 64)
+	muxer, err := CreateMp4Muxer(ws)
+	if err != nil {
+		t.Fatal(err)
+	}
+	tid := muxer.AddAudioTrack(MP4_CODEC_FLAC)
+	//第一次写入包含metadata和3帧, 后面每次写入一帧
+	first := append(append(append(append([]byte{}, stream...), frames[0]...), frames[1]...), frames[2]...)
+	if err = muxer.Write(tid, first, 0, 0); err != nil {
+		t.Fatal(err)
+	}
+	for i := 3; i < len(frames); i++ {
+		pts := uint64(i * 48)
+		if err = muxer.Write(tid, frames[i], pts, pts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err = muxer.WriteTrailer(); err != nil {
+		t.Fatal(err)
+	}
+
+	demuxer := CreateMp4Demuxer(bytes.NewReader(ws.buffer))
+	infos, err := demuxer.ReadHead()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(infos) != 1 || infos[0].Cid != MP4_CODEC_FLAC || infos[0].SampleRate != 96000 || infos[0].ChannelCount != 2 || infos[0].SampleSize != 24 {
+		t.Fatalf("ReadHead() = %+v", infos)
+	}
+	extra := demuxer.tracks[0].extra.(*flacExtraData)
+	blocks, _, err := codec.DecodeFLACMetadataBlocks(extra.export())
+	if err != nil || len(blocks) != 2 || blocks[1].Block_type != codec.FLAC_METADATA_VORBIS_COMMENT {
+		t.Fatalf("dfLa metadata blocks = %+v, %v", blocks, err)
+	}
+	for i := 0; ; i++ {
+		pkg, err := demuxer.ReadPacket()
+		if err == io.EOF {
+			if i != len(frames) {
+				t.Errorf("got %d packets, want %d", i, len(frames))
+			}
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		if pkg.Cid != MP4_CODEC_FLAC || !bytes.Equal(pkg.Data, frames[i]) || pkg.Pts != uint64(i*48) {
+			t.Errorf("packet %d cid %d pts %d", i, pkg.Cid, pkg.Pts)
+		}
+	}
+}
@@ -0,0 +1,691 @@
+package mp4
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+
+    "github.com/yapingcat/gomedia/go-codec"
+)
+
+type stblBoxDecoder interface {
+    Decode(r io.Reader) (int, error)
+}
+
+func decodeStblChild(box *convBox, decoder stblBoxDecoder) error {
+    if _, err := decoder.Decode(bytes.NewReader(box.payload())); err != nil {
+        return fmt.Errorf("mp4 %s box: %w", string(box.boxtype[:]), codec.ErrTruncated)
+    }
+    return nil
+}
+
+// 读取普通mp4 stbl中的sample信息
+func readProgressiveMp4(r io.ReadSeeker) (*convSource, error) {
+    src, _, err := readConvHead(r)
+    if err != nil {
+        return nil, err
+    }
+    mvex, err := findBoxPath(src.moov.payload(), "mvex")
+    if err != nil {
+        return nil, err
+    }
+    if mvex != nil {
+        return nil, errors.New("mp4 fragment: already a fragmented mp4")
+    }
+    for _, track := range src.tracks {
+        if err = track.readStbl(r); err != nil {
+            return nil, err
+        }
+    }
+    return src, nil
+}
+
+func (track *convTrack) readStbl(r io.ReadSeeker) error {
+    stbl, err := track.stblBox()
+    if err != nil {
+        return err
+    }
+    children, err := splitBoxes(stbl.payload())
+    if err != nil {
+        return err
+    }
+    stts := &TimeToSampleBox{box: new(FullBox)}
+    stsc := &SampleToChunkBox{box: new(FullBox)}
+    stsz := &SampleSizeBox{box: new(FullBox)}
+    var ctts *CompositionOffsetBox
+    var stss *SyncSampleBox
+    var chunks *movstco
+    var sdtp []byte
+    for i := range children {
+        child := &children[i]
+        switch {
+        case child.is("stts"):
+            err = decodeStblChild(child, stts)
+        case child.is("ctts"):
+            ctts = &CompositionOffsetBox{box: new(FullBox)}
+            err = decodeStblChild(child, ctts)
+        case child.is("stsc"):
+            err = decodeStblChild(child, stsc)
+        case child.is("stsz"):
+            err = decodeStblChild(child, stsz)
+        case child.is("stco"):
+            stco := &ChunkOffsetBox{box: new(FullBox)}
+            err = decodeStblChild(child, stco)
+            chunks = stco.stco
+        case child.is("co64"):
+            co64 := &ChunkLargeOffsetBox{box: new(FullBox)}
+            err = decodeStblChild(child, co64)
+            chunks = co64.stco
+        case child.is("stss"):
+            stss = &SyncSampleBox{box: new(FullBox)}
+            err = decodeStblChild(child, stss)
+        case child.is("sdtp"):
+            if len(child.payload()) < 4 {
+                return errBoxTruncated("sdtp")
+            }
+            sdtp = child.payload()[4:]
+        case child.is("stz2"):
+            return fmt.Errorf("mp4 stz2 box: %w", codec.ErrUnsupportedCodec)
+        }
+        if err != nil {
+            return err
+        }
+    }
+    if stts.entryList == nil || stsc.stscentrys == nil || stsz.stsz == nil || chunks == nil {
+        return fmt.Errorf("mp4 stbl box: %w: track %d missing sample table", codec.ErrInvalidData, track.trackId)
+    }
+
+    count := int(stsz.stsz.sampleCount)
+    //所有sample大小相同时没有办法根据box大小判断sample count是否合理
+    if stsz.stsz.sampleSize != 0 && count > maxTrunDefaultSamples {
+        return fmt.Errorf("mp4 stsz box: %w: sample count %d", codec.ErrInvalidData, count)
+    }
+    track.samples = make([]convSample, count)
+    for i := range track.samples {
+        if stsz.stsz.sampleSize != 0 {
+            track.samples[i].size = stsz.stsz.sampleSize
+        } else {
+            track.samples[i].size = stsz.stsz.entrySizelist[i]
+        }
+    }
+
+    idx := 0
+    dts := uint64(0)
+    for _, entry := range stts.entryList.entrys {
+        for j := uint32(0); j < entry.sampleCount && idx < count; j++ {
+            track.samples[idx].dts = dts
+            track.samples[idx].duration = entry.sampleDelta
+            dts += uint64(entry.sampleDelta)
+            idx++
+        }
+    }
+    if idx != count {
+        return fmt.Errorf("mp4 stts box: %w: %d samples, stsz has %d", codec.ErrInvalidData, idx, count)
+    }
+    track.nextDts = dts
+
+    if ctts != nil && ctts.ctts != nil {
+        idx = 0
+        for _, entry := range ctts.ctts.entrys {
+            for j := uint32(0); j < entry.sampleCount && idx < count; j++ {
+                track.samples[idx].cto = int32(entry.sampleOffset)
+                idx++
+            }
+        }
+    }
+
+    //没有stss表示所有sample都是关键帧
+    if stss != nil {
+        for i := range track.samples {
+            track.samples[i].flags = MOV_FRAG_SAMPLE_FLAG_IS_NON_SYNC
+        }
+        for _, number := range stss.entrys {
+            if number >= 1 && int(number) <= count {
+                track.samples[number-1].flags = 0
+            }
+        }
+    }
+    for i := 0; i < len(sdtp) && i < count; i++ {
+        track.samples[i].flags |= uint32(sdtp[i]) << 20
+    }
+
+    //根据stsc展开每个chunk
+    var runs []int
+    idx = 0
+    entrys := stsc.stscentrys.entrys
+    for i, entry := range entrys {
+        if entry.firstChunk == 0 {
+            return fmt.Errorf("mp4 stsc box: %w: first chunk is 0", codec.ErrInvalidData)
+        }
+        lastChunk := uint32(len(chunks.chunkOffsetlist))
+        if i+1 < len(entrys) {
+            lastChunk = entrys[i+1].firstChunk - 1
+        }
+        for chunk := entry.firstChunk; chunk <= lastChunk && idx < count; chunk++ {
+            if int(chunk) > len(chunks.chunkOffsetlist) {
+                return fmt.Errorf("mp4 stsc box: %w: chunk %d out of range", codec.ErrInvalidData, chunk)
+            }
+            offset := chunks.chunkOffsetlist[chunk-1]
+            n := 0
+            for ; n < int(entry.samplesPerChunk) && idx < count; n++ {
+                track.samples[idx].offset = offset
+                track.samples[idx].descIdx = entry.sampleDescriptionIndex
+                offset += uint64(track.samples[idx].size)
+                idx++
+            }
+            runs = append(runs, n)
+        }
+    }
+    if idx != count {
+        return fmt.Errorf("mp4 stsc box: %w: %d samples, stsz has %d", codec.ErrInvalidData, idx, count)
+    }
+
+    if saiz, saio := findBox(children, "saiz"), findBox(children, "saio"); saiz != nil && saio != nil {
+        sizes, err := parseSaizSizes(saiz)
+        if err != nil {
+            return err
+        }
+        offsets, err := parseSaioOffsets(saio)
+        if err != nil {
+            return err
+        }
+        aux, err := readAuxInfo(r, sizes, offsets, 0, runs)
+        if err != nil {
+            return err
+        }
+        if len(aux) != count {
+            return fmt.Errorf("mp4 saiz box: %w: %d aux info for %d samples", codec.ErrInvalidData, len(aux), count)
+        }
+        for i := range aux {
+            track.samples[i].aux = aux[i]
+        }
+    }
+    for i := range children {
+        if children[i].is("sbgp") {
+            if err = track.applySbgp(&children[i], 0, count); err != nil {
+                return err
+            }
+        }
+    }
+    track.padGroups()
+    return nil
+}
+
+type FragmentOption func(opt *fragmentOptions)
+
+type fragmentOptions struct {
+    interval uint32
+    sidx     bool
+    mfra     bool
+}
+
+// WithFragmentInterval fragment的最小时长(毫秒), 到达时长之后在下一个关键帧处切分
+// 默认每个关键帧切分一次
+func WithFragmentInterval(ms uint32) FragmentOption {
+    return func(opt *fragmentOptions) {
+        opt.interval = ms
+    }
+}
+
+// WithFragmentSidx 是否在第一个moof之前写入sidx, 默认写入
+func WithFragmentSidx(enable bool) FragmentOption {
+    return func(opt *fragmentOptions) {
+        opt.sidx = enable
+    }
+}
+
+// WithFragmentMfra 是否在文件最后写入mfra, 默认写入
+func WithFragmentMfra(enable bool) FragmentOption {
+    return func(opt *fragmentOptions) {
+        opt.mfra = enable
+    }
+}
+
+// 一个fragment中某个track的sample范围
+type fragTraf struct {
+    track      *convTrack
+    start, end int
+}
+
+type convFragment struct {
+    trafs  []fragTraf
+    moof   []byte
+    mdat   []byte //mdat头
+    offset uint64 //moof在输出文件中的位置
+}
+
+func (frag *convFragment) size() uint64 {
+    size := uint64(len(frag.moof) + len(frag.mdat))
+    for _, traf := range frag.trafs {
+        for _, sample := range traf.track.samples[traf.start:traf.end] {
+            size += uint64(sample.size)
+        }
+    }
+    return size
+}
+
+// Fragment 把普通mp4转换成fmp4, 输出ftyp moov [sidx] (moof mdat)... [mfra]
+// 以第一个视频track(没有视频时是第一个track)为参考, 在关键帧处切分fragment
+func Fragment(r io.ReadSeeker, w io.Writer, options ...FragmentOption) error {
+    opt := fragmentOptions{sidx: true, mfra: true}
+    for _, o := range options {
+        o(&opt)
+    }
+    src, err := readProgressiveMp4(r)
+    if err != nil {
+        return err
+    }
+    frags, err := splitFragments(src, opt.interval)
+    if err != nil {
+        return err
+    }
+    ref := frags[0].trafs[0].track
+
+    ftyp := makeConvFtyp(src.ftyp, mov_tag(iso5), []uint32{mov_tag(iso5), mov_tag(iso6), mov_tag(mp41)}, nil)
+    moov, err := makeFragmentMoov(src)
+    if err != nil {
+        return err
+    }
+    for i, frag := range frags {
+        if err = frag.build(uint32(i + 1)); err != nil {
+            return err
+        }
+    }
+    var sidx []byte
+    if opt.sidx {
+        if sidx, err = makeConvSidx(ref, frags); err != nil {
+            return err
+        }
+    }
+    offset := uint64(len(ftyp) + len(moov) + len(sidx))
+    for _, frag := range frags {
+        frag.offset = offset
+        offset += frag.size()
+    }
+
+    for _, data := range [][]byte{ftyp, moov, sidx} {
+        if _, err = w.Write(data); err != nil {
+            return err
+        }
+    }
+    for _, frag := range frags {
+        if _, err = w.Write(frag.moof); err != nil {
+            return err
+        }
+        if _, err = w.Write(frag.mdat); err != nil {
+            return err
+        }
+        for _, traf := range frag.trafs {
+            samples := make([]*convSample, 0, traf.end-traf.start)
+            for i := traf.start; i < traf.end; i++ {
+                samples = append(samples, &traf.track.samples[i])
+            }
+            if err = copySampleData(r, w, samples); err != nil {
+                return err
+            }
+        }
+    }
+    if opt.mfra {
+        mfra, err := makeConvMfra(src, frags)
+        if err != nil {
+            return err
+        }
+        if _, err = w.Write(mfra); err != nil {
+            return err
+        }
+    }
+    return nil
+}
+
+// 参考track在关键帧处切分, 其他track的sample按照dts分配到对应的fragment
+func splitFragments(src *convSource, intervalMs uint32) ([]*convFragment, error) {
+    var ref *convTrack
+    for _, track := range src.tracks {
+        if len(track.samples) == 0 {
+            continue
+        }
+        if ref == nil || (string(track.handler[:]) == "vide" && string(ref.handler[:]) != "vide") {
+            ref = track
+        }
+    }
+    if ref == nil {
+        return nil, errors.New("mp4 fragment: no sample found")
+    }
+    allSync := true
+    for i := range ref.samples {
+        allSync = allSync && ref.samples[i].isSync()
+    }
+    //全部是关键帧(比如音频)时没有时长限制会导致每个sample一个fragment
+    if allSync && intervalMs == 0 {
+        intervalMs = 1000
+    }
+    interval := rescaleTimescale(uint64(intervalMs), 1000, ref.timescale)
+    bounds := []uint64{ref.samples[0].dts}
+    starts := []int{0}
+    for i := 1; i < len(ref.samples); i++ {
+        if ref.samples[i].isSync() && ref.samples[i].dts-bounds[len(bounds)-1] >= interval {
+            bounds = append(bounds, ref.samples[i].dts)
+            starts = append(starts, i)
+        }
+    }
+    if len(bounds) > 0xFFFF {
+        return nil, fmt.Errorf("mp4 fragment: %w: too many fragments %d", codec.ErrUnsupportedCodec, len(bounds))
+    }
+
+    frags := make([]*convFragment, len(bounds))
+    for i := range frags {
+        frags[i] = &convFragment{}
+        end := len(ref.samples)
+        if i+1 < len(starts) {
+            end = starts[i+1]
+        }
+        frags[i].trafs = append(frags[i].trafs, fragTraf{track: ref, start: starts[i], end: end})
+    }
+    for _, track := range src.tracks {
+        if track == ref || len(track.samples) == 0 {
+            continue
+        }
+        start := 0
+        for k := range frags {
+            end := len(track.samples)
+            if k+1 < len(bounds) {
+                //dts换算到参考track的时间单位比较
+                end = start
+                for end < len(track.samples) && rescaleTimescale(track.samples[end].dts, track.timescale, ref.timescale) < bounds[k+1] {
+                    end++
+                }
+            }
+            if end > start {
+                frags[k].trafs = append(frags[k].trafs, fragTraf{track: track, start: start, end: end})
+            }
+            start = end
+        }
+    }
+    return frags, nil
+}
+
+// 生成moof, sample数据在mdat中按照traf的顺序存放
+func (frag *convFragment) build(sequence uint32) error {
+    dataSize := uint64(0)
+    for _, traf := range frag.trafs {
+        for _, sample := range traf.track.samples[traf.start:traf.end] {
+            dataSize += uint64(sample.size)
+        }
+    }
+    frag.mdat = makeMdatHeader(dataSize)
+    //data offset依赖moof的大小, 第一次只计算大小
+    moofSize := uint64(0)
+    for pass := 0; pass < 2; pass++ {
+        mfhd := makeMfhdBox(sequence)
+        children := [][]byte{mfhd}
+        pos := uint64(8 + len(mfhd))
+        dataPos := moofSize + uint64(len(frag.mdat))
+        for _, traf := range frag.trafs {
+            trafData, err := makeConvTraf(traf, dataPos, pos)
+            if err != nil {
+                return err
+            }
+            children = append(children, trafData)
+            pos += uint64(len(trafData))
+            for _, sample := range traf.track.samples[traf.start:traf.end] {
+                dataPos += uint64(sample.size)
+            }
+        }
+        if dataPos > 0x7FFFFFFF {
+            return fmt.Errorf("mp4 fragment: %w: fragment size %d", codec.ErrUnsupportedCodec, dataPos)
+        }
+        frag.moof = makeContainerBox("moof", children...)
+        moofSize = uint64(len(frag.moof))
+    }
+    return nil
+}
+
+// dataOffset是sample数据相对moof的位置, trafPos是traf相对moof的位置
+func makeConvTraf(traf fragTraf, dataOffset uint64, trafPos uint64) ([]byte, error) {
+    track := traf.track
+    samples := track.samples[traf.start:traf.end]
+    descIdx := samples[0].descIdx
+    for i := range samples {
+        if samples[i].descIdx != descIdx {
+            return nil, fmt.Errorf("mp4 fragment: %w: sample description changes in fragment", codec.ErrUnsupportedCodec)
+        }
+    }
+
+    tfFlags := TF_FLAG_DEAAULT_BASE_IS_MOOF
+    tfhd := NewTrackFragmentHeaderBox(track.trackId)
+    if descIdx != 1 && descIdx != 0 {
+        tfFlags |= TF_FLAG_SAMPLE_DESCRIPTION_INDEX_PRESENT
+        tfhd.SampleDescriptionIndex = descIdx
+    }
+    tfhd.Box.Flags[0] = uint8(tfFlags >> 16)
+    tfhd.Box.Flags[1] = uint8(tfFlags >> 8)
+    tfhd.Box.Flags[2] = uint8(tfFlags)
+    _, tfhdData := tfhd.Encode()
+
+    _, tfdtData := NewTrackFragmentBaseMediaDecodeTimeBox(samples[0].dts).Encode()
+
+    trFlags := TR_FLAG_DATA_OFFSET | TR_FLAG_DATA_SAMPLE_DURATION | TR_FLAG_DATA_SAMPLE_SIZE | TR_FLAG_DATA_SAMPLE_FLAGS
+    trun := NewTrackRunBox()
+    trun.Box.Version = 0
+    trun.SampleCount = uint32(len(samples))
+    trun.Dataoffset = int32(dataOffset)
+    trun.EntryList = &movtrun{entrys: make([]trunEntry, len(samples))}
+    for i := range samples {
+        trun.EntryList.entrys[i] = trunEntry{
+            sampleDuration:              samples[i].duration,
+            sampleSize:                  samples[i].size,
+            sampleFlags:                 samples[i].flags,
+            sampleCompositionTimeOffset: uint32(samples[i].cto),
+        }
+        if samples[i].cto != 0 {
+            trFlags |= TR_FLAG_DATA_SAMPLE_COMPOSITION_TIME
+        }
+        //负数的composition offset需要version 1
+        if samples[i].cto < 0 {
+            trun.Box.Version = 1
+        }
+    }
+    trun.Box.Flags[0] = uint8(trFlags >> 16)
+    trun.Box.Flags[1] = uint8(trFlags >> 8)
+    trun.Box.Flags[2] = uint8(trFlags)
+    _, trunData := trun.Encode()
+
+    children := [][]byte{tfhdData, tfdtData, trunData}
+    if samples[0].aux != nil {
+        senc, err := makeConvSenc(track, samples)
+        if err != nil {
+            return nil, err
+        }
+        saiz, err := makeSaizBox(senc.aux)
+        if err != nil {
+            return nil, err
+        }
+        pos := trafPos + 8
+        for _, child := range children {
+            pos += uint64(len(child))
+        }
+        //saio指向senc中第一个sample的数据
+        auxPos := pos + uint64(len(saiz)) + uint64(len(makeSaioBox(0))) + 16
+        children = append(children, saiz, makeSaioBox(auxPos), senc.data)
+    }
+    for _, g := range track.groups {
+        children = append(children, makeSbgpBox(g, g.index[traf.start:traf.end]))
+    }
+    return makeContainerBox("traf", children...), nil
+}
+
+type convSenc struct {
+    data []byte
+    aux  [][]byte //senc中每个sample的数据, 和saiz对应
+}
+
+func makeConvSenc(track *convTrack, samples []convSample) (*convSenc, error) {
+    if track.ivSize < 0 {
+        return nil, fmt.Errorf("mp4 fragment: %w: aux info without tenc", codec.ErrUnsupportedCodec)
+    }
+    subsample := false
+    for i := range samples {
+        if samples[i].aux == nil {
+            return nil, fmt.Errorf("mp4 fragment: %w: sample without aux info", codec.ErrInvalidData)
+        }
+        if len(samples[i].aux) < track.ivSize {
+            return nil, fmt.Errorf("mp4 fragment: %w: aux info size %d", codec.ErrInvalidData, len(samples[i].aux))
+        }
+        subsample = subsample || len(samples[i].aux) > track.ivSize
+    }
+    senc := &convSenc{aux: make([][]byte, len(samples))}
+    size := 16
+    for i := range samples {
+        senc.aux[i] = samples[i].aux
+        //有subsample时每个sample都要有subsample_count
+        if subsample && len(samples[i].aux) == track.ivSize {
+            senc.aux[i] = append(append([]byte{}, samples[i].aux...), 0, 0)
+        }
+        size += len(senc.aux[i])
+    }
+    box := NewFullBox([4]byte{'s', 'e', 'n', 'c'}, 0)
+    if subsample {
+        box.Flags[2] = uint8(UseSubsampleEncryption)
+    }
+    box.Box.Size = uint64(size)
+    n, buf := box.Encode()
+    binary.BigEndian.PutUint32(buf[n:], uint32(len(samples)))
+    n += 4
+    for _, aux := range senc.aux {
+        n += copy(buf[n:], aux)
+    }
+    senc.data = buf
+    return senc, nil
+}
+
+// moov中的stbl只保留stsd和sgpd, 增加mvex
+func makeFragmentMoov(src *convSource) ([]byte, error) {
+    movieTimescale, err := src.movieTimescale()
+    if err != nil {
+        return nil, err
+    }
+    fragmentDuration := uint64(0)
+    traks := make([][]byte, 0, len(src.tracks))
+    trexs := make([][]byte, 0, len(src.tracks))
+    for _, track := range src.tracks {
+        stbl, err := track.stblBox()
+        if err != nil {
+            return nil, err
+        }
+        stsd, sgpd, err := keepStblBoxes(stbl)
+        if err != nil {
+            return nil, err
+        }
+        boxes := append([][]byte{}, stsd...)
+        boxes = append(boxes, makeStts(&movstts{}), makeStsc(&movstsc{}), makeStsz(&movstsz{}), makeStco(&movstco{}))
+        boxes = append(boxes, sgpd...)
+        trakBoxes, err := splitBoxes(track.trak)
+        if err != nil {
+            return nil, err
+        }
+        trak, err := rewriteTrak(&trakBoxes[0], makeContainerBox("stbl", boxes...), nil, nil)
+        if err != nil {
+            return nil, err
+        }
+        traks = append(traks, trak)
+        trex := NewTrackExtendsBox(track.trackId)
+        trex.DefaultSampleDescriptionIndex = 1
+        _, trexData := trex.Encode()
+        trexs = append(trexs, trexData)
+        if duration := rescaleTimescale(track.mediaDuration(), track.timescale, movieTimescale); duration > fragmentDuration {
+            fragmentDuration = duration
+        }
+    }
+
+    mehd := NewFullBox([4]byte{'m', 'e', 'h', 'd'}, 1)
+    mehd.Box.Size = 12 + 8
+    n, mehdData := mehd.Encode()
+    binary.BigEndian.PutUint64(mehdData[n:], fragmentDuration)
+    mvex := makeContainerBox("mvex", append([][]byte{mehdData}, trexs...)...)
+
+    trakIdx := 0
+    moov, err := rewriteContainer(src.moov, func(child *convBox) ([]byte, error) {
+        if child.is("trak") {
+            trakIdx++
+            return traks[trakIdx-1], nil
+        }
+        return child.data, nil
+    })
+    if err != nil {
+        return nil, err
+    }
+    return makeContainerBox("moov", moov[8:], mvex), nil
+}
+
+// 一个sidx引用所有的fragment
+func makeConvSidx(ref *convTrack, frags []*convFragment) ([]byte, error) {
+    sidx := NewSegmentIndexBox()
+    sidx.ReferenceID = ref.trackId
+    sidx.TimeScale = ref.timescale
+    first := ref.samples[0]
+    sidx.EarliestPresentationTime = uint64(int64(first.dts) + int64(first.cto))
+    sidx.ReferenceCount = uint16(len(frags))
+    for _, frag := range frags {
+        traf := frag.trafs[0]
+        duration := uint64(0)
+        for _, sample := range ref.samples[traf.start:traf.end] {
+            duration += uint64(sample.duration)
+        }
+        size := frag.size()
+        if size > 0x7FFFFFFF || duration > 0xFFFFFFFF {
+            return nil, fmt.Errorf("mp4 sidx box: %w: fragment too large", codec.ErrUnsupportedCodec)
+        }
+        sidx.Entrys = append(sidx.Entrys, sidxEntry{
+            ReferencedSize:     uint32(size),
+            SubsegmentDuration: uint32(duration),
+            StartsWithSAP:      1,
+            SAPType:            1,
+        })
+    }
+    _, data := sidx.Encode()
+    return data, nil
+}
+
+// 每个track一个tfra, 记录以关键帧开始的fragment
+func makeConvMfra(src *convSource, frags []*convFragment) ([]byte, error) {
+    var boxes [][]byte
+    for _, track := range src.tracks {
+        tfra := NewTrackFragmentRandomAccessBox(track.trackId)
+        tfra.FragEntrys = new(movtfra)
+        var trafNumbers []int
+        for _, frag := range frags {
+            for i, traf := range frag.trafs {
+                if traf.track != track || !track.samples[traf.start].isSync() {
+                    continue
+                }
+                sample := track.samples[traf.start]
+                tfra.FragEntrys.frags = append(tfra.FragEntrys.frags, fragEntry{
+                    time:       uint64(int64(sample.dts) + int64(sample.cto)),
+                    moofOffset: frag.offset,
+                })
+                trafNumbers = append(trafNumbers, i+1)
+            }
+        }
+        if len(trafNumbers) == 0 {
+            continue
+        }
+        tfra.NumberOfEntry = uint32(len(trafNumbers))
+        _, data := tfra.Encode()
+        //Encode中traf_number/trun_number/sample_number固定为1
+        for i, number := range trafNumbers {
+            if number > 0xFF {
+                return nil, fmt.Errorf("mp4 tfra box: %w: traf number %d", codec.ErrUnsupportedCodec, number)
+            }
+            data[12+12+i*19+16] = uint8(number)
+        }
+        boxes = append(boxes, data)
+    }
+    size := 8 + 16
+    for _, box := range boxes {
+        size += len(box)
+    }
+    _, mfro := NewMovieFragmentRandomAccessOffsetBox(uint32(size)).Encode()
+    return makeContainerBox("mfra", append(boxes, mfro)...), nil
+}
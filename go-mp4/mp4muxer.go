@@ -1,7 +1,9 @@
 package mp4
 
 import (
+    "bytes"
     "encoding/binary"
+    "errors"
     "io"
 )
 
@@ -9,10 +11,12 @@ type MP4_FLAG uint32
 
 //ffmpeg movenc.h
 const (
-    MP4_FLAG_FRAGMENT MP4_FLAG = (1 << 1)
-    MP4_FLAG_KEYFRAME MP4_FLAG = (1 << 3)
-    MP4_FLAG_CUSTOM   MP4_FLAG = (1 << 5)
-    MP4_FLAG_DASH     MP4_FLAG = (1 << 11)
+    MP4_FLAG_FRAGMENT  MP4_FLAG = (1 << 1)
+    MP4_FLAG_KEYFRAME  MP4_FLAG = (1 << 3)
+    MP4_FLAG_CUSTOM    MP4_FLAG = (1 << 5)
+    MP4_FLAG_FASTSTART MP4_FLAG = (1 << 7)
+    MP4_FLAG_CRASHSAFE MP4_FLAG = (1 << 9)
+    MP4_FLAG_DASH      MP4_FLAG = (1 << 11)
 )
 
 func (f MP4_FLAG) has(ff MP4_FLAG) bool {
@@ -27,6 +31,14 @@ func (f MP4_FLAG) isDash() bool {
     return (f & MP4_FLAG_DASH) != 0
 }
 
+func (f MP4_FLAG) isFastStart() bool {
+    return (f & MP4_FLAG_FASTSTART) != 0
+}
+
+func (f MP4_FLAG) isCrashSafe() bool {
+    return (f & MP4_FLAG_CRASHSAFE) != 0
+}
+
 type OnFragment func(duration uint32, firstPts, firstDts uint64)
 type Movmuxer struct {
     writer         io.WriteSeeker
@@ -37,6 +49,10 @@ type Movmuxer struct {
     movFlag        MP4_FLAG
     onNewFragment  OnFragment
     fragDuration   uint32
+    recoveryIndex  io.Writer
+    indexedSamples map[uint32]int
+    indexHeader    bool
+    mehdOffset     int64 //crash safe模式下mehd中fragment_duration在文件中的位置
 }
 
 type MuxerOption func(muxer *Movmuxer)
@@ -47,6 +63,14 @@ func WithMp4Flag(f MP4_FLAG) MuxerOption {
     }
 }
 
+// WithFragmentDuration fragment时长(毫秒)超过duration就输出, 不用等到下一个关键帧
+// 适用于纯音频或者GOP很长的录制, 0表示只在关键帧切分
+func WithFragmentDuration(duration uint32) MuxerOption {
+    return func(muxer *Movmuxer) {
+        muxer.fragDuration = duration
+    }
+}
+
 func CreateMp4Muxer(w io.WriteSeeker, options ...MuxerOption) (*Movmuxer, error) {
     muxer := &Movmuxer{
         writer:         w,
@@ -60,7 +84,22 @@ func CreateMp4Muxer(w io.WriteSeeker, options ...MuxerOption) (*Movmuxer, error)
         opt(muxer)
     }
 
+    if muxer.movFlag.isCrashSafe() {
+        if muxer.movFlag.isDash() {
+            return nil, errors.New("mp4 crash safe mode not support dash")
+        }
+        //结束时需要读出fragment的数据改写成普通mp4
+        if _, ok := w.(io.ReadWriteSeeker); !ok {
+            return nil, errors.New("mp4 crash safe mode need io.ReadWriteSeeker")
+        }
+        muxer.movFlag |= MP4_FLAG_FRAGMENT
+    }
+
     if !muxer.movFlag.isFragment() && !muxer.movFlag.isDash() {
+        //faststart需要把mdat读出来后移
+        if _, ok := w.(io.ReadWriteSeeker); muxer.movFlag.isFastStart() && !ok {
+            return nil, errors.New("mp4 faststart need io.ReadWriteSeeker")
+        }
         ftyp := NewFileTypeBox()
         ftyp.Major_brand = mov_tag(isom)
         ftyp.Minor_version = 0x200
@@ -169,9 +208,23 @@ func (muxer *Movmuxer) Write(track uint32, data []byte, pts uint64, dts uint64)
     }
 
     if !muxer.movFlag.isFragment() && !muxer.movFlag.isDash() {
+        if muxer.recoveryIndex != nil && muxer.pendingIndexSamples() >= recoveryCheckpointSamples {
+            return muxer.Checkpoint()
+        }
         return err
     }
 
+    if muxer.fragDuration > 0 && mp4track.duration >= muxer.fragDuration {
+        duration := mp4track.duration
+        if err = muxer.flushFragment(); err != nil {
+            return err
+        }
+        if muxer.onNewFragment != nil {
+            muxer.onNewFragment(duration, mp4track.startPts, mp4track.startDts)
+        }
+        return nil
+    }
+
     if isAudio(mp4track.cid) {
         return nil
     }
@@ -216,11 +269,17 @@ func (muxer *Movmuxer) WriteTrailer() (err error) {
                 muxer.onNewFragment(track.duration, track.startPts, track.startPts)
             }
         }
+        if muxer.movFlag.isCrashSafe() {
+            return muxer.defragment()
+        }
         return muxer.writeMfra()
     default:
         if err = muxer.reWriteMdatSize(); err != nil {
             return err
         }
+        if muxer.movFlag.isFastStart() {
+            return muxer.writeMoovFastStart()
+        }
         return muxer.writeMoov(muxer.writer)
     }
     return
@@ -279,6 +338,11 @@ func (muxer *Movmuxer) reWriteMdatSize() (err error) {
 }
 
 func (muxer *Movmuxer) writeMoov(w io.Writer) (err error) {
+    _, err = w.Write(muxer.makeMoov())
+    return
+}
+
+func (muxer *Movmuxer) makeMoov() []byte {
     var mvhd []byte
     var mvex []byte
     if muxer.movFlag.isDash() || muxer.movFlag.isFragment() {
@@ -310,8 +374,7 @@ func (muxer *Movmuxer) writeMoov(w io.Writer) (err error) {
         offset += len(trak)
     }
     copy(moovBox[offset:], mvex)
-    _, err = w.Write(moovBox)
-    return
+    return moovBox
 }
 
 func (muxer *Movmuxer) writeMfra() (err error) {
@@ -352,7 +415,16 @@ func (muxer *Movmuxer) flushFragment() (err error) {
             if err != nil {
                 return err
             }
-            muxer.writeMoov(muxer.writer)
+            moov := muxer.makeMoov()
+            if muxer.movFlag.isCrashSafe() {
+                if muxer.mehdOffset, err = muxer.writer.Seek(0, io.SeekCurrent); err != nil {
+                    return err
+                }
+                muxer.mehdOffset += int64(bytes.LastIndex(moov, []byte("mehd"))) + 8
+            }
+            if _, err = muxer.writer.Write(moov); err != nil {
+                return err
+            }
         }
     }
 
@@ -448,6 +520,9 @@ func (muxer *Movmuxer) flushFragment() (err error) {
                 lastDts:  lastDts,
             }
             muxer.tracks[i].fragments = append(muxer.tracks[i].fragments, frag)
+            if muxer.movFlag.isCrashSafe() {
+                muxer.tracks[i].recordSamples(uint64(moofOffset) + uint64(len(moofBox)) + 8)
+            }
         }
         ws := muxer.tracks[i].writer.(*fmp4WriterSeeker)
         _, err = muxer.writer.Write(ws.buffer)
@@ -458,5 +533,8 @@ func (muxer *Movmuxer) flushFragment() (err error) {
         ws.offset = 0
         muxer.tracks[i].clearSamples()
     }
+    if muxer.movFlag.isCrashSafe() {
+        return muxer.updateMoovSnapshot()
+    }
     return nil
 }
@@ -0,0 +1,868 @@
+package mp4
+
+import (
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+    "math/bits"
+    "sort"
+
+    "github.com/yapingcat/gomedia/go-codec"
+    "github.com/yapingcat/gomedia/go-timebase"
+)
+
+// 录制中断(没有调用WriteTrailer)的mp4文件只有mdat没有moov, 有两种恢复方式
+// 1. muxer通过WithRecoveryIndex定期保存sample索引, 恢复时精确还原索引中的sample
+// 2. 扫描mdat, 根据AVCC格式识别H264/H265的access unit, 视频帧之间的数据作为音频:
+//    G711按照20ms切分, AAC根据raw_data_block开头/结尾的特征和平均帧长切分,
+//    时间戳根据帧率/采样率估算, 不能还原B帧的pts
+// 两种方式可以结合使用, 索引之后还没有保存的部分通过扫描恢复
+
+const (
+    recoveryIndexMagic   = "GMRI"
+    recoveryIndexVersion = 1
+
+    //每写入多少个sample保存一次索引
+    recoveryCheckpointSamples = 64
+
+    recoveryTrackRecord      = 'T'
+    recoverySampleRecord     = 'S'
+    recoveryTrackRecordLen   = 27
+    recoverySampleRecordLen  = 34
+    recoverMaxNaluSize       = 1 << 24
+    recoverDefaultFrameDelta = 40
+    recoverScanWindow        = 1024 * 1024
+)
+
+// WithRecoveryIndex 录制过程中定期把sample索引写到w(一般是一个单独的文件),
+// 程序异常退出没有调用WriteTrailer时, 通过RecoverMp4+WithRecoverIndex恢复
+// 只对非fragment的mp4有效, 正常WriteTrailer之后索引就不需要了
+func WithRecoveryIndex(w io.Writer) MuxerOption {
+    return func(muxer *Movmuxer) {
+        muxer.recoveryIndex = w
+        muxer.indexedSamples = make(map[uint32]int)
+    }
+}
+
+// Checkpoint 把还没有保存的sample索引写入WithRecoveryIndex指定的writer
+// 视频的最后一帧缓存在muxer中, 写入下一帧之后才会出现在索引里
+func (muxer *Movmuxer) Checkpoint() error {
+    if muxer.recoveryIndex == nil {
+        return nil
+    }
+    var buf []byte
+    if !muxer.indexHeader {
+        buf = append(buf, recoveryIndexMagic...)
+        buf = append(buf, recoveryIndexVersion)
+    }
+    for id := uint32(1); id < muxer.nextTrackId; id++ {
+        track := muxer.tracks[id]
+        indexed, found := muxer.indexedSamples[id]
+        if len(track.samplelist) <= indexed {
+            continue
+        }
+        if !found {
+            buf = appendRecoveryTrack(buf, track)
+        }
+        for _, sample := range track.samplelist[indexed:] {
+            buf = appendRecoverySample(buf, id, sample)
+        }
+        muxer.indexedSamples[id] = len(track.samplelist)
+    }
+    if len(buf) == 0 {
+        return nil
+    }
+    if _, err := muxer.recoveryIndex.Write(buf); err != nil {
+        return err
+    }
+    muxer.indexHeader = true
+    return nil
+}
+
+func (muxer *Movmuxer) pendingIndexSamples() int {
+    pending := 0
+    for id, track := range muxer.tracks {
+        pending += len(track.samplelist) - muxer.indexedSamples[id]
+    }
+    return pending
+}
+
+func appendRecoveryTrack(buf []byte, track *mp4track) []byte {
+    extra := track.extraData
+    if len(extra) == 0 && track.extra != nil {
+        extra = track.extra.export()
+    }
+    rec := make([]byte, recoveryTrackRecordLen)
+    rec[0] = recoveryTrackRecord
+    binary.BigEndian.PutUint32(rec[1:], track.trackId)
+    binary.BigEndian.PutUint32(rec[5:], uint32(track.cid))
+    binary.BigEndian.PutUint32(rec[9:], track.width)
+    binary.BigEndian.PutUint32(rec[13:], track.height)
+    binary.BigEndian.PutUint32(rec[17:], track.sampleRate)
+    rec[21] = track.chanelCount
+    rec[22] = track.sampleBits
+    binary.BigEndian.PutUint32(rec[23:], uint32(len(extra)))
+    buf = append(buf, rec...)
+    return append(buf, extra...)
+}
+
+func appendRecoverySample(buf []byte, trackId uint32, sample sampleEntry) []byte {
+    rec := make([]byte, recoverySampleRecordLen)
+    rec[0] = recoverySampleRecord
+    binary.BigEndian.PutUint32(rec[1:], trackId)
+    binary.BigEndian.PutUint64(rec[5:], sample.offset)
+    binary.BigEndian.PutUint32(rec[13:], uint32(sample.size))
+    binary.BigEndian.PutUint64(rec[17:], sample.pts)
+    binary.BigEndian.PutUint64(rec[25:], sample.dts)
+    if sample.isKeyFrame {
+        rec[33] = 1
+    }
+    return append(buf, rec...)
+}
+
+type recoverSample struct {
+    track      *mp4track
+    offset     uint64
+    size       uint64
+    pts        uint64
+    dts        uint64
+    //索引中记录的sample, isKeyFrame有效, 扫描得到的sample由muxer根据nalu类型判断
+    fromIndex  bool
+    isKeyFrame bool
+}
+
+// 解析索引, 最后一条记录可能不完整, 直接丢弃
+func readRecoveryIndex(r io.Reader) ([]*mp4track, []recoverSample, error) {
+    data, err := io.ReadAll(r)
+    if err != nil {
+        return nil, nil, err
+    }
+    if len(data) < 5 || string(data[:4]) != recoveryIndexMagic {
+        return nil, nil, fmt.Errorf("mp4 recovery index: %w", codec.ErrInvalidData)
+    }
+    if data[4] != recoveryIndexVersion {
+        return nil, nil, fmt.Errorf("mp4 recovery index version %d: %w", data[4], codec.ErrInvalidData)
+    }
+    data = data[5:]
+    var tracks []*mp4track
+    var samples []recoverSample
+    trackMap := make(map[uint32]*mp4track)
+    for len(data) > 0 {
+        switch data[0] {
+        case recoveryTrackRecord:
+            if len(data) < recoveryTrackRecordLen {
+                return tracks, samples, nil
+            }
+            extraLen := binary.BigEndian.Uint32(data[23:])
+            if uint64(extraLen) > uint64(len(data)-recoveryTrackRecordLen) {
+                return tracks, samples, nil
+            }
+            track := newmp4track(MP4_CODEC_TYPE(binary.BigEndian.Uint32(data[5:])), nil)
+            track.trackId = binary.BigEndian.Uint32(data[1:])
+            track.width = binary.BigEndian.Uint32(data[9:])
+            track.height = binary.BigEndian.Uint32(data[13:])
+            track.sampleRate = binary.BigEndian.Uint32(data[17:])
+            track.chanelCount = data[21]
+            track.sampleBits = data[22]
+            track.extraData = append([]byte{}, data[recoveryTrackRecordLen:recoveryTrackRecordLen+int(extraLen)]...)
+            if _, found := trackMap[track.trackId]; !found {
+                tracks = append(tracks, track)
+                trackMap[track.trackId] = track
+            }
+            data = data[recoveryTrackRecordLen+int(extraLen):]
+        case recoverySampleRecord:
+            if len(data) < recoverySampleRecordLen {
+                return tracks, samples, nil
+            }
+            track, found := trackMap[binary.BigEndian.Uint32(data[1:])]
+            if !found {
+                return nil, nil, fmt.Errorf("mp4 recovery index sample without track: %w", codec.ErrInvalidData)
+            }
+            samples = append(samples, recoverSample{
+                track:  track,
+                offset: binary.BigEndian.Uint64(data[5:]),
+                size:   uint64(binary.BigEndian.Uint32(data[13:])),
+                pts:    binary.BigEndian.Uint64(data[17:]),
+                dts:    binary.BigEndian.Uint64(data[25:]),
+
+                fromIndex:  true,
+                isKeyFrame: data[33] == 1,
+            })
+            data = data[recoverySampleRecordLen:]
+        default:
+            return nil, nil, fmt.Errorf("mp4 recovery index record %d: %w", data[0], codec.ErrInvalidData)
+        }
+    }
+    return tracks, samples, nil
+}
+
+type RecoverOption func(rc *mp4Recover)
+
+// WithRecoverIndex muxer通过WithRecoveryIndex保存的索引
+func WithRecoverIndex(r io.Reader) RecoverOption {
+    return func(rc *mp4Recover) {
+        rc.index = r
+    }
+}
+
+// WithRecoverReference 同一个设备/配置录制的完整mp4文件, 用来获取track信息, extradata, 帧率和AAC平均帧长
+func WithRecoverReference(r io.ReadSeeker) RecoverOption {
+    return func(rc *mp4Recover) {
+        rc.reference = r
+    }
+}
+
+// WithRecoverTrack 已知的track信息, 比如WithExtraData(sps/pps或者AudioSpecificConfig), WithAudioSampleRate
+// 按照录制时AddTrack的顺序添加
+func WithRecoverTrack(cid MP4_CODEC_TYPE, options ...TrackOption) RecoverOption {
+    return func(rc *mp4Recover) {
+        track := newmp4track(cid, nil)
+        for _, opt := range options {
+            opt(track)
+        }
+        track.trackId = uint32(len(rc.tracks) + 1)
+        rc.tracks = append(rc.tracks, track)
+    }
+}
+
+// WithRecoverFrameDuration 视频帧间隔(毫秒), 没有参考文件并且sps中没有帧率信息时使用, 默认40ms
+func WithRecoverFrameDuration(duration uint32) RecoverOption {
+    return func(rc *mp4Recover) {
+        rc.frameDuration = duration
+    }
+}
+
+type mp4Recover struct {
+    index         io.Reader
+    reference     io.ReadSeeker
+    tracks        []*mp4track
+    frameDuration uint32
+    aacFrameSize  int
+    sps           []byte
+}
+
+// RecoverMp4 恢复没有moov的mp4文件(录制时没有调用WriteTrailer), 恢复后的文件写入w
+func RecoverMp4(r io.ReadSeeker, w io.WriteSeeker, options ...RecoverOption) error {
+    rc := &mp4Recover{}
+    for _, opt := range options {
+        opt(rc)
+    }
+
+    mdatStart, mdatEnd, err := findRecoverMdat(r)
+    if err != nil {
+        return err
+    }
+
+    var samples []recoverSample
+    if rc.index != nil {
+        var tracks []*mp4track
+        if tracks, samples, err = readRecoveryIndex(rc.index); err != nil {
+            return err
+        }
+        if len(tracks) > 0 {
+            rc.tracks = tracks
+        }
+        valid := samples[:0]
+        for _, sample := range samples {
+            if sample.offset >= uint64(mdatStart) && sample.offset+sample.size <= uint64(mdatEnd) {
+                valid = append(valid, sample)
+            }
+        }
+        samples = valid
+    }
+    if rc.reference != nil {
+        if err = rc.loadReference(); err != nil {
+            return err
+        }
+    }
+
+    scanStart := mdatStart
+    for _, sample := range samples {
+        if int64(sample.offset+sample.size) > scanStart {
+            scanStart = int64(sample.offset + sample.size)
+        }
+    }
+    if scanStart < mdatEnd {
+        var scanned []recoverSample
+        if scanned, err = rc.scan(r, scanStart, mdatEnd, samples); err != nil {
+            return err
+        }
+        samples = append(samples, scanned...)
+    }
+    if len(samples) == 0 {
+        return errors.New("mp4 recover: no sample found")
+    }
+    return rc.writeSamples(r, w, samples)
+}
+
+// 录制中断的文件mdat的大小还是初始值8(或者0), mdat一直到文件结束
+func findRecoverMdat(r io.ReadSeeker) (int64, int64, error) {
+    end, err := r.Seek(0, io.SeekEnd)
+    if err != nil {
+        return 0, 0, err
+    }
+    offset := int64(0)
+    mdatStart, mdatEnd := int64(-1), int64(-1)
+    for offset+BasicBoxLen <= end {
+        if _, err = r.Seek(offset, io.SeekStart); err != nil {
+            return 0, 0, err
+        }
+        basebox := BasicBox{}
+        hdrLen, err := basebox.Decode(r)
+        if err != nil {
+            return 0, 0, err
+        }
+        switch string(basebox.Type[:]) {
+        case "moov":
+            return 0, 0, fmt.Errorf("mp4 recover: file has moov box: %w", codec.ErrInvalidState)
+        case "mdat":
+            if mdatStart >= 0 {
+                break
+            }
+            mdatStart = offset + int64(hdrLen)
+            if basebox.Size <= uint64(hdrLen) || basebox.Size > uint64(end-offset) {
+                return mdatStart, end, nil
+            }
+            mdatEnd = offset + int64(basebox.Size)
+        }
+        if basebox.Size < uint64(hdrLen) || basebox.Size > uint64(end-offset) {
+            break
+        }
+        offset += int64(basebox.Size)
+    }
+    //mdat大小正确的时候继续检查后面有没有moov
+    if mdatStart < 0 {
+        return 0, 0, errors.New("mp4 recover: mdat box not found")
+    }
+    return mdatStart, mdatEnd, nil
+}
+
+func (rc *mp4Recover) loadReference() error {
+    demuxer := CreateMp4Demuxer(rc.reference)
+    if _, err := demuxer.ReadHead(); err != nil {
+        return err
+    }
+    useTracks := len(rc.tracks) == 0
+    for _, track := range demuxer.tracks {
+        if len(track.samplelist) > 1 && track.timescale > 0 {
+            first, last := track.samplelist[0], track.samplelist[len(track.samplelist)-1]
+            delta := track.toMillisecond(last.dts-first.dts) / uint64(len(track.samplelist)-1)
+            if isVideo(track.cid) && rc.frameDuration == 0 && delta > 0 {
+                rc.frameDuration = uint32(delta)
+            }
+        }
+        if track.cid == MP4_CODEC_AAC && len(track.samplelist) > 0 {
+            total := uint64(0)
+            for _, sample := range track.samplelist {
+                total += sample.size
+            }
+            rc.aacFrameSize = int(total / uint64(len(track.samplelist)))
+        }
+        if !useTracks {
+            continue
+        }
+        t := newmp4track(track.cid, nil)
+        t.trackId = uint32(len(rc.tracks) + 1)
+        t.width, t.height = track.width, track.height
+        t.sampleRate, t.chanelCount, t.sampleBits = track.sampleRate, track.chanelCount, track.sampleBits
+        if track.extra != nil {
+            t.extraData = track.extra.export()
+        }
+        rc.tracks = append(rc.tracks, t)
+    }
+    return nil
+}
+
+// 按照文件中的顺序写入新的mp4
+func (rc *mp4Recover) writeSamples(r io.ReadSeeker, w io.WriteSeeker, samples []recoverSample) error {
+    sort.SliceStable(samples, func(i, j int) bool {
+        return samples[i].offset < samples[j].offset
+    })
+    muxer, err := CreateMp4Muxer(w)
+    if err != nil {
+        return err
+    }
+    ids := make(map[*mp4track]uint32)
+    for _, track := range rc.tracks {
+        has := false
+        for i := range samples {
+            if samples[i].track == track {
+                has = true
+                break
+            }
+        }
+        if !has {
+            continue
+        }
+        options := []TrackOption{WithExtraData(track.extraData)}
+        if isVideo(track.cid) {
+            options = append(options, WithVideoWidth(track.width), WithVideoHeight(track.height))
+            ids[track] = muxer.AddVideoTrack(track.cid, options...)
+        } else {
+            options = append(options, WithAudioSampleRate(track.sampleRate), WithAudioChannelCount(track.chanelCount), WithAudioSampleBits(track.sampleBits))
+            ids[track] = muxer.AddAudioTrack(track.cid, options...)
+        }
+    }
+
+    for _, sample := range samples {
+        if _, err = r.Seek(int64(sample.offset), io.SeekStart); err != nil {
+            return err
+        }
+        data := make([]byte, sample.size)
+        if _, err = io.ReadFull(r, data); err != nil {
+            return err
+        }
+        switch sample.track.cid {
+        case MP4_CODEC_H264, MP4_CODEC_H265:
+            if data, err = recoverAVCCToAnnexB(data); err != nil {
+                return err
+            }
+        case MP4_CODEC_AAC:
+            if len(sample.track.extraData) == 0 {
+                return errors.New("mp4 recover: aac track need AudioSpecificConfig")
+            }
+            adts, err := codec.ConvertASCToADTS(sample.track.extraData, len(data)+7)
+            if err != nil {
+                return err
+            }
+            data = append(adts.Encode(), data...)
+        }
+        if err = muxer.Write(ids[sample.track], data, sample.pts, sample.dts); err != nil {
+            return err
+        }
+        //还原stss, 这一帧还缓存在lastSample中, 写入下一帧或者WriteTrailer时才会生成sample
+        if track := muxer.tracks[ids[sample.track]]; sample.fromIndex && track.lastSample != nil && track.lastSample.hasVcl {
+            track.lastSample.isKey = sample.isKeyFrame
+        }
+    }
+    return muxer.WriteTrailer()
+}
+
+func recoverAVCCToAnnexB(avcc []byte) ([]byte, error) {
+    annexb := make([]byte, 0, len(avcc))
+    for len(avcc) > 0 {
+        if len(avcc) < 4 {
+            return nil, fmt.Errorf("mp4 recover avcc sample: %w", codec.ErrTruncated)
+        }
+        naluLen := binary.BigEndian.Uint32(avcc)
+        if uint64(naluLen) > uint64(len(avcc)-4) {
+            return nil, fmt.Errorf("mp4 recover avcc sample: %w", codec.ErrTruncated)
+        }
+        annexb = append(annexb, 0x00, 0x00, 0x00, 0x01)
+        annexb = append(annexb, avcc[4:4+naluLen]...)
+        avcc = avcc[4+naluLen:]
+    }
+    return annexb, nil
+}
+
+// 扫描时按窗口读取文件, 避免把整个mdat读入内存
+type recoverScanBuffer struct {
+    r    io.ReadSeeker
+    base int64
+    end  int64
+    buf  []byte
+}
+
+// 返回[pos, pos+n)的数据, 超出end的部分截断
+func (sb *recoverScanBuffer) peek(pos int64, n int) ([]byte, error) {
+    if pos+int64(n) > sb.end {
+        n = int(sb.end - pos)
+    }
+    if n <= 0 {
+        return nil, nil
+    }
+    if pos >= sb.base && pos+int64(n) <= sb.base+int64(len(sb.buf)) {
+        return sb.buf[pos-sb.base : pos-sb.base+int64(n)], nil
+    }
+    size := recoverScanWindow
+    if n > size {
+        size = n
+    }
+    if pos+int64(size) > sb.end {
+        size = int(sb.end - pos)
+    }
+    if _, err := sb.r.Seek(pos, io.SeekStart); err != nil {
+        return nil, err
+    }
+    buf := make([]byte, size)
+    if _, err := io.ReadFull(sb.r, buf); err != nil {
+        return nil, err
+    }
+    sb.base, sb.buf = pos, buf
+    return sb.buf[:n], nil
+}
+
+type recoverSegment struct {
+    offset  int64
+    size    int64
+    isVideo bool
+}
+
+func (rc *mp4Recover) scan(r io.ReadSeeker, start, end int64, indexed []recoverSample) ([]recoverSample, error) {
+    var video, audio *mp4track
+    for _, track := range rc.tracks {
+        if isVideo(track.cid) && video == nil {
+            video = track
+        } else if isAudio(track.cid) && audio == nil {
+            audio = track
+        }
+    }
+    rc.learnFromIndex(indexed)
+    sb := &recoverScanBuffer{r: r, end: end}
+    if video == nil && audio == nil {
+        //没有任何track信息, 只恢复视频
+        cid, err := rc.detectVideoCodec(sb, start, end)
+        if err != nil {
+            return nil, err
+        }
+        video = newmp4track(cid, nil)
+        video.trackId = 1
+        rc.tracks = append(rc.tracks, video)
+    }
+    if video != nil && video.cid == MP4_CODEC_H264 && len(video.extraData) > 0 && rc.sps == nil {
+        if spss, _ := codec.CovertExtradata(video.extraData); len(spss) > 0 {
+            rc.sps = spss[0][4:]
+        }
+    }
+
+    var segments []recoverSegment
+    pos := start
+    runStart := int64(-1)
+    for pos < end {
+        if video != nil {
+            auEnd, err := rc.parseAccessUnit(sb, pos, end, video.cid)
+            if err != nil {
+                return nil, err
+            }
+            if auEnd > pos {
+                if runStart >= 0 {
+                    segments = append(segments, recoverSegment{offset: runStart, size: pos - runStart})
+                    runStart = -1
+                }
+                segments = append(segments, recoverSegment{offset: pos, size: auEnd - pos, isVideo: true})
+                pos = auEnd
+                continue
+            }
+        }
+        if runStart < 0 {
+            runStart = pos
+        }
+        if video == nil {
+            pos = end
+        } else {
+            pos++
+        }
+    }
+    if runStart >= 0 {
+        segments = append(segments, recoverSegment{offset: runStart, size: end - runStart})
+    }
+
+    var samples []recoverSample
+    if video != nil {
+        frameDuration := rc.videoFrameDuration()
+        dts := uint64(0)
+        for _, sample := range indexed {
+            if sample.track == video {
+                dts = sample.dts + uint64(frameDuration)
+            }
+        }
+        for _, seg := range segments {
+            if !seg.isVideo {
+                continue
+            }
+            samples = append(samples, recoverSample{track: video, offset: uint64(seg.offset), size: uint64(seg.size), pts: dts, dts: dts})
+            dts += uint64(frameDuration)
+        }
+    }
+    if audio != nil {
+        audioSamples, err := rc.splitAudio(sb, audio, segments, len(samples), indexed)
+        if err != nil {
+            return nil, err
+        }
+        samples = append(samples, audioSamples...)
+    }
+    return samples, nil
+}
+
+// 索引中已有的sample比参考文件更准确, 用来计算帧间隔和AAC平均帧长
+func (rc *mp4Recover) learnFromIndex(indexed []recoverSample) {
+    var videoFirst, videoLast *recoverSample
+    videoCount, aacCount, aacBytes := 0, 0, uint64(0)
+    for i := range indexed {
+        sample := &indexed[i]
+        if isVideo(sample.track.cid) {
+            if videoFirst == nil {
+                videoFirst = sample
+            }
+            videoLast = sample
+            videoCount++
+        } else if sample.track.cid == MP4_CODEC_AAC {
+            aacCount++
+            aacBytes += sample.size
+        }
+    }
+    if videoCount > 1 && videoLast.dts > videoFirst.dts {
+        rc.frameDuration = uint32((videoLast.dts - videoFirst.dts) / uint64(videoCount-1))
+    }
+    if aacCount > 0 {
+        rc.aacFrameSize = int(aacBytes / uint64(aacCount))
+    }
+}
+
+// 根据第一个能识别的access unit判断是H264还是H265
+func (rc *mp4Recover) detectVideoCodec(sb *recoverScanBuffer, start, end int64) (MP4_CODEC_TYPE, error) {
+    for pos := start; pos < end; pos++ {
+        for _, cid := range []MP4_CODEC_TYPE{MP4_CODEC_H264, MP4_CODEC_H265} {
+            auEnd, err := rc.parseAccessUnit(sb, pos, end, cid)
+            if err != nil {
+                return 0, err
+            }
+            if auEnd > pos {
+                return cid, nil
+            }
+        }
+    }
+    return 0, errors.New("mp4 recover: no video found, need track information")
+}
+
+func (rc *mp4Recover) videoFrameDuration() uint32 {
+    if rc.frameDuration > 0 {
+        return rc.frameDuration
+    }
+    if rc.sps != nil {
+        sps := codec.SPS{}
+        sps.Decode(codec.NewBitStream(codec.CovertRbspToSodb(rc.sps[1:])))
+        vui := sps.VuiParameters
+        if sps.Vui_parameters_present_flag == 1 && vui.TimingInfoPresentFlag == 1 && vui.TimeScale > 0 {
+            duration := timebase.RescaleUint64(uint64(vui.NumUnitsInTick)*2, timebase.ClockRate(vui.TimeScale), timebase.MILLISECOND)
+            if duration > 0 && duration <= 1000 {
+                return uint32(duration)
+            }
+        }
+    }
+    return recoverDefaultFrameDelta
+}
+
+func isRecoverNaluHeader(cid MP4_CODEC_TYPE, hdr []byte) bool {
+    if len(hdr) < 2 || hdr[0]&0x80 != 0 {
+        return false
+    }
+    if cid == MP4_CODEC_H264 {
+        naluType := codec.H264_NAL_TYPE(hdr[0] & 0x1F)
+        if naluType == codec.H264_NAL_RESERVED || naluType > 12 {
+            return false
+        }
+        //sps/pps/idr的nal_ref_idc不能为0
+        if (naluType == codec.H264_NAL_I_SLICE || naluType == codec.H264_NAL_SPS || naluType == codec.H264_NAL_PPS) && hdr[0]&0x60 == 0 {
+            return false
+        }
+        return true
+    }
+    naluType := (hdr[0] >> 1) & 0x3F
+    layerId := (hdr[0]&0x01)<<5 | hdr[1]>>3
+    return naluType <= 40 && layerId == 0 && hdr[1]&0x07 != 0
+}
+
+// 从pos开始解析一个AVCC格式的access unit, 成功返回结束位置, 失败返回pos
+func (rc *mp4Recover) parseAccessUnit(sb *recoverScanBuffer, pos, end int64, cid MP4_CODEC_TYPE) (int64, error) {
+    p := pos
+    hasVcl := false
+    for p+6 <= end {
+        hdr, err := sb.peek(p, 6)
+        if err != nil {
+            return pos, err
+        }
+        naluLen := int64(binary.BigEndian.Uint32(hdr))
+        if naluLen < 2 || naluLen > recoverMaxNaluSize || naluLen > end-p-4 || !isRecoverNaluHeader(cid, hdr[4:]) {
+            break
+        }
+        head, err := sb.peek(p+4, 24)
+        if err != nil {
+            return pos, err
+        }
+        if int64(len(head)) > naluLen {
+            head = head[:naluLen]
+        }
+        nalu := append([]byte{0x00, 0x00, 0x00, 0x01}, head...)
+        isVcl, newAU := false, false
+        if cid == MP4_CODEC_H264 {
+            isVcl = codec.IsH264VCLNaluType(codec.H264NaluType(nalu))
+            newAU = codec.IsH264NewAccessUnit(nalu)
+        } else {
+            isVcl = codec.IsH265VCLNaluType(codec.H265NaluType(nalu))
+            newAU = codec.IsH265NewAccessUnit(nalu)
+        }
+        //录制时一个access unit从新的access unit的第一个nalu开始, 遇到下一个access unit的开头结束
+        if (p == pos && !newAU) || (hasVcl && newAU) {
+            break
+        }
+        if cid == MP4_CODEC_H264 && codec.H264NaluType(nalu) == codec.H264_NAL_SPS && rc.sps == nil {
+            sps, err := sb.peek(p+4, int(naluLen))
+            if err != nil {
+                return pos, err
+            }
+            rc.sps = append([]byte{}, sps...)
+        }
+        hasVcl = hasVcl || isVcl
+        p += 4 + naluLen
+    }
+    if !hasVcl {
+        return pos, nil
+    }
+    return p, nil
+}
+
+func (rc *mp4Recover) splitAudio(sb *recoverScanBuffer, audio *mp4track, segments []recoverSegment, videoFrames int, indexed []recoverSample) ([]recoverSample, error) {
+    sampleRate := uint64(audio.sampleRate)
+    channels := uint64(audio.chanelCount)
+    var samples []recoverSample
+    switch audio.cid {
+    case MP4_CODEC_G711A, MP4_CODEC_G711U:
+        if sampleRate == 0 {
+            sampleRate = 8000
+        }
+        if channels == 0 {
+            channels = 1
+        }
+        bytesPerSecond := sampleRate * channels
+        total := uint64(0)
+        for _, sample := range indexed {
+            if sample.track == audio {
+                total = timebase.RescaleUint64(sample.dts, timebase.MILLISECOND, timebase.ClockRate(uint32(bytesPerSecond))) + sample.size
+            }
+        }
+        //每20ms一个sample
+        chunk := int64(bytesPerSecond / 50)
+        for _, seg := range segments {
+            if seg.isVideo {
+                continue
+            }
+            for off := int64(0); off < seg.size; off += chunk {
+                size := chunk
+                if seg.size-off < size {
+                    size = seg.size - off
+                }
+                dts := timebase.RescaleUint64(total, timebase.ClockRate(uint32(bytesPerSecond)), timebase.MILLISECOND)
+                samples = append(samples, recoverSample{track: audio, offset: uint64(seg.offset + off), size: uint64(size), pts: dts, dts: dts})
+                total += uint64(size)
+            }
+        }
+    case MP4_CODEC_AAC:
+        if len(audio.extraData) > 0 && (sampleRate == 0 || channels == 0) {
+            asc := codec.NewAudioSpecificConfiguration()
+            if err := asc.Decode(audio.extraData); err == nil {
+                sampleRate = uint64(codec.AACSampleIdxToSample(int(asc.Sample_freq_index)))
+            }
+        }
+        if sampleRate == 0 {
+            return nil, errors.New("mp4 recover: unknown aac sample rate")
+        }
+        //每帧1024个采样
+        frameTimebase := timebase.NewRational(1024, int64(sampleRate))
+        frames := uint64(0)
+        for _, sample := range indexed {
+            if sample.track == audio {
+                frames = uint64(timebase.RescaleRound(int64(sample.dts), timebase.MILLISECOND, frameTimebase, timebase.ROUND_NEAREST)) + 1
+            }
+        }
+        frameSize := rc.aacFrameSize
+        if frameSize <= 0 {
+            //没有参考文件, 根据视频的时长估算平均帧长
+            totalBytes := int64(0)
+            for _, seg := range segments {
+                if !seg.isVideo {
+                    totalBytes += seg.size
+                }
+            }
+            expectFrames := timebase.RescaleUint64(uint64(videoFrames)*uint64(rc.videoFrameDuration()), timebase.MILLISECOND, frameTimebase)
+            if expectFrames == 0 {
+                return nil, errors.New("mp4 recover: can not estimate aac frame size, need reference file or recovery index")
+            }
+            frameSize = int(uint64(totalBytes) / expectFrames)
+        }
+        if frameSize <= 0 {
+            return nil, nil
+        }
+        var first []byte
+        for _, seg := range segments {
+            if seg.isVideo {
+                continue
+            }
+            if first == nil {
+                data, err := sb.peek(seg.offset, 1)
+                if err != nil {
+                    return nil, err
+                }
+                first = data
+            }
+            split, err := splitRecoverAACFrames(sb, seg.offset, seg.size, frameSize, first[0])
+            if err != nil {
+                return nil, err
+            }
+            for _, frame := range split {
+                dts := timebase.RescaleUint64(frames, frameTimebase, timebase.MILLISECOND)
+                samples = append(samples, recoverSample{track: audio, offset: uint64(frame[0]), size: uint64(frame[1]), pts: dts, dts: dts})
+                frames++
+            }
+        }
+    default:
+        return nil, fmt.Errorf("mp4 recover %d by scanning: %w", audio.cid, codec.ErrUnsupportedCodec)
+    }
+    return samples, nil
+}
+
+// AAC的raw_data_block没有同步头, 用平均帧长估算帧数, 在估算位置附近寻找帧边界:
+// 上一帧以ID_END(0b111)加补齐的0结束, 新的一帧第一个字节(element id和tag)和第一帧相同
+// 只读取估算位置前后半帧的数据, 返回每一帧在文件中的offset和size
+func splitRecoverAACFrames(sb *recoverScanBuffer, offset, size int64, frameSize int, first byte) ([][2]int64, error) {
+    k := (size + int64(frameSize/2)) / int64(frameSize)
+    if k <= 1 {
+        return [][2]int64{{offset, size}}, nil
+    }
+    end := offset + size
+    var frames [][2]int64
+    last := offset
+    for j := int64(1); j < k; j++ {
+        ideal := offset + j*size/k
+        lo, hi := ideal-int64(frameSize/2)-1, ideal+int64(frameSize/2)+1
+        if lo < last {
+            lo = last
+        }
+        if hi > end {
+            hi = end
+        }
+        window, err := sb.peek(lo, int(hi-lo))
+        if err != nil {
+            return nil, err
+        }
+        isBoundary := func(pos int64) bool {
+            cur, prev := window[pos-lo], window[pos-1-lo]
+            if cur&0xFE != first&0xFE || prev == 0 {
+                return false
+            }
+            tz := bits.TrailingZeros8(prev)
+            return tz > 5 || (prev>>tz)&0x07 == 0x07
+        }
+        split := int64(-1)
+        for d := int64(0); d <= int64(frameSize/2); d++ {
+            if p := ideal - d; p > last && isBoundary(p) {
+                split = p
+                break
+            }
+            if p := ideal + d; p < end && p > last && isBoundary(p) {
+                split = p
+                break
+            }
+        }
+        if split < 0 {
+            split = ideal
+        }
+        if split <= last {
+            continue
+        }
+        frames = append(frames, [2]int64{last, split - last})
+        last = split
+    }
+    return append(frames, [2]int64{last, end - last}), nil
+}
@@ -0,0 +1,223 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"testing"
+
+	codec "github.com/yapingcat/gomedia/go-codec"
+)
+
+func countPackets(pkgs []*AVPacket) (video int, audio int) {
+	for _, pkg := range pkgs {
+		if isVideo(pkg.Cid) {
+			video++
+		} else {
+			audio++
+		}
+	}
+	return
+}
+
+func recoverTestFile(t *testing.T, crashed []byte, options ...RecoverOption) []*AVPacket {
+	ws := newFmp4WriterSeeker(1024 * 64)
+	if err := RecoverMp4(bytes.NewReader(crashed), ws, options...); err != nil {
+		t.Fatal(err)
+	}
+	return readAllPackets(t, ws.buffer)
+}
+
+func TestRecoverMp4WithIndex(t *testing.T) {
+	var index bytes.Buffer
+	//写入100帧, 每64个sample自动保存一次索引, 剩下的部分靠扫描恢复
+	crashed := makeTestMp4(t, testMp4{frames: 100, crash: true, options: []MuxerOption{WithRecoveryIndex(&index)}})
+	if index.Len() == 0 {
+		t.Fatal("recovery index is empty")
+	}
+	pkgs := recoverTestFile(t, crashed, WithRecoverIndex(bytes.NewReader(index.Bytes())))
+	//最后一帧视频还在muxer的缓存中, 没有写入文件
+	video, audio := countPackets(pkgs)
+	if video != 99 || audio != 100 {
+		t.Fatalf("recover %d video %d audio", video, audio)
+	}
+	normal := readAllPackets(t, makeTestMp4(t, testMp4{}))
+	for _, pkg := range pkgs {
+		if pkg.Cid == MP4_CODEC_H264 && pkg.Dts%40 != 0 {
+			t.Fatalf("video dts %d", pkg.Dts)
+		}
+	}
+	if !bytes.Equal(pkgs[0].Data, normal[0].Data) {
+		t.Error("first video packet mismatch")
+	}
+}
+
+func TestRecoverMp4TruncatedIndex(t *testing.T) {
+	var index bytes.Buffer
+	crashed := makeTestMp4(t, testMp4{frames: 40, crash: true, options: []MuxerOption{WithRecoveryIndex(&index)}})
+	//索引最后一条记录(第32帧音频)不完整被丢弃, 它在最后一个完整记录的视频帧之前, 不会被扫描到
+	truncated := index.Bytes()[:index.Len()-3]
+	pkgs := recoverTestFile(t, crashed, WithRecoverIndex(bytes.NewReader(truncated)))
+	if video, audio := countPackets(pkgs); video != 39 || audio != 39 {
+		t.Fatalf("recover %d video %d audio", video, audio)
+	}
+}
+
+func TestRecoverMp4Scan(t *testing.T) {
+	crashed := makeTestMp4(t, testMp4{frames: 30, audio: MP4_CODEC_G711A, crash: true})
+	pkgs := recoverTestFile(t, crashed, WithRecoverTrack(MP4_CODEC_H264), WithRecoverTrack(MP4_CODEC_G711A, WithAudioSampleRate(8000), WithAudioChannelCount(1)))
+	//每帧320字节的G711按照20ms切分成两个sample
+	if video, audio := countPackets(pkgs); video != 29 || audio != 60 {
+		t.Fatalf("recover %d video %d audio", video, audio)
+	}
+	last := pkgs[len(pkgs)-1]
+	if last.Dts < 1100 || last.Dts > 1200 {
+		t.Errorf("last packet dts %d", last.Dts)
+	}
+
+	//没有track信息只恢复视频
+	pkgs = recoverTestFile(t, crashed)
+	if video, audio := countPackets(pkgs); video != 29 || audio != 0 {
+		t.Fatalf("recover %d video %d audio", video, audio)
+	}
+}
+
+func TestRecoverMp4Reference(t *testing.T) {
+	crashed := makeTestMp4(t, testMp4{frames: 30, crash: true})
+	reference := makeTestMp4(t, testMp4{})
+	pkgs := recoverTestFile(t, crashed, WithRecoverReference(bytes.NewReader(reference)))
+	if video, audio := countPackets(pkgs); video != 29 || audio != 30 {
+		t.Fatalf("recover %d video %d audio", video, audio)
+	}
+	normal := readAllPackets(t, reference)
+	for _, pkg := range pkgs {
+		if pkg.Cid != MP4_CODEC_AAC {
+			continue
+		}
+		if !bytes.Equal(pkg.Data, normal[1].Data) {
+			t.Fatal("aac packet mismatch")
+		}
+	}
+}
+
+func TestRecoverMp4Errors(t *testing.T) {
+	complete := makeTestMp4(t, testMp4{})
+	if err := RecoverMp4(bytes.NewReader(complete), newFmp4WriterSeeker(1024)); err == nil {
+		t.Error("file with moov should fail")
+	}
+	if err := RecoverMp4(bytes.NewReader(complete[:16]), newFmp4WriterSeeker(1024)); err == nil {
+		t.Error("file without mdat should fail")
+	}
+	crashed := makeTestMp4(t, testMp4{frames: 10, crash: true})
+	if err := RecoverMp4(bytes.NewReader(crashed), newFmp4WriterSeeker(1024), WithRecoverIndex(bytes.NewReader([]byte("bad index")))); err == nil {
+		t.Error("bad index should fail")
+	}
+}
+
+func recoverSyncDts(t *testing.T, data []byte) []uint64 {
+	demuxer := CreateMp4Demuxer(bytes.NewReader(data))
+	if _, err := demuxer.ReadHead(); err != nil {
+		t.Fatal(err)
+	}
+	table, err := demuxer.GetSyncTable(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dts []uint64
+	for _, sample := range table {
+		dts = append(dts, sample.Dts)
+	}
+	return dts
+}
+
+func TestRecoverMp4IndexKeyFrame(t *testing.T) {
+	var index bytes.Buffer
+	crashed := makeTestMp4(t, testMp4{frames: 40, gop: 10, crash: true, options: []MuxerOption{WithRecoveryIndex(&index)}})
+	recoverSync := func(index []byte) []uint64 {
+		ws := newFmp4WriterSeeker(1024 * 64)
+		if err := RecoverMp4(bytes.NewReader(crashed), ws, WithRecoverIndex(bytes.NewReader(index))); err != nil {
+			t.Fatal(err)
+		}
+		return recoverSyncDts(t, ws.buffer)
+	}
+	if dts := recoverSync(index.Bytes()); len(dts) != 4 || dts[0] != 0 || dts[3] != 1200 {
+		t.Fatalf("sync samples dts %v", dts)
+	}
+
+	//索引中的视频sample全部标记为关键帧, 恢复后的stss以索引为准, 扫描部分仍然根据nalu类型判断
+	modified := append([]byte{}, index.Bytes()...)
+	var want []uint64
+	for rec := modified[5:]; len(rec) > 0; {
+		if rec[0] == recoveryTrackRecord {
+			rec = rec[recoveryTrackRecordLen+int(binary.BigEndian.Uint32(rec[23:])):]
+			continue
+		}
+		if binary.BigEndian.Uint32(rec[1:]) == 1 {
+			rec[33] = 1
+			want = append(want, binary.BigEndian.Uint64(rec[25:]))
+		}
+		rec = rec[recoverySampleRecordLen:]
+	}
+	for dts := (want[len(want)-1]/400 + 1) * 400; dts < 39*40; dts += 400 {
+		want = append(want, dts)
+	}
+	if dts := recoverSync(modified); len(dts) != len(want) {
+		t.Fatalf("sync samples dts %v, want %v", dts, want)
+	} else {
+		for i := range dts {
+			if dts[i] != want[i] {
+				t.Fatalf("sync samples dts %v, want %v", dts, want)
+			}
+		}
+	}
+}
+
+func TestReadRecoveryIndexVersion(t *testing.T) {
+	_, _, err := readRecoveryIndex(bytes.NewReader([]byte{'G', 'M', 'R', 'I', recoveryIndexVersion + 1}))
+	if !errors.Is(err, codec.ErrInvalidData) {
+		t.Errorf("readRecoveryIndex() error = %v", err)
+	}
+}
+
+// 记录单次读取的最大长度
+type maxReadReader struct {
+	*bytes.Reader
+	max int
+}
+
+func (r *maxReadReader) Read(p []byte) (int, error) {
+	if len(p) > r.max {
+		r.max = len(p)
+	}
+	return r.Reader.Read(p)
+}
+
+func TestSplitRecoverAACFrames(t *testing.T) {
+	//比扫描窗口大的音频segment, 帧长380和420交替, 每帧以SCE开始, ID_END结束
+	var data []byte
+	var want [][2]int64
+	for len(data) < 3*recoverScanWindow {
+		size := 380 + 40*(len(want)%2)
+		frame := bytes.Repeat([]byte{0x55}, size)
+		frame[0], frame[size-1] = 0x21, 0xE0
+		want = append(want, [2]int64{int64(len(data)), int64(size)})
+		data = append(data, frame...)
+	}
+	r := &maxReadReader{Reader: bytes.NewReader(data)}
+	sb := &recoverScanBuffer{r: r, end: int64(len(data))}
+	got, err := splitRecoverAACFrames(sb, 0, int64(len(data)), 400, 0x21)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(want) {
+		t.Fatalf("got %d frames, want %d", len(got), len(want))
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("frame %d = %v, want %v", i, got[i], want[i])
+		}
+	}
+	if r.max > recoverScanWindow {
+		t.Errorf("read %d bytes at once", r.max)
+	}
+}
@@ -1,10 +1,12 @@
 package mp4
 
 import (
+	"bytes"
 	"errors"
 	"io"
 
 	"github.com/yapingcat/gomedia/go-codec"
+	"github.com/yapingcat/gomedia/go-timebase"
 )
 
 type sampleCache struct {
@@ -87,6 +89,41 @@ func (extra *aacExtraData) load(data []byte) {
 	copy(extra.asc, data)
 }
 
+// dac3或者dec3的内容
+type ac3ExtraData struct {
+	specific []byte
+}
+
+func (extra *ac3ExtraData) export() []byte {
+	return extra.specific
+}
+
+func (extra *ac3ExtraData) load(data []byte) {
+	extra.specific = make([]byte, len(data))
+	copy(extra.specific, data)
+}
+
+// FLACSpecificBox中的metadata block
+type flacExtraData struct {
+	metadata   []byte
+	streamInfo *codec.FLACStreamInfo
+}
+
+func (extra *flacExtraData) export() []byte {
+	return extra.metadata
+}
+
+func (extra *flacExtraData) load(data []byte) {
+	if len(data) >= 4 && bytes.Equal(data[:4], codec.FLACStreamMarker) {
+		data = data[4:]
+	}
+	extra.metadata = make([]byte, len(data))
+	copy(extra.metadata, data)
+	if blocks, _, err := codec.DecodeFLACMetadataBlocks(extra.metadata); err == nil {
+		extra.streamInfo, _ = codec.FindFLACStreamInfo(blocks)
+	}
+}
+
 type movFragment struct {
 	offset   uint64
 	duration uint32
@@ -110,6 +147,8 @@ type mp4track struct {
 	samplelist  []sampleEntry
 	elst        *movelst
 	extra       extraData
+	bsf         codec.BitStreamFilter //demux时转换sample
+	toLength    codec.BitStreamFilter //mux时Annex-B转换为length-prefixed
 	lastSample  *sampleCache
 	writer      io.WriteSeeker
 	fragments   []movFragment
@@ -122,6 +161,7 @@ type mp4track struct {
 	defaultDuration    uint32
 	defaultSampleFlags uint32
 	baseDataOffset     uint64
+	recordedSamples    []sampleEntry //crash safe模式下已经输出的sample, offset是文件中的绝对位置
 
 	//for subsample
 	defaultIsProtected     uint8
@@ -135,6 +175,11 @@ type mp4track struct {
 	subSamples             []sencEntry
 }
 
+// track timescale下的时间戳转换为毫秒
+func (track *mp4track) toMillisecond(ts uint64) uint64 {
+	return timebase.RescaleUint64(ts, timebase.ClockRate(track.timescale), timebase.MILLISECOND)
+}
+
 func newmp4track(cid MP4_CODEC_TYPE, writer io.WriteSeeker) *mp4track {
 	track := &mp4track{
 		cid:        cid,
@@ -150,12 +195,19 @@ func newmp4track(cid MP4_CODEC_TYPE, writer io.WriteSeeker) *mp4track {
 		startDts:  0,
 	}
 
+	if cid == MP4_CODEC_H264 || cid == MP4_CODEC_H265 {
+		track.toLength, _ = codec.NewAnnexBToLengthFilter(4)
+	}
 	if cid == MP4_CODEC_H264 {
 		track.extra = new(h264ExtraData)
 	} else if cid == MP4_CODEC_H265 {
 		track.extra = newh265ExtraData()
 	} else if cid == MP4_CODEC_AAC {
 		track.extra = new(aacExtraData)
+	} else if cid == MP4_CODEC_AC3 || cid == MP4_CODEC_EAC3 {
+		track.extra = new(ac3ExtraData)
+	} else if cid == MP4_CODEC_FLAC {
+		track.extra = new(flacExtraData)
 	}
 	return track
 }
@@ -289,6 +341,10 @@ func (track *mp4track) writeSample(sample []byte, pts, dts uint64) (err error) {
 		err = track.writeMP3(sample, pts, dts)
 	case MP4_CODEC_OPUS:
 		err = track.writeOPUS(sample, pts, dts)
+	case MP4_CODEC_AC3, MP4_CODEC_EAC3:
+		err = track.writeAC3(sample, pts, dts)
+	case MP4_CODEC_FLAC:
+		err = track.writeFLAC(sample, pts, dts)
 	}
 	return err
 }
@@ -333,7 +389,7 @@ func (track *mp4track) writeH264(h264 []byte, pts, dts uint64) (err error) {
 		}
 		//aud/sps/pps/sei 为帧间隔
 		//通过first_slice_in_mb来判断，改nalu是否为一帧的开头
-		if track.lastSample.hasVcl && isH264NewAccessUnit(nalu) {
+		if track.lastSample.hasVcl && codec.IsH264NewAccessUnit(nalu) {
 			var currentOffset int64
 			if currentOffset, err = track.writer.Seek(0, io.SeekCurrent); err != nil {
 				return false
@@ -364,7 +420,11 @@ func (track *mp4track) writeH264(h264 []byte, pts, dts uint64) (err error) {
 				track.lastSample.isKey = true
 			}
 		}
-		track.lastSample.cache = append(track.lastSample.cache, codec.ConvertAnnexBToAVCC(nalu)...)
+		var sample []byte
+		if sample, err = track.toLength.Filter(nalu); err != nil {
+			return false
+		}
+		track.lastSample.cache = append(track.lastSample.cache, sample...)
 		return true
 	})
 	return
@@ -395,7 +455,7 @@ func (track *mp4track) writeH265(h265 []byte, pts, dts uint64) (err error) {
 			h265extra.hvccExtra.UpdateVPS(nalu)
 		}
 
-		if track.lastSample.hasVcl && isH265NewAccessUnit(nalu) {
+		if track.lastSample.hasVcl && codec.IsH265NewAccessUnit(nalu) {
 			var currentOffset int64
 			if currentOffset, err = track.writer.Seek(0, io.SeekCurrent); err != nil {
 				return false
@@ -426,7 +486,11 @@ func (track *mp4track) writeH265(h265 []byte, pts, dts uint64) (err error) {
 				track.lastSample.isKey = true
 			}
 		}
-		track.lastSample.cache = append(track.lastSample.cache, codec.ConvertAnnexBToAVCC(nalu)...)
+		var sample []byte
+		if sample, err = track.toLength.Filter(nalu); err != nil {
+			return false
+		}
+		track.lastSample.cache = append(track.lastSample.cache, sample...)
 		return true
 	})
 	return
@@ -533,6 +597,160 @@ func (track *mp4track) writeOPUS(opus []byte, pts, dts uint64) (err error) {
 	return track.writeG711(opus, pts, dts)
 }
 
+// 每个access unit(E-AC-3包含所有independent/dependent substream)作为一个sample
+func (track *mp4track) writeAC3(ac3 []byte, pts, dts uint64) (err error) {
+	ac3extra, ok := track.extra.(*ac3ExtraData)
+	if !ok {
+		return errors.New("must init ac3ExtraData first")
+	}
+	if len(ac3extra.specific) == 0 {
+		start := codec.FindAC3Syncword(ac3, 0)
+		if start < 0 {
+			return errors.New("not found ac3 syncword")
+		}
+		head, err := codec.DecodeAC3FrameHead(ac3[start:])
+		if err != nil {
+			return err
+		}
+		track.chanelCount = uint8(head.ChannelCount)
+		if track.cid == MP4_CODEC_AC3 {
+			ac3extra.specific = codec.NewAC3SpecificConfig(head).Encode()
+		} else {
+			dec3, err := codec.NewEAC3SpecificConfig(ac3[start:])
+			if err != nil {
+				return err
+			}
+			ac3extra.specific = dec3.Encode()
+			track.chanelCount = uint8(dec3.ChannelCount())
+		}
+		if track.sampleRate == 0 {
+			track.sampleRate = uint32(head.SampleRate)
+		}
+		track.sampleBits = 16
+	}
+
+	var currentOffset int64
+	if currentOffset, err = track.writer.Seek(0, io.SeekCurrent); err != nil {
+		return
+	}
+	var entry *sampleEntry
+	samples, unitSamples := 0, 0
+	splitErr := codec.SplitAC3Frames(ac3, func(head *codec.AC3FrameHead, frame []byte) {
+		if err != nil {
+			return
+		}
+		if entry == nil || !head.IsEAC3() || (head.Strmtyp != codec.EAC3_STRMTYP_DEPENDENT && head.Substreamid == 0) {
+			if entry != nil {
+				track.addSampleEntry(*entry)
+				samples += unitSamples
+			}
+			unitSamples = head.SampleSize
+			delta := timebase.RescaleUint64(uint64(samples), timebase.ClockRate(uint32(head.SampleRate)), timebase.MILLISECOND)
+			entry = &sampleEntry{
+				pts:                    pts + delta,
+				dts:                    dts + delta,
+				SampleDescriptionIndex: 1,
+				offset:                 uint64(currentOffset),
+			}
+		}
+		n := 0
+		if n, err = track.writer.Write(frame); err != nil {
+			return
+		}
+		currentOffset += int64(n)
+		entry.size += uint64(n)
+	})
+	if entry != nil {
+		track.addSampleEntry(*entry)
+	}
+	if err != nil {
+		return err
+	}
+	return splitErr
+}
+
+// data可以是完整的FLAC流("fLaC"+METADATA_BLOCK+FRAME), 也可以只包含完整的FRAME
+// 每个FRAME作为一个sample
+func (track *mp4track) writeFLAC(flac []byte, pts, dts uint64) (err error) {
+	flacextra, ok := track.extra.(*flacExtraData)
+	if !ok {
+		return errors.New("must init flacExtraData first")
+	}
+	if len(flac) >= 4 && bytes.Equal(flac[:4], codec.FLACStreamMarker) {
+		blocks, offset, err := codec.DecodeFLACMetadataBlocks(flac)
+		if err != nil {
+			return err
+		}
+		metadata := blocks[:0:0]
+		for _, block := range blocks {
+			if block.Block_type != codec.FLAC_METADATA_PADDING {
+				metadata = append(metadata, block)
+			}
+		}
+		flacextra.load(codec.EncodeFLACMetadataBlocks(metadata))
+		flac = flac[offset:]
+	} else if flacextra.streamInfo == nil && len(track.extraData) > 0 {
+		flacextra.load(track.extraData)
+	}
+	if len(flac) == 0 {
+		return nil
+	}
+
+	if flacextra.streamInfo == nil {
+		//没有STREAMINFO, 根据第一个帧头生成
+		_, head := codec.FindFLACFrameHead(flac, 0, nil)
+		if head == nil {
+			return errors.New("not found flac frame head")
+		}
+		si := &codec.FLACStreamInfo{
+			Min_block_size:  uint16(head.BlockSize),
+			Max_block_size:  uint16(head.BlockSize),
+			Sample_rate:     uint32(head.SampleRate),
+			Channels:        uint8(head.ChannelCount),
+			Bits_per_sample: uint8(head.BitsPerSample),
+		}
+		if head.Blocking_strategy == 1 {
+			si.Min_block_size = 16
+			si.Max_block_size = 65535
+		}
+		flacextra.load(codec.EncodeFLACMetadataBlocks([]codec.FLACMetadataBlock{{Block_type: codec.FLAC_METADATA_STREAMINFO, Data: si.Encode()}}))
+	}
+	if track.sampleRate == 0 {
+		track.sampleRate = flacextra.streamInfo.Sample_rate
+		track.chanelCount = flacextra.streamInfo.Channels
+		track.sampleBits = flacextra.streamInfo.Bits_per_sample
+	}
+
+	var currentOffset int64
+	if currentOffset, err = track.writer.Seek(0, io.SeekCurrent); err != nil {
+		return
+	}
+	samples := 0
+	splitErr := codec.SplitFLACFrames(flac, flacextra.streamInfo, func(head *codec.FLACFrameHead, frame []byte) {
+		if err != nil {
+			return
+		}
+		delta := timebase.RescaleUint64(uint64(samples), timebase.ClockRate(uint32(head.SampleRate)), timebase.MILLISECOND)
+		samples += head.BlockSize
+		n := 0
+		if n, err = track.writer.Write(frame); err != nil {
+			return
+		}
+		track.addSampleEntry(sampleEntry{
+			pts:                    pts + delta,
+			dts:                    dts + delta,
+			size:                   uint64(n),
+			SampleDescriptionIndex: 1,
+			offset:                 uint64(currentOffset),
+		})
+		currentOffset += int64(n)
+	})
+	if err != nil {
+		return err
+	}
+	return splitErr
+}
+
 func (track *mp4track) flush() (err error) {
 	var currentOffset int64
 	if track.lastSample != nil && len(track.lastSample.cache) > 0 {
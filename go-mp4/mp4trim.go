@@ -0,0 +1,465 @@
+package mp4
+
+import (
+    "bytes"
+    "encoding/binary"
+    "errors"
+    "fmt"
+    "io"
+    "sort"
+
+    "github.com/yapingcat/gomedia/go-codec"
+    "github.com/yapingcat/gomedia/go-timebase"
+)
+
+// 普通mp4和fmp4都可以作为输入
+func readConvSource(r io.ReadSeeker) (*convSource, error) {
+    src, _, err := readConvHead(r)
+    if err != nil {
+        return nil, err
+    }
+    mvex, err := findBoxPath(src.moov.payload(), "mvex")
+    if err != nil {
+        return nil, err
+    }
+    if mvex != nil {
+        return readFragmentedMp4(r)
+    }
+    return readProgressiveMp4(r)
+}
+
+func makeConvEdts(edits []elstEntry) []byte {
+    version := uint32(0)
+    for _, edit := range edits {
+        if edit.segmentDuration > 0xFFFFFFFF || edit.mediaTime > 0x7FFFFFFF {
+            version = 1
+        }
+    }
+    elst := NewEditListBox(version)
+    elst.entrys.entryCount = uint32(len(edits))
+    elst.entrys.entrys = edits
+    elst.box.Box.Size = uint64(12 + 4 + 12*len(edits))
+    if version == 1 {
+        elst.box.Box.Size += uint64(8 * len(edits))
+    }
+    _, elstData := elst.Encode()
+    return makeContainerBox("edts", elstData)
+}
+
+// 替换trak中的edts, 没有edts时插入到tkhd之后
+func replaceEdts(trak []byte, edts []byte) ([]byte, error) {
+    boxes, err := splitBoxes(trak)
+    if err != nil {
+        return nil, err
+    }
+    children, err := splitBoxes(boxes[0].payload())
+    if err != nil {
+        return nil, err
+    }
+    found := findBox(children, "edts") != nil
+    out := make([][]byte, 0, len(children)+1)
+    for i := range children {
+        switch {
+        case children[i].is("edts"):
+            out = append(out, edts)
+        case children[i].is("tkhd") && !found:
+            out = append(out, children[i].data, edts)
+        default:
+            out = append(out, children[i].data)
+        }
+    }
+    return makeContainerBox("trak", out...), nil
+}
+
+// trak中原有的edit list, 没有时整个track作为一个edit
+func (track *convTrack) readEdits(movieTimescale uint32) ([]elstEntry, error) {
+    elstBox, err := findBoxPath(track.trak[8:], "edts", "elst")
+    if err != nil {
+        return nil, err
+    }
+    if elstBox != nil {
+        elst := &EditListBox{box: new(FullBox)}
+        if _, err = elst.Decode(bytes.NewReader(elstBox.payload())); err != nil {
+            return nil, errBoxTruncated("elst")
+        }
+        return elst.entrys.entrys, nil
+    }
+    return []elstEntry{{
+        segmentDuration:  rescaleTimescale(track.mediaDuration(), track.timescale, movieTimescale),
+        mediaRateInteger: 1,
+    }}, nil
+}
+
+// 找到media时间start(track timescale)之前最近的关键帧
+// 优先使用demuxer的sync sample table, 没有stss(比如音频或者fmp4)时根据sample flags查找
+func trimStartSample(demuxer *MovDemuxer, track *convTrack, start uint64) int {
+    var syncs []SyncSample
+    if demuxer != nil {
+        syncs, _ = demuxer.GetSyncTable(track.trackId)
+    }
+    if len(syncs) > 0 {
+        startMs := rescaleTimescale(start, track.timescale, 1000)
+        syncDts := syncs[0].Dts
+        for _, sync := range syncs {
+            if sync.Pts <= startMs {
+                syncDts = sync.Dts
+            }
+        }
+        for i := range track.samples {
+            if track.samples[i].isSync() && rescaleTimescale(track.samples[i].dts, track.timescale, 1000) >= syncDts {
+                return i
+            }
+        }
+    }
+    first := 0
+    for i := range track.samples {
+        pts := int64(track.samples[i].dts) + int64(track.samples[i].cto)
+        if pts > int64(start) {
+            break
+        }
+        if track.samples[i].isSync() {
+            first = i
+        }
+    }
+    return first
+}
+
+// 播放时间start(track timescale)通过原有的edit list映射到media时间轴
+// start落在空edit中时从下一个edit的入点开始, delay是输出中还需要保留的空edit时长
+func mapTrimStart(edits []elstEntry, movieTimescale, timescale uint32, start uint64) (mediaTime uint64, delay uint64) {
+    pos := uint64(0)
+    for i, edit := range edits {
+        end := pos + rescaleTimescale(edit.segmentDuration, movieTimescale, timescale)
+        if edit.mediaTime < 0 {
+            if start < end {
+                if start > pos {
+                    delay += end - start
+                } else {
+                    delay += end - pos
+                }
+            }
+            pos = end
+            continue
+        }
+        if start < end || i == len(edits)-1 {
+            if start > pos {
+                mediaTime = start - pos
+            }
+            return uint64(edit.mediaTime) + mediaTime, delay
+        }
+        pos = end
+    }
+    //只有空edit
+    return start, delay
+}
+
+// Trim 不重新编码截取[start, end)(毫秒)之间的内容, 输出普通mp4
+// start和end是原文件的播放时间, 通过原有的edit list映射到media时间轴
+// 每个track从start之前最近的关键帧开始, 通过edit list从start开始播放
+func Trim(r io.ReadSeeker, w io.Writer, start, end uint64) error {
+    if end <= start {
+        return fmt.Errorf("mp4 trim: invalid range [%d, %d)", start, end)
+    }
+    src, err := readConvSource(r)
+    if err != nil {
+        return err
+    }
+    movieTimescale, err := src.movieTimescale()
+    if err != nil {
+        return err
+    }
+    if _, err = r.Seek(0, io.SeekStart); err != nil {
+        return err
+    }
+    //demuxer不支持的文件(比如stbl中有saiz)根据sample flags查找关键帧
+    demuxer := CreateMp4Demuxer(r)
+    if _, err = demuxer.ReadHead(); err != nil {
+        demuxer = nil
+    }
+
+    total := 0
+    for _, track := range src.tracks {
+        edits, err := track.readEdits(movieTimescale)
+        if err != nil {
+            return err
+        }
+        mediaStart, delay := mapTrimStart(edits, movieTimescale, track.timescale, rescaleTimescale(start, 1000, track.timescale))
+        //dts < end, 向上取整
+        length := uint64(timebase.RescaleRound(int64(end-start), timebase.MILLISECOND, timebase.ClockRate(track.timescale), timebase.ROUND_UP))
+        first := len(track.samples)
+        if delay < length && track.endDts() > mediaStart {
+            //demuxer输出的时间戳包含了空edit的时长, 这时只能根据sample flags查找关键帧
+            syncTable := demuxer
+            for _, edit := range edits {
+                if edit.mediaTime < 0 {
+                    syncTable = nil
+                }
+            }
+            first = trimStartSample(syncTable, track, mediaStart)
+        }
+        last := first
+        for last < len(track.samples) && track.samples[last].dts < mediaStart+length-delay {
+            last++
+        }
+        if first >= last {
+            //没有sample的track使用空的edit
+            track.samples = nil
+            track.groups = nil
+            track.edits = []elstEntry{{mediaTime: -1, mediaRateInteger: 1}}
+            continue
+        }
+        total += last - first
+        firstDts := track.samples[first].dts
+        track.samples = append([]convSample{}, track.samples[first:last]...)
+        for i := range track.samples {
+            track.samples[i].dts -= firstDts
+        }
+        for _, g := range track.groups {
+            g.index = append([]uint32{}, g.index[first:last]...)
+        }
+
+        mediaTime := uint64(0)
+        if mediaStart > firstDts {
+            mediaTime = mediaStart - firstDts
+        }
+        segment := uint64(0)
+        if duration := rescaleTimescale(end-start, 1000, track.timescale); duration > delay {
+            segment = duration - delay
+        }
+        if mediaDuration := track.mediaDuration(); mediaTime+segment > mediaDuration {
+            segment = 0
+            if mediaDuration > mediaTime {
+                segment = mediaDuration - mediaTime
+            }
+        }
+        track.edits = nil
+        if delay > 0 {
+            track.edits = append(track.edits, elstEntry{segmentDuration: rescaleTimescale(delay, track.timescale, movieTimescale), mediaTime: -1, mediaRateInteger: 1})
+        }
+        track.edits = append(track.edits, elstEntry{
+            segmentDuration:  rescaleTimescale(segment, track.timescale, movieTimescale),
+            mediaTime:        int64(mediaTime),
+            mediaRateInteger: 1,
+        })
+    }
+    if total == 0 {
+        return fmt.Errorf("mp4 trim: no sample in [%d, %d)", start, end)
+    }
+    return writeConvMp4(w, src, makeProgressiveFtyp(src), sortedSampleRefs(r, src.tracks))
+}
+
+// stsd中的sample entry
+func (track *convTrack) sampleEntries() ([][]byte, [][]byte, error) {
+    stbl, err := track.stblBox()
+    if err != nil {
+        return nil, nil, err
+    }
+    stsds, sgpd, err := keepStblBoxes(stbl)
+    if err != nil {
+        return nil, nil, err
+    }
+    stsd, err := splitBoxes(stsds[0])
+    if err != nil {
+        return nil, nil, err
+    }
+    if len(stsd[0].payload()) < 8 {
+        return nil, nil, errBoxTruncated("stsd")
+    }
+    boxes, err := splitBoxes(stsd[0].payload()[8:])
+    if err != nil {
+        return nil, nil, err
+    }
+    entries := make([][]byte, len(boxes))
+    for i := range boxes {
+        entries[i] = boxes[i].data
+    }
+    return entries, sgpd, nil
+}
+
+// 用新的sample entry替换stsd
+func (track *convTrack) replaceSampleEntries(entries [][]byte) error {
+    stbl, err := track.stblBox()
+    if err != nil {
+        return err
+    }
+    stblData, err := rewriteContainer(stbl, func(child *convBox) ([]byte, error) {
+        if !child.is("stsd") {
+            return child.data, nil
+        }
+        stsd := NewFullBox([4]byte{'s', 't', 's', 'd'}, 0)
+        stsd.Box.Size = 16
+        n, header := stsd.Encode()
+        binary.BigEndian.PutUint32(header[n:], uint32(len(entries)))
+        return makeContainerBox("stsd", append([][]byte{header[8:]}, entries...)...), nil
+    })
+    if err != nil {
+        return err
+    }
+    trak, err := splitBoxes(track.trak)
+    if err != nil {
+        return err
+    }
+    track.trak, err = rewriteTrak(&trak[0], stblData, nil, nil)
+    return err
+}
+
+func (track *convTrack) endDts() uint64 {
+    if len(track.samples) == 0 {
+        return 0
+    }
+    last := track.samples[len(track.samples)-1]
+    return last.dts + uint64(last.duration)
+}
+
+// 每个track的edit list转换到目标时间单位, 比最长的track短的部分用空的edit补齐, 保证下一个输入的所有track同时开始
+func (src *convSource) alignedEdits(timescale uint32) ([][]elstEntry, error) {
+    movieTimescale, err := src.movieTimescale()
+    if err != nil {
+        return nil, err
+    }
+    if movieTimescale == 0 {
+        return nil, fmt.Errorf("mp4 mvhd box: %w: timescale is 0", codec.ErrInvalidData)
+    }
+    edits := make([][]elstEntry, len(src.tracks))
+    totals := make([]uint64, len(src.tracks))
+    maxTotal := uint64(0)
+    for i, track := range src.tracks {
+        if edits[i], err = track.readEdits(movieTimescale); err != nil {
+            return nil, err
+        }
+        for j := range edits[i] {
+            edits[i][j].segmentDuration = rescaleTimescale(edits[i][j].segmentDuration, movieTimescale, timescale)
+            totals[i] += edits[i][j].segmentDuration
+        }
+        if totals[i] > maxTotal {
+            maxTotal = totals[i]
+        }
+    }
+    for i := range edits {
+        if totals[i] < maxTotal {
+            edits[i] = append(edits[i], elstEntry{segmentDuration: maxTotal - totals[i], mediaTime: -1, mediaRateInteger: 1})
+        }
+    }
+    return edits, nil
+}
+
+// Concat 不重新编码把多个mp4首尾相接拼成一个普通mp4
+// 所有输入的track按照顺序一一对应, handler和timescale必须相同, sample description不同时增加stsd entry
+// 每个输入的sample在media时间轴上依次排列, 原有的edit list按照顺序合并
+func Concat(w io.Writer, inputs ...io.ReadSeeker) error {
+    if len(inputs) == 0 {
+        return errors.New("mp4 concat: no input")
+    }
+    dst, err := readConvSource(inputs[0])
+    if err != nil {
+        return err
+    }
+    dstTimescale, err := dst.movieTimescale()
+    if err != nil {
+        return err
+    }
+    edits, err := dst.alignedEdits(dstTimescale)
+    if err != nil {
+        return err
+    }
+    dstEntries := make([][][]byte, len(dst.tracks))
+    dstSgpd := make([][][]byte, len(dst.tracks))
+    for i, track := range dst.tracks {
+        if dstEntries[i], dstSgpd[i], err = track.sampleEntries(); err != nil {
+            return err
+        }
+        track.edits = edits[i]
+    }
+    order := sortedSampleRefs(inputs[0], dst.tracks)
+
+    for k := 1; k < len(inputs); k++ {
+        r := inputs[k]
+        src, err := readConvSource(r)
+        if err != nil {
+            return err
+        }
+        if len(src.tracks) != len(dst.tracks) {
+            return fmt.Errorf("mp4 concat: %w: input %d has %d tracks, want %d", codec.ErrUnsupportedCodec, k, len(src.tracks), len(dst.tracks))
+        }
+        if edits, err = src.alignedEdits(dstTimescale); err != nil {
+            return err
+        }
+        var refs []convSampleRef
+        for i, track := range src.tracks {
+            dt := dst.tracks[i]
+            if track.handler != dt.handler || track.timescale != dt.timescale || track.ivSize != dt.ivSize {
+                return fmt.Errorf("mp4 concat: %w: input %d track %d does not match", codec.ErrUnsupportedCodec, k, track.trackId)
+            }
+            entries, sgpd, err := track.sampleEntries()
+            if err != nil {
+                return err
+            }
+            if len(track.groups) > 0 && !sameBoxList(sgpd, dstSgpd[i]) {
+                return fmt.Errorf("mp4 concat: %w: input %d track %d has different sample group description", codec.ErrUnsupportedCodec, k, track.trackId)
+            }
+            //相同的sample entry复用, 不同的增加到stsd最后
+            descMap := make([]uint32, len(entries)+1)
+            for j, entry := range entries {
+                for n, dstEntry := range dstEntries[i] {
+                    if bytes.Equal(entry, dstEntry) {
+                        descMap[j+1] = uint32(n + 1)
+                    }
+                }
+                if descMap[j+1] == 0 {
+                    dstEntries[i] = append(dstEntries[i], entry)
+                    descMap[j+1] = uint32(len(dstEntries[i]))
+                }
+            }
+
+            delta := int64(0)
+            if len(track.samples) > 0 {
+                delta = int64(dt.endDts()) - int64(track.samples[0].dts)
+            }
+            base := len(dt.samples)
+            for _, sample := range track.samples {
+                if sample.descIdx == 0 || int(sample.descIdx) >= len(descMap) {
+                    return fmt.Errorf("mp4 concat: %w: sample description index %d", codec.ErrInvalidData, sample.descIdx)
+                }
+                sample.descIdx = descMap[sample.descIdx]
+                sample.dts = uint64(int64(sample.dts) + delta)
+                dt.samples = append(dt.samples, sample)
+                refs = append(refs, convSampleRef{track: dt, idx: len(dt.samples) - 1, r: r})
+            }
+            for _, g := range track.groups {
+                dg := dt.group(g.groupingType)
+                dg.hasParameter, dg.parameter = g.hasParameter, g.parameter
+                dt.padGroups()
+                copy(dg.index[base:], g.index)
+            }
+            dt.padGroups()
+            for _, edit := range edits[i] {
+                if edit.mediaTime >= 0 {
+                    edit.mediaTime += delta
+                }
+                dt.edits = append(dt.edits, edit)
+            }
+        }
+        sort.SliceStable(refs, func(i, j int) bool {
+            return refs[i].track.samples[refs[i].idx].offset < refs[j].track.samples[refs[j].idx].offset
+        })
+        order = append(order, refs...)
+    }
+    for i, track := range dst.tracks {
+        if err := track.replaceSampleEntries(dstEntries[i]); err != nil {
+            return err
+        }
+    }
+    return writeConvMp4(w, dst, makeProgressiveFtyp(dst), order)
+}
+
+func sameBoxList(a, b [][]byte) bool {
+    if len(a) != len(b) {
+        return false
+    }
+    for i := range a {
+        if !bytes.Equal(a[i], b[i]) {
+            return false
+        }
+    }
+    return true
+}
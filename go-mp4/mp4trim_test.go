@@ -0,0 +1,201 @@
+package mp4
+
+import (
+	"bytes"
+	"encoding/binary"
+	"io"
+	"testing"
+)
+
+func readConvTestEdits(t *testing.T, track *convTrack) []elstEntry {
+	edits, err := track.readEdits(1000)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return edits
+}
+
+func TestTrimGop(t *testing.T) {
+	file := makeTestMp4(t, testMp4{gop: 10})
+	out := rewriteTestMp4(t, func(w io.Writer) error { return Trim(bytes.NewReader(file), w, 500, 1300) })
+	//从400ms的关键帧开始, edit list跳过100ms
+	pkgs := readAllPackets(t, out)
+	origin := readAllPackets(t, file)
+	if video, audio := countPackets(pkgs); video != 23 || audio != 21 {
+		t.Fatalf("trim %d video %d audio", video, audio)
+	}
+	if pkgs[0].Cid != MP4_CODEC_H264 || !bytes.Equal(pkgs[0].Data, origin[20].Data) {
+		t.Error("first packet should be the key frame at 400ms")
+	}
+	src := readConvTestSource(t, out, false)
+	if edits := readConvTestEdits(t, src.tracks[0]); len(edits) != 1 || edits[0].mediaTime != 100 || edits[0].segmentDuration != 800 {
+		t.Fatalf("video edits %+v", edits)
+	}
+}
+
+func TestTrim(t *testing.T) {
+	normal := makeTestMp4(t, testMp4{})
+	out := rewriteTestMp4(t, func(w io.Writer) error { return Trim(bytes.NewReader(normal), w, 500, 1300) })
+	if types := topLevelBoxTypes(t, out); types != "ftyp moov mdat " {
+		t.Fatalf("top level boxes %q", types)
+	}
+	//所有帧都是关键帧, 从480ms的sample开始
+	pkgs := readAllPackets(t, out)
+	origin := readAllPackets(t, normal)
+	if video, audio := countPackets(pkgs); video != 21 || audio != 21 {
+		t.Fatalf("trim %d video %d audio", video, audio)
+	}
+	if !bytes.Equal(pkgs[0].Data, origin[24].Data) || pkgs[0].Dts != 0 {
+		t.Error("first packet should be the sample at 480ms")
+	}
+	src := readConvTestSource(t, out, false)
+	for _, track := range src.tracks {
+		edits := readConvTestEdits(t, track)
+		if len(edits) != 1 || edits[0].mediaTime != 20 || edits[0].segmentDuration != 800 {
+			t.Fatalf("track %d edits %+v", track.trackId, edits)
+		}
+	}
+
+	if err := Trim(bytes.NewReader(normal), io.Discard, 500, 500); err == nil {
+		t.Error("empty range should fail")
+	}
+	if err := Trim(bytes.NewReader(normal), io.Discard, 5000, 6000); err == nil {
+		t.Error("range without sample should fail")
+	}
+	if err := Trim(bytes.NewReader(makeTestMp4(t, testMp4{frames: 1, crash: true})), io.Discard, 0, 1000); err == nil {
+		t.Error("file without moov should fail")
+	}
+}
+
+func TestTrimSyncSample(t *testing.T) {
+	file := makeConvTestFile(t)
+	origin := readConvTestSource(t, file, false)
+	out := rewriteTestMp4(t, func(w io.Writer) error { return Trim(bytes.NewReader(file), w, 500, 1300) })
+	src := readConvTestSource(t, out, false)
+	//视频每10帧一个关键帧, 从400ms的关键帧开始, edit list跳过100ms
+	video := src.tracks[0]
+	if len(video.samples) != 23 || !video.samples[0].isSync() || video.samples[0].dts != 0 {
+		t.Fatalf("trim %d video samples", len(video.samples))
+	}
+	for i, sample := range video.samples {
+		want := origin.tracks[0].samples[i+10]
+		if sample.flags != want.flags || sample.cto != want.cto || !bytes.Equal(sample.aux, want.aux) || video.groups[0].index[i] != origin.tracks[0].groups[0].index[i+10] {
+			t.Fatalf("video sample %d mismatch", i)
+		}
+	}
+	if edits := readConvTestEdits(t, video); len(edits) != 1 || edits[0].mediaTime != 100 || edits[0].segmentDuration != 800 {
+		t.Fatalf("video edits %+v", edits)
+	}
+	if audio := src.tracks[1]; len(audio.samples) != 21 {
+		t.Fatalf("trim %d audio samples", len(audio.samples))
+	}
+}
+
+func TestTrimEditList(t *testing.T) {
+	file := makeTestMp4(t, testMp4{gop: 10, bframes: true, noAudio: true})
+	//B帧的显示时间整体延迟40ms, 原文件的edit list从media的40ms开始播放
+	elst := bytes.Index(file, []byte("elst"))
+	if file[elst+4] != 0 {
+		t.Fatal("elst should be version 0")
+	}
+	binary.BigEndian.PutUint32(file[elst+16:], 40)
+	if edits := readConvTestEdits(t, readConvTestSource(t, file, false).tracks[0]); edits[0].mediaTime != 40 {
+		t.Fatalf("source edits %+v", edits)
+	}
+	out := rewriteTestMp4(t, func(w io.Writer) error { return Trim(bytes.NewReader(file), w, 400, 800) })
+	//播放时间400ms对应media的440ms, 从dts 400ms的关键帧开始
+	origin := readAllPackets(t, file)
+	pkgs := readAllPackets(t, out)
+	if len(pkgs) != 11 || !bytes.Equal(pkgs[0].Data, origin[10].Data) || pkgs[0].Pts-pkgs[0].Dts != 40 {
+		t.Fatalf("trim %d packets", len(pkgs))
+	}
+	src := readConvTestSource(t, out, false)
+	if edits := readConvTestEdits(t, src.tracks[0]); len(edits) != 1 || edits[0].mediaTime != 40 || edits[0].segmentDuration != 400 {
+		t.Fatalf("video edits %+v", edits)
+	}
+}
+
+func TestMapTrimStart(t *testing.T) {
+	//movie timescale 1000, track timescale 90000, 空edit 100ms之后从media的40ms开始播放
+	edits := []elstEntry{
+		{segmentDuration: 100, mediaTime: -1, mediaRateInteger: 1},
+		{segmentDuration: 1000, mediaTime: 40 * 90, mediaRateInteger: 1},
+	}
+	tests := []struct {
+		start     uint64
+		mediaTime uint64
+		delay     uint64
+	}{
+		{0, 40, 100},
+		{50, 40, 50},
+		{100, 40, 0},
+		{300, 240, 0},
+		{2000, 1940, 0},
+	}
+	for _, tt := range tests {
+		mediaTime, delay := mapTrimStart(edits, 1000, 90000, tt.start*90)
+		if mediaTime != tt.mediaTime*90 || delay != tt.delay*90 {
+			t.Errorf("start %d: got media time %d delay %d", tt.start, mediaTime, delay)
+		}
+	}
+}
+
+func TestConcat(t *testing.T) {
+	normal := makeTestMp4(t, testMp4{})
+	out := rewriteTestMp4(t, func(w io.Writer) error { return Concat(w, bytes.NewReader(normal), bytes.NewReader(normal)) })
+	origin := readAllPackets(t, normal)
+	pkgs := readAllPackets(t, out)
+	if len(pkgs) != 2*len(origin) {
+		t.Fatalf("got %d packets, want %d", len(pkgs), 2*len(origin))
+	}
+	//第二个文件紧接着第一个文件的最后一个sample
+	offset := readConvTestSource(t, normal, false).tracks[0].endDts()
+	for i, pkg := range pkgs[len(origin):] {
+		if pkg.Cid != origin[i].Cid || pkg.Dts != origin[i].Dts+offset || !bytes.Equal(pkg.Data, origin[i].Data) {
+			t.Fatalf("packet %d mismatch", len(origin)+i)
+		}
+	}
+
+	//sample entry不同时增加stsd entry
+	patched := append([]byte{}, normal...)
+	stsd := bytes.Index(patched, []byte("stsd"))
+	avc1 := stsd + bytes.Index(patched[stsd:], []byte("avc1"))
+	patched[avc1+4+24]++
+	out = rewriteTestMp4(t, func(w io.Writer) error { return Concat(w, bytes.NewReader(normal), bytes.NewReader(patched)) })
+	src := readConvTestSource(t, out, false)
+	entries, _, err := src.tracks[0].sampleEntries()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 2 || src.tracks[0].samples[49].descIdx != 1 || src.tracks[0].samples[50].descIdx != 2 {
+		t.Fatalf("got %d sample entries", len(entries))
+	}
+	if entries, _, _ = src.tracks[1].sampleEntries(); len(entries) != 1 {
+		t.Fatalf("got %d audio sample entries", len(entries))
+	}
+}
+
+func TestConcatTrimmed(t *testing.T) {
+	clip := rewriteTestMp4(t, func(w io.Writer) error { return Trim(bytes.NewReader(makeConvTestFile(t)), w, 500, 1300) })
+	out := rewriteTestMp4(t, func(w io.Writer) error { return Concat(w, bytes.NewReader(clip), bytes.NewReader(clip)) })
+	src := readConvTestSource(t, out, false)
+	//第二个片段的media从920ms开始, edit list保留原来的入点
+	video := readConvTestEdits(t, src.tracks[0])
+	if len(video) != 2 || video[0].mediaTime != 100 || video[1].mediaTime != 1020 || video[1].segmentDuration != 800 {
+		t.Fatalf("video edits %+v", video)
+	}
+	if len(src.tracks[0].samples) != 46 || !src.tracks[0].samples[23].isSync() {
+		t.Fatalf("got %d video samples", len(src.tracks[0].samples))
+	}
+}
+
+func TestConcatErrors(t *testing.T) {
+	normal := makeTestMp4(t, testMp4{})
+	if err := Concat(io.Discard); err == nil {
+		t.Error("no input should fail")
+	}
+	//加密信息不同
+	if err := Concat(io.Discard, bytes.NewReader(normal), bytes.NewReader(makeConvTestFile(t))); err == nil {
+		t.Error("incompatible tracks should fail")
+	}
+}
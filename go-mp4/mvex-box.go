@@ -8,6 +8,13 @@ func makeMvex(muxer *Movmuxer) []byte {
 		_, boxData := trex.Encode()
 		trexs = append(trexs, boxData...)
 	}
+	if muxer.movFlag.isCrashSafe() {
+		//moov快照, 录制过程中更新fragment_duration
+		mehd := NewFullBox([4]byte{'m', 'e', 'h', 'd'}, 1)
+		mehd.Box.Size = 12 + 8
+		_, mehdData := mehd.Encode()
+		trexs = append(mehdData, trexs...)
+	}
 	mvex := BasicBox{Type: [4]byte{'m', 'v', 'e', 'x'}}
 	mvex.Size = 8 + uint64(len(trexs))
 	offset, mvexBox := mvex.Encode()
@@ -26,6 +26,9 @@ func (pssh *PsshBox) Decode(r io.Reader, size uint32) (offset int, err error) {
 	if offset, err = pssh.Box.Decode(r); err != nil {
 		return
 	}
+	if size < 12+20 {
+		return 0, errBoxTruncated("pssh")
+	}
 	buf := make([]byte, size-12)
 	if _, err = io.ReadFull(r, buf); err != nil {
 		return 0, err
@@ -36,6 +39,9 @@ func (pssh *PsshBox) Decode(r io.Reader, size uint32) (offset int, err error) {
 	if pssh.Box.Version > 0 {
 		kidCount := binary.BigEndian.Uint32(buf[n:])
 		n += 4
+		if uint64(kidCount)*16+4 > uint64(len(buf)-n) {
+			return 0, errBoxTruncated("pssh")
+		}
 		for i := uint32(0); i < kidCount; i++ {
 			var kid [16]byte
 			copy(kid[:], buf[n:n+16])
@@ -45,6 +51,9 @@ func (pssh *PsshBox) Decode(r io.Reader, size uint32) (offset int, err error) {
 	}
 	dataLen := binary.BigEndian.Uint32(buf[n:])
 	n += 4
+	if uint64(dataLen) > uint64(len(buf)-n) {
+		return 0, errBoxTruncated("pssh")
+	}
 	pssh.Data = buf[n:n+int(dataLen)]
 	return
 }
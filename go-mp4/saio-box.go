@@ -18,12 +18,18 @@ func (s *SaioBox) Decode(r io.Reader, size uint32) error {
  	if _, err := s.Box.Decode(r); err != nil {
 		return err
 	}
+	if size < 16 {
+		return errBoxTruncated("saio")
+	}
 	buf := make([]byte, size-12)
 	if _, err := io.ReadFull(r, buf); err != nil {
 		return err
 	}
 	var n int
 	flags := uint32(s.Box.Flags[0])<<16 | uint32(s.Box.Flags[1])<<8 | uint32(s.Box.Flags[2])
+	if flags&0x01 != 0 && len(buf) < 12 {
+		return errBoxTruncated("saio")
+	}
 	if flags&0x01 != 0 {
 		s.AuxInfoType = string(buf[n:n+4])
 		n += 4
@@ -32,6 +38,13 @@ func (s *SaioBox) Decode(r io.Reader, size uint32) error {
 	}
 	entryCount := binary.BigEndian.Uint32(buf[n:])
 	n += 4
+	entrySize := uint64(4)
+	if s.Box.Version != 0 {
+		entrySize = 8
+	}
+	if uint64(entryCount)*entrySize > uint64(len(buf)-n) {
+		return errBoxTruncated("saio")
+	}
 	if s.Box.Version == 0 {
 		for i := uint32(0); i < entryCount; i++ {
 			s.Offset = append(s.Offset, int64(binary.BigEndian.Uint32(buf[n:])))
@@ -63,13 +76,21 @@ func decodeSaioBox(demuxer *MovDemuxer, size uint32) error {
 		}
 		demuxer.reader.Seek(demuxer.moofOffset+saio.Offset[0], io.SeekStart)
 		saiz := demuxer.currentTrack.lastSaiz
+		if saiz == nil {
+			return errors.New("saio box without saiz box")
+		}
 		for i := uint32(0); i < saiz.SampleCount; i++ {
 			sampleSize := saiz.DefaultSampleInfoSize
 			if saiz.DefaultSampleInfoSize == 0 {
 				sampleSize = saiz.SampleInfo[i]
 			}
+			if sampleSize < 8 || (sampleSize > 8 && sampleSize < 10) {
+				return errBoxTruncated("saio sample info")
+			}
 			buf := make([]byte, sampleSize)
-			demuxer.reader.Read(buf)
+			if _, err = io.ReadFull(demuxer.reader, buf); err != nil {
+				return err
+			}
 			var se sencEntry
 			se.iv = make([]byte, 16)
 			copy(se.iv, buf[:8])
@@ -80,6 +101,9 @@ func decodeSaioBox(demuxer *MovDemuxer, size uint32) error {
 			n := 8
 			sampleCount := binary.BigEndian.Uint16(buf[n:])
 			n += 2
+			if int(sampleCount)*6 > len(buf)-n {
+				return errBoxTruncated("saio sample info")
+			}
 
 			se.subSamples = make([]subSampleEntry, sampleCount)
 			for j := 0; j < int(sampleCount); j++ {
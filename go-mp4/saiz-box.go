@@ -20,12 +20,18 @@ func (s *SaizBox) Decode(r io.Reader, size uint32) error {
 	if _, err := s.Box.Decode(r); err != nil {
 		return err
 	}
+	if size < 17 {
+		return errBoxTruncated("saiz")
+	}
 	buf := make([]byte, size-12)
 	if _, err := io.ReadFull(r, buf); err != nil {
 		return err
 	}
 	var n int
 	flags := uint32(s.Box.Flags[0])<<16 | uint32(s.Box.Flags[1])<<8 | uint32(s.Box.Flags[2])
+	if flags&0x01 != 0 && len(buf) < 13 {
+		return errBoxTruncated("saiz")
+	}
 	if flags&0x01 != 0 {
 		s.AuxInfoType = string(buf[n:n+4])
 		n += 4
@@ -39,6 +45,9 @@ func (s *SaizBox) Decode(r io.Reader, size uint32) error {
 	n += 4
 
 	if s.DefaultSampleInfoSize == 0 {
+		if uint64(s.SampleCount) > uint64(len(buf)-n) {
+			return errBoxTruncated("saiz")
+		}
 		for i := 0; i < int(s.SampleCount); i++ {
 			s.SampleInfo = append(s.SampleInfo, buf[n])
 			n += 1
@@ -1,6 +1,7 @@
 package mp4
 import (
 	"encoding/binary"
+	"errors"
 	"io"
 )
 
@@ -23,6 +24,9 @@ func (senc *SencBox) Decode(r io.Reader, size uint32, perSampleIVSize uint8) (of
 		return
 	}
 	senc.PerSampleIVSize = uint32(perSampleIVSize)
+	if size < 16 {
+		return 0, errBoxTruncated("senc")
+	}
 	buf := make([]byte, size-12)
     if _, err = io.ReadFull(r, buf); err != nil {
         return 0, err
@@ -33,9 +37,19 @@ func (senc *SencBox) Decode(r io.Reader, size uint32, perSampleIVSize uint8) (of
 	sencFlags := uint32(senc.Box.Flags[0])<<16 | uint32(senc.Box.Flags[1])<<8 | uint32(senc.Box.Flags[2])
 
 
+	//每个sample至少占用PerSampleIVSize个字节
+	if senc.PerSampleIVSize > 0 && uint64(senc.SampleCount)*uint64(senc.PerSampleIVSize) > uint64(len(buf)-n) {
+		return 0, errBoxTruncated("senc")
+	}
+	if sencFlags&UseSubsampleEncryption > 0 && uint64(senc.SampleCount)*2 > uint64(len(buf)-n) {
+		return 0, errBoxTruncated("senc")
+	}
 	senc.EntryList = new(movsenc)
 	senc.EntryList.entrys = make([]sencEntry, senc.SampleCount)
 	for i := 0; i < int(senc.SampleCount); i++ {
+		if int(senc.PerSampleIVSize) > len(buf)-n {
+			return 0, errBoxTruncated("senc")
+		}
 		senc.EntryList.entrys[i].iv = buf[n:n+int(senc.PerSampleIVSize)]
 		n += int(senc.PerSampleIVSize)
 
@@ -43,8 +57,14 @@ func (senc *SencBox) Decode(r io.Reader, size uint32, perSampleIVSize uint8) (of
         	continue
 		}
 
+		if len(buf)-n < 2 {
+			return 0, errBoxTruncated("senc")
+		}
 		subsampleCount := binary.BigEndian.Uint16(buf[n:])
 		n += 2
+		if int(subsampleCount)*6 > len(buf)-n {
+			return 0, errBoxTruncated("senc")
+		}
 
 		senc.EntryList.entrys[i].subSamples = make([]subSampleEntry, subsampleCount)
 		for j := uint16(0); j < subsampleCount; j++ {
@@ -60,6 +80,9 @@ func (senc *SencBox) Decode(r io.Reader, size uint32, perSampleIVSize uint8) (of
 }
 
 func decodeSencBox(demuxer *MovDemuxer, size uint32) (err error) {
+	if demuxer.currentTrack == nil {
+		return errors.New("current track is nil")
+	}
 	perSampleIVSize := demuxer.tracks[len(demuxer.tracks)-1].defaultPerSampleIVSize
 	senc := SencBox{Box: new(FullBox)}
 	if _, err = senc.Decode(demuxer.reader, size, perSampleIVSize); err != nil {
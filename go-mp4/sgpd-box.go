@@ -32,6 +32,9 @@ type SgpdBox struct {
 
 
 func decodeSgpdBox(demuxer *MovDemuxer, size uint32) (err error) {
+	if size < BasicBoxLen+12 {
+		return errBoxTruncated("sgpd")
+	}
 	buf := make([]byte, size-BasicBoxLen)
 	if _, err = io.ReadFull(demuxer.reader, buf); err != nil {
 		return
@@ -48,6 +51,16 @@ func decodeSgpdBox(demuxer *MovDemuxer, size uint32) (err error) {
 	b.GroupingType = string(buf[n:n+4])
 	n += 4
 
+	needSize := 12
+	if b.Version >= 1 {
+		needSize += 4
+	}
+	if b.Version >= 2 {
+		needSize += 4
+	}
+	if len(buf) < needSize {
+		return errBoxTruncated("sgpd")
+	}
 	if b.Version >= 1 {
 		b.DefaultLength = binary.BigEndian.Uint32(buf[n:])
 		n += 4
@@ -59,10 +72,16 @@ func decodeSgpdBox(demuxer *MovDemuxer, size uint32) (err error) {
 	entryCount := int(binary.BigEndian.Uint32(buf[n:]))
 	n += 4
 
+	if _, ok := sgeDecoders[b.GroupingType]; !ok {
+		return nil
+	}
 	track := demuxer.tracks[len(demuxer.tracks)-1]
 	for i := 0; i < entryCount; i++ {
 		var descriptionLength = b.DefaultLength
 		if b.Version >= 1 && b.DefaultLength == 0 {
+			if len(buf)-n < 4 {
+				return errBoxTruncated("sgpd")
+			}
 			descriptionLength = binary.BigEndian.Uint32(buf[n:])
 			n += 4
 			b.DescriptionLengths = append(b.DescriptionLengths, descriptionLength)
@@ -105,6 +124,9 @@ func decodeSampleGroupEntry(name string, length uint32, buf []byte) (interface{}
 // DecodeSeigSampleGroupEntry - decode Common Encryption Sample Group Entry
 func DecodeSeigSampleGroupEntry(name string, length uint32, buf []byte) (interface{}, int, error) {
 	s := &SeigSampleGroupEntry{}
+	if len(buf) < 20 {
+		return nil, 0, errBoxTruncated("sgpd seig")
+	}
 	n := 0
 	n += 1 // Reserved
 	byteTwo := buf[n]
@@ -123,6 +145,9 @@ func DecodeSeigSampleGroupEntry(name string, length uint32, buf []byte) (interfa
 	n += 16
 
 	if s.IsProtected == 1 && s.PerSampleIVSize == 0 {
+		if len(buf) < 21 || int(buf[n]) > len(buf)-21 {
+			return nil, 0, errBoxTruncated("sgpd seig")
+		}
 		constantIVSize := int(buf[n])
 		n += 1
 		s.ConstantIV = buf[n:n+constantIVSize]
@@ -50,11 +50,11 @@ func (stco *ChunkOffsetBox) Decode(r io.Reader) (offset int, err error) {
 	offset = 8
 	stco.stco = new(movstco)
 	stco.stco.entryCount = binary.BigEndian.Uint32(tmp)
-	stco.stco.chunkOffsetlist = make([]uint64, stco.stco.entryCount)
-	buf := make([]byte, stco.stco.entryCount*4)
-	if _, err = io.ReadFull(r, buf); err != nil {
+	buf, err := readBoxData(r, uint64(stco.stco.entryCount)*4)
+	if err != nil {
 		return
 	}
+	stco.stco.chunkOffsetlist = make([]uint64, stco.stco.entryCount)
 	idx := 0
 	for i := 0; i < int(stco.stco.entryCount); i++ {
 		stco.stco.chunkOffsetlist[i] = uint64(binary.BigEndian.Uint32(buf[idx:]))
@@ -106,11 +106,11 @@ func (co64 *ChunkLargeOffsetBox) Decode(r io.Reader) (offset int, err error) {
 	offset = 8
 	co64.stco = new(movstco)
 	co64.stco.entryCount = binary.BigEndian.Uint32(tmp)
-	co64.stco.chunkOffsetlist = make([]uint64, co64.stco.entryCount)
-	buf := make([]byte, co64.stco.entryCount*8)
-	if _, err = io.ReadFull(r, buf); err != nil {
+	buf, err := readBoxData(r, uint64(co64.stco.entryCount)*8)
+	if err != nil {
 		return
 	}
+	co64.stco.chunkOffsetlist = make([]uint64, co64.stco.entryCount)
 	idx := 0
 	for i := 0; i < int(co64.stco.entryCount); i++ {
 		co64.stco.chunkOffsetlist[i] = binary.BigEndian.Uint64(buf[idx:])
@@ -134,7 +134,14 @@ func (co64 *ChunkLargeOffsetBox) Encode() (int, []byte) {
 
 func makeStco(stco *movstco) (boxdata []byte) {
 
-	if stco.entryCount > 0 && stco.chunkOffsetlist[stco.entryCount-1] > 0xFFFFFFFF {
+	large := false
+	for _, offset := range stco.chunkOffsetlist {
+		if offset > 0xFFFFFFFF {
+			large = true
+			break
+		}
+	}
+	if large {
 		co64 := NewChunkLargeOffsetBox()
 		co64.stco = stco
 		_, boxdata = co64.Encode()
@@ -43,11 +43,11 @@ func (stsc *SampleToChunkBox) Decode(r io.Reader) (offset int, err error) {
     }
     stsc.stscentrys = new(movstsc)
     stsc.stscentrys.entryCount = binary.BigEndian.Uint32(tmp)
-    stsc.stscentrys.entrys = make([]stscEntry, stsc.stscentrys.entryCount)
-    buf := make([]byte, stsc.stscentrys.entryCount*12)
-    if _, err = io.ReadFull(r, buf); err != nil {
+    buf, err := readBoxData(r, uint64(stsc.stscentrys.entryCount)*12)
+    if err != nil {
         return
     }
+    stsc.stscentrys.entrys = make([]stscEntry, stsc.stscentrys.entryCount)
     offset = 8
     idx := 0
     for i := 0; i < int(stsc.stscentrys.entryCount); i++ {
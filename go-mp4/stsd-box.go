@@ -4,6 +4,8 @@ import (
     "encoding/binary"
     "fmt"
     "io"
+
+    "github.com/yapingcat/gomedia/go-codec"
 )
 
 // aligned(8) abstract class SampleEntry (unsigned int(32) format) extends Box(format){
@@ -314,7 +316,8 @@ func makeStsd(track *mp4track, handler_type HandlerType) []byte {
     var avbox []byte
     var extraData []byte
     if len(track.extraData) == 0 {
-        if track.cid == MP4_CODEC_AAC || track.cid == MP4_CODEC_H264 || track.cid == MP4_CODEC_H265 {
+        if track.cid == MP4_CODEC_AAC || track.cid == MP4_CODEC_H264 || track.cid == MP4_CODEC_H265 ||
+            track.cid == MP4_CODEC_AC3 || track.cid == MP4_CODEC_EAC3 || track.cid == MP4_CODEC_FLAC {
             if track.extra == nil {
                 panic(fmt.Sprintf("track %d:extra is nil", track.trackId))
             }
@@ -332,6 +335,12 @@ func makeStsd(track *mp4track, handler_type HandlerType) []byte {
         avbox = makeEsdsBox(track.trackId, track.cid, extraData)
     } else if track.cid == MP4_CODEC_OPUS {
         avbox = makeOpusSpecificBox(extraData)
+    } else if track.cid == MP4_CODEC_AC3 {
+        avbox = makeDac3Box(extraData)
+    } else if track.cid == MP4_CODEC_EAC3 {
+        avbox = makeDec3Box(extraData)
+    } else if track.cid == MP4_CODEC_FLAC {
+        avbox = makeDflaBox(extraData)
     }
 
     var se []byte
@@ -346,6 +355,10 @@ func makeStsd(track *mp4track, handler_type HandlerType) []byte {
         entry := NewAudioSampleEntry(getCodecNameWithCodecId(track.cid))
         entry.channelcount = uint16(track.chanelCount)
         entry.samplerate = track.sampleRate
+        if track.cid == MP4_CODEC_FLAC && track.sampleRate > 0xFFFF {
+            //采样率以dfLa中的STREAMINFO为准
+            entry.samplerate = 0
+        }
         entry.samplesize = uint16(track.sampleBits)
         entry.entry.box.Size = entry.Size() + uint64(len(avbox))
         offset, se = entry.Encode()
@@ -401,6 +414,9 @@ func decodeHvccBox(demuxer *MovDemuxer, size uint32) (err error) {
         return
     }
     track := demuxer.tracks[len(demuxer.tracks)-1]
+    if track.extra == nil {
+        track.extra = newh265ExtraData()
+    }
     track.extra.load(buf)
     return
 }
@@ -419,12 +435,18 @@ func decodeEsdsBox(demuxer *MovDemuxer, size uint32) (err error) {
     if _, err = esds.Decode(demuxer.reader); err != nil {
         return
     }
+    if size < FullBoxLen {
+        return fmt.Errorf("mp4 esds box: %w", codec.ErrTruncated)
+    }
     buf := make([]byte, size-FullBoxLen)
     if _, err = io.ReadFull(demuxer.reader, buf); err != nil {
         return
     }
     track := demuxer.tracks[len(demuxer.tracks)-1]
-    vosdata := decodeESDescriptor(buf, track)
+    vosdata, err := decodeESDescriptor(buf, track)
+    if err != nil {
+        return err
+    }
     if track.extra != nil {
         track.extra.load(vosdata)
     }
@@ -54,11 +54,11 @@ func (stss *SyncSampleBox) Decode(r io.Reader) (offset int, err error) {
 	}
 	offset = 8
 	entry_count := binary.BigEndian.Uint32(tmp[:])
-	stss.entrys = make([]uint32, entry_count)
-	buf := make([]byte, entry_count*4)
-	if _, err = io.ReadFull(r, buf); err != nil {
+	buf, err := readBoxData(r, uint64(entry_count)*4)
+	if err != nil {
 		return
 	}
+	stss.entrys = make([]uint32, entry_count)
 	idx := 0
 	for i := 0; i < int(entry_count); i++ {
 		stss.entrys[i] = binary.BigEndian.Uint32(buf[idx:])
@@ -49,8 +49,8 @@ func (stsz *SampleSizeBox) Decode(r io.Reader) (offset int, err error) {
     stsz.stsz.sampleSize = binary.BigEndian.Uint32(tmp[:])
     stsz.stsz.sampleCount = binary.BigEndian.Uint32(tmp[4:])
     if stsz.stsz.sampleSize == 0 {
-        buf := make([]byte, stsz.stsz.sampleCount*4)
-        if _, err = io.ReadFull(r, buf); err != nil {
+        var buf []byte
+        if buf, err = readBoxData(r, uint64(stsz.stsz.sampleCount)*4); err != nil {
             return
         }
         idx := 0
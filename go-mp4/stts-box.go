@@ -44,11 +44,11 @@ func (stts *TimeToSampleBox) Decode(r io.Reader) (offset int, err error) {
     offset = 8
     stts.entryList = new(movstts)
     stts.entryList.entryCount = binary.BigEndian.Uint32(entryCountBuf)
-    stts.entryList.entrys = make([]sttsEntry, stts.entryList.entryCount)
-    buf := make([]byte, stts.entryList.entryCount*8)
-    if _, err = io.ReadFull(r, buf); err != nil {
+    buf, err := readBoxData(r, uint64(stts.entryList.entryCount)*8)
+    if err != nil {
         return
     }
+    stts.entryList.entrys = make([]sttsEntry, stts.entryList.entryCount)
     idx := 0
     for i := 0; i < int(stts.entryList.entryCount); i++ {
         stts.entryList.entrys[i].sampleCount = binary.BigEndian.Uint32(buf[idx:])
@@ -6,6 +6,9 @@ import (
 )
 
 func decodeTencBox(demuxer *MovDemuxer, size uint32) (err error) {
+	if size < BasicBoxLen+24 {
+		return errBoxTruncated("tenc")
+	}
 	buf := make([]byte, size-BasicBoxLen)
 	if _, err = io.ReadFull(demuxer.reader, buf); err != nil {
 		return
@@ -28,6 +31,9 @@ func decodeTencBox(demuxer *MovDemuxer, size uint32) (err error) {
 	copy(track.defaultKID[:], buf[n:n+16])
 	n += 16
 	if track.defaultIsProtected == 1 && track.defaultPerSampleIVSize == 0 {
+		if n >= len(buf) || int(buf[n]) > len(buf)-n-1 {
+			return errBoxTruncated("tenc")
+		}
 		defaultConstantIVSize := int(buf[n])
 		n += 1
 		track.defaultConstantIV = make([]byte, defaultConstantIVSize)
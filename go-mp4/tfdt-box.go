@@ -34,6 +34,9 @@ func (tfdt *TrackFragmentBaseMediaDecodeTimeBox) Decode(r io.Reader, size uint32
         return
     }
 
+    if size < 16 || (tfdt.Box.Version == 1 && size < 20) {
+        return 0, errBoxTruncated("tfdt")
+    }
     buf := make([]byte, size-12)
     if _, err = io.ReadFull(r, buf); err != nil {
         return 0, err
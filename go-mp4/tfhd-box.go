@@ -3,6 +3,7 @@ package mp4
 import (
     "encoding/binary"
     "io"
+    "math/bits"
 )
 
 // aligned(8) class TrackFragmentHeaderBox extends FullBox(‘tfhd’, 0, tf_flags){
@@ -80,6 +81,9 @@ func (tfhd *TrackFragmentHeaderBox) Decode(r io.Reader, size uint32, moofOffset
     if offset, err = tfhd.Box.Decode(r); err != nil {
         return
     }
+    if size < 16 {
+        return 0, errBoxTruncated("tfhd")
+    }
     buf := make([]byte, size-12)
     if _, err = io.ReadFull(r, buf); err != nil {
         return 0, err
@@ -88,6 +92,11 @@ func (tfhd *TrackFragmentHeaderBox) Decode(r io.Reader, size uint32, moofOffset
     tfhd.Track_ID = binary.BigEndian.Uint32(buf[n:])
     n += 4
     tfhdFlags := uint32(tfhd.Box.Flags[0])<<16 | uint32(tfhd.Box.Flags[1])<<8 | uint32(tfhd.Box.Flags[2])
+    needSize := 4 + 8*bits.OnesCount32(tfhdFlags&TF_FLAG_BASE_DATA_OFFSET)
+    needSize += 4 * bits.OnesCount32(tfhdFlags&(TF_FLAG_SAMPLE_DESCRIPTION_INDEX_PRESENT|TF_FLAG_DEFAULT_SAMPLE_DURATION_PRESENT|TF_FLAG_DEFAULT_SAMPLE_SIZE_PRESENT|TF_FLAG_DEAAULT_SAMPLE_FLAGS_PRESENT))
+    if len(buf) < needSize {
+        return 0, errBoxTruncated("tfhd")
+    }
     if tfhdFlags&uint32(TF_FLAG_BASE_DATA_OFFSET) > 0 {
         tfhd.BaseDataOffset = binary.BigEndian.Uint64(buf[n:])
         n += 8
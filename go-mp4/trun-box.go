@@ -3,9 +3,15 @@ package mp4
 import (
     "encoding/binary"
     "errors"
+    "fmt"
     "io"
+    "math/bits"
+
+    "github.com/yapingcat/gomedia/go-codec"
 )
 
+const maxTrunDefaultSamples = 1 << 20
+
 // aligned(8) class TrackRunBox extends FullBox(‘trun’, version, tr_flags) {
 //      unsigned int(32) sample_count;
 //      // the following are optional fields
@@ -79,6 +85,9 @@ func (trun *TrackRunBox) Decode(r io.Reader, size uint32, dataOffset uint32) (of
     if offset, err = trun.Box.Decode(r); err != nil {
         return
     }
+    if size < 16 {
+        return 0, errBoxTruncated("trun")
+    }
     buf := make([]byte, size-12)
     if _, err = io.ReadFull(r, buf); err != nil {
         return 0, err
@@ -87,6 +96,15 @@ func (trun *TrackRunBox) Decode(r io.Reader, size uint32, dataOffset uint32) (of
     trun.SampleCount = binary.BigEndian.Uint32(buf[n:])
     n += 4
     trunFlags := uint32(trun.Box.Flags[0])<<16 | uint32(trun.Box.Flags[1])<<8 | uint32(trun.Box.Flags[2])
+    headSize := 4 + 4*bits.OnesCount32(trunFlags&(TR_FLAG_DATA_OFFSET|TR_FLAG_DATA_FIRST_SAMPLE_FLAGS))
+    entrySize := 4 * bits.OnesCount32(trunFlags&(TR_FLAG_DATA_SAMPLE_DURATION|TR_FLAG_DATA_SAMPLE_SIZE|TR_FLAG_DATA_SAMPLE_FLAGS|TR_FLAG_DATA_SAMPLE_COMPOSITION_TIME))
+    if uint64(headSize)+uint64(trun.SampleCount)*uint64(entrySize) > uint64(len(buf)) {
+        return 0, fmt.Errorf("mp4 trun box: %w: sample count %d", codec.ErrTruncated, trun.SampleCount)
+    }
+    //所有sample都使用默认值时没有办法根据box大小判断sample count是否合理
+    if entrySize == 0 && trun.SampleCount > maxTrunDefaultSamples {
+        return 0, fmt.Errorf("mp4 trun box: %w: sample count %d", codec.ErrInvalidData, trun.SampleCount)
+    }
 
     if trunFlags&uint32(TR_FLAG_DATA_OFFSET) > 0 {
         trun.Dataoffset = int32(binary.BigEndian.Uint32(buf[n:]))
@@ -168,6 +186,10 @@ func decodeTrunBox(demuxer *MovDemuxer, size uint32) (err error) {
     if demuxer.currentTrack == nil {
         return errors.New("current track is nil")
     }
+    //每个sample至少占用一个字节
+    if uint64(len(demuxer.currentTrack.samplelist))+uint64(trun.SampleCount) > uint64(demuxer.fileSize) {
+        return fmt.Errorf("mp4 trun box: %w: too many samples", codec.ErrInvalidData)
+    }
 
     dataOffset := trun.Dataoffset
     nextDts := demuxer.currentTrack.startDts
@@ -0,0 +1,63 @@
+package mpeg2
+
+import (
+    "bytes"
+    "testing"
+)
+
+// go test -run=^$ -fuzz=FuzzXXX
+// 只检查不会panic, 解析结果不做校验
+
+var fuzzH264Frame = []byte{0x00, 0x00, 0x00, 0x01, 0x67, 0x42, 0xC0, 0x1E, 0xDA, 0x02, 0x80, 0xBF, 0xE5, 0x84, 0x00, 0x00, 0x03, 0x00, 0x04, 0x00, 0x00, 0x03, 0x00, 0xF0, 0x3C, 0x58, 0xB9, 0x20,
+    0x00, 0x00, 0x00, 0x01, 0x68, 0xCE, 0x3C, 0x80, 0x00, 0x00, 0x00, 0x01, 0x65, 0x88, 0x84, 0x00, 0x33, 0xFF}
+
+var fuzzAACFrame = []byte{0xFF, 0xF1, 0x50, 0x80, 0x01, 0x3F, 0xFC, 0x21, 0x00}
+
+func FuzzTSDemuxer(f *testing.F) {
+    var ts []byte
+    muxer := NewTSMuxer()
+    muxer.OnPacket = func(pkg []byte) {
+        ts = append(ts, pkg...)
+    }
+    vpid := muxer.AddStream(TS_STREAM_H264)
+    apid := muxer.AddStream(TS_STREAM_AAC)
+    muxer.Write(vpid, fuzzH264Frame, 0, 0)
+    muxer.Write(apid, fuzzAACFrame, 0, 0)
+    muxer.Write(vpid, fuzzH264Frame, 3600, 3600)
+    f.Add(ts)
+    f.Add(ts[:188*2])
+    f.Fuzz(func(t *testing.T, data []byte) {
+        demuxer := NewTSDemuxer()
+        demuxer.OnFrame = func(cid TS_STREAM_TYPE, frame []byte, pts uint64, dts uint64) {}
+        demuxer.OnTSPacket = func(pkg *TSPacket) {}
+        demuxer.Input(bytes.NewReader(data))
+    })
+}
+
+func FuzzPSDemuxer(f *testing.F) {
+    var ps []byte
+    muxer := NewPsMuxer()
+    muxer.OnPacket = func(pkg []byte) {
+        ps = append(ps, pkg...)
+    }
+    vsid := muxer.AddStream(PS_STREAM_H264)
+    asid := muxer.AddStream(PS_STREAM_G711A)
+    muxer.Write(vsid, fuzzH264Frame, 0, 0)
+    muxer.Write(asid, bytes.Repeat([]byte{0xD5}, 160), 0, 0)
+    muxer.Write(vsid, fuzzH264Frame, 3600, 3600)
+    f.Add(ps)
+    f.Add(ps2)
+    f.Add(ps5)
+    f.Add(ps6)
+    f.Fuzz(func(t *testing.T, data []byte) {
+        demuxer := NewPSDemuxer()
+        demuxer.OnFrame = func(frame []byte, cid PS_STREAM_TYPE, pts uint64, dts uint64) {}
+        demuxer.OnPacket = func(pkg Display, decodeResult error) {}
+        //分两次输入, 覆盖cache的逻辑
+        half := len(data) / 2
+        if demuxer.Input(data[:half]) == nil {
+            demuxer.Input(data[half:])
+        }
+        demuxer.Flush()
+    })
+}
@@ -83,7 +83,9 @@ func (psdemuxer *PSDemuxer) Input(data []byte) error {
             }
         case 0x000001BB: //system header
             if psdemuxer.pkg.Header == nil {
-                panic("psdemuxer.pkg.Header must not be nil")
+                //system header必须跟在pack header之后
+                ret = errParser
+                break
             }
             if psdemuxer.pkg.System == nil {
                 psdemuxer.pkg.System = new(System_header)
@@ -215,7 +217,7 @@ func (psdemuxer *PSDemuxer) guessCodecid(stream *psstream) {
 
 func (psdemuxer *PSDemuxer) demuxPespacket(stream *psstream, pes *PesPacket) error {
     switch stream.cid {
-    case PS_STREAM_AAC, PS_STREAM_G711A, PS_STREAM_G711U:
+    case PS_STREAM_AAC, PS_STREAM_G711A, PS_STREAM_G711U, PS_STREAM_G722, PS_STREAM_G726:
         return psdemuxer.demuxAudio(stream, pes)
     case PS_STREAM_H264, PS_STREAM_H265:
         return psdemuxer.demuxH26x(stream, pes)
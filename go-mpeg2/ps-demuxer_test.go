@@ -1,7 +1,11 @@
 package mpeg2
 
 import (
+	"bytes"
+	"errors"
 	"testing"
+
+	"github.com/yapingcat/gomedia/go-codec"
 )
 
 var ps1 []byte = []byte{0x00, 0x00, 0x01, 0xBA}
@@ -78,3 +82,63 @@ func TestPSDemuxer_Input(t *testing.T) {
 		})
 	}
 }
+
+func TestPSDemuxer_G72x(t *testing.T) {
+	tests := []struct {
+		name string
+		cid  PS_STREAM_TYPE
+	}{
+		{name: "g722", cid: PS_STREAM_G722},
+		{name: "g726", cid: PS_STREAM_G726},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			muxer := NewPsMuxer()
+			var ps []byte
+			muxer.OnPacket = func(pkg []byte) {
+				ps = append(ps, pkg...)
+			}
+			sid := muxer.AddStream(tt.cid)
+			frames := [][]byte{bytes.Repeat([]byte{0x11}, 160), bytes.Repeat([]byte{0x22}, 160)}
+			for i, frame := range frames {
+				if err := muxer.Write(sid, frame, uint64(100+i*20), uint64(100+i*20)); err != nil {
+					t.Fatal(err)
+				}
+			}
+			var got [][]byte
+			demuxer := NewPSDemuxer()
+			demuxer.OnFrame = func(frame []byte, cid PS_STREAM_TYPE, pts uint64, dts uint64) {
+				if cid != tt.cid || pts != uint64(100+len(got)*20) {
+					t.Errorf("cid %#x pts %d", cid, pts)
+				}
+				got = append(got, append([]byte{}, frame...))
+			}
+			if err := demuxer.Input(ps); err != nil {
+				t.Fatal(err)
+			}
+			demuxer.Flush()
+			if len(got) != 2 || !bytes.Equal(got[0], frames[0]) || !bytes.Equal(got[1], frames[1]) {
+				t.Errorf("got %d frames", len(got))
+			}
+		})
+	}
+}
+
+func TestPSDemuxer_Malformed(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want error
+	}{
+		{name: "system header without pack header", data: []byte{0x00, 0x00, 0x01, 0xBB, 0x00, 0x06, 0x80, 0x00, 0x01, 0x00, 0x21, 0xFF}, want: codec.ErrInvalidData},
+		{name: "truncated pack header", data: ps1, want: codec.ErrTruncated},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			demuxer := NewPSDemuxer()
+			if err := demuxer.Input(tt.data); !errors.Is(err, tt.want) {
+				t.Errorf("PSDemuxer.Input() error = %v, want %v", err, tt.want)
+			}
+		})
+	}
+}
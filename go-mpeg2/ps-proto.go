@@ -22,6 +22,7 @@ func (e *needmoreError) Error() string          { return "need more bytes" }
 func (e *needmoreError) NeedMore() bool         { return true }
 func (e *needmoreError) ParserError() bool      { return false }
 func (e *needmoreError) StreamIdNotFound() bool { return false }
+func (e *needmoreError) Unwrap() error          { return codec.ErrTruncated }
 
 var errParser error = &parserError{}
 
@@ -31,6 +32,7 @@ func (e *parserError) Error() string          { return "parser packet error" }
 func (e *parserError) NeedMore() bool         { return false }
 func (e *parserError) ParserError() bool      { return true }
 func (e *parserError) StreamIdNotFound() bool { return false }
+func (e *parserError) Unwrap() error          { return codec.ErrInvalidData }
 
 var errNotFound error = &sidNotFoundError{}
 
@@ -50,6 +52,8 @@ const (
     PS_STREAM_H265   PS_STREAM_TYPE = 0x24
     PS_STREAM_G711A  PS_STREAM_TYPE = 0x90
     PS_STREAM_G711U  PS_STREAM_TYPE = 0x91
+    PS_STREAM_G722   PS_STREAM_TYPE = 0x92
+    PS_STREAM_G726   PS_STREAM_TYPE = 0x96 //GB28181未定义G726, 这里使用私有值
 )
 
 // Table 2-33 – Program Stream pack header
@@ -98,7 +102,7 @@ func (ps_pkg_hdr *PSPackHeader) Decode(bs *codec.BitStream) error {
         return errNeedMore
     }
     if bs.Uint32(32) != 0x000001BA {
-        panic("ps header must start with 000001BA")
+        return errParser
     }
 
     if bs.NextBits(2) == 0x01 { //mpeg2
@@ -273,7 +277,7 @@ func (sh *System_header) Decode(bs *codec.BitStream) error {
         return errNeedMore
     }
     if bs.Uint32(32) != 0x000001BB {
-        panic("system header must start with 000001BB")
+        return errParser
     }
     sh.Header_length = bs.Uint16(16)
     if bs.RemainBytes() < int(sh.Header_length) {
@@ -375,6 +379,10 @@ func (psm *Program_stream_map) PrettyPrint(file *os.File) {
             file.WriteString("    stream_type:G711A\n")
         } else if es.Stream_type == uint8(PS_STREAM_G711U) {
             file.WriteString("    stream_type:G711U\n")
+        } else if es.Stream_type == uint8(PS_STREAM_G722) {
+            file.WriteString("    stream_type:G722\n")
+        } else if es.Stream_type == uint8(PS_STREAM_G726) {
+            file.WriteString("    stream_type:G726\n")
         } else if es.Stream_type == uint8(PS_STREAM_H264) {
             file.WriteString("    stream_type:H264\n")
         } else if es.Stream_type == uint8(PS_STREAM_H265) {
@@ -416,11 +424,11 @@ func (psm *Program_stream_map) Decode(bs *codec.BitStream) error {
         return errNeedMore
     }
     if bs.Uint32(24) != 0x000001 {
-        panic("program stream map must startwith 0x000001")
+        return errParser
     }
     psm.Map_stream_id = bs.Uint8(8)
     if psm.Map_stream_id != 0xBC {
-        panic("map stream id must be 0xBC")
+        return errParser
     }
     psm.Program_stream_map_length = bs.Uint16(16)
     if bs.RemainBytes() < int(psm.Program_stream_map_length) {
@@ -479,7 +487,7 @@ func (psd *Program_stream_directory) Decode(bs *codec.BitStream) error {
         return errNeedMore
     }
     if bs.Uint32(32) != 0x000001FF {
-        panic("program stream directory 000001FF")
+        return errParser
     }
     psd.PES_packet_length = bs.Uint16(16)
     if bs.RemainBytes() < int(psd.PES_packet_length) {
@@ -5,8 +5,12 @@ import (
     "io"
 
     "github.com/yapingcat/gomedia/go-codec"
+    "github.com/yapingcat/gomedia/go-timebase"
 )
 
+// 相邻两帧dts的间隔超过10秒认为时间戳不连续
+const tsDiscontinuityThreshold = 10000
+
 type pakcet_t struct {
     payload []byte
     pts     uint64
@@ -22,21 +26,27 @@ func newPacket_t(size uint32) *pakcet_t {
 }
 
 type tsstream struct {
-    cid     TS_STREAM_TYPE
-    pes_sid PES_STREMA_ID
-    pes_pkg *PesPacket
-    pkg     *pakcet_t
+    cid       TS_STREAM_TYPE
+    pes_sid   PES_STREMA_ID
+    pes_pkg   *PesPacket
+    pkg       *pakcet_t
+    unwrapper *timebase.Unwrapper
+    detector  *timebase.DiscontinuityDetector
 }
 
 type tsprogram struct {
-    pn      uint16
-    streams map[uint16]*tsstream
+    pn        uint16
+    streams   map[uint16]*tsstream
+    unwrapper *timebase.Unwrapper //同一个节目的流共用, 回绕之后音视频时间戳仍然同步
 }
 
 type TSDemuxer struct {
-    programs   map[uint16]*tsprogram
+    programs map[uint16]*tsprogram
+    //pts/dts 为毫秒, 33bit回绕之后继续递增
     OnFrame    func(cid TS_STREAM_TYPE, frame []byte, pts uint64, dts uint64)
     OnTSPacket func(pkg *TSPacket)
+    //相邻两帧dts的跳变超过10秒时回调, delta单位为毫秒
+    OnDiscontinuity func(cid TS_STREAM_TYPE, delta int64)
 }
 
 func NewTSDemuxer() *TSDemuxer {
@@ -86,7 +96,7 @@ func (demuxer *TSDemuxer) Input(r io.Reader) error {
             for _, pmt := range pat.Pmts {
                 if pmt.Program_number != 0x0000 {
                     if _, found := demuxer.programs[pmt.PID]; !found {
-                        demuxer.programs[pmt.PID] = &tsprogram{pn: 0, streams: make(map[uint16]*tsstream)}
+                        demuxer.programs[pmt.PID] = &tsprogram{pn: 0, streams: make(map[uint16]*tsstream), unwrapper: timebase.NewPTSUnwrapper()}
                     }
                 }
             }
@@ -107,9 +117,11 @@ func (demuxer *TSDemuxer) Input(r io.Reader) error {
                     for _, ps := range pmt.Streams {
                         if _, found := s.streams[ps.Elementary_PID]; !found {
                             s.streams[ps.Elementary_PID] = &tsstream{
-                                cid:     TS_STREAM_TYPE(ps.StreamType),
-                                pes_sid: findPESIDByStreamType(TS_STREAM_TYPE(ps.StreamType)),
-                                pes_pkg: NewPesPacket(),
+                                cid:       ps.CodecStreamType(),
+                                pes_sid:   findPESIDByStreamType(ps.CodecStreamType()),
+                                pes_pkg:   NewPesPacket(),
+                                unwrapper: s.unwrapper,
+                                detector:  timebase.NewDiscontinuityDetector(tsDiscontinuityThreshold),
                             }
                         }
                     }
@@ -130,7 +142,7 @@ func (demuxer *TSDemuxer) Input(r io.Reader) error {
                             pkg.Payload = bs.RemainData()
                         }
                         stype := findPESIDByStreamType(stream.cid)
-                        if stype == PES_STREAM_AUDIO {
+                        if stype == PES_STREAM_AUDIO || stream.cid == TS_STREAM_AC3 || stream.cid == TS_STREAM_EAC3 {
                             demuxer.doAudioPesPacket(stream, pkg.Payload_unit_start_indicator)
                         } else if stype == PES_STREAM_VIDEO {
                             demuxer.doVideoPesPacket(stream, pkg.Payload_unit_start_indicator)
@@ -195,28 +207,32 @@ func (demuxer *TSDemuxer) flush() {
                 continue
             }
             if stream.cid == TS_STREAM_H264 || stream.cid == TS_STREAM_H265 {
-                audLen := 0
-                codec.SplitFrameWithStartCode(stream.pkg.payload, func(nalu []byte) bool {
-                    if stream.cid == TS_STREAM_H264 {
-                        if codec.H264NaluType(nalu) == codec.H264_NAL_AUD {
-                            audLen += len(nalu)
-                        }
-                    } else {
-                        if codec.H265NaluType(nalu) == codec.H265_NAL_AUD {
-                            audLen += len(nalu)
-                        }
-                    }
-                    return false
-                })
-                demuxer.OnFrame(stream.cid, stream.pkg.payload[audLen:], stream.pkg.pts/90, stream.pkg.dts/90)
+                demuxer.onFrame(stream, trimLeadingAUD(stream.cid, stream.pkg.payload))
             } else {
-                demuxer.OnFrame(stream.cid, stream.pkg.payload, stream.pkg.pts/90, stream.pkg.dts/90)
+                demuxer.onFrame(stream, stream.pkg.payload)
             }
             stream.pkg = nil
         }
     }
 }
 
+// 展开33bit的pts/dts, 转换为毫秒
+func (demuxer *TSDemuxer) onFrame(stream *tsstream, frame []byte) {
+    dts := timebase.Rescale(stream.unwrapper.Unwrap(stream.pkg.dts), timebase.MPEG_90K, timebase.MILLISECOND)
+    pts := timebase.Rescale(stream.unwrapper.Unwrap(stream.pkg.pts), timebase.MPEG_90K, timebase.MILLISECOND)
+    if delta, discontinuous := stream.detector.Check(dts); discontinuous && demuxer.OnDiscontinuity != nil {
+        demuxer.OnDiscontinuity(stream.cid, delta)
+    }
+    //开始时向后回绕得到的负数时间戳按0处理
+    if dts < 0 {
+        dts = 0
+    }
+    if pts < 0 {
+        pts = 0
+    }
+    demuxer.OnFrame(stream.cid, frame, uint64(pts), uint64(dts))
+}
+
 func (demuxer *TSDemuxer) doVideoPesPacket(stream *tsstream, start uint8) {
     if stream.cid != TS_STREAM_H264 && stream.cid != TS_STREAM_H265 {
         return
@@ -240,7 +256,9 @@ func (demuxer *TSDemuxer) doVideoPesPacket(stream *tsstream, start uint8) {
 }
 
 func (demuxer *TSDemuxer) doAudioPesPacket(stream *tsstream, start uint8) {
-    if stream.cid != TS_STREAM_AAC && stream.cid != TS_STREAM_AUDIO_MPEG1 && stream.cid != TS_STREAM_AUDIO_MPEG2 {
+    switch stream.cid {
+    case TS_STREAM_AAC, TS_STREAM_AAC_LATM, TS_STREAM_AUDIO_MPEG1, TS_STREAM_AUDIO_MPEG2, TS_STREAM_AC3, TS_STREAM_EAC3:
+    default:
         return
     }
 
@@ -252,7 +270,7 @@ func (demuxer *TSDemuxer) doAudioPesPacket(stream *tsstream, start uint8) {
 
     if len(stream.pkg.payload) > 0 && (start == 1 || stream.pes_pkg.Pts != stream.pkg.pts) {
         if demuxer.OnFrame != nil {
-            demuxer.OnFrame(stream.cid, stream.pkg.payload, stream.pkg.pts/90, stream.pkg.dts/90)
+            demuxer.onFrame(stream, stream.pkg.payload)
         }
         stream.pkg.payload = stream.pkg.payload[:0]
     }
@@ -263,22 +281,20 @@ func (demuxer *TSDemuxer) doAudioPesPacket(stream *tsstream, start uint8) {
 
 func (demuxer *TSDemuxer) splitH264Frame(stream *tsstream) bool {
     data := stream.pkg.payload
-    start, sct := codec.FindStartCode(data, 0)
     datalen := len(data)
     vcl := 0
     newAcessUnit := false
     needUpdate := false
-    frameBeg := start
+    frameBeg, _ := codec.FindStartCode(data, 0)
     if frameBeg < 0 {
-        frameBeg = 0
+        return false
     }
-    for start < datalen {
-        if start < 0 || len(data)-start <= int(sct)+1 {
-            break
-        }
-
-        naluType := codec.H264NaluTypeWithoutStartCode(data[start+int(sct):])
-        switch naluType {
+    base := frameBeg
+    it := codec.NewAnnexBNaluIterator(data[base:])
+    for it.Next() {
+        nalu := it.Nalu()
+        start := base + it.StartCodeOffset()
+        switch it.H264NaluType() {
         case codec.H264_NAL_AUD, codec.H264_NAL_SPS,
             codec.H264_NAL_PPS, codec.H264_NAL_SEI:
             if vcl > 0 {
@@ -287,10 +303,11 @@ func (demuxer *TSDemuxer) splitH264Frame(stream *tsstream) bool {
         case codec.H264_NAL_I_SLICE, codec.H264_NAL_P_SLICE,
             codec.H264_NAL_SLICE_A, codec.H264_NAL_SLICE_B, codec.H264_NAL_SLICE_C:
             if vcl > 0 {
-                // bs := codec.NewBitStream(data[start+int(sct)+1:])
+                // bs := codec.NewBitStream(nalu[1:])
                 // sliceHdr := &codec.SliceHeader{}
                 // sliceHdr.Decode(bs)
-                if data[start+int(sct)+1]&0x80 > 0 {
+                //first_mb_in_slice == 0
+                if len(nalu) > 1 && nalu[1]&0x80 > 0 {
                     newAcessUnit = true
                 }
             } else {
@@ -300,26 +317,13 @@ func (demuxer *TSDemuxer) splitH264Frame(stream *tsstream) bool {
 
         if vcl > 0 && newAcessUnit {
             if demuxer.OnFrame != nil {
-                audLen := 0
-                codec.SplitFrameWithStartCode(data[frameBeg:start], func(nalu []byte) bool {
-                    if codec.H264NaluType(nalu) == codec.H264_NAL_AUD {
-                        audLen += len(nalu)
-                    }
-                    return false
-                })
-                demuxer.OnFrame(stream.cid, data[frameBeg+audLen:start], stream.pkg.pts/90, stream.pkg.dts/90)
+                demuxer.onFrame(stream, trimLeadingAUD(stream.cid, data[frameBeg:start]))
             }
             frameBeg = start
             needUpdate = true
             vcl = 0
             newAcessUnit = false
         }
-        end, sct2 := codec.FindStartCode(data, start+3)
-        if end < 0 {
-            break
-        }
-        start = end
-        sct = sct2
     }
 
     if frameBeg == 0 {
@@ -332,18 +336,20 @@ func (demuxer *TSDemuxer) splitH264Frame(stream *tsstream) bool {
 
 func (demuxer *TSDemuxer) splitH265Frame(stream *tsstream) bool {
     data := stream.pkg.payload
-    start, sct := codec.FindStartCode(data, 0)
     datalen := len(data)
     vcl := 0
     newAcessUnit := false
     needUpdate := false
-    frameBeg := start
-    for start < datalen {
-        if len(data)-start <= int(sct)+2 {
-            break
-        }
-        naluType := codec.H265NaluTypeWithoutStartCode(data[start+int(sct):])
-        switch naluType {
+    frameBeg, _ := codec.FindStartCode(data, 0)
+    if frameBeg < 0 {
+        return false
+    }
+    base := frameBeg
+    it := codec.NewAnnexBNaluIterator(data[base:])
+    for it.Next() {
+        nalu := it.Nalu()
+        start := base + it.StartCodeOffset()
+        switch it.H265NaluType() {
         case codec.H265_NAL_AUD, codec.H265_NAL_SPS,
             codec.H265_NAL_PPS, codec.H265_NAL_VPS, codec.H265_NAL_SEI:
             if vcl > 0 {
@@ -358,13 +364,8 @@ func (demuxer *TSDemuxer) splitH265Frame(stream *tsstream) bool {
             codec.H265_NAL_SLICE_BLA_N_LP, codec.H265_NAL_SLICE_IDR_W_RADL,
             codec.H265_NAL_SLICE_IDR_N_LP, codec.H265_NAL_SLICE_CRA:
             if vcl > 0 {
-                // bs := codec.NewBitStream(data[start+int(sct)+2:])
-                // sliceHdr := &codec.SliceHeader{}
-                // sliceHdr.Decode(bs)
-                // if sliceHdr.First_mb_in_slice == 0 {
-                //     newAcessUnit = true
-                // }
-                if data[start+int(sct)+2]&0x80 > 0 {
+                //first_slice_segment_in_pic_flag
+                if len(nalu) > 2 && nalu[2]&0x80 > 0 {
                     newAcessUnit = true
                 }
             } else {
@@ -374,27 +375,13 @@ func (demuxer *TSDemuxer) splitH265Frame(stream *tsstream) bool {
 
         if vcl > 0 && newAcessUnit {
             if demuxer.OnFrame != nil {
-                audLen := 0
-                codec.SplitFrameWithStartCode(data[frameBeg:start], func(nalu []byte) bool {
-                    if codec.H265NaluType(nalu) == codec.H265_NAL_AUD {
-                        audLen = len(nalu)
-                    }
-                    return false
-                })
-                demuxer.OnFrame(stream.cid, data[frameBeg+audLen:start], stream.pkg.pts/90, stream.pkg.dts/90)
+                demuxer.onFrame(stream, trimLeadingAUD(stream.cid, data[frameBeg:start]))
             }
             frameBeg = start
             needUpdate = true
             vcl = 0
             newAcessUnit = false
         }
-
-        end, sct2 := codec.FindStartCode(data, start+3)
-        if end < 0 {
-            break
-        }
-        start = end
-        sct = sct2
     }
 
     if frameBeg == 0 {
@@ -404,3 +391,21 @@ func (demuxer *TSDemuxer) splitH265Frame(stream *tsstream) bool {
     stream.pkg.payload = stream.pkg.payload[0 : datalen-frameBeg]
     return needUpdate
 }
+
+// 去掉access unit开头的AUD
+func trimLeadingAUD(cid TS_STREAM_TYPE, frame []byte) []byte {
+    it := codec.NewAnnexBNaluIterator(frame)
+    if !it.Next() {
+        return frame
+    }
+    if cid == TS_STREAM_H264 && it.H264NaluType() != codec.H264_NAL_AUD {
+        return frame
+    }
+    if cid == TS_STREAM_H265 && it.H265NaluType() != codec.H265_NAL_AUD {
+        return frame
+    }
+    if it.Next() {
+        return frame[it.StartCodeOffset():]
+    }
+    return frame[len(frame):]
+}
@@ -0,0 +1,124 @@
+package mpeg2
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+)
+
+func TestTSDemuxer_AC3(t *testing.T) {
+	tests := []struct {
+		name   string
+		cid    TS_STREAM_TYPE
+		format string
+	}{
+		{name: "ac3", cid: TS_STREAM_AC3, format: "AC-3"},
+		{name: "eac3", cid: TS_STREAM_EAC3, format: "EAC3"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			frames := [][]byte{
+				append([]byte{0x0B, 0x77, 0x01}, bytes.Repeat([]byte{0x11}, 300)...),
+				append([]byte{0x0B, 0x77, 0x02}, bytes.Repeat([]byte{0x22}, 300)...),
+			}
+			var ts bytes.Buffer
+			muxer := NewTSMuxer()
+			muxer.OnPacket = func(pkg []byte) {
+				ts.Write(pkg)
+			}
+			pid := muxer.AddStream(tt.cid)
+			for i, frame := range frames {
+				if err := muxer.Write(pid, frame, uint64(i*32), uint64(i*32)); err != nil {
+					t.Fatal(err)
+				}
+			}
+
+			var got [][]byte
+			demuxer := NewTSDemuxer()
+			demuxer.OnFrame = func(cid TS_STREAM_TYPE, frame []byte, pts uint64, dts uint64) {
+				if cid != tt.cid {
+					t.Errorf("cid = %d, want %d", cid, tt.cid)
+				}
+				got = append(got, append([]byte{}, frame...))
+			}
+			demuxer.OnTSPacket = func(pkg *TSPacket) {
+				pmt, ok := pkg.Payload.(*Pmt)
+				if !ok {
+					return
+				}
+				sp := pmt.Streams[0]
+				if sp.StreamType != uint8(tt.cid) || sp.CodecStreamType() != tt.cid || len(sp.Descriptors) != 1 ||
+					sp.Descriptors[0].Tag != TS_DESCRIPTOR_REGISTRATION || string(sp.Descriptors[0].Data) != tt.format {
+					t.Errorf("stream pair = %+v", sp)
+				}
+			}
+			if err := demuxer.Input(bytes.NewReader(ts.Bytes())); err != nil {
+				t.Fatal(err)
+			}
+			if len(got) != len(frames) || !bytes.Equal(got[0], frames[0]) || !bytes.Equal(got[1], frames[1]) {
+				t.Errorf("got %d frames", len(got))
+			}
+		})
+	}
+}
+
+func TestTSDemuxer_Unwrap(t *testing.T) {
+	//33bit的90kHz时间戳在95443717ms之后回绕, 最后一帧跳变20秒
+	ptss := []uint64{95443700, 95443732, 95443764, 95463764}
+	var ts bytes.Buffer
+	muxer := NewTSMuxer()
+	muxer.OnPacket = func(pkg []byte) {
+		ts.Write(pkg)
+	}
+	pid := muxer.AddStream(TS_STREAM_AC3)
+	for i, pts := range ptss {
+		frame := append([]byte{0x0B, 0x77, byte(i)}, bytes.Repeat([]byte{0x11}, 100)...)
+		if err := muxer.Write(pid, frame, pts, pts); err != nil {
+			t.Fatal(err)
+		}
+	}
+	var got []uint64
+	var deltas []int64
+	demuxer := NewTSDemuxer()
+	demuxer.OnFrame = func(cid TS_STREAM_TYPE, frame []byte, pts uint64, dts uint64) {
+		if pts != dts {
+			t.Errorf("pts %d != dts %d", pts, dts)
+		}
+		got = append(got, pts)
+	}
+	demuxer.OnDiscontinuity = func(cid TS_STREAM_TYPE, delta int64) {
+		deltas = append(deltas, delta)
+	}
+	if err := demuxer.Input(bytes.NewReader(ts.Bytes())); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(got, ptss) {
+		t.Errorf("pts = %v, want %v", got, ptss)
+	}
+	if !reflect.DeepEqual(deltas, []int64{20000}) {
+		t.Errorf("discontinuity = %v", deltas)
+	}
+}
+
+func TestStreamPair_CodecStreamType(t *testing.T) {
+	tests := []struct {
+		name string
+		sp   StreamPair
+		want TS_STREAM_TYPE
+	}{
+		{name: "dvb ac3", sp: StreamPair{StreamType: uint8(TS_STREAM_PRIVATE_DATA), Descriptors: []Descriptor{{Tag: TS_DESCRIPTOR_AC3}}}, want: TS_STREAM_AC3},
+		{name: "dvb eac3", sp: StreamPair{StreamType: uint8(TS_STREAM_PRIVATE_DATA), Descriptors: []Descriptor{{Tag: 0x0A}, {Tag: TS_DESCRIPTOR_ENHANCED_AC3}}}, want: TS_STREAM_EAC3},
+		{name: "registration ac3", sp: StreamPair{StreamType: uint8(TS_STREAM_PRIVATE_DATA), Descriptors: []Descriptor{{Tag: TS_DESCRIPTOR_REGISTRATION, Data: []byte("AC-3")}}}, want: TS_STREAM_AC3},
+		{name: "registration eac3", sp: StreamPair{StreamType: uint8(TS_STREAM_PRIVATE_DATA), Descriptors: []Descriptor{{Tag: TS_DESCRIPTOR_REGISTRATION, Data: []byte("EAC3")}}}, want: TS_STREAM_EAC3},
+		{name: "registration other", sp: StreamPair{StreamType: uint8(TS_STREAM_PRIVATE_DATA), Descriptors: []Descriptor{{Tag: TS_DESCRIPTOR_REGISTRATION, Data: []byte("KLVA")}}}, want: TS_STREAM_PRIVATE_DATA},
+		{name: "private data", sp: StreamPair{StreamType: uint8(TS_STREAM_PRIVATE_DATA)}, want: TS_STREAM_PRIVATE_DATA},
+		{name: "atsc ac3", sp: StreamPair{StreamType: uint8(TS_STREAM_AC3)}, want: TS_STREAM_AC3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.sp.CodecStreamType(); got != tt.want {
+				t.Errorf("CodecStreamType() = %d, want %d", got, tt.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package mpeg2
 
 import (
 	"errors"
+	"fmt"
 
 	"github.com/yapingcat/gomedia/go-codec"
 )
@@ -165,6 +166,12 @@ func (mux *TSMuxer) Write(pid uint16, data []byte, pts uint64, dts uint64) error
                 sp.StreamType = uint8(stream.streamtype)
                 sp.Elementary_PID = stream.pid
                 sp.ES_Info_Length = 0
+                // ATSC的stream_type 0x81/0x87需要registration_descriptor
+                if stream.streamtype == TS_STREAM_AC3 {
+                    sp.Descriptors = []Descriptor{{Tag: TS_DESCRIPTOR_REGISTRATION, Data: []byte(TS_FORMAT_IDENTIFIER_AC3)}}
+                } else if stream.streamtype == TS_STREAM_EAC3 {
+                    sp.Descriptors = []Descriptor{{Tag: TS_DESCRIPTOR_REGISTRATION, Data: []byte(TS_FORMAT_IDENTIFIER_EAC3)}}
+                }
                 tmppmt.Streams = append(tmppmt.Streams, sp)
             }
             mux.writePmt(tmppmt, pmt)
@@ -179,8 +186,7 @@ func (mux *TSMuxer) Write(pid uint16, data []byte, pts uint64, dts uint64) error
         flag = codec.IsH265IDRFrame(data)
     }
 
-    mux.writePES(whichstream, whichpmt, data, pts*90, dts*90, flag, withaud)
-    return nil
+    return mux.writePES(whichstream, whichpmt, data, pts*90, dts*90, flag, withaud)
 }
 
 func (mux *TSMuxer) writePat(pat *Pat) {
@@ -217,7 +223,7 @@ func (mux *TSMuxer) writePmt(pmt *Pmt, t_pmt *table_pmt) {
     }
 }
 
-func (mux *TSMuxer) writePES(pes *pes_stream, pmt *table_pmt, data []byte, pts uint64, dts uint64, idr_flag bool, withaud bool) {
+func (mux *TSMuxer) writePES(pes *pes_stream, pmt *table_pmt, data []byte, pts uint64, dts uint64, idr_flag bool, withaud bool) error {
     var firstPesPacket bool = true
     bsw := codec.NewBitStreamWriter(TS_PAKCET_SIZE)
     for {
@@ -321,7 +327,7 @@ func (mux *TSMuxer) writePES(pes *pes_stream, pmt *table_pmt, data []byte, pts u
         firstPesPacket = false
         if mux.OnPacket != nil {
             if len(bsw.Bits()) != TS_PAKCET_SIZE {
-                panic("packet ts packet failed")
+                return fmt.Errorf("ts muxer: %w: packet size %d", codec.ErrInvalidState, len(bsw.Bits()))
             }
             mux.OnPacket(bsw.Bits())
         }
@@ -329,4 +335,5 @@ func (mux *TSMuxer) writePES(pes *pes_stream, pmt *table_pmt, data []byte, pts u
             break
         }
     }
+    return nil
 }
@@ -1,6 +1,7 @@
 package mpeg2
 
 import (
+    "bytes"
     "encoding/binary"
     "errors"
     "fmt"
@@ -34,11 +35,28 @@ const (
 type TS_STREAM_TYPE int
 
 const (
-    TS_STREAM_AUDIO_MPEG1 TS_STREAM_TYPE = 0x03
-    TS_STREAM_AUDIO_MPEG2 TS_STREAM_TYPE = 0x04
-    TS_STREAM_AAC         TS_STREAM_TYPE = 0x0F
-    TS_STREAM_H264        TS_STREAM_TYPE = 0x1B
-    TS_STREAM_H265        TS_STREAM_TYPE = 0x24
+    TS_STREAM_AUDIO_MPEG1  TS_STREAM_TYPE = 0x03
+    TS_STREAM_AUDIO_MPEG2  TS_STREAM_TYPE = 0x04
+    TS_STREAM_PRIVATE_DATA TS_STREAM_TYPE = 0x06
+    TS_STREAM_AAC          TS_STREAM_TYPE = 0x0F
+    TS_STREAM_AAC_LATM     TS_STREAM_TYPE = 0x11
+    TS_STREAM_H264         TS_STREAM_TYPE = 0x1B
+    TS_STREAM_H265         TS_STREAM_TYPE = 0x24
+    TS_STREAM_AC3          TS_STREAM_TYPE = 0x81 //ATSC A/52
+    TS_STREAM_EAC3         TS_STREAM_TYPE = 0x87 //ATSC A/52
+)
+
+// ATSC(A/52 Annex A) 使用stream_type 0x81/0x87 + registration_descriptor("AC-3"/"EAC3") 标识AC-3/E-AC-3
+// DVB(ETSI EN 300 468) 使用stream_type 0x06 + AC-3_descriptor/enhanced_AC-3_descriptor
+const (
+    TS_DESCRIPTOR_REGISTRATION = 0x05
+    TS_DESCRIPTOR_AC3          = 0x6A
+    TS_DESCRIPTOR_ENHANCED_AC3 = 0x7A
+)
+
+const (
+    TS_FORMAT_IDENTIFIER_AC3  = "AC-3"
+    TS_FORMAT_IDENTIFIER_EAC3 = "EAC3"
 )
 
 const (
@@ -368,12 +386,15 @@ func (adaptation *Adaptation_field) Decode(bs *codec.BitStream) error {
         }
         bitscount := bs.DistanceFromMarkDot()
         if bitscount%8 > 0 {
-            panic("maybe parser ts file failed")
+            return fmt.Errorf("adaptation field extension: %w: not byte aligned", codec.ErrInvalidData)
         }
         bs.SkipBits(int(adaptation.Adaptation_field_extension_length*8 - uint8(bitscount)))
     }
     endoffset := bs.ByteOffset()
     bs.SkipBits((int(adaptation.Adaptation_field_length) - (endoffset - startoffset)) * 8)
+    if bs.Err() != nil {
+        return fmt.Errorf("adaptation field: %w", bs.Err())
+    }
     return nil
 }
 
@@ -508,13 +529,41 @@ func (pat *Pat) Decode(bs *codec.BitStream) error {
         tmp.PID = bs.Uint16(13)
         pat.Pmts = append(pat.Pmts, tmp)
     }
+    if bs.Err() != nil {
+        return fmt.Errorf("pat: %w", bs.Err())
+    }
     return nil
 }
 
+type Descriptor struct {
+    Tag  uint8 //8 uimsbf
+    Data []byte
+}
+
 type StreamPair struct {
     StreamType     uint8  //8 uimsbf
     Elementary_PID uint16 //13 uimsbf
     ES_Info_Length uint16 //12 uimsbf
+    Descriptors    []Descriptor
+}
+
+// 根据stream_type和descriptor确定码流类型, stream_type 0x06的AC-3/E-AC-3转换为TS_STREAM_AC3/TS_STREAM_EAC3
+func (sp *StreamPair) CodecStreamType() TS_STREAM_TYPE {
+    if sp.StreamType == uint8(TS_STREAM_PRIVATE_DATA) {
+        for _, desc := range sp.Descriptors {
+            switch {
+            case desc.Tag == TS_DESCRIPTOR_AC3:
+                return TS_STREAM_AC3
+            case desc.Tag == TS_DESCRIPTOR_ENHANCED_AC3:
+                return TS_STREAM_EAC3
+            case desc.Tag == TS_DESCRIPTOR_REGISTRATION && bytes.HasPrefix(desc.Data, []byte(TS_FORMAT_IDENTIFIER_AC3)):
+                return TS_STREAM_AC3
+            case desc.Tag == TS_DESCRIPTOR_REGISTRATION && bytes.HasPrefix(desc.Data, []byte(TS_FORMAT_IDENTIFIER_EAC3)):
+                return TS_STREAM_EAC3
+            }
+        }
+    }
+    return TS_STREAM_TYPE(sp.StreamType)
 }
 
 type Pmt struct {
@@ -555,6 +604,8 @@ func (pmt *Pmt) PrettyPrint(file *os.File) {
         file.WriteString(fmt.Sprintf("----stream %d\n", i))
         if stream.StreamType == uint8(TS_STREAM_AAC) {
             file.WriteString("    stream_type:AAC\n")
+        } else if stream.StreamType == uint8(TS_STREAM_AAC_LATM) {
+            file.WriteString("    stream_type:AAC LATM\n")
         } else if stream.StreamType == uint8(TS_STREAM_AUDIO_MPEG1) {
             file.WriteString("    stream_type:MPEG1\n")
         } else if stream.StreamType == uint8(TS_STREAM_AUDIO_MPEG2) {
@@ -563,6 +614,10 @@ func (pmt *Pmt) PrettyPrint(file *os.File) {
             file.WriteString("    stream_type:H264\n")
         } else if stream.StreamType == uint8(TS_STREAM_H265) {
             file.WriteString("    stream_type:H265\n")
+        } else if stream.CodecStreamType() == TS_STREAM_AC3 {
+            file.WriteString("    stream_type:AC3\n")
+        } else if stream.CodecStreamType() == TS_STREAM_EAC3 {
+            file.WriteString("    stream_type:EAC3\n")
         } else {
             file.WriteString(fmt.Sprintf("    stream_type:UnSupport streamtype:%d\n", stream.StreamType))
         }
@@ -595,8 +650,16 @@ func (pmt *Pmt) Encode(bsw *codec.BitStreamWriter) {
         bsw.PutUint8(0x00, 3)
         bsw.PutUint16(stream.Elementary_PID, 13)
         bsw.PutUint8(0x00, 4)
-        //TODO ES_info
-        bsw.PutUint8(0 /*ES_info_length*/, 12)
+        esInfoLength := 0
+        for _, desc := range stream.Descriptors {
+            esInfoLength += 2 + len(desc.Data)
+        }
+        bsw.PutUint16(uint16(esInfoLength), 12)
+        for _, desc := range stream.Descriptors {
+            bsw.PutUint8(desc.Tag, 8)
+            bsw.PutUint8(uint8(len(desc.Data)), 8)
+            bsw.PutBytes(desc.Data)
+        }
     }
     length := bsw.DistanceFromMarkDot()
     pmt.Section_length = uint16(length)/8 + 4
@@ -639,10 +702,26 @@ func (pmt *Pmt) Decode(bs *codec.BitStream) error {
         tmp.Elementary_PID = bs.Uint16(13)
         bs.SkipBits(4)
         tmp.ES_Info_Length = bs.Uint16(12)
-        //TODO N loop descriptors
-        bs.SkipBits(int(tmp.ES_Info_Length) * 8)
+        if bs.Err() != nil {
+            return fmt.Errorf("pmt: %w", bs.Err())
+        }
+        n := 0
+        for n+2 <= int(tmp.ES_Info_Length) {
+            desc := Descriptor{Tag: bs.Uint8(8)}
+            length := int(bs.Uint8(8))
+            if n+2+length > int(tmp.ES_Info_Length) {
+                return errors.New("illegal es descriptor length")
+            }
+            desc.Data = bs.GetBytes(length)
+            tmp.Descriptors = append(tmp.Descriptors, desc)
+            n += 2 + length
+        }
+        bs.SkipBits((int(tmp.ES_Info_Length) - n) * 8)
         pmt.Streams = append(pmt.Streams, tmp)
         i += 5 + int(tmp.ES_Info_Length)
     }
+    if bs.Err() != nil {
+        return fmt.Errorf("pmt: %w", bs.Err())
+    }
     return nil
 }
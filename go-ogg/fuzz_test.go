@@ -0,0 +1,34 @@
+package ogg
+
+import (
+    "testing"
+
+    "github.com/yapingcat/gomedia/go-codec"
+)
+
+// go test -run=^$ -fuzz=FuzzXXX
+// 只检查不会panic, 解析结果不做校验
+
+func FuzzDemuxer(f *testing.F) {
+    opusHead := codec.WriteDefaultOpusExtraData()
+    var ogg []byte
+    ogg = append(ogg, makeTestPage(0x02, 0, 0, opusHead)...)
+    ogg = append(ogg, makeTestPage(0x00, 0, 1, []byte("OpusTags\x00\x00\x00\x00\x00\x00\x00\x00"))...)
+    ogg = append(ogg, makeTestPage(0x00, 1272, 2, []byte{0x78, 0x01, 0x02, 0x03}, []byte{0x78, 0x04, 0x05})...)
+    ogg = append(ogg, makeRawTestPage(0x01, 1272, 3, []byte{255, 10}, make([]byte, 265))...)
+    f.Add(ogg)
+    vp8 := []byte{'O', 'V', 'P', '8', '0', 0x01, 0x01, 0x00, 0x01, 0x40, 0x00, 0xF0, 0x00, 0x00, 0x01, 0x00, 0x00, 0x01, 0x00, 0x00, 0x00, 0x1E, 0x00, 0x00, 0x00, 0x01}
+    f.Add(append(makeTestPage(0x02, 0, 0, vp8), makeTestPage(0x00, 1<<32, 1, []byte{0x10, 0x02, 0x00})...))
+    f.Add(makeTestPage(0x02, 0, 0, []byte("\x7FFLAC\x01\x00\x00\x00fLaC\x80\x00\x00\x22")))
+    f.Fuzz(func(t *testing.T, data []byte) {
+        readPage(data)
+        demuxer := NewDemuxer()
+        demuxer.OnPacket = func(streamId uint32, granule uint64, packet []byte, lost int) {}
+        demuxer.OnFrame = func(streamId uint32, cid codec.CodecID, frame []byte, pts, dts uint64, lost int) {}
+        //分两次输入, 覆盖cache的逻辑
+        half := len(data) / 2
+        if demuxer.Input(data[:half]) == nil {
+            demuxer.Input(data[half:])
+        }
+    })
+}
@@ -4,6 +4,7 @@ import (
 	"bytes"
 	"encoding/binary"
 	"errors"
+	"fmt"
 	"strconv"
 
 	"github.com/yapingcat/gomedia/go-codec"
@@ -45,12 +46,28 @@ func (vp8 VP8Codec) magicSize() int {
     return 5
 }
 
+type FLACCodec struct {
+}
+
+func (flac FLACCodec) codecid() codec.CodecID {
+    return codec.CODECID_AUDIO_FLAC
+}
+
+func (flac FLACCodec) magic() []byte {
+    return []byte("\x7FFLAC")
+}
+
+func (flac FLACCodec) magicSize() int {
+    return 5
+}
+
 var codecs []oggCodec
 
 func init() {
-    codecs = make([]oggCodec, 2)
+    codecs = make([]oggCodec, 3)
     codecs[0] = OpusCodec{}
     codecs[1] = VP8Codec{}
+    codecs[2] = FLACCodec{}
 }
 
 type oggParser interface {
@@ -71,6 +88,8 @@ func createParser(cid codec.CodecID) oggParser {
             lastpts: ^uint64(0),
             pktIdx:  0,
         }
+    case codec.CODECID_AUDIO_FLAC:
+        return &flacDemuxer{}
     default:
         panic("unsupport codecid")
     }
@@ -102,6 +121,9 @@ type opusDemuxer struct {
 // +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
 
 func (opus *opusDemuxer) header(stream *oggStream, packet []byte) (err error) {
+    if len(packet) < 8 {
+        return fmt.Errorf("opus header: %w", codec.ErrTruncated)
+    }
     if bytes.Equal([]byte("OpusHead"), packet[0:8]) {
         opus.extradata = make([]byte, len(packet))
         copy(opus.extradata, packet)
@@ -167,6 +189,9 @@ type vp8Demuxer struct {
 }
 
 func (vp8 *vp8Demuxer) header(stream *oggStream, packet []byte) (err error) {
+    if len(packet) < 7 {
+        return fmt.Errorf("vp8 header: %w", codec.ErrTruncated)
+    }
     if !bytes.Equal([]byte("OVP80"), packet[0:5]) {
         return
     }
@@ -176,6 +201,9 @@ func (vp8 *vp8Demuxer) header(stream *oggStream, packet []byte) (err error) {
         if packet[6] != 1 {
             return
         }
+        if len(packet) < 26 {
+            return fmt.Errorf("vp8 stream info header: %w", codec.ErrTruncated)
+        }
         vp8.width = binary.BigEndian.Uint16(packet[8:])
         vp8.height = binary.BigEndian.Uint16(packet[10:])
         num := uint32(packet[12])
@@ -184,10 +212,14 @@ func (vp8 *vp8Demuxer) header(stream *oggStream, packet []byte) (err error) {
         den := uint32(packet[15])
         den = (den << 8) | uint32(packet[16])
         den = (den << 8) | uint32(packet[17])
-        vp8.sampleAspectratio = num / den
+        if den > 0 {
+            vp8.sampleAspectratio = num / den
+        }
         num = binary.BigEndian.Uint32(packet[18:])
         den = binary.BigEndian.Uint32(packet[22:])
-        vp8.frameRate = num / den
+        if den > 0 {
+            vp8.frameRate = num / den
+        }
         vp8.extradata = make([]byte, len(packet))
         copy(vp8.extradata, packet)
     case 0x02:
@@ -214,6 +246,9 @@ func (vp8 *vp8Demuxer) packet(stream *oggStream, packet []byte) (frame []byte, p
     }
     var duration uint64 = 0
     for i := int(vp8.pktIdx); i < len(stream.currentPage.packets); i++ {
+        if len(stream.currentPage.packets[i]) == 0 {
+            continue
+        }
         duration += uint64((stream.currentPage.packets[i][0] >> 4) & 1)
     }
     vp8.lastpts = vp8.gptopts(stream.currentPage.granulePos) - duration
@@ -236,3 +271,64 @@ func (vp8 *vp8Demuxer) gptopts(granulePos uint64) uint64 {
 func (vp8 *vp8Demuxer) extraData() []byte {
     return vp8.extradata
 }
+
+// https://xiph.org/flac/ogg_mapping.html
+// first header packet
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+// | 0x7F | "FLAC" | major version(1) | minor version(1) | number of header packets(2) | "fLaC" | STREAMINFO |
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+// 后续的header packet每个包含一个METADATA_BLOCK, 之后每个packet是一个FLAC FRAME
+// granule position为该page最后一个完整packet的最后一个sample的序号
+type flacDemuxer struct {
+    extradata  []byte //"fLaC"+METADATA_BLOCK
+    streamInfo *codec.FLACStreamInfo
+    lastpts    uint64
+}
+
+func (flac *flacDemuxer) header(stream *oggStream, packet []byte) (err error) {
+    if len(packet) >= 13 && bytes.Equal([]byte("\x7FFLAC"), packet[0:5]) {
+        if packet[5] != 1 {
+            return errors.New("unsupported ogg flac mapping version " + strconv.Itoa(int(packet[5])))
+        }
+        if !bytes.Equal(codec.FLACStreamMarker, packet[9:13]) {
+            return errors.New("ogg flac header missing 'fLaC'")
+        }
+        //第一个packet只包含STREAMINFO, Last-metadata-block一般为0
+        if len(packet) < 17+codec.FLAC_STREAMINFO_SIZE || packet[13]&0x7F != codec.FLAC_METADATA_STREAMINFO {
+            return errors.New("ogg flac first header packet must contain streaminfo")
+        }
+        flac.streamInfo = &codec.FLACStreamInfo{}
+        if err = flac.streamInfo.Decode(packet[17:]); err != nil {
+            return err
+        }
+        flac.extradata = make([]byte, len(packet)-9)
+        copy(flac.extradata, packet[9:])
+        return nil
+    }
+    if flac.streamInfo == nil {
+        return errors.New("ogg flac first header packet not found")
+    }
+    flac.extradata = append(flac.extradata, packet...)
+    return nil
+}
+
+// pts/dts 单位为sample
+func (flac *flacDemuxer) packet(stream *oggStream, packet []byte) (frame []byte, pts uint64, dts uint64) {
+    frame = packet
+    head, err := codec.DecodeFLACFrameHead(packet, flac.streamInfo)
+    if err != nil {
+        return frame, flac.lastpts, flac.lastpts
+    }
+    pts = head.SampleNumber(flac.streamInfo)
+    dts = pts
+    flac.lastpts = pts + uint64(head.BlockSize)
+    return
+}
+
+func (flac *flacDemuxer) gptopts(granulePos uint64) uint64 {
+    return granulePos
+}
+
+func (flac *flacDemuxer) extraData() []byte {
+    return flac.extradata
+}
@@ -145,29 +145,35 @@ func (demuxer *Demuxer) Input(buf []byte) (err error) {
 
             idx := 0
             if stream.lost > 0 && page.isContinuePacket {
+                //上一个page丢失, 丢弃跨page的packet剩余部分
                 removeLen := 0
                 for ; idx < int(page.segmentsCount); idx++ {
+                    removeLen += int(page.seqmentTable[idx])
                     if page.seqmentTable[idx] < 255 {
-                        removeLen += int(page.seqmentTable[idx])
-                    } else {
-                        tmp = tmp[removeLen:]
+                        idx++
                         break
                     }
                 }
+                tmp = tmp[removeLen:]
             } else if stream.lost == 0 && page.isContinuePacket {
                 appendLen := 0
                 for ; idx < int(page.segmentsCount); idx++ {
                     appendLen += int(page.seqmentTable[idx])
                     if page.seqmentTable[idx] < 255 {
-                        stream.cache = append(stream.cache, tmp[:appendLen]...)
-                        if demuxer.OnPacket != nil {
-                            demuxer.OnPacket(stream.streamId, stream.currentPage.granulePos, stream.cache, 0)
-                        }
-                        page.packets = append(page.packets, stream.cache)
-                        stream.cache = stream.cache[:0]
-                        tmp = tmp[appendLen:]
+                        idx++
+                        break
                     }
                 }
+                stream.cache = append(stream.cache, tmp[:appendLen]...)
+                tmp = tmp[appendLen:]
+                if idx > 0 && page.seqmentTable[idx-1] < 255 {
+                    packet := append([]byte{}, stream.cache...)
+                    if demuxer.OnPacket != nil {
+                        demuxer.OnPacket(stream.streamId, stream.currentPage.granulePos, packet, 0)
+                    }
+                    page.packets = append(page.packets, packet)
+                    stream.cache = stream.cache[:0]
+                }
             }
 
             start := 0
@@ -213,6 +219,9 @@ func (demuxer *Demuxer) GetAudioParam() *AudioParam {
 
 func (demuxer *Demuxer) findCodec(stream *oggStream, packet []byte) {
     for _, ogg_codec := range codecs {
+        if len(packet) < ogg_codec.magicSize() {
+            continue
+        }
         if bytes.Equal(ogg_codec.magic(), packet[0:ogg_codec.magicSize()]) {
             stream.cid = ogg_codec.codecid()
             stream.parser = createParser(stream.cid)
@@ -222,6 +231,9 @@ func (demuxer *Demuxer) findCodec(stream *oggStream, packet []byte) {
 }
 
 func (demuxer *Demuxer) readPacket(stream *oggStream, packet []byte) error {
+    if len(packet) == 0 {
+        return nil
+    }
     if stream.currentPage.isFirstPage {
         if stream.cid == codec.CODECID_UNRECOGNIZED {
             demuxer.findCodec(stream, packet)
@@ -255,6 +267,30 @@ func (demuxer *Demuxer) readPacket(stream *oggStream, packet []byte) error {
                 demuxer.OnFrame(stream.streamId, stream.cid, frame, pts, dts, stream.lost)
             }
         }
+    case codec.CODECID_AUDIO_FLAC:
+        //FLAC FRAME以0xFF开头, METADATA_BLOCK的第一个字节不可能为0xFF
+        if len(packet) > 0 && packet[0] != 0xFF {
+            err := stream.parser.header(stream, packet)
+            if err != nil {
+                return err
+            }
+            flac, _ := stream.parser.(*flacDemuxer)
+            if demuxer.aparam == nil {
+                demuxer.aparam = &AudioParam{
+                    CodecId:      codec.CODECID_AUDIO_FLAC,
+                    SampleRate:   flac.streamInfo.Sample_rate,
+                    ChannelCount: uint32(flac.streamInfo.Channels),
+                }
+            }
+            if demuxer.aparam.CodecId == codec.CODECID_AUDIO_FLAC {
+                demuxer.aparam.ExtraData = flac.extradata
+            }
+        } else {
+            frame, pts, dts := stream.parser.packet(stream, packet)
+            if demuxer.OnFrame != nil {
+                demuxer.OnFrame(stream.streamId, stream.cid, frame, pts, dts, stream.lost)
+            }
+        }
     case codec.CODECID_VIDEO_VP8:
         if stream.currentPage.isFirstPage || stream.currentPage.granulePos == 0 {
             err := stream.parser.header(stream, packet)
@@ -1,8 +1,11 @@
 package ogg
 
 import (
+	"bytes"
+	"encoding/binary"
 	"fmt"
 	"os"
+	"reflect"
 	"testing"
 
 	"github.com/yapingcat/gomedia/go-codec"
@@ -54,3 +57,124 @@ func TestDemuxer_Input(t *testing.T) {
         }
     })
 }
+
+func makeTestPage(headerType uint8, granule uint64, seq uint32, packets ...[]byte) []byte {
+    var segs, payload []byte
+    for _, pkt := range packets {
+        n := len(pkt)
+        for ; n >= 255; n -= 255 {
+            segs = append(segs, 255)
+        }
+        segs = append(segs, uint8(n))
+        payload = append(payload, pkt...)
+    }
+    return makeRawTestPage(headerType, granule, seq, segs, payload)
+}
+
+func makeRawTestPage(headerType uint8, granule uint64, seq uint32, segs []byte, payload []byte) []byte {
+    page := make([]byte, 27, 27+len(segs)+len(payload))
+    copy(page, CapturePattern[:])
+    page[5] = headerType
+    binary.LittleEndian.PutUint64(page[6:], granule)
+    binary.LittleEndian.PutUint32(page[14:], 0x1234)
+    binary.LittleEndian.PutUint32(page[18:], seq)
+    page[26] = uint8(len(segs))
+    page = append(append(page, segs...), payload...)
+    binary.LittleEndian.PutUint32(page[22:], makeChecksum(0, page))
+    return page
+}
+
+func TestDemuxer_FLAC(t *testing.T) {
+    si := &codec.FLACStreamInfo{Min_block_size: 1152, Max_block_size: 1152, Sample_rate: 44100, Channels: 2, Bits_per_sample: 16}
+    vc := &codec.FLACVorbisComment{Vendor: "gomedia", Comments: []string{"TITLE=ogg"}}
+    first := append([]byte("\x7FFLAC\x01\x00\x00\x01fLaC"), codec.EncodeFLACMetadataBlocks([]codec.FLACMetadataBlock{{Block_type: codec.FLAC_METADATA_STREAMINFO, Data: si.Encode()}})...)
+    first[13] &= 0x7F //STREAMINFO后还有VORBIS_COMMENT
+    comment := codec.EncodeFLACMetadataBlocks([]codec.FLACMetadataBlock{{Block_type: codec.FLAC_METADATA_VORBIS_COMMENT, Data: vc.Encode()}})
+
+    var frames [][]byte
+    for i := 0; i < 4; i++ {
+        head := &codec.FLACFrameHead{Block_size_code: 4, Sample_rate_code: 9, Channel_assignment: 1, Sample_size_code: 4, Coded_number: uint64(i)}
+        frames = append(frames, append(head.Encode(), bytes.Repeat([]byte{uint8(i)}, 300)...))
+    }
+    var ogg []byte
+    ogg = append(ogg, makeTestPage(0x02, 0, 0, first)...)
+    ogg = append(ogg, makeTestPage(0x00, 0, 1, comment)...)
+    ogg = append(ogg, makeTestPage(0x00, 2304, 2, frames[0], frames[1])...)
+    ogg = append(ogg, makeTestPage(0x04, 4608, 3, frames[2], frames[3])...)
+
+    demuxer := NewDemuxer()
+    var got [][]byte
+    var pts []uint64
+    demuxer.OnFrame = func(streamId uint32, cid codec.CodecID, frame []byte, p, dts uint64, lost int) {
+        if cid != codec.CODECID_AUDIO_FLAC || lost != 0 {
+            t.Errorf("cid %d lost %d", cid, lost)
+        }
+        got = append(got, append([]byte{}, frame...))
+        pts = append(pts, p)
+    }
+    //分段输入
+    for i := 0; i < len(ogg); i += 100 {
+        end := i + 100
+        if end > len(ogg) {
+            end = len(ogg)
+        }
+        if err := demuxer.Input(ogg[i:end]); err != nil {
+            t.Fatal(err)
+        }
+    }
+    if !reflect.DeepEqual(got, frames) || !reflect.DeepEqual(pts, []uint64{0, 1152, 2304, 3456}) {
+        t.Errorf("got %d frames, pts %v", len(got), pts)
+    }
+    param := demuxer.GetAudioParam()
+    if param == nil || param.CodecId != codec.CODECID_AUDIO_FLAC || param.SampleRate != 44100 || param.ChannelCount != 2 {
+        t.Fatalf("GetAudioParam() = %+v", param)
+    }
+    blocks, _, err := codec.DecodeFLACMetadataBlocks(param.ExtraData)
+    if err != nil || len(blocks) != 2 || blocks[1].Block_type != codec.FLAC_METADATA_VORBIS_COMMENT {
+        t.Errorf("extra data blocks = %+v, %v", blocks, err)
+    }
+}
+
+func TestDemuxer_ContinuedPacket(t *testing.T) {
+    si := &codec.FLACStreamInfo{Min_block_size: 1152, Max_block_size: 1152, Sample_rate: 44100, Channels: 2, Bits_per_sample: 16}
+    first := append([]byte("\x7FFLAC\x01\x00\x00\x00fLaC"), codec.EncodeFLACMetadataBlocks([]codec.FLACMetadataBlock{{Block_type: codec.FLAC_METADATA_STREAMINFO, Data: si.Encode()}})...)
+    var frames [][]byte
+    for i := 0; i < 3; i++ {
+        head := &codec.FLACFrameHead{Block_size_code: 4, Sample_rate_code: 9, Channel_assignment: 1, Sample_size_code: 4, Coded_number: uint64(i)}
+        frames = append(frames, append(head.Encode(), bytes.Repeat([]byte{uint8(i)}, 600)...))
+    }
+    n0 := len(frames[0])
+    //frames[1]跨两个page
+    segs := []byte{255, 255, uint8(n0 - 510), 255, 255}
+    page2 := makeRawTestPage(0x00, 1152, 1, segs, append(append([]byte{}, frames[0]...), frames[1][:510]...))
+    n1 := len(frames[1]) - 510
+    n2 := len(frames[2])
+    segs = []byte{uint8(n1), 255, 255, uint8(n2 - 510)}
+    page3 := makeRawTestPage(0x05, 3456, 2, segs, append(append([]byte{}, frames[1][510:]...), frames[2]...))
+
+    tests := []struct {
+        name  string
+        pages [][]byte
+        want  [][]byte
+    }{
+        {name: "continued", pages: [][]byte{makeTestPage(0x02, 0, 0, first), page2, page3}, want: frames},
+        {name: "lost", pages: [][]byte{makeTestPage(0x02, 0, 0, first), page3}, want: frames[2:]},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            demuxer := NewDemuxer()
+            var got [][]byte
+            demuxer.OnFrame = func(streamId uint32, cid codec.CodecID, frame []byte, p, dts uint64, lost int) {
+                got = append(got, append([]byte{}, frame...))
+            }
+            for _, page := range tt.pages {
+                if err := demuxer.Input(page); err != nil {
+                    t.Fatal(err)
+                }
+            }
+            if !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("got %d frames, want %d", len(got), len(tt.want))
+            }
+        })
+    }
+}
@@ -100,6 +100,9 @@ type oggPage struct {
 
 func readPage(data []byte) (*oggPage, error) {
 
+    if len(data) < 27 || len(data) < 27+int(data[26]) {
+        return nil, fmt.Errorf("ogg page head: %w", codec.ErrTruncated)
+    }
     if !bytes.Equal(data[:4], CapturePattern[:]) {
         return nil, errors.New("capture pattern not found")
     }
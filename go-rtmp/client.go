@@ -204,7 +204,11 @@ func (cli *RtmpClient) WriteFrame(cid codec.CodecID, frame []byte, pts, dts uint
 
 func (cli *RtmpClient) WriteAudio(cid codec.CodecID, frame []byte, pts, dts uint32) error {
     if cli.audioMuxer == nil {
-        cli.audioMuxer = flv.CreateAudioMuxer(flv.CovertCodecId2SoundFromat(cid))
+        format, err := flv.CovertCodecId2SoundFromat(cid)
+        if err != nil {
+            return err
+        }
+        cli.audioMuxer = flv.CreateAudioMuxer(format)
     }
     if cli.audioChan == nil {
         cli.audioChan = newChunkStreamWriter(CHUNK_CHANNEL_AUDIO)
@@ -224,7 +228,11 @@ func (cli *RtmpClient) WriteAudio(cid codec.CodecID, frame []byte, pts, dts uint
 
 func (cli *RtmpClient) WriteVideo(cid codec.CodecID, frame []byte, pts, dts uint32) error {
     if cli.videoMuxer == nil {
-        cli.videoMuxer = flv.CreateVideoMuxer(flv.CovertCodecId2FlvVideoCodecId(cid))
+        flvcid, err := flv.CovertCodecId2FlvVideoCodecId(cid)
+        if err != nil {
+            return err
+        }
+        cli.videoMuxer = flv.CreateVideoMuxer(flvcid)
     }
     if cli.videoChan == nil {
         cli.videoChan = newChunkStreamWriter(CHUNK_CHANNEL_VIDEO)
@@ -325,7 +333,11 @@ func (cli *RtmpClient) handleCommandRes(data []byte) error {
 
 func (cli *RtmpClient) handleVideoMessage(msg *rtmpMessage) error {
     if cli.videoDemuxer == nil {
-        cli.videoDemuxer = flv.CreateFlvVideoTagHandle(flv.GetFLVVideoCodecId(msg.msg))
+        demuxer, err := flv.CreateFlvVideoTagHandle(flv.GetFLVVideoCodecId(msg.msg))
+        if err != nil {
+            return err
+        }
+        cli.videoDemuxer = demuxer
         cli.videoDemuxer.OnFrame(func(codecid codec.CodecID, frame []byte, cts int) {
             dts := cli.timestamp
             pts := dts + uint32(cts)
@@ -337,7 +349,11 @@ func (cli *RtmpClient) handleVideoMessage(msg *rtmpMessage) error {
 
 func (cli *RtmpClient) handleAudioMessage(msg *rtmpMessage) error {
     if cli.audioDemuxer == nil {
-        cli.audioDemuxer = flv.CreateAudioTagDemuxer(flv.FLV_SOUND_FORMAT((msg.msg[0] >> 4) & 0x0F))
+        demuxer, err := flv.CreateAudioTagDemuxer(flv.FLV_SOUND_FORMAT((msg.msg[0] >> 4) & 0x0F))
+        if err != nil {
+            return err
+        }
+        cli.audioDemuxer = demuxer
         cli.audioDemuxer.OnFrame(func(codecid codec.CodecID, frame []byte) {
             dts := cli.timestamp
             pts := dts
@@ -218,7 +218,11 @@ func (server *RtmpServerHandle) WriteFrame(cid codec.CodecID, frame []byte, pts,
 func (server *RtmpServerHandle) WriteAudio(cid codec.CodecID, frame []byte, pts, dts uint32) error {
 
     if server.audioMuxer == nil {
-        server.audioMuxer = flv.CreateAudioMuxer(flv.CovertCodecId2SoundFromat(cid))
+        format, err := flv.CovertCodecId2SoundFromat(cid)
+        if err != nil {
+            return err
+        }
+        server.audioMuxer = flv.CreateAudioMuxer(format)
     }
     if server.audioChan == nil {
         server.audioChan = newChunkStreamWriter(CHUNK_CHANNEL_AUDIO)
@@ -238,7 +242,11 @@ func (server *RtmpServerHandle) WriteAudio(cid codec.CodecID, frame []byte, pts,
 
 func (server *RtmpServerHandle) WriteVideo(cid codec.CodecID, frame []byte, pts, dts uint32) error {
     if server.videoMuxer == nil {
-        server.videoMuxer = flv.CreateVideoMuxer(flv.CovertCodecId2FlvVideoCodecId(cid))
+        flvcid, err := flv.CovertCodecId2FlvVideoCodecId(cid)
+        if err != nil {
+            return err
+        }
+        server.videoMuxer = flv.CreateVideoMuxer(flvcid)
     }
     if server.videoChan == nil {
         server.videoChan = newChunkStreamWriter(CHUNK_CHANNEL_VIDEO)
@@ -440,7 +448,11 @@ func (server *RtmpServerHandle) handlePublish(data []byte) error {
 
 func (server *RtmpServerHandle) handleVideoMessage(msg *rtmpMessage) error {
     if server.videoDemuxer == nil {
-        server.videoDemuxer = flv.CreateFlvVideoTagHandle(flv.GetFLVVideoCodecId(msg.msg))
+        demuxer, err := flv.CreateFlvVideoTagHandle(flv.GetFLVVideoCodecId(msg.msg))
+        if err != nil {
+            return err
+        }
+        server.videoDemuxer = demuxer
         server.videoDemuxer.OnFrame(func(codecid codec.CodecID, frame []byte, cts int) {
             dts := server.timestamp
             pts := dts + uint32(cts)
@@ -452,7 +464,11 @@ func (server *RtmpServerHandle) handleVideoMessage(msg *rtmpMessage) error {
 
 func (server *RtmpServerHandle) handleAudioMessage(msg *rtmpMessage) error {
     if server.audioDemuxer == nil {
-        server.audioDemuxer = flv.CreateAudioTagDemuxer(flv.FLV_SOUND_FORMAT((msg.msg[0] >> 4) & 0x0F))
+        demuxer, err := flv.CreateAudioTagDemuxer(flv.FLV_SOUND_FORMAT((msg.msg[0] >> 4) & 0x0F))
+        if err != nil {
+            return err
+        }
+        server.audioDemuxer = demuxer
         server.audioDemuxer.OnFrame(func(codecid codec.CodecID, frame []byte) {
             dts := server.timestamp
             pts := dts
@@ -0,0 +1,44 @@
+package rtsp
+
+import (
+    "testing"
+)
+
+// go test -run=^$ -fuzz=FuzzXXX
+// 只检查不会panic, 解析结果不做校验
+
+func FuzzRtspRequest(f *testing.F) {
+    req := makeOptions("rtsp://127.0.0.1/live/test", 1)
+    f.Add(req.Encode())
+    setup := makeCommonReq(SETUP, "rtsp://127.0.0.1/live/test/streamid=0", 3)
+    setup.Fileds[Transport] = "RTP/AVP/TCP;unicast;interleaved=0-1;mode=record"
+    setup.Fileds[Range] = "npt=0.000-10.5"
+    setup.Body = "v=0\r\n"
+    f.Add(setup.Encode())
+    f.Fuzz(func(t *testing.T, data string) {
+        req := RtspRequest{}
+        if _, err := req.parse(data); err != nil {
+            return
+        }
+        transport := &RtspTransport{}
+        transport.DecodeString(req.Fileds[Transport])
+        parseRange(req.Fileds[Range])
+    })
+}
+
+func FuzzRtspResponse(f *testing.F) {
+    f.Add("RTSP/1.0 200 OK\r\nCSeq: 2\r\nContent-Length: 5\r\n\r\nv=0\r\n")
+    f.Add("RTSP/1.0 200 OK\r\nCSeq: 4\r\nRange: clock=20220101T000000Z-20220101T000010Z\r\n" +
+        "RTP-Info: url=rtsp://127.0.0.1/live/test/streamid=0;seq=1;rtptime=0,url=rtsp://127.0.0.1/live/test/streamid=1;seq=1\r\n\r\n")
+    f.Fuzz(func(t *testing.T, data string) {
+        res := RtspResponse{}
+        if _, err := res.parse(data); err != nil {
+            return
+        }
+        parseRange(res.Fileds[Range])
+        for _, v := range res.Fileds {
+            info := &RtpInfo{}
+            info.Decode(v)
+        }
+    })
+}
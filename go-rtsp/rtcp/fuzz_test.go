@@ -0,0 +1,28 @@
+package rtcp
+
+import (
+    "testing"
+)
+
+// go test -run=^$ -fuzz=FuzzXXX
+// 只检查不会panic, 解析结果不做校验
+
+func FuzzRtcp(f *testing.F) {
+    ctx := NewRtcpContext(1, 1, 90000)
+    f.Add(ctx.GenerateSR().Encode())
+    f.Add(ctx.GenerateRR().Encode())
+    f.Add(ctx.GenerateBye().Encode())
+    f.Add(ctx.GenerateApp("test", []byte{1, 2, 3, 4}).Encode())
+    f.Add(ctx.GenerateSDES(SDES_CNAME, "gomedia").Encode())
+    f.Fuzz(func(t *testing.T, data []byte) {
+        comm := Comm{}
+        if comm.Decode(data) != nil {
+            return
+        }
+        NewSenderReport().Decode(data)
+        NewReceiverReport().Decode(data)
+        NewSourceDescription().Decode(data)
+        NewBye().Decode(data)
+        NewApp().Decode(data)
+    })
+}
@@ -37,12 +37,12 @@ func (pkt *App) Decode(data []byte) error {
     }
 
     pkt.SubType = data[0] & 0x1F
-    if pkt.Length > uint16(len(data)-4) {
+    if pkt.PayloadLen < 8 {
         return errors.New("app rtcp packet need more data")
     }
     pkt.SSRC = binary.BigEndian.Uint32(data[4:])
     pkt.Name = data[8:12]
-    pkt.AppData = data[12 : 12+pkt.PayloadLen]
+    pkt.AppData = data[12 : 4+pkt.PayloadLen]
     return nil
 }
 
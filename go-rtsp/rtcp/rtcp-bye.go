@@ -1,6 +1,9 @@
 package rtcp
 
-import "encoding/binary"
+import (
+    "encoding/binary"
+    "errors"
+)
 
 //  	  0                   1                   2                   3
 //  	  0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
@@ -34,14 +37,25 @@ func (pkt *Bye) Decode(data []byte) error {
         return err
     }
     pkt.SC = data[0] & 0x1F
+    end := 4 + int(pkt.PayloadLen)
+    if 4+int(pkt.SC)*4 > end {
+        return errors.New("bye rtcp packet need more data")
+    }
     offset := 4
     for i := 0; i < int(pkt.SC); i++ {
-        pkt.SSRCS = append(pkt.SSRCS, binary.BigEndian.Uint32(data[offset+i*4:]))
-        offset += i * 4
+        pkt.SSRCS = append(pkt.SSRCS, binary.BigEndian.Uint32(data[offset:]))
+        offset += 4
     }
 
+    //reason是可选的
+    if offset >= end {
+        return nil
+    }
     pkt.ReasonLen = data[offset]
     offset++
+    if offset+int(pkt.ReasonLen) > end {
+        return errors.New("bye rtcp packet need more data")
+    }
     pkt.Reason = string(data[offset : offset+int(pkt.ReasonLen)])
     return nil
 }
@@ -29,11 +29,21 @@ func (pkt *Comm) Decode(data []byte) error {
     }
     pkt.PT = data[1]
     pkt.Length = binary.BigEndian.Uint16(data[2:])
+    if pkt.Length > 0x3FFF {
+        return errors.New("rtcp packet length too large")
+    }
+    total := 4 + int(pkt.Length)*4
+    if len(data) < total {
+        return errors.New("rtcp packet need more data")
+    }
     pkt.PayloadLen = pkt.Length * 4
     if pkt.Padding {
-        paddingLen := data[pkt.Length*4-1]
-        pkt.PayloadLen = pkt.Length*4 - uint16(paddingLen)
-        pkt.PaddingData = data[pkt.Length*4-uint16(paddingLen):]
+        paddingLen := uint16(data[total-1])
+        if paddingLen == 0 || paddingLen > pkt.PayloadLen {
+            return errors.New("invalid rtcp padding length")
+        }
+        pkt.PayloadLen -= paddingLen
+        pkt.PaddingData = data[total-int(paddingLen) : total-1]
     }
     return nil
 }
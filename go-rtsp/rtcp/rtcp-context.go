@@ -73,9 +73,11 @@ func (ctx *RtcpContext) GenerateSDES(sdesType uint8, txt string) *SourceDescript
     sdes.SC = 1
     sdes.Chunks = make([]SDESChunk, 1)
     sdes.Chunks[0].SSRC = ctx.ssrc
-    sdes.Chunks[0].Item.Length = uint8(len(txt))
-    sdes.Chunks[0].Item.Txt = []byte(txt)
-    sdes.Chunks[0].Item.Type = sdesType
+    sdes.Chunks[0].Item = &ChunkItem{
+        Type:   sdesType,
+        Length: uint8(len(txt)),
+        Txt:    []byte(txt),
+    }
     return sdes
 }
 
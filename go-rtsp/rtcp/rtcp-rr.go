@@ -87,8 +87,11 @@ func (pkt *ReceiverReport) Decode(data []byte) error {
         return err
     }
     pkt.RC = data[0] & 0x1F
+    if pkt.PayloadLen < 4 {
+        return errors.New("rr rtcp packet need more data")
+    }
     pkt.SSRC = binary.BigEndian.Uint32(data[4:])
-    if int(pkt.RC)*24 > len(data)-8 {
+    if int(pkt.RC)*24 > int(pkt.PayloadLen)-4 {
         return errors.New("rr rtcp packet need more data")
     }
 
@@ -1,6 +1,9 @@
 package rtcp
 
-import "encoding/binary"
+import (
+    "encoding/binary"
+    "errors"
+)
 
 //           0                   1                   2                   3
 //           0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1 2 3 4 5 6 7 8 9 0 1
@@ -73,17 +76,26 @@ func (pkt *SourceDescription) Decode(data []byte) error {
         return err
     }
     pkt.SC = data[0] & 0x1F
+    end := 4 + int(pkt.PayloadLen)
     offset := 4
     for i := 0; i < int(pkt.SC); i++ {
+        if offset+6 > end {
+            return errors.New("sdes rtcp packet need more data")
+        }
         chk := SDESChunk{}
-        chk.SSRC = binary.BigEndian.Uint32(data[4:])
+        chk.SSRC = binary.BigEndian.Uint32(data[offset:])
         offset += 4
         chk.Item = &ChunkItem{
             Type:   data[offset],
             Length: data[offset+1],
         }
+        if offset+2+int(chk.Item.Length) > end {
+            return errors.New("sdes rtcp packet need more data")
+        }
         chk.Item.Txt = make([]byte, chk.Item.Length)
         copy(chk.Item.Txt, data[offset+2:offset+2+int(chk.Item.Length)])
+        offset += 2 + int(chk.Item.Length)
+        pkt.Chunks = append(pkt.Chunks, chk)
     }
     return nil
 }
@@ -0,0 +1,59 @@
+package rtp
+
+import (
+    "testing"
+)
+
+// go test -run=^$ -fuzz=FuzzXXX
+// 只检查不会panic, 解析结果不做校验
+
+func fuzzRtpSeeds(f *testing.F, packer Packer, frame []byte) {
+    var pkts [][]byte
+    packer.OnPacket(func(pkt []byte) error {
+        pkts = append(pkts, append([]byte(nil), pkt...))
+        return nil
+    })
+    packer.Pack(frame, 3600)
+    for _, pkt := range pkts {
+        f.Add(pkt)
+    }
+    //分片的包拼在一起作为一个输入
+    if len(pkts) > 1 {
+        f.Add(append(append([]byte(nil), pkts[0]...), pkts[1]...))
+    }
+}
+
+func FuzzUnPacker(f *testing.F) {
+    bigNalu := make([]byte, 3000)
+    bigNalu[0] = 0x65
+    fuzzRtpSeeds(f, NewH264Packer(96, 1, 1, 1400), append([]byte{0x00, 0x00, 0x00, 0x01}, bigNalu...))
+    fuzzRtpSeeds(f, NewH264Packer(96, 1, 1, 1400), []byte{0x00, 0x00, 0x00, 0x01, 0x67, 0x42, 0x00, 0x1f, 0x00, 0x00, 0x00, 0x01, 0x68, 0xce, 0x3c, 0x80})
+    hevcNalu := make([]byte, 3000)
+    hevcNalu[0] = 0x26
+    hevcNalu[1] = 0x01
+    fuzzRtpSeeds(f, NewH265Packer(96, 1, 1, 1400), append([]byte{0x00, 0x00, 0x00, 0x01}, hevcNalu...))
+    fuzzRtpSeeds(f, NewAACPacker(97, 1, 1, 1400), []byte{0xFF, 0xF1, 0x50, 0x80, 0x01, 0x7F, 0xFC, 0x21, 0x00, 0x03})
+    fuzzRtpSeeds(f, NewG711Packer(8, 1, 1, 1400), make([]byte, 160))
+    f.Fuzz(func(t *testing.T, data []byte) {
+        pkg := &RtpPacket{}
+        pkg.Decode(data)
+        unpackers := []UnPacker{
+            NewH264UnPacker(),
+            NewH265UnPacker(),
+            NewAACUnPacker(13, 3, []byte{0x12, 0x10}),
+            NewAACUnPacker(13, 3, nil),
+            NewG711UnPacker(),
+            NewG722UnPacker(),
+            NewG726UnPacker(),
+            NewTsUnPacker(),
+        }
+        half := len(data) / 2
+        for _, unpacker := range unpackers {
+            unpacker.OnFrame(func(frame []byte, timestamp uint32, lost bool) {})
+            unpacker.UnPack(data)
+            //前后两半当作两个rtp包, 覆盖分片重组的逻辑
+            unpacker.UnPack(data[:half])
+            unpacker.UnPack(data[half:])
+        }
+    })
+}
@@ -116,9 +116,12 @@ func (unpacker *AACUnPacker) UnPack(pkt []byte) error {
         unpacker.onRtp(pkg)
     }
 
-    headLength := (binary.BigEndian.Uint16(pkg.Payload) + 7) / 8
+    headLength := (int(binary.BigEndian.Uint16(pkg.Payload)) + 7) / 8
     auNum := headLength / 2
     pkg.Payload = pkg.Payload[2:]
+    if headLength > len(pkg.Payload) {
+        return errors.New("aac rtp au header need more data")
+    }
     tmp := make([]int, auNum)
     for i := 0; i < int(auNum); i++ {
         bs := codec.NewBitStream(pkg.Payload)
@@ -127,9 +130,15 @@ func (unpacker *AACUnPacker) UnPack(pkt []byte) error {
     }
 
     for i := 0; i < len(tmp); i++ {
+        if tmp[i] > len(pkg.Payload) {
+            return errors.New("aac rtp au need more data")
+        }
         var adts []byte
         if len(unpacker.asc) > 0 {
-            adtsHdr, _ := codec.ConvertASCToADTS(unpacker.asc, tmp[i]+7)
+            adtsHdr, err := codec.ConvertASCToADTS(unpacker.asc, tmp[i]+7)
+            if err != nil {
+                return err
+            }
             adts = adtsHdr.Encode()
         }
         adts = append(adts, pkg.Payload[:tmp[i]]...)
@@ -32,13 +32,13 @@ func (packer *G711Packer) Pack(data []byte, timestamp uint32) error {
     pkg.Header.Marker = 1
     pkg.Payload = make([]byte, len(data))
     copy(pkg.Payload, data)
+    packer.sequence++
     if packer.onRtp != nil {
         packer.onRtp(&pkg)
     }
     if packer.onPacket != nil {
         return packer.onPacket(pkg.Encode())
     }
-    packer.sequence++
     return nil
 }
 
@@ -0,0 +1,27 @@
+package rtp
+
+import (
+    "testing"
+)
+
+func TestG711Packer_Sequence(t *testing.T) {
+    packer := NewG711Packer(8, 1, 100, 1400)
+    var seqs []uint16
+    packer.OnPacket(func(pkt []byte) error {
+        pkg := &RtpPacket{}
+        if err := pkg.Decode(pkt); err != nil {
+            t.Fatal(err)
+        }
+        seqs = append(seqs, pkg.Header.SequenceNumber)
+        return nil
+    })
+    for i := 0; i < 3; i++ {
+        if err := packer.Pack(make([]byte, 160), uint32(i*160)); err != nil {
+            t.Fatal(err)
+        }
+    }
+    //设置了OnPacket回调时序号也要递增
+    if len(seqs) != 3 || seqs[0] != 100 || seqs[1] != 101 || seqs[2] != 102 {
+        t.Errorf("sequence = %v", seqs)
+    }
+}
@@ -0,0 +1,81 @@
+package rtp
+
+import (
+    "errors"
+)
+
+// rfc3551 4.5.2 G722
+// 每个字节包含两个16000Hz的采样, 但RTP时钟频率为8000, 所以每个字节时间戳增加1
+// 超过mtu的数据按字节拆分为多个RTP包
+
+type G722Packer struct {
+    CommPacker
+    pt       uint8
+    ssrc     uint32
+    sequence uint16
+}
+
+func NewG722Packer(pt uint8, ssrc uint32, sequence uint16, mtu int) *G722Packer {
+    return &G722Packer{
+        pt:         pt,
+        ssrc:       ssrc,
+        sequence:   sequence,
+        CommPacker: CommPacker{mtu: mtu},
+    }
+}
+
+func (packer *G722Packer) Pack(data []byte, timestamp uint32) error {
+    maxPayload := packer.mtu - RTP_FIX_HEAD_LEN
+    if maxPayload <= 0 {
+        return errors.New("mtu is too small")
+    }
+    for len(data) > 0 {
+        size := len(data)
+        if size > maxPayload {
+            size = maxPayload
+        }
+        pkg := RtpPacket{}
+        pkg.Header.PayloadType = packer.pt
+        pkg.Header.SequenceNumber = packer.sequence
+        pkg.Header.SSRC = packer.ssrc
+        pkg.Header.Timestamp = timestamp
+        pkg.Payload = make([]byte, size)
+        copy(pkg.Payload, data[:size])
+        packer.sequence++
+        timestamp += uint32(size)
+        data = data[size:]
+        if packer.onRtp != nil {
+            packer.onRtp(&pkg)
+        }
+        if packer.onPacket != nil {
+            if err := packer.onPacket(pkg.Encode()); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+type G722UnPacker struct {
+    CommUnPacker
+}
+
+func NewG722UnPacker() *G722UnPacker {
+    return &G722UnPacker{}
+}
+
+func (unpacker *G722UnPacker) UnPack(pkt []byte) error {
+    pkg := &RtpPacket{}
+    if err := pkg.Decode(pkt); err != nil {
+        return err
+    }
+
+    if unpacker.onRtp != nil {
+        unpacker.onRtp(pkg)
+    }
+
+    if unpacker.onFrame != nil {
+        unpacker.onFrame(pkg.Payload, pkg.Header.Timestamp, false)
+    }
+    return nil
+}
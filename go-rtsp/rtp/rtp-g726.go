@@ -0,0 +1,98 @@
+package rtp
+
+import (
+    "errors"
+
+    "github.com/yapingcat/gomedia/go-codec"
+)
+
+// rfc3551 4.5.4 G726-16/24/32/40
+// 码字按照little-endian方式打包, 第一个码字位于第一个字节的低位
+// G726-24/G726-40 每8个采样(3/5个字节)对齐, 一个RTP包必须包含整数个这样的分组
+// 超过mtu的数据按分组拆分为多个RTP包, 时钟频率为8000, 每个采样时间戳增加1
+
+type G726Packer struct {
+    CommPacker
+    pt       uint8
+    ssrc     uint32
+    sequence uint16
+    bits     int
+}
+
+// NewG726Packer bitRate 16000/24000/32000/40000
+func NewG726Packer(pt uint8, ssrc uint32, sequence uint16, mtu int, bitRate int) *G726Packer {
+    return &G726Packer{
+        pt:         pt,
+        ssrc:       ssrc,
+        sequence:   sequence,
+        bits:       codec.G726BitsPerSample(bitRate),
+        CommPacker: CommPacker{mtu: mtu},
+    }
+}
+
+func (packer *G726Packer) Pack(data []byte, timestamp uint32) error {
+    if packer.bits == 0 {
+        return errors.New("unsupport g726 bitrate")
+    }
+    //8个采样对应的字节数为bits
+    align := 1
+    if packer.bits%2 == 1 {
+        align = packer.bits
+    }
+    if len(data)%align != 0 {
+        return errors.New("g726 data is not aligned to 8 samples")
+    }
+    maxPayload := (packer.mtu - RTP_FIX_HEAD_LEN) / align * align
+    if maxPayload <= 0 {
+        return errors.New("mtu is too small")
+    }
+    for len(data) > 0 {
+        size := len(data)
+        if size > maxPayload {
+            size = maxPayload
+        }
+        pkg := RtpPacket{}
+        pkg.Header.PayloadType = packer.pt
+        pkg.Header.SequenceNumber = packer.sequence
+        pkg.Header.SSRC = packer.ssrc
+        pkg.Header.Timestamp = timestamp
+        pkg.Payload = make([]byte, size)
+        copy(pkg.Payload, data[:size])
+        packer.sequence++
+        timestamp += uint32(size * 8 / packer.bits)
+        data = data[size:]
+        if packer.onRtp != nil {
+            packer.onRtp(&pkg)
+        }
+        if packer.onPacket != nil {
+            if err := packer.onPacket(pkg.Encode()); err != nil {
+                return err
+            }
+        }
+    }
+    return nil
+}
+
+type G726UnPacker struct {
+    CommUnPacker
+}
+
+func NewG726UnPacker() *G726UnPacker {
+    return &G726UnPacker{}
+}
+
+func (unpacker *G726UnPacker) UnPack(pkt []byte) error {
+    pkg := &RtpPacket{}
+    if err := pkg.Decode(pkt); err != nil {
+        return err
+    }
+
+    if unpacker.onRtp != nil {
+        unpacker.onRtp(pkg)
+    }
+
+    if unpacker.onFrame != nil {
+        unpacker.onFrame(pkg.Payload, pkg.Header.Timestamp, false)
+    }
+    return nil
+}
@@ -273,6 +273,9 @@ func (unpacker *H264UnPacker) UnPack(pkt []byte) error {
 }
 
 func (unpacker *H264UnPacker) unpackFuA(pkt *RtpPacket) error {
+    if len(pkt.Payload) < 2 {
+        return errors.New("h264 fu-a packet need more bytes")
+    }
     s := pkt.Payload[1] & 0x80
     e := pkt.Payload[1] & 0x40
     if s > 0 {
@@ -304,6 +307,9 @@ func (unpacker *H264UnPacker) unpackFuA(pkt *RtpPacket) error {
 func (unpacker *H264UnPacker) unpackStapa(pkt *RtpPacket) error {
     nalus := pkt.Payload[1:]
     for len(nalus) > 0 {
+        if len(nalus) < 2 {
+            return errors.New("need more bytes")
+        }
         naluLength := binary.BigEndian.Uint16(nalus)
         if len(nalus)-2 < int(naluLength) {
             return errors.New("need more bytes")
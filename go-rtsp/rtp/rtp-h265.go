@@ -152,6 +152,10 @@ func (unpacker *H265UnPacker) UnPack(pkt []byte) error {
         return err
     }
 
+    if len(pkg.Payload) == 0 {
+        return nil
+    }
+
     if unpacker.onRtp != nil {
         unpacker.onRtp(pkg)
     }
@@ -165,7 +169,7 @@ func (unpacker *H265UnPacker) UnPack(pkt []byte) error {
         }
         unpacker.frameBuffer.Truncate(4)
     case packType == 49:
-        unpacker.unpackFu(pkg)
+        return unpacker.unpackFu(pkg)
     default:
         return errors.New("unsupport h264 rtp packet type")
     }
@@ -173,6 +177,9 @@ func (unpacker *H265UnPacker) UnPack(pkt []byte) error {
 }
 
 func (unpacker *H265UnPacker) unpackFu(pkt *RtpPacket) error {
+    if len(pkt.Payload) < 3 {
+        return errors.New("h265 fu packet need more bytes")
+    }
     s := pkt.Payload[2] & 0x80
     e := pkt.Payload[2] & 0x40
     if s > 0 {
@@ -9,6 +9,8 @@ import (
     "strings"
     "sync/atomic"
     "time"
+
+    "github.com/yapingcat/gomedia/go-codec"
 )
 
 type authenticate interface {
@@ -22,13 +24,13 @@ type authenticate interface {
     wwwAuthenticate() string
 }
 
-func createAuthByAuthenticate(auth string) authenticate {
+func createAuthByAuthenticate(auth string) (authenticate, error) {
     if strings.HasPrefix(auth, "Basic") {
-        return &basicAuth{}
+        return &basicAuth{}, nil
     } else if strings.HasPrefix(auth, "Digest") {
-        return &digestAuth{nonceCounter: 0}
+        return &digestAuth{nonceCounter: 0}, nil
     } else {
-        panic("unsupport Authorization")
+        return nil, fmt.Errorf("unsupport Authorization %q: %w", auth, codec.ErrUnsupportedCodec)
     }
 }
 
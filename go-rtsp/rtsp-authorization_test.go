@@ -0,0 +1,19 @@
+package rtsp
+
+import (
+    "errors"
+    "testing"
+
+    "github.com/yapingcat/gomedia/go-codec"
+)
+
+func TestCreateAuthByAuthenticate(t *testing.T) {
+    if auth, err := createAuthByAuthenticate(`Digest realm="test", nonce="123"`); err != nil {
+        t.Fatal(err)
+    } else if _, ok := auth.(*digestAuth); !ok {
+        t.Errorf("auth = %T, want *digestAuth", auth)
+    }
+    if _, err := createAuthByAuthenticate(`Bearer token`); !errors.Is(err, codec.ErrUnsupportedCodec) {
+        t.Errorf("err = %v, want ErrUnsupportedCodec", err)
+    }
+}
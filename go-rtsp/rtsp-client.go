@@ -339,7 +339,11 @@ func (client *RtspClient) handleUnAuth(response RtspResponse) error {
     }
 
     if client.auth == nil {
-        client.auth = createAuthByAuthenticate(response.Fileds[WWWAuthenticate])
+        auth, err := createAuthByAuthenticate(response.Fileds[WWWAuthenticate])
+        if err != nil {
+            return err
+        }
+        client.auth = auth
         client.auth.setUserInfo(client.usrName, client.passwd)
     }
     client.auth.setMethod(client.lastRequest.Method)
@@ -442,12 +446,22 @@ func (client *RtspClient) handleDescribe(res *RtspResponse) (err error) {
             fmtpHandle.Load(media.Attrs["fmtp"])
         }
         var track *RtspTrack = nil
+        var c RtspCodec
         if media.MediaType == "audio" {
-            track = NewAudioTrack(NewAudioCodec(media.EncodeName, uint8(media.PayloadType), uint32(media.ClockRate), media.ChannelCount), WithCodecParamHandler(fmtpHandle))
+            if c, err = NewAudioCodec(media.EncodeName, uint8(media.PayloadType), uint32(media.ClockRate), media.ChannelCount); err != nil {
+                return err
+            }
+            track = NewAudioTrack(c, WithCodecParamHandler(fmtpHandle))
         } else if media.MediaType == "video" {
-            track = NewVideoTrack(NewVideoCodec(media.EncodeName, uint8(media.PayloadType), uint32(media.ClockRate)), WithCodecParamHandler(fmtpHandle))
+            if c, err = NewVideoCodec(media.EncodeName, uint8(media.PayloadType), uint32(media.ClockRate)); err != nil {
+                return err
+            }
+            track = NewVideoTrack(c, WithCodecParamHandler(fmtpHandle))
         } else {
-            track = NewMetaTrack(NewApplicatioCodec(media.EncodeName, uint8(media.PayloadType)))
+            if c, err = NewApplicatioCodec(media.EncodeName, uint8(media.PayloadType)); err != nil {
+                return err
+            }
+            track = NewMetaTrack(c)
         }
         if track == nil {
             continue
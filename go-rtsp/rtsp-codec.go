@@ -1,7 +1,10 @@
 package rtsp
 
 import (
+    "fmt"
     "strings"
+
+    "github.com/yapingcat/gomedia/go-codec"
 )
 
 type RTSP_CODEC_ID int
@@ -14,6 +17,11 @@ const (
     RTSP_CODEC_G711U
     RTSP_CODEC_PS
     RTSP_CODEC_TS
+    RTSP_CODEC_G722
+    RTSP_CODEC_G726_16
+    RTSP_CODEC_G726_24
+    RTSP_CODEC_G726_32
+    RTSP_CODEC_G726_40
 )
 
 type RtspCodec struct {
@@ -23,23 +31,58 @@ type RtspCodec struct {
     ChannelCount uint8
 }
 
-func GetCodecIdByEncodeName(name string) RTSP_CODEC_ID {
+// ClockRate RTP时间戳的时钟频率
+// rfc3551 G722的采样率为16000, 但是rtpmap和RTP时间戳使用8000
+func (c RtspCodec) ClockRate() uint32 {
+    if c.Cid == RTSP_CODEC_G722 {
+        return codec.G722_RTP_CLOCKRATE
+    }
+    return c.SampleRate
+}
+
+// G726BitRate G726码率, 其他codec返回0
+func (c RtspCodec) G726BitRate() int {
+    switch c.Cid {
+    case RTSP_CODEC_G726_16:
+        return 16000
+    case RTSP_CODEC_G726_24:
+        return 24000
+    case RTSP_CODEC_G726_32:
+        return 32000
+    case RTSP_CODEC_G726_40:
+        return 40000
+    default:
+        return 0
+    }
+}
+
+func GetCodecIdByEncodeName(name string) (RTSP_CODEC_ID, error) {
     lowName := strings.ToLower(name)
     switch lowName {
     case "h264":
-        return RTSP_CODEC_H264
+        return RTSP_CODEC_H264, nil
     case "h265":
-        return RTSP_CODEC_H265
+        return RTSP_CODEC_H265, nil
     case "mpeg4-generic", "mpeg4-latm":
-        return RTSP_CODEC_AAC
-    case "pcmu":
-        return RTSP_CODEC_G711A
+        return RTSP_CODEC_AAC, nil
     case "pcma":
-        return RTSP_CODEC_G711U
+        return RTSP_CODEC_G711A, nil
+    case "pcmu":
+        return RTSP_CODEC_G711U, nil
     case "mp2t":
-        return RTSP_CODEC_TS
+        return RTSP_CODEC_TS, nil
+    case "g722":
+        return RTSP_CODEC_G722, nil
+    case "g726-16":
+        return RTSP_CODEC_G726_16, nil
+    case "g726-24":
+        return RTSP_CODEC_G726_24, nil
+    case "g726-32":
+        return RTSP_CODEC_G726_32, nil
+    case "g726-40":
+        return RTSP_CODEC_G726_40, nil
     }
-    panic("unsupport codec")
+    return 0, fmt.Errorf("rtsp encode name %q: %w", name, codec.ErrUnsupportedCodec)
 }
 
 func GetEncodeNameByCodecId(cid RTSP_CODEC_ID) string {
@@ -58,23 +101,57 @@ func GetEncodeNameByCodecId(cid RTSP_CODEC_ID) string {
         return "MP2P"
     case RTSP_CODEC_TS:
         return "MP2T"
+    case RTSP_CODEC_G722:
+        return "G722"
+    case RTSP_CODEC_G726_16:
+        return "G726-16"
+    case RTSP_CODEC_G726_24:
+        return "G726-24"
+    case RTSP_CODEC_G726_32:
+        return "G726-32"
+    case RTSP_CODEC_G726_40:
+        return "G726-40"
     default:
         panic("unsupport rtsp codec id")
     }
 }
 
-func NewCodec(name string, pt uint8, sampleRate uint32, channel uint8) RtspCodec {
-    return RtspCodec{Cid: GetCodecIdByEncodeName(name), PayloadType: pt, SampleRate: sampleRate, ChannelCount: channel}
+func NewCodec(name string, pt uint8, sampleRate uint32, channel uint8) (RtspCodec, error) {
+    cid, err := GetCodecIdByEncodeName(name)
+    if err != nil {
+        return RtspCodec{}, err
+    }
+    return RtspCodec{Cid: cid, PayloadType: pt, SampleRate: audioSampleRate(cid, sampleRate), ChannelCount: channel}, nil
+}
+
+func NewVideoCodec(name string, pt uint8, sampleRate uint32) (RtspCodec, error) {
+    cid, err := GetCodecIdByEncodeName(name)
+    if err != nil {
+        return RtspCodec{}, err
+    }
+    return RtspCodec{Cid: cid, PayloadType: pt, SampleRate: sampleRate}, nil
 }
 
-func NewVideoCodec(name string, pt uint8, sampleRate uint32) RtspCodec {
-    return RtspCodec{Cid: GetCodecIdByEncodeName(name), PayloadType: pt, SampleRate: sampleRate}
+func NewAudioCodec(name string, pt uint8, sampleRate uint32, channelCount int) (RtspCodec, error) {
+    cid, err := GetCodecIdByEncodeName(name)
+    if err != nil {
+        return RtspCodec{}, err
+    }
+    return RtspCodec{Cid: cid, PayloadType: pt, SampleRate: audioSampleRate(cid, sampleRate), ChannelCount: uint8(channelCount)}, nil
 }
 
-func NewAudioCodec(name string, pt uint8, sampleRate uint32, channelCount int) RtspCodec {
-    return RtspCodec{Cid: GetCodecIdByEncodeName(name), PayloadType: pt, SampleRate: sampleRate, ChannelCount: uint8(channelCount)}
+// SDP中G722的时钟频率8000转换为实际采样率16000
+func audioSampleRate(cid RTSP_CODEC_ID, sampleRate uint32) uint32 {
+    if cid == RTSP_CODEC_G722 && sampleRate == codec.G722_RTP_CLOCKRATE {
+        return codec.G722_SAMPLE_RATE
+    }
+    return sampleRate
 }
 
-func NewApplicatioCodec(name string, pt uint8) RtspCodec {
-    return RtspCodec{Cid: GetCodecIdByEncodeName(name), PayloadType: pt}
+func NewApplicatioCodec(name string, pt uint8) (RtspCodec, error) {
+    cid, err := GetCodecIdByEncodeName(name)
+    if err != nil {
+        return RtspCodec{}, err
+    }
+    return RtspCodec{Cid: cid, PayloadType: pt}, nil
 }
@@ -0,0 +1,42 @@
+package rtsp
+
+import (
+    "errors"
+    "testing"
+
+    "github.com/yapingcat/gomedia/go-codec"
+)
+
+func TestGetCodecIdByEncodeName(t *testing.T) {
+    tests := []struct {
+        name string
+        want RTSP_CODEC_ID
+    }{
+        {name: "PCMA", want: RTSP_CODEC_G711A},
+        {name: "pcma", want: RTSP_CODEC_G711A},
+        {name: "PCMU", want: RTSP_CODEC_G711U},
+        {name: "pcmu", want: RTSP_CODEC_G711U},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got, err := GetCodecIdByEncodeName(tt.name); err != nil || got != tt.want {
+                t.Errorf("GetCodecIdByEncodeName() = %v, %v, want %v", got, err, tt.want)
+            }
+        })
+    }
+    //rfc3551 PCMU/PCMA和codec id互相转换
+    for _, cid := range []RTSP_CODEC_ID{RTSP_CODEC_G711A, RTSP_CODEC_G711U} {
+        if got, _ := GetCodecIdByEncodeName(GetEncodeNameByCodecId(cid)); got != cid {
+            t.Errorf("codec %d round trip = %d", cid, got)
+        }
+    }
+}
+
+func TestGetCodecIdByEncodeName_Unsupported(t *testing.T) {
+    if _, err := GetCodecIdByEncodeName("vp8"); !errors.Is(err, codec.ErrUnsupportedCodec) {
+        t.Errorf("err = %v, want ErrUnsupportedCodec", err)
+    }
+    if _, err := NewAudioCodec("opus", 111, 48000, 2); !errors.Is(err, codec.ErrUnsupportedCodec) {
+        t.Errorf("err = %v, want ErrUnsupportedCodec", err)
+    }
+}
@@ -179,16 +179,27 @@ func (req *RtspRequest) parse(data string) (int, error) {
         return 0, errors.New("illegal rtsp request")
     }
 
-    req.parseFirstLine(strs[0])
+    if err := req.parseFirstLine(strs[0]); err != nil {
+        return 0, err
+    }
+    if req.Fileds == nil {
+        req.Fileds = make(HeadFiled)
+    }
     for i := 1; i < len(strs); i++ {
         kv := strings.SplitN(strs[i], ":", 2)
+        if len(kv) < 2 {
+            return 0, errors.New("illegal rtsp request header")
+        }
         k := strings.Title(strings.TrimSpace(kv[0]))
         v := strings.TrimSpace(kv[1])
         req.Fileds[k] = v
     }
 
     if content_length, found := req.Fileds["Content-Length"]; found {
-        length, _ := strconv.Atoi(content_length)
+        length, err := strconv.Atoi(content_length)
+        if err != nil || length < 0 {
+            return 0, errors.New("illegal rtsp request Content-Length")
+        }
         if length > len(body) {
             return 0, errNeedMore
         }
@@ -341,15 +352,24 @@ func (res *RtspResponse) parse(data string) (int, error) {
         return 0, err
     }
 
+    if res.Fileds == nil {
+        res.Fileds = make(HeadFiled)
+    }
     for i := 1; i < len(strs); i++ {
         kv := strings.SplitN(strs[i], ":", 2)
+        if len(kv) < 2 {
+            return 0, errors.New("illegal rtsp response header")
+        }
         k := strings.Title(strings.TrimSpace(kv[0]))
         v := strings.TrimSpace(kv[1])
         res.Fileds[k] = v
     }
 
     if content_length, found := res.Fileds[ContentLength]; found {
-        length, _ := strconv.Atoi(content_length)
+        length, err := strconv.Atoi(content_length)
+        if err != nil || length < 0 {
+            return 0, errors.New("illegal rtsp response Content-Length")
+        }
         if length > len(body) {
             return 0, errNeedMore
         }
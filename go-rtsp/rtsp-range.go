@@ -66,7 +66,10 @@ func parseNPT(npt string) int64 {
 func parseRange(str string) (*RangeTime, error) {
     strs := strings.Split(str, ";")
     rt := &RangeTime{}
-    timestr := strings.Split(strs[0], "=")
+    timestr := strings.SplitN(strs[0], "=", 2)
+    if len(timestr) < 2 {
+        return rt, errors.New("illegal Range " + str)
+    }
     switch timestr[0] {
     case "npt":
         rt.rangeType = RANGE_NPT
@@ -87,7 +90,7 @@ func parseRange(str string) (*RangeTime, error) {
         t, _ := time.Parse(layout, tp[0])
         rt.begin = t.UTC().UnixNano() / 1000000
         if len(tp) > 1 {
-            t, _ = time.Parse(layout, tp[0])
+            t, _ = time.Parse(layout, tp[1])
             rt.end = t.UTC().UnixNano() / 1000000
         }
         return rt, nil
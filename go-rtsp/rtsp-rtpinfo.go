@@ -26,7 +26,10 @@ func (info *RtpInfo) EncodeString() string {
 func (info *RtpInfo) Decode(str string) {
     items := strings.Split(str, ";")
     for _, item := range items {
-        kv := strings.Split(item, "=")
+        kv := strings.SplitN(item, "=", 2)
+        if len(kv) < 2 {
+            continue
+        }
         switch kv[0] {
         case "url":
             info.Url = kv[1]
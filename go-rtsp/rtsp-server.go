@@ -38,7 +38,10 @@ func WithUserInfo(userName, passwd string) ServerOption {
 
 func WithAuthType(authType string) ServerOption {
     return func(rs *RtspServer) {
-        rs.auth = createAuthByAuthenticate(authType)
+        //不支持的认证方式忽略, 设置了用户名密码时使用Digest
+        if auth, err := createAuthByAuthenticate(authType); err == nil {
+            rs.auth = auth
+        }
     }
 }
 
@@ -61,7 +64,7 @@ func NewRtspServer(handle ServerHandle, opt ...ServerOption) *RtspServer {
         o(server)
     }
     if server.auth == nil && server.userName != "" && server.passwd != "" {
-        server.auth = createAuthByAuthenticate("Digest")
+        server.auth, _ = createAuthByAuthenticate("Digest")
         server.auth.setUserInfo(server.userName, server.passwd)
         server.auth.setRealm(server.realm)
     }
@@ -267,12 +270,22 @@ func (server *RtspServer) handleRequest(req []byte) (ret int, err error) {
                 fmtpHandle.Load(media.Attrs["fmtp"])
             }
             var track *RtspTrack = nil
+            var c RtspCodec
             if media.MediaType == "audio" {
-                track = NewAudioTrack(NewAudioCodec(media.EncodeName, uint8(media.PayloadType), uint32(media.ClockRate), media.ChannelCount), WithCodecParamHandler(fmtpHandle))
+                if c, err = NewAudioCodec(media.EncodeName, uint8(media.PayloadType), uint32(media.ClockRate), media.ChannelCount); err != nil {
+                    return
+                }
+                track = NewAudioTrack(c, WithCodecParamHandler(fmtpHandle))
             } else if media.MediaType == "video" {
-                track = NewVideoTrack(NewVideoCodec(media.EncodeName, uint8(media.PayloadType), uint32(media.ClockRate)), WithCodecParamHandler(fmtpHandle))
+                if c, err = NewVideoCodec(media.EncodeName, uint8(media.PayloadType), uint32(media.ClockRate)); err != nil {
+                    return
+                }
+                track = NewVideoTrack(c, WithCodecParamHandler(fmtpHandle))
             } else {
-                track = NewMetaTrack(NewApplicatioCodec(media.EncodeName, uint8(media.PayloadType)))
+                if c, err = NewApplicatioCodec(media.EncodeName, uint8(media.PayloadType)); err != nil {
+                    return
+                }
+                track = NewMetaTrack(c)
             }
             track.uri = media.ControlUrl
             server.tracks[media.MediaType] = track
@@ -9,6 +9,7 @@ import (
     "github.com/yapingcat/gomedia/go-rtsp/rtcp"
     "github.com/yapingcat/gomedia/go-rtsp/rtp"
     "github.com/yapingcat/gomedia/go-rtsp/sdp"
+    "github.com/yapingcat/gomedia/go-timebase"
 )
 
 func init() {
@@ -18,7 +19,8 @@ func init() {
 type RtspSample struct {
     Cid       RTSP_CODEC_ID
     Sample    []byte
-    Timestamp uint32 //in milliseconds
+    Timestamp uint32 //rtp timestamp
+    Pts       uint64 //in milliseconds, 32bit rtp时间戳回绕之后继续递增, WriteSample时不使用
     Completed bool
 }
 
@@ -41,6 +43,7 @@ type RtspTrack struct {
     recvCtx      *rtcp.RtcpContext
     sendCtx      *rtcp.RtcpContext
     autoSendRR   bool
+    unwrapper    *timebase.Unwrapper
 }
 
 type PacketCallBack func(b []byte, isRtcp bool) error
@@ -76,6 +79,7 @@ func newTrack(name string, codec RtspCodec, opt ...TrackOption) *RtspTrack {
         Codec:        codec,
         initSequence: uint16(rand.Uint32()),
         autoSendRR:   true,
+        unwrapper:    timebase.NewRTPUnwrapper(),
     }
     for _, o := range opt {
         o(track)
@@ -83,10 +87,10 @@ func newTrack(name string, codec RtspCodec, opt ...TrackOption) *RtspTrack {
     track.ssrc = rand.Uint32()
     track.unpack = track.createUnpacker()
     track.pack = track.createPacker()
-    track.sendCtx = rtcp.NewRtcpContext(track.ssrc, track.initSequence, track.Codec.SampleRate)
+    track.sendCtx = rtcp.NewRtcpContext(track.ssrc, track.initSequence, track.Codec.ClockRate())
     track.unpack.HookRtp(func(pkg *rtp.RtpPacket) {
         if track.recvCtx == nil {
-            track.recvCtx = rtcp.NewRtcpContext(track.ssrc, pkg.Header.SequenceNumber, track.Codec.SampleRate)
+            track.recvCtx = rtcp.NewRtcpContext(track.ssrc, pkg.Header.SequenceNumber, track.Codec.ClockRate())
         }
         track.recvCtx.ReceivedRtp(pkg)
     })
@@ -125,9 +129,12 @@ func (track *RtspTrack) OnSample(onsample OnSampleCallBack) {
         sample := RtspSample{
             Cid:       track.Codec.Cid,
             Sample:    frame,
-            Timestamp: timestamp, //uint32(uint64() * 1000 / uint64(track.Codec.SampleRate)),
+            Timestamp: timestamp,
             Completed: !lost,
         }
+        if pts := timebase.Rescale(track.unwrapper.Unwrap(uint64(timestamp)), timebase.ClockRate(track.Codec.ClockRate()), timebase.MILLISECOND); pts > 0 {
+            sample.Pts = uint64(pts)
+        }
         if sample.Cid == RTSP_CODEC_H264 {
             nalu_type := codec.H264NaluType(frame)
             switch nalu_type {
@@ -235,7 +242,7 @@ func (track *RtspTrack) mediaDescripe() string {
     if track.TrackName != "audio" {
         md += fmt.Sprintf("a=rtpmap:%d %s/%d\r\n", track.Codec.PayloadType, GetEncodeNameByCodecId(track.Codec.Cid), track.Codec.SampleRate)
     } else {
-        md += fmt.Sprintf("a=rtpmap:%d %s/%d/%d\r\n", track.Codec.PayloadType, GetEncodeNameByCodecId(track.Codec.Cid), track.Codec.SampleRate, track.Codec.ChannelCount)
+        md += fmt.Sprintf("a=rtpmap:%d %s/%d/%d\r\n", track.Codec.PayloadType, GetEncodeNameByCodecId(track.Codec.Cid), track.Codec.ClockRate(), track.Codec.ChannelCount)
     }
     if track.paramHandler != nil {
         md += fmt.Sprintf("a=fmtp:%d %s\r\n", track.Codec.PayloadType, track.paramHandler.Save())
@@ -253,11 +260,15 @@ func (track *RtspTrack) Input(data []byte, isRtcp bool) error {
 
 func (track *RtspTrack) inputRtcp(data []byte) error {
     pkt := rtcp.Comm{}
-    pkt.Decode(data)
+    if err := pkt.Decode(data); err != nil {
+        return err
+    }
     switch pkt.PT {
     case rtcp.RTCP_SR:
         sr := rtcp.NewSenderReport()
-        sr.Decode(data)
+        if err := sr.Decode(data); err != nil {
+            return err
+        }
         if track.recvCtx != nil {
             track.recvCtx.ReceivedSR(sr)
             if track.autoSendRR {
@@ -283,6 +294,10 @@ func (track *RtspTrack) createUnpacker() rtp.UnPacker {
         }
     case RTSP_CODEC_G711A, RTSP_CODEC_G711U:
         return rtp.NewG711UnPacker()
+    case RTSP_CODEC_G722:
+        return rtp.NewG722UnPacker()
+    case RTSP_CODEC_G726_16, RTSP_CODEC_G726_24, RTSP_CODEC_G726_32, RTSP_CODEC_G726_40:
+        return rtp.NewG726UnPacker()
     case RTSP_CODEC_TS:
         return rtp.NewTsUnPacker()
     }
@@ -299,6 +314,10 @@ func (track *RtspTrack) createPacker() rtp.Packer {
         return rtp.NewH265Packer(track.Codec.PayloadType, track.ssrc, track.initSequence, 1400)
     case RTSP_CODEC_G711U, RTSP_CODEC_G711A:
         return rtp.NewG711Packer(track.Codec.PayloadType, track.ssrc, track.initSequence, 1400)
+    case RTSP_CODEC_G722:
+        return rtp.NewG722Packer(track.Codec.PayloadType, track.ssrc, track.initSequence, 1400)
+    case RTSP_CODEC_G726_16, RTSP_CODEC_G726_24, RTSP_CODEC_G726_32, RTSP_CODEC_G726_40:
+        return rtp.NewG726Packer(track.Codec.PayloadType, track.ssrc, track.initSequence, 1400, track.Codec.G726BitRate())
     case RTSP_CODEC_PS:
         return nil
     case RTSP_CODEC_TS:
@@ -98,7 +98,10 @@ func (transport *RtspTransport) Decode(data []byte) error {
 func (transport *RtspTransport) DecodeString(data string) error {
     items := strings.Split(data, ";")
     for _, item := range items {
-        kv := strings.Split(item, "=")
+        kv := strings.SplitN(item, "=", 2)
+        if len(kv) < 2 {
+            kv = append(kv, "")
+        }
         switch kv[0] {
         case "RTP/AVP/TCP":
             transport.Proto = TCP
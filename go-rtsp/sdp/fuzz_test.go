@@ -0,0 +1,26 @@
+package sdp
+
+import (
+	"testing"
+)
+
+// go test -run=^$ -fuzz=FuzzXXX
+// 只检查不会panic, 解析结果不做校验
+
+func FuzzParserSdp(f *testing.F) {
+	f.Add(sdpstr)
+	f.Add("v=0\r\nm=audio 0/2 RTP/AVP 8\r\na=rtpmap:8 PCMA/8000/1\r\n")
+	f.Fuzz(func(t *testing.T, content string) {
+		sdp := &Sdp{}
+		if sdp.ParserSdp(content) != nil {
+			return
+		}
+		for _, m := range sdp.Medias {
+			if fmtp, ok := m.Attrs["fmtp"]; ok {
+				if parser := CreateFmtpParamParser(m.EncodeName); parser != nil {
+					parser.Load(fmtp)
+				}
+			}
+		}
+	})
+}
@@ -108,6 +108,9 @@ func (param *H264FmtpParam) Load(fmtp string) {
             param.packetizationMode, _ = strconv.Atoi(kv[1])
         case "sprop-parameter-sets":
             spspps := strings.Split(kv[1], ",")
+            if len(spspps) < 2 {
+                continue
+            }
             param.sps, _ = base64.StdEncoding.DecodeString(spspps[0])
             param.pps, _ = base64.StdEncoding.DecodeString(spspps[1])
         case "profile-level-id":
@@ -40,6 +40,9 @@ func (r *RtpMap) Decode(rtpmap string) error {
     }
     param := strings.Split(items[1], "/")
     r.EncodeName = param[0]
+    if len(param) < 2 {
+        return errors.New("parser rtpmap failed")
+    }
     r.ClockRate, _ = strconv.Atoi(param[1])
     if len(param) > 2 {
         r.EncodParam = param[2]
@@ -108,17 +111,26 @@ func (m *Media) Encode() string {
 
 func (m *Media) ParseMLine(mediaLine string) error {
     strs := strings.SplitN(mediaLine, " ", 4)
+    if len(strs) < 3 {
+        return errors.New("parser \"m=\" field failed")
+    }
     m.MediaType = strs[0]
     pn := strings.SplitN(strs[1], "/", 2)
     p, _ := strconv.Atoi(pn[0])
     m.Ports = append(m.Ports, uint16(p))
     if len(pn) > 1 {
         numberOfPort, _ := strconv.Atoi(pn[1])
+        if numberOfPort > 0xFFFF {
+            return errors.New("parser \"m=\" field failed, too many ports")
+        }
         for i := 1; i < numberOfPort; i++ {
             m.Ports = append(m.Ports, uint16(p)+1)
         }
     }
     m.Proto = strs[2]
+    if len(strs) < 4 {
+        return nil
+    }
     fmts := strings.Split(strs[3], " ")
     for _, fmt := range fmts {
         f, _ := strconv.Atoi(fmt)
@@ -166,7 +178,7 @@ func (sdp *Sdp) ParserSdp(sdpContent string) error {
     })
     for _, line := range lines {
         nameValue := strings.SplitN(line, "=", 2)
-        if len(nameValue) < 2 {
+        if len(nameValue) < 2 || len(nameValue[0]) == 0 {
             return errors.New("parser sdp line failed")
         }
         name := nameValue[0]
@@ -200,6 +212,9 @@ func (sdp *Sdp) ParserSdp(sdpContent string) error {
             }
             switch attrName {
             case "rtpmap":
+                if len(sdp.Medias) == 0 {
+                    continue
+                }
                 rtpMap := &RtpMap{}
                 rtpMap.Decode(attrValue)
                 sdp.Medias[len(sdp.Medias)-1].EncodeName = rtpMap.EncodeName
@@ -244,6 +259,12 @@ func (sdp *Sdp) ParserSdp(sdpContent string) error {
                 sdp.Medias[i].EncodeName = "PCMA"
                 sdp.Medias[i].ClockRate = 8000
                 sdp.Medias[i].ChannelCount = 1
+            case 9:
+                //rfc3551 G722的RTP时钟频率为8000, 实际采样率为16000
+                sdp.Medias[i].PayloadType = 9
+                sdp.Medias[i].EncodeName = "G722"
+                sdp.Medias[i].ClockRate = 8000
+                sdp.Medias[i].ChannelCount = 1
             case 26:
                 sdp.Medias[i].PayloadType = 26
                 sdp.Medias[i].EncodeName = "JPEG"
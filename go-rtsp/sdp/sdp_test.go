@@ -31,3 +31,36 @@ func TestParserSdp(t *testing.T) {
 		fmt.Printf("%+v\n", sdp.Medias[1])
 	})
 }
+
+func TestParserSdp_G72x(t *testing.T) {
+	sdpG72x := "v=0\r\n" +
+		"o=- 0 0 IN IP4 127.0.0.1\r\n" +
+		"s=No Name\r\n" +
+		"t=0 0\r\n" +
+		"m=audio 0 RTP/AVP 9\r\n" +
+		"a=control:trackID=1\r\n" +
+		"m=audio 0 RTP/AVP 97\r\n" +
+		"a=rtpmap:97 G726-32/8000\r\n" +
+		"a=control:trackID=2\r\n"
+	sdp := &Sdp{}
+	if err := sdp.ParserSdp(sdpG72x); err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		encodeName  string
+		payloadType int
+		clockRate   int
+	}{
+		{encodeName: "G722", payloadType: 9, clockRate: 8000},
+		{encodeName: "G726-32", payloadType: 97, clockRate: 8000},
+	}
+	if len(sdp.Medias) != len(tests) {
+		t.Fatalf("got %d medias", len(sdp.Medias))
+	}
+	for i, tt := range tests {
+		m := sdp.Medias[i]
+		if m.EncodeName != tt.encodeName || m.PayloadType != tt.payloadType || m.ClockRate != tt.clockRate {
+			t.Errorf("media %d = %+v", i, m)
+		}
+	}
+}
@@ -0,0 +1,194 @@
+package timebase
+
+import (
+    "fmt"
+    "math"
+    "math/big"
+    "math/bits"
+)
+
+// Rational 时间基, 一个时间单位等于Num/Den秒
+type Rational struct {
+    Num int64
+    Den int64
+}
+
+var (
+    SECOND      = Rational{Num: 1, Den: 1}
+    MILLISECOND = Rational{Num: 1, Den: 1000}
+    MICROSECOND = Rational{Num: 1, Den: 1000000}
+    NANOSECOND  = Rational{Num: 1, Den: 1000000000}
+    MPEG_90K    = Rational{Num: 1, Den: 90000}    //PES pts/dts
+    MPEG_27M    = Rational{Num: 1, Den: 27000000} //PCR
+)
+
+func NewRational(num, den int64) Rational {
+    return Rational{Num: num, Den: den}
+}
+
+// ClockRate 时钟频率为rate的时间基, 例如RTP的90000/48000, mp4 mdhd中的timescale
+func ClockRate(rate uint32) Rational {
+    return Rational{Num: 1, Den: int64(rate)}
+}
+
+func (r Rational) IsValid() bool {
+    return r.Num > 0 && r.Den > 0
+}
+
+func (r Rational) Float64() float64 {
+    if r.Den == 0 {
+        return math.NaN()
+    }
+    return float64(r.Num) / float64(r.Den)
+}
+
+// Reduce 约分
+func (r Rational) Reduce() Rational {
+    a, b := r.Num, r.Den
+    if a < 0 {
+        a = -a
+    }
+    if b < 0 {
+        b = -b
+    }
+    for b != 0 {
+        a, b = b, a%b
+    }
+    if a <= 1 {
+        return r
+    }
+    return Rational{Num: r.Num / a, Den: r.Den / a}
+}
+
+// Invert 倒数, 例如帧率转换为帧间隔的时间基
+func (r Rational) Invert() Rational {
+    return Rational{Num: r.Den, Den: r.Num}
+}
+
+func (r Rational) String() string {
+    return fmt.Sprintf("%d/%d", r.Num, r.Den)
+}
+
+type Rounding int
+
+const (
+    ROUND_DOWN    Rounding = iota //向负无穷取整, 与对非负数做整数除法一致
+    ROUND_UP                      //向正无穷取整
+    ROUND_NEAREST                 //四舍五入, 0.5远离0
+)
+
+// MulDiv 计算a*b/c, 中间结果使用128位, 不会溢出; 结果超过uint64时返回math.MaxUint64
+func MulDiv(a, b, c uint64, rnd Rounding) uint64 {
+    if c == 0 {
+        return math.MaxUint64
+    }
+    hi, lo := bits.Mul64(a, b)
+    if rnd == ROUND_NEAREST {
+        var carry uint64
+        lo, carry = bits.Add64(lo, c/2, 0)
+        hi += carry
+    }
+    if hi >= c {
+        return math.MaxUint64
+    }
+    q, r := bits.Div64(hi, lo, c)
+    if rnd == ROUND_UP && r != 0 {
+        if q == math.MaxUint64 {
+            return q
+        }
+        q++
+    }
+    return q
+}
+
+// Rescale 将from时间基下的v转换到to时间基, 向下取整
+func Rescale(v int64, from, to Rational) int64 {
+    return RescaleRound(v, from, to, ROUND_DOWN)
+}
+
+// RescaleRound 计算 v * from.Num * to.Den / (from.Den * to.Num), 中间结果不会溢出,
+// 结果超出int64时取math.MaxInt64/math.MinInt64; 时间基无效时返回0
+func RescaleRound(v int64, from, to Rational, rnd Rounding) int64 {
+    if !from.IsValid() || !to.IsValid() {
+        return 0
+    }
+    bh, b := bits.Mul64(uint64(from.Num), uint64(to.Den))
+    ch, c := bits.Mul64(uint64(from.Den), uint64(to.Num))
+    if bh != 0 || ch != 0 {
+        return rescaleBig(v, from, to, rnd)
+    }
+    neg := v < 0
+    abs := uint64(v)
+    if neg {
+        abs = uint64(-v) //v为MinInt64时结果也正确
+        //负数向下取整等于绝对值向上取整
+        switch rnd {
+        case ROUND_DOWN:
+            rnd = ROUND_UP
+        case ROUND_UP:
+            rnd = ROUND_DOWN
+        }
+    }
+    q := MulDiv(abs, b, c, rnd)
+    if neg {
+        if q > uint64(math.MaxInt64)+1 {
+            return math.MinInt64
+        }
+        return -int64(q)
+    }
+    if q > math.MaxInt64 {
+        return math.MaxInt64
+    }
+    return int64(q)
+}
+
+func rescaleBig(v int64, from, to Rational, rnd Rounding) int64 {
+    num := new(big.Int).Mul(big.NewInt(v), big.NewInt(from.Num))
+    num.Mul(num, big.NewInt(to.Den))
+    den := new(big.Int).Mul(big.NewInt(from.Den), big.NewInt(to.Num))
+    switch rnd {
+    case ROUND_UP:
+        num.Add(num, new(big.Int).Sub(den, big.NewInt(1)))
+    case ROUND_NEAREST:
+        half := new(big.Int).Rsh(den, 1)
+        if num.Sign() < 0 {
+            num.Sub(num, half)
+            //Quo向0取整
+            num.Quo(num, den)
+            return clampBig(num)
+        }
+        num.Add(num, half)
+    }
+    //Div向负无穷取整(den为正数)
+    num.Div(num, den)
+    return clampBig(num)
+}
+
+func clampBig(v *big.Int) int64 {
+    if v.IsInt64() {
+        return v.Int64()
+    }
+    if v.Sign() < 0 {
+        return math.MinInt64
+    }
+    return math.MaxInt64
+}
+
+// RescaleUint64 无符号时间戳的转换, 例如demuxer输出的pts/dts, 时间基无效时返回0
+func RescaleUint64(v uint64, from, to Rational) uint64 {
+    if !from.IsValid() || !to.IsValid() {
+        return 0
+    }
+    bh, b := bits.Mul64(uint64(from.Num), uint64(to.Den))
+    ch, c := bits.Mul64(uint64(from.Den), uint64(to.Num))
+    if bh != 0 || ch != 0 {
+        num := new(big.Int).Mul(new(big.Int).SetUint64(v), big.NewInt(from.Num))
+        num.Mul(num, big.NewInt(to.Den))
+        num.Div(num, new(big.Int).Mul(big.NewInt(from.Den), big.NewInt(to.Num)))
+        if !num.IsUint64() {
+            return math.MaxUint64
+        }
+        return num.Uint64()
+    }
+    return MulDiv(v, b, c, ROUND_DOWN)
+}
@@ -0,0 +1,56 @@
+package timebase
+
+import (
+    "math"
+    "testing"
+)
+
+func TestRescale(t *testing.T) {
+    tests := []struct {
+        name string
+        v    int64
+        from Rational
+        to   Rational
+        rnd  Rounding
+        want int64
+    }{
+        {name: "90k to ms", v: 90000*3 + 89, from: MPEG_90K, to: MILLISECOND, rnd: ROUND_DOWN, want: 3000},
+        {name: "90k to ms nearest", v: 90000*3 + 89, from: MPEG_90K, to: MILLISECOND, rnd: ROUND_NEAREST, want: 3001},
+        {name: "90k to ms up", v: 91, from: MPEG_90K, to: MILLISECOND, rnd: ROUND_UP, want: 2},
+        {name: "negative down", v: -91, from: MPEG_90K, to: MILLISECOND, rnd: ROUND_DOWN, want: -2},
+        {name: "negative up", v: -91, from: MPEG_90K, to: MILLISECOND, rnd: ROUND_UP, want: -1},
+        {name: "negative nearest", v: -135, from: MPEG_90K, to: MILLISECOND, rnd: ROUND_NEAREST, want: -2},
+        {name: "ms to 48k", v: 1001, from: MILLISECOND, to: ClockRate(48000), rnd: ROUND_DOWN, want: 48048},
+        {name: "frame rate", v: 3, from: NewRational(30000, 1001).Invert(), to: MILLISECOND, rnd: ROUND_NEAREST, want: 100},
+        //v*1000会溢出int64
+        {name: "no overflow", v: math.MaxInt64 / 10, from: MPEG_27M, to: MPEG_90K, rnd: ROUND_DOWN, want: math.MaxInt64 / 10 / 300},
+        {name: "saturate", v: math.MaxInt64 / 2, from: SECOND, to: MILLISECOND, rnd: ROUND_DOWN, want: math.MaxInt64},
+        {name: "saturate negative", v: math.MinInt64 / 2, from: SECOND, to: MILLISECOND, rnd: ROUND_DOWN, want: math.MinInt64},
+        {name: "big factors", v: 7, from: NewRational(1<<40, 1<<41), to: NewRational(1<<40, 1<<40), rnd: ROUND_DOWN, want: 3},
+        {name: "big factors negative", v: -7, from: NewRational(1<<40, 1<<41), to: NewRational(1<<40, 1<<40), rnd: ROUND_DOWN, want: -4},
+        {name: "invalid", v: 100, from: NewRational(1, 0), to: MILLISECOND, rnd: ROUND_DOWN, want: 0},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            if got := RescaleRound(tt.v, tt.from, tt.to, tt.rnd); got != tt.want {
+                t.Errorf("RescaleRound() = %d, want %d", got, tt.want)
+            }
+        })
+    }
+    if got := RescaleUint64(math.MaxUint64-1, MILLISECOND, SECOND); got != (math.MaxUint64-1)/1000 {
+        t.Errorf("RescaleUint64() = %d", got)
+    }
+}
+
+func TestRational(t *testing.T) {
+    r := NewRational(60000, 2002).Reduce()
+    if r != NewRational(30000, 1001) || r.String() != "30000/1001" {
+        t.Errorf("Reduce() = %v", r)
+    }
+    if f := MILLISECOND.Float64(); f != 0.001 {
+        t.Errorf("Float64() = %f", f)
+    }
+    if NewRational(1, 0).IsValid() || !MPEG_90K.IsValid() {
+        t.Error("IsValid() mismatch")
+    }
+}
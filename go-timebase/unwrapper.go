@@ -0,0 +1,103 @@
+package timebase
+
+import "errors"
+
+const (
+    PTS_BITS = 33 //PES pts/dts
+    RTP_BITS = 32 //RTP timestamp
+    FLV_BITS = 32 //FLV/RTMP timestamp, 24bit + 8bit扩展
+)
+
+// Unwrapper 把会回绕的N位时间戳展开成64位单调的时间戳
+//
+// 相邻两个时间戳的差值按照有符号数处理, 所以只要相邻输入的跳变小于2^(N-1),
+// 无论向前(回绕)还是向后(B帧的pts, 多路流交织)都能得到正确的结果
+type Unwrapper struct {
+    bits uint
+    mask uint64
+    last int64
+    init bool
+}
+
+var errUnwrapBits = errors.New("timestamp bits must be in [2, 63]")
+
+func NewUnwrapper(nbits uint) (*Unwrapper, error) {
+    if nbits < 2 || nbits > 63 {
+        return nil, errUnwrapBits
+    }
+    return &Unwrapper{bits: nbits, mask: uint64(1)<<nbits - 1}, nil
+}
+
+// NewPTSUnwrapper 33bit 90kHz的PES pts/dts
+func NewPTSUnwrapper() *Unwrapper {
+    u, _ := NewUnwrapper(PTS_BITS)
+    return u
+}
+
+// NewRTPUnwrapper 32bit RTP时间戳
+func NewRTPUnwrapper() *Unwrapper {
+    u, _ := NewUnwrapper(RTP_BITS)
+    return u
+}
+
+// NewFLVUnwrapper 32bit毫秒的FLV/RTMP时间戳
+func NewFLVUnwrapper() *Unwrapper {
+    u, _ := NewUnwrapper(FLV_BITS)
+    return u
+}
+
+// Unwrap 返回展开后的时间戳, 第一个时间戳原样返回;
+// 在起始点附近向后回绕(例如第一个时间戳为1, 下一个为2^N-1)时会返回负数
+func (u *Unwrapper) Unwrap(ts uint64) int64 {
+    ts &= u.mask
+    if !u.init {
+        u.init = true
+        u.last = int64(ts)
+        return u.last
+    }
+    diff := int64((ts - uint64(u.last)) & u.mask)
+    if diff >= int64(1)<<(u.bits-1) {
+        diff -= int64(1) << u.bits
+    }
+    u.last += diff
+    return u.last
+}
+
+// Last 上一次展开后的时间戳
+func (u *Unwrapper) Last() int64 {
+    return u.last
+}
+
+func (u *Unwrapper) Reset() {
+    u.init = false
+    u.last = 0
+}
+
+// DiscontinuityDetector 检测时间戳的跳变, 例如推流端重启, 切换节目, 拼接不同的文件
+type DiscontinuityDetector struct {
+    threshold int64
+    last      int64
+    init      bool
+}
+
+// threshold 允许的最大间隔, 单位与Check的输入一致
+func NewDiscontinuityDetector(threshold int64) *DiscontinuityDetector {
+    return &DiscontinuityDetector{threshold: threshold}
+}
+
+// Check 返回与上一个时间戳的差值, 差值的绝对值超过threshold时discontinuous为true
+func (d *DiscontinuityDetector) Check(ts int64) (delta int64, discontinuous bool) {
+    if !d.init {
+        d.init = true
+        d.last = ts
+        return 0, false
+    }
+    delta = ts - d.last
+    d.last = ts
+    return delta, delta > d.threshold || delta < -d.threshold
+}
+
+func (d *DiscontinuityDetector) Reset() {
+    d.init = false
+    d.last = 0
+}
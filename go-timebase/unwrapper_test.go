@@ -0,0 +1,64 @@
+package timebase
+
+import (
+    "reflect"
+    "testing"
+)
+
+func TestUnwrapper(t *testing.T) {
+    const pts33 = uint64(1) << 33
+    const rtp32 = uint64(1) << 32
+    tests := []struct {
+        name string
+        u    *Unwrapper
+        in   []uint64
+        want []int64
+    }{
+        {name: "pts wraparound", u: NewPTSUnwrapper(),
+            in:   []uint64{pts33 - 3600, pts33 - 1, 3599, 7199},
+            want: []int64{int64(pts33) - 3600, int64(pts33) - 1, int64(pts33) + 3599, int64(pts33) + 7199}},
+        {name: "pts reorder across wrap", u: NewPTSUnwrapper(),
+            in:   []uint64{pts33 - 3000, 6000, pts33 - 100, 3000},
+            want: []int64{int64(pts33) - 3000, int64(pts33) + 6000, int64(pts33) - 100, int64(pts33) + 3000}},
+        {name: "rtp wrap twice", u: NewRTPUnwrapper(),
+            in:   []uint64{rtp32 - 10, 1 << 30, 1 << 31, 3 << 30, 10, 1 << 31},
+            want: []int64{int64(rtp32) - 10, int64(rtp32) + 1<<30, int64(rtp32) + 1<<31, int64(rtp32) + 3<<30, 2*int64(rtp32) + 10, 2*int64(rtp32) + 1<<31}},
+        {name: "high bits ignored", u: NewPTSUnwrapper(),
+            in:   []uint64{pts33 + 100, 200},
+            want: []int64{100, 200}},
+        {name: "backward at start", u: NewFLVUnwrapper(),
+            in:   []uint64{10, rtp32 - 10, 40},
+            want: []int64{10, -10, 40}},
+    }
+    for _, tt := range tests {
+        t.Run(tt.name, func(t *testing.T) {
+            var got []int64
+            for _, ts := range tt.in {
+                got = append(got, tt.u.Unwrap(ts))
+            }
+            if !reflect.DeepEqual(got, tt.want) {
+                t.Errorf("Unwrap() = %v, want %v", got, tt.want)
+            }
+            tt.u.Reset()
+            if got := tt.u.Unwrap(tt.in[len(tt.in)-1]); got != int64(tt.in[len(tt.in)-1]&tt.u.mask) {
+                t.Errorf("Unwrap() after Reset = %d", got)
+            }
+        })
+    }
+    if _, err := NewUnwrapper(64); err == nil {
+        t.Error("expect error for 64 bits")
+    }
+}
+
+func TestDiscontinuityDetector(t *testing.T) {
+    d := NewDiscontinuityDetector(1000)
+    in := []int64{0, 40, 80, 5000, 5040, 100}
+    wantDelta := []int64{0, 40, 40, 4920, 40, -4940}
+    wantDis := []bool{false, false, false, true, false, true}
+    for i, ts := range in {
+        delta, dis := d.Check(ts)
+        if delta != wantDelta[i] || dis != wantDis[i] {
+            t.Errorf("Check(%d) = %d %v, want %d %v", ts, delta, dis, wantDelta[i], wantDis[i])
+        }
+    }
+}
@@ -0,0 +1,291 @@
+package wav
+
+import (
+    "encoding/binary"
+    "errors"
+    "math"
+
+    "github.com/yapingcat/gomedia/go-codec"
+)
+
+// RIFF WAVE
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+// | "RIFF" | size(4) | "WAVE" | chunk | chunk | ... | "data" | size(4) | samples ...    |
+// +-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+-+
+// 每个chunk为 id(4) + size(4, little-endian) + payload, payload长度为奇数时补一个字节
+//
+// RF64 (EBU Tech 3306), 文件超过4GB时使用
+// "RF64" | 0xFFFFFFFF | "WAVE" | "ds64" | 28 | riffSize(8) | dataSize(8) | sampleCount(8) | tableLength(4) | ...
+// data chunk的size为0xFFFFFFFF, 实际大小在ds64中
+
+// fmt chunk
+// uint16   wFormatTag;
+// uint16   nChannels;
+// uint32   nSamplesPerSec;
+// uint32   nAvgBytesPerSec;
+// uint16   nBlockAlign;
+// uint16   wBitsPerSample;
+// uint16   cbSize;                 WAVEFORMATEX
+// ---------- WAVE_FORMAT_EXTENSIBLE, cbSize = 22 -----------
+// uint16   wValidBitsPerSample;
+// uint32   dwChannelMask;
+// GUID     SubFormat;              前两个字节为实际的wFormatTag
+
+const (
+    WAVE_FORMAT_PCM        uint16 = 0x0001
+    WAVE_FORMAT_IEEE_FLOAT uint16 = 0x0003
+    WAVE_FORMAT_ALAW       uint16 = 0x0006
+    WAVE_FORMAT_MULAW      uint16 = 0x0007
+    WAVE_FORMAT_G726_ADPCM uint16 = 0x0064
+    WAVE_FORMAT_G722_ADPCM uint16 = 0x0065
+    WAVE_FORMAT_G722       uint16 = 0x028F //ffmpeg
+    WAVE_FORMAT_EXTENSIBLE uint16 = 0xFFFE
+)
+
+// KSDATAFORMAT_SUBTYPE_XXX = {XXXX0000-0000-0010-8000-00AA00389B71}
+var subFormatSuffix = []byte{0x00, 0x00, 0x00, 0x00, 0x10, 0x00, 0x80, 0x00, 0x00, 0xAA, 0x00, 0x38, 0x9B, 0x71}
+
+// 默认声道布局 FL FR FC LFE BL BR
+var defaultChannelMask = []uint32{0, 0x4, 0x3, 0x7, 0x33, 0x37, 0x3F, 0x13F, 0x63F}
+
+const RIFF_MAX_SIZE = 0xFFFFFFFF
+
+var errUnsupportFormat = errors.New("unsupport wav format")
+
+type WavFormat struct {
+    FormatTag          uint16 //WAVE_FORMAT_EXTENSIBLE时为SubFormat中的实际格式
+    Channels           uint16
+    SampleRate         uint32
+    ByteRate           uint32
+    BlockAlign         uint16
+    BitsPerSample      uint16
+    Extensible         bool
+    ValidBitsPerSample uint16
+    ChannelMask        uint32
+    ExtraData          []byte //cbSize之后的数据(非EXTENSIBLE)
+}
+
+func NewPCMFormat(sampleRate uint32, channels uint16, bitsPerSample uint16) *WavFormat {
+    return newFormat(WAVE_FORMAT_PCM, sampleRate, channels, bitsPerSample)
+}
+
+func NewFloatFormat(sampleRate uint32, channels uint16, bitsPerSample uint16) *WavFormat {
+    return newFormat(WAVE_FORMAT_IEEE_FLOAT, sampleRate, channels, bitsPerSample)
+}
+
+func newFormat(tag uint16, sampleRate uint32, channels uint16, bitsPerSample uint16) *WavFormat {
+    blockAlign := uint16((uint32(bitsPerSample) + 7) / 8 * uint32(channels))
+    format := &WavFormat{
+        FormatTag:          tag,
+        Channels:           channels,
+        SampleRate:         sampleRate,
+        ByteRate:           sampleRate * uint32(blockAlign),
+        BlockAlign:         blockAlign,
+        BitsPerSample:      (bitsPerSample + 7) / 8 * 8,
+        ValidBitsPerSample: bitsPerSample,
+    }
+    //多声道或者PCM超过16bit时应该使用WAVE_FORMAT_EXTENSIBLE
+    if channels > 2 || (tag == WAVE_FORMAT_PCM && bitsPerSample > 16) || bitsPerSample%8 != 0 {
+        format.Extensible = true
+        if int(channels) < len(defaultChannelMask) {
+            format.ChannelMask = defaultChannelMask[channels]
+        }
+    }
+    return format
+}
+
+// NewCodecFormat 根据codec id创建压缩格式
+// G711A/G711U 每个采样8bit; G722 采样率16000, 每个采样4bit; G726 bitsPerSample为2/3/4/5
+// G726的码字按照MSB在前(AAL2)的方式打包
+func NewCodecFormat(cid codec.CodecID, sampleRate uint32, channels uint16, bitsPerSample uint16) (*WavFormat, error) {
+    format := &WavFormat{Channels: channels, SampleRate: sampleRate}
+    switch cid {
+    case codec.CODECID_AUDIO_G711A:
+        format.FormatTag = WAVE_FORMAT_ALAW
+        format.BitsPerSample = 8
+    case codec.CODECID_AUDIO_G711U:
+        format.FormatTag = WAVE_FORMAT_MULAW
+        format.BitsPerSample = 8
+    case codec.CODECID_AUDIO_G722:
+        format.FormatTag = WAVE_FORMAT_G722
+        format.BitsPerSample = 4
+        format.SampleRate = codec.G722_SAMPLE_RATE
+    case codec.CODECID_AUDIO_G726:
+        if bitsPerSample < 2 || bitsPerSample > 5 {
+            return nil, errors.New("g726 bits per sample must be 2~5")
+        }
+        format.FormatTag = WAVE_FORMAT_G726_ADPCM
+        format.BitsPerSample = bitsPerSample
+    default:
+        return nil, errUnsupportFormat
+    }
+    //blockAlign为整数个字节能容纳的最少采样
+    bits := uint32(format.BitsPerSample) * uint32(channels)
+    format.BlockAlign = uint16(bits / gcd(8, bits))
+    format.ByteRate = format.SampleRate * bits / 8
+    format.ValidBitsPerSample = format.BitsPerSample
+    return format, nil
+}
+
+func gcd(a uint32, b uint32) uint32 {
+    for b != 0 {
+        a, b = b, a%b
+    }
+    return a
+}
+
+// CodecID PCM/IEEE float返回CODECID_UNRECOGNIZED
+func (format *WavFormat) CodecID() codec.CodecID {
+    switch format.FormatTag {
+    case WAVE_FORMAT_ALAW:
+        return codec.CODECID_AUDIO_G711A
+    case WAVE_FORMAT_MULAW:
+        return codec.CODECID_AUDIO_G711U
+    case WAVE_FORMAT_G722, WAVE_FORMAT_G722_ADPCM:
+        return codec.CODECID_AUDIO_G722
+    case WAVE_FORMAT_G726_ADPCM:
+        return codec.CODECID_AUDIO_G726
+    default:
+        return codec.CODECID_UNRECOGNIZED
+    }
+}
+
+// SamplesPerBlock 每个block包含的采样数(每个声道)
+func (format *WavFormat) SamplesPerBlock() uint32 {
+    if format.BitsPerSample == 0 || format.Channels == 0 {
+        return 0
+    }
+    return uint32(format.BlockAlign) * 8 / (uint32(format.BitsPerSample) * uint32(format.Channels))
+}
+
+func (format *WavFormat) isPCM() bool {
+    return format.FormatTag == WAVE_FORMAT_PCM
+}
+
+func (format *WavFormat) Encode() []byte {
+    size := 16
+    if format.Extensible {
+        size = 40
+    } else if !format.isPCM() {
+        size = 18 + len(format.ExtraData)
+    }
+    fmtChunk := make([]byte, size)
+    tag := format.FormatTag
+    if format.Extensible {
+        tag = WAVE_FORMAT_EXTENSIBLE
+    }
+    binary.LittleEndian.PutUint16(fmtChunk, tag)
+    binary.LittleEndian.PutUint16(fmtChunk[2:], format.Channels)
+    binary.LittleEndian.PutUint32(fmtChunk[4:], format.SampleRate)
+    binary.LittleEndian.PutUint32(fmtChunk[8:], format.ByteRate)
+    binary.LittleEndian.PutUint16(fmtChunk[12:], format.BlockAlign)
+    binary.LittleEndian.PutUint16(fmtChunk[14:], format.BitsPerSample)
+    if format.Extensible {
+        binary.LittleEndian.PutUint16(fmtChunk[16:], 22)
+        valid := format.ValidBitsPerSample
+        if valid == 0 {
+            valid = format.BitsPerSample
+        }
+        binary.LittleEndian.PutUint16(fmtChunk[18:], valid)
+        binary.LittleEndian.PutUint32(fmtChunk[20:], format.ChannelMask)
+        binary.LittleEndian.PutUint16(fmtChunk[24:], format.FormatTag)
+        copy(fmtChunk[26:], subFormatSuffix)
+    } else if !format.isPCM() {
+        binary.LittleEndian.PutUint16(fmtChunk[16:], uint16(len(format.ExtraData)))
+        copy(fmtChunk[18:], format.ExtraData)
+    }
+    return fmtChunk
+}
+
+func (format *WavFormat) Decode(data []byte) error {
+    if len(data) < 16 {
+        return errors.New("wav fmt chunk need 16 bytes at least")
+    }
+    format.FormatTag = binary.LittleEndian.Uint16(data)
+    format.Channels = binary.LittleEndian.Uint16(data[2:])
+    format.SampleRate = binary.LittleEndian.Uint32(data[4:])
+    format.ByteRate = binary.LittleEndian.Uint32(data[8:])
+    format.BlockAlign = binary.LittleEndian.Uint16(data[12:])
+    format.BitsPerSample = binary.LittleEndian.Uint16(data[14:])
+    format.ValidBitsPerSample = format.BitsPerSample
+    format.Extensible = false
+    format.ExtraData = nil
+    if len(data) < 18 {
+        return nil
+    }
+    cbSize := int(binary.LittleEndian.Uint16(data[16:]))
+    if len(data) < 18+cbSize {
+        return errors.New("wav fmt chunk is truncated")
+    }
+    if format.FormatTag != WAVE_FORMAT_EXTENSIBLE {
+        if cbSize > 0 {
+            format.ExtraData = make([]byte, cbSize)
+            copy(format.ExtraData, data[18:18+cbSize])
+        }
+        return nil
+    }
+    if cbSize < 22 {
+        return errors.New("wav extensible fmt chunk need 22 bytes cbSize")
+    }
+    format.Extensible = true
+    format.ValidBitsPerSample = binary.LittleEndian.Uint16(data[18:])
+    format.ChannelMask = binary.LittleEndian.Uint32(data[20:])
+    format.FormatTag = binary.LittleEndian.Uint16(data[24:])
+    return nil
+}
+
+// ToInt16 将PCM/IEEE float/ALAW/MULAW数据转换为16bit线性PCM, 多声道交错存放
+func (format *WavFormat) ToInt16(data []byte) ([]int16, error) {
+    switch format.FormatTag {
+    case WAVE_FORMAT_ALAW:
+        return codec.DecodeG711A(data), nil
+    case WAVE_FORMAT_MULAW:
+        return codec.DecodeG711U(data), nil
+    case WAVE_FORMAT_PCM:
+        switch format.BitsPerSample {
+        case 8:
+            pcm := make([]int16, len(data))
+            for i, v := range data {
+                pcm[i] = (int16(v) - 128) << 8
+            }
+            return pcm, nil
+        case 16:
+            return codec.DecodePCMS16LE(data), nil
+        case 24, 32:
+            //只保留高16bit
+            bytes := int(format.BitsPerSample / 8)
+            pcm := make([]int16, len(data)/bytes)
+            for i := range pcm {
+                sample := data[i*bytes : (i+1)*bytes]
+                pcm[i] = int16(binary.LittleEndian.Uint16(sample[bytes-2:]))
+            }
+            return pcm, nil
+        }
+    case WAVE_FORMAT_IEEE_FLOAT:
+        switch format.BitsPerSample {
+        case 32:
+            pcm := make([]int16, len(data)/4)
+            for i := range pcm {
+                pcm[i] = floatToInt16(float64(math.Float32frombits(binary.LittleEndian.Uint32(data[i*4:]))))
+            }
+            return pcm, nil
+        case 64:
+            pcm := make([]int16, len(data)/8)
+            for i := range pcm {
+                pcm[i] = floatToInt16(math.Float64frombits(binary.LittleEndian.Uint64(data[i*8:])))
+            }
+            return pcm, nil
+        }
+    }
+    return nil, errUnsupportFormat
+}
+
+func floatToInt16(f float64) int16 {
+    v := f * 32768
+    if v > 32767 {
+        return 32767
+    } else if v < -32768 {
+        return -32768
+    }
+    return int16(v)
+}
@@ -0,0 +1,175 @@
+package wav
+
+import (
+    "encoding/binary"
+    "errors"
+    "io"
+    "io/ioutil"
+
+    "github.com/yapingcat/gomedia/go-codec"
+)
+
+type WavReader struct {
+    r           io.Reader
+    Format      *WavFormat
+    RF64        bool
+    DataSize    uint64 //0表示未知(流式写入的文件), 读到EOF为止
+    SampleCount uint64 //fact/ds64中的采样数, 可能为0
+    remain      uint64
+    unknownSize bool
+    samples     uint64 //已经读取的采样数, 用于计算pts
+}
+
+func CreateWavReader(r io.Reader) *WavReader {
+    return &WavReader{r: r}
+}
+
+func (reader *WavReader) readFull(n int) ([]byte, error) {
+    buf := make([]byte, n)
+    if _, err := io.ReadFull(reader.r, buf); err != nil {
+        return nil, err
+    }
+    return buf, nil
+}
+
+func (reader *WavReader) skip(n uint64) error {
+    _, err := io.CopyN(ioutil.Discard, reader.r, int64(n))
+    return err
+}
+
+// ReadHeader 解析到data chunk为止, 之后可以调用Read/ReadFrame读取音频数据
+func (reader *WavReader) ReadHeader() error {
+    head, err := reader.readFull(12)
+    if err != nil {
+        return err
+    }
+    switch string(head[0:4]) {
+    case "RIFF":
+    case "RF64":
+        reader.RF64 = true
+    default:
+        return errors.New("not riff wave file")
+    }
+    if string(head[8:12]) != "WAVE" {
+        return errors.New("not riff wave file")
+    }
+
+    var ds64DataSize uint64
+    for {
+        chunkHead, err := reader.readFull(8)
+        if err != nil {
+            return err
+        }
+        chunkId := string(chunkHead[0:4])
+        chunkSize := uint64(binary.LittleEndian.Uint32(chunkHead[4:]))
+        switch chunkId {
+        case "ds64":
+            if chunkSize < 24 {
+                return errors.New("wav ds64 chunk is too small")
+            }
+            ds64, err := reader.readFull(int(chunkSize))
+            if err != nil {
+                return err
+            }
+            ds64DataSize = binary.LittleEndian.Uint64(ds64[8:])
+            reader.SampleCount = binary.LittleEndian.Uint64(ds64[16:])
+        case "fmt ":
+            if chunkSize > 0xFFFF {
+                return errors.New("wav fmt chunk is too large")
+            }
+            fmtChunk, err := reader.readFull(int(chunkSize + chunkSize&1))
+            if err != nil {
+                return err
+            }
+            reader.Format = new(WavFormat)
+            if err = reader.Format.Decode(fmtChunk[:chunkSize]); err != nil {
+                return err
+            }
+            if reader.Format.Channels == 0 || reader.Format.SampleRate == 0 {
+                return errors.New("invalid wav channels or sample rate")
+            }
+        case "fact":
+            fact, err := reader.readFull(int(chunkSize + chunkSize&1))
+            if err != nil {
+                return err
+            }
+            if chunkSize >= 4 && reader.SampleCount == 0 {
+                sampleCount := binary.LittleEndian.Uint32(fact)
+                if sampleCount != RIFF_MAX_SIZE {
+                    reader.SampleCount = uint64(sampleCount)
+                }
+            }
+        case "data":
+            if reader.Format == nil {
+                return errors.New("wav data chunk before fmt chunk")
+            }
+            if reader.RF64 && chunkSize == RIFF_MAX_SIZE {
+                chunkSize = ds64DataSize
+            }
+            if chunkSize == 0 || chunkSize == RIFF_MAX_SIZE {
+                reader.unknownSize = true
+            } else {
+                reader.DataSize = chunkSize
+                reader.remain = chunkSize
+            }
+            return nil
+        default:
+            //LIST/JUNK/bext ...
+            if err = reader.skip(chunkSize + chunkSize&1); err != nil {
+                return err
+            }
+        }
+    }
+}
+
+// Read 读取data chunk中的原始数据
+func (reader *WavReader) Read(p []byte) (int, error) {
+    if reader.Format == nil {
+        return 0, errors.New("wav header has not been read")
+    }
+    if !reader.unknownSize {
+        if reader.remain == 0 {
+            return 0, io.EOF
+        }
+        if uint64(len(p)) > reader.remain {
+            p = p[:reader.remain]
+        }
+    }
+    n, err := reader.r.Read(p)
+    reader.remain -= uint64(n)
+    if reader.unknownSize {
+        reader.remain = 0
+    }
+    return n, err
+}
+
+// ReadFrame 读取blocks个block, 返回数据以及第一个采样的pts(ms)
+// 文件末尾不足blocks个block时返回剩余的完整block
+func (reader *WavReader) ReadFrame(blocks int) ([]byte, uint64, error) {
+    if reader.Format == nil {
+        return nil, 0, errors.New("wav header has not been read")
+    }
+    if blocks <= 0 || reader.Format.BlockAlign == 0 {
+        return nil, 0, errors.New("invalid wav block count")
+    }
+    align := int(reader.Format.BlockAlign)
+    frame := make([]byte, blocks*align)
+    n, err := io.ReadFull(reader, frame)
+    n -= n % align
+    if n == 0 {
+        if err == nil || err == io.ErrUnexpectedEOF {
+            err = io.EOF
+        }
+        return nil, 0, err
+    }
+    pts := reader.samples * 1000 / uint64(reader.Format.SampleRate)
+    reader.samples += uint64(n/align) * uint64(reader.Format.SamplesPerBlock())
+    return frame[:n], pts, nil
+}
+
+func (reader *WavReader) CodecID() codec.CodecID {
+    if reader.Format == nil {
+        return codec.CODECID_UNRECOGNIZED
+    }
+    return reader.Format.CodecID()
+}
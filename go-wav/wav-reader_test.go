@@ -0,0 +1,243 @@
+package wav
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"reflect"
+	"testing"
+
+	"github.com/yapingcat/gomedia/go-codec"
+)
+
+type memFile struct {
+	buf []byte
+	pos int64
+}
+
+func (m *memFile) Write(p []byte) (int, error) {
+	end := m.pos + int64(len(p))
+	if end > int64(len(m.buf)) {
+		m.buf = append(m.buf, make([]byte, end-int64(len(m.buf)))...)
+	}
+	copy(m.buf[m.pos:], p)
+	m.pos = end
+	return len(p), nil
+}
+
+func (m *memFile) Seek(offset int64, whence int) (int64, error) {
+	switch whence {
+	case io.SeekStart:
+	case io.SeekCurrent:
+		offset += m.pos
+	case io.SeekEnd:
+		offset += int64(len(m.buf))
+	}
+	if offset < 0 {
+		return 0, errors.New("negative position")
+	}
+	m.pos = offset
+	return offset, nil
+}
+
+func makeData(n int) []byte {
+	data := make([]byte, n)
+	for i := range data {
+		data[i] = byte(i*7 + 3)
+	}
+	return data
+}
+
+func TestWavWriterReader(t *testing.T) {
+	g726, _ := NewCodecFormat(codec.CODECID_AUDIO_G726, 8000, 1, 3)
+	g722, _ := NewCodecFormat(codec.CODECID_AUDIO_G722, 8000, 1, 4)
+	alaw, _ := NewCodecFormat(codec.CODECID_AUDIO_G711A, 8000, 1, 8)
+	tests := []struct {
+		name       string
+		format     *WavFormat
+		dataLen    int
+		seekable   bool
+		extensible bool
+		cid        codec.CodecID
+	}{
+		{name: "pcm16 stereo", format: NewPCMFormat(44100, 2, 16), dataLen: 4000, seekable: true, cid: codec.CODECID_UNRECOGNIZED},
+		{name: "pcm24", format: NewPCMFormat(48000, 1, 24), dataLen: 3000, seekable: true, extensible: true, cid: codec.CODECID_UNRECOGNIZED},
+		{name: "pcm 6 channels", format: NewPCMFormat(48000, 6, 16), dataLen: 1200, seekable: true, extensible: true, cid: codec.CODECID_UNRECOGNIZED},
+		{name: "float32", format: NewFloatFormat(16000, 1, 32), dataLen: 800, seekable: true, cid: codec.CODECID_UNRECOGNIZED},
+		{name: "alaw odd size", format: alaw, dataLen: 161, seekable: true, cid: codec.CODECID_AUDIO_G711A},
+		{name: "alaw stream", format: alaw, dataLen: 320, seekable: false, cid: codec.CODECID_AUDIO_G711A},
+		{name: "g722", format: g722, dataLen: 160, seekable: true, cid: codec.CODECID_AUDIO_G722},
+		{name: "g726-24", format: g726, dataLen: 300, seekable: true, cid: codec.CODECID_AUDIO_G726},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			data := makeData(tt.dataLen)
+			var out []byte
+			if tt.seekable {
+				f := &memFile{}
+				w := CreateWavWriter(f, tt.format)
+				if _, err := w.Write(data); err != nil {
+					t.Fatal(err)
+				}
+				if err := w.Close(); err != nil {
+					t.Fatal(err)
+				}
+				out = f.buf
+			} else {
+				buf := &bytes.Buffer{}
+				w := CreateWavWriter(buf, tt.format)
+				if _, err := w.Write(data); err != nil {
+					t.Fatal(err)
+				}
+				if err := w.Close(); err != nil {
+					t.Fatal(err)
+				}
+				out = buf.Bytes()
+			}
+			if len(out)%2 != 0 {
+				t.Fatalf("riff file size %d is not even", len(out))
+			}
+			r := CreateWavReader(bytes.NewReader(out))
+			if err := r.ReadHeader(); err != nil {
+				t.Fatal(err)
+			}
+			if r.RF64 {
+				t.Fatal("unexpected rf64")
+			}
+			if r.Format.Extensible != tt.extensible {
+				t.Errorf("extensible = %v, want %v", r.Format.Extensible, tt.extensible)
+			}
+			if r.CodecID() != tt.cid {
+				t.Errorf("codec id = %d, want %d", r.CodecID(), tt.cid)
+			}
+			got := *r.Format
+			want := *tt.format
+			got.ExtraData, want.ExtraData = nil, nil
+			if !reflect.DeepEqual(got, want) {
+				t.Errorf("format = %+v, want %+v", got, want)
+			}
+			if tt.seekable && r.DataSize != uint64(tt.dataLen) {
+				t.Errorf("data size = %d, want %d", r.DataSize, tt.dataLen)
+			}
+			content, err := io.ReadAll(r)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !tt.seekable {
+				//流式写入时补齐字节无法和数据区分
+				content = content[:tt.dataLen]
+			}
+			if !bytes.Equal(content, data) {
+				t.Errorf("data mismatch, len %d want %d", len(content), len(data))
+			}
+		})
+	}
+}
+
+func TestWavWriter_RF64(t *testing.T) {
+	maxRiffSize = 1000
+	defer func() { maxRiffSize = RIFF_MAX_SIZE }()
+
+	format := NewPCMFormat(8000, 1, 16)
+	f := &memFile{}
+	w := CreateWavWriter(f, format)
+	data := makeData(2000)
+	if _, err := w.Write(data); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if string(f.buf[0:4]) != "RF64" || string(f.buf[12:16]) != "ds64" {
+		t.Fatalf("rf64 header is not written %q", f.buf[0:16])
+	}
+	r := CreateWavReader(bytes.NewReader(f.buf))
+	if err := r.ReadHeader(); err != nil {
+		t.Fatal(err)
+	}
+	if !r.RF64 || r.DataSize != 2000 || r.SampleCount != 1000 {
+		t.Fatalf("rf64 %v data size %d sample count %d", r.RF64, r.DataSize, r.SampleCount)
+	}
+	content, err := io.ReadAll(r)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(content, data) {
+		t.Error("data mismatch")
+	}
+}
+
+func TestWavReader_ReadFrame(t *testing.T) {
+	format, _ := NewCodecFormat(codec.CODECID_AUDIO_G711U, 8000, 1, 8)
+	f := &memFile{}
+	w := CreateWavWriter(f, format)
+	pcm := make([]int16, 1000)
+	for i := range pcm {
+		pcm[i] = int16(8000 * math.Sin(float64(i)/10))
+	}
+	//写入A-law帧, 自动转换为µ-law
+	if err := w.WriteFrame(codec.CODECID_AUDIO_G711A, codec.EncodeG711A(pcm)); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.WriteFrame(codec.CODECID_AUDIO_AAC, []byte{1, 2, 3}); err == nil {
+		t.Fatal("expect error when codec mismatch")
+	}
+	w.Close()
+
+	r := CreateWavReader(bytes.NewReader(f.buf))
+	if err := r.ReadHeader(); err != nil {
+		t.Fatal(err)
+	}
+	var pts []uint64
+	var all []byte
+	for {
+		frame, p, err := r.ReadFrame(160)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Fatal(err)
+		}
+		pts = append(pts, p)
+		all = append(all, frame...)
+	}
+	if !reflect.DeepEqual(pts, []uint64{0, 20, 40, 60, 80, 100, 120}) {
+		t.Errorf("pts = %v", pts)
+	}
+	decoded, err := r.Format.ToInt16(all)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decoded) != len(pcm) {
+		t.Fatalf("decoded %d samples, want %d", len(decoded), len(pcm))
+	}
+	for i := range pcm {
+		if d := int(decoded[i]) - int(pcm[i]); d > 512 || d < -512 {
+			t.Fatalf("sample %d = %d, want %d", i, decoded[i], pcm[i])
+		}
+	}
+}
+
+func TestWavReader_SkipChunk(t *testing.T) {
+	format := NewPCMFormat(8000, 1, 16)
+	fmtChunk := format.Encode()
+	var file []byte
+	file = append(file, "RIFF\x00\x00\x00\x00WAVE"...)
+	file = append(file, "LIST\x03\x00\x00\x00abc\x00"...)
+	file = append(file, "fmt \x10\x00\x00\x00"...)
+	file = append(file, fmtChunk...)
+	file = append(file, "data\x04\x00\x00\x00\x01\x02\x03\x04"...)
+	file = append(file, "LIST\x04\x00\x00\x00abcd"...)
+	r := CreateWavReader(bytes.NewReader(file))
+	if err := r.ReadHeader(); err != nil {
+		t.Fatal(err)
+	}
+	content, _ := io.ReadAll(r)
+	if !bytes.Equal(content, []byte{1, 2, 3, 4}) {
+		t.Errorf("data = %v", content)
+	}
+	pcm, _ := r.Format.ToInt16(content)
+	if !reflect.DeepEqual(pcm, []int16{0x0201, 0x0403}) {
+		t.Errorf("pcm = %v", pcm)
+	}
+}
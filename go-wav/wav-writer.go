@@ -0,0 +1,200 @@
+package wav
+
+import (
+    "encoding/binary"
+    "errors"
+    "io"
+
+    "github.com/yapingcat/gomedia/go-codec"
+)
+
+// 超过这个大小时改写为RF64, 测试时可以修改
+var maxRiffSize uint64 = RIFF_MAX_SIZE
+
+// 预留给ds64的JUNK chunk, 大小与ds64 chunk(不带table)一致
+const ds64ChunkSize = 28
+
+type WavWriter struct {
+    w          io.Writer
+    format     *WavFormat
+    headerLen  int
+    dataSize   uint64
+    baseOffset int64
+    hasHeader  bool
+    closed     bool
+}
+
+// CreateWavWriter 如果w实现了io.WriteSeeker, Close时会回写RIFF/data的大小(必要时改写为RF64),
+// 否则大小字段为0xFFFFFFFF, WavReader会读到EOF为止
+func CreateWavWriter(w io.Writer, format *WavFormat) *WavWriter {
+    return &WavWriter{w: w, format: format}
+}
+
+func (writer *WavWriter) Format() *WavFormat {
+    return writer.format
+}
+
+func (writer *WavWriter) DataSize() uint64 {
+    return writer.dataSize
+}
+
+func (writer *WavWriter) makeHeader(rf64 bool, riffSize uint64, dataSize uint64) []byte {
+    fmtChunk := writer.format.Encode()
+    hdr := make([]byte, 0, 12+8+ds64ChunkSize+8+len(fmtChunk)+12+8)
+    tmp := make([]byte, 8)
+    putChunk := func(id string, size uint32) {
+        binary.LittleEndian.PutUint32(tmp, size)
+        hdr = append(hdr, id...)
+        hdr = append(hdr, tmp[:4]...)
+    }
+    if rf64 {
+        putChunk("RF64", RIFF_MAX_SIZE)
+    } else {
+        putChunk("RIFF", uint32(riffSize))
+    }
+    hdr = append(hdr, "WAVE"...)
+    if rf64 {
+        putChunk("ds64", ds64ChunkSize)
+        binary.LittleEndian.PutUint64(tmp, riffSize)
+        hdr = append(hdr, tmp...)
+        binary.LittleEndian.PutUint64(tmp, dataSize)
+        hdr = append(hdr, tmp...)
+        binary.LittleEndian.PutUint64(tmp, writer.sampleCount(dataSize))
+        hdr = append(hdr, tmp...)
+        hdr = append(hdr, 0, 0, 0, 0) //table length
+    } else {
+        putChunk("JUNK", ds64ChunkSize)
+        hdr = append(hdr, make([]byte, ds64ChunkSize)...)
+    }
+    putChunk("fmt ", uint32(len(fmtChunk)))
+    hdr = append(hdr, fmtChunk...)
+    //非PCM格式需要fact chunk
+    if !writer.format.isPCM() {
+        putChunk("fact", 4)
+        sampleCount := writer.sampleCount(dataSize)
+        if rf64 || dataSize == RIFF_MAX_SIZE {
+            sampleCount = RIFF_MAX_SIZE
+        }
+        binary.LittleEndian.PutUint32(tmp, uint32(sampleCount))
+        hdr = append(hdr, tmp[:4]...)
+    }
+    if rf64 {
+        putChunk("data", RIFF_MAX_SIZE)
+    } else {
+        putChunk("data", uint32(dataSize))
+    }
+    return hdr
+}
+
+func (writer *WavWriter) sampleCount(dataSize uint64) uint64 {
+    if writer.format.BlockAlign == 0 {
+        return 0
+    }
+    return dataSize / uint64(writer.format.BlockAlign) * uint64(writer.format.SamplesPerBlock())
+}
+
+func (writer *WavWriter) writeHeader() error {
+    if ws, ok := writer.w.(io.WriteSeeker); ok {
+        offset, err := ws.Seek(0, io.SeekCurrent)
+        if err != nil {
+            return err
+        }
+        writer.baseOffset = offset
+    }
+    hdr := writer.makeHeader(false, RIFF_MAX_SIZE, RIFF_MAX_SIZE)
+    writer.headerLen = len(hdr)
+    _, err := writer.w.Write(hdr)
+    return err
+}
+
+// Write 写入原始数据, 多声道数据需要交错存放, 长度应该是BlockAlign的整数倍
+func (writer *WavWriter) Write(data []byte) (int, error) {
+    if writer.closed {
+        return 0, errors.New("wav writer has been closed")
+    }
+    if !writer.hasHeader {
+        if err := writer.writeHeader(); err != nil {
+            return 0, err
+        }
+        writer.hasHeader = true
+    }
+    n, err := writer.w.Write(data)
+    writer.dataSize += uint64(n)
+    return n, err
+}
+
+// WriteFrame 写入FLV/TS/PS等demuxer输出的音频帧, cid必须与WavFormat一致
+// G711A与G711U之间会自动转换
+func (writer *WavWriter) WriteFrame(cid codec.CodecID, frame []byte) error {
+    fcid := writer.format.CodecID()
+    switch {
+    case fcid == cid:
+    case fcid == codec.CODECID_AUDIO_G711A && cid == codec.CODECID_AUDIO_G711U:
+        frame = codec.G711UToG711A(frame)
+    case fcid == codec.CODECID_AUDIO_G711U && cid == codec.CODECID_AUDIO_G711A:
+        frame = codec.G711AToG711U(frame)
+    default:
+        return errors.New("wav format mismatch codec " + codec.CodecString(cid))
+    }
+    _, err := writer.Write(frame)
+    return err
+}
+
+// WritePCM 将16bit PCM按照WavFormat编码后写入, 支持PCM 16bit, ALAW, MULAW
+func (writer *WavWriter) WritePCM(pcm []int16) error {
+    var data []byte
+    switch {
+    case writer.format.FormatTag == WAVE_FORMAT_PCM && writer.format.BitsPerSample == 16:
+        data = codec.EncodePCMS16LE(pcm)
+    case writer.format.FormatTag == WAVE_FORMAT_ALAW:
+        data = codec.EncodeG711A(pcm)
+    case writer.format.FormatTag == WAVE_FORMAT_MULAW:
+        data = codec.EncodeG711U(pcm)
+    default:
+        return errUnsupportFormat
+    }
+    _, err := writer.Write(data)
+    return err
+}
+
+// Close 写入data chunk的补齐字节, 并回写头部中的大小
+func (writer *WavWriter) Close() error {
+    if writer.closed {
+        return nil
+    }
+    writer.closed = true
+    if !writer.hasHeader {
+        if err := writer.writeHeader(); err != nil {
+            return err
+        }
+        writer.hasHeader = true
+    }
+    if writer.dataSize&1 == 1 {
+        if _, err := writer.w.Write([]byte{0}); err != nil {
+            return err
+        }
+    }
+    ws, ok := writer.w.(io.WriteSeeker)
+    if !ok {
+        return nil
+    }
+    riffSize := uint64(writer.headerLen) - 8 + writer.dataSize + writer.dataSize&1
+    var hdr []byte
+    if riffSize > maxRiffSize || writer.dataSize > maxRiffSize {
+        hdr = writer.makeHeader(true, riffSize, writer.dataSize)
+    } else {
+        hdr = writer.makeHeader(false, riffSize, writer.dataSize)
+    }
+    end, err := ws.Seek(0, io.SeekCurrent)
+    if err != nil {
+        return err
+    }
+    if _, err = ws.Seek(writer.baseOffset, io.SeekStart); err != nil {
+        return err
+    }
+    if _, err = ws.Write(hdr); err != nil {
+        return err
+    }
+    _, err = ws.Seek(end, io.SeekStart)
+    return err
+}